@@ -0,0 +1,362 @@
+// Package abuse protects the API against credential guessing and flags
+// unusual bursts of refused requests. Failed authentications (401s) are
+// counted per client address and per claimed user in the shared cache;
+// once either reaches the limit it is locked out, for twice as long at
+// each lockout within a day. Separately, each replica watches its rate of
+// 401 and 403 responses and reports a spike when a minute's count jumps
+// well above the recent baseline. Lockouts and spikes are security events:
+// they are published on the event bus and written to the audit log.
+package abuse
+
+import (
+	"context"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/cache"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+// Event types published on the bus.
+const (
+	EventLockout = "security.lockout"
+	EventAnomaly = "security.anomaly"
+)
+
+// strikeTTL is how long a lockout counts towards doubling the next one.
+const strikeTTL = 24 * time.Hour
+
+// bucket is the period refused responses are counted over for spikes.
+const bucket = time.Minute
+
+// smoothing weighs each finished bucket into the baseline.
+const smoothing = 0.2
+
+var (
+	failuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "abuse_refused_responses_total",
+		Help: "API responses refusing the caller by status (401 or 403).",
+	}, []string{"status"})
+	lockoutsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "abuse_lockouts_total",
+		Help: "Lockouts after repeated failed authentication by scope (ip or user).",
+	}, []string{"scope"})
+	rejectedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "abuse_rejected_requests_total",
+		Help: "Requests refused because their client address or user was locked out.",
+	})
+	anomaliesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "abuse_anomalies_total",
+		Help: "Spikes of refused responses by status (401 or 403).",
+	}, []string{"status"})
+)
+
+// Options configures a Guard.
+type Options struct {
+	// UserHeader carries the caller's claimed user.
+	UserHeader string
+	// MaxFailures failed authentications within FailureWindow lock a
+	// client address or user out for Lockout, doubling with each lockout
+	// within a day up to MaxLockout.
+	MaxFailures   int
+	FailureWindow time.Duration
+	Lockout       time.Duration
+	MaxLockout    time.Duration
+	// A minute with at least SpikeMin responses of a refusing status, and
+	// SpikeFactor times the usual number, is a spike. Zero SpikeMin turns
+	// spike detection off.
+	SpikeMin    int
+	SpikeFactor float64
+}
+
+// Guard locks out callers failing to authenticate and detects spikes.
+type Guard struct {
+	cache  cache.Cache
+	bus    events.Publisher
+	audit  store.AuditRepository
+	opts   Options
+	logger *zap.Logger
+	now    func() time.Time
+
+	mu       sync.Mutex
+	start    time.Time
+	counts   map[int]int
+	baseline map[int]float64
+	flagged  map[int]bool
+}
+
+// New creates a guard keeping failure counts and lockouts in c, so that
+// they hold across replicas.
+func New(c cache.Cache, bus events.Publisher, audit store.AuditRepository, opts Options, logger *zap.Logger) *Guard {
+	if opts.MaxFailures <= 0 {
+		opts.MaxFailures = 10
+	}
+	if opts.FailureWindow <= 0 {
+		opts.FailureWindow = 10 * time.Minute
+	}
+	if opts.Lockout <= 0 {
+		opts.Lockout = time.Minute
+	}
+	if opts.MaxLockout < opts.Lockout {
+		opts.MaxLockout = opts.Lockout
+	}
+	if opts.SpikeFactor < 1 {
+		opts.SpikeFactor = 1
+	}
+	return &Guard{
+		cache:    c,
+		bus:      bus,
+		audit:    audit,
+		opts:     opts,
+		logger:   logger,
+		now:      time.Now,
+		counts:   make(map[int]int),
+		baseline: make(map[int]float64),
+		flagged:  make(map[int]bool),
+	}
+}
+
+// statusWriter records the response status.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	if sw.status == 0 {
+		sw.status = code
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+// ReadFrom keeps sendfile(2) available to handlers serving files.
+func (sw *statusWriter) ReadFrom(src io.Reader) (int64, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return io.Copy(sw.ResponseWriter, src)
+}
+
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// Middleware answers 429 to locked-out callers and watches the responses
+// of the rest. Mount it outside the authentication middleware, so that it
+// sees their 401s. Cache failures let requests through.
+func (g *Guard) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys := g.keys(r)
+		if wait := g.locked(r.Context(), keys); wait > 0 {
+			rejectedTotal.Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, `{"error":"too many failed authentication attempts"}`, http.StatusTooManyRequests)
+			return
+		}
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		switch sw.status {
+		case http.StatusUnauthorized:
+			g.observe(r.Context(), sw.status)
+			for _, key := range keys {
+				g.fail(r, key)
+			}
+		case http.StatusForbidden:
+			g.observe(r.Context(), sw.status)
+		}
+	})
+}
+
+// keys returns the failure keys of r: its client address, and its user
+// when it claims one.
+func (g *Guard) keys(r *http.Request) []string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	keys := []string{"ip:" + host}
+	if user := r.Header.Get(g.opts.UserHeader); user != "" {
+		keys = append(keys, "user:"+user)
+	}
+	return keys
+}
+
+// locked returns how much longer the longest lockout among keys lasts.
+func (g *Guard) locked(ctx context.Context, keys []string) time.Duration {
+	var wait time.Duration
+	for _, key := range keys {
+		b, err := g.cache.Get(ctx, "abuse:lock:"+key)
+		if err != nil {
+			continue
+		}
+		until, err := strconv.ParseInt(string(b), 10, 64)
+		if err != nil {
+			continue
+		}
+		wait = max(wait, time.Unix(until, 0).Sub(g.now()))
+	}
+	return wait
+}
+
+// fail counts a failed authentication against key and locks it out at the
+// limit.
+func (g *Guard) fail(r *http.Request, key string) {
+	ctx := context.WithoutCancel(r.Context())
+	n, err := g.cache.Incr(ctx, "abuse:failures:"+key, g.opts.FailureWindow)
+	if err != nil {
+		g.logger.Warn("abuse cache unavailable", zap.Error(err))
+		return
+	}
+	if n < int64(g.opts.MaxFailures) {
+		return
+	}
+	strikes, err := g.cache.Incr(ctx, "abuse:strikes:"+key, strikeTTL)
+	if err != nil {
+		g.logger.Warn("abuse cache unavailable", zap.Error(err))
+		return
+	}
+	d := g.lockout(strikes)
+	until := g.now().Add(d)
+	if err := g.cache.Set(ctx, "abuse:lock:"+key, []byte(strconv.FormatInt(until.Unix(), 10)), d); err != nil {
+		g.logger.Warn("failed to store lockout", zap.String("key", key), zap.Error(err))
+		return
+	}
+	g.cache.Delete(ctx, "abuse:failures:"+key)
+
+	scope, subject, _ := strings.Cut(key, ":")
+	lockoutsTotal.WithLabelValues(scope).Inc()
+	g.logger.Warn("locked out after failed authentication",
+		zap.String("audit", "abuse"),
+		zap.String("request_id", middleware.GetRequestID(ctx)),
+		zap.String(scope, subject),
+		zap.Int64("failures", n),
+		zap.Duration("lockout", d),
+	)
+	g.report(ctx, EventLockout, &store.AuditEvent{
+		Actor:     subject,
+		Action:    EventLockout,
+		Resource:  key,
+		Outcome:   "locked",
+		RequestID: middleware.GetRequestID(ctx),
+		Details: map[string]string{
+			"failures": strconv.FormatInt(n, 10),
+			"lockout":  d.String(),
+			"until":    until.UTC().Format(time.RFC3339),
+		},
+	})
+}
+
+// lockout returns the duration of the nth lockout within strikeTTL.
+func (g *Guard) lockout(n int64) time.Duration {
+	d := g.opts.Lockout
+	for i := int64(1); i < n && d < g.opts.MaxLockout; i++ {
+		d *= 2
+	}
+	return min(d, g.opts.MaxLockout)
+}
+
+// observe counts a refused response and reports a spike the first time
+// the current minute's count of status exceeds the threshold.
+func (g *Guard) observe(ctx context.Context, status int) {
+	label := strconv.Itoa(status)
+	failuresTotal.WithLabelValues(label).Inc()
+	if g.opts.SpikeMin <= 0 {
+		return
+	}
+
+	g.mu.Lock()
+	now := g.now()
+	g.roll(now)
+	g.counts[status]++
+	count := g.counts[status]
+	baseline := g.baseline[status]
+	spike := !g.flagged[status] && count >= g.opts.SpikeMin && float64(count) >= g.opts.SpikeFactor*baseline
+	if spike {
+		g.flagged[status] = true
+	}
+	g.mu.Unlock()
+	if !spike {
+		return
+	}
+
+	anomaliesTotal.WithLabelValues(label).Inc()
+	g.logger.Warn("spike of refused responses",
+		zap.String("audit", "abuse"),
+		zap.Int("status", status),
+		zap.Int("count", count),
+		zap.Float64("baseline", baseline),
+	)
+	g.report(context.WithoutCancel(ctx), EventAnomaly, &store.AuditEvent{
+		Actor:    "system",
+		Action:   EventAnomaly,
+		Resource: "status:" + label,
+		Outcome:  "detected",
+		Details: map[string]string{
+			"count":    strconv.Itoa(count),
+			"baseline": strconv.FormatFloat(baseline, 'f', 1, 64),
+			"window":   bucket.String(),
+		},
+	})
+}
+
+// roll starts a new bucket once the current one is over, folding the
+// finished ones into the baseline. Callers hold g.mu.
+func (g *Guard) roll(now time.Time) {
+	current := now.Truncate(bucket)
+	if current.Sub(g.start) > time.Hour {
+		// New, or idle for long enough that the baseline has decayed away
+		clear(g.counts)
+		clear(g.flagged)
+		clear(g.baseline)
+		g.start = current
+		return
+	}
+	for g.start.Before(current) {
+		for status := range g.baseline {
+			g.baseline[status] *= 1 - smoothing
+		}
+		for status, n := range g.counts {
+			g.baseline[status] += smoothing * float64(n)
+		}
+		clear(g.counts)
+		clear(g.flagged)
+		g.start = g.start.Add(bucket)
+	}
+}
+
+// report publishes a security event and records it in the audit log.
+func (g *Guard) report(ctx context.Context, eventType string, ev *store.AuditEvent) {
+	e, err := events.New(eventType, "abuse", map[string]any{
+		"subject": ev.Actor,
+		"key":     ev.Resource,
+		"details": ev.Details,
+	})
+	if err == nil {
+		if err := g.bus.Publish(ctx, e); err != nil {
+			g.logger.Warn("failed to publish security event", zap.Error(err))
+		}
+	}
+	if err := g.audit.Record(ctx, ev); err != nil {
+		g.logger.Warn("failed to record security event", zap.Error(err))
+	}
+}
@@ -0,0 +1,109 @@
+package abuse
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/cache"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+func newGuard(t *testing.T, opts Options) (*Guard, *cache.Memory, *store.Store, *[]events.Event) {
+	t.Helper()
+	c := cache.NewMemory()
+	st := store.NewMemory()
+	bus := events.NewMemoryBus()
+	var published []events.Event
+	bus.Subscribe(func(_ context.Context, e events.Event) { published = append(published, e) })
+	opts.UserHeader = "X-Forwarded-User"
+	return New(c, bus, st.Audit, opts, zap.NewNop()), c, st, &published
+}
+
+func TestLockout(t *testing.T) {
+	g, c, st, published := newGuard(t, Options{MaxFailures: 3, Lockout: time.Minute, MaxLockout: 3 * time.Minute})
+	h := g.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer good" {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+		}
+	}))
+	call := func(auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/tenants", nil)
+		req.RemoteAddr = "10.0.0.7:4711"
+		req.Header.Set("Authorization", "Bearer "+auth)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := range 3 {
+		if rec := call("guess"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status %d, want 401", i+1, rec.Code)
+		}
+	}
+	// Locked out, even with a valid token
+	rec := call("good")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "60" {
+		t.Fatalf("locked: status %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if len(*published) != 1 || (*published)[0].Type != EventLockout {
+		t.Fatalf("published %+v, want one lockout", *published)
+	}
+	audit, err := st.Audit.List(t.Context(), store.AuditFilter{})
+	if err != nil || len(audit) != 1 || audit[0].Action != EventLockout || audit[0].Resource != "ip:10.0.0.7" {
+		t.Fatalf("audit = %+v, %v", audit, err)
+	}
+
+	// The next lockout within a day lasts twice as long, up to the maximum
+	for _, want := range []string{"120", "180"} {
+		c.Delete(t.Context(), "abuse:lock:ip:10.0.0.7")
+		if rec := call("good"); rec.Code != http.StatusOK {
+			t.Fatalf("after lockout: status %d", rec.Code)
+		}
+		for range 3 {
+			call("guess")
+		}
+		if rec := call("good"); rec.Header().Get("Retry-After") != want {
+			t.Fatalf("Retry-After %q, want %s", rec.Header().Get("Retry-After"), want)
+		}
+	}
+}
+
+func TestSpikes(t *testing.T) {
+	g, _, _, published := newGuard(t, Options{SpikeMin: 10, SpikeFactor: 3})
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	g.now = func() time.Time { return now }
+	status := http.StatusForbidden
+	h := g.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	send := func(n int) {
+		for range n {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/tenants", nil)
+			h.ServeHTTP(httptest.NewRecorder(), req)
+		}
+	}
+
+	// A steady 8 denials a minute is the baseline, not a spike
+	for range 10 {
+		send(8)
+		now = now.Add(time.Minute)
+	}
+	if len(*published) != 0 {
+		t.Fatalf("published %+v during steady traffic", *published)
+	}
+	send(20)
+	if len(*published) != 0 {
+		t.Fatalf("published %+v below %.0fx the baseline", *published, g.opts.SpikeFactor)
+	}
+	// Reported once per minute
+	send(30)
+	if len(*published) != 1 || (*published)[0].Type != EventAnomaly {
+		t.Fatalf("published %+v, want one anomaly", *published)
+	}
+}
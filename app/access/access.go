@@ -0,0 +1,277 @@
+// Package access lets routes declare what their callers need, next to
+// where they are registered:
+//
+//	mux.Handle("POST /api/v1/tokens", access.Protect(h, access.RequireClaim("auth", "proxy", "session")))
+//
+// Requirements are checked in one place, against the Caller the
+// middleware resolves: the identity, the scopes the caller holds and the
+// claims the authenticators recorded. Refusals are RFC 9457 problem
+// documents and are counted per requirement.
+package access
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/rbac"
+)
+
+var denialsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "access_denials_total",
+	Help: "Requests refused by route requirements by kind (scope, claim or unauthenticated) and name.",
+}, []string{"kind", "name"})
+
+// Caller is who a request acts as, as far as route requirements go.
+type Caller struct {
+	User   string
+	Groups []string
+	// Claims are attributes of the caller: "sub" and "groups", "auth"
+	// naming how the caller authenticated (proxy, session, token or
+	// spiffe), and whatever else the authenticator recorded.
+	Claims map[string][]string
+
+	// scopes are the caller's credential's scopes; nil when the
+	// credential is not limited by scopes.
+	scopes []string
+	// grants returns the permissions of the caller's roles; nil when
+	// platform roles are off.
+	grants func() ([]string, error)
+}
+
+type claimsKey struct{}
+
+type scopesKey struct{}
+
+// WithClaims records claims about the caller in ctx, adding to those
+// recorded before. Authenticators call it.
+func WithClaims(ctx context.Context, claims map[string]string) context.Context {
+	merged := make(map[string]string)
+	if prev, ok := ctx.Value(claimsKey{}).(map[string]string); ok {
+		for k, v := range prev {
+			merged[k] = v
+		}
+	}
+	for k, v := range claims {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, claimsKey{}, merged)
+}
+
+// WithScopes records that the caller's credential is limited to scopes.
+func WithScopes(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, scopesKey{}, slices.Clone(scopes))
+}
+
+// Options configures the middleware.
+type Options struct {
+	// UserHeader and GroupsHeader carry the caller's identity.
+	UserHeader   string
+	GroupsHeader string
+	// Grants returns the permissions of id's roles, which bound the scopes
+	// of every caller. Without it, callers whose credential has no scopes
+	// hold them all.
+	Grants func(ctx context.Context, id authz.Identity) ([]string, error)
+}
+
+// Resolver resolves callers for Protect.
+type Resolver struct {
+	headers authz.Headers
+	grants  func(ctx context.Context, id authz.Identity) ([]string, error)
+	logger  *zap.Logger
+}
+
+type resolverKey struct{}
+
+// New creates a resolver.
+func New(opts Options, logger *zap.Logger) *Resolver {
+	return &Resolver{
+		headers: authz.Headers{User: opts.UserHeader, Groups: opts.GroupsHeader},
+		grants:  opts.Grants,
+		logger:  logger,
+	}
+}
+
+// Middleware makes the resolver available to protected routes. Mount it
+// inside the authentication middleware, whose identity and claims it
+// reads.
+func (res *Resolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), resolverKey{}, res)))
+	})
+}
+
+// caller resolves r's caller. Role permissions are only looked up when a
+// scope is checked.
+func (res *Resolver) caller(r *http.Request) *Caller {
+	id := res.headers.Identity(r)
+	c := &Caller{
+		User:   id.User,
+		Groups: id.Groups,
+		Claims: map[string][]string{"sub": {id.User}, "groups": id.Groups},
+	}
+	if claims, ok := r.Context().Value(claimsKey{}).(map[string]string); ok {
+		for k, v := range claims {
+			c.Claims[k] = []string{v}
+		}
+	}
+	c.scopes, _ = r.Context().Value(scopesKey{}).([]string)
+	if res.grants != nil {
+		c.grants = sync.OnceValues(func() ([]string, error) {
+			return res.grants(r.Context(), id)
+		})
+	}
+	return c
+}
+
+// Holds reports whether c holds scope: its credential's scopes, if
+// limited, and its roles' permissions, with platform roles on, must both
+// grant it. Scopes are matched like permissions: "*" and "tenants:*"
+// grant "tenants:read".
+func (c *Caller) Holds(scope string) (bool, error) {
+	if c.scopes != nil && !(rbac.Role{Permissions: c.scopes}).Grants(scope) {
+		return false, nil
+	}
+	if c.grants == nil {
+		return true, nil
+	}
+	perms, err := c.grants()
+	if err != nil {
+		return false, err
+	}
+	return rbac.Role{Permissions: perms}.Grants(scope), nil
+}
+
+// Requirement is what a route needs of its callers.
+type Requirement struct {
+	conds []condition
+}
+
+// condition is a single scope or claim a Requirement checks.
+type condition struct {
+	kind string
+	name string
+	// describe words the condition for problem details.
+	describe string
+	check    func(*Caller) (bool, error)
+}
+
+// RequireScopes requires each of scopes.
+func RequireScopes(scopes ...string) Requirement {
+	var req Requirement
+	for _, scope := range scopes {
+		req.conds = append(req.conds, condition{
+			kind:     "scope",
+			name:     scope,
+			describe: "scope " + scope,
+			check:    func(c *Caller) (bool, error) { return c.Holds(scope) },
+		})
+	}
+	return req
+}
+
+// RequireClaim requires the claim name to have one of values, or, without
+// values, to be present and not empty.
+func RequireClaim(name string, values ...string) Requirement {
+	describe := "claim " + name
+	if len(values) > 0 {
+		describe += " of " + strings.Join(values, ", ")
+	}
+	return Requirement{conds: []condition{{
+		kind:     "claim",
+		name:     name,
+		describe: describe,
+		check: func(c *Caller) (bool, error) {
+			for _, v := range c.Claims[name] {
+				if v != "" && (len(values) == 0 || slices.Contains(values, v)) {
+					return true, nil
+				}
+			}
+			return false, nil
+		},
+	}}}
+}
+
+// Protect serves h to callers meeting every requirement, and refuses the
+// others: 401 without an identity, 403 otherwise. Routes served outside
+// the resolver's middleware are refused too, with 500, rather than left
+// open.
+func Protect(h http.Handler, reqs ...Requirement) http.Handler {
+	var conds []condition
+	for _, req := range reqs {
+		conds = append(conds, req.conds...)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, ok := r.Context().Value(resolverKey{}).(*Resolver)
+		if !ok {
+			writeProblem(w, r, http.StatusInternalServerError, "route protection is not configured", nil)
+			return
+		}
+		c := res.caller(r)
+		if c.User == "" {
+			denialsTotal.WithLabelValues("unauthenticated", "").Inc()
+			writeProblem(w, r, http.StatusUnauthorized, "authentication required", nil)
+			return
+		}
+		var missing []string
+		for _, cond := range conds {
+			ok, err := cond.check(c)
+			if err != nil {
+				res.logger.Error("failed to check route requirement",
+					zap.String("request_id", middleware.GetRequestID(r.Context())),
+					zap.String(cond.kind, cond.name), zap.Error(err))
+				writeProblem(w, r, http.StatusInternalServerError, "internal error", nil)
+				return
+			}
+			if !ok {
+				denialsTotal.WithLabelValues(cond.kind, cond.name).Inc()
+				missing = append(missing, cond.describe)
+			}
+		}
+		if len(missing) > 0 {
+			res.logger.Warn("request denied",
+				zap.String("audit", "access"),
+				zap.String("request_id", middleware.GetRequestID(r.Context())),
+				zap.String("user", c.User),
+				zap.Strings("groups", c.Groups),
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.Strings("missing", missing))
+			writeProblem(w, r, http.StatusForbidden, "requires "+strings.Join(missing, "; "), missing)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// problem is an RFC 9457 problem document.
+type problem struct {
+	Type     string   `json:"type"`
+	Title    string   `json:"title"`
+	Status   int      `json:"status"`
+	Detail   string   `json:"detail"`
+	Instance string   `json:"instance"`
+	Missing  []string `json:"missing,omitempty"`
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, detail string, missing []string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	codec.Encode(w, problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Missing:  missing,
+	})
+}
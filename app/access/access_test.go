@@ -0,0 +1,139 @@
+package access
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+)
+
+func TestProtect(t *testing.T) {
+	res := New(Options{
+		UserHeader:   "X-Forwarded-User",
+		GroupsHeader: "X-Forwarded-Groups",
+		Grants: func(_ context.Context, id authz.Identity) ([]string, error) {
+			if slices.Contains(id.Groups, "operators") {
+				return []string{"tenants:*", "audit:verify"}, nil
+			}
+			return []string{"tenants:read"}, nil
+		},
+	}, zap.NewNop())
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	mux := http.NewServeMux()
+	mux.Handle("GET /tenants", Protect(ok, RequireScopes("tenants:read")))
+	mux.Handle("POST /verify", Protect(ok, RequireScopes("tenants:write", "audit:verify")))
+	mux.Handle("POST /tokens", Protect(ok, RequireClaim("auth", "proxy", "session")))
+	// A token limited to tenants:read, as the tokens middleware records it
+	asToken := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "" {
+				ctx := WithClaims(r.Context(), map[string]string{"auth": "token"})
+				r = r.WithContext(WithScopes(ctx, []string{"tenants:read"}))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	headers := authz.Headers{User: "X-Forwarded-User", Groups: "X-Forwarded-Groups"}
+	proxies, err := ParseProxies([]string{"192.0.2.0/24"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := TrustProxy(headers, proxies, asToken(res.Middleware(mux)))
+
+	tests := []struct {
+		name, method, path, groups string
+		token                      bool
+		want                       int
+		missing                    []string
+	}{
+		{"role grants the scope", http.MethodGet, "/tenants", "developers", false, http.StatusOK, nil},
+		{"role lacks scopes", http.MethodPost, "/verify", "developers", false, http.StatusForbidden,
+			[]string{"scope tenants:write", "scope audit:verify"}},
+		{"role grants both scopes", http.MethodPost, "/verify", "operators", false, http.StatusOK, nil},
+		{"token limits the role", http.MethodPost, "/verify", "operators", true, http.StatusForbidden,
+			[]string{"scope tenants:write", "scope audit:verify"}},
+		{"token within its scopes", http.MethodGet, "/tenants", "operators", true, http.StatusOK, nil},
+		{"interactive claim", http.MethodPost, "/tokens", "developers", false, http.StatusOK, nil},
+		{"token lacks the claim", http.MethodPost, "/tokens", "operators", true, http.StatusForbidden,
+			[]string{"claim auth of proxy, session"}},
+		{"anonymous", http.MethodGet, "/tenants", "", false, http.StatusUnauthorized, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.groups != "" {
+				req.Header.Set("X-Forwarded-User", "alice")
+				req.Header.Set("X-Forwarded-Groups", tt.groups)
+			}
+			if tt.token {
+				req.Header.Set("Authorization", "Bearer plt_x")
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if tt.want == http.StatusOK {
+				return
+			}
+			var p problem
+			if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&p); err != nil || p.Status != tt.want || p.Instance != tt.path ||
+				!slices.Equal(p.Missing, tt.missing) {
+				t.Errorf("problem = %+v, %v", p, err)
+			}
+		})
+	}
+
+	// Protected routes outside the middleware fail closed
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tenants", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("without the middleware: status %d", rec.Code)
+	}
+}
+
+func TestTrustProxy(t *testing.T) {
+	headers := authz.Headers{User: "X-Forwarded-User", Groups: "X-Forwarded-Groups"}
+	proxies, err := ParseProxies([]string{"10.0.0.0/8"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := New(Options{UserHeader: headers.User, GroupsHeader: headers.Groups}, zap.NewNop())
+	mux := http.NewServeMux()
+	mux.Handle("POST /tokens", Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		RequireClaim("auth", "proxy", "session")))
+	h := TrustProxy(headers, proxies, res.Middleware(mux))
+
+	for _, tt := range []struct {
+		name, remote string
+		want         int
+	}{
+		{"from the proxy", "10.1.2.3:4567", http.StatusOK},
+		{"spoofed by a client", "192.0.2.1:1234", http.StatusUnauthorized},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/tokens", nil)
+			req.RemoteAddr = tt.remote
+			req.Header.Set("X-Forwarded-User", "admin")
+			req.Header.Set("X-Forwarded-Groups", "platform-admins")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+
+	if _, err := ParseProxies([]string{"proxy"}, false); err == nil {
+		t.Error("expected an invalid CIDR refused")
+	}
+}
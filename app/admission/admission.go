@@ -0,0 +1,265 @@
+// Package admission implements the validating and mutating admission
+// webhooks that enforce platform policy (required labels, image registry
+// allowlists, default labels) on workloads as they are created or updated.
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+)
+
+// maxReviewBytes bounds an AdmissionReview body; the API server caps
+// objects at roughly 3 MiB.
+const maxReviewBytes = 4 << 20
+
+var reviewsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "admission_reviews_total",
+	Help: "Admission reviews by webhook, resource kind, and decision.",
+}, []string{"webhook", "kind", "decision"})
+
+// External is an additional validation, such as a policy engine, consulted
+// after the built-in policy. An error with allowed true admits the object
+// anyway (failing open); with allowed false, reason explains the denial.
+type External func(ctx context.Context, req *admissionv1.AdmissionRequest) (allowed bool, reason string, err error)
+
+// Webhook serves the admission endpoints.
+type Webhook struct {
+	policy   *Policy
+	external External
+	logger   *zap.Logger
+}
+
+// New creates a webhook enforcing policy.
+func New(policy *Policy, logger *zap.Logger) *Webhook {
+	return &Webhook{policy: policy, logger: logger}
+}
+
+// UseExternal makes the validate endpoint also consult fn.
+func (wh *Webhook) UseExternal(fn External) {
+	wh.external = fn
+}
+
+// Handler returns the mux for the admission listener: POST /validate and
+// POST /mutate, plus /healthz for the API server's connectivity checks.
+func (wh *Webhook) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /validate", wh.serve("validate", wh.validate))
+	mux.HandleFunc("POST /mutate", wh.serve("mutate", wh.mutate))
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return mux
+}
+
+type reviewFunc func(ctx context.Context, req *admissionv1.AdmissionRequest, obj *object) *admissionv1.AdmissionResponse
+
+// serve decodes an AdmissionReview, runs fn, and writes the response review.
+func (wh *Webhook) serve(name string, fn reviewFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+			http.Error(w, "expected application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxReviewBytes))
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+
+		var review admissionv1.AdmissionReview
+		if err := json.Unmarshal(body, &review); err != nil || review.Request == nil {
+			http.Error(w, "invalid AdmissionReview", http.StatusBadRequest)
+			return
+		}
+		req := review.Request
+
+		var resp *admissionv1.AdmissionResponse
+		obj, err := decodeObject(req.Kind.Kind, req.Object.Raw)
+		switch {
+		case err != nil:
+			resp = deny(fmt.Sprintf("cannot decode %s: %v", req.Kind.Kind, err))
+		case obj == nil || wh.policy.exempt(req.Namespace):
+			resp = &admissionv1.AdmissionResponse{Allowed: true}
+		default:
+			resp = fn(r.Context(), req, obj)
+		}
+		resp.UID = req.UID
+
+		decision := "allowed"
+		if !resp.Allowed {
+			decision = "denied"
+			wh.logger.Info("admission denied",
+				zap.String("audit", "admission"),
+				zap.String("webhook", name),
+				zap.String("kind", req.Kind.Kind),
+				zap.String("namespace", req.Namespace),
+				zap.String("name", req.Name),
+				zap.String("user", req.UserInfo.Username),
+				zap.String("reason", resp.Result.Message),
+			)
+		}
+		reviewsTotal.WithLabelValues(name, req.Kind.Kind, decision).Inc()
+
+		w.Header().Set("Content-Type", "application/json")
+		codec.Encode(w, admissionv1.AdmissionReview{
+			TypeMeta: review.TypeMeta,
+			Response: resp,
+		})
+	}
+}
+
+func (wh *Webhook) validate(ctx context.Context, req *admissionv1.AdmissionRequest, obj *object) *admissionv1.AdmissionResponse {
+	if v := wh.policy.violations(obj.labels, obj.images); len(v) > 0 {
+		return deny(strings.Join(v, "; "))
+	}
+	if wh.external != nil {
+		allowed, reason, err := wh.external(ctx, req)
+		if err != nil {
+			wh.logger.Error("external admission check failed", zap.Bool("allowed", allowed), zap.Error(err))
+		}
+		if !allowed {
+			if reason == "" {
+				reason = "denied by policy"
+			}
+			return deny(reason)
+		}
+	}
+	return &admissionv1.AdmissionResponse{Allowed: true}
+}
+
+// jsonPatchOp is one RFC 6902 operation.
+type jsonPatchOp struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value,omitempty"`
+}
+
+func (wh *Webhook) mutate(_ context.Context, _ *admissionv1.AdmissionRequest, obj *object) *admissionv1.AdmissionResponse {
+	var ops []jsonPatchOp
+	if obj.labels == nil && len(wh.policy.DefaultLabels) > 0 {
+		ops = append(ops, jsonPatchOp{Op: "add", Path: "/metadata/labels", Value: wh.policy.DefaultLabels})
+	} else {
+		for key, value := range wh.policy.DefaultLabels {
+			if _, ok := obj.labels[key]; !ok {
+				ops = append(ops, jsonPatchOp{Op: "add", Path: "/metadata/labels/" + escapePointer(key), Value: value})
+			}
+		}
+	}
+
+	resp := &admissionv1.AdmissionResponse{Allowed: true}
+	if len(ops) == 0 {
+		return resp
+	}
+	patch, err := json.Marshal(ops)
+	if err != nil {
+		return deny("failed to build patch")
+	}
+	patchType := admissionv1.PatchTypeJSONPatch
+	resp.Patch = patch
+	resp.PatchType = &patchType
+	return resp
+}
+
+func deny(message string) *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: message,
+			Reason:  metav1.StatusReasonForbidden,
+			Code:    http.StatusForbidden,
+		},
+	}
+}
+
+// escapePointer escapes a JSON Pointer reference token (RFC 6901).
+func escapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+// object is the policy-relevant part of an admitted resource.
+type object struct {
+	labels map[string]string
+	images []string
+}
+
+// decodeObject extracts labels and container images from the workload
+// kinds the platform governs. Other kinds return nil and are allowed.
+func decodeObject(kind string, raw []byte) (*object, error) {
+	if len(raw) == 0 {
+		// DELETE carries no object
+		return nil, nil
+	}
+
+	var (
+		meta metav1.ObjectMeta
+		spec *corev1.PodSpec
+	)
+	switch kind {
+	case "Pod":
+		var o corev1.Pod
+		if err := json.Unmarshal(raw, &o); err != nil {
+			return nil, err
+		}
+		meta, spec = o.ObjectMeta, &o.Spec
+	case "Deployment":
+		var o appsv1.Deployment
+		if err := json.Unmarshal(raw, &o); err != nil {
+			return nil, err
+		}
+		meta, spec = o.ObjectMeta, &o.Spec.Template.Spec
+	case "StatefulSet":
+		var o appsv1.StatefulSet
+		if err := json.Unmarshal(raw, &o); err != nil {
+			return nil, err
+		}
+		meta, spec = o.ObjectMeta, &o.Spec.Template.Spec
+	case "DaemonSet":
+		var o appsv1.DaemonSet
+		if err := json.Unmarshal(raw, &o); err != nil {
+			return nil, err
+		}
+		meta, spec = o.ObjectMeta, &o.Spec.Template.Spec
+	case "Job":
+		var o batchv1.Job
+		if err := json.Unmarshal(raw, &o); err != nil {
+			return nil, err
+		}
+		meta, spec = o.ObjectMeta, &o.Spec.Template.Spec
+	case "CronJob":
+		var o batchv1.CronJob
+		if err := json.Unmarshal(raw, &o); err != nil {
+			return nil, err
+		}
+		meta, spec = o.ObjectMeta, &o.Spec.JobTemplate.Spec.Template.Spec
+	default:
+		return nil, nil
+	}
+
+	obj := &object{labels: meta.Labels}
+	for _, c := range spec.InitContainers {
+		obj.images = append(obj.images, c.Image)
+	}
+	for _, c := range spec.Containers {
+		obj.images = append(obj.images, c.Image)
+	}
+	for _, c := range spec.EphemeralContainers {
+		obj.images = append(obj.images, c.Image)
+	}
+	return obj, nil
+}
@@ -0,0 +1,102 @@
+package admission
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func testPolicy() *Policy {
+	return &Policy{
+		RequiredLabels:    []string{"team"},
+		AllowedRegistries: []string{"registry.internal/"},
+		DefaultLabels:     map[string]string{"platform.io/admitted": "true"},
+		ExemptNamespaces:  []string{"kube-system"},
+	}
+}
+
+func review(t *testing.T, path, namespace string, labels map[string]string, image string) *admissionv1.AdmissionResponse {
+	t.Helper()
+	d := appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: namespace, Labels: labels},
+		Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app", Image: image}},
+		}}},
+	}
+	raw, _ := json.Marshal(d)
+	body, _ := json.Marshal(admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       "uid-1",
+			Kind:      metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+			Namespace: namespace,
+			Name:      "api",
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	New(testPolicy(), zap.NewNop()).Handler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var out admissionv1.AdmissionReview
+	if err := json.NewDecoder(rec.Body).Decode(&out); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if out.Response.UID != "uid-1" {
+		t.Errorf("expected uid-1, got %s", out.Response.UID)
+	}
+	return out.Response
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		labels    map[string]string
+		image     string
+		allowed   bool
+		reason    string
+	}{
+		{"compliant", "team-a", map[string]string{"team": "a"}, "registry.internal/api:1", true, ""},
+		{"missing label", "team-a", nil, "registry.internal/api:1", false, `missing required label "team"`},
+		{"untrusted registry", "team-a", map[string]string{"team": "a"}, "docker.io/api:1", false, "not from an allowed registry"},
+		{"exempt namespace", "kube-system", nil, "docker.io/coredns:1", true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := review(t, "/validate", tt.namespace, tt.labels, tt.image)
+			if resp.Allowed != tt.allowed {
+				t.Fatalf("expected allowed=%v, got %v", tt.allowed, resp.Allowed)
+			}
+			if tt.reason != "" && !strings.Contains(resp.Result.Message, tt.reason) {
+				t.Errorf("expected reason containing %q, got %q", tt.reason, resp.Result.Message)
+			}
+		})
+	}
+}
+
+func TestMutateAddsDefaultLabels(t *testing.T) {
+	resp := review(t, "/mutate", "team-a", map[string]string{"team": "a"}, "registry.internal/api:1")
+	if !resp.Allowed {
+		t.Fatal("expected allowed")
+	}
+	want := `[{"op":"add","path":"/metadata/labels/platform.io~1admitted","value":"true"}]`
+	if string(resp.Patch) != want {
+		t.Errorf("expected patch %s, got %s", want, resp.Patch)
+	}
+}
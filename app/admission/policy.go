@@ -0,0 +1,80 @@
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Policy is the set of platform rules enforced at admission.
+type Policy struct {
+	// RequiredLabels must be present (non-empty) on every admitted object.
+	RequiredLabels []string `json:"required_labels"`
+	// AllowedRegistries are image prefixes such as "registry.internal/" or
+	// "ghcr.io/acme/". Empty allows any registry.
+	AllowedRegistries []string `json:"allowed_registries"`
+	// DefaultLabels are added by the mutating webhook when missing.
+	DefaultLabels map[string]string `json:"default_labels"`
+	// ExemptNamespaces are skipped entirely (e.g. kube-system).
+	ExemptNamespaces []string `json:"exempt_namespaces"`
+}
+
+// LoadPolicy reads a JSON policy file.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read admission policy: %w", err)
+	}
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse admission policy: %w", err)
+	}
+	return &p, nil
+}
+
+func (p *Policy) exempt(namespace string) bool {
+	return slices.Contains(p.ExemptNamespaces, namespace)
+}
+
+// Check returns every rule the JSON object of kind in namespace breaks, as
+// the validating webhook would report it. It lets manifests be checked
+// before they reach the API server.
+func (p *Policy) Check(kind, namespace string, raw []byte) ([]string, error) {
+	if p.exempt(namespace) {
+		return nil, nil
+	}
+	obj, err := decodeObject(kind, raw)
+	if err != nil || obj == nil {
+		return nil, err
+	}
+	return p.violations(obj.labels, obj.images), nil
+}
+
+// violations returns every rule the object breaks.
+func (p *Policy) violations(labels map[string]string, images []string) []string {
+	var out []string
+	for _, key := range p.RequiredLabels {
+		if labels[key] == "" {
+			out = append(out, fmt.Sprintf("missing required label %q", key))
+		}
+	}
+	if len(p.AllowedRegistries) > 0 {
+		for _, image := range images {
+			if !p.registryAllowed(image) {
+				out = append(out, fmt.Sprintf("image %q is not from an allowed registry", image))
+			}
+		}
+	}
+	return out
+}
+
+func (p *Policy) registryAllowed(image string) bool {
+	for _, prefix := range p.AllowedRegistries {
+		if strings.HasPrefix(image, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+	// A session that lasted this long resets the backoff.
+	stableSession = 30 * time.Second
+)
+
+// Options configures the node-side agent.
+type Options struct {
+	// CentralAddr is the central instance's gRPC address (host:port).
+	CentralAddr    string
+	NodeName       string
+	Version        string
+	ReportInterval time.Duration
+	// TLS dials the central instance with TLS using the system roots.
+	TLS bool
+	// TokenFile holds the bearer token sent on each stream, a projected
+	// service account token the hub reviews. It is reread per stream, so
+	// rotated tokens are picked up.
+	TokenFile string
+}
+
+// Agent streams reports to a central Hub, reconnecting with jittered
+// exponential backoff whenever the stream breaks.
+type Agent struct {
+	opts   Options
+	id     string
+	conn   *grpc.ClientConn
+	logger *zap.Logger
+}
+
+// New creates an agent. No connection is made until Run.
+func New(opts Options, logger *zap.Logger) (*Agent, error) {
+	if opts.CentralAddr == "" {
+		return nil, errors.New("agent: central address is required")
+	}
+	if opts.NodeName == "" {
+		return nil, errors.New("agent: node name is required")
+	}
+	if opts.ReportInterval <= 0 {
+		opts.ReportInterval = 15 * time.Second
+	}
+
+	creds := insecure.NewCredentials()
+	if opts.TLS {
+		creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+	conn, err := grpc.NewClient(opts.CentralAddr,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(codecName)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("agent: %w", err)
+	}
+
+	return &Agent{opts: opts, id: uuid.NewString(), conn: conn, logger: logger}, nil
+}
+
+// Run streams until ctx is cancelled, then closes the connection.
+func (a *Agent) Run(ctx context.Context) {
+	defer a.conn.Close()
+
+	backoff := minBackoff
+	for {
+		start := time.Now()
+		err := a.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(start) > stableSession {
+			backoff = minBackoff
+		}
+
+		delay := backoff/2 + time.Duration(rand.Int64N(int64(backoff/2)+1))
+		a.logger.Warn("agent stream ended, reconnecting",
+			zap.String("central", a.opts.CentralAddr),
+			zap.Duration("retry_in", delay),
+			zap.Error(err),
+		)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// session runs one stream: send a report, then keep reporting on the
+// current interval while applying directives from the hub.
+func (a *Agent) session(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if a.opts.TokenFile != "" {
+		token, err := os.ReadFile(a.opts.TokenFile)
+		if err != nil {
+			return fmt.Errorf("read agent token: %w", err)
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	cs, err := a.conn.NewStream(ctx, &serviceDesc.Streams[0], connectMethod)
+	if err != nil {
+		return err
+	}
+	stream := &grpc.GenericClientStream[Report, Directive]{ClientStream: cs}
+
+	if err := stream.Send(a.report()); err != nil {
+		return err
+	}
+
+	directives := make(chan *Directive)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			d, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case directives <- d:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	interval := a.opts.ReportInterval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			stream.CloseSend()
+			return ctx.Err()
+		case err := <-recvErr:
+			return err
+		case d := <-directives:
+			if d.ReportInterval > 0 && d.ReportInterval != interval {
+				interval = d.ReportInterval
+				ticker.Reset(interval)
+				a.logger.Info("agent report interval changed", zap.Duration("interval", interval))
+			}
+		case <-ticker.C:
+			if err := stream.Send(a.report()); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (a *Agent) report() *Report {
+	return &Report{
+		AgentID:   a.id,
+		NodeName:  a.opts.NodeName,
+		Version:   a.opts.Version,
+		Time:      time.Now().UTC(),
+		Health:    collectHealth(),
+		Inventory: collectInventory(),
+	}
+}
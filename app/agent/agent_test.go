@@ -0,0 +1,202 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	authnv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+)
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// reviewer answers TokenReviews for the agent service account, binding
+// each token in nodes to its node.
+func reviewer(nodes map[string]string) *TokenReviewer {
+	cs := fake.NewClientset()
+	cs.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authnv1.TokenReview)
+		if node, ok := nodes[review.Spec.Token]; ok {
+			review.Status = authnv1.TokenReviewStatus{
+				Authenticated: true,
+				Audiences:     review.Spec.Audiences,
+				User: authnv1.UserInfo{
+					Username: "system:serviceaccount:platform:platform-agent",
+					Extra:    map[string]authnv1.ExtraValue{nodeNameExtra: {node}},
+				},
+			}
+		}
+		return true, review, nil
+	})
+	return NewTokenReviewer(cs, "platform", "platform-agent", "platform-agent")
+}
+
+// serveHub serves hub on a local port and returns its address.
+func serveHub(t *testing.T, hub *Hub) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := grpc.NewServer()
+	hub.Register(srv)
+	go srv.Serve(ln)
+	t.Cleanup(srv.Stop)
+	return ln.Addr().String()
+}
+
+// tokenFile writes token to a file for Options.TokenFile.
+func tokenFile(t *testing.T, token string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte(token+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAgentStreamsToHub(t *testing.T) {
+	bus := events.NewMemoryBus()
+	received := make(chan string, 4)
+	bus.Subscribe(func(_ context.Context, e events.Event) { received <- e.Type })
+
+	hub := NewHub(bus, 20*time.Millisecond, reviewer(map[string]string{"token-a": "node-a"}), zap.NewNop())
+	a, err := New(Options{
+		CentralAddr:    serveHub(t, hub),
+		NodeName:       "node-a",
+		ReportInterval: time.Hour,
+		TokenFile:      tokenFile(t, "token-a"),
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.Run(ctx)
+		close(done)
+	}()
+
+	// The hub's 20ms interval replaces the agent's hourly one, so LastSeen
+	// moves past ConnectedAt only if the directive was applied
+	waitFor(t, func() bool {
+		s, ok := hub.Agents()["node-a"]
+		return ok && s.LastSeen.After(s.ConnectedAt)
+	})
+	if got := <-received; got != "agent.connected" {
+		t.Errorf("expected agent.connected event, got %s", got)
+	}
+
+	cancel()
+	<-done
+	waitFor(t, func() bool { return !hub.Agents()["node-a"].Connected })
+}
+
+func TestHubReconnectOverlap(t *testing.T) {
+	hub := NewHub(events.NewMemoryBus(), 0, nil, zap.NewNop())
+	before := testutil.ToFloat64(agentsConnected)
+	ctx := context.Background()
+
+	// The agent reconnects before the hub sees its old stream end
+	old := hub.connected(ctx, &Report{NodeName: "node-a", AgentID: "1"})
+	live := hub.connected(ctx, &Report{NodeName: "node-a", AgentID: "2"})
+	if got := testutil.ToFloat64(agentsConnected) - before; got != 1 {
+		t.Errorf("expected 1 agent connected, got %v", got)
+	}
+
+	hub.observe(old, &Report{NodeName: "node-a", AgentID: "1"})
+	hub.disconnected("node-a", old)
+	s := hub.Agents()["node-a"]
+	if !s.Connected {
+		t.Error("stale disconnect marked the live session disconnected")
+	}
+	if s.Last.AgentID != "2" {
+		t.Errorf("stale stream overwrote the live report: %+v", s.Last)
+	}
+	if got := testutil.ToFloat64(agentsConnected) - before; got != 1 {
+		t.Errorf("expected 1 agent connected after stale disconnect, got %v", got)
+	}
+
+	hub.disconnected("node-a", live)
+	if hub.Agents()["node-a"].Connected {
+		t.Error("expected node-a disconnected")
+	}
+	if got := testutil.ToFloat64(agentsConnected) - before; got != 0 {
+		t.Errorf("expected 0 agents connected, got %v", got)
+	}
+}
+
+func TestHubRefusesUnauthenticatedAgents(t *testing.T) {
+	hub := NewHub(events.NewMemoryBus(), 0, reviewer(map[string]string{"token-a": "node-a"}), zap.NewNop())
+	addr := serveHub(t, hub)
+
+	tests := []struct {
+		name, node, token string
+		want              codes.Code
+	}{
+		{"no token", "node-a", "", codes.Unauthenticated},
+		{"unknown token", "node-a", "forged", codes.Unauthenticated},
+		{"another node's token", "node-b", "token-a", codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		opts := Options{CentralAddr: addr, NodeName: tt.node}
+		if tt.token != "" {
+			opts.TokenFile = tokenFile(t, tt.token)
+		}
+		a, err := New(opts, zap.NewNop())
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = a.session(ctx)
+		cancel()
+		a.conn.Close()
+		if status.Code(err) != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+	if len(hub.Agents()) != 0 {
+		t.Errorf("expected no agent registered, got %v", hub.Agents())
+	}
+}
+
+func TestTokenReviewerChecksServiceAccount(t *testing.T) {
+	tr := reviewer(map[string]string{"token-a": "node-a"})
+	if node, err := tr.NodeName(context.Background(), "token-a"); err != nil || node != "node-a" {
+		t.Errorf("expected node-a, got %q, %v", node, err)
+	}
+	tr.username = "system:serviceaccount:default:other"
+	if _, err := tr.NodeName(context.Background(), "token-a"); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("expected another service account's token refused, got %v", err)
+	}
+}
+
+func TestNewRequiresNodeName(t *testing.T) {
+	if _, err := New(Options{CentralAddr: "127.0.0.1:1"}, zap.NewNop()); err == nil {
+		t.Error("expected error without node name")
+	}
+}
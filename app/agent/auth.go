@@ -0,0 +1,71 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	authnv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// nodeNameExtra is the TokenReview extra naming the node of the pod a
+// service account token is bound to (Kubernetes 1.30+).
+const nodeNameExtra = "authentication.kubernetes.io/node-name"
+
+// ErrUnauthenticated is returned by an Authenticator for tokens it does not
+// accept, as opposed to failing to check them.
+var ErrUnauthenticated = errors.New("agent: token not accepted")
+
+// Authenticator resolves the bearer token an agent streams with to the one
+// node it may report for.
+type Authenticator interface {
+	NodeName(ctx context.Context, token string) (string, error)
+}
+
+// TokenReviewer authenticates agents by their pod-bound service account
+// token. The token must carry the audience, belong to the agents' service
+// account and be bound to a pod; the pod's node is the agent's node. The
+// central instance's service account needs create on
+// tokenreviews.authentication.k8s.io.
+type TokenReviewer struct {
+	clientset kubernetes.Interface
+	username  string
+	audience  string
+}
+
+// NewTokenReviewer accepts tokens of serviceAccount in namespace issued for
+// audience.
+func NewTokenReviewer(cs kubernetes.Interface, namespace, serviceAccount, audience string) *TokenReviewer {
+	return &TokenReviewer{
+		clientset: cs,
+		username:  "system:serviceaccount:" + namespace + ":" + serviceAccount,
+		audience:  audience,
+	}
+}
+
+// NodeName reviews token and returns the node its pod runs on.
+func (t *TokenReviewer) NodeName(ctx context.Context, token string) (string, error) {
+	review, err := t.clientset.AuthenticationV1().TokenReviews().Create(ctx, &authnv1.TokenReview{
+		Spec: authnv1.TokenReviewSpec{Token: token, Audiences: []string{t.audience}},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("agent: token review: %w", err)
+	}
+	st := review.Status
+	switch {
+	case !st.Authenticated:
+		return "", ErrUnauthenticated
+	case st.User.Username != t.username:
+		return "", fmt.Errorf("%w: %s is not the agent service account", ErrUnauthenticated, st.User.Username)
+	case !slices.Contains(st.Audiences, t.audience):
+		return "", fmt.Errorf("%w: audience %s missing", ErrUnauthenticated, t.audience)
+	}
+	nodes := st.User.Extra[nodeNameExtra]
+	if len(nodes) != 1 || nodes[0] == "" {
+		return "", fmt.Errorf("%w: token is not bound to a pod on a node", ErrUnauthenticated)
+	}
+	return nodes[0], nil
+}
@@ -0,0 +1,236 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+)
+
+var (
+	agentsConnected = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "platform_agents_connected",
+		Help: "Agents currently streaming to this instance.",
+	})
+	agentReports = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "platform_agent_reports_total",
+		Help: "Agent reports received by health status.",
+	}, []string{"status"})
+	agentAuthentications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "platform_agent_authentications_total",
+		Help: "Agent streams by authentication result (accepted, missing, rejected, mismatch or error).",
+	}, []string{"result"})
+)
+
+// Status is the hub's view of one agent.
+type Status struct {
+	Connected   bool      `json:"connected"`
+	ConnectedAt time.Time `json:"connected_at"`
+	LastSeen    time.Time `json:"last_seen"`
+	Last        Report    `json:"last_report"`
+}
+
+// Hub is the central side of agent mode. It accepts agent streams and keeps
+// the latest report from each node.
+type Hub struct {
+	bus            events.Publisher
+	reportInterval time.Duration
+	auth           Authenticator
+	logger         *zap.Logger
+
+	mu     sync.RWMutex
+	agents map[string]*Status
+}
+
+// NewHub creates a hub. reportInterval is pushed to agents when they
+// connect; zero leaves their configured interval alone. Connect and
+// disconnect events are published to bus. Streams must carry a bearer
+// token auth accepts for the node they report for; with a nil auth every
+// stream is refused.
+func NewHub(bus events.Publisher, reportInterval time.Duration, auth Authenticator, logger *zap.Logger) *Hub {
+	return &Hub{
+		bus:            bus,
+		reportInterval: reportInterval,
+		auth:           auth,
+		logger:         logger,
+		agents:         make(map[string]*Status),
+	}
+}
+
+// Register adds the agent service to a gRPC server.
+func (h *Hub) Register(s *grpc.Server) {
+	s.RegisterService(&serviceDesc, h)
+}
+
+// Connect implements the bidirectional agent stream. The caller is
+// authenticated before anything it sends is read, and may only report for
+// the node its token is bound to.
+func (h *Hub) Connect(stream connectStream) error {
+	allowed, err := h.authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if first.NodeName == "" {
+		return status.Error(codes.InvalidArgument, "node_name is required")
+	}
+	if first.NodeName != allowed {
+		agentAuthentications.WithLabelValues("mismatch").Inc()
+		h.logger.Warn("agent refused: token is bound to another node",
+			zap.String("node", first.NodeName), zap.String("token_node", allowed))
+		return status.Error(codes.PermissionDenied, "token is not bound to node "+first.NodeName)
+	}
+	agentAuthentications.WithLabelValues("accepted").Inc()
+	node := first.NodeName
+
+	if err := stream.Send(&Directive{ReportInterval: h.reportInterval}); err != nil {
+		return err
+	}
+
+	sess := h.connected(stream.Context(), first)
+	defer h.disconnected(node, sess)
+
+	for {
+		r, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		r.NodeName = node
+		h.observe(sess, r)
+	}
+}
+
+// authenticate returns the node the stream's bearer token is bound to.
+func (h *Hub) authenticate(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	if v := md.Get("authorization"); len(v) == 1 {
+		token, _ = strings.CutPrefix(v[0], "Bearer ")
+	}
+	if token == "" || h.auth == nil {
+		agentAuthentications.WithLabelValues("missing").Inc()
+		return "", status.Error(codes.Unauthenticated, "agent token required")
+	}
+	node, err := h.auth.NodeName(ctx, token)
+	switch {
+	case errors.Is(err, ErrUnauthenticated):
+		agentAuthentications.WithLabelValues("rejected").Inc()
+		h.logger.Warn("agent refused", zap.Error(err))
+		return "", status.Error(codes.Unauthenticated, "agent token not accepted")
+	case err != nil:
+		agentAuthentications.WithLabelValues("error").Inc()
+		h.logger.Error("failed to authenticate agent", zap.Error(err))
+		return "", status.Error(codes.Unavailable, "agent authentication failed")
+	}
+	return node, nil
+}
+
+// connected records a new stream for the node and returns its session.
+// A reconnecting agent's new stream replaces one the hub has not yet seen
+// end; the old stream then owns nothing.
+func (h *Hub) connected(ctx context.Context, r *Report) *Status {
+	now := time.Now()
+	sess := &Status{Connected: true, ConnectedAt: now, LastSeen: now, Last: *r}
+	h.mu.Lock()
+	prev, ok := h.agents[r.NodeName]
+	h.agents[r.NodeName] = sess
+	h.mu.Unlock()
+
+	if !ok || !prev.Connected {
+		agentsConnected.Inc()
+	}
+	agentReports.WithLabelValues(r.Health.Status).Inc()
+	h.logger.Info("agent connected", zap.String("node", r.NodeName), zap.String("agent_id", r.AgentID))
+	h.publish(ctx, "agent.connected", r.NodeName)
+	return sess
+}
+
+// disconnected marks node disconnected if sess is still its session; a
+// stream replaced by a reconnect ends without touching the live one.
+func (h *Hub) disconnected(node string, sess *Status) {
+	h.mu.Lock()
+	current := h.agents[node] == sess
+	if current {
+		sess.Connected = false
+	}
+	h.mu.Unlock()
+	if !current {
+		h.logger.Debug("replaced agent stream ended", zap.String("node", node))
+		return
+	}
+
+	agentsConnected.Dec()
+	h.logger.Info("agent disconnected", zap.String("node", node))
+	h.publish(context.Background(), "agent.disconnected", node)
+}
+
+func (h *Hub) observe(sess *Status, r *Report) {
+	h.mu.Lock()
+	if h.agents[r.NodeName] == sess {
+		sess.LastSeen = time.Now()
+		sess.Last = *r
+	}
+	h.mu.Unlock()
+	agentReports.WithLabelValues(r.Health.Status).Inc()
+}
+
+func (h *Hub) publish(ctx context.Context, eventType, node string) {
+	e, err := events.New(eventType, "agent-hub", map[string]string{"node": node})
+	if err != nil {
+		return
+	}
+	if err := h.bus.Publish(ctx, e); err != nil {
+		h.logger.Warn("failed to publish agent event", zap.String("type", eventType), zap.Error(err))
+	}
+}
+
+// Agents returns a snapshot of every known agent keyed by node name.
+func (h *Hub) Agents() map[string]Status {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	out := make(map[string]Status, len(h.agents))
+	for node, s := range h.agents {
+		out[node] = *s
+	}
+	return out
+}
+
+// agentView is one entry of the GET /api/v1/agents response.
+type agentView struct {
+	Node string `json:"node"`
+	Status
+}
+
+// ServeHTTP lists known agents, sorted by node name.
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	agents := h.Agents()
+	views := make([]agentView, 0, len(agents))
+	for node, s := range agents {
+		views = append(views, agentView{Node: node, Status: s})
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Node < views[j].Node })
+
+	w.Header().Set("Content-Type", "application/json")
+	codec.Encode(w, map[string]any{"agents": views})
+}
@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// procRoot is where host /proc is read from. DaemonSets usually mount the
+// host's /proc at a separate path; on non-Linux hosts the reads simply fail
+// and the corresponding fields stay zero.
+var procRoot = "/proc"
+
+func collectInventory() Inventory {
+	hostname, _ := os.Hostname()
+	inv := Inventory{
+		Hostname: hostname,
+		OS:       runtime.GOOS,
+		Arch:     runtime.GOARCH,
+		CPUs:     runtime.NumCPU(),
+	}
+	if b, err := os.ReadFile(procRoot + "/sys/kernel/osrelease"); err == nil {
+		inv.KernelVersion = strings.TrimSpace(string(b))
+	}
+	if mem, err := readMeminfo(); err == nil {
+		inv.MemoryTotal = mem["MemTotal"]
+	}
+	return inv
+}
+
+// collectHealth reports degraded when the node is overloaded relative to its
+// CPU count or nearly out of memory.
+func collectHealth() Health {
+	h := Health{Status: "ok"}
+
+	if b, err := os.ReadFile(procRoot + "/loadavg"); err == nil {
+		if fields := strings.Fields(string(b)); len(fields) > 0 {
+			h.Load1, _ = strconv.ParseFloat(fields[0], 64)
+		}
+	}
+	if cpus := float64(runtime.NumCPU()); h.Load1 > 2*cpus {
+		h.Problems = append(h.Problems, fmt.Sprintf("load %.1f exceeds 2x CPUs", h.Load1))
+	}
+
+	if mem, err := readMeminfo(); err == nil {
+		h.MemoryAvailable = mem["MemAvailable"]
+		if total := mem["MemTotal"]; total > 0 && h.MemoryAvailable*20 < total {
+			h.Problems = append(h.Problems, "less than 5% memory available")
+		}
+	}
+
+	if len(h.Problems) > 0 {
+		h.Status = "degraded"
+	}
+	return h
+}
+
+// readMeminfo parses /proc/meminfo into bytes.
+func readMeminfo() (map[string]uint64, error) {
+	f, err := os.Open(procRoot + "/meminfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	out := make(map[string]uint64)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		key, rest, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			v *= 1024
+		}
+		out[key] = v
+	}
+	return out, sc.Err()
+}
@@ -0,0 +1,86 @@
+// Package agent implements the host-level agent mode. Instances running as a
+// DaemonSet stream node-local health and inventory to a central instance over
+// a bidirectional gRPC stream; the central Hub tracks the fleet and can steer
+// agents (e.g. change their report interval) on the same stream.
+package agent
+
+import (
+	"encoding/json"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// The agent protocol is small and internal, so messages are plain Go structs
+// carried with a JSON codec rather than generated protobuf types.
+const (
+	serviceName   = "platform.agent.v1.AgentService"
+	connectMethod = "/" + serviceName + "/Connect"
+	codecName     = "json"
+)
+
+// Report is sent by an agent on connect and then every report interval.
+type Report struct {
+	AgentID   string    `json:"agent_id"`
+	NodeName  string    `json:"node_name"`
+	Version   string    `json:"version"`
+	Time      time.Time `json:"time"`
+	Health    Health    `json:"health"`
+	Inventory Inventory `json:"inventory"`
+}
+
+// Health is the node-local health snapshot.
+type Health struct {
+	// Status is "ok" or "degraded".
+	Status          string  `json:"status"`
+	Load1           float64 `json:"load1"`
+	MemoryAvailable uint64  `json:"memory_available_bytes"`
+	// Problems lists human-readable reasons for a degraded status.
+	Problems []string `json:"problems,omitempty"`
+}
+
+// Inventory describes the host an agent runs on.
+type Inventory struct {
+	Hostname      string `json:"hostname"`
+	OS            string `json:"os"`
+	Arch          string `json:"arch"`
+	KernelVersion string `json:"kernel_version,omitempty"`
+	CPUs          int    `json:"cpus"`
+	MemoryTotal   uint64 `json:"memory_total_bytes"`
+}
+
+// Directive is sent by the hub to an agent.
+type Directive struct {
+	// ReportInterval, when non-zero, replaces the agent's report interval.
+	ReportInterval time.Duration `json:"report_interval,omitempty"`
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                       { return codecName }
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+type connectStream = grpc.BidiStreamingServer[Report, Directive]
+
+type agentServiceServer interface {
+	Connect(connectStream) error
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*agentServiceServer)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName: "Connect",
+		Handler: func(srv any, stream grpc.ServerStream) error {
+			return srv.(agentServiceServer).Connect(&grpc.GenericServerStream[Report, Directive]{ServerStream: stream})
+		},
+		ServerStreams: true,
+		ClientStreams: true,
+	}},
+}
@@ -0,0 +1,43 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// CatalogItem describes a capability teams can provision through the portal
+// (a database, queue, cache, ...). It is cluster-scoped; the portal renders
+// a provisioning form from Parameters.
+type CatalogItem struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CatalogItemSpec `json:"spec"`
+}
+
+// CatalogItemSpec is the published description of a capability.
+type CatalogItemSpec struct {
+	DisplayName string `json:"displayName"`
+	Description string `json:"description,omitempty"`
+	// Category groups items in the portal, e.g. "database", "queue", "cache".
+	Category string   `json:"category"`
+	Tags     []string `json:"tags,omitempty"`
+	// Owner is the team maintaining the capability.
+	Owner            string `json:"owner,omitempty"`
+	DocumentationURL string `json:"documentationURL,omitempty"`
+	// Parameters is a JSON Schema object describing provisioning inputs.
+	Parameters *runtime.RawExtension `json:"parameters,omitempty"`
+	// Deprecated items stay listed but are not offered for new provisioning.
+	Deprecated bool `json:"deprecated,omitempty"`
+}
+
+// CatalogItemList is a list of CatalogItems.
+type CatalogItemList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CatalogItem `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CatalogItem{}, &CatalogItemList{})
+}
@@ -0,0 +1,158 @@
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto copies in into out.
+func (in *PlatformService) DeepCopyInto(out *PlatformService) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy returns a deep copy.
+func (in *PlatformService) DeepCopy() *PlatformService {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformService)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object.
+func (in *PlatformService) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// DeepCopyInto copies in into out.
+func (in *PlatformServiceSpec) DeepCopyInto(out *PlatformServiceSpec) {
+	*out = *in
+	if in.Replicas != nil {
+		out.Replicas = new(int32)
+		*out.Replicas = *in.Replicas
+	}
+	if in.Env != nil {
+		out.Env = make([]corev1.EnvVar, len(in.Env))
+		for i := range in.Env {
+			in.Env[i].DeepCopyInto(&out.Env[i])
+		}
+	}
+	in.Resources.DeepCopyInto(&out.Resources)
+	if in.Ingress != nil {
+		out.Ingress = new(IngressSpec)
+		*out.Ingress = *in.Ingress
+	}
+	if in.Observability != nil {
+		out.Observability = new(ObservabilitySpec)
+		*out.Observability = *in.Observability
+	}
+}
+
+// DeepCopyInto copies in into out.
+func (in *PlatformServiceStatus) DeepCopyInto(out *PlatformServiceStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		out.Conditions = make([]metav1.Condition, len(in.Conditions))
+		for i := range in.Conditions {
+			in.Conditions[i].DeepCopyInto(&out.Conditions[i])
+		}
+	}
+}
+
+// DeepCopyInto copies in into out.
+func (in *PlatformServiceList) DeepCopyInto(out *PlatformServiceList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]PlatformService, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+// DeepCopy returns a deep copy.
+func (in *PlatformServiceList) DeepCopy() *PlatformServiceList {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformServiceList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object.
+func (in *PlatformServiceList) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// DeepCopyInto copies in into out.
+func (in *CatalogItem) DeepCopyInto(out *CatalogItem) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy returns a deep copy.
+func (in *CatalogItem) DeepCopy() *CatalogItem {
+	if in == nil {
+		return nil
+	}
+	out := new(CatalogItem)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object.
+func (in *CatalogItem) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// DeepCopyInto copies in into out.
+func (in *CatalogItemSpec) DeepCopyInto(out *CatalogItemSpec) {
+	*out = *in
+	if in.Tags != nil {
+		out.Tags = make([]string, len(in.Tags))
+		copy(out.Tags, in.Tags)
+	}
+	if in.Parameters != nil {
+		out.Parameters = new(runtime.RawExtension)
+		in.Parameters.DeepCopyInto(out.Parameters)
+	}
+}
+
+// DeepCopyInto copies in into out.
+func (in *CatalogItemList) DeepCopyInto(out *CatalogItemList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]CatalogItem, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+// DeepCopy returns a deep copy.
+func (in *CatalogItemList) DeepCopy() *CatalogItemList {
+	if in == nil {
+		return nil
+	}
+	out := new(CatalogItemList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object.
+func (in *CatalogItemList) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
@@ -0,0 +1,19 @@
+// Package v1alpha1 contains the platform.io/v1alpha1 API types served as
+// CustomResourceDefinitions and reconciled by the controller package.
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+var (
+	// GroupVersion is the API group and version of these types.
+	GroupVersion = schema.GroupVersion{Group: "platform.io", Version: "v1alpha1"}
+
+	// SchemeBuilder registers the types with a runtime.Scheme.
+	SchemeBuilder = &scheme.Builder{GroupVersion: GroupVersion}
+
+	// AddToScheme adds the types in this group-version to a scheme.
+	AddToScheme = SchemeBuilder.AddToScheme
+)
@@ -0,0 +1,79 @@
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PlatformService describes an application the platform runs on a team's
+// behalf. The controller materialises it as a Deployment, a Service, and
+// optionally an Ingress and a Prometheus ServiceMonitor.
+type PlatformService struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PlatformServiceSpec   `json:"spec"`
+	Status PlatformServiceStatus `json:"status,omitempty"`
+}
+
+// PlatformServiceSpec is the desired state.
+type PlatformServiceSpec struct {
+	// Image is the container image to run.
+	Image string `json:"image"`
+	// Replicas defaults to 1.
+	Replicas *int32 `json:"replicas,omitempty"`
+	// Port is the container port the Service targets. Defaults to 8080.
+	Port int32 `json:"port,omitempty"`
+
+	Env       []corev1.EnvVar             `json:"env,omitempty"`
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	Ingress       *IngressSpec       `json:"ingress,omitempty"`
+	Observability *ObservabilitySpec `json:"observability,omitempty"`
+}
+
+// IngressSpec exposes the service outside the cluster.
+type IngressSpec struct {
+	Host string `json:"host"`
+	// Path defaults to "/".
+	Path          string `json:"path,omitempty"`
+	ClassName     string `json:"className,omitempty"`
+	TLSSecretName string `json:"tlsSecretName,omitempty"`
+}
+
+// ObservabilitySpec configures metrics scraping.
+type ObservabilitySpec struct {
+	// Metrics creates a ServiceMonitor when the Prometheus Operator is
+	// installed.
+	Metrics bool `json:"metrics,omitempty"`
+	// MetricsPath defaults to "/metrics".
+	MetricsPath string `json:"metricsPath,omitempty"`
+	// MetricsPort defaults to the service port.
+	MetricsPort int32 `json:"metricsPort,omitempty"`
+	// ScrapeInterval such as "30s"; empty uses the Prometheus default.
+	ScrapeInterval string `json:"scrapeInterval,omitempty"`
+}
+
+// PlatformServiceStatus is the observed state.
+type PlatformServiceStatus struct {
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	ReadyReplicas      int32              `json:"readyReplicas,omitempty"`
+	URL                string             `json:"url,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Condition types reported in status.
+const (
+	ConditionReady = "Ready"
+)
+
+// PlatformServiceList is a list of PlatformServices.
+type PlatformServiceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PlatformService `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PlatformService{}, &PlatformServiceList{})
+}
@@ -0,0 +1,871 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	metricsv "k8s.io/metrics/pkg/client/clientset/versioned"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/admission"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/agent"
+	platformv1alpha1 "github.com/virenpatel/k8s-platform-engineering-lab/app/api/v1alpha1"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/argocd"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/auditlog"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/backup"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/catalog"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/clusterevents"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/config"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/controller"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/costs"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/credentials"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/dev"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/featureflags"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/graph"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/handlers"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/helmreleases"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/httpclient"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/infra"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/jobs"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/kube"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/kustomize"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/lifecycle"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/loadshed"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/locks"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/multicluster"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/nodeops"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/nodes"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/onboarding"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/outbox"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/pdbs"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/podexec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/podlogs"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/proxy"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/queue"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/quotas"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/registry"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/resources"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/rpc"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/scaffold"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/search"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/server"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/static"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/supplychain"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/webhooks"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/workloads"
+)
+
+// initAPI builds the handlers the configuration enables, mounts them on
+// the public route tables and wraps those in the middleware chain, setting
+// Handler. Components with background work register it to run on Start.
+func (a *App) initAPI() error {
+	cfg, logger, st, bus, kubeClient := a.Config, a.Logger, a.Store, a.Bus, a.Kube
+	clientOptions := a.clientOptions
+
+	var (
+		jobQueue *queue.Queue
+		queueAPI *queue.Handler
+	)
+	if cfg.QueueEnabled {
+		jobQueue = queue.New(st.Queue, queue.Options{
+			Workers:      cfg.QueueWorkers,
+			PollInterval: cfg.QueuePollInterval,
+			Lease:        cfg.QueueLease,
+			MaxAttempts:  cfg.QueueMaxAttempts,
+			BackoffBase:  cfg.QueueBackoffBase,
+			BackoffMax:   cfg.QueueBackoffMax,
+			Retention:    cfg.QueueRetention,
+		}, logger)
+		queueAPI = queue.NewHandler(jobQueue, authz.Headers{
+			User:   cfg.AuthProxyUserHeader,
+			Groups: cfg.AuthProxyGroupsHeader,
+		}, cfg.QueueAdminGroups, logger)
+	}
+	var credentialAPI *credentials.Handler
+	if cfg.CredentialsEnabled {
+		sealer, err := a.sealer("CREDENTIALS_ENABLED")
+		if err != nil {
+			return err
+		}
+		credentialStore := credentials.New(st.Credentials, st.Tenants, sealer, logger)
+		if jobQueue != nil {
+			credentialStore.UseQueue(jobQueue)
+		}
+		credentialAPI = credentials.NewHandler(credentialStore, authz.Headers{
+			User:   cfg.AuthProxyUserHeader,
+			Groups: cfg.AuthProxyGroupsHeader,
+		}, logger)
+	}
+	// Outgoing webhooks, signed with keys rotated through the admin API
+	var webhookKeys *webhooks.KeyHandler
+	if len(cfg.WebhookDispatchURLs) > 0 {
+		sealer, err := a.sealer("WEBHOOK_DISPATCH_URLS")
+		if err != nil {
+			return err
+		}
+		signingKeys := webhooks.NewKeys(st.WebhookKeys, sealer, webhooks.KeyOptions{
+			Algorithm: cfg.WebhookSigningAlgorithm,
+			Grace:     cfg.WebhookKeyGrace,
+		}, logger)
+		dispatcher := webhooks.NewDispatcher(signingKeys, httpclient.New("webhooks", clientOptions("webhooks"), logger),
+			webhooks.DispatchOptions{
+				URLs:       cfg.WebhookDispatchURLs,
+				Events:     cfg.WebhookDispatchEvents,
+				BufferSize: cfg.WebhookDispatchBuffer,
+			}, logger)
+		bus.Subscribe(dispatcher.HandleEvent)
+		a.Lifecycle.OnShutdown("webhook-dispatcher", lifecycle.PhaseFlush, 0, dispatcher.Shutdown)
+		webhookKeys = webhooks.NewKeyHandler(signingKeys, authz.Headers{
+			User:   cfg.AuthProxyUserHeader,
+			Groups: cfg.AuthProxyGroupsHeader,
+		}, logger)
+	}
+	// The audit chain is verified through st.Audit, which Kafka has already
+	// wrapped; Chain and Head pass straight through to the store
+	var auditAPI *auditlog.Handler
+	if a.enforcer != nil {
+		auditAPI = auditlog.NewHandler(st.Audit, authz.Headers{
+			User:   cfg.AuthProxyUserHeader,
+			Groups: cfg.AuthProxyGroupsHeader,
+		}, logger)
+	}
+
+	var (
+		workloadList *workloads.Catalog
+		podLogs      *podlogs.Handler
+		warningFeed  *clusterevents.Feed
+		lockHandler  *locks.Handler
+		helmRepos    *helmreleases.Repositories
+		helmInv      *helmreleases.Inventory
+		onboarder    *onboarding.Engine
+		svcCatalog   *catalog.Handler
+		authzCheck   *authz.Handler
+		jobRunner    *jobs.Handler
+		nodeInv      *nodes.Inventory
+		quotaReport  *quotas.Reporter
+		nodeOps      *nodeops.Engine
+		nodeOpsAPI   *nodeops.Handler
+		images       *registry.Inventory
+		costReport   *costs.Estimator
+		podExec      *podexec.Handler
+		budgets      *pdbs.Handler
+		renderer     *kustomize.Handler
+		scaffolder   *scaffold.Handler
+		infraRuns    *infra.Handler
+		atlantis     *infra.Atlantis
+		fleet        *multicluster.Handler
+		pricing      *costs.Pricing
+		// metrics-server client, shared by the node inventory and cost estimates
+		clusterMetrics metricsv.Interface
+		// CatalogItem client, shared by the catalog and search
+		catalogClient ctrlclient.Client
+	)
+	if kubeClient != nil {
+		a.Health.AddReadinessCheck("kubernetes", kubeClient.Check)
+		workloadList = workloads.New(kubeClient.Clientset, kubeClient.Informers, cfg.KubeNamespaces)
+		warningFeed = clusterevents.New(kubeClient.Clientset, kubeClient.Informers, cfg.KubeNamespaces)
+		authzCheck = authz.NewHandler(authz.NewReviewer(kubeClient.Clientset), authz.Headers{
+			User:   cfg.AuthProxyUserHeader,
+			Groups: cfg.AuthProxyGroupsHeader,
+		}, logger)
+		// A wrapped clientset, such as a fake one, has no config to build
+		// the metrics-server client from
+		if cfg.NodeMetricsEnabled && kubeClient.Config() != nil {
+			mc, err := metricsv.NewForConfig(kubeClient.Config())
+			if err != nil {
+				return fmt.Errorf("create metrics-server client: %w", err)
+			}
+			clusterMetrics = mc
+		}
+		nodeInv = nodes.New(kubeClient.Clientset, kubeClient.Informers, clusterMetrics, logger)
+		podLogs = podlogs.New(kubeClient.Clientset, podlogs.Options{
+			Namespaces:   cfg.KubeNamespaces,
+			UserHeader:   cfg.AuthProxyUserHeader,
+			GroupsHeader: cfg.AuthProxyGroupsHeader,
+			MaxTailLines: int64(cfg.PodLogsMaxTailLines),
+		}, logger)
+	}
+	if cfg.HelmInventoryEnabled {
+		if len(cfg.HelmRepositories) > 0 {
+			helmRepos = helmreleases.NewRepositories(cfg.HelmRepositories, httpclient.New("helm-repos", clientOptions("helm-repos"), logger), logger)
+		}
+		helmInv = helmreleases.New(kubeClient.Clientset, cfg.KubeNamespaces, helmRepos, logger)
+	}
+	if cfg.CatalogEnabled {
+		scheme, err := controller.NewScheme()
+		if err != nil {
+			return fmt.Errorf("build API scheme: %w", err)
+		}
+		crClient, err := ctrlclient.New(kubeClient.Config(), ctrlclient.Options{Scheme: scheme})
+		if err != nil {
+			return fmt.Errorf("create catalog client: %w", err)
+		}
+		catalogClient = crClient
+		// The first list resolves the REST mapping through discovery
+		a.Warmup.Add("catalog", false, func(ctx context.Context) error {
+			return crClient.List(ctx, &platformv1alpha1.CatalogItemList{}, ctrlclient.Limit(1))
+		})
+		svcCatalog = catalog.New(crClient, kubeClient.Clientset, catalog.Options{
+			UserHeader:   cfg.AuthProxyUserHeader,
+			GroupsHeader: cfg.AuthProxyGroupsHeader,
+		}, logger)
+	}
+	if cfg.OnboardingEnabled {
+		onboarder = onboarding.New(kubeClient.Clientset, st.Tenants, bus, onboarding.Options{
+			DefaultQuota:     cfg.OnboardingDefaultQuota,
+			PullSecretSource: cfg.OnboardingPullSecret,
+			IngressNamespace: cfg.OnboardingIngressNamespace,
+			Timeout:          cfg.OnboardingTimeout,
+			// The platform's own namespace is no tenant's
+			ReservedNamespaces: []string{cfg.PodNamespace},
+		}, logger)
+		if jobQueue != nil {
+			if cfg.QueueLease < 2*cfg.OnboardingTimeout {
+				logger.Warn("QUEUE_LEASE is shorter than an onboarding run and its compensation; runs may be claimed twice",
+					zap.Duration("lease", cfg.QueueLease), zap.Duration("onboarding_timeout", cfg.OnboardingTimeout))
+			}
+			onboarder.UseQueue(jobQueue)
+		}
+	}
+	if cfg.JobsEnabled {
+		templates, err := jobs.LoadTemplates(cfg.JobsTemplatesFile)
+		if err != nil {
+			return fmt.Errorf("load job templates: %w", err)
+		}
+		jobRunner = jobs.New(kubeClient.Clientset, kubeClient.Informers, templates, bus, jobs.Options{
+			Namespaces:   cfg.KubeNamespaces,
+			UserHeader:   cfg.AuthProxyUserHeader,
+			GroupsHeader: cfg.AuthProxyGroupsHeader,
+			TTL:          cfg.JobsTTL,
+		}, logger)
+		logger.Info("job templates loaded", zap.Int("templates", len(templates)))
+	}
+	if cfg.QuotaReportEnabled {
+		quotaReport = quotas.New(kubeClient.Informers, st.QuotaUsage, bus, quotas.Options{
+			Namespaces:        cfg.KubeNamespaces,
+			Retention:         cfg.QuotaHistoryRetention,
+			WarnThreshold:     cfg.QuotaWarnThreshold,
+			CriticalThreshold: cfg.QuotaCriticalThreshold,
+		}, logger)
+	}
+	if cfg.NodeOpsEnabled {
+		nodeOps = nodeops.New(kubeClient.Clientset, bus, nodeops.Options{
+			EvictionTimeout: cfg.NodeOpsEvictionTimeout,
+			Timeout:         cfg.NodeOpsDrainTimeout,
+		}, logger)
+		nodeOpsAPI = nodeops.NewHandler(nodeOps, authz.Headers{
+			User:   cfg.AuthProxyUserHeader,
+			Groups: cfg.AuthProxyGroupsHeader,
+		}, cfg.NodeOpsGroups, logger)
+	}
+	if cfg.RegistryEnabled {
+		regClient, err := registry.NewClient(cfg.Registries, cfg.RegistryCredentialsFile, httpclient.New("registry", clientOptions("registry"), logger))
+		if err != nil {
+			return fmt.Errorf("configure registry client: %w", err)
+		}
+		images = registry.New(kubeClient.Informers, regClient, cfg.KubeNamespaces, logger)
+	}
+	if cfg.CostsEnabled {
+		pricing = costs.NewPricing(costs.Rates{
+			Currency:      cfg.CostsCurrency,
+			CPUCoreHour:   cfg.CostsCPUCoreHour,
+			MemoryGiBHour: cfg.CostsMemoryGiBHour,
+		}, cfg.CostsPricingURL, httpclient.New("pricing", clientOptions("pricing"), logger), logger)
+		costReport = costs.New(kubeClient.Informers, clusterMetrics, pricing, cfg.KubeNamespaces, logger)
+	}
+	if cfg.PodExecEnabled {
+		podExec = podexec.New(kubeClient.Clientset, podexec.SPDYExecutor(kubeClient.Clientset, kubeClient.Config()), podexec.Options{
+			Namespaces:   cfg.KubeNamespaces,
+			UserHeader:   cfg.AuthProxyUserHeader,
+			GroupsHeader: cfg.AuthProxyGroupsHeader,
+			Commands:     cfg.PodExecCommands,
+			MaxDuration:  cfg.PodExecMaxDuration,
+			RecordingDir: cfg.PodExecRecordingDir,
+		}, logger)
+	}
+	if cfg.PDBsEnabled {
+		templates, err := pdbs.LoadTemplates(cfg.PDBTemplatesFile)
+		if err != nil {
+			return fmt.Errorf("load disruption budget templates: %w", err)
+		}
+		budgets = pdbs.New(kubeClient.Clientset, kubeClient.Informers, templates, bus, pdbs.Options{
+			Namespaces:   cfg.KubeNamespaces,
+			UserHeader:   cfg.AuthProxyUserHeader,
+			GroupsHeader: cfg.AuthProxyGroupsHeader,
+		}, logger)
+		logger.Info("disruption budget templates loaded", zap.Int("templates", len(templates)))
+	}
+	if cfg.KustomizeEnabled {
+		var policy *admission.Policy
+		if cfg.AdmissionPolicyFile != "" {
+			var err error
+			if policy, err = admission.LoadPolicy(cfg.AdmissionPolicyFile); err != nil {
+				return fmt.Errorf("load admission policy: %w", err)
+			}
+		}
+		renderer = kustomize.New(httpclient.New("kustomize", clientOptions("kustomize"), logger), policy, kustomize.Options{
+			Repositories: cfg.KustomizeRepositories,
+			Token:        cfg.KustomizeToken,
+			Objects:      a.objects,
+			ObjectExpiry: cfg.ObjectStorePresignExpiry,
+			UserHeader:   cfg.AuthProxyUserHeader,
+			GroupsHeader: cfg.AuthProxyGroupsHeader,
+			Workers:      a.workers,
+		}, logger)
+	}
+	if cfg.ScaffoldEnabled {
+		var remote *scaffold.Remote
+		if cfg.ScaffoldGitURL != "" {
+			remote = &scaffold.Remote{
+				URL:         cfg.ScaffoldGitURL,
+				BaseBranch:  cfg.ScaffoldGitBaseBranch,
+				Username:    cfg.ScaffoldGitUsername,
+				Token:       cfg.ScaffoldGitToken,
+				AuthorName:  cfg.ScaffoldGitAuthorName,
+				AuthorEmail: cfg.ScaffoldGitAuthorEmail,
+				Client:      httpclient.New("scaffold-git", clientOptions("scaffold-git"), logger),
+			}
+		}
+		scaffolder = scaffold.New(bus, scaffold.Options{
+			Registry:     cfg.ScaffoldRegistry,
+			Remote:       remote,
+			Objects:      a.objects,
+			ObjectExpiry: cfg.ObjectStorePresignExpiry,
+			UserHeader:   cfg.AuthProxyUserHeader,
+			GroupsHeader: cfg.AuthProxyGroupsHeader,
+			Workers:      a.workers,
+		}, logger)
+	}
+	if cfg.InfraEnabled {
+		workspaces, err := infra.LoadWorkspaces(cfg.InfraWorkspacesFile)
+		if err != nil {
+			return fmt.Errorf("load infra workspaces: %w", err)
+		}
+		backends := map[string]infra.Backend{}
+		if cfg.TFCOrganization != "" {
+			backends[infra.BackendTFC] = &infra.TerraformCloud{
+				URL:          cfg.TFCURL,
+				Organization: cfg.TFCOrganization,
+				Token:        cfg.TFCToken,
+				Client:       httpclient.New("terraform-cloud", clientOptions("terraform-cloud"), logger),
+			}
+		}
+		if cfg.AtlantisURL != "" {
+			// Atlantis only answers once the plan or apply is done; runs
+			// are bounded by ATLANTIS_TIMEOUT instead
+			opts := clientOptions("atlantis")
+			opts.Timeout = 0
+			opts.ResponseHeaderTimeout = 0
+			atlantis = infra.NewAtlantis(cfg.AtlantisURL, cfg.AtlantisToken, cfg.AtlantisVCS, cfg.AtlantisTimeout,
+				httpclient.New("atlantis", opts, logger))
+			backends[infra.BackendAtlantis] = atlantis
+		}
+		if infraRuns, err = infra.New(backends, bus, infra.Options{
+			Workspaces:   workspaces,
+			Groups:       cfg.InfraGroups,
+			UserHeader:   cfg.AuthProxyUserHeader,
+			GroupsHeader: cfg.AuthProxyGroupsHeader,
+		}, logger); err != nil {
+			return fmt.Errorf("configure infra runs: %w", err)
+		}
+	}
+	// The cluster health view is served for the local cluster alone too;
+	// remote clusters come from kubeconfig contexts and Secrets
+	if kubeClient != nil {
+		clusters := kube.NewClusters(cfg.KubeClusterName, kubeClient)
+		if err := clusters.AddContexts(cfg.KubeContexts, KubeOptions(cfg), logger); err != nil {
+			return fmt.Errorf("configure kubeconfig context clusters: %w", err)
+		}
+		if cfg.KubeClusterSecretSelector != "" {
+			ns := cfg.KubeClusterSecretsNamespace
+			if ns == "" {
+				ns = cfg.PodNamespace
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			err := clusters.AddSecrets(ctx, ns, cfg.KubeClusterSecretSelector, KubeOptions(cfg), logger)
+			cancel()
+			if err != nil {
+				return fmt.Errorf("load cluster secrets: %w", err)
+			}
+		}
+		fleet = multicluster.New(clusters, multicluster.Options{
+			Namespaces: cfg.KubeNamespaces,
+			Header:     cfg.KubeClusterHeader,
+			Metrics:    clusterMetrics,
+		}, logger)
+		logger.Info("cluster endpoints enabled", zap.Strings("clusters", clusters.Names()))
+	}
+	if cfg.LocksEnabled {
+		ns := cfg.LocksNamespace
+		if ns == "" {
+			ns = cfg.PodNamespace
+		}
+		lockHandler = locks.NewHandler(locks.New(kubeClient.Clientset, locks.Options{
+			Namespace:  ns,
+			DefaultTTL: cfg.LocksDefaultTTL,
+			MaxTTL:     cfg.LocksMaxTTL,
+		}, logger), authz.Headers{User: cfg.AuthProxyUserHeader, Groups: cfg.AuthProxyGroupsHeader}, logger)
+	}
+	apiHandler := handlers.NewAPIHandler(logger, cfg)
+	apiHandler.Limits = a.limits
+	apiHandler.Degraded = a.Startup.Degraded
+	flags := featureflags.New(cfg.FeatureFlags, logger)
+	// What this binary was built from, for security tooling
+	build, _ := debug.ReadBuildInfo()
+	supplyChain, err := supplychain.New(supplychain.Embedded(), build)
+	if err != nil {
+		return fmt.Errorf("invalid embedded attestations: %w", err)
+	}
+
+	graphHandler, err := graph.NewHandler(st, graph.Limits{
+		MaxDepth:       cfg.GraphQLMaxDepth,
+		MaxQueryLength: cfg.GraphQLMaxQueryLength,
+		MaxParallelism: cfg.GraphQLMaxParallelism,
+	}, logger)
+	if err != nil {
+		return fmt.Errorf("build GraphQL schema: %w", err)
+	}
+
+	var resourceAPI *resources.Handlers
+	if cfg.ResourcesAPIEnabled {
+		resourceAPI = resources.New(st, resources.Options{
+			UserHeader:   cfg.AuthProxyUserHeader,
+			GroupsHeader: cfg.AuthProxyGroupsHeader,
+			AdminGroups:  cfg.ResourcesAdminGroups,
+		}, logger)
+	}
+
+	var searchAPI *search.Handler
+	if cfg.SearchEnabled {
+		searchAPI = search.New(logger)
+		// The memory store and the informer cache rank in memory
+		var stored search.Source = st.Search
+		if cfg.StoreBackend == config.StoreMemory {
+			stored = search.Pooled(stored, a.workers)
+		}
+		searchAPI.Add(stored, store.SearchTenant, store.SearchService)
+		if kubeClient != nil {
+			searchAPI.Add(search.Pooled(search.Namespaces(kubeClient.Informers, cfg.KubeNamespaces), a.workers), search.TypeNamespace)
+		}
+		if catalogClient != nil {
+			searchAPI.Add(search.CatalogItems(catalogClient), search.TypeCatalogItem)
+		}
+	}
+
+	var backupAPI *backup.Handler
+	if cfg.BackupEnabled {
+		backupAPI = backup.New(st, backup.Options{
+			UserHeader:     cfg.AuthProxyUserHeader,
+			GroupsHeader:   cfg.AuthProxyGroupsHeader,
+			AdminGroups:    cfg.BackupAdminGroups,
+			MaxImportBytes: int64(cfg.BackupMaxImportBytes),
+		}, logger)
+	}
+
+	// gRPC services share the public port (see MultiplexGRPC in initServers)
+	var agentHub *agent.Hub
+	if cfg.EnableGRPC {
+		a.RPC = rpc.New(logger)
+		// Agents prove their node with a pod-bound service account token
+		var agentAuth agent.Authenticator
+		if kubeClient != nil {
+			agentAuth = agent.NewTokenReviewer(kubeClient.Clientset, cfg.PodNamespace, cfg.AgentHubServiceAccount, cfg.AgentTokenAudience)
+		} else {
+			logger.Warn("agent streams are refused without KUBE_ENABLED to review their tokens")
+		}
+		agentHub = agent.NewHub(bus, cfg.AgentHubReportInterval, agentAuth, logger)
+		agentHub.Register(a.RPC.GRPC)
+	}
+
+	// GitOps sync triggers through Argo CD
+	var argoHandler *argocd.Handler
+	if cfg.ArgoCDURL != "" {
+		argoClient := argocd.NewClient(cfg.ArgoCDURL, cfg.ArgoCDToken, httpclient.New("argocd", clientOptions("argocd"), logger))
+		// Syncs are authorized against cluster RBAC
+		argoHandler = argocd.NewHandler(argoClient, kubeClient.Clientset, bus, argocd.Options{
+			UserHeader:   cfg.AuthProxyUserHeader,
+			GroupsHeader: cfg.AuthProxyGroupsHeader,
+		}, logger)
+	}
+
+	// Webhook receivers for external systems
+	var webhookProviders []webhooks.Provider
+	if cfg.WebhookGitHubSecret != "" {
+		webhookProviders = append(webhookProviders, webhooks.GitHub{Secret: cfg.WebhookGitHubSecret})
+	}
+	if cfg.WebhookHarborSecret != "" {
+		webhookProviders = append(webhookProviders, webhooks.Harbor{Secret: cfg.WebhookHarborSecret, Tolerance: cfg.WebhookReplayWindow})
+	}
+	if cfg.WebhookAlertmanagerToken != "" {
+		webhookProviders = append(webhookProviders, webhooks.Alertmanager{Token: cfg.WebhookAlertmanagerToken})
+	}
+	webhookReceiver := webhooks.NewReceiver(bus, cfg.WebhookReplayWindow, logger, webhookProviders...)
+
+	// ─── Configure Public Routes ─────────────────────────────────────
+	mux := http.NewServeMux()
+
+	// Gateway routes to internal backends
+	var gateway *proxy.Proxy
+	if cfg.ProxyRoutesFile != "" {
+		routes, err := proxy.LoadRoutes(cfg.ProxyRoutesFile)
+		if err != nil {
+			return fmt.Errorf("load proxy routes: %w", err)
+		}
+		gateway, err = proxy.New(routes, proxy.Options{SessionCookie: cfg.SessionCookieName}, logger)
+		if err != nil {
+			return fmt.Errorf("configure proxy: %w", err)
+		}
+	}
+
+	// Application API routes (also served alone as the "api" virtual host)
+	registerAPI := func(m *http.ServeMux) {
+		m.HandleFunc("/api/v1/info", apiHandler.Info)
+		m.HandleFunc("/api/v1/status", apiHandler.Status)
+		m.Handle("/graphql", graphHandler)
+		m.Handle("POST /webhooks/{provider}", webhookReceiver)
+		m.Handle("GET /api/v1/events", events.NewPollHandler(a.Events, cfg.EventsMaxWait))
+		m.Handle("GET /api/v1/features", flags)
+		supplyChain.Register(m)
+		if agentHub != nil {
+			m.Handle("GET /api/v1/agents", agentHub)
+		}
+		if resourceAPI != nil {
+			resourceAPI.Register(m)
+		}
+		if searchAPI != nil {
+			searchAPI.Register(m)
+		}
+		if backupAPI != nil {
+			backupAPI.Register(m)
+		}
+		if queueAPI != nil {
+			queueAPI.Register(m)
+		}
+		if a.enforcer != nil {
+			a.enforcer.Register(m)
+		}
+		if a.tokenService != nil {
+			a.tokenService.Register(m)
+		}
+		if a.sessions != nil {
+			a.sessions.Register(m)
+		}
+		if credentialAPI != nil {
+			credentialAPI.Register(m)
+		}
+		if webhookKeys != nil {
+			webhookKeys.Register(m)
+		}
+		if auditAPI != nil {
+			auditAPI.Register(m)
+		}
+		if workloadList != nil {
+			workloadList.Register(m)
+		}
+		if podLogs != nil {
+			podLogs.Register(m)
+		}
+		if warningFeed != nil {
+			warningFeed.Register(m)
+		}
+		if lockHandler != nil {
+			lockHandler.Register(m)
+		}
+		if helmInv != nil {
+			helmInv.Register(m)
+		}
+		if onboarder != nil {
+			onboarder.Register(m)
+		}
+		if svcCatalog != nil {
+			svcCatalog.Register(m)
+		}
+		if authzCheck != nil {
+			authzCheck.Register(m)
+		}
+		if jobRunner != nil {
+			jobRunner.Register(m)
+		}
+		if nodeInv != nil {
+			nodeInv.Register(m)
+		}
+		if quotaReport != nil {
+			quotaReport.Register(m)
+		}
+		if nodeOpsAPI != nil {
+			nodeOpsAPI.Register(m)
+		}
+		if images != nil {
+			images.Register(m)
+		}
+		if costReport != nil {
+			costReport.Register(m)
+		}
+		if podExec != nil {
+			podExec.Register(m)
+		}
+		if budgets != nil {
+			budgets.Register(m)
+		}
+		if renderer != nil {
+			renderer.Register(m)
+		}
+		if scaffolder != nil {
+			scaffolder.Register(m)
+		}
+		if a.objectAPI != nil {
+			a.objectAPI.Register(m)
+		}
+		if infraRuns != nil {
+			infraRuns.Register(m)
+		}
+		if fleet != nil {
+			fleet.Register(m)
+		}
+		if argoHandler != nil {
+			argoHandler.Register(m)
+		}
+		if gateway != nil {
+			gateway.Register(m)
+		}
+	}
+	registerAPI(mux)
+
+	// Portal frontend, served from the same pod
+	assets := static.Embedded()
+	if cfg.StaticDir != "" {
+		assets = static.Dir(cfg.StaticDir)
+	}
+	staticPrefix := strings.TrimSuffix(cfg.StaticPrefix, "/")
+	if cfg.StaticEnabled {
+		mux.Handle(staticPrefix+"/", static.New(assets, staticPrefix))
+	}
+
+	if cfg.APIExplorerEnabled {
+		mux.Handle("GET /explorer", dev.Explorer(dev.ExplorerOptions{
+			Service:      cfg.ServiceName,
+			UserHeader:   cfg.AuthProxyUserHeader,
+			GroupsHeader: cfg.AuthProxyGroupsHeader,
+		}))
+	}
+
+	// Root endpoint (optional catch-all for testing)
+	if !cfg.StaticEnabled || staticPrefix != "" {
+		mux.HandleFunc("/", apiHandler.Info)
+	}
+
+	// ─── Apply Middleware ────────────────────────────────────────────
+	// Requests slower than their route's latency budget are logged and
+	// counted; measured around the mux, which names the route
+	latencyBudgets := make(map[string]time.Duration, len(cfg.LatencyBudgets))
+	for pattern, value := range cfg.LatencyBudgets {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid latency budget for %s: %w", pattern, err)
+		}
+		latencyBudgets[pattern] = d
+	}
+	budgeted := func(h http.Handler) http.Handler {
+		if len(latencyBudgets) == 0 && cfg.LatencyBudgetDefault <= 0 {
+			return h
+		}
+		return middleware.LatencyBudget(latencyBudgets, cfg.LatencyBudgetDefault, cfg.TraceURLTemplate, logger, h)
+	}
+	// The cluster header sends cluster-scoped requests to a remote cluster
+	clusterRouted := func(h http.Handler) http.Handler {
+		if fleet == nil {
+			return h
+		}
+		return fleet.Middleware(h)
+	}
+	// Rate limits, idempotency keys and response caching share the cache
+	cached := func(h http.Handler) http.Handler {
+		if len(cfg.ResponseCachePaths) > 0 {
+			vary := []string{cfg.AuthProxyUserHeader, cfg.AuthProxyGroupsHeader, cfg.KubeClusterHeader, "Accept"}
+			h = middleware.ResponseCache(a.Cache, cfg.ResponseCacheTTL, cfg.ResponseCachePaths, vary, logger, h)
+		}
+		if cfg.IdempotencyTTL > 0 {
+			h = middleware.Idempotency(a.Cache, cfg.IdempotencyTTL, cfg.AuthProxyUserHeader, logger, h)
+		}
+		if cfg.RateLimit > 0 {
+			h = middleware.RateLimit(a.Cache, cfg.RateLimit, cfg.RateLimitWindow, cfg.AuthProxyUserHeader, logger, h)
+		}
+		return h
+	}
+	handler := middleware.RequestID(
+		middleware.Logging(logger,
+			middleware.Recovery(logger,
+				middleware.CORS(a.authorized(cached(clusterRouted(budgeted(mux))))),
+			),
+		),
+	)
+
+	// ─── Virtual Hosts ───────────────────────────────────────────────
+	// Each logical API gets its own route table and middleware chain;
+	// unmatched hosts get the combined table above.
+	if len(cfg.VirtualHosts) > 0 {
+		apiMux := http.NewServeMux()
+		registerAPI(apiMux)
+		var portal http.Handler = static.New(assets, "")
+		if a.sessions != nil {
+			// Browsers sign in on the portal's host too, so the cookie is there
+			portalMux := http.NewServeMux()
+			a.sessions.Register(portalMux)
+			portalMux.Handle("/", portal)
+			portal = a.sessions.Middleware(portalMux)
+		}
+
+		tables := map[string]http.Handler{
+			"api": middleware.RequestID(
+				middleware.Logging(logger,
+					middleware.Recovery(logger,
+						middleware.CORS(a.authorized(cached(clusterRouted(budgeted(apiMux))))),
+					),
+				),
+			),
+			"portal": middleware.RequestID(
+				middleware.Logging(logger,
+					middleware.Recovery(logger, portal),
+				),
+			),
+		}
+
+		router := server.NewHostRouter(handler)
+		for host, table := range cfg.VirtualHosts {
+			h, ok := tables[table]
+			if !ok {
+				return fmt.Errorf("unknown route table %q for virtual host %s", table, host)
+			}
+			router.Handle(host, h)
+			logger.Info("virtual host registered", zap.String("host", host), zap.String("table", table))
+		}
+		handler = router
+	}
+	// Counted across every route table; exported as a custom metric for HPAs
+	handler = middleware.InFlight(handler)
+	// Outermost, so that a shed request costs as little as possible
+	if cfg.LoadShedEnabled {
+		shedder := loadshed.New(loadshed.Options{
+			LatencyTarget:    cfg.LoadShedLatencyTarget,
+			CPUThreshold:     cfg.LoadShedCPUThreshold,
+			Interval:         cfg.LoadShedInterval,
+			LowPriorityPaths: cfg.LoadShedLowPriorityPaths,
+		}, logger)
+		handler = shedder.Middleware(handler)
+		a.background(shedder.Run)
+		logger.Info("load shedding enabled",
+			zap.Duration("latency_target", cfg.LoadShedLatencyTarget),
+			zap.Float64("cpu_threshold", cfg.LoadShedCPUThreshold),
+		)
+	}
+	a.Handler = handler
+
+	// ─── Background Work ─────────────────────────────────────────────
+	// Informers requested by the handlers above start with the warmup;
+	// the replica is not ready before their caches are synced
+	if kubeClient != nil {
+		a.Warmup.Add("kube-informers", true, func(ctx context.Context) error {
+			// The informers run until shutdown; ctx bounds the wait only
+			kubeClient.Informers.Start(a.ctx.Done())
+			return kubeClient.WaitForSync(ctx)
+		})
+		a.Lifecycle.OnShutdown("kube-informers", lifecycle.PhaseWorkers, 0, kubeClient.Shutdown)
+	}
+	if fleet != nil {
+		a.onStart(func(ctx context.Context) error {
+			fleet.Start(ctx)
+			return nil
+		})
+		a.Lifecycle.OnShutdown("remote-cluster-informers", lifecycle.PhaseWorkers, 0, fleet.Shutdown)
+	}
+	if helmRepos != nil {
+		a.background(func(ctx context.Context) { helmRepos.Run(ctx, cfg.HelmRepoRefresh) })
+	}
+	if quotaReport != nil {
+		a.background(func(ctx context.Context) { quotaReport.Run(ctx, cfg.QuotaReportInterval) })
+	}
+	if images != nil {
+		a.background(func(ctx context.Context) { images.Run(ctx, cfg.RegistryRefresh) })
+	}
+	if pricing != nil {
+		a.background(func(ctx context.Context) { pricing.Run(ctx, cfg.CostsPricingRefresh) })
+	}
+	if database := a.Database; database != nil {
+		a.background(func(ctx context.Context) { database.MonitorReplicas(ctx, cfg.DatabaseReplicaCheckInterval, logger) })
+	}
+	if cfg.OutboxEnabled {
+		relay := outbox.NewRelay(st, bus, outbox.Options{
+			Interval:  cfg.OutboxInterval,
+			BatchSize: cfg.OutboxBatchSize,
+			Retention: cfg.OutboxRetention,
+		}, logger)
+		a.background(relay.Run)
+	}
+	if jobQueue != nil {
+		a.background(jobQueue.Run)
+		a.Lifecycle.OnShutdown("job-queue", lifecycle.PhaseWorkers, 0, jobQueue.Shutdown)
+	}
+	if onboarder != nil {
+		a.Lifecycle.OnShutdown("onboarding", lifecycle.PhaseWorkers, 0, onboarder.Shutdown)
+	}
+	if nodeOps != nil {
+		a.Lifecycle.OnShutdown("node-drains", lifecycle.PhaseWorkers, 0, nodeOps.Shutdown)
+	}
+	if podExec != nil {
+		a.Lifecycle.OnShutdown("exec-sessions", lifecycle.PhaseWorkers, 0, podExec.Shutdown)
+	}
+	if atlantis != nil {
+		a.Lifecycle.OnShutdown("atlantis-runs", lifecycle.PhaseWorkers, 0, atlantis.Shutdown)
+	}
+	if cfg.FeatureFlagsConfigMap != "" {
+		a.onStart(func(ctx context.Context) error {
+			if err := flags.WatchConfigMap(ctx, kubeClient.Clientset, cfg.PodNamespace, cfg.FeatureFlagsConfigMap, cfg.KubeResyncPeriod); err != nil {
+				return fmt.Errorf("watch feature flag configmap: %w", err)
+			}
+			return nil
+		})
+	}
+	if a.opaEngine != nil && cfg.OPAPolicyNamespace != "" {
+		a.onStart(func(ctx context.Context) error {
+			if err := a.opaEngine.WatchPolicies(ctx, kubeClient.Clientset, cfg.OPAPolicyNamespace, cfg.KubeResyncPeriod); err != nil {
+				return fmt.Errorf("watch OPA policy configmaps: %w", err)
+			}
+			return nil
+		})
+	}
+
+	// ─── Agent Mode (optional) ───────────────────────────────────────
+	if cfg.AgentMode {
+		nodeName := cfg.NodeName
+		if nodeName == "" {
+			nodeName, _ = os.Hostname()
+		}
+		nodeAgent, err := agent.New(agent.Options{
+			CentralAddr:    cfg.AgentCentralAddr,
+			NodeName:       nodeName,
+			Version:        cfg.Version,
+			ReportInterval: cfg.AgentReportInterval,
+			TLS:            cfg.AgentTLS,
+			TokenFile:      cfg.AgentTokenFile,
+		}, logger)
+		if err != nil {
+			return fmt.Errorf("configure agent mode: %w", err)
+		}
+		a.background(nodeAgent.Run)
+		logger.Info("agent mode enabled",
+			zap.String("central", cfg.AgentCentralAddr),
+			zap.String("node", nodeName),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,437 @@
+// Package app is the composition root of the platform API service. New
+// builds every component the configuration enables (stores, event bus,
+// Kubernetes clients, handlers, middleware and listeners) and wires them
+// together; Start, Run and Shutdown drive their lifecycle.
+//
+// Tests assemble partial apps by turning features off in the configuration
+// and passing their own store, cache, bus or Kubernetes client in Options,
+// then serve requests through Handler and AdminHandler without binding a
+// port.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/abuse"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/access"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/cache"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/cgroup"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/config"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/encryption"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/handlers"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/httpclient"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/kube"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/leakwatch"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/lifecycle"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/memwatch"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/objectstore"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/opa"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/rbac"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/redact"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/rpc"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/server"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/session"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/siem"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/spiffe"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/startup"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/tokens"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/warmup"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/workpool"
+)
+
+// Options supplies what New does not build from the configuration. Every
+// field is optional.
+type Options struct {
+	// Logger defaults to a logger at LOG_LEVEL for ENVIRONMENT.
+	Logger *zap.Logger
+	// Redactor masks sensitive data in events, audit records and debug
+	// endpoints; nil disables masking.
+	Redactor *redact.Redactor
+	// Limits are the container limits the runtime was sized to, reported by
+	// the status endpoint.
+	Limits *cgroup.Limits
+
+	// Store, Cache, Bus and Kube replace the ones STORE_BACKEND,
+	// REDIS_ADDRS, EVENTS_BACKEND and KUBE_ENABLED select. Kube enables the
+	// Kubernetes features even if KUBE_ENABLED is off.
+	Store *store.Store
+	Cache cache.Cache
+	Bus   events.Bus
+	Kube  *kube.Client
+}
+
+// App is the assembled service.
+type App struct {
+	Config *config.Config
+	Logger *zap.Logger
+	// Lifecycle holds the shutdown hooks of every component New created.
+	Lifecycle *lifecycle.Registry
+
+	Store *store.Store
+	// Database is nil unless STORE_BACKEND is postgres.
+	Database *store.Postgres
+	Cache    cache.Cache
+	Bus      events.Bus
+	Events   *events.Log
+	// Kube is nil when the Kubernetes features are off.
+	Kube *kube.Client
+
+	Health *handlers.HealthHandler
+	// Startup connects the dependencies New built, in the order they were
+	// built; Warmup runs once they are up.
+	Startup *startup.Orchestrator
+	Warmup  *warmup.Warmup
+
+	// Handler serves the public port: the route tables behind the
+	// middleware chain. AdminHandler serves probes, metrics and pprof.
+	Handler      http.Handler
+	AdminHandler http.Handler
+	// RPC is nil unless ENABLE_GRPC is set.
+	RPC    *rpc.Server
+	Public *server.Server
+	Admin  *server.Server
+
+	redactor      *redact.Redactor
+	limits        *cgroup.Limits
+	clientOptions func(name string) httpclient.Options
+	workers       *workpool.Pool
+
+	redisCache *cache.Redis
+	natsBus    *events.NATSBus
+	objects    *objectstore.Client
+	objectAPI  *objectstore.Handler
+	encryptor  *encryption.Encryptor
+
+	forwarder    *siem.Forwarder
+	enforcer     *rbac.Enforcer
+	routeAccess  *access.Resolver
+	proxies      access.Proxies
+	tokenService *tokens.Service
+	sessions     *session.Manager
+	guard        *abuse.Guard
+	svids        *spiffe.Source
+	spiffeAuth   *spiffe.Authenticator
+	opaEngine    *opa.Engine
+	leaks        *leakwatch.Detector
+
+	admission     *server.Server
+	customMetrics *server.Server
+	http3         *http3.Server
+
+	// ctx is canceled on shutdown and bounds the background work
+	ctx      context.Context
+	starters []func(ctx context.Context) error
+}
+
+// New assembles the service cfg describes. Nothing runs and no port is
+// bound until Start. If New fails, whatever it had opened is closed again.
+func New(cfg *config.Config, opts Options) (*App, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = middleware.NewLogger(cfg.LogLevel, cfg.Environment)
+	}
+	logger.Info("starting platform API service",
+		zap.String("version", cfg.Version),
+		zap.String("environment", cfg.Environment),
+		zap.Int("port", cfg.Port),
+		zap.Int("admin_port", cfg.AdminPort),
+		zap.String("json_codec", codec.Default().Name()),
+	)
+
+	a := &App{
+		Config: cfg,
+		Logger: logger,
+		// Components register their shutdown steps here as they are created
+		Lifecycle: lifecycle.New(logger),
+		redactor:  opts.Redactor,
+		limits:    opts.Limits,
+		// Outbound clients named in OAUTH2_CLIENTS attach client-credentials tokens
+		clientOptions: outboundOptions(cfg, logger),
+		// CPU-heavy request work shares a bounded set of workers
+		workers: workpool.New("cpu", cfg.WorkerPoolSize, cfg.WorkerPoolQueue),
+		// Components declare what must answer before the replica serves
+		Startup: startup.New(startup.Options{
+			Timeout:        cfg.StartupTimeout,
+			AttemptTimeout: cfg.StartupAttemptTimeout,
+			BackoffBase:    cfg.StartupBackoffBase,
+			BackoffMax:     cfg.StartupBackoffMax,
+		}, logger),
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	a.ctx = ctx
+	a.Lifecycle.OnShutdown("background-tasks", lifecycle.PhaseWorkers, 0, func(context.Context) error {
+		stop()
+		return nil
+	})
+
+	err := a.initSIEM()
+	if err == nil {
+		err = a.initStorage(opts)
+	}
+	if err == nil {
+		err = a.initHealth()
+	}
+	if err == nil {
+		err = a.initAccess()
+	}
+	if err == nil {
+		err = a.initAPI()
+	}
+	if err == nil {
+		err = a.initServers()
+	}
+	if err != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		a.Lifecycle.Shutdown(ctx)
+		return nil, err
+	}
+	return a, nil
+}
+
+// initHealth sets up the probes, the startup dependencies and warmup gating
+// readiness, and the memory and goroutine watchdogs.
+func (a *App) initHealth() error {
+	cfg, logger := a.Config, a.Logger
+	a.Health = handlers.NewHealthHandler(logger, cfg)
+	a.Health.AddReadinessCheck("dependencies", a.Startup.Check)
+	// Components register what to do before the first request; ready after
+	a.Warmup = warmup.New(cfg.WarmupTimeout, logger)
+	a.Health.AddReadinessCheck("warmup", a.Warmup.Check)
+	if database := a.Database; database != nil {
+		a.Health.AddReadinessCheck("database", database.Check)
+		// Until a migration Job or another replica brings the schema up to date
+		a.Health.AddReadinessCheck("database-schema", database.CheckSchema)
+		a.Warmup.Add("database-pool", false, func(ctx context.Context) error {
+			return database.Warm(ctx, cfg.DatabaseMaxIdleConns)
+		})
+	}
+	if a.redisCache != nil {
+		a.Health.AddReadinessCheck("redis", a.redisCache.Check)
+	}
+	if a.natsBus != nil {
+		a.Health.AddReadinessCheck("nats", a.natsBus.Check)
+	}
+	if a.redactor != nil {
+		a.background(func(ctx context.Context) { a.redactor.Watch(ctx, cfg.RedactionReloadInterval) })
+	}
+	if cfg.MemoryWatchdogEnabled {
+		l, err := cgroup.Read(cgroup.Root)
+		switch {
+		case err != nil:
+			logger.Warn("memory watchdog disabled: failed to read cgroup limits", zap.Error(err))
+		case l.MemoryLimit == 0:
+			logger.Warn("memory watchdog disabled: no container memory limit")
+		default:
+			watchdog := memwatch.New(memwatch.Options{
+				Limit:             l.MemoryLimit,
+				Interval:          cfg.MemoryWatchdogInterval,
+				GCThreshold:       cfg.MemoryWatchdogGC,
+				CachesThreshold:   cfg.MemoryWatchdogCaches,
+				NotReadyThreshold: cfg.MemoryWatchdogNotReady,
+				ShutdownThreshold: cfg.MemoryWatchdogShutdown,
+				// Through the signal handler, like a pod deletion
+				Shutdown: func() { syscall.Kill(os.Getpid(), syscall.SIGTERM) },
+			}, a.Bus, logger)
+			if mem, ok := a.Cache.(*cache.Memory); ok {
+				// Cached responses are rebuilt on the next request
+				watchdog.OnPressure("response-cache", func() { mem.DeletePrefix("response:") })
+			}
+			a.Health.AddReadinessCheck("memory", watchdog.Check)
+			a.background(watchdog.Run)
+		}
+	}
+	if cfg.GoroutineLeakDetection {
+		a.leaks = leakwatch.New(leakwatch.Options{
+			Interval:  cfg.GoroutineLeakInterval,
+			Baseline:  cfg.GoroutineLeakBaseline,
+			Tolerance: cfg.GoroutineLeakTolerance,
+			Window:    cfg.GoroutineLeakWindow,
+		}, a.Bus, logger)
+		a.background(a.leaks.Run)
+	}
+	return nil
+}
+
+// onStart runs fn on Start, with a context canceled on shutdown.
+func (a *App) onStart(fn func(ctx context.Context) error) {
+	a.starters = append(a.starters, fn)
+}
+
+// background runs fn in its own goroutine from Start until shutdown.
+func (a *App) background(fn func(ctx context.Context)) {
+	a.onStart(func(ctx context.Context) error {
+		go fn(ctx)
+		return nil
+	})
+}
+
+// Start serves the admin listener, brings up the startup dependencies,
+// then starts the background work, serves the other listeners and runs the
+// warmup; the replica turns ready once the warmup is done. A replacement
+// process (zero-downtime restart) tells its parent it is serving at that
+// point. Start fails if a required dependency does not come up.
+func (a *App) Start() error {
+	cfg, logger := a.Config, a.Logger
+	if a.RPC != nil {
+		a.Lifecycle.OnShutdown("grpc", lifecycle.PhaseListeners, 0, a.RPC.Shutdown)
+	}
+	// The connection cap applies to the public listener only, so probes and
+	// scrapes still get through when the API is saturated.
+	adminOpts := server.ListenOptions{
+		ReusePort: cfg.ReusePort,
+		KeepAlive: cfg.TCPKeepAlive,
+	}
+	publicOpts := adminOpts
+	publicOpts.MaxConns = cfg.MaxConns
+
+	// Probes answer, not ready, while the dependencies come up
+	if err := a.Admin.Listen(adminOpts); err != nil {
+		return fmt.Errorf("bind admin listener: %w", err)
+	}
+	a.Admin.Start()
+	// Admin goes last so probes and metrics stay reachable while draining
+	a.Lifecycle.OnShutdown("admin-listener", lifecycle.PhaseFinal, 0, a.Admin.Shutdown)
+	if err := a.Startup.Run(a.ctx); err != nil {
+		return fmt.Errorf("start dependencies: %w", err)
+	}
+
+	for _, start := range a.starters {
+		if err := start(a.ctx); err != nil {
+			return err
+		}
+	}
+	if err := a.Public.Listen(publicOpts); err != nil {
+		return fmt.Errorf("bind public listener: %w", err)
+	}
+	a.Public.Start()
+	for _, s := range []*server.Server{a.admission, a.customMetrics} {
+		if s == nil {
+			continue
+		}
+		if err := s.Listen(adminOpts); err != nil {
+			return fmt.Errorf("bind %s listener: %w", s.Name(), err)
+		}
+		s.Start()
+		a.Lifecycle.OnShutdown(s.Name()+"-listener", lifecycle.PhaseListeners, 0, s.Shutdown)
+	}
+	a.Lifecycle.OnShutdown("public-listener", lifecycle.PhaseListeners, 0, a.Public.Shutdown)
+
+	go func() {
+		if err := a.Warmup.Run(a.ctx); err != nil {
+			logger.Fatal("warmup failed", zap.Error(err))
+		}
+		if err := server.NotifyRestartReady(); err != nil {
+			logger.Error("failed to notify parent process", zap.Error(err))
+		}
+	}()
+
+	if a.http3 != nil {
+		a.Lifecycle.OnShutdown("http3-listener", lifecycle.PhaseListeners, 0, a.http3.Shutdown)
+		go func() {
+			logger.Info("http3 listening", zap.String("addr", a.http3.Addr))
+			if err := a.http3.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("http3 server failed", zap.Error(err))
+			}
+		}()
+	}
+	return nil
+}
+
+// Run starts the app and serves until SIGINT or SIGTERM, then drains and
+// shuts it down. SIGUSR2 hands the listeners to a freshly started copy of
+// the binary (in-place upgrade) and drains this process once the copy is
+// serving. If Start fails, Run shuts down what it had started and returns
+// the error.
+func (a *App) Run() error {
+	cfg, logger := a.Config, a.Logger
+	if err := a.Start(); err != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		a.Shutdown(ctx)
+		return err
+	}
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR2)
+	defer signal.Stop(quit)
+
+	var sig os.Signal
+	restarted := false
+	for sig = range quit {
+		if sig != syscall.SIGUSR2 {
+			break
+		}
+		logger.Info("restart requested, starting replacement process")
+		restartable := []*server.Server{a.Admin, a.Public}
+		for _, s := range []*server.Server{a.admission, a.customMetrics} {
+			if s != nil {
+				restartable = append(restartable, s)
+			}
+		}
+		child, err := server.Restart(logger, cfg.RestartTimeout, restartable...)
+		if err != nil {
+			logger.Error("restart failed, continuing to serve", zap.Error(err))
+			continue
+		}
+		logger.Info("replacement process ready", zap.Int("pid", child.Pid))
+		restarted = true
+		break
+	}
+	logger.Info("received shutdown signal", zap.String("signal", sig.String()))
+
+	// Mark service as not ready (Kubernetes will stop sending traffic).
+	// After a restart the replacement shares our probe port and is ready,
+	// so this process just drains quietly.
+	if !restarted {
+		a.Health.SetNotReady()
+		if a.RPC != nil {
+			a.RPC.SetNotServing()
+		}
+	}
+
+	// Stop reusing connections, then keep serving until the endpoint removal
+	// has propagated so no new requests hit a closed listener.
+	a.Public.DisableKeepAlives()
+	if !restarted && cfg.ShutdownDelay > 0 {
+		logger.Info("waiting for endpoint propagation", zap.Duration("delay", cfg.ShutdownDelay))
+		time.Sleep(cfg.ShutdownDelay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	// Allow in-flight requests to drain
+	logger.Info("draining connections",
+		zap.Duration("timeout", cfg.ShutdownTimeout),
+		zap.Int64("open_conns", a.Public.OpenConns()),
+	)
+	return a.Lifecycle.Shutdown(ctx)
+}
+
+// Shutdown marks the replica not ready and runs every shutdown hook, for
+// apps started with Start rather than Run.
+func (a *App) Shutdown(ctx context.Context) error {
+	a.Health.SetNotReady()
+	if a.RPC != nil {
+		a.RPC.SetNotServing()
+	}
+	a.Public.DisableKeepAlives()
+	return a.Lifecycle.Shutdown(ctx)
+}
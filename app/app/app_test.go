@@ -0,0 +1,257 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/config"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+func TestNewServesPartialApp(t *testing.T) {
+	t.Setenv("RESOURCES_API_ENABLED", "true")
+	t.Setenv("RESOURCES_ADMIN_GROUPS", "platform-admins")
+	// httptest requests come from 192.0.2.1
+	t.Setenv("AUTH_PROXY_TRUSTED_CIDRS", "192.0.2.0/24")
+	st := store.NewMemory()
+	a, err := New(config.Load(), Options{Logger: zap.NewNop(), Store: st})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Store != st || a.Kube != nil || a.Database != nil || a.RPC != nil {
+		t.Fatalf("expected only the given memory store and no cluster, database or gRPC, got %+v", a)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tenants", strings.NewReader(`{"name":"payments","display_name":"Payments","owner":"team-payments"}`))
+	req.Header.Set("X-Forwarded-User", "alice")
+	req.Header.Set("X-Forwarded-Groups", "platform-admins")
+	rec := httptest.NewRecorder()
+	a.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated || rec.Header().Get("X-Request-ID") == "" {
+		t.Fatalf("expected 201 through the middleware chain, got %d %v: %s", rec.Code, rec.Header(), rec.Body)
+	}
+	tenants, err := st.Tenants.List(context.Background())
+	if err != nil || len(tenants) != 1 || tenants[0].Name != "payments" {
+		t.Errorf("expected the tenant in the given store, got %+v %v", tenants, err)
+	}
+
+	rec = httptest.NewRecorder()
+	a.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/info", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"version"`) {
+		t.Errorf("expected the service info, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// Not ready before Start has run the warmup
+	rec = httptest.NewRecorder()
+	a.AdminHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected not ready before the warmup, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	a.AdminHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected live, got %d", rec.Code)
+	}
+}
+
+func TestIdentityHeadersRequireTrustedProxy(t *testing.T) {
+	t.Setenv("RESOURCES_API_ENABLED", "true")
+	t.Setenv("RESOURCES_ADMIN_GROUPS", "platform-admins")
+	t.Setenv("AUTH_PROXY_TRUSTED_CIDRS", "10.0.0.0/8")
+	a, err := New(config.Load(), Options{Logger: zap.NewNop(), Store: store.NewMemory()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name, remote string
+		want         int
+	}{
+		{"spoofed by a client", "192.0.2.1:1234", http.StatusUnauthorized},
+		{"from the proxy", "10.0.0.7:1234", http.StatusCreated},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/tenants", strings.NewReader(`{"name":"payments","display_name":"Payments","owner":"team-payments"}`))
+		req.RemoteAddr = tt.remote
+		req.Header.Set("X-Forwarded-User", "alice")
+		req.Header.Set("X-Forwarded-Groups", "platform-admins")
+		rec := httptest.NewRecorder()
+		a.Handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.want, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestTokensInheritOwnerGroupRoles(t *testing.T) {
+	scimServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("filter") == `userName eq "alice"` {
+			w.Write([]byte(`{"Resources":[{"userName":"alice","groups":[{"display":"platform-admins"}]}]}`))
+			return
+		}
+		w.Write([]byte(`{"Resources":[]}`))
+	}))
+	defer scimServer.Close()
+	t.Setenv("RESOURCES_API_ENABLED", "true")
+	t.Setenv("RESOURCES_ADMIN_GROUPS", "platform-admins")
+	t.Setenv("RBAC_ENABLED", "true")
+	t.Setenv("RBAC_GROUP_ROLES", "platform-admins=admin")
+	t.Setenv("TOKENS_ENABLED", "true")
+	t.Setenv("SCIM_URL", scimServer.URL)
+	t.Setenv("AUTH_PROXY_TRUSTED_CIDRS", "192.0.2.0/24")
+	a, err := New(config.Load(), Options{Logger: zap.NewNop(), Store: store.NewMemory()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// mint signs user in through the proxy, without groups, and creates a token
+	mint := func(user string) string {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/tokens", strings.NewReader(`{"name":"ci","scopes":["tenants:write"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-User", user)
+		rec := httptest.NewRecorder()
+		a.Handler.ServeHTTP(rec, req)
+		var created struct {
+			Secret string `json:"secret"`
+		}
+		if rec.Code != http.StatusCreated || json.Unmarshal(rec.Body.Bytes(), &created) != nil {
+			t.Fatalf("expected the token to be created, got %d: %s", rec.Code, rec.Body)
+		}
+		return created.Secret
+	}
+
+	for _, tt := range []struct {
+		user string
+		want int
+	}{
+		{"alice", http.StatusCreated},
+		{"bob", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/tenants", strings.NewReader(`{"name":"payments-`+tt.user+`","display_name":"Payments","owner":"team-payments"}`))
+		req.Header.Set("Authorization", "Bearer "+mint(tt.user))
+		rec := httptest.NewRecorder()
+		a.Handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s's token: expected %d from the groups in the directory, got %d: %s", tt.user, tt.want, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestStartAndShutdown(t *testing.T) {
+	t.Setenv("PORT", "0")
+	t.Setenv("ADMIN_PORT", "0")
+	a, err := New(config.Load(), Options{Logger: zap.NewNop()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopped := make(chan struct{})
+	a.background(func(ctx context.Context) {
+		<-ctx.Done()
+		close(stopped)
+	})
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for a.Warmup.Check(context.Background()) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the warmup to finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := a.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	a.AdminHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected not ready after shutdown, got %d", rec.Code)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Error("expected background work to be stopped")
+	}
+}
+
+func TestStartFailsWithoutRequiredDependency(t *testing.T) {
+	t.Setenv("PORT", "0")
+	t.Setenv("ADMIN_PORT", "0")
+	// Nothing listens on port 1
+	t.Setenv("REDIS_ADDRS", "127.0.0.1:1")
+	t.Setenv("STARTUP_TIMEOUT", "200ms")
+	t.Setenv("STARTUP_ATTEMPT_TIMEOUT", "50ms")
+	t.Setenv("STARTUP_BACKOFF_BASE", "1ms")
+	t.Setenv("STARTUP_BACKOFF_MAX", "10ms")
+	a, err := New(config.Load(), Options{Logger: zap.NewNop()})
+	if err != nil {
+		t.Fatalf("expected New not to connect, got %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		a.Shutdown(ctx)
+	}()
+
+	if err := a.Start(); err == nil || !strings.Contains(err.Error(), "redis") {
+		t.Errorf("expected Start to fail on Redis, got %v", err)
+	}
+	rec := httptest.NewRecorder()
+	a.AdminHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected not ready without Redis, got %d", rec.Code)
+	}
+}
+
+func TestDevModeServesSampleData(t *testing.T) {
+	t.Setenv("DEV_MODE", "true")
+	t.Setenv("API_EXPLORER_ENABLED", "true")
+	t.Setenv("RESOURCES_API_ENABLED", "true")
+	t.Setenv("RESOURCES_ADMIN_GROUPS", "platform-admins")
+	t.Setenv("AUTH_PROXY_TRUSTED_CIDRS", "192.0.2.0/24")
+	a, err := New(config.Load(), Options{Logger: zap.NewNop()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Kube == nil {
+		t.Fatal("expected the fake cluster")
+	}
+
+	// No identity: served as the developer, an admin
+	for path, want := range map[string]string{
+		"/api/v1/tenants":               `"payments"`,
+		"/api/v1/workloads/deployments": `"ledger"`,
+		"/explorer":                     "API explorer",
+	} {
+		rec := httptest.NewRecorder()
+		a.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("%s: expected 200 with %s, got %d: %s", path, want, rec.Code, rec.Body)
+		}
+	}
+
+	// A named user is kept, and is no admin
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tenants", strings.NewReader(`{"name":"checkout","display_name":"Checkout","owner":"team-checkout"}`))
+	req.Header.Set("X-Forwarded-User", "mallory")
+	rec := httptest.NewRecorder()
+	a.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected a named user without the admin group refused, got %d", rec.Code)
+	}
+}
+
+func TestNewRejectsInvalidConfiguration(t *testing.T) {
+	t.Setenv("QUEUE_ENABLED", "true")
+	if _, err := New(config.Load(), Options{Logger: zap.NewNop()}); err == nil || !strings.Contains(err.Error(), "QUEUE_ADMIN_GROUPS") {
+		t.Errorf("expected the configuration error, got %v", err)
+	}
+}
@@ -0,0 +1,258 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/abuse"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/access"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/config"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/dev"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/encryption"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/httpclient"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/jwks"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/lifecycle"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/opa"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/rbac"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/scim"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/session"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/siem"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/spiffe"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/startup"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/tokens"
+)
+
+// initSIEM forwards refused requests, audit log lines and policy violations
+// to the SIEM, masked like the logs. From here on the logger tees into it.
+func (a *App) initSIEM() error {
+	cfg, logger := a.Config, a.Logger
+	if !cfg.SIEMEnabled {
+		return nil
+	}
+	product := siem.Product{Vendor: "k8s-platform-engineering-lab", Name: cfg.ServiceName, Version: cfg.Version}
+	client := httpclient.New("siem", a.clientOptions("siem"), logger)
+	var sink siem.Sink
+	switch cfg.SIEMBackend {
+	case "splunk":
+		sink = &siem.Splunk{URL: cfg.SIEMURL, Token: cfg.SIEMToken, Index: cfg.SIEMIndex, Format: cfg.SIEMFormat, Product: product, Client: client}
+	case "elastic":
+		sink = &siem.Elastic{URL: cfg.SIEMURL, APIKey: cfg.SIEMToken, Index: cfg.SIEMIndex, Format: cfg.SIEMFormat, Product: product, Client: client}
+	default:
+		return fmt.Errorf("SIEM_BACKEND must be splunk or elastic, not %q", cfg.SIEMBackend)
+	}
+	forwarder := siem.New(siem.Options{
+		Sink:         sink,
+		BatchSize:    cfg.SIEMBatchSize,
+		BatchTimeout: cfg.SIEMBatchTimeout,
+		BufferSize:   cfg.SIEMBufferSize,
+		UserHeader:   cfg.AuthProxyUserHeader,
+	}, logger)
+	a.forwarder = forwarder
+	a.Lifecycle.OnShutdown("siem", lifecycle.PhaseFlush, 0, forwarder.Shutdown)
+	a.Logger = logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		audit := forwarder.Core()
+		if a.redactor != nil {
+			audit = a.redactor.WrapCore(audit)
+		}
+		return zapcore.NewTee(core, audit)
+	}))
+	return nil
+}
+
+// initAccess sets up who may call what: platform roles, route scopes,
+// personal access tokens, portal sessions, abuse lockouts, SPIFFE peers and
+// OPA policies.
+func (a *App) initAccess() error {
+	cfg, logger, st := a.Config, a.Logger, a.Store
+	proxies, err := access.ParseProxies(cfg.AuthProxyTrustedCIDRs, cfg.AuthProxyClientCAFile != "")
+	if err != nil {
+		return fmt.Errorf("invalid AUTH_PROXY_TRUSTED_CIDRS: %w", err)
+	}
+	a.proxies = proxies
+	if cfg.RBACEnabled {
+		enforcer, err := rbac.New(st.Roles, rbac.Options{
+			UserHeader:   cfg.AuthProxyUserHeader,
+			GroupsHeader: cfg.AuthProxyGroupsHeader,
+			GroupRoles:   cfg.RBACGroupRoles,
+		}, logger)
+		if err != nil {
+			return fmt.Errorf("invalid RBAC configuration: %w", err)
+		}
+		a.enforcer = enforcer
+	}
+	// Routes declaring scopes or claims with access.Protect are checked
+	// against the caller's roles, with platform roles on
+	accessOpts := access.Options{UserHeader: cfg.AuthProxyUserHeader, GroupsHeader: cfg.AuthProxyGroupsHeader}
+	if a.enforcer != nil {
+		accessOpts.Grants = a.enforcer.PermissionsOf
+	}
+	a.routeAccess = access.New(accessOpts, logger)
+	if cfg.TokensEnabled {
+		directory := scim.NewClient(cfg.SCIMURL, cfg.SCIMToken, httpclient.New("scim", a.clientOptions("scim"), logger))
+		a.tokenService = tokens.New(st.Tokens, tokens.Options{
+			UserHeader:   cfg.AuthProxyUserHeader,
+			GroupsHeader: cfg.AuthProxyGroupsHeader,
+			DefaultTTL:   cfg.TokensDefaultTTL,
+			MaxTTL:       cfg.TokensMaxTTL,
+			Permission:   a.enforcer.Permission,
+			Groups:       directory.Groups,
+		}, logger)
+	}
+	if cfg.SessionsEnabled {
+		sameSite := map[string]http.SameSite{"lax": http.SameSiteLaxMode, "strict": http.SameSiteStrictMode}[cfg.SessionSameSite]
+		provider := session.NewProvider(session.ProviderConfig{
+			IssuerURL:    cfg.OIDCIssuerURL,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       cfg.OIDCScopes,
+			UserClaim:    cfg.OIDCUserClaim,
+			GroupsClaim:  cfg.OIDCGroupsClaim,
+			Keys: jwks.Options{
+				RefreshInterval: cfg.OIDCKeysRefresh,
+				Grace:           cfg.OIDCKeysGrace,
+			},
+		}, httpclient.New("oidc", a.clientOptions("oidc"), logger), logger)
+		opts := session.Options{
+			UserHeader:   cfg.AuthProxyUserHeader,
+			GroupsHeader: cfg.AuthProxyGroupsHeader,
+			Secrets:      cfg.SessionSecrets,
+			CookieName:   cfg.SessionCookieName,
+			IdleTimeout:  cfg.SessionIdleTimeout,
+			MaxAge:       cfg.SessionMaxAge,
+			SameSite:     sameSite,
+			Insecure:     cfg.SessionInsecure,
+		}
+		if enforcer := a.enforcer; enforcer != nil {
+			// A session is rotated when the user's roles change
+			opts.Privileges = func(ctx context.Context, id authz.Identity) (string, error) {
+				roles, err := enforcer.RolesOf(ctx, id)
+				return strings.Join(roles, ","), err
+			}
+		}
+		// Discovery document and signing keys
+		a.Warmup.Add("oidc", false, provider.Check)
+		// Sessions are shared through Redis when it is configured
+		sessions, err := session.New(session.NewCacheStore(a.Cache), provider, opts, logger)
+		if err != nil {
+			return fmt.Errorf("invalid session settings: %w", err)
+		}
+		a.sessions = sessions
+	}
+	if cfg.AbuseProtection {
+		a.guard = abuse.New(a.Cache, a.Bus, st.Audit, abuse.Options{
+			UserHeader:    cfg.AuthProxyUserHeader,
+			MaxFailures:   cfg.AbuseMaxFailures,
+			FailureWindow: cfg.AbuseFailureWindow,
+			Lockout:       cfg.AbuseLockout,
+			MaxLockout:    cfg.AbuseMaxLockout,
+			SpikeMin:      cfg.AbuseSpikeMin,
+			SpikeFactor:   cfg.AbuseSpikeFactor,
+		}, logger)
+	}
+	if cfg.SPIFFEEnabled {
+		a.svids = spiffe.NewSource(cfg.SPIFFEEndpointSocket, logger)
+		a.Health.AddReadinessCheck("spiffe", a.svids.Check)
+		a.spiffeAuth = spiffe.New(a.svids, spiffe.Options{
+			TrustDomains: cfg.SPIFFETrustDomains,
+			UserHeader:   cfg.AuthProxyUserHeader,
+			GroupsHeader: cfg.AuthProxyGroupsHeader,
+			Principals:   cfg.SPIFFEPrincipals,
+			Groups:       cfg.SPIFFEGroups,
+		}, logger)
+	}
+	if cfg.OPAEnabled {
+		// Kafka has already wrapped st.Audit, so decisions reach the audit topic too
+		a.opaEngine = opa.New(opa.NewClient(cfg.OPAURL, httpclient.New("opa", a.clientOptions("opa"), logger)), st.Audit, opa.Options{
+			AuthzPath:     cfg.OPAAuthzPath,
+			AdmissionPath: cfg.OPAAdmissionPath,
+			PathPrefix:    "/api/",
+			FailOpen:      cfg.OPAFailOpen,
+			LogAllowed:    cfg.OPALogAllowed,
+			UserHeader:    cfg.AuthProxyUserHeader,
+			GroupsHeader:  cfg.AuthProxyGroupsHeader,
+		}, logger)
+		// Failing open, requests are served without it: degraded, not down
+		a.Startup.Add(startup.Dependency{Name: "opa", Required: !cfg.OPAFailOpen, Start: a.opaEngine.Check})
+		if !cfg.OPAFailOpen {
+			a.Health.AddReadinessCheck("opa", a.opaEngine.Check)
+		}
+	}
+	return nil
+}
+
+// authorized wraps h in the access checks. Platform roles and OPA policies
+// are checked before anything is served from the cache; a request must pass
+// both. SPIFFE peers, portal sessions and personal access tokens are
+// resolved to their user first, and callers failing that too often are
+// locked out. In dev mode, callers still without a user are the developer.
+// Identity headers are dropped first unless the authenticating proxy sent
+// them.
+func (a *App) authorized(h http.Handler) http.Handler {
+	h = a.routeAccess.Middleware(h)
+	if a.opaEngine != nil {
+		h = a.opaEngine.Middleware(h)
+	}
+	if a.enforcer != nil {
+		h = a.enforcer.Middleware(h)
+	}
+	if a.forwarder != nil {
+		h = a.forwarder.Identify(h)
+	}
+	if a.Config.DevMode {
+		// After tokens and sessions, which may still name the caller
+		h = dev.Identity(a.Config.AuthProxyUserHeader, a.Config.AuthProxyGroupsHeader, h)
+	}
+	if a.tokenService != nil {
+		h = a.tokenService.Middleware(h)
+	}
+	if a.sessions != nil {
+		h = a.sessions.Middleware(h)
+	}
+	if a.spiffeAuth != nil {
+		h = a.spiffeAuth.Middleware(h)
+	}
+	if a.guard != nil {
+		h = a.guard.Middleware(h)
+	}
+	if a.forwarder != nil {
+		h = a.forwarder.Middleware(h)
+	}
+	headers := authz.Headers{User: a.Config.AuthProxyUserHeader, Groups: a.Config.AuthProxyGroupsHeader}
+	return access.TrustProxy(headers, a.proxies, h)
+}
+
+// sealer returns the envelope encryption for the secrets kept in the
+// store, setting it up for the first feature needing it.
+func (a *App) sealer(feature string) (*encryption.Encryptor, error) {
+	if a.encryptor != nil {
+		return a.encryptor, nil
+	}
+	cfg := a.Config
+	var keys encryption.KeyWrapper
+	switch cfg.EncryptionProvider {
+	case config.EncryptionLocal:
+		keyring, err := encryption.NewKeyring(cfg.EncryptionKeys, cfg.EncryptionActiveKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption keys: %w", err)
+		}
+		keys = keyring
+	case config.EncryptionVault:
+		vault := encryption.NewVault(cfg.EncryptionVaultAddr, cfg.EncryptionVaultToken, cfg.EncryptionVaultMount,
+			cfg.EncryptionVaultKey, httpclient.New("vault", a.clientOptions("vault"), a.Logger))
+		a.Health.AddReadinessCheck("vault", vault.Check)
+		a.Startup.Add(startup.Dependency{Name: "vault", Required: true, Start: vault.Check})
+		keys = vault
+	default:
+		return nil, errors.New(feature + " requires ENCRYPTION_PROVIDER local or vault")
+	}
+	a.encryptor = encryption.New(keys)
+	return a.encryptor, nil
+}
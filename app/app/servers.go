@@ -0,0 +1,283 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/quic-go/quic-go/http3"
+	"go.uber.org/zap"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/admission"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/certreload"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/config"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/controller"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/custommetrics"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/handlers"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/httpclient"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/lifecycle"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/redact"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/server"
+)
+
+// initServers creates the listeners: public (with HTTP/3 and gRPC when
+// enabled), admin, and the TLS-only admission webhook and custom metrics
+// listeners. It also sets up the embedded controller manager. Nothing is
+// bound before Start.
+func (a *App) initServers() error {
+	cfg, logger := a.Config, a.Logger
+
+	// Probes and scrapes are too frequent to access-log; no CORS on admin.
+	adminMux := NewAdminMux(a.Health, a.redactor)
+	if a.leaks != nil {
+		adminMux.Handle("GET /debug/goroutines/leak", a.leaks)
+	}
+	a.AdminHandler = middleware.RequestID(
+		middleware.Recovery(logger, adminMux),
+	)
+
+	// ─── TLS (optional, hot-reloaded) ────────────────────────────────
+	var tlsConfig *tls.Config
+	if cfg.TLSEnabled() {
+		certs, err := certreload.New(cfg.TLSCertFile, cfg.TLSKeyFile, logger)
+		if err != nil {
+			return fmt.Errorf("load TLS certificate: %w", err)
+		}
+		a.background(func(ctx context.Context) { certs.Watch(ctx, cfg.TLSReloadInterval) })
+		tlsConfig = certs.TLSConfig()
+	}
+	if cfg.AuthProxyClientCAFile != "" {
+		// The authenticating proxy proves itself with a client certificate
+		pem, err := os.ReadFile(cfg.AuthProxyClientCAFile)
+		if err != nil {
+			return fmt.Errorf("read auth proxy client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("auth proxy client CA %s holds no certificates", cfg.AuthProxyClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	if a.spiffeAuth != nil {
+		// In-mesh peers may present their SVID; without certificate files
+		// the service serves its own
+		a.background(a.svids.Run)
+		tlsConfig = a.spiffeAuth.TLSConfig(tlsConfig)
+	}
+
+	// ─── Admission Webhooks (optional, own TLS listener) ─────────────
+	// The API server always calls webhooks over TLS, independent of how the
+	// public port is exposed.
+	if cfg.AdmissionEnabled {
+		policy := &admission.Policy{}
+		if cfg.AdmissionPolicyFile != "" {
+			var err error
+			if policy, err = admission.LoadPolicy(cfg.AdmissionPolicyFile); err != nil {
+				return fmt.Errorf("load admission policy: %w", err)
+			}
+		}
+		admissionCerts, err := certreload.New(cfg.AdmissionCertFile, cfg.AdmissionKeyFile, logger)
+		if err != nil {
+			return fmt.Errorf("load admission webhook certificate: %w", err)
+		}
+		a.background(func(ctx context.Context) { admissionCerts.Watch(ctx, cfg.TLSReloadInterval) })
+		webhook := admission.New(policy, logger)
+		if a.opaEngine != nil {
+			webhook.UseExternal(a.opaEngine.Admit)
+		}
+
+		a.admission = server.New("admission", &http.Server{
+			Addr:              fmt.Sprintf(":%d", cfg.AdmissionPort),
+			Handler:           middleware.Recovery(logger, webhook.Handler()),
+			ReadTimeout:       cfg.ReadTimeout,
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+			TLSConfig:         admissionCerts.TLSConfig(),
+		}, logger)
+	}
+
+	// ─── Custom Metrics API (optional, own TLS listener) ─────────────
+	// Served to the kube-aggregator, which only talks TLS.
+	if cfg.CustomMetricsEnabled {
+		metrics := cfg.CustomMetrics
+		if len(metrics) == 0 {
+			metrics = custommetrics.DefaultMetrics
+		}
+		// Scrapes must stay well inside the HPA's sync period; no retries
+		scrapeOpts := httpclient.DefaultOptions()
+		scrapeOpts.Timeout = 5 * time.Second
+		scrapeOpts.Retries = 0
+		// Only the aggregator, holding a front-proxy client certificate,
+		// may call the API
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		auth, err := custommetrics.LoadAuthentication(ctx, a.Kube.Clientset)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("load custom metrics client authentication: %w", err)
+		}
+		adapter := custommetrics.New(a.Kube.Informers, httpclient.New("custom-metrics", scrapeOpts, logger), custommetrics.Options{
+			Metrics:      metrics,
+			ScrapePort:   cfg.CustomMetricsScrapePort,
+			Namespaces:   cfg.KubeNamespaces,
+			AllowedNames: auth.AllowedNames,
+		}, logger)
+
+		customMetricsCerts, err := certreload.New(cfg.CustomMetricsCertFile, cfg.CustomMetricsKeyFile, logger)
+		if err != nil {
+			return fmt.Errorf("load custom metrics certificate: %w", err)
+		}
+		a.background(func(ctx context.Context) { customMetricsCerts.Watch(ctx, cfg.TLSReloadInterval) })
+		customMetricsTLS := customMetricsCerts.TLSConfig()
+		customMetricsTLS.ClientCAs = auth.ClientCAs
+		customMetricsTLS.ClientAuth = tls.VerifyClientCertIfGiven
+
+		a.customMetrics = server.New("custom-metrics", &http.Server{
+			Addr:              fmt.Sprintf(":%d", cfg.CustomMetricsPort),
+			Handler:           middleware.Recovery(logger, adapter.Handler()),
+			ReadTimeout:       cfg.ReadTimeout,
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+			TLSConfig:         customMetricsTLS,
+		}, logger)
+	}
+
+	// ─── Platform Controllers (optional) ─────────────────────────────
+	if cfg.ControllerEnabled {
+		mgr, err := controller.NewManager(a.Kube.Config(), controller.Options{
+			LeaderElection:          cfg.ControllerLeaderElection,
+			LeaderElectionNamespace: cfg.PodNamespace,
+		}, logger)
+		if err != nil {
+			return fmt.Errorf("configure controller manager: %w", err)
+		}
+		a.onStart(func(context.Context) error {
+			StartManager(mgr, a.Lifecycle, logger)
+			return nil
+		})
+	}
+
+	// ─── HTTP/3 (optional, requires TLS) ─────────────────────────────
+	handler := a.Handler
+	if cfg.EnableHTTP3 {
+		if tlsConfig == nil {
+			return errors.New("ENABLE_HTTP3 requires TLS_CERT_FILE and TLS_KEY_FILE")
+		}
+		a.http3 = &http3.Server{
+			Addr:        fmt.Sprintf(":%d", cfg.Port),
+			Handler:     handler,
+			IdleTimeout: cfg.IdleTimeout,
+			TLSConfig:   http3.ConfigureTLSConfig(tlsConfig),
+		}
+		// Advertise HTTP/3 to HTTPS clients via Alt-Svc
+		handler = middleware.AltSvc(a.http3.SetQUICHeaders, handler)
+	}
+
+	// ─── Create Servers ──────────────────────────────────────────────
+	publicHTTP := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Port),
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		TLSConfig:         tlsConfig,
+	}
+
+	// Serve HTTP/2 without TLS when a sidecar terminates TLS in front of us,
+	// so gRPC-Web and multiplexed clients work in-cluster.
+	if cfg.EnableH2C {
+		protocols := new(http.Protocols)
+		protocols.SetHTTP1(true)
+		protocols.SetUnencryptedHTTP2(true)
+		publicHTTP.Protocols = protocols
+	}
+
+	a.Public = server.New("public", publicHTTP, logger)
+	a.Admin = NewAdminServer(cfg, a.AdminHandler, logger)
+	if a.RPC != nil {
+		a.Public.MultiplexGRPC(a.RPC.GRPC)
+	}
+	return nil
+}
+
+// NewAdminMux builds the operational routes. They live on a separate port so
+// the public ingress never exposes them. With a redactor, the command line
+// is served masked.
+func NewAdminMux(healthHandler *handlers.HealthHandler, redactor *redact.Redactor) *http.ServeMux {
+	adminMux := http.NewServeMux()
+
+	// Health & readiness probes (Kubernetes)
+	adminMux.HandleFunc("/healthz", healthHandler.Liveness)
+	adminMux.HandleFunc("/readyz", healthHandler.Readiness)
+
+	// Prometheus metrics, including controller-runtime's own registry
+	adminMux.Handle("/metrics", promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.Gatherers{prometheus.DefaultGatherer, ctrlmetrics.Registry}, promhttp.HandlerOpts{}),
+	))
+
+	// Profiling
+	adminMux.HandleFunc("/debug/pprof/", pprof.Index)
+	if redactor != nil {
+		adminMux.Handle("/debug/pprof/cmdline", redactor.Debug(http.HandlerFunc(pprof.Cmdline)))
+	} else {
+		adminMux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	}
+	adminMux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	adminMux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	adminMux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	return adminMux
+}
+
+// NewAdminServer creates the admin listener serving handler.
+func NewAdminServer(cfg *config.Config, handler http.Handler, logger *zap.Logger) *server.Server {
+	return server.New("admin", &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.AdminPort),
+		Handler:           handler,
+		ReadTimeout:       cfg.AdminReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.AdminWriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}, logger)
+}
+
+// StartManager runs mgr in the background and registers a shutdown hook that
+// stops it and waits for reconciles in flight.
+func StartManager(mgr ctrl.Manager, shutdown *lifecycle.Registry, logger *zap.Logger) {
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// Losing leadership also ends Start with an error; exiting lets
+		// Kubernetes restart the pod as a follower
+		if err := mgr.Start(ctx); err != nil {
+			logger.Fatal("controller manager stopped", zap.Error(err))
+		}
+	}()
+	shutdown.OnShutdown("controller-manager", lifecycle.PhaseWorkers, 0, func(ctx context.Context) error {
+		stop()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
@@ -0,0 +1,367 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/cache"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/config"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/dev"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/httpclient"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/kafka"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/kube"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/lifecycle"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/objectstore"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/startup"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+// migrateTimeout bounds a migration run, including waiting for another
+// replica's run to release the lock.
+const migrateTimeout = 10 * time.Minute
+
+// initStorage sets up the store, the shared cache, the event bus, the object
+// store and the Kubernetes client, keeping those given in Options. Those it
+// builds are connected on Start, as startup dependencies in that order.
+func (a *App) initStorage(opts Options) error {
+	cfg, logger := a.Config, a.Logger
+
+	switch {
+	case opts.Store != nil:
+		a.Store = opts.Store
+	case cfg.StoreBackend == config.StoreMemory:
+		a.Store = store.NewMemory()
+		switch {
+		case cfg.StoreSeedFile != "":
+			if err := seedStore(a.Store, cfg.StoreSeedFile, logger); err != nil {
+				return err
+			}
+		case cfg.DevMode:
+			seed, err := dev.Seed()
+			if err == nil {
+				err = seed.Apply(context.Background(), a.Store)
+			}
+			if err != nil {
+				return fmt.Errorf("seed store with the sample data: %w", err)
+			}
+		}
+	case cfg.StoreBackend == config.StorePostgres:
+		database, err := store.NewPostgres(postgresOptions(cfg))
+		if err != nil {
+			return err
+		}
+		a.Database = database
+		a.Lifecycle.OnShutdown("database", lifecycle.PhaseClose, 0, func(context.Context) error {
+			return database.Close()
+		})
+		a.Startup.Add(startup.Dependency{Name: "database", Required: true, Start: database.Connect})
+		if cfg.DatabaseAutoMigrate {
+			// A failed migration fails again; waiting for another replica's
+			// run to release the lock is part of the attempt
+			a.Startup.Add(startup.Dependency{
+				Name:           "database-migrations",
+				Required:       true,
+				Timeout:        migrateTimeout,
+				AttemptTimeout: migrateTimeout,
+				Attempts:       1,
+				Start: func(ctx context.Context) error {
+					return migrateDatabase(ctx, database, logger)
+				},
+			})
+		}
+		a.Store = database.Store()
+	default:
+		return fmt.Errorf("unknown store backend %q", cfg.StoreBackend)
+	}
+	// Redis when replicas must share idempotency keys and rate limits
+	switch {
+	case opts.Cache != nil:
+		a.Cache = opts.Cache
+	case len(cfg.RedisAddrs) > 0:
+		redisCache, err := cache.NewRedis(redisOptions(cfg))
+		if err != nil {
+			return fmt.Errorf("configure Redis: %w", err)
+		}
+		a.Cache, a.redisCache = redisCache, redisCache
+		a.Lifecycle.OnShutdown("redis", lifecycle.PhaseClose, 0, func(context.Context) error {
+			return redisCache.Close()
+		})
+		a.Startup.Add(startup.Dependency{Name: "redis", Required: true, Start: redisCache.Check})
+	default:
+		a.Cache = cache.NewMemory()
+	}
+	switch {
+	case opts.Bus != nil:
+		a.Bus = opts.Bus
+	case cfg.EventsBackend == config.EventsMemory:
+		a.Bus = events.NewMemoryBus()
+	case cfg.EventsBackend == config.EventsNATS:
+		natsBus, err := newNATSBus(cfg, logger)
+		if err != nil {
+			return fmt.Errorf("configure NATS: %w", err)
+		}
+		a.Bus, a.natsBus = natsBus, natsBus
+		a.Lifecycle.OnShutdown("nats", lifecycle.PhaseClose, 0, natsBus.Shutdown)
+		a.Startup.Add(startup.Dependency{Name: "nats", Required: true, Start: natsBus.Connect})
+	default:
+		return fmt.Errorf("unknown events backend %q", cfg.EventsBackend)
+	}
+	a.Events = events.NewLog(cfg.EventsHistorySize)
+	if a.redactor != nil {
+		a.Bus.Subscribe(a.redactor.Events(a.Events.Record))
+	} else {
+		a.Bus.Subscribe(a.Events.Record)
+	}
+	if cfg.KafkaEnabled {
+		if err := startKafka(cfg, a.Bus, a.Store, a.Lifecycle, logger); err != nil {
+			return fmt.Errorf("configure Kafka: %w", err)
+		}
+	}
+	if a.redactor != nil {
+		// Outermost, so the store and Kafka both get masked records
+		a.Store.Audit = a.redactor.AuditRepository(a.Store.Audit)
+	}
+	if cfg.ObjectStoreEnabled {
+		objects, err := objectstore.New(httpclient.New("objectstore", a.clientOptions("objectstore"), logger), objectstore.Options{
+			Endpoint:        cfg.ObjectStoreEndpoint,
+			PublicEndpoint:  cfg.ObjectStorePublicEndpoint,
+			Region:          cfg.ObjectStoreRegion,
+			Bucket:          cfg.ObjectStoreBucket,
+			PathStyle:       cfg.ObjectStorePathStyle,
+			Prefix:          cfg.ObjectStorePrefix,
+			AccessKeyID:     cfg.ObjectStoreAccessKeyID,
+			SecretAccessKey: cfg.ObjectStoreSecretAccessKey,
+			SessionToken:    cfg.ObjectStoreSessionToken,
+		})
+		if err != nil {
+			return fmt.Errorf("configure object store: %w", err)
+		}
+		a.objects = objects
+		// Only uploads and downloads need it; the rest of the API does not
+		a.Startup.Add(startup.Dependency{Name: "objectstore", Start: objects.Check})
+		a.objectAPI = objectstore.NewHandler(objects, objectstore.HandlerOptions{
+			Expiry:       cfg.ObjectStorePresignExpiry,
+			UserHeader:   cfg.AuthProxyUserHeader,
+			GroupsHeader: cfg.AuthProxyGroupsHeader,
+		}, logger)
+	}
+
+	switch {
+	case opts.Kube != nil:
+		a.Kube = opts.Kube
+	case cfg.DevMode:
+		// Sample workloads to browse; every access review is allowed
+		a.Kube = kube.NewForClientset(dev.Clientset(dev.Objects()...), nil, cfg.KubeResyncPeriod, logger)
+		logger.Info("dev mode: serving a fake cluster with sample data")
+	case cfg.KubeEnabled:
+		kubeClient, err := kube.New(KubeOptions(cfg), logger)
+		if err != nil {
+			return fmt.Errorf("configure Kubernetes client: %w", err)
+		}
+		a.Kube = kubeClient
+		a.Startup.Add(startup.Dependency{Name: "kubernetes", Required: true, Start: kubeClient.Check})
+	}
+	return nil
+}
+
+// outboundOptions returns the options for the outbound client name: the
+// defaults with the configured pooling and timeouts, plus bearer tokens for
+// the clients in OAUTH2_CLIENTS. Those clients share one token source, so
+// one token serves them all.
+func outboundOptions(cfg *config.Config, logger *zap.Logger) func(name string) httpclient.Options {
+	defaults := httpclient.DefaultOptions()
+	defaults.DialTimeout = cfg.OutboundDialTimeout
+	defaults.TLSHandshakeTimeout = cfg.OutboundTLSHandshakeTimeout
+	defaults.ResponseHeaderTimeout = cfg.OutboundResponseHeaderTimeout
+	defaults.IdleConnTimeout = cfg.OutboundIdleConnTimeout
+	defaults.MaxIdleConns = cfg.OutboundMaxIdleConns
+	defaults.MaxIdleConnsPerHost = cfg.OutboundMaxIdleConnsPerHost
+	defaults.MaxConnsPerHost = cfg.OutboundMaxConnsPerHost
+	defaults.HTTP2 = cfg.OutboundHTTP2
+	defaults.HTTP2PingInterval = cfg.OutboundHTTP2PingInterval
+	defaults.HTTP2PingTimeout = cfg.OutboundHTTP2PingTimeout
+
+	var tokens httpclient.TokenSource
+	if len(cfg.OAuth2Clients) > 0 {
+		tokens = httpclient.NewClientCredentials(httpclient.ClientCredentialsConfig{
+			TokenURL:     cfg.OAuth2TokenURL,
+			ClientID:     cfg.OAuth2ClientID,
+			ClientSecret: cfg.OAuth2ClientSecret,
+			Scopes:       cfg.OAuth2Scopes,
+			Audience:     cfg.OAuth2Audience,
+		}, httpclient.New("oauth2", defaults, logger))
+	}
+	return func(name string) httpclient.Options {
+		opts := defaults
+		if tokens != nil && slices.Contains(cfg.OAuth2Clients, name) {
+			opts.Auth = tokens
+		}
+		return opts
+	}
+}
+
+// startKafka streams bus events and audit records to Kafka and, with a
+// consumer group, replays other instances' events onto bus.
+func startKafka(cfg *config.Config, bus events.Bus, st *store.Store, shutdown *lifecycle.Registry, logger *zap.Logger) error {
+	conn := kafka.Options{
+		Brokers:       cfg.KafkaBrokers,
+		Username:      cfg.KafkaUsername,
+		Password:      cfg.KafkaPassword,
+		SASLMechanism: cfg.KafkaSASLMechanism,
+		TLS:           cfg.KafkaTLS,
+	}
+	// Unique per replica, so a consumer can skip its own events
+	name := cfg.PodName
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+
+	producer, err := kafka.NewProducer(conn, kafka.ProducerOptions{
+		EventsTopic:  cfg.KafkaEventsTopic,
+		AuditTopic:   cfg.KafkaAuditTopic,
+		BatchTimeout: cfg.KafkaBatchTimeout,
+		BufferSize:   cfg.KafkaBufferSize,
+		Producer:     name,
+	}, logger)
+	if err != nil {
+		return err
+	}
+	bus.Subscribe(producer.HandleEvent)
+	st.Audit = producer.AuditRepository(st.Audit)
+	shutdown.OnShutdown("kafka-producer", lifecycle.PhaseFlush, 0, producer.Shutdown)
+
+	if cfg.KafkaConsumerGroup == "" {
+		return nil
+	}
+	topics := cfg.KafkaConsumerTopics
+	if len(topics) == 0 {
+		topics = []string{cfg.KafkaEventsTopic}
+	}
+	consumer, err := kafka.NewConsumer(conn, bus, kafka.ConsumerOptions{
+		Group:    cfg.KafkaConsumerGroup,
+		Topics:   topics,
+		Instance: name,
+		Producer: name,
+	}, logger)
+	if err != nil {
+		return err
+	}
+	consumer.Start()
+	shutdown.OnShutdown("kafka-consumer", lifecycle.PhaseWorkers, 0, consumer.Shutdown)
+	return nil
+}
+
+// newNATSBus creates the NATS event bus; it connects on Connect.
+func newNATSBus(cfg *config.Config, logger *zap.Logger) (*events.NATSBus, error) {
+	// One durable consumer per replica, resumed when the pod comes back
+	name := cfg.PodName
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	return events.NewDisconnectedNATSBus(events.NATSOptions{
+		URL:           cfg.NATSURL,
+		Token:         cfg.NATSToken,
+		Stream:        cfg.NATSStream,
+		SubjectPrefix: cfg.NATSSubjectPrefix,
+		MaxAge:        cfg.NATSMaxAge,
+		Replicas:      cfg.NATSReplicas,
+		Name:          cfg.ServiceName,
+		Consumer:      cfg.ServiceName + "-" + name,
+	}, logger)
+}
+
+// OpenDatabase connects to the PostgreSQL store, giving it 30s to answer.
+func OpenDatabase(cfg *config.Config) (*store.Postgres, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return store.OpenPostgres(ctx, postgresOptions(cfg))
+}
+
+// postgresOptions maps configuration onto the PostgreSQL pool options.
+func postgresOptions(cfg *config.Config) store.PostgresOptions {
+	return store.PostgresOptions{
+		DSN:             cfg.DatabaseURL,
+		MaxOpenConns:    cfg.DatabaseMaxOpenConns,
+		MaxIdleConns:    cfg.DatabaseMaxIdleConns,
+		ConnMaxLifetime: cfg.DatabaseConnMaxLifetime,
+		ConnMaxIdleTime: cfg.DatabaseConnMaxIdleTime,
+		PingTimeout:     cfg.DatabasePingTimeout,
+		ReplicaDSNs:     cfg.DatabaseReplicaURLs,
+		MaxReplicaLag:   cfg.DatabaseReplicaMaxLag,
+	}
+}
+
+// MigrateDatabase applies pending migrations, logging each one.
+func MigrateDatabase(database *store.Postgres, logger *zap.Logger) error {
+	ctx, cancel := context.WithTimeout(context.Background(), migrateTimeout)
+	defer cancel()
+	return migrateDatabase(ctx, database, logger)
+}
+
+func migrateDatabase(ctx context.Context, database *store.Postgres, logger *zap.Logger) error {
+	applied, err := database.Migrate(ctx)
+	for _, m := range applied {
+		logger.Info("database migration applied", zap.Int("version", m.Version), zap.String("name", m.Name))
+	}
+	if err != nil {
+		return fmt.Errorf("apply migrations: %w", err)
+	}
+	st, err := database.MigrationStatus(ctx)
+	if err != nil {
+		return fmt.Errorf("read migration status: %w", err)
+	}
+	logger.Info("database schema is current", zap.Int("version", st.Current), zap.Int("applied", len(applied)))
+	return nil
+}
+
+// seedStore loads the fixtures at path into the memory store.
+func seedStore(st *store.Store, path string, logger *zap.Logger) error {
+	seed, err := store.LoadSeed(path)
+	if err == nil {
+		err = seed.Apply(context.Background(), st)
+	}
+	if err != nil {
+		return fmt.Errorf("seed store from %s: %w", path, err)
+	}
+	logger.Info("store seeded",
+		zap.String("file", path),
+		zap.Int("tenants", len(seed.Tenants)),
+		zap.Int("services", len(seed.Services)),
+		zap.Int("deployments", len(seed.Deployments)),
+	)
+	return nil
+}
+
+// redisOptions maps configuration onto Redis client options.
+func redisOptions(cfg *config.Config) cache.RedisOptions {
+	return cache.RedisOptions{
+		Mode:             cfg.RedisMode,
+		Addrs:            cfg.RedisAddrs,
+		MasterName:       cfg.RedisMasterName,
+		Username:         cfg.RedisUsername,
+		Password:         cfg.RedisPassword,
+		SentinelPassword: cfg.RedisSentinelPassword,
+		DB:               cfg.RedisDB,
+		TLS:              cfg.RedisTLS,
+		TLSCAFile:        cfg.RedisTLSCAFile,
+		KeyPrefix:        cfg.RedisKeyPrefix,
+		PoolSize:         cfg.RedisPoolSize,
+	}
+}
+
+// KubeOptions maps configuration onto Kubernetes client options.
+func KubeOptions(cfg *config.Config) kube.Options {
+	return kube.Options{
+		Kubeconfig:   cfg.Kubeconfig,
+		QPS:          float32(cfg.KubeQPS),
+		Burst:        cfg.KubeBurst,
+		ResyncPeriod: cfg.KubeResyncPeriod,
+		UserAgent:    cfg.ServiceName + "/" + cfg.Version,
+	}
+}
@@ -0,0 +1,165 @@
+package argocd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	authzv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+)
+
+const appJSON = `{
+  "metadata": {"name": "billing", "namespace": "argocd"},
+  "spec": {"project": "team-a"},
+  "status": {
+    "sync": {"status": "OutOfSync", "revision": "abc123"},
+    "health": {"status": "Healthy"},
+    "operationState": {"phase": "Running", "startedAt": "2026-01-01T12:00:00Z"}
+  }
+}`
+
+func newArgo(t *testing.T) (*httptest.Server, *SyncRequest) {
+	t.Helper()
+	var got SyncRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case (r.URL.Path == "/api/v1/applications/billing" || r.URL.Path == "/api/v1/applications/busy") && r.Method == http.MethodGet:
+			w.Write([]byte(appJSON))
+		case r.URL.Path == "/api/v1/applications/billing/sync" && r.Method == http.MethodPost:
+			json.NewDecoder(r.Body).Decode(&got)
+			w.Write([]byte(appJSON))
+		case r.URL.Path == "/api/v1/applications/busy/sync":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"another operation is already in progress","code":9,"message":"another operation is already in progress"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"not found"}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &got
+}
+
+// cluster grants alice sync and prune in the argocd namespace, and bob
+// sync only.
+func cluster() *fake.Clientset {
+	cs := fake.NewClientset()
+	cs.PrependReactor("create", "subjectaccessreviews", func(a k8stesting.Action) (bool, runtime.Object, error) {
+		sar := a.(k8stesting.CreateAction).GetObject().(*authzv1.SubjectAccessReview)
+		attrs := sar.Spec.ResourceAttributes
+		sar.Status.Allowed = attrs.Group == "argoproj.io" && attrs.Resource == "applications" && attrs.Namespace == "argocd" &&
+			attrs.Verb == "create" && (sar.Spec.User == "alice" || sar.Spec.User == "bob" && attrs.Subresource == "sync")
+		return true, sar, nil
+	})
+	return cs
+}
+
+func newMux(t *testing.T, bus events.Bus) (*http.ServeMux, *SyncRequest) {
+	srv, got := newArgo(t)
+	mux := http.NewServeMux()
+	NewHandler(NewClient(srv.URL, "secret", srv.Client()), cluster(), bus, Options{
+		UserHeader:   "X-Forwarded-User",
+		GroupsHeader: "X-Forwarded-Groups",
+	}, zap.NewNop()).Register(mux)
+	return mux, got
+}
+
+func TestStatus(t *testing.T) {
+	mux, _ := newMux(t, events.NewMemoryBus())
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/argocd/applications/billing", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var s Status
+	json.NewDecoder(rec.Body).Decode(&s)
+	if s.SyncStatus != "OutOfSync" || s.HealthStatus != "Healthy" {
+		t.Errorf("expected OutOfSync/Healthy, got %s/%s", s.SyncStatus, s.HealthStatus)
+	}
+	if s.Operation == nil || s.Operation.Phase != "Running" {
+		t.Errorf("expected running operation, got %+v", s.Operation)
+	}
+}
+
+func TestSync(t *testing.T) {
+	bus := events.NewMemoryBus()
+	var published []events.Event
+	bus.Subscribe(func(_ context.Context, e events.Event) { published = append(published, e) })
+	mux, got := newMux(t, bus)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/argocd/applications/billing/sync",
+		strings.NewReader(`{"revision":"v1.2.0","prune":true}`))
+	req.Header.Set("X-Forwarded-User", "alice")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body)
+	}
+	if got.Revision != "v1.2.0" || !got.Prune {
+		t.Errorf("expected revision v1.2.0 with prune, got %+v", *got)
+	}
+	if len(published) != 1 || published[0].Type != "argocd.sync.started" {
+		t.Errorf("expected argocd.sync.started event, got %+v", published)
+	}
+}
+
+func TestSyncErrors(t *testing.T) {
+	mux, _ := newMux(t, events.NewMemoryBus())
+
+	tests := []struct {
+		name string
+		app  string
+		user string
+		want int
+	}{
+		{"unauthenticated", "billing", "", http.StatusUnauthorized},
+		{"not allowed to sync", "billing", "mallory", http.StatusForbidden},
+		{"operation in progress", "busy", "alice", http.StatusConflict},
+		{"unknown application", "missing", "alice", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/argocd/applications/"+tt.app+"/sync", nil)
+			if tt.user != "" {
+				req.Header.Set("X-Forwarded-User", tt.user)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestSyncPruneNeedsOwnPermission(t *testing.T) {
+	mux, got := newMux(t, events.NewMemoryBus())
+	sync := func(user, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/argocd/applications/billing/sync", strings.NewReader(body))
+		req.Header.Set("X-Forwarded-User", user)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := sync("bob", `{"prune":true}`); code != http.StatusForbidden || got.Prune {
+		t.Errorf("expected a prune without the prune permission refused, got %d %+v", code, *got)
+	}
+	if code := sync("bob", `{}`); code != http.StatusAccepted {
+		t.Errorf("expected a plain sync allowed, got %d", code)
+	}
+}
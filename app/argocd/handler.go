@@ -0,0 +1,239 @@
+package argocd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	authzv1 "k8s.io/api/authorization/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+)
+
+var syncsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "argocd_sync_requests_total",
+	Help: "Argo CD sync requests made through the platform API, by result.",
+}, []string{"result"})
+
+// Status is the sync and health state reported to platform users.
+type Status struct {
+	Name         string     `json:"name"`
+	Project      string     `json:"project"`
+	SyncStatus   string     `json:"sync_status"`
+	HealthStatus string     `json:"health_status"`
+	Revision     string     `json:"revision"`
+	Operation    *Operation `json:"operation,omitempty"`
+}
+
+// Operation is the latest sync operation.
+type Operation struct {
+	Phase      string     `json:"phase"`
+	Message    string     `json:"message,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Handler serves:
+//
+//	GET  /api/v1/argocd/applications/{name}        sync and health status
+//	POST /api/v1/argocd/applications/{name}/sync   start a sync {"revision", "prune", "dry_run"}
+//
+// Syncs are authorized against cluster RBAC with SubjectAccessReviews on
+// the Application: "create" on applications/sync, and for pruning
+// syncs also on applications/prune, in group argoproj.io.
+type Handler struct {
+	client   *Client
+	reviewer *authz.Reviewer
+	headers  authz.Headers
+	bus      events.Publisher
+	logger   *zap.Logger
+}
+
+// Options configures the handler.
+type Options struct {
+	// UserHeader and GroupsHeader carry the caller's identity, set by the
+	// authenticating proxy.
+	UserHeader   string
+	GroupsHeader string
+}
+
+// NewHandler creates the handler. cs reviews the callers' access; the
+// service account needs create on subjectaccessreviews.
+func NewHandler(client *Client, cs kubernetes.Interface, bus events.Publisher, opts Options, logger *zap.Logger) *Handler {
+	return &Handler{
+		client:   client,
+		reviewer: authz.NewReviewer(cs),
+		headers:  authz.Headers{User: opts.UserHeader, Groups: opts.GroupsHeader},
+		bus:      bus,
+		logger:   logger,
+	}
+}
+
+// Register mounts the handler on mux.
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/argocd/applications/{name}", h.status)
+	mux.HandleFunc("POST /api/v1/argocd/applications/{name}/sync", h.sync)
+}
+
+func (h *Handler) status(w http.ResponseWriter, r *http.Request) {
+	app, err := h.client.Application(r.Context(), r.PathValue("name"))
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toStatus(app))
+}
+
+type syncBody struct {
+	Revision string `json:"revision"`
+	Prune    bool   `json:"prune"`
+	DryRun   bool   `json:"dry_run"`
+}
+
+func (h *Handler) sync(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	id := h.headers.Identity(r)
+	if id.User == "" {
+		syncsTotal.WithLabelValues("unauthenticated").Inc()
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var body syncBody
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&body); err != nil {
+			syncsTotal.WithLabelValues("bad_request").Inc()
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	audit := h.logger.With(
+		zap.String("audit", "argocd_sync"),
+		zap.String("request_id", middleware.GetRequestID(r.Context())),
+		zap.String("user", id.User),
+		zap.Strings("groups", id.Groups),
+		zap.String("application", name),
+		zap.String("revision", body.Revision),
+		zap.Bool("prune", body.Prune),
+		zap.Bool("dry_run", body.DryRun),
+	)
+
+	app, err := h.client.Application(r.Context(), name)
+	if err != nil {
+		syncsTotal.WithLabelValues("error").Inc()
+		h.fail(w, err)
+		return
+	}
+	subresources := []string{"sync"}
+	if body.Prune {
+		subresources = append(subresources, "prune")
+	}
+	for _, sub := range subresources {
+		allowed, reason, err := h.reviewer.Allowed(r.Context(), id, authzv1.ResourceAttributes{
+			Namespace:   app.Metadata.Namespace,
+			Verb:        "create",
+			Group:       "argoproj.io",
+			Resource:    "applications",
+			Subresource: sub,
+			Name:        name,
+		})
+		if err != nil {
+			syncsTotal.WithLabelValues("error").Inc()
+			audit.Error("argocd sync authorization failed", zap.Error(err))
+			http.Error(w, "authorization check failed", http.StatusBadGateway)
+			return
+		}
+		if !allowed {
+			syncsTotal.WithLabelValues("forbidden").Inc()
+			audit.Warn("argocd sync denied", zap.String("project", app.Spec.Project),
+				zap.String("subresource", sub), zap.String("reason", reason))
+			http.Error(w, "forbidden: requires create on applications/"+sub, http.StatusForbidden)
+			return
+		}
+	}
+
+	app, err = h.client.Sync(r.Context(), name, SyncRequest{
+		Revision: body.Revision,
+		Prune:    body.Prune,
+		DryRun:   body.DryRun,
+	})
+	if err != nil {
+		syncsTotal.WithLabelValues("error").Inc()
+		audit.Warn("argocd sync rejected", zap.Error(err))
+		h.fail(w, err)
+		return
+	}
+	syncsTotal.WithLabelValues("ok").Inc()
+	audit.Info("argocd sync started")
+	h.publish(r.Context(), name, id.User, body.Revision)
+
+	writeJSON(w, http.StatusAccepted, toStatus(app))
+}
+
+func (h *Handler) publish(ctx context.Context, app, user, revision string) {
+	e, err := events.New("argocd.sync.started", "argocd", map[string]string{
+		"application": app,
+		"user":        user,
+		"revision":    revision,
+	})
+	if err != nil {
+		return
+	}
+	if err := h.bus.Publish(ctx, e); err != nil {
+		h.logger.Warn("failed to publish argocd event", zap.Error(err))
+	}
+}
+
+// fail maps Argo CD errors to responses. Not-found and precondition errors
+// (e.g. another operation already running) are passed through; anything
+// else is the upstream's fault.
+func (h *Handler) fail(w http.ResponseWriter, err error) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusNotFound:
+			http.Error(w, "application not found", http.StatusNotFound)
+			return
+		case http.StatusBadRequest, http.StatusConflict:
+			http.Error(w, apiErr.Message, http.StatusConflict)
+			return
+		}
+	}
+	h.logger.Error("argocd request failed", zap.Error(err))
+	http.Error(w, "argocd request failed", http.StatusBadGateway)
+}
+
+func toStatus(app *Application) Status {
+	s := Status{
+		Name:         app.Metadata.Name,
+		Project:      app.Spec.Project,
+		SyncStatus:   app.Status.Sync.Status,
+		HealthStatus: app.Status.Health.Status,
+		Revision:     app.Status.Sync.Revision,
+	}
+	if op := app.Status.OperationState; op != nil {
+		s.Operation = &Operation{
+			Phase:      op.Phase,
+			Message:    op.Message,
+			StartedAt:  op.StartedAt,
+			FinishedAt: op.FinishedAt,
+		}
+	}
+	return s
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
@@ -0,0 +1,124 @@
+// Package auditlog verifies the hash chain of the audit log. Each audit
+// event records the hash of the one before it (see store.AuditHash), so
+// editing, deleting or inserting an event breaks the chain from that point
+// on, and deleting the latest events leaves the chain short of the head
+// the store keeps apart from them.
+package auditlog
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+// pageSize is how many events Verify reads at a time.
+const pageSize = 500
+
+// Break reasons.
+const (
+	// ReasonGap means an event is missing: the sequence skips a number.
+	ReasonGap = "gap"
+	// ReasonLink means an event's PrevHash is not the previous event's
+	// Hash: an event before it was replaced.
+	ReasonLink = "broken_link"
+	// ReasonModified means an event's Hash does not match its contents.
+	ReasonModified = "modified"
+	// ReasonTruncated means the chain ends before the recorded head.
+	ReasonTruncated = "truncated"
+	// ReasonHead means the last event is not the recorded head.
+	ReasonHead = "head_mismatch"
+)
+
+var verificationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "audit_chain_verifications_total",
+	Help: "Audit chain verifications by result (valid, broken or error).",
+}, []string{"result"})
+
+// Break is the first point where the chain does not hold.
+type Break struct {
+	// Seq is the sequence number of the offending event, or of the
+	// recorded head for ReasonTruncated.
+	Seq    int64  `json:"seq"`
+	Reason string `json:"reason"`
+	Detail string `json:"detail"`
+}
+
+// Report is the result of a verification.
+type Report struct {
+	Valid bool `json:"valid"`
+	// Checked is the number of events verified.
+	Checked  int64     `json:"checked"`
+	HeadSeq  int64     `json:"head_seq"`
+	HeadHash string    `json:"head_hash,omitempty"`
+	Break    *Break    `json:"break,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// Verify walks the audit chain from its first event and reports the first
+// break. The head is read first, so events recorded meanwhile are not
+// mistaken for tampering.
+func Verify(ctx context.Context, repo store.AuditRepository) (*Report, error) {
+	report, err := verify(ctx, repo)
+	switch {
+	case err != nil:
+		verificationsTotal.WithLabelValues("error").Inc()
+	case report.Valid:
+		verificationsTotal.WithLabelValues("valid").Inc()
+	default:
+		verificationsTotal.WithLabelValues("broken").Inc()
+	}
+	return report, err
+}
+
+func verify(ctx context.Context, repo store.AuditRepository) (*Report, error) {
+	headSeq, headHash, err := repo.Head(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read audit chain head: %w", err)
+	}
+	report := &Report{HeadSeq: headSeq, HeadHash: headHash, Time: time.Now().UTC()}
+	var (
+		seq  int64
+		hash string
+	)
+	fail := func(seq int64, reason, format string, args ...any) (*Report, error) {
+		report.Break = &Break{Seq: seq, Reason: reason, Detail: fmt.Sprintf(format, args...)}
+		return report, nil
+	}
+	for seq < headSeq {
+		page, err := repo.Chain(ctx, seq, pageSize)
+		if err != nil {
+			return nil, fmt.Errorf("read audit chain: %w", err)
+		}
+		if len(page) == 0 {
+			return fail(headSeq, ReasonTruncated, "chain ends at %d, head is %d", seq, headSeq)
+		}
+		for i := range page {
+			e := &page[i]
+			if e.Seq > headSeq {
+				// Recorded after the head was read
+				break
+			}
+			if e.Seq != seq+1 {
+				return fail(e.Seq, ReasonGap, "expected event %d, found %d", seq+1, e.Seq)
+			}
+			if e.PrevHash != hash {
+				return fail(e.Seq, ReasonLink, "previous hash does not match event %d", seq)
+			}
+			if store.AuditHash(e) != e.Hash {
+				return fail(e.Seq, ReasonModified, "event %s does not match its hash", e.ID)
+			}
+			seq, hash = e.Seq, e.Hash
+			report.Checked++
+		}
+	}
+	if hash != headHash {
+		return fail(seq, ReasonHead, "last event's hash is not the recorded head's")
+	}
+	report.Valid = true
+	return report, nil
+}
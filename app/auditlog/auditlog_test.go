@@ -0,0 +1,94 @@
+package auditlog
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+// tampered serves the events of a real chain after edit has altered them.
+type tampered struct {
+	store.AuditRepository
+	edit func([]store.AuditEvent) []store.AuditEvent
+}
+
+func (r tampered) Chain(ctx context.Context, afterSeq int64, limit int) ([]store.AuditEvent, error) {
+	events, err := r.AuditRepository.Chain(ctx, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	var out []store.AuditEvent
+	for _, e := range r.edit(events) {
+		if e.Seq > afterSeq && (limit <= 0 || len(out) < limit) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func TestVerify(t *testing.T) {
+	ctx := t.Context()
+	repo := store.NewMemory().Audit
+	for _, action := range []string{"create", "update", "delete", "update"} {
+		e := &store.AuditEvent{Actor: "alice", Action: action, Resource: "tenants/t1",
+			Details: map[string]string{"reason": "test"}}
+		if err := repo.Record(ctx, e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if report, err := Verify(ctx, repo); err != nil || !report.Valid || report.Checked != 4 || report.HeadSeq != 4 {
+		t.Fatalf("expected a valid chain of 4, got %+v, %v", report, err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		edit   func([]store.AuditEvent) []store.AuditEvent
+		seq    int64
+		reason string
+	}{
+		{"modified", func(es []store.AuditEvent) []store.AuditEvent {
+			es[1].Actor = "mallory"
+			return es
+		}, 2, ReasonModified},
+		{"rehashed", func(es []store.AuditEvent) []store.AuditEvent {
+			es[1].Actor = "mallory"
+			es[1].Hash = store.AuditHash(&es[1])
+			return es
+		}, 3, ReasonLink},
+		{"deleted", func(es []store.AuditEvent) []store.AuditEvent {
+			return append(es[:1], es[2:]...)
+		}, 3, ReasonGap},
+		{"truncated", func(es []store.AuditEvent) []store.AuditEvent {
+			return es[:3]
+		}, 4, ReasonTruncated},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			report, err := Verify(ctx, tampered{repo, tc.edit})
+			if err != nil || report.Valid || report.Break == nil {
+				t.Fatalf("expected a break, got %+v, %v", report, err)
+			}
+			if report.Break.Seq != tc.seq || report.Break.Reason != tc.reason {
+				t.Errorf("expected %s at %d, got %+v", tc.reason, tc.seq, report.Break)
+			}
+		})
+	}
+
+	h := NewHandler(tampered{repo, func(es []store.AuditEvent) []store.AuditEvent { return es[:2] }},
+		authz.Headers{User: "X-Auth-Request-User"}, zap.NewNop())
+	mux := http.NewServeMux()
+	h.Register(mux)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/admin/audit/verify", nil))
+	var report Report
+	json.NewDecoder(rec.Body).Decode(&report)
+	if rec.Code != http.StatusOK || report.Valid || report.Break.Reason != ReasonTruncated {
+		t.Errorf("expected a truncated chain reported, got %d %+v", rec.Code, report)
+	}
+}
@@ -0,0 +1,64 @@
+package auditlog
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+// Handler serves the verification endpoint. Access is decided by the rbac
+// rule for audit:verify.
+type Handler struct {
+	repo    store.AuditRepository
+	headers authz.Headers
+	logger  *zap.Logger
+}
+
+// NewHandler creates the verification endpoint for repo.
+func NewHandler(repo store.AuditRepository, headers authz.Headers, logger *zap.Logger) *Handler {
+	return &Handler{repo: repo, headers: headers, logger: logger}
+}
+
+// Register mounts the endpoint on mux:
+//
+//	GET /api/v1/admin/audit/verify   verify the audit chain
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/admin/audit/verify", h.verify)
+}
+
+func (h *Handler) verify(w http.ResponseWriter, r *http.Request) {
+	report, err := Verify(r.Context(), h.repo)
+	if err != nil {
+		h.logger.Error("audit chain verification failed", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	id := h.headers.Identity(r)
+	fields := []zap.Field{
+		zap.String("audit", "auditlog"),
+		zap.String("request_id", middleware.GetRequestID(r.Context())),
+		zap.String("user", id.User),
+		zap.Strings("groups", id.Groups),
+		zap.Int64("checked", report.Checked),
+		zap.Int64("head_seq", report.HeadSeq),
+	}
+	if report.Break != nil {
+		h.logger.Warn("audit chain broken", append(fields,
+			zap.Int64("seq", report.Break.Seq), zap.String("reason", report.Break.Reason))...)
+	} else {
+		h.logger.Info("audit chain verified", fields...)
+	}
+	// A broken chain is a result, not a failure of the request
+	writeJSON(w, http.StatusOK, report)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
@@ -0,0 +1,70 @@
+// Package authz answers "can this user do X?" against cluster RBAC. The
+// caller's identity is asserted by the authenticating proxy in front of the
+// service and checked with SubjectAccessReviews, so the service's own
+// (broader) permissions never stand in for the user's.
+package authz
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	authzv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Identity is the caller as asserted by the authenticating proxy.
+type Identity struct {
+	User   string
+	Groups []string
+}
+
+// Headers names the request headers carrying the identity, e.g.
+// X-Forwarded-User and X-Forwarded-Groups (comma-separated).
+type Headers struct {
+	User   string
+	Groups string
+}
+
+// Identity reads the caller's identity from r. User is empty when the proxy
+// did not authenticate the request.
+func (h Headers) Identity(r *http.Request) Identity {
+	id := Identity{User: strings.TrimSpace(r.Header.Get(h.User))}
+	if h.Groups != "" {
+		for _, g := range strings.Split(r.Header.Get(h.Groups), ",") {
+			if g = strings.TrimSpace(g); g != "" {
+				id.Groups = append(id.Groups, g)
+			}
+		}
+	}
+	return id
+}
+
+// Reviewer performs SubjectAccessReviews.
+type Reviewer struct {
+	clientset kubernetes.Interface
+}
+
+// NewReviewer creates a reviewer. The service account needs create on
+// subjectaccessreviews.authorization.k8s.io.
+func NewReviewer(cs kubernetes.Interface) *Reviewer {
+	return &Reviewer{clientset: cs}
+}
+
+// Allowed asks the API server whether id may perform attrs. reason is the
+// authorizer's explanation, often empty.
+func (rv *Reviewer) Allowed(ctx context.Context, id Identity, attrs authzv1.ResourceAttributes) (allowed bool, reason string, err error) {
+	review := &authzv1.SubjectAccessReview{
+		Spec: authzv1.SubjectAccessReviewSpec{
+			User:               id.User,
+			Groups:             id.Groups,
+			ResourceAttributes: &attrs,
+		},
+	}
+	resp, err := rv.clientset.AuthorizationV1().SubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return false, "", err
+	}
+	return resp.Status.Allowed, resp.Status.Reason, nil
+}
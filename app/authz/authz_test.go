@@ -0,0 +1,99 @@
+package authz
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	authzv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestHeadersIdentity(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Forwarded-User", " alice ")
+	r.Header.Set("X-Forwarded-Groups", "devs, ,sre")
+
+	id := Headers{User: "X-Forwarded-User", Groups: "X-Forwarded-Groups"}.Identity(r)
+	if id.User != "alice" {
+		t.Errorf("expected alice, got %q", id.User)
+	}
+	if len(id.Groups) != 2 || id.Groups[0] != "devs" || id.Groups[1] != "sre" {
+		t.Errorf("expected [devs sre], got %v", id.Groups)
+	}
+}
+
+func newHandler(reactor k8stesting.ReactionFunc) http.Handler {
+	cs := fake.NewClientset()
+	cs.PrependReactor("create", "subjectaccessreviews", reactor)
+	mux := http.NewServeMux()
+	NewHandler(NewReviewer(cs), Headers{User: "X-Forwarded-User", Groups: "X-Forwarded-Groups"}, zap.NewNop()).Register(mux)
+	return mux
+}
+
+func post(h http.Handler, user, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/authz/check", strings.NewReader(body))
+	if user != "" {
+		req.Header.Set("X-Forwarded-User", user)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCheckRunsAsCaller(t *testing.T) {
+	// alice may only delete in team-a
+	h := newHandler(func(a k8stesting.Action) (bool, runtime.Object, error) {
+		sar := a.(k8stesting.CreateAction).GetObject().(*authzv1.SubjectAccessReview)
+		attrs := sar.Spec.ResourceAttributes
+		sar.Status.Allowed = sar.Spec.User == "alice" && attrs.Verb == "delete" && attrs.Namespace == "team-a"
+		return true, sar, nil
+	})
+
+	rec := post(h, "alice", `{"checks":[
+		{"verb":"delete","resource":"deployments","group":"apps","namespace":"team-a"},
+		{"verb":"delete","resource":"deployments","group":"apps","namespace":"team-b"}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		User    string
+		Results []Result
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if len(resp.Results) != 2 || !resp.Results[0].Allowed || resp.Results[1].Allowed {
+		t.Errorf("expected [allowed denied], got %+v", resp.Results)
+	}
+}
+
+func TestCheckErrors(t *testing.T) {
+	failing := newHandler(func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("apiserver unavailable")
+	})
+	check := `{"checks":[{"verb":"get","resource":"pods"}]}`
+
+	tests := []struct {
+		name string
+		user string
+		body string
+		want int
+	}{
+		{"unauthenticated", "", check, http.StatusUnauthorized},
+		{"no checks", "alice", `{"checks":[]}`, http.StatusBadRequest},
+		{"missing resource", "alice", `{"checks":[{"verb":"get"}]}`, http.StatusBadRequest},
+		{"review fails", "alice", check, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := post(failing, tt.user, tt.body); rec.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package authz
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	authzv1 "k8s.io/api/authorization/v1"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+)
+
+const (
+	// maxChecks bounds the reviews performed for one request.
+	maxChecks = 50
+	// reviewConcurrency bounds parallel SubjectAccessReviews per request.
+	reviewConcurrency = 8
+)
+
+var checksTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "authz_checks_total",
+	Help: "Access checks answered by POST /api/v1/authz/check, by result.",
+}, []string{"result"})
+
+// Check is one question, mirroring SubjectAccessReview resource attributes.
+type Check struct {
+	Verb        string `json:"verb"`
+	Group       string `json:"group,omitempty"`
+	Resource    string `json:"resource"`
+	Subresource string `json:"subresource,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+	Name        string `json:"name,omitempty"`
+}
+
+// Result answers a Check.
+type Result struct {
+	Check
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Handler serves POST /api/v1/authz/check so the portal can hide actions the
+// caller is not allowed to perform. Checks always run as the caller; there
+// is no way to ask about another user.
+type Handler struct {
+	reviewer *Reviewer
+	headers  Headers
+	logger   *zap.Logger
+}
+
+// NewHandler creates the check handler.
+func NewHandler(rv *Reviewer, headers Headers, logger *zap.Logger) *Handler {
+	return &Handler{reviewer: rv, headers: headers, logger: logger}
+}
+
+// Register mounts the handler on mux.
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.Handle("POST /api/v1/authz/check", h)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := h.headers.Identity(r)
+	if id.User == "" {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		Checks []Check `json:"checks"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&body); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(body.Checks) == 0 || len(body.Checks) > maxChecks {
+		http.Error(w, "between 1 and 50 checks are required", http.StatusBadRequest)
+		return
+	}
+	for _, c := range body.Checks {
+		if c.Verb == "" || c.Resource == "" {
+			http.Error(w, "every check needs verb and resource", http.StatusBadRequest)
+			return
+		}
+	}
+
+	results := make([]Result, len(body.Checks))
+	errs := make([]error, len(body.Checks))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, reviewConcurrency)
+	for i, c := range body.Checks {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			allowed, reason, err := h.reviewer.Allowed(r.Context(), id, authzv1.ResourceAttributes{
+				Verb:        c.Verb,
+				Group:       c.Group,
+				Resource:    c.Resource,
+				Subresource: c.Subresource,
+				Namespace:   c.Namespace,
+				Name:        c.Name,
+			})
+			results[i], errs[i] = Result{Check: c, Allowed: allowed, Reason: reason}, err
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		checksTotal.WithLabelValues("error").Inc()
+		h.logger.Error("access review failed", zap.String("user", id.User), zap.Error(err))
+		http.Error(w, "authorization check failed", http.StatusBadGateway)
+		return
+	}
+	for _, res := range results {
+		if res.Allowed {
+			checksTotal.WithLabelValues("allowed").Inc()
+		} else {
+			checksTotal.WithLabelValues("denied").Inc()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	codec.Encode(w, map[string]any{"user": id.User, "results": results})
+}
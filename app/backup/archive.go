@@ -0,0 +1,300 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+// Formats of the entity files in an archive.
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+const (
+	manifestName = "manifest.json"
+	// archiveVersion is bumped when the layout or columns change
+	// incompatibly.
+	archiveVersion = 1
+)
+
+// Manifest describes an archive and is its first file.
+type Manifest struct {
+	Version    int       `json:"version"`
+	Format     string    `json:"format"`
+	ExportedAt time.Time `json:"exported_at"`
+	Files      []File    `json:"files"`
+}
+
+// File is one entity file of an archive.
+type File struct {
+	Name   string `json:"name"`
+	Entity string `json:"entity"`
+	Count  int    `json:"count"`
+	// SHA256 is the hex digest of the file's contents.
+	SHA256 string `json:"sha256"`
+}
+
+// column is a CSV column, named after the entity's JSON field. raw columns
+// hold JSON (numbers, label objects) rather than a string.
+type column struct {
+	name string
+	raw  bool
+}
+
+// entity is one kind of entity in an archive.
+type entity struct {
+	name    string
+	columns []column
+	// rows returns a pointer to the seed's slice of the entity
+	rows func(*store.Seed) any
+}
+
+// entities are in the order they are written, parents first.
+var entities = []entity{
+	{"tenants", []column{{"id", false}, {"name", false}, {"display_name", false}, {"owner", false}, {"labels", true},
+		{"created_at", false}, {"updated_at", false}}, func(s *store.Seed) any { return &s.Tenants }},
+	{"environments", []column{{"id", false}, {"name", false}, {"display_name", false}, {"tier", false}, {"cluster", false},
+		{"labels", true}, {"created_at", false}, {"updated_at", false}}, func(s *store.Seed) any { return &s.Environments }},
+	{"services", []column{{"id", false}, {"tenant_id", false}, {"name", false}, {"description", false}, {"owner", false},
+		{"repository", false}, {"created_at", false}, {"updated_at", false}}, func(s *store.Seed) any { return &s.Services }},
+	{"deployments", []column{{"id", false}, {"service_id", false}, {"environment", false}, {"version", false}, {"image", false},
+		{"replicas", true}, {"status", false}, {"deployed_at", false}}, func(s *store.Seed) any { return &s.Deployments }},
+}
+
+func count(rows any) int {
+	return reflect.ValueOf(rows).Elem().Len()
+}
+
+// writeArchive writes seed to w as a gzipped tar of the manifest followed
+// by one file per entity in format.
+func writeArchive(w io.Writer, seed *store.Seed, format string, now time.Time) error {
+	manifest := Manifest{Version: archiveVersion, Format: format, ExportedAt: now}
+	files := make([][]byte, len(entities))
+	for i, e := range entities {
+		data, err := encode(e, e.rows(seed), format)
+		if err != nil {
+			return fmt.Errorf("encode %s: %w", e.name, err)
+		}
+		sum := sha256.Sum256(data)
+		files[i] = data
+		manifest.Files = append(manifest.Files, File{
+			Name:   e.name + "." + format,
+			Entity: e.name,
+			Count:  count(e.rows(seed)),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+	}
+	mdata, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	add := func(name string, data []byte) error {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: now, Typeflag: tar.TypeReg}); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	if err := add(manifestName, mdata); err != nil {
+		return err
+	}
+	for i, f := range manifest.Files {
+		if err := add(f.Name, files[i]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// encode renders rows of e as a JSON array or as CSV with a header line.
+func encode(e entity, rows any, format string) ([]byte, error) {
+	data, err := json.Marshal(rows)
+	if err != nil {
+		return nil, err
+	}
+	if format == FormatJSON {
+		if count(rows) == 0 {
+			return []byte("[]"), nil
+		}
+		return data, nil
+	}
+	var objects []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &objects); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	header := make([]string, len(e.columns))
+	for i, c := range e.columns {
+		header[i] = c.name
+	}
+	cw.Write(header)
+	for _, obj := range objects {
+		record := make([]string, len(e.columns))
+		for i, c := range e.columns {
+			v := obj[c.name]
+			switch {
+			case len(v) == 0 || string(v) == "null":
+			case c.raw:
+				record[i] = string(v)
+			default:
+				if err := json.Unmarshal(v, &record[i]); err != nil {
+					return nil, fmt.Errorf("%s: %w", c.name, err)
+				}
+			}
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return buf.Bytes(), cw.Error()
+}
+
+// decode parses a file of e in format into the seed's rows.
+func decode(e entity, data []byte, format string, seed *store.Seed) error {
+	rows := e.rows(seed)
+	if format == FormatJSON {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		return dec.Decode(rows)
+	}
+	cr := csv.NewReader(bytes.NewReader(data))
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("read header: %w", err)
+	}
+	cols := make([]column, len(header))
+	for i, name := range header {
+		j := slices.IndexFunc(e.columns, func(c column) bool { return c.name == name })
+		if j < 0 {
+			return fmt.Errorf("unknown column %q", name)
+		}
+		cols[i] = e.columns[j]
+	}
+	objects := []map[string]json.RawMessage{}
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		obj := make(map[string]json.RawMessage, len(cols))
+		for i, c := range cols {
+			switch cell := record[i]; {
+			case !c.raw:
+				obj[c.name], _ = json.Marshal(cell)
+			case cell == "":
+			case json.Valid([]byte(cell)):
+				obj[c.name] = json.RawMessage(cell)
+			default:
+				line, _ := cr.FieldPos(i)
+				return fmt.Errorf("line %d: %s is not valid JSON", line, c.name)
+			}
+		}
+		objects = append(objects, obj)
+	}
+	data, err = json.Marshal(objects)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, rows)
+}
+
+// errArchive marks archives that cannot be read: corrupt, incomplete, or
+// not matching their manifest.
+var errArchive = errors.New("invalid archive")
+
+// readArchive reads an archive written by writeArchive, verifying every
+// file against the manifest.
+func readArchive(r io.Reader) (*store.Seed, *Manifest, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", errArchive, err)
+	}
+	tr := tar.NewReader(zr)
+	next := func() (*tar.Header, []byte, error) {
+		hdr, err := tr.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := io.ReadAll(tr)
+		return hdr, data, err
+	}
+
+	hdr, data, err := next()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", errArchive, err)
+	}
+	if hdr.Name != manifestName {
+		return nil, nil, fmt.Errorf("%w: first file is %s, not %s", errArchive, hdr.Name, manifestName)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("%w: parse manifest: %w", errArchive, err)
+	}
+	if manifest.Version != archiveVersion {
+		return nil, nil, fmt.Errorf("%w: unsupported version %d", errArchive, manifest.Version)
+	}
+	if manifest.Format != FormatJSON && manifest.Format != FormatCSV {
+		return nil, nil, fmt.Errorf("%w: unknown format %q", errArchive, manifest.Format)
+	}
+
+	var seed store.Seed
+	seen := map[string]bool{}
+	for {
+		hdr, data, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %w", errArchive, err)
+		}
+		i := slices.IndexFunc(manifest.Files, func(f File) bool { return f.Name == hdr.Name })
+		if i < 0 || seen[hdr.Name] {
+			return nil, nil, fmt.Errorf("%w: unexpected file %s", errArchive, hdr.Name)
+		}
+		seen[hdr.Name] = true
+		f := manifest.Files[i]
+		if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != f.SHA256 {
+			return nil, nil, fmt.Errorf("%w: %s does not match its checksum", errArchive, f.Name)
+		}
+		j := slices.IndexFunc(entities, func(e entity) bool { return e.name == f.Entity })
+		if j < 0 || f.Name != f.Entity+"."+manifest.Format {
+			return nil, nil, fmt.Errorf("%w: unknown entity file %s", errArchive, f.Name)
+		}
+		e := entities[j]
+		if err := decode(e, data, manifest.Format, &seed); err != nil {
+			return nil, nil, fmt.Errorf("%w: %s: %w", errArchive, f.Name, err)
+		}
+		if n := count(e.rows(&seed)); n != f.Count {
+			return nil, nil, fmt.Errorf("%w: %s has %d entries, the manifest says %d", errArchive, f.Name, n, f.Count)
+		}
+	}
+	for _, f := range manifest.Files {
+		if !seen[f.Name] {
+			return nil, nil, fmt.Errorf("%w: %s is missing", errArchive, f.Name)
+		}
+	}
+	return &seed, &manifest, nil
+}
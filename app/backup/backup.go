@@ -0,0 +1,264 @@
+// Package backup exports the platform's entities (tenants, environments,
+// services and deployments) as an archive and imports them back, for
+// moving them between environments and for disaster recovery drills.
+//
+// An archive is a gzipped tar: manifest.json first, listing each entity
+// file with its entry count and SHA-256, then one JSON or CSV file per
+// entity. Imports verify every file against the manifest, validate the
+// entities and write them in one transaction, or only check that they
+// could be written when dry_run=true.
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+// Options configures the handler.
+type Options struct {
+	// UserHeader and GroupsHeader carry the caller's identity, set by the
+	// authenticating proxy.
+	UserHeader   string
+	GroupsHeader string
+	// AdminGroups may export and import.
+	AdminGroups []string
+	// MaxImportBytes bounds uploaded archives; 0 means 64 MiB.
+	MaxImportBytes int64
+}
+
+// Handler serves the export and import endpoints.
+type Handler struct {
+	store   *store.Store
+	opts    Options
+	headers authz.Headers
+	logger  *zap.Logger
+}
+
+// New creates a handler over st.
+func New(st *store.Store, opts Options, logger *zap.Logger) *Handler {
+	if opts.MaxImportBytes <= 0 {
+		opts.MaxImportBytes = 64 << 20
+	}
+	return &Handler{
+		store:   st,
+		opts:    opts,
+		headers: authz.Headers{User: opts.UserHeader, Groups: opts.GroupsHeader},
+		logger:  logger,
+	}
+}
+
+// Register mounts the endpoints on mux:
+//
+//	GET  /api/v1/admin/export?format=json|csv   download an archive
+//	POST /api/v1/admin/import?dry_run=true      upload an archive
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/admin/export", h.export)
+	mux.HandleFunc("POST /api/v1/admin/import", h.importArchive)
+}
+
+// archiveChecksumTrailer carries the SHA-256 of the whole archive, known
+// only once it has been streamed.
+const archiveChecksumTrailer = "X-Archive-Sha256"
+
+func (h *Handler) export(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = FormatJSON
+	}
+	if format != FormatJSON && format != FormatCSV {
+		http.Error(w, "format must be json or csv", http.StatusBadRequest)
+		return
+	}
+	audit, ok := h.authorize(w, r, "export")
+	if !ok {
+		return
+	}
+	seed, err := store.Dump(r.Context(), h.store)
+	if err != nil {
+		h.logger.Error("export failed", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	// A large export can outlast the server's WriteTimeout
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	now := time.Now().UTC()
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="platform-export-%s.tar.gz"`, now.Format("20060102T150405Z")))
+	w.Header().Set("Trailer", archiveChecksumTrailer)
+	sum := sha256.New()
+	if err := writeArchive(io.MultiWriter(w, sum), seed, format, now); err != nil {
+		// The status is already sent; the truncated archive fails to
+		// decompress and lacks the checksum trailer.
+		h.logger.Error("writing export failed", zap.Error(err))
+		return
+	}
+	w.Header().Set(archiveChecksumTrailer, hex.EncodeToString(sum.Sum(nil)))
+	audit.Info("platform data exported",
+		zap.String("format", format),
+		zap.Int("tenants", len(seed.Tenants)),
+		zap.Int("services", len(seed.Services)))
+}
+
+// ImportResult reports an import.
+type ImportResult struct {
+	DryRun bool           `json:"dry_run"`
+	Format string         `json:"format,omitempty"`
+	Counts map[string]int `json:"counts,omitempty"`
+	// Errors lists the problems that prevented the import.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// errDryRun rolls back a dry run's transaction once everything was
+// written.
+var errDryRun = errors.New("dry run")
+
+func (h *Handler) importArchive(w http.ResponseWriter, r *http.Request) {
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+	audit, ok := h.authorize(w, r, "import")
+	if !ok {
+		return
+	}
+	// A large upload can outlast the server's ReadTimeout
+	_ = http.NewResponseController(w).SetReadDeadline(time.Time{})
+	res := ImportResult{DryRun: dryRun}
+	seed, manifest, err := readArchive(http.MaxBytesReader(w, r.Body, h.opts.MaxImportBytes))
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		http.Error(w, fmt.Sprintf("archive larger than %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		res.Errors = []string{err.Error()}
+		writeJSON(w, http.StatusBadRequest, res)
+		return
+	}
+	res.Format = manifest.Format
+	res.Counts = map[string]int{}
+	for _, e := range entities {
+		res.Counts[e.name] = count(e.rows(seed))
+	}
+	if res.Errors = validate(seed); len(res.Errors) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, res)
+		return
+	}
+
+	err = h.store.WithTx(r.Context(), func(tx store.Repos) error {
+		if err := seed.Create(r.Context(), tx); err != nil {
+			return err
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		err = nil
+	}
+	switch {
+	case errors.Is(err, store.ErrConflict):
+		res.Errors = []string{err.Error()}
+		writeJSON(w, http.StatusConflict, res)
+		return
+	case errors.Is(err, store.ErrNotFound):
+		// A service or deployment whose parent is neither in the archive
+		// nor in the store
+		res.Errors = []string{err.Error()}
+		writeJSON(w, http.StatusUnprocessableEntity, res)
+		return
+	case err != nil:
+		h.logger.Error("import failed", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	audit.Info("platform data imported",
+		zap.Bool("dry_run", dryRun),
+		zap.Time("exported_at", manifest.ExportedAt),
+		zap.Any("counts", res.Counts))
+	writeJSON(w, http.StatusOK, res)
+}
+
+// validate checks what the store does not: IDs, which the archive must
+// keep so services and deployments can refer to their parents, and the
+// names and tiers the resources API requires.
+func validate(seed *store.Seed) []string {
+	var errs []string
+	add := func(kind string, i int, format string, args ...any) {
+		errs = append(errs, fmt.Sprintf("%s %d: %s", kind, i, fmt.Sprintf(format, args...)))
+	}
+	for i, t := range seed.Tenants {
+		if t.ID == "" {
+			add("tenant", i, "id is required")
+		}
+		if msgs := validation.IsDNS1123Label(t.Name); len(msgs) > 0 {
+			add("tenant", i, "invalid name %q: %s", t.Name, msgs[0])
+		}
+	}
+	for i, e := range seed.Environments {
+		if e.ID == "" {
+			add("environment", i, "id is required")
+		}
+		if msgs := validation.IsDNS1123Label(e.Name); len(msgs) > 0 {
+			add("environment", i, "invalid name %q: %s", e.Name, msgs[0])
+		}
+		if !slices.Contains([]string{store.TierDevelopment, store.TierStaging, store.TierProduction}, e.Tier) {
+			add("environment", i, "unknown tier %q", e.Tier)
+		}
+	}
+	for i, s := range seed.Services {
+		if s.ID == "" || s.Name == "" || s.TenantID == "" {
+			add("service", i, "id, name and tenant_id are required")
+		}
+	}
+	for i, d := range seed.Deployments {
+		if d.ID == "" || d.ServiceID == "" {
+			add("deployment", i, "id and service_id are required")
+		}
+	}
+	return errs
+}
+
+// authorize admits callers in one of the admin groups, returning a logger
+// for the audit entry of the operation.
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request, op string) (*zap.Logger, bool) {
+	id := h.headers.Identity(r)
+	if id.User == "" {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return nil, false
+	}
+	audit := h.logger.With(
+		zap.String("audit", "backup"),
+		zap.String("request_id", middleware.GetRequestID(r.Context())),
+		zap.String("user", id.User),
+		zap.Strings("groups", id.Groups),
+		zap.String("operation", op),
+	)
+	for _, g := range id.Groups {
+		if slices.Contains(h.opts.AdminGroups, g) {
+			return audit, true
+		}
+	}
+	audit.Warn("backup operation denied")
+	http.Error(w, "forbidden", http.StatusForbidden)
+	return nil, false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
@@ -0,0 +1,134 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+func newMux(t *testing.T, st *store.Store) *http.ServeMux {
+	t.Helper()
+	mux := http.NewServeMux()
+	New(st, Options{
+		UserHeader:   "X-Forwarded-User",
+		GroupsHeader: "X-Forwarded-Groups",
+		AdminGroups:  []string{"platform-admins"},
+	}, zap.NewNop()).Register(mux)
+	return mux
+}
+
+func do(mux *http.ServeMux, method, path string, body []byte, groups string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("X-Forwarded-User", "alice")
+	req.Header.Set("X-Forwarded-Groups", groups)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func seeded(t *testing.T) *store.Store {
+	t.Helper()
+	seed, err := store.LoadSeed("../store/testdata/seed.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	st := store.NewMemory()
+	if err := seed.Apply(context.Background(), st); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return st
+}
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	src := newMux(t, seeded(t))
+	if rec := do(src, http.MethodGet, "/api/v1/admin/export", nil, "developers"); rec.Code != http.StatusForbidden {
+		t.Errorf("expected callers outside the admin groups to be refused, got %d", rec.Code)
+	}
+
+	for _, format := range []string{FormatJSON, FormatCSV} {
+		rec := do(src, http.MethodGet, "/api/v1/admin/export?format="+format, nil, "platform-admins")
+		archive := rec.Body.Bytes()
+		sum := sha256.Sum256(archive)
+		if rec.Code != http.StatusOK || rec.Result().Trailer.Get(archiveChecksumTrailer) != hex.EncodeToString(sum[:]) {
+			t.Fatalf("%s: expected the archive with its checksum trailer, got %d %v", format, rec.Code, rec.Result().Trailer)
+		}
+
+		dst := store.NewMemory()
+		mux := newMux(t, dst)
+		rec = do(mux, http.MethodPost, "/api/v1/admin/import?dry_run=true", archive, "platform-admins")
+		var res ImportResult
+		json.NewDecoder(rec.Body).Decode(&res)
+		if rec.Code != http.StatusOK || !res.DryRun || res.Counts["services"] != 3 || res.Counts["deployments"] == 0 {
+			t.Fatalf("%s: expected a dry run counting the entities, got %d %+v", format, rec.Code, res)
+		}
+		if tenants, _ := dst.Tenants.List(ctx); len(tenants) != 0 {
+			t.Fatalf("%s: expected a dry run to write nothing, got %+v", format, tenants)
+		}
+		if rec := do(mux, http.MethodPost, "/api/v1/admin/import", archive, "platform-admins"); rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", format, rec.Code, rec.Body)
+		}
+		ledger, err := dst.Services.Get(ctx, "payments-ledger")
+		if err != nil || ledger.TenantID != "payments" {
+			t.Errorf("%s: expected the services restored with their IDs, got %+v (%v)", format, ledger, err)
+		}
+		payments, _ := dst.Tenants.Get(ctx, "payments")
+		if payments == nil || payments.Labels["namespace"] != "payments" {
+			t.Errorf("%s: expected labels to survive, got %+v", format, payments)
+		}
+		if rec := do(mux, http.MethodPost, "/api/v1/admin/import?dry_run=true", archive, "platform-admins"); rec.Code != http.StatusConflict {
+			t.Errorf("%s: expected importing over existing entities to conflict, got %d", format, rec.Code)
+		}
+	}
+}
+
+func TestImportRejectsTamperedArchives(t *testing.T) {
+	rec := do(newMux(t, seeded(t)), http.MethodGet, "/api/v1/admin/export?format=csv", nil, "platform-admins")
+	archive := rec.Body.Bytes()
+
+	// Rewrite the archive with one tenant renamed in tenants.csv but the
+	// manifest left alone
+	zr, _ := gzip.NewReader(bytes.NewReader(archive))
+	tr := tar.NewReader(zr)
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		data, _ := io.ReadAll(tr)
+		if hdr.Name == "tenants.csv" {
+			data = bytes.Replace(data, []byte("payments"), []byte("paymentz"), 1)
+		}
+		hdr.Size = int64(len(data))
+		tw.WriteHeader(hdr)
+		tw.Write(data)
+	}
+	tw.Close()
+	zw.Close()
+
+	mux := newMux(t, store.NewMemory())
+	rec = do(mux, http.MethodPost, "/api/v1/admin/import", buf.Bytes(), "platform-admins")
+	var res ImportResult
+	json.NewDecoder(rec.Body).Decode(&res)
+	if rec.Code != http.StatusBadRequest || len(res.Errors) != 1 {
+		t.Errorf("expected the checksum mismatch to be refused, got %d %+v", rec.Code, res)
+	}
+	if rec := do(mux, http.MethodPost, "/api/v1/admin/import", []byte("not an archive"), "platform-admins"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a body that is not an archive, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,146 @@
+// Package cache provides the shared key-value store behind idempotency keys,
+// rate limiting and response caching: Redis when replicas must agree, or
+// process memory for a single replica.
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrMiss is returned by Get when the key does not exist or has expired.
+var ErrMiss = errors.New("cache miss")
+
+// Cache is a key-value store with per-key expiry.
+type Cache interface {
+	// Get returns the value stored under key, or ErrMiss.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores value under key for ttl.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// SetNX stores value only when key does not exist, reporting whether
+	// it did; the building block for locks.
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	// Incr increments the counter under key and returns the new value. The
+	// counter expires ttl after it was created.
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	Delete(ctx context.Context, key string) error
+	// Check reports whether the cache answers, for readiness probes.
+	Check(ctx context.Context) error
+	Close() error
+}
+
+// sweepEvery is how many writes pass between scans for expired entries.
+const sweepEvery = 1000
+
+type entry struct {
+	value   []byte
+	counter int64
+	expires time.Time
+}
+
+// Memory is a Cache in process memory. Each replica has its own, so limits
+// and idempotency keys hold per replica only.
+type Memory struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+	writes  int
+	now     func() time.Time
+}
+
+// NewMemory creates an empty in-memory cache.
+func NewMemory() *Memory {
+	return &Memory{entries: map[string]*entry{}, now: time.Now}
+}
+
+// lookup returns the live entry under key, dropping it when expired.
+func (m *Memory) lookup(key string) *entry {
+	e, ok := m.entries[key]
+	if !ok {
+		return nil
+	}
+	if !m.now().Before(e.expires) {
+		delete(m.entries, key)
+		return nil
+	}
+	return e
+}
+
+func (m *Memory) store(key string, e *entry) {
+	m.entries[key] = e
+	if m.writes++; m.writes%sweepEvery == 0 {
+		now := m.now()
+		for k, e := range m.entries {
+			if !now.Before(e.expires) {
+				delete(m.entries, k)
+			}
+		}
+	}
+}
+
+func (m *Memory) Get(_ context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.lookup(key)
+	if e == nil || e.value == nil {
+		return nil, ErrMiss
+	}
+	return e.value, nil
+}
+
+func (m *Memory) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.store(key, &entry{value: append([]byte{}, value...), expires: m.now().Add(ttl)})
+	return nil
+}
+
+func (m *Memory) SetNX(_ context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lookup(key) != nil {
+		return false, nil
+	}
+	m.store(key, &entry{value: append([]byte{}, value...), expires: m.now().Add(ttl)})
+	return true, nil
+}
+
+func (m *Memory) Incr(_ context.Context, key string, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.lookup(key)
+	if e == nil {
+		e = &entry{expires: m.now().Add(ttl)}
+		m.store(key, e)
+	}
+	e.counter++
+	return e.counter, nil
+}
+
+func (m *Memory) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+// DeletePrefix deletes the keys starting with prefix, e.g. to free memory
+// held by entries that can be rebuilt, and returns how many it deleted.
+func (m *Memory) DeletePrefix(prefix string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for k := range m.entries {
+		if strings.HasPrefix(k, prefix) {
+			delete(m.entries, k)
+			n++
+		}
+	}
+	return n
+}
+
+func (m *Memory) Check(context.Context) error { return nil }
+
+func (m *Memory) Close() error { return nil }
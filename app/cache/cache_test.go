@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := t.Context()
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+
+	m.Set(ctx, "k", []byte("v"), time.Minute)
+	if v, err := m.Get(ctx, "k"); err != nil || string(v) != "v" {
+		t.Errorf("expected the stored value, got %q (%v)", v, err)
+	}
+	if ok, _ := m.SetNX(ctx, "k", []byte("other"), time.Minute); ok {
+		t.Error("expected SetNX to keep an existing key")
+	}
+	for want := int64(1); want <= 3; want++ {
+		if n, _ := m.Incr(ctx, "counter", 30*time.Second); n != want {
+			t.Errorf("expected %d, got %d", want, n)
+		}
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := m.Get(ctx, "k"); !errors.Is(err, ErrMiss) {
+		t.Errorf("expected an expired key to miss, got %v", err)
+	}
+	if ok, _ := m.SetNX(ctx, "k", []byte("other"), time.Minute); !ok {
+		t.Error("expected SetNX to take an expired key")
+	}
+	if n, _ := m.Incr(ctx, "counter", 30*time.Second); n != 1 {
+		t.Errorf("expected the counter to restart after expiry, got %d", n)
+	}
+	m.Delete(ctx, "k")
+	if _, err := m.Get(ctx, "k"); !errors.Is(err, ErrMiss) {
+		t.Errorf("expected a deleted key to miss, got %v", err)
+	}
+}
+
+func TestNewRedis(t *testing.T) {
+	for _, opts := range []RedisOptions{
+		{},
+		{Mode: ModeSentinel, Addrs: []string{"sentinel:26379"}},
+		{Mode: "replicated", Addrs: []string{"redis:6379"}},
+		{Addrs: []string{"redis:6379"}, TLS: true, TLSCAFile: "/nonexistent/ca.pem"},
+	} {
+		if _, err := NewRedis(opts); err == nil {
+			t.Errorf("%+v: expected an error", opts)
+		}
+	}
+	for _, opts := range []RedisOptions{
+		{Addrs: []string{"redis:6379"}, Password: "s3cret"},
+		{Mode: ModeSentinel, Addrs: []string{"a:26379", "b:26379"}, MasterName: "mymaster"},
+		{Mode: ModeCluster, Addrs: []string{"a:6379", "b:6379"}, TLS: true},
+	} {
+		r, err := NewRedis(opts)
+		if err != nil {
+			t.Errorf("%+v: unexpected error: %v", opts, err)
+			continue
+		}
+		r.Close()
+	}
+}
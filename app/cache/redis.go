@@ -0,0 +1,194 @@
+package cache
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+)
+
+var commandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "cache_command_duration_seconds",
+	Help:    "Redis command latency by command and result.",
+	Buckets: prometheus.ExponentialBuckets(0.0002, 2, 14),
+}, []string{"command", "result"})
+
+// Redis deployment modes.
+const (
+	// ModeStandalone talks to a single Redis server at the first address.
+	ModeStandalone = "standalone"
+	// ModeSentinel discovers the primary of MasterName through the Sentinel
+	// addresses and follows failovers.
+	ModeSentinel = "sentinel"
+	// ModeCluster spreads keys over a Redis Cluster seeded by the addresses.
+	ModeCluster = "cluster"
+)
+
+// RedisOptions configures the Redis client.
+type RedisOptions struct {
+	Mode  string
+	Addrs []string
+	// MasterName is the Sentinel-monitored primary, for ModeSentinel.
+	MasterName string
+	// Username and Password authenticate with Redis (ACL users when
+	// Username is set); SentinelPassword authenticates with the Sentinels.
+	Username         string
+	Password         string
+	SentinelPassword string
+	// DB selects the logical database; ignored by Redis Cluster.
+	DB  int
+	TLS bool
+	// TLSCAFile verifies the server against a private CA instead of the
+	// system roots.
+	TLSCAFile string
+	// KeyPrefix namespaces every key, so instances can share a Redis.
+	KeyPrefix string
+	PoolSize  int
+}
+
+// Redis is a Cache in Redis, shared by every replica.
+type Redis struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// incr increments a counter, setting its expiry only when it is created so
+// a busy key still expires on time.
+var incr = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return n`)
+
+// NewRedis creates the Redis client. Connections are opened lazily; use
+// Check to verify the server answers.
+func NewRedis(opts RedisOptions) (*Redis, error) {
+	if len(opts.Addrs) == 0 {
+		return nil, errors.New("at least one Redis address is required")
+	}
+	var tlsConfig *tls.Config
+	if opts.TLS {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		if opts.TLSCAFile != "" {
+			pem, err := os.ReadFile(opts.TLSCAFile)
+			if err != nil {
+				return nil, fmt.Errorf("read Redis CA: %w", err)
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates in %s", opts.TLSCAFile)
+			}
+		}
+	}
+
+	var client redis.UniversalClient
+	switch opts.Mode {
+	case ModeStandalone, "":
+		client = redis.NewClient(&redis.Options{
+			Addr:      opts.Addrs[0],
+			Username:  opts.Username,
+			Password:  opts.Password,
+			DB:        opts.DB,
+			TLSConfig: tlsConfig,
+			PoolSize:  opts.PoolSize,
+		})
+	case ModeSentinel:
+		if opts.MasterName == "" {
+			return nil, errors.New("sentinel mode requires a master name")
+		}
+		client = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       opts.MasterName,
+			SentinelAddrs:    opts.Addrs,
+			SentinelPassword: opts.SentinelPassword,
+			Username:         opts.Username,
+			Password:         opts.Password,
+			DB:               opts.DB,
+			TLSConfig:        tlsConfig,
+			PoolSize:         opts.PoolSize,
+		})
+	case ModeCluster:
+		client = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     opts.Addrs,
+			Username:  opts.Username,
+			Password:  opts.Password,
+			TLSConfig: tlsConfig,
+			PoolSize:  opts.PoolSize,
+		})
+	default:
+		return nil, fmt.Errorf("unknown Redis mode %q", opts.Mode)
+	}
+	client.AddHook(metricsHook{})
+	return &Redis{client: client, prefix: opts.KeyPrefix}, nil
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	b, err := r.client.Get(ctx, r.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrMiss
+	}
+	return b, err
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.client.Set(ctx, r.prefix+key, value, ttl).Err()
+}
+
+func (r *Redis) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, r.prefix+key, value, ttl).Result()
+}
+
+func (r *Redis) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return incr.Run(ctx, r.client, []string{r.prefix + key}, ttl.Milliseconds()).Int64()
+}
+
+func (r *Redis) Delete(ctx context.Context, key string) error {
+	return r.client.Del(ctx, r.prefix+key).Err()
+}
+
+func (r *Redis) Check(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+// Close closes the connection pool.
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
+
+// metricsHook records the latency of every command.
+type metricsHook struct{}
+
+func (metricsHook) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (metricsHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		observe(cmd.Name(), start, err)
+		return err
+	}
+}
+
+func (metricsHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+		observe("pipeline", start, err)
+		return err
+	}
+}
+
+func observe(command string, start time.Time, err error) {
+	result := "success"
+	if err != nil && !errors.Is(err, redis.Nil) {
+		result = "error"
+	}
+	commandDuration.WithLabelValues(command, result).Observe(time.Since(start).Seconds())
+}
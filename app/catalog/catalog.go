@@ -0,0 +1,264 @@
+// Package catalog serves the service catalog: CatalogItem custom resources
+// describing the capabilities teams can self-provision, with the JSON
+// Schema of their parameters. Reads are open to portal users; writes are
+// authorised with a SubjectAccessReview against the catalogitems resource
+// for the caller's identity, so cluster RBAC decides who curates the catalog.
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"go.uber.org/zap"
+	authzv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	platformv1alpha1 "github.com/virenpatel/k8s-platform-engineering-lab/app/api/v1alpha1"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/crud"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+)
+
+// Item is the API representation of a CatalogItem.
+type Item struct {
+	Name             string          `json:"name"`
+	DisplayName      string          `json:"display_name"`
+	Description      string          `json:"description,omitempty"`
+	Category         string          `json:"category"`
+	Tags             []string        `json:"tags,omitempty"`
+	Owner            string          `json:"owner,omitempty"`
+	DocumentationURL string          `json:"documentation_url,omitempty"`
+	Parameters       json.RawMessage `json:"parameters,omitempty"`
+	Deprecated       bool            `json:"deprecated"`
+	// ResourceVersion guards updates against concurrent edits; send back the
+	// value from the last read.
+	ResourceVersion string `json:"resource_version,omitempty"`
+}
+
+// Options configures the handler.
+type Options struct {
+	// UserHeader and GroupsHeader carry the caller's identity, set by the
+	// authenticating proxy. Groups are comma-separated.
+	UserHeader   string
+	GroupsHeader string
+}
+
+// Handler serves /api/v1/catalog.
+type Handler struct {
+	*crud.Handler[Item, *Item]
+}
+
+// New creates a catalog handler. c must have the platform.io types in its
+// scheme; cs is used for SubjectAccessReviews.
+func New(c client.Client, cs kubernetes.Interface, opts Options, logger *zap.Logger) *Handler {
+	a := &authorizer{
+		reviewer: authz.NewReviewer(cs),
+		headers:  authz.Headers{User: opts.UserHeader, Groups: opts.GroupsHeader},
+		logger:   logger,
+	}
+	return &Handler{crud.New[Item](backend{c}, crud.Options{
+		Path:      "/api/v1/catalog",
+		Kind:      "catalog item",
+		Authorize: a.authorize,
+	}, logger)}
+}
+
+func (item *Item) Key() string          { return item.Name }
+func (item *Item) SetKey(name string)   { item.Name = name }
+func (item *Item) Version() string      { return item.ResourceVersion }
+func (item *Item) SetVersion(rv string) { item.ResourceVersion = rv }
+func (item *Item) Validate() error      { return validate(*item) }
+
+// backend keeps items as CatalogItem resources. Their resourceVersion is
+// the item's version, so the API server refuses stale writes.
+type backend struct {
+	client client.Client
+}
+
+// List supports the category filter and hides deprecated items unless
+// deprecated=true.
+func (b backend) List(ctx context.Context, q url.Values) ([]Item, error) {
+	var list platformv1alpha1.CatalogItemList
+	if err := b.client.List(ctx, &list); err != nil {
+		return nil, translate(err)
+	}
+	category, includeDeprecated := q.Get("category"), q.Get("deprecated") == "true"
+	items := make([]Item, 0, len(list.Items))
+	for i := range list.Items {
+		ci := &list.Items[i]
+		if category != "" && ci.Spec.Category != category {
+			continue
+		}
+		if ci.Spec.Deprecated && !includeDeprecated {
+			continue
+		}
+		items = append(items, toItem(ci))
+	}
+	return items, nil
+}
+
+func (b backend) Get(ctx context.Context, name string) (*Item, error) {
+	var ci platformv1alpha1.CatalogItem
+	if err := b.client.Get(ctx, client.ObjectKey{Name: name}, &ci); err != nil {
+		return nil, translate(err)
+	}
+	item := toItem(&ci)
+	return &item, nil
+}
+
+func (b backend) Create(ctx context.Context, item *Item) error {
+	ci := &platformv1alpha1.CatalogItem{ObjectMeta: metav1.ObjectMeta{Name: item.Name}}
+	applySpec(ci, *item)
+	if err := b.client.Create(ctx, ci); err != nil {
+		return translate(err)
+	}
+	*item = toItem(ci)
+	return nil
+}
+
+func (b backend) Update(ctx context.Context, item *Item) error {
+	var ci platformv1alpha1.CatalogItem
+	if err := b.client.Get(ctx, client.ObjectKey{Name: item.Name}, &ci); err != nil {
+		return translate(err)
+	}
+	if item.ResourceVersion != "" {
+		ci.ResourceVersion = item.ResourceVersion
+	}
+	applySpec(&ci, *item)
+	if err := b.client.Update(ctx, &ci); err != nil {
+		return translate(err)
+	}
+	*item = toItem(&ci)
+	return nil
+}
+
+func (b backend) Delete(ctx context.Context, name, rv string) error {
+	ci := &platformv1alpha1.CatalogItem{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	var opts []client.DeleteOption
+	if rv != "" {
+		opts = append(opts, client.Preconditions{ResourceVersion: &rv})
+	}
+	return translate(b.client.Delete(ctx, ci, opts...))
+}
+
+// translate maps API server errors to the crud errors.
+func translate(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case apierrors.IsNotFound(err):
+		return fmt.Errorf("%w: %w", crud.ErrNotFound, err)
+	case apierrors.IsAlreadyExists(err):
+		return fmt.Errorf("%w: %w", crud.ErrExists, err)
+	case apierrors.IsConflict(err):
+		return fmt.Errorf("%w: %w", crud.ErrStale, err)
+	case apierrors.IsInvalid(err):
+		return fmt.Errorf("%w: %w", crud.ErrInvalid, err)
+	}
+	return err
+}
+
+type authorizer struct {
+	reviewer *authz.Reviewer
+	headers  authz.Headers
+	logger   *zap.Logger
+}
+
+// authorize checks that the caller may perform verb on the catalog item and
+// writes the audit entry. It writes the error response when it returns false.
+func (a *authorizer) authorize(w http.ResponseWriter, r *http.Request, verb, name string) bool {
+	id := a.headers.Identity(r)
+	if id.User == "" {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return false
+	}
+
+	audit := a.logger.With(
+		zap.String("audit", "catalog"),
+		zap.String("request_id", middleware.GetRequestID(r.Context())),
+		zap.String("user", id.User),
+		zap.Strings("groups", id.Groups),
+		zap.String("verb", verb),
+		zap.String("item", name),
+	)
+
+	allowed, _, err := a.reviewer.Allowed(r.Context(), id, authzv1.ResourceAttributes{
+		Group:    platformv1alpha1.GroupVersion.Group,
+		Version:  platformv1alpha1.GroupVersion.Version,
+		Resource: "catalogitems",
+		Verb:     verb,
+		Name:     name,
+	})
+	if err != nil {
+		audit.Error("catalog authorization failed", zap.Error(err))
+		http.Error(w, "authorization check failed", http.StatusBadGateway)
+		return false
+	}
+	if !allowed {
+		audit.Warn("catalog change denied")
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return false
+	}
+	audit.Info("catalog change allowed")
+	return true
+}
+
+func validate(item Item) error {
+	if errs := validation.IsDNS1123Subdomain(item.Name); len(errs) > 0 {
+		return fmt.Errorf("invalid name %q: %s", item.Name, errs[0])
+	}
+	if item.DisplayName == "" || item.Category == "" {
+		return fmt.Errorf("display_name and category are required")
+	}
+	if len(item.Parameters) > 0 {
+		var schema map[string]any
+		if err := json.Unmarshal(item.Parameters, &schema); err != nil {
+			return fmt.Errorf("parameters must be a JSON Schema object")
+		}
+		if t, ok := schema["type"]; ok && t != "object" {
+			return fmt.Errorf(`parameters schema must have "type": "object"`)
+		}
+	}
+	return nil
+}
+
+func applySpec(ci *platformv1alpha1.CatalogItem, item Item) {
+	ci.Spec = platformv1alpha1.CatalogItemSpec{
+		DisplayName:      item.DisplayName,
+		Description:      item.Description,
+		Category:         item.Category,
+		Tags:             item.Tags,
+		Owner:            item.Owner,
+		DocumentationURL: item.DocumentationURL,
+		Deprecated:       item.Deprecated,
+	}
+	if len(item.Parameters) > 0 {
+		ci.Spec.Parameters = &runtime.RawExtension{Raw: item.Parameters}
+	}
+}
+
+func toItem(ci *platformv1alpha1.CatalogItem) Item {
+	item := Item{
+		Name:             ci.Name,
+		DisplayName:      ci.Spec.DisplayName,
+		Description:      ci.Spec.Description,
+		Category:         ci.Spec.Category,
+		Tags:             ci.Spec.Tags,
+		Owner:            ci.Spec.Owner,
+		DocumentationURL: ci.Spec.DocumentationURL,
+		Deprecated:       ci.Spec.Deprecated,
+		ResourceVersion:  ci.ResourceVersion,
+	}
+	if ci.Spec.Parameters != nil {
+		item.Parameters = ci.Spec.Parameters.Raw
+	}
+	return item
+}
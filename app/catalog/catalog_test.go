@@ -0,0 +1,112 @@
+package catalog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	authzv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	platformv1alpha1 "github.com/virenpatel/k8s-platform-engineering-lab/app/api/v1alpha1"
+)
+
+func newMux(t *testing.T, objs ...*platformv1alpha1.CatalogItem) *http.ServeMux {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := platformv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b := fake.NewClientBuilder().WithScheme(scheme)
+	for _, o := range objs {
+		b = b.WithObjects(o)
+	}
+
+	// Only platform-admins may change the catalog
+	cs := kubefake.NewClientset()
+	cs.PrependReactor("create", "subjectaccessreviews", func(a k8stesting.Action) (bool, runtime.Object, error) {
+		sar := a.(k8stesting.CreateAction).GetObject().(*authzv1.SubjectAccessReview)
+		for _, g := range sar.Spec.Groups {
+			if g == "platform-admins" {
+				sar.Status.Allowed = true
+			}
+		}
+		return true, sar, nil
+	})
+
+	mux := http.NewServeMux()
+	New(b.Build(), cs, Options{UserHeader: "X-Forwarded-User", GroupsHeader: "X-Forwarded-Groups"}, zap.NewNop()).Register(mux)
+	return mux
+}
+
+func do(mux *http.ServeMux, method, path, body, groups string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-Forwarded-User", "alice")
+	req.Header.Set("X-Forwarded-Groups", groups)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestListFiltersCategoryAndDeprecated(t *testing.T) {
+	mux := newMux(t,
+		&platformv1alpha1.CatalogItem{ObjectMeta: metav1.ObjectMeta{Name: "postgres"}, Spec: platformv1alpha1.CatalogItemSpec{DisplayName: "PostgreSQL", Category: "database"}},
+		&platformv1alpha1.CatalogItem{ObjectMeta: metav1.ObjectMeta{Name: "mysql"}, Spec: platformv1alpha1.CatalogItemSpec{DisplayName: "MySQL", Category: "database", Deprecated: true}},
+		&platformv1alpha1.CatalogItem{ObjectMeta: metav1.ObjectMeta{Name: "redis"}, Spec: platformv1alpha1.CatalogItemSpec{DisplayName: "Redis", Category: "cache"}},
+	)
+
+	rec := do(mux, http.MethodGet, "/api/v1/catalog?category=database", "", "")
+	var resp struct{ Items []Item }
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if len(resp.Items) != 1 || resp.Items[0].Name != "postgres" {
+		t.Errorf("expected only postgres, got %+v", resp.Items)
+	}
+}
+
+func TestWriteRequiresAuthorization(t *testing.T) {
+	mux := newMux(t)
+	body := `{"name":"rabbitmq","display_name":"RabbitMQ","category":"queue","parameters":{"type":"object","properties":{"vhosts":{"type":"integer"}}}}`
+
+	if rec := do(mux, http.MethodPost, "/api/v1/catalog", body, "developers"); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", rec.Code)
+	}
+	if rec := do(mux, http.MethodPost, "/api/v1/catalog", body, "platform-admins"); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+
+	rec := do(mux, http.MethodGet, "/api/v1/catalog/rabbitmq", "", "")
+	var item Item
+	json.NewDecoder(rec.Body).Decode(&item)
+	if !strings.Contains(string(item.Parameters), "vhosts") {
+		t.Errorf("expected parameters schema to round-trip, got %s", item.Parameters)
+	}
+
+	update := `{"display_name":"RabbitMQ","category":"queue","deprecated":true}`
+	if rec := do(mux, http.MethodPut, "/api/v1/catalog/rabbitmq", update, "platform-admins"); rec.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(mux, http.MethodDelete, "/api/v1/catalog/rabbitmq", "", "platform-admins"); rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rec.Code)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []Item{
+		{Name: "Bad Name", DisplayName: "x", Category: "db"},
+		{Name: "pg", Category: "db"},
+		{Name: "pg", DisplayName: "x", Category: "db", Parameters: json.RawMessage(`["not","an","object"]`)},
+		{Name: "pg", DisplayName: "x", Category: "db", Parameters: json.RawMessage(`{"type":"string"}`)},
+	}
+	for _, item := range tests {
+		if err := validate(item); err == nil {
+			t.Errorf("expected validation error for %+v", item)
+		}
+	}
+}
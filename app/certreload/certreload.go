@@ -0,0 +1,134 @@
+// Package certreload serves TLS certificates from disk and reloads them in place
+// when they change (e.g. cert-manager rotating a mounted Secret).
+package certreload
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+var (
+	certExpiry = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tls_certificate_expiry_timestamp_seconds",
+		Help: "Unix time at which the currently served TLS certificate expires.",
+	}, []string{"cert_file"})
+	reloadsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tls_certificate_reloads_total",
+		Help: "TLS certificate reload attempts by result.",
+	}, []string{"cert_file", "result"})
+)
+
+// Reloader holds the current certificate and swaps it when the files change.
+type Reloader struct {
+	certFile string
+	keyFile  string
+	logger   *zap.Logger
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// New loads the initial certificate. It fails if the files cannot be parsed,
+// so a misconfigured pod never starts serving.
+func New(certFile, keyFile string, logger *zap.Logger) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// TLSConfig returns a server TLS config backed by this reloader.
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+}
+
+// Watch polls the certificate files until ctx is cancelled. Polling (rather than
+// inotify) survives the symlink swaps Kubernetes uses for Secret volumes.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := r.reload()
+			switch {
+			case err != nil:
+				reloadsTotal.WithLabelValues(r.certFile, "error").Inc()
+				r.logger.Error("tls certificate reload failed, keeping previous certificate",
+					zap.String("cert_file", r.certFile),
+					zap.Error(err),
+				)
+			case changed:
+				reloadsTotal.WithLabelValues(r.certFile, "success").Inc()
+			}
+		}
+	}
+}
+
+// reload re-reads the files and swaps the certificate if their contents changed.
+func (r *Reloader) reload() (bool, error) {
+	certPEM, err := os.ReadFile(r.certFile)
+	if err != nil {
+		return false, fmt.Errorf("read certificate: %w", err)
+	}
+	keyPEM, err := os.ReadFile(r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("read key: %w", err)
+	}
+
+	r.mu.RLock()
+	unchanged := bytes.Equal(certPEM, r.certPEM) && bytes.Equal(keyPEM, r.keyPEM)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false, fmt.Errorf("parse key pair: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return false, fmt.Errorf("parse leaf certificate: %w", err)
+	}
+	cert.Leaf = leaf
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.certPEM = certPEM
+	r.keyPEM = keyPEM
+	r.mu.Unlock()
+
+	certExpiry.WithLabelValues(r.certFile).Set(float64(leaf.NotAfter.Unix()))
+	r.logger.Info("tls certificate loaded",
+		zap.String("subject", leaf.Subject.String()),
+		zap.Time("not_after", leaf.NotAfter),
+	)
+	return true, nil
+}
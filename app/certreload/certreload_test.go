@@ -0,0 +1,84 @@
+package certreload
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func writeCert(t *testing.T, dir, cn string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "first")
+
+	r, err := New(certFile, keyFile, zap.NewNop())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	cert, _ := r.GetCertificate(nil)
+	if cert.Leaf.Subject.CommonName != "first" {
+		t.Errorf("expected CN 'first', got '%s'", cert.Leaf.Subject.CommonName)
+	}
+
+	// Unchanged files are not reloaded
+	if changed, err := r.reload(); err != nil || changed {
+		t.Errorf("expected no change, got changed=%v err=%v", changed, err)
+	}
+
+	// Rotated files are picked up
+	writeCert(t, dir, "second")
+	if changed, err := r.reload(); err != nil || !changed {
+		t.Fatalf("expected reload, got changed=%v err=%v", changed, err)
+	}
+	cert, _ = r.GetCertificate(nil)
+	if cert.Leaf.Subject.CommonName != "second" {
+		t.Errorf("expected CN 'second', got '%s'", cert.Leaf.Subject.CommonName)
+	}
+
+	// A broken rotation keeps the previous certificate
+	os.WriteFile(keyFile, []byte("garbage"), 0o600)
+	if _, err := r.reload(); err == nil {
+		t.Error("expected error for invalid key")
+	}
+	cert, _ = r.GetCertificate(nil)
+	if cert.Leaf.Subject.CommonName != "second" {
+		t.Errorf("expected previous certificate to be kept, got '%s'", cert.Leaf.Subject.CommonName)
+	}
+}
@@ -0,0 +1,153 @@
+// Package cgroup sizes the Go runtime to the container it runs in: it reads
+// the CPU and memory limits of the container's cgroup and derives
+// GOMAXPROCS and GOMEMLIMIT from them.
+//
+// The runtime sizes GOMAXPROCS to a CPU limit by itself since Go 1.25, but
+// rounds up and never goes below 2: with a limit of 1.5 CPUs, two threads
+// run Go code and the container is throttled for the rest of every CFS
+// period. Here the quota is rounded down, as automaxprocs does. The runtime
+// knows nothing of memory limits; without GOMEMLIMIT the heap grows until
+// the OOM killer ends the process instead of the GC working harder first.
+//
+// Only the container's own cgroup is read, through /sys/fs/cgroup as
+// mounted in its cgroup namespace: cgroup v2 (cpu.max, memory.max) or v1
+// (cpu.cfs_quota_us, memory.limit_in_bytes).
+package cgroup
+
+import (
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// Root is where the cgroup hierarchy is mounted.
+const Root = "/sys/fs/cgroup"
+
+// Limits are a container's limits and the runtime settings derived from
+// them. Zero means no limit, or a setting left alone.
+type Limits struct {
+	// CPUQuota is the CPU limit in CPUs, e.g. 1.5.
+	CPUQuota float64 `json:"cpu_quota,omitempty"`
+	// MemoryLimit is the memory limit in bytes.
+	MemoryLimit int64 `json:"memory_limit_bytes,omitempty"`
+
+	// GOMAXPROCS and GOMEMLIMIT are the values set, from the limits or
+	// from their environment variables.
+	GOMAXPROCS int   `json:"gomaxprocs"`
+	GOMEMLIMIT int64 `json:"gomemlimit_bytes,omitempty"`
+	// GOMAXPROCSSource and GOMEMLIMITSource are where they came from:
+	// "cgroup", "env" or "default".
+	GOMAXPROCSSource string `json:"gomaxprocs_source"`
+	GOMEMLIMITSource string `json:"gomemlimit_source"`
+}
+
+// Read returns the CPU and memory limits of the cgroup mounted at root.
+// Outside a cgroup, or without limits, both are zero.
+func Read(root string) (Limits, error) {
+	var l Limits
+	var err error
+	if _, statErr := os.Stat(filepath.Join(root, "cgroup.controllers")); statErr == nil {
+		l.CPUQuota, err = cpuV2(root)
+		if err == nil {
+			l.MemoryLimit, err = readLimit(filepath.Join(root, "memory.max"))
+		}
+	} else {
+		l.CPUQuota, err = cpuV1(filepath.Join(root, "cpu"))
+		if err == nil {
+			l.MemoryLimit, err = readLimit(filepath.Join(root, "memory", "memory.limit_in_bytes"))
+		}
+	}
+	return l, err
+}
+
+// cpuV2 reads cpu.max: "$MAX $PERIOD", MAX being "max" without a limit.
+func cpuV2(root string) (float64, error) {
+	fields, err := readFields(filepath.Join(root, "cpu.max"))
+	if err != nil || len(fields) != 2 || fields[0] == "max" {
+		return 0, err
+	}
+	return quota(fields[0], fields[1])
+}
+
+// cpuV1 reads cpu.cfs_quota_us, -1 without a limit, and cpu.cfs_period_us.
+func cpuV1(dir string) (float64, error) {
+	q, err := readFields(filepath.Join(dir, "cpu.cfs_quota_us"))
+	if err != nil || len(q) != 1 || q[0] == "-1" {
+		return 0, err
+	}
+	p, err := readFields(filepath.Join(dir, "cpu.cfs_period_us"))
+	if err != nil || len(p) != 1 {
+		return 0, err
+	}
+	return quota(q[0], p[0])
+}
+
+func quota(limit, period string) (float64, error) {
+	m, err := strconv.ParseFloat(limit, 64)
+	if err != nil {
+		return 0, err
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return 0, errors.New("invalid CPU period " + period)
+	}
+	return m / p, nil
+}
+
+// readLimit reads a memory limit in bytes: "max" in v2, and in v1 a page
+// aligned number near the largest int64 without a limit.
+func readLimit(path string) (int64, error) {
+	fields, err := readFields(path)
+	if err != nil || len(fields) != 1 || fields[0] == "max" {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || n >= math.MaxInt64/2 {
+		return 0, err
+	}
+	return n, nil
+}
+
+// readFields returns the fields of a cgroup file, or none if it does not
+// exist.
+func readFields(path string) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return strings.Fields(string(b)), err
+}
+
+// Apply sets GOMAXPROCS to the CPU quota rounded down (at least 1, at most
+// the CPUs there are) and GOMEMLIMIT to memoryRatio of the memory limit,
+// unless GOMAXPROCS or GOMEMLIMIT is set in the environment. It returns l
+// with the settings.
+func Apply(l Limits, memoryRatio float64) Limits {
+	l.GOMAXPROCSSource, l.GOMEMLIMITSource = "default", "default"
+	switch {
+	case os.Getenv("GOMAXPROCS") != "":
+		l.GOMAXPROCSSource = "env"
+	case l.CPUQuota > 0:
+		runtime.GOMAXPROCS(min(max(int(l.CPUQuota), 1), runtime.NumCPU()))
+		l.GOMAXPROCSSource = "cgroup"
+	}
+	l.GOMAXPROCS = runtime.GOMAXPROCS(0)
+
+	switch {
+	case os.Getenv("GOMEMLIMIT") != "":
+		l.GOMEMLIMITSource = "env"
+	case l.MemoryLimit > 0 && memoryRatio > 0:
+		debug.SetMemoryLimit(int64(float64(l.MemoryLimit) * min(memoryRatio, 1)))
+		l.GOMEMLIMITSource = "cgroup"
+	}
+	if limit := debug.SetMemoryLimit(-1); limit != math.MaxInt64 {
+		l.GOMEMLIMIT = limit
+	}
+	return l
+}
@@ -0,0 +1,66 @@
+package cgroup
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	write := func(root string, files map[string]string) string {
+		for name, content := range files {
+			path := filepath.Join(root, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return root
+	}
+	for _, tc := range []struct {
+		name  string
+		files map[string]string
+		want  Limits
+	}{
+		{"v2", map[string]string{
+			"cgroup.controllers": "cpu memory\n",
+			"cpu.max":            "150000 100000\n",
+			"memory.max":         "536870912\n",
+		}, Limits{CPUQuota: 1.5, MemoryLimit: 512 << 20}},
+		{"v2 unlimited", map[string]string{
+			"cgroup.controllers": "cpu memory\n",
+			"cpu.max":            "max 100000\n",
+			"memory.max":         "max\n",
+		}, Limits{}},
+		{"v1", map[string]string{
+			"cpu/cpu.cfs_quota_us":              "200000\n",
+			"cpu/cpu.cfs_period_us":             "100000\n",
+			"memory/memory.limit_in_bytes":      "1073741824\n",
+			"memory/memory.usage_in_bytes":      "1024\n",
+			"cpu/cpu.shares":                    "1024\n",
+			"memory/memory.soft_limit_in_bytes": "9223372036854771712\n",
+		}, Limits{CPUQuota: 2, MemoryLimit: 1 << 30}},
+		{"v1 unlimited", map[string]string{
+			"cpu/cpu.cfs_quota_us":         "-1\n",
+			"cpu/cpu.cfs_period_us":        "100000\n",
+			"memory/memory.limit_in_bytes": "9223372036854771712\n",
+		}, Limits{}},
+		{"no cgroup", nil, Limits{}},
+	} {
+		got, err := Read(write(t.TempDir(), tc.files))
+		if err != nil || got != tc.want {
+			t.Errorf("%s: %+v, %v; want %+v", tc.name, got, err, tc.want)
+		}
+	}
+
+	// Settings in the environment win over the limits
+	t.Setenv("GOMAXPROCS", "3")
+	t.Setenv("GOMEMLIMIT", "100MiB")
+	l := Apply(Limits{CPUQuota: 1, MemoryLimit: 1 << 30}, 0.9)
+	if l.GOMAXPROCSSource != "env" || l.GOMEMLIMITSource != "env" || l.GOMAXPROCS != runtime.GOMAXPROCS(0) {
+		t.Errorf("with env: %+v", l)
+	}
+}
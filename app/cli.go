@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/config"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/dev"
+)
+
+// newRootCommand returns the platform-api command. Without a subcommand it
+// runs the mode RUN_MODE selects, as the binary did before it had
+// subcommands; every mode loads its configuration from the environment.
+func newRootCommand() *cobra.Command {
+	var mode string
+	var migrate bool
+	root := &cobra.Command{
+		Use:   "platform-api",
+		Short: "Kubernetes platform API service",
+		Long: `Kubernetes platform API service.
+
+Configuration is read from environment variables (see docs/architecture.md).
+Without a subcommand, the service runs the mode RUN_MODE selects.`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			if migrate {
+				mode = config.ModeMigrate
+			}
+			run(mode)
+		},
+	}
+	root.CompletionOptions.DisableDefaultCmd = true
+	root.Flags().StringVar(&mode, "mode", "", "run mode: api, controller, migrate or verify-audit (overrides RUN_MODE)")
+	root.Flags().BoolVar(&migrate, "migrate", false, "apply pending database migrations and exit")
+	root.Flags().MarkDeprecated("mode", "use a subcommand instead, e.g. platform-api controller")
+	root.Flags().MarkDeprecated("migrate", "use platform-api migrate instead")
+	devFlag(root)
+
+	serve := modeCommand("serve", config.ModeAPI, "Serve the public API",
+		"Serves the public API, plus the admin listener and whatever else the\nconfiguration enables, until SIGINT or SIGTERM.\n\nWith --dev, it needs nothing else running: the store and event bus are\nin memory, the cluster is a fake one with sample data, requests without\nan identity are the developer's, and /explorer sends requests to the API.\nSettings already in the environment are kept.")
+	devFlag(serve)
+
+	root.AddCommand(
+		serve,
+		modeCommand("controller", config.ModeController, "Run only the controllers",
+			"Runs the controller manager and the admin listener, without the public\nAPI, so the reconcile plane scales independently of the API plane."),
+		modeCommand("migrate", config.ModeMigrate, "Apply pending database migrations and exit",
+			"Applies pending database migrations and exits, for a Job or init\ncontainer ahead of a rollout. Requires STORE_BACKEND=postgres."),
+		modeCommand("verify-audit", config.ModeVerifyAudit, "Verify the audit log's hash chain and exit",
+			"Verifies the audit log's hash chain and exits non-zero if it is broken,\nfor a scheduled compliance check. Requires STORE_BACKEND=postgres."),
+		newValidateConfigCommand(),
+		newVersionCommand(),
+	)
+	return root
+}
+
+// devFlag adds --dev to cmd, which applies the dev defaults the
+// environment leaves unset before cmd runs.
+func devFlag(cmd *cobra.Command) {
+	var enabled bool
+	cmd.Flags().BoolVar(&enabled, "dev", false, "run with no external dependencies: memory store, fake cluster with sample data, permissive auth and the API explorer")
+	cmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+		if !enabled {
+			return nil
+		}
+		set, err := dev.UseDefaults()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "dev mode: never expose this instance; defaulted %s\n", strings.Join(set, ", "))
+		return nil
+	}
+}
+
+// modeCommand returns the subcommand that runs mode.
+func modeCommand(name, mode, short, long string) *cobra.Command {
+	return &cobra.Command{
+		Use:   name,
+		Short: short,
+		Long:  long,
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			run(mode)
+		},
+	}
+}
+
+// newValidateConfigCommand returns the validate-config subcommand, which
+// checks the configuration in the environment without starting anything,
+// e.g. in CI before a rollout.
+func newValidateConfigCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate-config",
+		Short: "Check the configuration and exit",
+		Long: `Checks the configuration in the environment the way serve does before
+starting, and reports every problem found rather than the first. Settings
+that do not parse are reported too; at startup they fall back to their
+defaults with a warning. Exits non-zero if any problem is found.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := config.Load()
+			errs := cfg.Malformed()
+			if err := cfg.Validate(); err != nil {
+				errs = append(errs, err)
+			}
+			if len(errs) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "configuration is valid")
+				return nil
+			}
+			for _, err := range errs {
+				fmt.Fprintln(cmd.ErrOrStderr(), err)
+			}
+			return errors.New("invalid configuration")
+		},
+	}
+}
+
+// newVersionCommand returns the version subcommand, which prints the
+// service version and what the binary was built from.
+func newVersionCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Print the version and build information",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg := config.Load()
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "%s %s\n", cfg.ServiceName, cfg.Version)
+			build, ok := debug.ReadBuildInfo()
+			if !ok {
+				return
+			}
+			fmt.Fprintf(out, "go: %s\n", build.GoVersion)
+			for _, s := range build.Settings {
+				switch s.Key {
+				case "vcs.revision", "vcs.time", "vcs.modified":
+					fmt.Fprintf(out, "%s: %s\n", s.Key, s.Value)
+				}
+			}
+		},
+	}
+}
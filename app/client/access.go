@@ -0,0 +1,155 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Me is the caller as the API sees it: identity, roles and the
+// permissions they grant.
+type Me struct {
+	User        string   `json:"user"`
+	Groups      []string `json:"groups"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
+// Role is a named set of permissions.
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Permissions []string `json:"permissions"`
+}
+
+// RoleAssignment grants a role to a user or to the members of a group.
+type RoleAssignment struct {
+	ID string `json:"id,omitempty"`
+	// SubjectKind is "user" or "group".
+	SubjectKind string    `json:"subject_kind"`
+	Subject     string    `json:"subject"`
+	Role        string    `json:"role"`
+	CreatedBy   string    `json:"created_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// APIToken is a personal access token. The secret is only returned by
+// CreateToken.
+type APIToken struct {
+	ID         string     `json:"id"`
+	Owner      string     `json:"owner"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// NewAPIToken is a token just created, with its secret.
+type NewAPIToken struct {
+	APIToken
+	Secret string `json:"secret"`
+}
+
+// AccessCheck asks whether the caller may perform a Kubernetes verb.
+type AccessCheck struct {
+	Verb        string `json:"verb"`
+	Group       string `json:"group,omitempty"`
+	Resource    string `json:"resource"`
+	Subresource string `json:"subresource,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+	Name        string `json:"name,omitempty"`
+}
+
+// AccessResult answers an AccessCheck.
+type AccessResult struct {
+	AccessCheck
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Me returns the caller's identity and permissions.
+func (c *Client) Me(ctx context.Context) (*Me, error) {
+	var me Me
+	if err := c.do(ctx, call{method: http.MethodGet, path: path("rbac", "me")}, &me); err != nil {
+		return nil, err
+	}
+	return &me, nil
+}
+
+// Roles lists the roles.
+func (c *Client) Roles(ctx context.Context) ([]Role, error) {
+	var resp struct {
+		Items []Role `json:"items"`
+	}
+	err := c.do(ctx, call{method: http.MethodGet, path: path("rbac", "roles")}, &resp)
+	return resp.Items, err
+}
+
+// RoleAssignments lists the role assignments, of one subject if
+// subjectKind and subject are set.
+func (c *Client) RoleAssignments(ctx context.Context, subjectKind, subject string) ([]RoleAssignment, error) {
+	var resp struct {
+		Items []RoleAssignment `json:"items"`
+	}
+	q := query("subject_kind", subjectKind, "subject", subject)
+	err := c.do(ctx, call{method: http.MethodGet, path: path("rbac", "assignments"), query: q}, &resp)
+	return resp.Items, err
+}
+
+// AssignRole grants role to a user or group (subjectKind "user" or
+// "group").
+func (c *Client) AssignRole(ctx context.Context, subjectKind, subject, role string) (*RoleAssignment, error) {
+	body := RoleAssignment{SubjectKind: subjectKind, Subject: subject, Role: role}
+	var a RoleAssignment
+	if err := c.do(ctx, call{method: http.MethodPost, path: path("rbac", "assignments"), body: body}, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// DeleteRoleAssignment revokes a role assignment.
+func (c *Client) DeleteRoleAssignment(ctx context.Context, id string) error {
+	return c.do(ctx, call{method: http.MethodDelete, path: path("rbac", "assignments", id)}, nil)
+}
+
+// Tokens lists the caller's personal access tokens.
+func (c *Client) Tokens(ctx context.Context) ([]APIToken, error) {
+	var resp struct {
+		Items []APIToken `json:"items"`
+	}
+	err := c.do(ctx, call{method: http.MethodGet, path: path("tokens")}, &resp)
+	return resp.Items, err
+}
+
+// CreateToken creates a personal access token limited to scopes, valid
+// for expiresIn (0 means the server's default). The secret is returned
+// only here.
+func (c *Client) CreateToken(ctx context.Context, name string, scopes []string, expiresIn time.Duration) (*NewAPIToken, error) {
+	body := map[string]any{"name": name, "scopes": scopes}
+	if expiresIn > 0 {
+		body["expires_in"] = expiresIn.String()
+	}
+	var tok NewAPIToken
+	if err := c.do(ctx, call{method: http.MethodPost, path: path("tokens"), body: body}, &tok); err != nil {
+		return nil, err
+	}
+	return &tok, nil
+}
+
+// RevokeToken revokes one of the caller's tokens.
+func (c *Client) RevokeToken(ctx context.Context, id string) error {
+	return c.do(ctx, call{method: http.MethodDelete, path: path("tokens", id)}, nil)
+}
+
+// CheckAccess asks the cluster whether the caller may perform each check.
+func (c *Client) CheckAccess(ctx context.Context, checks ...AccessCheck) ([]AccessResult, error) {
+	body := map[string]any{"checks": checks}
+	var resp struct {
+		Results []AccessResult `json:"results"`
+	}
+	err := c.do(ctx, call{method: http.MethodPost, path: path("authz", "check"), body: body}, &resp)
+	return resp.Results, err
+}
@@ -0,0 +1,198 @@
+package client
+
+import (
+	"context"
+	"io"
+	"iter"
+	"net/http"
+	"time"
+)
+
+// DrainRequest tunes a node drain.
+type DrainRequest struct {
+	// Force evicts pods that no controller will recreate.
+	Force bool `json:"force"`
+	// DeleteEmptyDirData evicts pods using emptyDir volumes, losing the
+	// data.
+	DeleteEmptyDirData bool `json:"delete_emptydir_data"`
+}
+
+// Drain is the progress of a node drain.
+type Drain struct {
+	Node   string `json:"node"`
+	User   string `json:"user"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Pods   []struct {
+		Namespace string `json:"namespace"`
+		Name      string `json:"name"`
+		Status    string `json:"status"`
+		Message   string `json:"message,omitempty"`
+	} `json:"pods"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// WebhookKey signs outgoing webhook deliveries.
+type WebhookKey struct {
+	ID        string     `json:"id"`
+	Algorithm string     `json:"algorithm"`
+	PublicKey string     `json:"public_key,omitempty"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RetiresAt *time.Time `json:"retires_at,omitempty"`
+}
+
+// NewWebhookKey is a key just rotated in, with the HMAC secret receivers
+// verify with (empty for Ed25519 keys).
+type NewWebhookKey struct {
+	WebhookKey
+	Secret string `json:"secret,omitempty"`
+}
+
+// AuditReport is the result of verifying the audit log's hash chain.
+type AuditReport struct {
+	Valid    bool   `json:"valid"`
+	Checked  int64  `json:"checked"`
+	HeadSeq  int64  `json:"head_seq"`
+	HeadHash string `json:"head_hash,omitempty"`
+	// Break is where the chain is broken, if it is.
+	Break *struct {
+		Seq    int64  `json:"seq"`
+		Reason string `json:"reason"`
+		Detail string `json:"detail"`
+	} `json:"break,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+// ImportResult reports an import.
+type ImportResult struct {
+	DryRun bool           `json:"dry_run"`
+	Format string         `json:"format,omitempty"`
+	Counts map[string]int `json:"counts,omitempty"`
+	// Errors lists the problems that prevented the import.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Cordon marks a node unschedulable.
+func (c *Client) Cordon(ctx context.Context, node string) error {
+	return c.do(ctx, call{method: http.MethodPost, path: path("admin", "nodes", node, "cordon")}, nil)
+}
+
+// Uncordon marks a node schedulable again.
+func (c *Client) Uncordon(ctx context.Context, node string) error {
+	return c.do(ctx, call{method: http.MethodPost, path: path("admin", "nodes", node, "uncordon")}, nil)
+}
+
+// StartDrain cordons a node and starts evicting its pods. If a drain of
+// the node is already running, the error is a conflict and the returned
+// drain is the running one.
+func (c *Client) StartDrain(ctx context.Context, node string, req DrainRequest) (*Drain, error) {
+	var d Drain
+	err := c.do(ctx, call{method: http.MethodPost, path: path("admin", "nodes", node, "drain"), body: req}, &d)
+	if err != nil && !(IsConflict(err) && errorBody(err, &d)) {
+		return nil, err
+	}
+	return &d, err
+}
+
+// Drain returns the progress of a node's latest drain.
+func (c *Client) Drain(ctx context.Context, node string) (*Drain, error) {
+	var d Drain
+	if err := c.do(ctx, call{method: http.MethodGet, path: path("admin", "nodes", node, "drain")}, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// FollowDrain iterates over the progress of a node's latest drain as it
+// changes, until the drain finishes or ctx is done.
+func (c *Client) FollowDrain(ctx context.Context, node string) iter.Seq2[Drain, error] {
+	return lines[Drain](c.stream(ctx, call{
+		method: http.MethodGet,
+		path:   path("admin", "nodes", node, "drain"),
+		query:  query("follow", "true"),
+	}))
+}
+
+// CancelDrain stops a running drain. Pods already evicted stay evicted and
+// the node stays cordoned.
+func (c *Client) CancelDrain(ctx context.Context, node string) error {
+	return c.do(ctx, call{method: http.MethodDelete, path: path("admin", "nodes", node, "drain")}, nil)
+}
+
+// WebhookKeys lists the webhook signing keys.
+func (c *Client) WebhookKeys(ctx context.Context) ([]WebhookKey, error) {
+	var resp struct {
+		Items []WebhookKey `json:"items"`
+	}
+	err := c.do(ctx, call{method: http.MethodGet, path: path("admin", "webhooks", "keys")}, &resp)
+	return resp.Items, err
+}
+
+// RotateWebhookKey creates a signing key with algorithm ("hmac-sha256",
+// "ed25519" or empty for the configured one). The previous key keeps
+// signing until it retires.
+func (c *Client) RotateWebhookKey(ctx context.Context, algorithm string) (*NewWebhookKey, error) {
+	body := map[string]string{"algorithm": algorithm}
+	var key NewWebhookKey
+	if err := c.do(ctx, call{method: http.MethodPost, path: path("admin", "webhooks", "keys", "rotate"), body: body}, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// VerifyAudit verifies the audit log's hash chain.
+func (c *Client) VerifyAudit(ctx context.Context) (*AuditReport, error) {
+	var report AuditReport
+	if err := c.do(ctx, call{method: http.MethodGet, path: path("admin", "audit", "verify")}, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// ReencryptCredentials reseals the stored credentials with the current
+// master key. With the job queue enabled it queues the work and returns
+// the job; otherwise it reseals them at once and returns how many.
+func (c *Client) ReencryptCredentials(ctx context.Context) (*QueueJob, int, error) {
+	var resp struct {
+		QueueJob
+		Resealed int `json:"resealed"`
+	}
+	if err := c.do(ctx, call{method: http.MethodPost, path: path("admin", "credentials", "reencrypt")}, &resp); err != nil {
+		return nil, 0, err
+	}
+	if resp.ID == "" {
+		return nil, resp.Resealed, nil
+	}
+	return &resp.QueueJob, 0, nil
+}
+
+// Export streams an archive (tar.gz) of the platform's data, with tables
+// as format "json" or "csv" (empty means json). The caller closes it.
+func (c *Client) Export(ctx context.Context, format string) (io.ReadCloser, error) {
+	return c.stream(ctx, call{
+		method: http.MethodGet,
+		path:   path("admin", "export"),
+		query:  query("format", format),
+		header: http.Header{"Accept": {"application/gzip"}},
+	})
+}
+
+// Import loads an archive written by Export, all or nothing. A dry run
+// checks the archive and rolls back. When the archive is refused, the
+// result lists the problems alongside the error.
+func (c *Client) Import(ctx context.Context, archive io.Reader, dryRun bool) (*ImportResult, error) {
+	var res ImportResult
+	err := c.do(ctx, call{
+		method: http.MethodPost,
+		path:   path("admin", "import"),
+		query:  query("dry_run", formatBool(dryRun)),
+		body:   archive,
+		header: http.Header{"Content-Type": {"application/gzip"}},
+	}, &res)
+	if err != nil && !errorBody(err, &res) {
+		return nil, err
+	}
+	return &res, err
+}
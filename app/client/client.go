@@ -0,0 +1,374 @@
+// Package client is the Go client for the platform API, for services that
+// call it instead of hand-rolling HTTP requests. Every endpoint has a typed
+// method taking a context; lists that page have an iterator over all their
+// items. Requests go through package httpclient, so they get its retries,
+// circuit breaking and metrics. POSTs carry a generated Idempotency-Key,
+// which lets them be retried as well.
+//
+// The response types are the client's own rather than the serving
+// packages', so depending on the client does not link the server.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/httpclient"
+)
+
+// Client calls the platform API. It is safe for concurrent use.
+type Client struct {
+	baseURL string
+	http    *http.Client
+	header  http.Header
+	timeout time.Duration
+}
+
+// Option configures a Client.
+type Option func(*options)
+
+type options struct {
+	http      httpclient.Options
+	transport http.RoundTripper
+	logger    *zap.Logger
+	header    http.Header
+}
+
+// WithToken authenticates with a static bearer token, such as a personal
+// access token from POST /api/v1/tokens.
+func WithToken(token string) Option {
+	return WithTokenSource(staticToken(token))
+}
+
+// WithTokenSource authenticates with bearer tokens from ts, e.g. an
+// httpclient.ClientCredentials source for service-to-service calls.
+func WithTokenSource(ts httpclient.TokenSource) Option {
+	return func(o *options) { o.http.Auth = ts }
+}
+
+// WithIdentity sends the caller's identity in the headers an authenticating
+// proxy would set, for callers inside the trust boundary that the API
+// accepts them from.
+func WithIdentity(user string, groups ...string) Option {
+	return func(o *options) {
+		o.header.Set("X-Forwarded-User", user)
+		if len(groups) > 0 {
+			o.header.Set("X-Forwarded-Groups", strings.Join(groups, ","))
+		}
+	}
+}
+
+// WithHeader sends a header with every request.
+func WithHeader(key, value string) Option {
+	return func(o *options) { o.header.Set(key, value) }
+}
+
+// WithUserAgent names the calling service in the User-Agent header.
+func WithUserAgent(ua string) Option {
+	return WithHeader("User-Agent", ua)
+}
+
+// WithRetries sets the number of extra attempts for requests that are safe
+// to repeat (default 2).
+func WithRetries(n int) Option {
+	return func(o *options) { o.http.Retries = n }
+}
+
+// WithTimeout bounds each call, retries included (default 30s; 0 means no
+// limit). Streams, such as followed logs, are bounded only by their
+// context.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) { o.http.Timeout = d }
+}
+
+// WithHTTPOptions replaces the connection, retry and circuit breaker
+// settings. Set it before WithRetries, WithTimeout or WithTokenSource,
+// which change single fields of it.
+func WithHTTPOptions(opts httpclient.Options) Option {
+	return func(o *options) { o.http = opts }
+}
+
+// WithTransport sends requests through rt instead of a pooled transport
+// built from the HTTP options; retries and circuit breaking still apply.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(o *options) { o.transport = rt }
+}
+
+// WithLogger logs retries to logger.
+func WithLogger(logger *zap.Logger) Option {
+	return func(o *options) { o.logger = logger }
+}
+
+// New creates a client for the platform API at baseURL, such as
+// http://platform-api.platform.svc:8080.
+func New(baseURL string, opts ...Option) *Client {
+	o := options{
+		http:   httpclient.DefaultOptions(),
+		logger: zap.NewNop(),
+		header: make(http.Header),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	base := o.transport
+	if base == nil {
+		base = httpclient.NewTransport(o.http)
+	}
+	if o.header.Get("User-Agent") == "" {
+		o.header.Set("User-Agent", "platform-api-client")
+	}
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		// The timeout is applied per call so it does not cut streams short
+		http:    &http.Client{Transport: httpclient.Wrap("platform-api", base, o.http, o.logger)},
+		header:  o.header,
+		timeout: o.http.Timeout,
+	}
+}
+
+// Cluster returns a client whose cluster-scoped calls (workloads, nodes,
+// events, budgets) go to the named cluster instead of the local one. It
+// selects the cluster with the X-Cluster header, the default
+// KUBE_CLUSTER_HEADER.
+func (c *Client) Cluster(name string) *Client {
+	cc := *c
+	cc.header = c.header.Clone()
+	cc.header.Set("X-Cluster", name)
+	return &cc
+}
+
+// staticToken is a TokenSource for a fixed token.
+type staticToken string
+
+func (t staticToken) Token(context.Context) (string, error) { return string(t), nil }
+func (staticToken) Invalidate(string)                       {}
+
+// Error is a response with a status other than 2xx.
+type Error struct {
+	StatusCode int
+	// Message is the error the API gave, from a problem detail, an "error"
+	// field or the plain text body.
+	Message   string
+	RequestID string
+	// Body is the raw response body. Some conflicts carry the resource in
+	// the way, e.g. the lock's current holder.
+	Body []byte
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("platform api: status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("platform api: status %d: %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound reports whether err is a 404 response.
+func IsNotFound(err error) bool { return hasStatus(err, http.StatusNotFound) }
+
+// IsConflict reports whether err is a 409 response, such as a stale
+// resource version or a lock held by someone else.
+func IsConflict(err error) bool { return hasStatus(err, http.StatusConflict) }
+
+// IsForbidden reports whether err is a 403 response.
+func IsForbidden(err error) bool { return hasStatus(err, http.StatusForbidden) }
+
+func hasStatus(err error, status int) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == status
+}
+
+// call is one request to the API.
+type call struct {
+	method string
+	path   string
+	query  url.Values
+	body   any
+	header http.Header
+}
+
+// do sends req and decodes the JSON response into out (if not nil).
+func (c *Client) do(ctx context.Context, req call, out any) error {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("platform api: decoding %s %s: %w", req.method, req.path, err)
+	}
+	return nil
+}
+
+// stream sends req and returns the response body for the caller to read
+// and close.
+func (c *Client) stream(ctx context.Context, req call) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// send sends req, turning responses other than 2xx into an *Error.
+func (c *Client) send(ctx context.Context, req call) (*http.Response, error) {
+	u := c.baseURL + req.path
+	if len(req.query) > 0 {
+		u += "?" + req.query.Encode()
+	}
+	var body io.Reader
+	if req.body != nil {
+		switch b := req.body.(type) {
+		case io.Reader:
+			body = b
+		default:
+			buf, err := json.Marshal(b)
+			if err != nil {
+				return nil, err
+			}
+			body = bytes.NewReader(buf)
+		}
+	}
+	r, err := http.NewRequestWithContext(ctx, req.method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.header {
+		r.Header[k] = v
+	}
+	for k, v := range req.header {
+		r.Header[k] = v
+	}
+	if r.Header.Get("Accept") == "" {
+		r.Header.Set("Accept", "application/json")
+	}
+	if _, ok := req.body.(io.Reader); !ok && req.body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if req.method == http.MethodPost && r.Header.Get("Idempotency-Key") == "" {
+		r.Header.Set("Idempotency-Key", uuid.NewString())
+	}
+
+	resp, err := c.http.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, readError(resp)
+	}
+	return resp, nil
+}
+
+// readError builds the *Error for resp. The API answers in plain text,
+// with {"error": "..."} or, for access denials, with a problem detail
+// (RFC 9457).
+func readError(resp *http.Response) *Error {
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	e := &Error{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get("X-Request-ID"),
+		Body:       raw,
+	}
+	var body struct {
+		Error  string `json:"error"`
+		Detail string `json:"detail"`
+		Title  string `json:"title"`
+	}
+	ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case json.Unmarshal(raw, &body) != nil:
+		e.Message = strings.TrimSpace(string(raw))
+	case ct == "application/problem+json" && body.Detail != "":
+		e.Message = body.Detail
+	case ct == "application/problem+json":
+		e.Message = body.Title
+	case body.Error != "":
+		e.Message = body.Error
+	}
+	return e
+}
+
+// errorBody decodes the body of err, an *Error, into out, for endpoints
+// that describe a refusal in their usual response shape: a lock held by
+// someone else, an import's problems. It reports whether there was such
+// a body.
+func errorBody(err error, out any) bool {
+	var e *Error
+	return errors.As(err, &e) && json.Unmarshal(e.Body, out) == nil
+}
+
+// lines decodes a stream of JSON values, one per line, from rc.
+func lines[T any](rc io.ReadCloser, err error) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer rc.Close()
+		sc := bufio.NewScanner(rc)
+		sc.Buffer(nil, 1<<20)
+		for sc.Scan() {
+			if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+				continue
+			}
+			var v T
+			if err := json.Unmarshal(sc.Bytes(), &v); err != nil {
+				yield(zero, err)
+				return
+			}
+			if !yield(v, nil) {
+				return
+			}
+		}
+		if err := sc.Err(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
+
+// path joins escaped segments onto /api/v1.
+func path(segments ...string) string {
+	var b strings.Builder
+	b.WriteString("/api/v1")
+	for _, s := range segments {
+		b.WriteByte('/')
+		b.WriteString(url.PathEscape(s))
+	}
+	return b.String()
+}
+
+// query builds query parameters from key, value pairs, leaving out empty
+// values.
+func query(kv ...string) url.Values {
+	q := make(url.Values)
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] != "" {
+			q.Set(kv[i], kv[i+1])
+		}
+	}
+	return q
+}
@@ -0,0 +1,239 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/resources"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+func TestTenantsAgainstServer(t *testing.T) {
+	mux := http.NewServeMux()
+	resources.New(store.NewMemory(), resources.Options{
+		UserHeader:   "X-Forwarded-User",
+		GroupsHeader: "X-Forwarded-Groups",
+		AdminGroups:  []string{"platform-admins"},
+	}, zap.NewNop()).Register(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	ctx := context.Background()
+
+	if _, err := New(srv.URL, WithIdentity("bob", "developers")).Tenants().Create(ctx, &Tenant{Name: "payments"}); !IsForbidden(err) {
+		t.Fatalf("expected writes outside the admin groups to be forbidden, got %v", err)
+	}
+
+	c := New(srv.URL, WithIdentity("alice", "platform-admins"))
+	tenants := c.Tenants()
+	var created []*Tenant
+	for _, name := range []string{"payments", "search", "billing"} {
+		tenant, err := tenants.Create(ctx, &Tenant{Name: name, DisplayName: name, Owner: "team-" + name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		created = append(created, tenant)
+	}
+	if created[0].ID == "" || created[0].ResourceVersion != "1" {
+		t.Fatalf("expected the tenant created at version 1, got %+v", created[0])
+	}
+
+	page, err := tenants.List(ctx, nil, ListOptions{Limit: 1})
+	if err != nil || len(page.Items) != 1 || page.Continue == "" {
+		t.Fatalf("expected a first page of one with a continue token, got %+v %v", page, err)
+	}
+	var names []string
+	for tenant, err := range tenants.All(ctx, nil) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, tenant.Name)
+	}
+	if len(names) != 3 {
+		t.Errorf("expected All to return every tenant, got %v", names)
+	}
+
+	tenant := created[0]
+	tenant.DisplayName = "Payments & Billing"
+	updated, err := tenants.Update(ctx, tenant.ID, tenant)
+	if err != nil || updated.ResourceVersion != "2" {
+		t.Fatalf("expected the update at version 2, got %+v %v", updated, err)
+	}
+	if _, err := tenants.Update(ctx, tenant.ID, tenant); !IsConflict(err) {
+		t.Errorf("expected a stale update to conflict, got %v", err)
+	}
+	if err := tenants.Delete(ctx, tenant.ID, "1"); !IsConflict(err) {
+		t.Errorf("expected a stale delete to conflict, got %v", err)
+	}
+	if err := tenants.Delete(ctx, tenant.ID, updated.ResourceVersion); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tenants.Get(ctx, tenant.ID); !IsNotFound(err) {
+		t.Errorf("expected the deleted tenant to be gone, got %v", err)
+	}
+	history, err := c.TenantHistory(ctx, tenant.ID)
+	if err != nil || len(history) != 3 {
+		t.Errorf("expected the create, update and delete in the history, got %+v %v", history, err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+	}{
+		{"plain text", "text/plain; charset=utf-8", "tenant not found\n", "tenant not found"},
+		{"error field", "application/json", `{"error":"idempotency key reused"}`, "idempotency key reused"},
+		{"problem detail", "application/problem+json", `{"title":"Forbidden","status":403,"detail":"missing permission tenants:write"}`, "missing permission tenants:write"},
+		{"problem title", "application/problem+json", `{"title":"Forbidden","status":403}`, "Forbidden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Header().Set("X-Request-Id", "req-1")
+				w.WriteHeader(http.StatusForbidden)
+				io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+
+			_, err := New(srv.URL).Me(context.Background())
+			e, ok := err.(*Error)
+			if !ok || e.StatusCode != http.StatusForbidden || e.Message != tt.want || e.RequestID != "req-1" {
+				t.Fatalf("expected a 403 with %q, got %#v", tt.want, err)
+			}
+			if !IsForbidden(fmt.Errorf("wrapped: %w", err)) {
+				t.Error("expected IsForbidden to see through wrapping")
+			}
+		})
+	}
+}
+
+func TestRequestHeaders(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"user":"ci"}`)
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	c := New(srv.URL, WithToken("pat_secret"), WithUserAgent("deployer/1.0"))
+	if _, err := c.Cluster("eu-west").Me(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("Authorization") != "Bearer pat_secret" || got.Get("User-Agent") != "deployer/1.0" || got.Get("X-Cluster") != "eu-west" {
+		t.Errorf("expected the token, user agent and cluster headers, got %v", got)
+	}
+	if got.Get("Idempotency-Key") != "" {
+		t.Error("expected no idempotency key on a GET")
+	}
+	if _, err := c.Me(ctx); err != nil || got.Get("X-Cluster") != "" {
+		t.Errorf("expected Cluster to leave the original client alone, got %v %v", got, err)
+	}
+
+	c = New(srv.URL, WithIdentity("alice", "developers", "oncall"))
+	if _, err := c.CreateToken(ctx, "ci", []string{"tenants:read"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("X-Forwarded-User") != "alice" || got.Get("X-Forwarded-Groups") != "developers,oncall" {
+		t.Errorf("expected the identity headers, got %v", got)
+	}
+	if got.Get("Idempotency-Key") == "" || got.Get("Content-Type") != "application/json" {
+		t.Errorf("expected a POST with a JSON body and an idempotency key, got %v", got)
+	}
+}
+
+func TestRetriesPostWithSameIdempotencyKey(t *testing.T) {
+	var calls atomic.Int32
+	keys := make(chan string, 3)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys <- r.Header.Get("Idempotency-Key")
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var body struct{ Template string }
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(Job{Name: "migrate-x1", Template: body.Template})
+	}))
+	defer srv.Close()
+
+	job, err := New(srv.URL).SubmitJob(context.Background(), "payments", "db-migrate", nil)
+	if err != nil || job.Template != "db-migrate" {
+		t.Fatalf("expected the job after a retry, got %+v %v", job, err)
+	}
+	if first, second := <-keys, <-keys; calls.Load() != 2 || first == "" || first != second {
+		t.Errorf("expected 2 attempts with the same key, got %d: %q %q", calls.Load(), first, second)
+	}
+}
+
+func TestLockConflictReturnsHolder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(Lock{Name: "deploy-payments", Holder: "pipeline-41"})
+	}))
+	defer srv.Close()
+
+	lock, err := New(srv.URL).AcquireLock(context.Background(), "deploy-payments", "pipeline-42", time.Minute)
+	if !IsConflict(err) || lock == nil || lock.Holder != "pipeline-41" {
+		t.Fatalf("expected a conflict naming the holder, got %+v %v", lock, err)
+	}
+}
+
+func TestFollowDrain(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/admin/nodes/node-1/drain" || r.URL.Query().Get("follow") != "true" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for _, status := range []string{"running", "running", "succeeded"} {
+			json.NewEncoder(w).Encode(Drain{Node: "node-1", Status: status})
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer srv.Close()
+
+	var statuses []string
+	for d, err := range New(srv.URL).FollowDrain(context.Background(), "node-1") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		statuses = append(statuses, d.Status)
+	}
+	if strings.Join(statuses, ",") != "running,running,succeeded" {
+		t.Errorf("expected every progress update, got %v", statuses)
+	}
+
+	for _, err := range New(srv.URL).FollowDrain(context.Background(), "node/2") {
+		if !IsNotFound(err) {
+			t.Errorf("expected the error from the request, got %v", err)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	q := query("namespace", "payments", "label_selector", "", "freshness", "cached")
+	if q.Encode() != (url.Values{"namespace": {"payments"}, "freshness": {"cached"}}).Encode() {
+		t.Errorf("expected empty values left out, got %v", q)
+	}
+	if p := path("locks", "deploy/payments"); p != "/api/v1/locks/deploy%2Fpayments" {
+		t.Errorf("expected escaped segments, got %s", p)
+	}
+}
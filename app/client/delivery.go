@@ -0,0 +1,374 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Presigned is a URL granting one operation on one object in the object
+// store.
+type Presigned struct {
+	Key       string    `json:"key"`
+	Method    string    `json:"method"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// RenderRequest selects a kustomize overlay to render.
+type RenderRequest struct {
+	Repository string `json:"repository"`
+	Ref        string `json:"ref"`
+	// Path is the overlay directory, relative to the repository root.
+	Path string `json:"path"`
+	// Namespace is the deployment target, assumed for resources that set
+	// none when checking the policy.
+	Namespace string `json:"namespace"`
+	// Store keeps the manifests in the object store and returns a
+	// download URL instead of inlining them.
+	Store bool `json:"store"`
+}
+
+// Rendered is a rendered overlay with the policy verdict for each
+// resource.
+type Rendered struct {
+	Manifests string     `json:"manifests,omitempty"`
+	Object    *Presigned `json:"object,omitempty"`
+	Resources []struct {
+		APIVersion string   `json:"api_version"`
+		Kind       string   `json:"kind"`
+		Namespace  string   `json:"namespace,omitempty"`
+		Name       string   `json:"name"`
+		Violations []string `json:"violations,omitempty"`
+	} `json:"resources"`
+	// Allowed is false if any resource breaks the admission policy.
+	Allowed bool `json:"allowed"`
+}
+
+// ScaffoldRequest describes a service to scaffold.
+type ScaffoldRequest struct {
+	Name     string `json:"name"`
+	Team     string `json:"team"`
+	Language string `json:"language"`
+	Deploy   string `json:"deploy"`
+	CI       string `json:"ci"`
+	Port     int    `json:"port,omitempty"`
+	// Branch is the branch ScaffoldToGit creates; empty means
+	// scaffold/<name>.
+	Branch string `json:"branch,omitempty"`
+}
+
+// ScaffoldCommit is a scaffold pushed to the scaffold repository.
+type ScaffoldCommit struct {
+	Repository string `json:"repository"`
+	Branch     string `json:"branch"`
+	Commit     string `json:"commit"`
+}
+
+// Workspace is an infrastructure workspace runs are started in.
+type Workspace struct {
+	Name               string   `json:"name"`
+	Backend            string   `json:"backend"`
+	Description        string   `json:"description,omitempty"`
+	Groups             []string `json:"groups,omitempty"`
+	Repository         string   `json:"repository,omitempty"`
+	Ref                string   `json:"ref,omitempty"`
+	Directory          string   `json:"directory,omitempty"`
+	TerraformWorkspace string   `json:"terraform_workspace,omitempty"`
+}
+
+// WorkspaceOutput is a Terraform output of a workspace.
+type WorkspaceOutput struct {
+	Name      string `json:"name"`
+	Type      string `json:"type,omitempty"`
+	Sensitive bool   `json:"sensitive"`
+	// Value is omitted for sensitive outputs.
+	Value any `json:"value,omitempty"`
+}
+
+// RunRequest starts an infrastructure run.
+type RunRequest struct {
+	Workspace string `json:"workspace"`
+	Message   string `json:"message"`
+	// PlanOnly runs can never be applied.
+	PlanOnly bool `json:"plan_only"`
+	Destroy  bool `json:"destroy"`
+}
+
+// Run is an infrastructure plan, and apply once confirmed.
+type Run struct {
+	ID            string    `json:"id"`
+	Workspace     string    `json:"workspace"`
+	Backend       string    `json:"backend"`
+	Status        string    `json:"status"`
+	BackendStatus string    `json:"backend_status"`
+	Message       string    `json:"message"`
+	PlanOnly      bool      `json:"plan_only"`
+	Destroy       bool      `json:"destroy"`
+	HasChanges    *bool     `json:"has_changes,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	URL           string    `json:"url,omitempty"`
+	Output        string    `json:"output,omitempty"`
+}
+
+// Application is an Argo CD application's sync and health status.
+type Application struct {
+	Name         string `json:"name"`
+	Project      string `json:"project"`
+	SyncStatus   string `json:"sync_status"`
+	HealthStatus string `json:"health_status"`
+	Revision     string `json:"revision"`
+	Operation    *struct {
+		Phase      string     `json:"phase"`
+		Message    string     `json:"message,omitempty"`
+		StartedAt  time.Time  `json:"started_at"`
+		FinishedAt *time.Time `json:"finished_at,omitempty"`
+	} `json:"operation,omitempty"`
+}
+
+// SyncRequest selects what to sync. Zero values sync the application's
+// target revision.
+type SyncRequest struct {
+	Revision string `json:"revision,omitempty"`
+	Prune    bool   `json:"prune,omitempty"`
+	DryRun   bool   `json:"dry_run,omitempty"`
+}
+
+// Lock is a distributed lock.
+type Lock struct {
+	Name       string    `json:"name"`
+	Holder     string    `json:"holder"`
+	Owner      string    `json:"owner"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	RenewedAt  time.Time `json:"renewed_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// OnboardingRequest describes a tenant to onboard.
+type OnboardingRequest struct {
+	DisplayName string `json:"display_name"`
+	Owner       string `json:"owner"`
+	// Groups maps identity provider groups to a namespace role: admin,
+	// edit or view.
+	Groups map[string]string `json:"groups"`
+	// Quota overrides the default ResourceQuota hard limits, e.g.
+	// {"requests.cpu": "8"}.
+	Quota map[string]string `json:"quota,omitempty"`
+}
+
+// Onboarding is the progress of a tenant's onboarding.
+type Onboarding struct {
+	Tenant string `json:"tenant"`
+	Status string `json:"status"`
+	JobID  string `json:"job_id,omitempty"`
+	Steps  []struct {
+		Name       string     `json:"name"`
+		Status     string     `json:"status"`
+		Error      string     `json:"error,omitempty"`
+		FinishedAt *time.Time `json:"finished_at,omitempty"`
+	} `json:"steps"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// KustomizeRepositories lists the repositories overlays are rendered from.
+func (c *Client) KustomizeRepositories(ctx context.Context) ([]string, error) {
+	var resp struct {
+		Items []string `json:"items"`
+	}
+	err := c.do(ctx, call{method: http.MethodGet, path: path("kustomize", "repositories")}, &resp)
+	return resp.Items, err
+}
+
+// Render renders a kustomize overlay and checks it against the admission
+// policy.
+func (c *Client) Render(ctx context.Context, req RenderRequest) (*Rendered, error) {
+	var out Rendered
+	if err := c.do(ctx, call{method: http.MethodPost, path: path("kustomize", "render"), body: req}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ScaffoldOptions returns the choices for each scaffold setting, such as
+// the languages, and whether scaffolds can be pushed to git.
+func (c *Client) ScaffoldOptions(ctx context.Context) (map[string]any, error) {
+	var resp map[string]any
+	err := c.do(ctx, call{method: http.MethodGet, path: path("scaffold")}, &resp)
+	return resp, err
+}
+
+// Scaffold renders a service skeleton and returns it as a gzipped tarball.
+// The caller closes it.
+func (c *Client) Scaffold(ctx context.Context, req ScaffoldRequest) (io.ReadCloser, error) {
+	return c.stream(ctx, call{
+		method: http.MethodPost,
+		path:   path("scaffold"),
+		body:   scaffoldBody{req, "tarball"},
+		header: http.Header{"Accept": {"application/gzip"}},
+	})
+}
+
+// ScaffoldToGit pushes a service skeleton to a new branch of the scaffold
+// repository.
+func (c *Client) ScaffoldToGit(ctx context.Context, req ScaffoldRequest) (*ScaffoldCommit, error) {
+	var out ScaffoldCommit
+	if err := c.do(ctx, call{method: http.MethodPost, path: path("scaffold"), body: scaffoldBody{req, "git"}}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ScaffoldToObject keeps a service skeleton in the object store and
+// returns a download URL for it.
+func (c *Client) ScaffoldToObject(ctx context.Context, req ScaffoldRequest) (*Presigned, error) {
+	var out Presigned
+	if err := c.do(ctx, call{method: http.MethodPost, path: path("scaffold"), body: scaffoldBody{req, "object"}}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+type scaffoldBody struct {
+	ScaffoldRequest
+	Output string `json:"output"`
+}
+
+// Presign returns a URL for one operation (GET or PUT) on an object,
+// valid for expiresIn (0 means the server's default).
+func (c *Client) Presign(ctx context.Context, key, method string, expiresIn time.Duration) (*Presigned, error) {
+	body := map[string]string{"key": key, "method": method}
+	if expiresIn > 0 {
+		body["expires_in"] = expiresIn.String()
+	}
+	var out Presigned
+	if err := c.do(ctx, call{method: http.MethodPost, path: path("objects", "presign"), body: body}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Workspaces lists the infrastructure workspaces the caller may use.
+func (c *Client) Workspaces(ctx context.Context) ([]Workspace, error) {
+	var out []Workspace
+	err := c.do(ctx, call{method: http.MethodGet, path: path("infra", "workspaces")}, &out)
+	return out, err
+}
+
+// WorkspaceOutputs returns a workspace's Terraform outputs.
+func (c *Client) WorkspaceOutputs(ctx context.Context, workspace string) ([]WorkspaceOutput, error) {
+	var out []WorkspaceOutput
+	err := c.do(ctx, call{method: http.MethodGet, path: path("infra", "workspaces", workspace, "outputs")}, &out)
+	return out, err
+}
+
+// Runs lists the runs of a workspace.
+func (c *Client) Runs(ctx context.Context, workspace string) ([]Run, error) {
+	var out []Run
+	err := c.do(ctx, call{method: http.MethodGet, path: path("infra", "runs"), query: query("workspace", workspace)}, &out)
+	return out, err
+}
+
+// Run returns a run.
+func (c *Client) Run(ctx context.Context, id string) (*Run, error) {
+	return c.run(ctx, call{method: http.MethodGet, path: path("infra", "runs", id)})
+}
+
+// StartRun starts a plan in a workspace.
+func (c *Client) StartRun(ctx context.Context, req RunRequest) (*Run, error) {
+	return c.run(ctx, call{method: http.MethodPost, path: path("infra", "runs"), body: req})
+}
+
+// ApplyRun confirms a planned run, applying it.
+func (c *Client) ApplyRun(ctx context.Context, id, comment string) (*Run, error) {
+	body := map[string]string{"comment": comment}
+	return c.run(ctx, call{method: http.MethodPost, path: path("infra", "runs", id, "apply"), body: body})
+}
+
+func (c *Client) run(ctx context.Context, req call) (*Run, error) {
+	var run Run
+	if err := c.do(ctx, req, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// Application returns an Argo CD application's status.
+func (c *Client) Application(ctx context.Context, name string) (*Application, error) {
+	var app Application
+	if err := c.do(ctx, call{method: http.MethodGet, path: path("argocd", "applications", name)}, &app); err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+// Sync starts a sync of an Argo CD application.
+func (c *Client) Sync(ctx context.Context, name string, req SyncRequest) (*Application, error) {
+	var app Application
+	if err := c.do(ctx, call{method: http.MethodPost, path: path("argocd", "applications", name, "sync"), body: req}, &app); err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+// Lock returns a lock's current holder.
+func (c *Client) Lock(ctx context.Context, name string) (*Lock, error) {
+	var lock Lock
+	if err := c.do(ctx, call{method: http.MethodGet, path: path("locks", name)}, &lock); err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
+
+// AcquireLock takes a lock for holder until ttl passes without a renewal.
+// If someone else holds it, the error is a conflict (see IsConflict) and
+// the returned lock shows the holder.
+func (c *Client) AcquireLock(ctx context.Context, name, holder string, ttl time.Duration) (*Lock, error) {
+	return c.lock(ctx, http.MethodPost, name, holder, ttl)
+}
+
+// RenewLock extends holder's lock by ttl. If holder has lost the lock, the
+// error is a conflict and the returned lock shows the new holder.
+func (c *Client) RenewLock(ctx context.Context, name, holder string, ttl time.Duration) (*Lock, error) {
+	return c.lock(ctx, http.MethodPut, name, holder, ttl)
+}
+
+func (c *Client) lock(ctx context.Context, method, name, holder string, ttl time.Duration) (*Lock, error) {
+	body := map[string]string{"holder": holder}
+	if ttl > 0 {
+		body["ttl"] = ttl.String()
+	}
+	var lock Lock
+	err := c.do(ctx, call{method: method, path: path("locks", name), body: body}, &lock)
+	if err != nil && !(IsConflict(err) && errorBody(err, &lock)) {
+		return nil, err
+	}
+	return &lock, err
+}
+
+// ReleaseLock releases holder's lock.
+func (c *Client) ReleaseLock(ctx context.Context, name, holder string) error {
+	return c.do(ctx, call{method: http.MethodDelete, path: path("locks", name), query: query("holder", holder)}, nil)
+}
+
+// StartOnboarding starts onboarding a tenant. If onboarding is already
+// in progress, the error is a conflict and the returned progress is that
+// of the running one.
+func (c *Client) StartOnboarding(ctx context.Context, tenant string, req OnboardingRequest) (*Onboarding, error) {
+	var wf Onboarding
+	err := c.do(ctx, call{method: http.MethodPost, path: path("tenants", tenant, "onboarding"), body: req}, &wf)
+	if err != nil && !(IsConflict(err) && errorBody(err, &wf)) {
+		return nil, err
+	}
+	return &wf, err
+}
+
+// Onboarding returns the progress of a tenant's onboarding.
+func (c *Client) Onboarding(ctx context.Context, tenant string) (*Onboarding, error) {
+	var wf Onboarding
+	if err := c.do(ctx, call{method: http.MethodGet, path: path("tenants", tenant, "onboarding")}, &wf); err != nil {
+		return nil, err
+	}
+	return &wf, nil
+}
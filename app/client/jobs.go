@@ -0,0 +1,246 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// JobTemplate is a Kubernetes Job users may run with their own parameters.
+type JobTemplate struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Image       string   `json:"image"`
+	Command     []string `json:"command,omitempty"`
+	Args        []string `json:"args,omitempty"`
+	Parameters  []struct {
+		Name        string `json:"name"`
+		Description string `json:"description,omitempty"`
+		Required    bool   `json:"required,omitempty"`
+		Default     string `json:"default,omitempty"`
+		Pattern     string `json:"pattern,omitempty"`
+	} `json:"parameters,omitempty"`
+	// Resources are the container's requests and limits by resource name,
+	// as Kubernetes quantities.
+	Resources struct {
+		Requests map[string]string `json:"requests,omitempty"`
+		Limits   map[string]string `json:"limits,omitempty"`
+	} `json:"resources"`
+	ServiceAccount string `json:"service_account,omitempty"`
+	BackoffLimit   int32  `json:"backoff_limit"`
+	// Timeout and TTL are durations such as "10m0s".
+	Timeout string `json:"timeout"`
+	TTL     string `json:"ttl"`
+}
+
+// Job is a Job submitted from a template.
+type Job struct {
+	Name           string     `json:"name"`
+	Namespace      string     `json:"namespace"`
+	Template       string     `json:"template"`
+	SubmittedBy    string     `json:"submitted_by,omitempty"`
+	Phase          string     `json:"phase"`
+	Active         int32      `json:"active"`
+	Succeeded      int32      `json:"succeeded"`
+	Failed         int32      `json:"failed"`
+	Created        time.Time  `json:"created"`
+	StartTime      *time.Time `json:"start_time,omitempty"`
+	CompletionTime *time.Time `json:"completion_time,omitempty"`
+	Message        string     `json:"message,omitempty"`
+}
+
+// CronJobRequest creates or replaces a CronJob running a template.
+type CronJobRequest struct {
+	Name     string            `json:"name"`
+	Template string            `json:"template"`
+	Params   map[string]string `json:"params"`
+	// Schedule is a five-field cron expression or a descriptor such as
+	// "@daily".
+	Schedule string `json:"schedule"`
+	// TimeZone is an IANA name such as "Europe/London".
+	TimeZone string `json:"time_zone,omitempty"`
+	Suspend  bool   `json:"suspend,omitempty"`
+}
+
+// CronJob is a CronJob created from a template.
+type CronJob struct {
+	Name               string            `json:"name"`
+	Namespace          string            `json:"namespace"`
+	Template           string            `json:"template"`
+	Params             map[string]string `json:"params,omitempty"`
+	Schedule           string            `json:"schedule"`
+	TimeZone           string            `json:"time_zone,omitempty"`
+	Suspended          bool              `json:"suspended"`
+	ChangedBy          string            `json:"changed_by,omitempty"`
+	Active             int               `json:"active"`
+	LastScheduleTime   *time.Time        `json:"last_schedule_time,omitempty"`
+	LastSuccessfulTime *time.Time        `json:"last_successful_time,omitempty"`
+	NextRun            *time.Time        `json:"next_run,omitempty"`
+	Created            time.Time         `json:"created"`
+}
+
+// QueueJob is a unit of background work in the platform's job queue.
+type QueueJob struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	LastError   string          `json:"last_error,omitempty"`
+	RunAt       time.Time       `json:"run_at"`
+	LockedBy    string          `json:"locked_by,omitempty"`
+	LockedUntil *time.Time      `json:"locked_until,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+}
+
+// QueueJobOptions filters queue jobs; zero fields match everything.
+type QueueJobOptions struct {
+	Type   string
+	Status string
+	Limit  int
+}
+
+// JobTemplates lists the Job templates.
+func (c *Client) JobTemplates(ctx context.Context) ([]JobTemplate, error) {
+	var resp struct {
+		Items []JobTemplate `json:"items"`
+	}
+	err := c.do(ctx, call{method: http.MethodGet, path: path("jobs", "templates")}, &resp)
+	return resp.Items, err
+}
+
+// Jobs lists the Jobs submitted in a namespace.
+func (c *Client) Jobs(ctx context.Context, namespace, freshness string) ([]Job, error) {
+	var resp struct {
+		Items []Job `json:"items"`
+	}
+	err := c.do(ctx, call{method: http.MethodGet, path: path("namespaces", namespace, "jobs"), query: query("freshness", freshness)}, &resp)
+	return resp.Items, err
+}
+
+// Job returns a submitted Job.
+func (c *Client) Job(ctx context.Context, namespace, name, freshness string) (*Job, error) {
+	var job Job
+	if err := c.do(ctx, call{method: http.MethodGet, path: path("namespaces", namespace, "jobs", name), query: query("freshness", freshness)}, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// SubmitJob runs template in a namespace with params.
+func (c *Client) SubmitJob(ctx context.Context, namespace, template string, params map[string]string) (*Job, error) {
+	body := map[string]any{"template": template, "params": params}
+	var job Job
+	if err := c.do(ctx, call{method: http.MethodPost, path: path("namespaces", namespace, "jobs"), body: body}, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// DeleteJob deletes a Job and its pods.
+func (c *Client) DeleteJob(ctx context.Context, namespace, name string) error {
+	return c.do(ctx, call{method: http.MethodDelete, path: path("namespaces", namespace, "jobs", name)}, nil)
+}
+
+// JobLogs streams the logs of a Job's pod. The caller closes the stream.
+func (c *Client) JobLogs(ctx context.Context, namespace, name string, follow bool) (io.ReadCloser, error) {
+	return c.stream(ctx, call{
+		method: http.MethodGet,
+		path:   path("namespaces", namespace, "jobs", name, "logs"),
+		query:  query("follow", formatBool(follow)),
+		header: http.Header{"Accept": {"text/plain"}},
+	})
+}
+
+// CronJobs lists the CronJobs of a namespace.
+func (c *Client) CronJobs(ctx context.Context, namespace string) ([]CronJob, error) {
+	var resp struct {
+		Items []CronJob `json:"items"`
+	}
+	err := c.do(ctx, call{method: http.MethodGet, path: path("namespaces", namespace, "cronjobs")}, &resp)
+	return resp.Items, err
+}
+
+// CronJob returns a CronJob.
+func (c *Client) CronJob(ctx context.Context, namespace, name string) (*CronJob, error) {
+	return c.cronJob(ctx, call{method: http.MethodGet, path: path("namespaces", namespace, "cronjobs", name)})
+}
+
+// CreateCronJob creates a CronJob.
+func (c *Client) CreateCronJob(ctx context.Context, namespace string, req CronJobRequest) (*CronJob, error) {
+	return c.cronJob(ctx, call{method: http.MethodPost, path: path("namespaces", namespace, "cronjobs"), body: req})
+}
+
+// UpdateCronJob replaces a CronJob's template, parameters and schedule.
+func (c *Client) UpdateCronJob(ctx context.Context, namespace, name string, req CronJobRequest) (*CronJob, error) {
+	return c.cronJob(ctx, call{method: http.MethodPut, path: path("namespaces", namespace, "cronjobs", name), body: req})
+}
+
+// DeleteCronJob deletes a CronJob and the Jobs it started.
+func (c *Client) DeleteCronJob(ctx context.Context, namespace, name string) error {
+	return c.do(ctx, call{method: http.MethodDelete, path: path("namespaces", namespace, "cronjobs", name)}, nil)
+}
+
+// SuspendCronJob stops a CronJob from scheduling runs.
+func (c *Client) SuspendCronJob(ctx context.Context, namespace, name string) (*CronJob, error) {
+	return c.cronJob(ctx, call{method: http.MethodPost, path: path("namespaces", namespace, "cronjobs", name, "suspend")})
+}
+
+// ResumeCronJob lets a suspended CronJob schedule runs again.
+func (c *Client) ResumeCronJob(ctx context.Context, namespace, name string) (*CronJob, error) {
+	return c.cronJob(ctx, call{method: http.MethodPost, path: path("namespaces", namespace, "cronjobs", name, "resume")})
+}
+
+// TriggerCronJob starts a run of a CronJob now.
+func (c *Client) TriggerCronJob(ctx context.Context, namespace, name string) (*Job, error) {
+	var job Job
+	if err := c.do(ctx, call{method: http.MethodPost, path: path("namespaces", namespace, "cronjobs", name, "trigger")}, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (c *Client) cronJob(ctx context.Context, req call) (*CronJob, error) {
+	var cj CronJob
+	if err := c.do(ctx, req, &cj); err != nil {
+		return nil, err
+	}
+	return &cj, nil
+}
+
+// QueueJobs lists the jobs in the platform's job queue.
+func (c *Client) QueueJobs(ctx context.Context, opts QueueJobOptions) ([]QueueJob, error) {
+	q := query("type", opts.Type, "status", opts.Status)
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	var resp struct {
+		Items []QueueJob `json:"items"`
+	}
+	err := c.do(ctx, call{method: http.MethodGet, path: path("jobs"), query: q}, &resp)
+	return resp.Items, err
+}
+
+// QueueJob returns a queue job.
+func (c *Client) QueueJob(ctx context.Context, id string) (*QueueJob, error) {
+	return c.queueJob(ctx, call{method: http.MethodGet, path: path("jobs", id)})
+}
+
+// RetryQueueJob queues a dead job to run again.
+func (c *Client) RetryQueueJob(ctx context.Context, id string) (*QueueJob, error) {
+	return c.queueJob(ctx, call{method: http.MethodPost, path: path("jobs", id, "retry")})
+}
+
+func (c *Client) queueJob(ctx context.Context, req call) (*QueueJob, error) {
+	var job QueueJob
+	if err := c.do(ctx, req, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
@@ -0,0 +1,583 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Workload is a Deployment or StatefulSet.
+type Workload struct {
+	Kind      string            `json:"kind"`
+	Namespace string            `json:"namespace"`
+	Name      string            `json:"name"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Images    []string          `json:"images"`
+	Replicas  struct {
+		Desired   int32 `json:"desired"`
+		Ready     int32 `json:"ready"`
+		Available int32 `json:"available"`
+		Updated   int32 `json:"updated"`
+	} `json:"replicas"`
+	Created time.Time `json:"created"`
+	// Cluster is set in lists spanning clusters.
+	Cluster string `json:"cluster,omitempty"`
+}
+
+// WorkloadListOptions selects workloads.
+type WorkloadListOptions struct {
+	Namespace     string
+	LabelSelector string
+	// Freshness is "cached", "live" or the greatest acceptable age of
+	// cached data, such as "30s" (empty means the server's default).
+	Freshness string
+	ListOptions
+}
+
+func (o WorkloadListOptions) query() url.Values {
+	return o.ListOptions.apply(query("namespace", o.Namespace, "labelSelector", o.LabelSelector, "freshness", o.Freshness))
+}
+
+// ClusterStatus is one cluster's entry in the cluster health view.
+type ClusterStatus struct {
+	Name         string `json:"name"`
+	Local        bool   `json:"local"`
+	Ready        bool   `json:"ready"`
+	Error        string `json:"error,omitempty"`
+	Deployments  int    `json:"deployments"`
+	StatefulSets int    `json:"statefulsets"`
+	// PDBFindings counts the cluster's disruption budget findings by
+	// severity.
+	PDBFindings map[string]int `json:"pdb_findings,omitempty"`
+}
+
+// Clusters is the health of every configured cluster.
+type Clusters struct {
+	Items []ClusterStatus `json:"items"`
+	Total int             `json:"total"`
+	Ready int             `json:"ready"`
+}
+
+// NodeResources is an amount of node resources.
+type NodeResources struct {
+	CPUMillis   int64 `json:"cpu_millis"`
+	MemoryBytes int64 `json:"memory_bytes"`
+	Pods        int64 `json:"pods,omitempty"`
+}
+
+// Node is a cluster node with its capacity and, where metrics-server has
+// a sample, its usage.
+type Node struct {
+	Name           string            `json:"name"`
+	Roles          []string          `json:"roles,omitempty"`
+	Ready          bool              `json:"ready"`
+	Unschedulable  bool              `json:"unschedulable"`
+	KubeletVersion string            `json:"kubelet_version"`
+	OSImage        string            `json:"os_image"`
+	Architecture   string            `json:"architecture"`
+	InstanceType   string            `json:"instance_type,omitempty"`
+	Zone           string            `json:"zone,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Taints         []struct {
+		Key       string     `json:"key"`
+		Value     string     `json:"value,omitempty"`
+		Effect    string     `json:"effect"`
+		TimeAdded *time.Time `json:"timeAdded,omitempty"`
+	} `json:"taints,omitempty"`
+	Capacity    NodeResources  `json:"capacity"`
+	Allocatable NodeResources  `json:"allocatable"`
+	Usage       *NodeResources `json:"usage,omitempty"`
+	Utilization *struct {
+		CPUPercent    float64 `json:"cpu_percent"`
+		MemoryPercent float64 `json:"memory_percent"`
+	} `json:"utilization,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// NodeList is the node inventory.
+type NodeList struct {
+	Items []Node `json:"items"`
+	// MetricsAvailable is false when metrics-server could not be queried.
+	MetricsAvailable bool `json:"metrics_available"`
+}
+
+// KubeEvent is a Kubernetes warning event.
+type KubeEvent struct {
+	Reason         string    `json:"reason"`
+	Message        string    `json:"message"`
+	Type           string    `json:"type"`
+	Count          int32     `json:"count"`
+	FirstSeen      time.Time `json:"first_seen"`
+	LastSeen       time.Time `json:"last_seen"`
+	InvolvedObject struct {
+		Kind string `json:"kind"`
+		Name string `json:"name"`
+	} `json:"involved_object"`
+	Source string `json:"source,omitempty"`
+}
+
+// KubeEventOptions filters a namespace's events.
+type KubeEventOptions struct {
+	Reason string
+	// Kind and Name select the involved object.
+	Kind      string
+	Name      string
+	Limit     int
+	Freshness string
+}
+
+// PodLogOptions selects the log lines to read.
+type PodLogOptions struct {
+	Container  string
+	Follow     bool
+	Timestamps bool
+	Previous   bool
+	// TailLines and SinceSeconds limit the lines from the end (0 means
+	// no limit).
+	TailLines    int64
+	SinceSeconds int64
+}
+
+// Amount is a pod count or a percentage such as "25%".
+type Amount string
+
+// UnmarshalJSON accepts a number or a string.
+func (a *Amount) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*a = Amount(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return err
+	}
+	*a = Amount(n)
+	return nil
+}
+
+// BudgetTemplate is a disruption budget policy budgets are created from.
+type BudgetTemplate struct {
+	Name           string  `json:"name"`
+	Description    string  `json:"description"`
+	MinAvailable   *Amount `json:"min_available,omitempty"`
+	MaxUnavailable *Amount `json:"max_unavailable,omitempty"`
+	EvictUnhealthy bool    `json:"evict_unhealthy"`
+}
+
+// Budget is a PodDisruptionBudget.
+type Budget struct {
+	Namespace          string    `json:"namespace"`
+	Name               string    `json:"name"`
+	Template           string    `json:"template,omitempty"`
+	Selector           string    `json:"selector"`
+	MinAvailable       *Amount   `json:"min_available,omitempty"`
+	MaxUnavailable     *Amount   `json:"max_unavailable,omitempty"`
+	ExpectedPods       int32     `json:"expected_pods"`
+	CurrentHealthy     int32     `json:"current_healthy"`
+	DesiredHealthy     int32     `json:"desired_healthy"`
+	DisruptionsAllowed int32     `json:"disruptions_allowed"`
+	Created            time.Time `json:"created"`
+	// Findings are set when a single budget is read.
+	Findings []BudgetFinding `json:"findings,omitempty"`
+}
+
+// BudgetFinding is a problem with the disruption budgets of a workload.
+type BudgetFinding struct {
+	Kind      string   `json:"kind"`
+	Severity  string   `json:"severity"`
+	Namespace string   `json:"namespace"`
+	Workload  string   `json:"workload,omitempty"`
+	PDBs      []string `json:"pdbs,omitempty"`
+	Message   string   `json:"message"`
+}
+
+// BudgetFindings are the findings of the disruption budget validator.
+type BudgetFindings struct {
+	Items []BudgetFinding `json:"items"`
+	// Summary counts the findings by severity.
+	Summary map[string]int `json:"summary"`
+}
+
+// HelmRelease is an installed Helm release.
+type HelmRelease struct {
+	Name               string    `json:"name"`
+	Namespace          string    `json:"namespace"`
+	Revision           int       `json:"revision"`
+	Status             string    `json:"status"`
+	Chart              string    `json:"chart"`
+	ChartVersion       string    `json:"chart_version"`
+	AppVersion         string    `json:"app_version,omitempty"`
+	Updated            time.Time `json:"updated"`
+	ValuesDigest       string    `json:"values_digest"`
+	LatestChartVersion string    `json:"latest_chart_version,omitempty"`
+	Repository         string    `json:"repository,omitempty"`
+	UpgradeAvailable   bool      `json:"upgrade_available"`
+}
+
+// HelmReleaseOptions filters Helm releases.
+type HelmReleaseOptions struct {
+	Namespace string
+	Status    string
+	// Outdated keeps only releases with a newer chart version.
+	Outdated bool
+}
+
+// QuotaUsage is the usage of one resource of a ResourceQuota.
+type QuotaUsage struct {
+	Namespace string  `json:"namespace"`
+	Quota     string  `json:"quota"`
+	Resource  string  `json:"resource"`
+	Used      float64 `json:"used"`
+	Hard      float64 `json:"hard"`
+	Ratio     float64 `json:"ratio"`
+	Level     string  `json:"level"`
+}
+
+// QuotaSample is a recorded QuotaUsage.
+type QuotaSample struct {
+	Namespace string    `json:"namespace"`
+	Quota     string    `json:"quota"`
+	Resource  string    `json:"resource"`
+	Used      float64   `json:"used"`
+	Hard      float64   `json:"hard"`
+	SampledAt time.Time `json:"sampled_at"`
+}
+
+// CostResources is an amount of CPU and memory.
+type CostResources struct {
+	CPUCores  float64 `json:"cpu_cores"`
+	MemoryGiB float64 `json:"memory_gib"`
+}
+
+// CostEstimate is the estimated monthly cost of a set of pods.
+type CostEstimate struct {
+	Pods         int            `json:"pods"`
+	Requests     CostResources  `json:"requests"`
+	Limits       CostResources  `json:"limits"`
+	Usage        *CostResources `json:"usage,omitempty"`
+	RequestsCost float64        `json:"requests_monthly"`
+	LimitsCost   float64        `json:"limits_monthly"`
+	UsageCost    *float64       `json:"usage_monthly,omitempty"`
+	MonthlyCost  float64        `json:"monthly_cost"`
+}
+
+// CostRates are the prices costs are estimated with.
+type CostRates struct {
+	Currency      string  `json:"currency"`
+	CPUCoreHour   float64 `json:"cpu_core_hour"`
+	MemoryGiBHour float64 `json:"memory_gib_hour"`
+}
+
+// NamespaceCost is the estimated cost of a namespace.
+type NamespaceCost struct {
+	Namespace string `json:"namespace"`
+	CostEstimate
+	Workloads []struct {
+		Kind string `json:"kind"`
+		Name string `json:"name"`
+		CostEstimate
+	} `json:"workloads,omitempty"`
+}
+
+// CostReport is the estimated cost of the allowed namespaces.
+type CostReport struct {
+	Rates            CostRates       `json:"rates"`
+	HoursPerMonth    int             `json:"hours_per_month"`
+	MetricsAvailable bool            `json:"metrics_available"`
+	Total            CostEstimate    `json:"total"`
+	Namespaces       []NamespaceCost `json:"namespaces"`
+}
+
+// NamespaceCostReport is the estimated cost of one namespace.
+type NamespaceCostReport struct {
+	Rates            CostRates `json:"rates"`
+	HoursPerMonth    int       `json:"hours_per_month"`
+	MetricsAvailable bool      `json:"metrics_available"`
+	NamespaceCost
+}
+
+// Image is a container image running in the cluster.
+type Image struct {
+	Image     string `json:"image"`
+	Reference struct {
+		Registry   string `json:"registry"`
+		Repository string `json:"repository"`
+		Tag        string `json:"tag,omitempty"`
+		Digest     string `json:"digest,omitempty"`
+	} `json:"reference"`
+	Workloads []string `json:"workloads"`
+	Supported bool     `json:"supported"`
+	Digest    string   `json:"digest,omitempty"`
+	Scan      *struct {
+		Status    string         `json:"status"`
+		Severity  string         `json:"severity,omitempty"`
+		Counts    map[string]int `json:"counts,omitempty"`
+		Fixable   int            `json:"fixable,omitempty"`
+		ScannedAt *time.Time     `json:"scanned_at,omitempty"`
+	} `json:"scan,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+}
+
+// ImageOptions filters the image inventory.
+type ImageOptions struct {
+	Namespace string
+	Registry  string
+	// Severity keeps images with findings of at least this severity.
+	Severity string
+}
+
+// Deployments returns a page of Deployments.
+func (c *Client) Deployments(ctx context.Context, opts WorkloadListOptions) (*Page[Workload], error) {
+	return c.workloads(ctx, "deployments", opts)
+}
+
+// AllDeployments iterates over every Deployment opts selects.
+func (c *Client) AllDeployments(ctx context.Context, opts WorkloadListOptions) iter.Seq2[Workload, error] {
+	return all(ctx, opts.ListOptions, func(ctx context.Context, lo ListOptions) (*Page[Workload], error) {
+		opts.ListOptions = lo
+		return c.Deployments(ctx, opts)
+	})
+}
+
+// StatefulSets returns a page of StatefulSets.
+func (c *Client) StatefulSets(ctx context.Context, opts WorkloadListOptions) (*Page[Workload], error) {
+	return c.workloads(ctx, "statefulsets", opts)
+}
+
+// AllStatefulSets iterates over every StatefulSet opts selects.
+func (c *Client) AllStatefulSets(ctx context.Context, opts WorkloadListOptions) iter.Seq2[Workload, error] {
+	return all(ctx, opts.ListOptions, func(ctx context.Context, lo ListOptions) (*Page[Workload], error) {
+		opts.ListOptions = lo
+		return c.StatefulSets(ctx, opts)
+	})
+}
+
+func (c *Client) workloads(ctx context.Context, kind string, opts WorkloadListOptions) (*Page[Workload], error) {
+	var page Page[Workload]
+	if err := c.do(ctx, call{method: http.MethodGet, path: path("workloads", kind), query: opts.query()}, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// ClusterWorkloads lists the Deployments and StatefulSets of every
+// cluster, or of cluster if set. kind is "Deployment", "StatefulSet" or
+// empty for both.
+func (c *Client) ClusterWorkloads(ctx context.Context, cluster, namespace, kind, labelSelector string) ([]Workload, error) {
+	var resp struct {
+		Items []Workload `json:"items"`
+	}
+	q := query("cluster", cluster, "namespace", namespace, "kind", kind, "labelSelector", labelSelector)
+	err := c.do(ctx, call{method: http.MethodGet, path: path("workloads"), query: q}, &resp)
+	return resp.Items, err
+}
+
+// Clusters returns the health of every configured cluster.
+func (c *Client) Clusters(ctx context.Context) (*Clusters, error) {
+	var resp Clusters
+	if err := c.do(ctx, call{method: http.MethodGet, path: path("clusters")}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Nodes lists the nodes matching the label selector (empty for all).
+func (c *Client) Nodes(ctx context.Context, selector, freshness string) (*NodeList, error) {
+	var resp NodeList
+	q := query("selector", selector, "freshness", freshness)
+	if err := c.do(ctx, call{method: http.MethodGet, path: path("nodes"), query: q}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Node returns a node.
+func (c *Client) Node(ctx context.Context, name, freshness string) (*Node, error) {
+	var node Node
+	if err := c.do(ctx, call{method: http.MethodGet, path: path("nodes", name), query: query("freshness", freshness)}, &node); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// KubeEvents lists the warning events of a namespace, most recent first.
+func (c *Client) KubeEvents(ctx context.Context, namespace string, opts KubeEventOptions) ([]KubeEvent, error) {
+	q := query("reason", opts.Reason, "kind", opts.Kind, "name", opts.Name, "freshness", opts.Freshness)
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	var resp struct {
+		Items []KubeEvent `json:"items"`
+	}
+	err := c.do(ctx, call{method: http.MethodGet, path: path("namespaces", namespace, "events"), query: q}, &resp)
+	return resp.Items, err
+}
+
+// PodLogs streams a pod's logs. The caller closes the stream; with
+// Follow it ends when the container stops or ctx is done.
+func (c *Client) PodLogs(ctx context.Context, namespace, pod string, opts PodLogOptions) (io.ReadCloser, error) {
+	q := query("container", opts.Container,
+		"follow", formatBool(opts.Follow),
+		"timestamps", formatBool(opts.Timestamps),
+		"previous", formatBool(opts.Previous))
+	if opts.TailLines > 0 {
+		q.Set("tailLines", strconv.FormatInt(opts.TailLines, 10))
+	}
+	if opts.SinceSeconds > 0 {
+		q.Set("sinceSeconds", strconv.FormatInt(opts.SinceSeconds, 10))
+	}
+	return c.stream(ctx, call{
+		method: http.MethodGet,
+		path:   path("namespaces", namespace, "pods", pod, "logs"),
+		query:  q,
+		header: http.Header{"Accept": {"text/plain"}},
+	})
+}
+
+// BudgetTemplates lists the disruption budget templates.
+func (c *Client) BudgetTemplates(ctx context.Context) ([]BudgetTemplate, error) {
+	var resp struct {
+		Items []BudgetTemplate `json:"items"`
+	}
+	err := c.do(ctx, call{method: http.MethodGet, path: path("pdbs", "templates")}, &resp)
+	return resp.Items, err
+}
+
+// BudgetFindings returns the disruption budget findings in namespace, or
+// in every allowed namespace if it is empty.
+func (c *Client) BudgetFindings(ctx context.Context, namespace string) (*BudgetFindings, error) {
+	var resp BudgetFindings
+	if err := c.do(ctx, call{method: http.MethodGet, path: path("pdbs", "findings"), query: query("namespace", namespace)}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Budgets lists the disruption budgets of a namespace.
+func (c *Client) Budgets(ctx context.Context, namespace string) ([]Budget, error) {
+	var resp struct {
+		Items []Budget `json:"items"`
+	}
+	err := c.do(ctx, call{method: http.MethodGet, path: path("namespaces", namespace, "pdbs")}, &resp)
+	return resp.Items, err
+}
+
+// Budget returns a disruption budget with its findings.
+func (c *Client) Budget(ctx context.Context, namespace, name string) (*Budget, error) {
+	var b Budget
+	if err := c.do(ctx, call{method: http.MethodGet, path: path("namespaces", namespace, "pdbs", name)}, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// CreateBudget protects a Deployment or StatefulSet (kind) with a budget
+// built from template.
+func (c *Client) CreateBudget(ctx context.Context, namespace, template, kind, name string) (*Budget, error) {
+	body := map[string]string{"template": template, "kind": kind, "name": name}
+	var b Budget
+	if err := c.do(ctx, call{method: http.MethodPost, path: path("namespaces", namespace, "pdbs"), body: body}, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// HelmReleases lists the installed Helm releases.
+func (c *Client) HelmReleases(ctx context.Context, opts HelmReleaseOptions) ([]HelmRelease, error) {
+	q := query("namespace", opts.Namespace, "status", opts.Status, "outdated", formatBool(opts.Outdated))
+	var resp struct {
+		Items []HelmRelease `json:"items"`
+	}
+	err := c.do(ctx, call{method: http.MethodGet, path: path("helm", "releases"), query: q}, &resp)
+	return resp.Items, err
+}
+
+// Quotas lists the quota usage at or above level ("warning" or
+// "critical"; empty for all).
+func (c *Client) Quotas(ctx context.Context, level string) ([]QuotaUsage, error) {
+	var resp struct {
+		Items []QuotaUsage `json:"items"`
+	}
+	err := c.do(ctx, call{method: http.MethodGet, path: path("quotas"), query: query("level", level)}, &resp)
+	return resp.Items, err
+}
+
+// NamespaceQuotas lists a namespace's quota usage.
+func (c *Client) NamespaceQuotas(ctx context.Context, namespace string) ([]QuotaUsage, error) {
+	var resp struct {
+		Items []QuotaUsage `json:"items"`
+	}
+	err := c.do(ctx, call{method: http.MethodGet, path: path("namespaces", namespace, "quotas")}, &resp)
+	return resp.Items, err
+}
+
+// QuotaHistory returns a namespace's quota usage samples from the last
+// since (0 means the server's default of a day), for one resource such as
+// requests.cpu or for all if resource is empty.
+func (c *Client) QuotaHistory(ctx context.Context, namespace string, since time.Duration, resource string) ([]QuotaSample, error) {
+	q := query("resource", resource)
+	if since > 0 {
+		q.Set("since", since.String())
+	}
+	var resp struct {
+		Items []QuotaSample `json:"items"`
+	}
+	err := c.do(ctx, call{method: http.MethodGet, path: path("namespaces", namespace, "quotas", "history"), query: q}, &resp)
+	return resp.Items, err
+}
+
+// Costs estimates the cost of the allowed namespaces, broken down by
+// workload if workloads is set.
+func (c *Client) Costs(ctx context.Context, workloads bool) (*CostReport, error) {
+	var report CostReport
+	if err := c.do(ctx, call{method: http.MethodGet, path: path("costs"), query: query("workloads", formatBool(workloads))}, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// NamespaceCosts estimates the cost of a namespace by workload.
+func (c *Client) NamespaceCosts(ctx context.Context, namespace string) (*NamespaceCostReport, error) {
+	var report NamespaceCostReport
+	if err := c.do(ctx, call{method: http.MethodGet, path: path("costs", namespace)}, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// Images lists the container images running in the cluster.
+func (c *Client) Images(ctx context.Context, opts ImageOptions) ([]Image, error) {
+	q := query("namespace", opts.Namespace, "registry", opts.Registry, "severity", opts.Severity)
+	var resp struct {
+		Items []Image `json:"items"`
+	}
+	err := c.do(ctx, call{method: http.MethodGet, path: path("images"), query: q}, &resp)
+	return resp.Items, err
+}
+
+// ImageTags lists the tags of a repository, such as
+// registry.example.com/team/web.
+func (c *Client) ImageTags(ctx context.Context, repository string) ([]string, error) {
+	var resp struct {
+		Tags []string `json:"tags"`
+	}
+	err := c.do(ctx, call{method: http.MethodGet, path: path("images", "tags"), query: query("repository", repository)}, &resp)
+	return resp.Tags, err
+}
+
+// InspectImage resolves an image reference and returns its digest and
+// vulnerability scan.
+func (c *Client) InspectImage(ctx context.Context, image string) (*Image, error) {
+	var img Image
+	if err := c.do(ctx, call{method: http.MethodGet, path: path("images", "inspect"), query: query("image", image)}, &img); err != nil {
+		return nil, err
+	}
+	return &img, nil
+}
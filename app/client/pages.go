@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Page is one page of a list.
+type Page[T any] struct {
+	Items []T `json:"items"`
+	// Continue fetches the next page when passed as ListOptions.Continue;
+	// empty on the last page.
+	Continue string `json:"continue,omitempty"`
+}
+
+// ListOptions selects a page of a list.
+type ListOptions struct {
+	// Limit is the page size (0 means the server's default).
+	Limit int
+	// Continue is the token from the previous page.
+	Continue string
+}
+
+func (o ListOptions) apply(q url.Values) url.Values {
+	if q == nil {
+		q = make(url.Values)
+	}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Continue != "" {
+		q.Set("continue", o.Continue)
+	}
+	return q
+}
+
+// all iterates over the items of every page fetch returns, starting from
+// opts, until the last page or the first error.
+func all[T any](ctx context.Context, opts ListOptions, fetch func(context.Context, ListOptions) (*Page[T], error)) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for {
+			page, err := fetch(ctx, opts)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			for _, item := range page.Items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+			if page.Continue == "" {
+				return
+			}
+			opts.Continue = page.Continue
+		}
+	}
+}
+
+// Collection is a resource type served with the API's uniform list, get,
+// create, update and delete endpoints: tenants, environments and catalog
+// items. Updates and deletes send the version from the last read, and fail
+// with a conflict (see IsConflict) if someone else has written since.
+type Collection[T any] struct {
+	c    *Client
+	path string
+}
+
+// List returns a page of the collection ordered by key. filter narrows the
+// list, e.g. owner for tenants or tier for environments.
+func (col *Collection[T]) List(ctx context.Context, filter url.Values, opts ListOptions) (*Page[T], error) {
+	var page Page[T]
+	q := make(url.Values)
+	for k, v := range filter {
+		q[k] = v
+	}
+	if err := col.c.do(ctx, call{method: http.MethodGet, path: col.path, query: opts.apply(q)}, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// All iterates over the whole collection, fetching pages as needed.
+func (col *Collection[T]) All(ctx context.Context, filter url.Values) iter.Seq2[T, error] {
+	return all(ctx, ListOptions{}, func(ctx context.Context, opts ListOptions) (*Page[T], error) {
+		return col.List(ctx, filter, opts)
+	})
+}
+
+// Get returns the item with key.
+func (col *Collection[T]) Get(ctx context.Context, key string) (*T, error) {
+	var item T
+	if err := col.c.do(ctx, call{method: http.MethodGet, path: col.path + "/" + url.PathEscape(key)}, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// Create creates item and returns it as stored, with its key and version.
+func (col *Collection[T]) Create(ctx context.Context, item *T) (*T, error) {
+	var out T
+	if err := col.c.do(ctx, call{method: http.MethodPost, path: col.path, body: item}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Update replaces the item with key. item carries the resource version
+// from the last read.
+func (col *Collection[T]) Update(ctx context.Context, key string, item *T) (*T, error) {
+	var out T
+	if err := col.c.do(ctx, call{method: http.MethodPut, path: col.path + "/" + url.PathEscape(key), body: item}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Delete deletes the item with key, if it is still at version.
+func (col *Collection[T]) Delete(ctx context.Context, key, version string) error {
+	req := call{method: http.MethodDelete, path: col.path + "/" + url.PathEscape(key)}
+	if version != "" {
+		req.header = http.Header{"If-Match": {strconv.Quote(version)}}
+	}
+	return col.c.do(ctx, req, nil)
+}
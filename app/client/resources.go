@@ -0,0 +1,175 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tenant is a team or organisation that owns services on the platform.
+type Tenant struct {
+	ID          string            `json:"id,omitempty"`
+	Name        string            `json:"name"`
+	DisplayName string            `json:"display_name"`
+	Owner       string            `json:"owner"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	DeletedAt   *time.Time        `json:"deleted_at,omitempty"`
+	// ResourceVersion guards updates against concurrent edits; send back
+	// the value from the last read.
+	ResourceVersion string `json:"resource_version,omitempty"`
+}
+
+// Environment is a stage services are deployed to, such as staging.
+type Environment struct {
+	ID          string            `json:"id,omitempty"`
+	Name        string            `json:"name"`
+	DisplayName string            `json:"display_name"`
+	Tier        string            `json:"tier"`
+	Cluster     string            `json:"cluster,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	DeletedAt   *time.Time        `json:"deleted_at,omitempty"`
+	// ResourceVersion guards updates against concurrent edits; send back
+	// the value from the last read.
+	ResourceVersion string `json:"resource_version,omitempty"`
+}
+
+// CatalogItem is an entry of the service catalog.
+type CatalogItem struct {
+	Name             string          `json:"name"`
+	DisplayName      string          `json:"display_name"`
+	Description      string          `json:"description,omitempty"`
+	Category         string          `json:"category"`
+	Tags             []string        `json:"tags,omitempty"`
+	Owner            string          `json:"owner,omitempty"`
+	DocumentationURL string          `json:"documentation_url,omitempty"`
+	Parameters       json.RawMessage `json:"parameters,omitempty"`
+	Deprecated       bool            `json:"deprecated"`
+	// ResourceVersion guards updates against concurrent edits; send back
+	// the value from the last read.
+	ResourceVersion string `json:"resource_version,omitempty"`
+}
+
+// Change is one write to a tenant or environment, with the entity as JSON
+// before and after it.
+type Change struct {
+	ID         string          `json:"id"`
+	Resource   string          `json:"resource"`
+	ResourceID string          `json:"resource_id"`
+	Action     string          `json:"action"`
+	Actor      string          `json:"actor"`
+	RequestID  string          `json:"request_id,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	// Diff is the JSON merge patch (RFC 7386) turning Before into After.
+	Diff json.RawMessage `json:"diff,omitempty"`
+	Time time.Time       `json:"time"`
+}
+
+// Credential describes a secret a tenant keeps on the platform. The value
+// is never returned.
+type Credential struct {
+	ID          string    `json:"id"`
+	TenantID    string    `json:"tenant_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	KeyID       string    `json:"key_id"`
+	UpdatedBy   string    `json:"updated_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// SearchHit is an entity matching a search, higher Rank first.
+type SearchHit struct {
+	Type        string  `json:"type"`
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Title       string  `json:"title,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Rank        float64 `json:"rank"`
+}
+
+// SearchResults are the hits of a search.
+type SearchResults struct {
+	Items []SearchHit `json:"items"`
+	// Unavailable lists the types whose source failed; Items lacks them.
+	Unavailable []string `json:"unavailable,omitempty"`
+}
+
+// Tenants returns the tenants collection. Lists filter on owner.
+func (c *Client) Tenants() *Collection[Tenant] {
+	return &Collection[Tenant]{c: c, path: path("tenants")}
+}
+
+// Environments returns the environments collection. Lists filter on tier.
+func (c *Client) Environments() *Collection[Environment] {
+	return &Collection[Environment]{c: c, path: path("environments")}
+}
+
+// Catalog returns the service catalog, keyed by name. Lists filter on
+// category and deprecated.
+func (c *Client) Catalog() *Collection[CatalogItem] {
+	return &Collection[CatalogItem]{c: c, path: path("catalog")}
+}
+
+// TenantHistory returns the changes to a tenant, newest first.
+func (c *Client) TenantHistory(ctx context.Context, id string) ([]Change, error) {
+	return c.history(ctx, "tenants", id)
+}
+
+// EnvironmentHistory returns the changes to an environment, newest first.
+func (c *Client) EnvironmentHistory(ctx context.Context, id string) ([]Change, error) {
+	return c.history(ctx, "environments", id)
+}
+
+func (c *Client) history(ctx context.Context, resource, id string) ([]Change, error) {
+	var resp struct {
+		Items []Change `json:"items"`
+	}
+	err := c.do(ctx, call{method: http.MethodGet, path: path(resource, id, "history")}, &resp)
+	return resp.Items, err
+}
+
+// Search searches tenants and services. types restricts the result types
+// and limit the number of hits (0 means the server's default).
+func (c *Client) Search(ctx context.Context, q string, limit int, types ...string) (*SearchResults, error) {
+	params := query("q", q, "type", strings.Join(types, ","))
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+	var resp SearchResults
+	if err := c.do(ctx, call{method: http.MethodGet, path: path("search"), query: params}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Credentials lists a tenant's credentials.
+func (c *Client) Credentials(ctx context.Context, tenant string) ([]Credential, error) {
+	var resp struct {
+		Items []Credential `json:"items"`
+	}
+	err := c.do(ctx, call{method: http.MethodGet, path: path("tenants", tenant, "credentials")}, &resp)
+	return resp.Items, err
+}
+
+// PutCredential creates or replaces a tenant's credential.
+func (c *Client) PutCredential(ctx context.Context, tenant, name, description, value string) (*Credential, error) {
+	body := map[string]string{"description": description, "value": value}
+	var cred Credential
+	if err := c.do(ctx, call{method: http.MethodPut, path: path("tenants", tenant, "credentials", name), body: body}, &cred); err != nil {
+		return nil, err
+	}
+	return &cred, nil
+}
+
+// DeleteCredential deletes a tenant's credential.
+func (c *Client) DeleteCredential(ctx context.Context, tenant, name string) error {
+	return c.do(ctx, call{method: http.MethodDelete, path: path("tenants", tenant, "credentials", name)}, nil)
+}
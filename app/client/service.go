@@ -0,0 +1,231 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"iter"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Info is the service's metadata.
+type Info struct {
+	Service     string   `json:"service"`
+	Version     string   `json:"version"`
+	Environment string   `json:"environment"`
+	GoVersion   string   `json:"go_version"`
+	OS          string   `json:"os"`
+	Arch        string   `json:"arch"`
+	Pod         *PodInfo `json:"pod,omitempty"`
+}
+
+// PodInfo is the pod serving the request, when running in Kubernetes.
+type PodInfo struct {
+	Name           string            `json:"name,omitempty"`
+	Namespace      string            `json:"namespace,omitempty"`
+	Node           string            `json:"node,omitempty"`
+	ServiceAccount string            `json:"service_account,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+}
+
+// Status is the service's runtime status.
+type Status struct {
+	Status      string `json:"status"`
+	Uptime      string `json:"uptime"`
+	Goroutines  int    `json:"goroutines"`
+	MemoryAlloc string `json:"memory_alloc_mb"`
+	Timestamp   string `json:"timestamp"`
+	GOMAXPROCS  int    `json:"gomaxprocs"`
+	GOMEMLIMIT  string `json:"gomemlimit_mb,omitempty"`
+	// Limits are the container limits the runtime was sized to.
+	Limits *struct {
+		CPUQuota         float64 `json:"cpu_quota,omitempty"`
+		MemoryLimit      int64   `json:"memory_limit_bytes,omitempty"`
+		GOMAXPROCS       int     `json:"gomaxprocs"`
+		GOMEMLIMIT       int64   `json:"gomemlimit_bytes,omitempty"`
+		GOMAXPROCSSource string  `json:"gomaxprocs_source"`
+		GOMEMLIMITSource string  `json:"gomemlimit_source"`
+	} `json:"limits,omitempty"`
+}
+
+// Event is a platform event with its position in the event log.
+type Event struct {
+	Cursor uint64          `json:"cursor"`
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Source string          `json:"source"`
+	Time   time.Time       `json:"time"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+// Events is a batch of events from the event log.
+type Events struct {
+	Events []Event `json:"events"`
+	// Cursor is passed back as since to get the events that follow.
+	Cursor string `json:"cursor"`
+	// Truncated means events after since were evicted before they were
+	// read; resynchronise any state built from them.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Agent is a node agent as the hub last saw it.
+type Agent struct {
+	Node        string      `json:"node"`
+	Connected   bool        `json:"connected"`
+	ConnectedAt time.Time   `json:"connected_at"`
+	LastSeen    time.Time   `json:"last_seen"`
+	LastReport  AgentReport `json:"last_report"`
+}
+
+// AgentReport is a node agent's health and inventory report.
+type AgentReport struct {
+	AgentID  string    `json:"agent_id"`
+	NodeName string    `json:"node_name"`
+	Version  string    `json:"version"`
+	Time     time.Time `json:"time"`
+	Health   struct {
+		Status          string   `json:"status"`
+		Load1           float64  `json:"load1"`
+		MemoryAvailable uint64   `json:"memory_available_bytes"`
+		Problems        []string `json:"problems,omitempty"`
+	} `json:"health"`
+	Inventory struct {
+		Hostname      string `json:"hostname"`
+		OS            string `json:"os"`
+		Arch          string `json:"arch"`
+		KernelVersion string `json:"kernel_version,omitempty"`
+		CPUs          int    `json:"cpus"`
+		MemoryTotal   uint64 `json:"memory_total_bytes"`
+	} `json:"inventory"`
+}
+
+// SupplyChain describes what the service was built from.
+type SupplyChain struct {
+	Build *struct {
+		GoVersion string            `json:"go_version"`
+		Path      string            `json:"path"`
+		Version   string            `json:"version"`
+		Revision  string            `json:"revision,omitempty"`
+		Time      string            `json:"time,omitempty"`
+		Modified  bool              `json:"modified"`
+		Settings  map[string]string `json:"settings,omitempty"`
+	} `json:"build,omitempty"`
+	Modules []Module `json:"modules"`
+	// SBOM and Provenance summarise the attestations served in full by
+	// Client.SBOM and Client.Provenance.
+	SBOM       map[string]string `json:"sbom,omitempty"`
+	Provenance map[string]string `json:"provenance,omitempty"`
+}
+
+// Module is a Go module linked into the service.
+type Module struct {
+	Path    string  `json:"path"`
+	Version string  `json:"version"`
+	Sum     string  `json:"sum,omitempty"`
+	Replace *Module `json:"replace,omitempty"`
+}
+
+// Info returns the service's metadata.
+func (c *Client) Info(ctx context.Context) (*Info, error) {
+	var info Info
+	if err := c.do(ctx, call{method: http.MethodGet, path: path("info")}, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Status returns the service's runtime status.
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	var status Status
+	if err := c.do(ctx, call{method: http.MethodGet, path: path("status")}, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Features returns the effective feature flags.
+func (c *Client) Features(ctx context.Context) (map[string]bool, error) {
+	var resp struct {
+		Flags map[string]bool `json:"flags"`
+	}
+	err := c.do(ctx, call{method: http.MethodGet, path: path("features")}, &resp)
+	return resp.Flags, err
+}
+
+// Events returns the events after the since cursor ("" for the oldest
+// kept). With a positive wait the server holds the request until an event
+// arrives or wait elapses.
+func (c *Client) Events(ctx context.Context, since string, wait time.Duration) (*Events, error) {
+	q := query("since", since)
+	if wait > 0 {
+		q.Set("wait", wait.String())
+	}
+	var resp Events
+	if err := c.do(ctx, call{method: http.MethodGet, path: path("events"), query: q}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// WatchEvents iterates over the events after since as they happen, long
+// polling with wait, until ctx is done or a poll fails. wait must be
+// shorter than the client's timeout.
+func (c *Client) WatchEvents(ctx context.Context, since string, wait time.Duration) iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		for ctx.Err() == nil {
+			batch, err := c.Events(ctx, since, wait)
+			if err != nil {
+				yield(Event{}, err)
+				return
+			}
+			for _, e := range batch.Events {
+				if !yield(e, nil) {
+					return
+				}
+			}
+			since = batch.Cursor
+		}
+	}
+}
+
+// Agents lists the node agents known to the hub, by node name.
+func (c *Client) Agents(ctx context.Context) ([]Agent, error) {
+	var resp struct {
+		Agents []Agent `json:"agents"`
+	}
+	err := c.do(ctx, call{method: http.MethodGet, path: path("agents")}, &resp)
+	return resp.Agents, err
+}
+
+// SupplyChain returns the service's build information and dependencies.
+func (c *Client) SupplyChain(ctx context.Context) (*SupplyChain, error) {
+	var sc SupplyChain
+	if err := c.do(ctx, call{method: http.MethodGet, path: path("supply-chain")}, &sc); err != nil {
+		return nil, err
+	}
+	return &sc, nil
+}
+
+// SBOM returns the service's software bill of materials document.
+func (c *Client) SBOM(ctx context.Context) (json.RawMessage, error) {
+	var doc json.RawMessage
+	err := c.do(ctx, call{method: http.MethodGet, path: path("supply-chain", "sbom")}, &doc)
+	return doc, err
+}
+
+// Provenance returns the service's build provenance attestation.
+func (c *Client) Provenance(ctx context.Context) (json.RawMessage, error) {
+	var doc json.RawMessage
+	err := c.do(ctx, call{method: http.MethodGet, path: path("supply-chain", "provenance")}, &doc)
+	return doc, err
+}
+
+// formatBool returns "true" for b and "" otherwise, so query leaves false
+// flags out.
+func formatBool(b bool) string {
+	if b {
+		return strconv.FormatBool(b)
+	}
+	return ""
+}
@@ -0,0 +1,198 @@
+// Package clusterevents exposes recent Kubernetes Warning events per
+// namespace from an informer cache (or the API server, with ?freshness=), so
+// the portal can show why a workload is unhealthy without users running
+// kubectl.
+package clusterevents
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/kube"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 500
+
+	warningSelector = "type=" + corev1.EventTypeWarning
+)
+
+// Event is one entry of the feed.
+type Event struct {
+	Reason         string         `json:"reason"`
+	Message        string         `json:"message"`
+	Type           string         `json:"type"`
+	Count          int32          `json:"count"`
+	FirstSeen      time.Time      `json:"first_seen"`
+	LastSeen       time.Time      `json:"last_seen"`
+	InvolvedObject InvolvedObject `json:"involved_object"`
+	Source         string         `json:"source,omitempty"`
+}
+
+// InvolvedObject identifies the object an event is about.
+type InvolvedObject struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// Feed serves GET /api/v1/namespaces/{ns}/events.
+type Feed struct {
+	clientset kubernetes.Interface
+	informer  cache.SharedIndexInformer
+	allowed   map[string]bool
+}
+
+// New registers a Warning-only Event informer on factory; the factory must
+// be started afterwards. The field selector keeps Normal events (the bulk of
+// event traffic) out of memory. It takes the factory's Event slot, so other
+// users of the factory see only Warning events too. cs serves the reads that
+// must be fresher than the cache.
+func New(cs kubernetes.Interface, factory informers.SharedInformerFactory, namespaces []string) *Feed {
+	informer := factory.InformerFor(&corev1.Event{}, func(cs kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return coreinformers.NewFilteredEventInformer(cs, metav1.NamespaceAll, resync,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+			func(o *metav1.ListOptions) { o.FieldSelector = warningSelector },
+		)
+	})
+
+	f := &Feed{clientset: cs, informer: informer}
+	if len(namespaces) > 0 {
+		f.allowed = make(map[string]bool, len(namespaces))
+		for _, ns := range namespaces {
+			f.allowed[ns] = true
+		}
+	}
+	return f
+}
+
+// Register mounts the feed on mux.
+func (f *Feed) Register(mux *http.ServeMux) {
+	mux.Handle("GET /api/v1/namespaces/{ns}/events", f)
+}
+
+// ServeHTTP returns the namespace's Warning events, newest first. Optional
+// filters: reason, kind and name (of the involved object); limit caps the
+// result.
+func (f *Feed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ns := r.PathValue("ns")
+	if f.allowed != nil && !f.allowed[ns] {
+		http.Error(w, "namespace not allowed", http.StatusForbidden)
+		return
+	}
+
+	q := r.URL.Query()
+	limit := defaultLimit
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxLimit)
+	}
+	reason, kind, name := q.Get("reason"), q.Get("kind"), q.Get("name")
+	freshness, err := kube.ParseFreshness(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var events []*corev1.Event
+	if freshness.Cached(f.informer) {
+		objs, err := f.informer.GetIndexer().ByIndex(cache.NamespaceIndex, ns)
+		if err != nil {
+			http.Error(w, "failed to list events", http.StatusInternalServerError)
+			return
+		}
+		for _, obj := range objs {
+			if e, ok := obj.(*corev1.Event); ok {
+				events = append(events, e)
+			}
+		}
+	} else {
+		list, err := f.clientset.CoreV1().Events(ns).List(r.Context(), metav1.ListOptions{FieldSelector: warningSelector})
+		if err != nil {
+			http.Error(w, "failed to list events", http.StatusInternalServerError)
+			return
+		}
+		for i := range list.Items {
+			events = append(events, &list.Items[i])
+		}
+	}
+
+	items := make([]Event, 0, len(events))
+	for _, e := range events {
+		if e.Type != corev1.EventTypeWarning {
+			continue
+		}
+		if reason != "" && e.Reason != reason {
+			continue
+		}
+		if kind != "" && e.InvolvedObject.Kind != kind {
+			continue
+		}
+		if name != "" && e.InvolvedObject.Name != name {
+			continue
+		}
+		items = append(items, toEvent(e))
+	}
+
+	slices.SortFunc(items, func(a, b Event) int { return b.LastSeen.Compare(a.LastSeen) })
+	if len(items) > limit {
+		items = items[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	codec.Encode(w, map[string]any{"items": items})
+}
+
+func toEvent(e *corev1.Event) Event {
+	// events.k8s.io/v1 writers set EventTime/Series instead of the legacy
+	// timestamps and count
+	first, last := e.FirstTimestamp.Time, e.LastTimestamp.Time
+	if first.IsZero() {
+		first = e.EventTime.Time
+	}
+	if last.IsZero() {
+		last = first
+		if e.Series != nil {
+			last = e.Series.LastObservedTime.Time
+		}
+	}
+	count := e.Count
+	if count == 0 {
+		count = 1
+		if e.Series != nil {
+			count = e.Series.Count
+		}
+	}
+
+	source := e.Source.Component
+	if source == "" {
+		source = e.ReportingController
+	}
+	return Event{
+		Reason:    e.Reason,
+		Message:   e.Message,
+		Type:      e.Type,
+		Count:     count,
+		FirstSeen: first.UTC(),
+		LastSeen:  last.UTC(),
+		InvolvedObject: InvolvedObject{
+			Kind: e.InvolvedObject.Kind,
+			Name: e.InvolvedObject.Name,
+		},
+		Source: source,
+	}
+}
@@ -0,0 +1,72 @@
+package clusterevents
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func warning(name, reason, kind, object string, last time.Time) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Namespace: "team-a", Name: name},
+		Type:           corev1.EventTypeWarning,
+		Reason:         reason,
+		InvolvedObject: corev1.ObjectReference{Kind: kind, Name: object, Namespace: "team-a"},
+		LastTimestamp:  metav1.NewTime(last),
+		Count:          2,
+	}
+}
+
+func TestFeedFiltersAndSorts(t *testing.T) {
+	now := time.Now()
+	cs := fake.NewClientset(
+		warning("e1", "BackOff", "Pod", "api-0", now.Add(-time.Minute)),
+		warning("e2", "FailedScheduling", "Pod", "api-1", now),
+		warning("e3", "BackOff", "Pod", "worker-0", now.Add(-2*time.Minute)),
+	)
+	factory := informers.NewSharedInformerFactory(cs, 0)
+	feed := New(cs, factory, []string{"team-a"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		factory.Shutdown()
+	}()
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+
+	mux := http.NewServeMux()
+	feed.Register(mux)
+
+	get := func(url string) (int, []Event) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		var resp struct {
+			Items []Event `json:"items"`
+		}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return rec.Code, resp.Items
+	}
+
+	_, items := get("/api/v1/namespaces/team-a/events")
+	if len(items) != 3 || items[0].Reason != "FailedScheduling" {
+		t.Fatalf("expected 3 events newest first, got %+v", items)
+	}
+
+	_, items = get("/api/v1/namespaces/team-a/events?reason=BackOff&name=api-0")
+	if len(items) != 1 || items[0].InvolvedObject.Name != "api-0" {
+		t.Errorf("expected only api-0 BackOff, got %+v", items)
+	}
+
+	if code, _ := get("/api/v1/namespaces/kube-system/events"); code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", code)
+	}
+}
@@ -0,0 +1,104 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+)
+
+// deployment is shaped like the list responses, the largest the API sends.
+type deployment struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	Replicas  int32             `json:"replicas"`
+	Ready     int32             `json:"ready_replicas"`
+	Image     string            `json:"image,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Created   time.Time         `json:"created_at"`
+	Paused    bool              `json:"paused"`
+	Raw       json.RawMessage   `json:"raw,omitempty"`
+}
+
+func payload() map[string]any {
+	items := make([]deployment, 100)
+	for i := range items {
+		items[i] = deployment{
+			Name:      "web-<" + string(rune('a'+i%26)) + ">",
+			Namespace: "team-a",
+			Replicas:  3,
+			Ready:     int32(i % 4),
+			Image:     "registry.example.com/web:1.2.3",
+			Labels:    map[string]string{"app": "web", "tier": "frontend", "team": "a&b"},
+			Created:   time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC),
+			Raw:       json.RawMessage(`{"b":1,"a":[true,null]}`),
+		}
+	}
+	return map[string]any{"items": items, "count": len(items), "continue": ""}
+}
+
+func each(t testing.TB) []Codec {
+	var out []Codec
+	for _, name := range Available() {
+		if err := Use(name); err != nil {
+			t.Fatalf("Use(%s): %v", name, err)
+		}
+		out = append(out, Default())
+	}
+	t.Cleanup(func() { Use("std") })
+	return out
+}
+
+func TestCodecs(t *testing.T) {
+	var want bytes.Buffer
+	if err := json.NewEncoder(&want).Encode(payload()); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	for _, c := range each(t) {
+		var got bytes.Buffer
+		if err := c.NewEncoder(&got).Encode(payload()); err != nil {
+			t.Fatalf("%s: encode: %v", c.Name(), err)
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("%s differs from encoding/json:\n%s\nwant\n%s", c.Name(), got.Bytes()[:200], want.Bytes()[:200])
+		}
+		var back map[string]any
+		if err := c.Unmarshal(got.Bytes(), &back); err != nil || back["count"] != float64(100) {
+			t.Errorf("%s: unmarshal = %v, %v", c.Name(), back["count"], err)
+		}
+	}
+
+	if err := Use("sonic"); err == nil {
+		t.Error("Use accepted a codec that is not compiled in")
+	}
+}
+
+// BenchmarkEncode compares the codecs on a list response; run it with
+// -tags segmentio to include segmentio/encoding.
+func BenchmarkEncode(b *testing.B) {
+	v := payload()
+	for _, c := range each(b) {
+		b.Run(c.Name(), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				c.NewEncoder(io.Discard).Encode(v)
+			}
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	data, _ := json.Marshal(payload())
+	for _, c := range each(b) {
+		b.Run(c.Name(), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				var v struct {
+					Items []deployment `json:"items"`
+				}
+				c.Unmarshal(data, &v)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+//go:build segmentio
+
+package codec
+
+import (
+	"io"
+
+	"github.com/segmentio/encoding/json"
+)
+
+// segmentioCodec is segmentio/encoding's drop-in replacement for
+// encoding/json. It compiles an encoder per type once instead of walking
+// values through reflection on every call, and writes the same bytes,
+// HTML escaping, sorted map keys and compacted json.RawMessage included.
+type segmentioCodec struct{}
+
+func init() {
+	register(segmentioCodec{})
+}
+
+func (segmentioCodec) Name() string                       { return "segmentio" }
+func (segmentioCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (segmentioCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (segmentioCodec) NewEncoder(w io.Writer) Encoder     { return json.NewEncoder(w) }
@@ -5,6 +5,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -14,6 +15,14 @@ type Config struct {
 	ServiceName string
 	Version     string
 	Environment string
+	// Mode selects what the process runs (ModeAPI, ModeController,
+	// ModeMigrate or ModeVerifyAudit)
+	Mode string
+	// DevMode runs the service against a fake cluster seeded with sample
+	// workloads, with the sample fixtures in an otherwise unseeded memory
+	// store, and serves requests without an identity as the developer. Never
+	// for a shared deployment.
+	DevMode bool
 
 	// Server settings
 	Port         int
@@ -21,29 +30,1081 @@ type Config struct {
 	WriteTimeout time.Duration
 	IdleTimeout  time.Duration
 
+	// Server tuning for high-connection environments
+	ReadHeaderTimeout time.Duration
+	MaxHeaderBytes    int
+	TCPKeepAlive      time.Duration
+	MaxConns          int
+
+	// Admin listener (health, metrics, pprof, admin APIs)
+	AdminPort         int
+	AdminReadTimeout  time.Duration
+	AdminWriteTimeout time.Duration
+
+	// EnableH2C serves HTTP/2 over cleartext on the plaintext listener.
+	// Intended for pods behind a mesh sidecar that terminates TLS.
+	EnableH2C bool
+
+	// EnableGRPC serves gRPC on the public port alongside HTTP (plaintext only).
+	EnableGRPC bool
+
+	// TLS (HTTPS is served when both files are set)
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// TLSReloadInterval is how often the cert/key files are checked for rotation.
+	TLSReloadInterval time.Duration
+
+	// EnableHTTP3 starts an HTTP/3 (QUIC) listener alongside HTTPS.
+	EnableHTTP3 bool
+
 	// Graceful shutdown
 	ShutdownTimeout time.Duration
+	// ShutdownDelay is how long to keep serving after readiness flips, giving
+	// kube-proxy and ingress controllers time to drop this endpoint.
+	ShutdownDelay time.Duration
+
+	// Zero-downtime restart: SO_REUSEPORT on listeners, and how long to wait
+	// for a replacement process (SIGUSR2) to report ready.
+	ReusePort      bool
+	RestartTimeout time.Duration
+
+	// CPU-heavy work (kustomize builds, scaffolding, in-memory search)
+	// runs on WorkerPoolSize workers (GOMAXPROCS when 0); up to
+	// WorkerPoolQueue requests wait for one, more get 503s.
+	WorkerPoolSize  int
+	WorkerPoolQueue int
+
+	// Load shedding: while the p99 latency is over LoadShedLatencyTarget or
+	// the CPU utilization over LoadShedCPUThreshold (0 to 1, 0 for off),
+	// low-priority requests (LoadShedLowPriorityPaths prefixes, or marked
+	// by clients) and then normal ones are rejected with 503s.
+	LoadShedEnabled          bool
+	LoadShedLatencyTarget    time.Duration
+	LoadShedCPUThreshold     float64
+	LoadShedInterval         time.Duration
+	LoadShedLowPriorityPaths []string
+
+	// Latency budgets, by route pattern as registered ("GET /api/v1/...");
+	// other routes get LatencyBudgetDefault, and 0 means none. Slower
+	// requests are logged with a link to their trace: TraceURLTemplate with
+	// "{trace_id}" replaced.
+	LatencyBudgets       map[string]string
+	LatencyBudgetDefault time.Duration
+	TraceURLTemplate     string
+
+	// GOMAXPROCS and GOMEMLIMIT are derived from the container's cgroup
+	// limits unless set in the environment; GOMEMLIMIT is MemoryLimitRatio
+	// of the memory limit, leaving the rest for non-heap memory.
+	CgroupLimits     bool
+	MemoryLimitRatio float64
+
+	// Memory watchdog: at these fractions of the container's memory limit
+	// it collects garbage, drops caches, fails readiness and finally shuts
+	// down gracefully before the OOM killer strikes.
+	MemoryWatchdogEnabled  bool
+	MemoryWatchdogInterval time.Duration
+	MemoryWatchdogGC       float64
+	MemoryWatchdogCaches   float64
+	MemoryWatchdogNotReady float64
+	MemoryWatchdogShutdown float64
+
+	// Goroutine leak detection: a leak is suspected when the goroutine
+	// count stays over GoroutineLeakBaseline (0: the first sample) plus
+	// GoroutineLeakTolerance for GoroutineLeakWindow samples and grows.
+	GoroutineLeakDetection bool
+	GoroutineLeakInterval  time.Duration
+	GoroutineLeakBaseline  int
+	GoroutineLeakTolerance int
+	GoroutineLeakWindow    int
+
+	// WarmupTimeout bounds each startup warmup task (informer sync, key
+	// sets, connection pools); the replica is not ready before they end.
+	WarmupTimeout time.Duration
+
+	// Startup dependencies (database, Redis, NATS, Kubernetes, ...) are
+	// started in order before the public listener opens. Each is retried
+	// with full-jitter backoff between StartupBackoffBase and
+	// StartupBackoffMax, each attempt gets StartupAttemptTimeout, and all
+	// attempts together StartupTimeout.
+	StartupTimeout        time.Duration
+	StartupAttemptTimeout time.Duration
+	StartupBackoffBase    time.Duration
+	StartupBackoffMax     time.Duration
 
 	// Logging
 	LogLevel string
+
+	// JSONCodec encodes API responses: "std" (encoding/json) or a codec
+	// compiled in with a build tag, such as "segmentio".
+	JSONCodec string
+
+	// Redaction of secrets, and of emails or addresses by policy, in logs,
+	// audit records, the recent-event log and debug endpoints. Rules come
+	// from RedactionRulesFile, re-read every RedactionReloadInterval, or
+	// are the built-in ones.
+	RedactionEnabled        bool
+	RedactionRulesFile      string
+	RedactionReloadInterval time.Duration
+
+	// Forwarding of security events (refused requests, admin actions,
+	// policy violations) to a SIEM: SIEMBackend is "splunk" (an HTTP Event
+	// Collector at SIEMURL, SIEMToken its token) or "elastic" (a cluster at
+	// SIEMURL, SIEMToken an API key, SIEMIndex the index or data stream).
+	// Events are sent as SIEMFormat ("json" or "cef") in batches of up to
+	// SIEMBatchSize, at least every SIEMBatchTimeout; at most
+	// SIEMBufferSize wait, the least severe being shed first.
+	SIEMEnabled      bool
+	SIEMBackend      string
+	SIEMURL          string
+	SIEMToken        string
+	SIEMIndex        string
+	SIEMFormat       string
+	SIEMBatchSize    int
+	SIEMBatchTimeout time.Duration
+	SIEMBufferSize   int
+
+	// Portal frontend (static assets). StaticDir overrides the embedded build.
+	StaticEnabled bool
+	StaticDir     string
+	StaticPrefix  string
+
+	// APIExplorerEnabled serves a page at /explorer for sending requests to
+	// the API as any user.
+	APIExplorerEnabled bool
+
+	// VirtualHosts maps Host header values to named route tables
+	// ("api", "portal"), e.g. "api.internal=api,portal.internal=portal".
+	VirtualHosts map[string]string
+
+	// GraphQL query limits
+	GraphQLMaxDepth       int
+	GraphQLMaxQueryLength int
+	GraphQLMaxParallelism int
+
+	// Webhook receivers (a provider is enabled when its secret is set)
+	WebhookGitHubSecret      string
+	WebhookHarborSecret      string
+	WebhookAlertmanagerToken string
+	WebhookReplayWindow      time.Duration
+
+	// Outgoing webhooks, on when WebhookDispatchURLs is set (needs
+	// RBAC_ENABLED and ENCRYPTION_PROVIDER): events whose type starts with
+	// one of WebhookDispatchEvents, or all events, are posted to every URL,
+	// signed with the keys rotated at /api/v1/admin/webhooks/keys/rotate.
+	// A rotated key keeps signing for WebhookKeyGrace.
+	WebhookDispatchURLs     []string
+	WebhookDispatchEvents   []string
+	WebhookDispatchBuffer   int
+	WebhookSigningAlgorithm string
+	WebhookKeyGrace         time.Duration
+
+	// Persistence (StoreMemory or StorePostgres). The memory store starts
+	// with the fixtures in StoreSeedFile when set. The Database* settings
+	// size the PostgreSQL connection pool and bound the readiness ping;
+	// with DatabaseAutoMigrate the API applies pending schema migrations on
+	// startup. Reads go to DatabaseReplicaURLs that answer and are at most
+	// DatabaseReplicaMaxLag behind, checked every
+	// DatabaseReplicaCheckInterval.
+	StoreBackend            string
+	StoreSeedFile           string
+	DatabaseURL             string
+	DatabaseMaxOpenConns    int
+	DatabaseMaxIdleConns    int
+	DatabaseConnMaxLifetime time.Duration
+	DatabaseConnMaxIdleTime time.Duration
+	DatabasePingTimeout     time.Duration
+	DatabaseAutoMigrate     bool
+
+	DatabaseReplicaURLs          []string
+	DatabaseReplicaMaxLag        time.Duration
+	DatabaseReplicaCheckInterval time.Duration
+
+	// Tenant and environment API over the store; writes are open to
+	// callers in ResourcesAdminGroups.
+	ResourcesAPIEnabled  bool
+	ResourcesAdminGroups []string
+
+	// Search across tenants, services, namespaces and catalog items
+	SearchEnabled bool
+
+	// Export and import of the store's entities, for callers in
+	// BackupAdminGroups
+	BackupEnabled        bool
+	BackupAdminGroups    []string
+	BackupMaxImportBytes int
+
+	// Shared cache behind idempotency keys, rate limits and response
+	// caching: Redis when RedisAddrs is set (RedisMode standalone, sentinel
+	// or cluster), otherwise memory private to each replica.
+	RedisAddrs            []string
+	RedisMode             string
+	RedisMasterName       string
+	RedisUsername         string
+	RedisPassword         string
+	RedisSentinelPassword string
+	RedisDB               int
+	RedisTLS              bool
+	RedisTLSCAFile        string
+	RedisKeyPrefix        string
+	RedisPoolSize         int
+	// IdempotencyTTL keeps responses to writes carrying an Idempotency-Key
+	// (0 disables); RateLimit caps each caller's requests per
+	// RateLimitWindow (0 disables); GET responses under ResponseCachePaths
+	// are cached for ResponseCacheTTL.
+	IdempotencyTTL     time.Duration
+	RateLimit          int
+	RateLimitWindow    time.Duration
+	ResponseCachePaths []string
+	ResponseCacheTTL   time.Duration
+
+	// Kafka streaming to KafkaBrokers, with SASL (KafkaSASLMechanism) when
+	// KafkaUsername is set: bus events go to KafkaEventsTopic and audit
+	// records to KafkaAuditTopic (empty turns a stream off). With
+	// KafkaConsumerGroup set, events other instances produced to
+	// KafkaConsumerTopics are published on the local bus.
+	KafkaEnabled        bool
+	KafkaBrokers        []string
+	KafkaUsername       string
+	KafkaPassword       string
+	KafkaSASLMechanism  string
+	KafkaTLS            bool
+	KafkaEventsTopic    string
+	KafkaAuditTopic     string
+	KafkaBatchTimeout   time.Duration
+	KafkaBufferSize     int
+	KafkaConsumerGroup  string
+	KafkaConsumerTopics []string
+
+	// Event history for GET /api/v1/events (polling and long-polling)
+	EventsHistorySize int
+	EventsMaxWait     time.Duration
+
+	// Event bus (EventsMemory or EventsNATS). With NATS, events are kept in
+	// the JetStream stream NATSStream under "<NATSSubjectPrefix>.<type>";
+	// a missing stream is created with NATSMaxAge retention on
+	// NATSReplicas servers.
+	EventsBackend     string
+	NATSURL           string
+	NATSToken         string
+	NATSStream        string
+	NATSSubjectPrefix string
+	NATSMaxAge        time.Duration
+	NATSReplicas      int
+
+	// Transactional outbox relay: every OutboxInterval, pending messages
+	// are published on the bus in batches of OutboxBatchSize; sent ones
+	// are kept for OutboxRetention (0 keeps them)
+	OutboxEnabled   bool
+	OutboxInterval  time.Duration
+	OutboxBatchSize int
+	OutboxRetention time.Duration
+
+	// Durable background job queue in the store: QueueWorkers jobs at a
+	// time per replica, each attempt bounded by QueueLease, failures
+	// retried with backoff up to QueueMaxAttempts and then dead-lettered.
+	// Succeeded jobs are kept for QueueRetention (0 keeps them). The
+	// /api/v1/jobs API is open to callers in QueueAdminGroups.
+	QueueEnabled      bool
+	QueueAdminGroups  []string
+	QueueWorkers      int
+	QueuePollInterval time.Duration
+	QueueLease        time.Duration
+	QueueMaxAttempts  int
+	QueueBackoffBase  time.Duration
+	QueueBackoffMax   time.Duration
+	QueueRetention    time.Duration
+
+	// S3-compatible object store (AWS S3, MinIO) for rendered manifests,
+	// scaffolds and exports. Presigned URLs point at
+	// ObjectStorePublicEndpoint when set and are valid for
+	// ObjectStorePresignExpiry. Without static credentials, the AWS SDK's
+	// default credential chain is used.
+	ObjectStoreEnabled         bool
+	ObjectStoreEndpoint        string
+	ObjectStorePublicEndpoint  string
+	ObjectStoreRegion          string
+	ObjectStoreBucket          string
+	ObjectStorePathStyle       bool
+	ObjectStorePrefix          string
+	ObjectStoreAccessKeyID     string
+	ObjectStoreSecretAccessKey string
+	ObjectStoreSessionToken    string
+	ObjectStorePresignExpiry   time.Duration
+
+	// Agent mode: DaemonSet instances stream node health to a central
+	// instance (which needs ENABLE_GRPC and KUBE_ENABLED). Agents send the
+	// projected token in AgentTokenFile; the hub accepts tokens of
+	// AgentHubServiceAccount in PodNamespace issued for AgentTokenAudience.
+	AgentMode              bool
+	AgentCentralAddr       string
+	AgentReportInterval    time.Duration
+	AgentTLS               bool
+	AgentTokenFile         string
+	AgentTokenAudience     string
+	AgentHubReportInterval time.Duration
+	AgentHubServiceAccount string
+
+	// Pod metadata from the Downward API, reported by /api/v1/info
+	PodName           string
+	PodNamespace      string
+	NodeName          string
+	PodServiceAccount string
+	PodLabelsFile     string
+
+	// Kubernetes API access (in-cluster config, or KUBECONFIG locally)
+	KubeEnabled      bool
+	Kubeconfig       string
+	KubeQPS          float64
+	KubeBurst        int
+	KubeResyncPeriod time.Duration
+	// KubeNamespaces limits cluster read endpoints (empty = all namespaces)
+	KubeNamespaces []string
+	// Further clusters, from kubeconfig contexts and/or Secrets matching
+	// KubeClusterSecretSelector in KubeClusterSecretsNamespace (defaults to
+	// PodNamespace). KubeClusterName names the local cluster; requests pick
+	// a cluster with KubeClusterHeader or a /api/v1/clusters/{cluster}/ path.
+	KubeClusterName             string
+	KubeContexts                []string
+	KubeClusterSecretSelector   string
+	KubeClusterSecretsNamespace string
+	KubeClusterHeader           string
+
+	// Identity headers set by the authenticating proxy in front of the
+	// service. They are only believed from the proxy: peers in
+	// AuthProxyTrustedCIDRs or presenting a client certificate issued by
+	// AuthProxyClientCAFile. Other callers' identity headers are dropped.
+	AuthProxyUserHeader   string
+	AuthProxyGroupsHeader string
+	AuthProxyTrustedCIDRs []string
+	AuthProxyClientCAFile string
+
+	// Platform roles enforced on mapped routes. RBACGroupRoles maps the
+	// identity provider's groups to roles; further roles are assigned to
+	// users and groups through /api/v1/rbac/assignments.
+	RBACEnabled    bool
+	RBACGroupRoles map[string]string
+
+	// Personal access tokens minted at /api/v1/tokens, limited to scopes
+	// (platform permissions) and to the owner's roles (needs RBAC_ENABLED)
+	TokensEnabled    bool
+	TokensDefaultTTL time.Duration
+	TokensMaxTTL     time.Duration
+	// SCIM 2.0 directory the token owners' groups are looked up in on
+	// every token request (needed by TOKENS_ENABLED)
+	SCIMURL   string
+	SCIMToken string
+
+	// Tenant credentials at /api/v1/tenants/{id}/credentials (needs
+	// RBAC_ENABLED), sealed with envelope encryption. The master key is
+	// EncryptionKeys[EncryptionActiveKey] (EncryptionLocal), or a Vault
+	// transit key (EncryptionVault).
+	CredentialsEnabled   bool
+	EncryptionProvider   string
+	EncryptionKeys       map[string]string
+	EncryptionActiveKey  string
+	EncryptionVaultAddr  string
+	EncryptionVaultToken string
+	EncryptionVaultMount string
+	EncryptionVaultKey   string
+
+	// Open Policy Agent sidecar deciding API requests (OPAAuthzPath) and
+	// admission reviews (OPAAdmissionPath); an empty path skips that check.
+	// Rego modules come from OPA's bundles and, with OPAPolicyNamespace set,
+	// from ConfigMaps labelled platform.io/opa-policy=true there (needs
+	// KUBE_ENABLED). Denials are recorded in the audit log, and allows too
+	// with OPALogAllowed.
+	OPAEnabled         bool
+	OPAURL             string
+	OPAAuthzPath       string
+	OPAAdmissionPath   string
+	OPAPolicyNamespace string
+	OPAFailOpen        bool
+	OPALogAllowed      bool
+
+	// Connection pooling and timeouts of every outbound HTTP client
+	OutboundDialTimeout           time.Duration
+	OutboundTLSHandshakeTimeout   time.Duration
+	OutboundResponseHeaderTimeout time.Duration
+	OutboundIdleConnTimeout       time.Duration
+	OutboundMaxIdleConns          int
+	OutboundMaxIdleConnsPerHost   int
+	OutboundMaxConnsPerHost       int
+	OutboundHTTP2                 bool
+	OutboundHTTP2PingInterval     time.Duration
+	OutboundHTTP2PingTimeout      time.Duration
+
+	// OAuth2 client credentials for calls to protected platform
+	// dependencies: the outbound clients named in OAuth2Clients (e.g.
+	// "opa", "registry") attach tokens obtained from OAuth2TokenURL,
+	// cached until shortly before they expire.
+	OAuth2TokenURL     string
+	OAuth2ClientID     string
+	OAuth2ClientSecret string
+	OAuth2Scopes       []string
+	OAuth2Audience     string
+	OAuth2Clients      []string
+
+	// Portal sign-in with OpenID Connect: browser users get a session
+	// cookie, encrypted with the first of SessionSecrets (the others still
+	// decrypt), kept in the shared cache. Sessions end after
+	// SessionIdleTimeout unused or SessionMaxAge in all. The provider's
+	// signing keys are refetched every OIDCKeysRefresh, and keys it drops
+	// are accepted for OIDCKeysGrace longer.
+	SessionsEnabled    bool
+	OIDCIssuerURL      string
+	OIDCClientID       string
+	OIDCClientSecret   string
+	OIDCRedirectURL    string
+	OIDCScopes         []string
+	OIDCUserClaim      string
+	OIDCGroupsClaim    string
+	OIDCKeysRefresh    time.Duration
+	OIDCKeysGrace      time.Duration
+	SessionSecrets     []string
+	SessionCookieName  string
+	SessionIdleTimeout time.Duration
+	SessionMaxAge      time.Duration
+	SessionSameSite    string
+	SessionInsecure    bool
+
+	// SPIFFE workload identity: the service fetches its X.509 SVID and
+	// trust bundles from the SPIRE agent's Workload API at
+	// SPIFFEEndpointSocket, and TLS peers presenting an SVID of one of
+	// SPIFFETrustDomains (default: the service's own) act as the principal
+	// SPIFFEPrincipals maps their SPIFFE ID to, in SPIFFEGroups.
+	SPIFFEEnabled        bool
+	SPIFFEEndpointSocket string
+	SPIFFETrustDomains   []string
+	SPIFFEPrincipals     map[string]string
+	SPIFFEGroups         []string
+
+	// Abuse protection: AbuseMaxFailures 401s within AbuseFailureWindow
+	// lock a client address or user out for AbuseLockout, doubling per
+	// lockout within a day up to AbuseMaxLockout. A minute with at least
+	// AbuseSpikeMin 401s or 403s, AbuseSpikeFactor times the usual number,
+	// is reported as a spike.
+	AbuseProtection    bool
+	AbuseMaxFailures   int
+	AbuseFailureWindow time.Duration
+	AbuseLockout       time.Duration
+	AbuseMaxLockout    time.Duration
+	AbuseSpikeMin      int
+	AbuseSpikeFactor   float64
+
+	// PodLogsMaxTailLines caps lines returned by the pod log endpoint
+	PodLogsMaxTailLines int
+	// NodeMetricsEnabled joins metrics-server usage into /api/v1/nodes
+	NodeMetricsEnabled bool
+
+	// Feature flag defaults ("name=true,name=false"); the ConfigMap named by
+	// FeatureFlagsConfigMap in PodNamespace overrides them live (needs KUBE_ENABLED)
+	FeatureFlags          map[string]string
+	FeatureFlagsConfigMap string
+
+	// Lease-backed locks API (needs KUBE_ENABLED); LocksNamespace defaults to PodNamespace
+	LocksEnabled    bool
+	LocksNamespace  string
+	LocksDefaultTTL time.Duration
+	LocksMaxTTL     time.Duration
+
+	// Argo CD API for GitOps sync triggers (enabled when ArgoCDURL is set)
+	ArgoCDURL   string
+	ArgoCDToken string
+
+	// Helm release inventory (needs KUBE_ENABLED); HelmRepositories maps
+	// repository names to URLs whose index.yaml is checked for newer charts
+	HelmInventoryEnabled bool
+	HelmRepositories     map[string]string
+	HelmRepoRefresh      time.Duration
+
+	// Service catalog over CatalogItem CRDs (needs KUBE_ENABLED)
+	CatalogEnabled bool
+
+	// Tenant onboarding workflow (needs KUBE_ENABLED)
+	OnboardingEnabled          bool
+	OnboardingDefaultQuota     map[string]string
+	OnboardingPullSecret       string
+	OnboardingIngressNamespace string
+	OnboardingTimeout          time.Duration
+
+	// Templated Job submission (needs KUBE_ENABLED). JobsTTL is how long
+	// finished Jobs are kept when their template sets no ttl.
+	JobsEnabled       bool
+	JobsTemplatesFile string
+	JobsTTL           time.Duration
+
+	// ResourceQuota usage reporting (needs KUBE_ENABLED). Thresholds are
+	// used/hard ratios that publish quota.threshold.* events when crossed.
+	QuotaReportEnabled     bool
+	QuotaReportInterval    time.Duration
+	QuotaHistoryRetention  time.Duration
+	QuotaWarnThreshold     float64
+	QuotaCriticalThreshold float64
+
+	// Node cordon/drain API (needs KUBE_ENABLED), open to callers in
+	// NodeOpsGroups. Evictions blocked by a PodDisruptionBudget are retried
+	// until NodeOpsEvictionTimeout.
+	NodeOpsEnabled         bool
+	NodeOpsGroups          []string
+	NodeOpsEvictionTimeout time.Duration
+	NodeOpsDrainTimeout    time.Duration
+
+	// Image inventory against OCI registries (needs KUBE_ENABLED).
+	// Registries maps registry hosts to their kind (oci, harbor, ecr);
+	// RegistryCredentialsFile is a dockerconfigjson re-read on every refresh.
+	RegistryEnabled         bool
+	Registries              map[string]string
+	RegistryCredentialsFile string
+	RegistryRefresh         time.Duration
+
+	// Namespace cost estimates (needs KUBE_ENABLED). Rates are per core-hour
+	// and GiB-hour; CostsPricingURL, if set, serves rates that replace them.
+	CostsEnabled        bool
+	CostsCurrency       string
+	CostsCPUCoreHour    float64
+	CostsMemoryGiBHour  float64
+	CostsPricingURL     string
+	CostsPricingRefresh time.Duration
+
+	// Browser terminal proxying pods/exec over a WebSocket (needs
+	// KUBE_ENABLED). Only the programs in PodExecCommands may be started;
+	// with PodExecRecordingDir set, every session is kept as an asciinema cast.
+	PodExecEnabled      bool
+	PodExecCommands     []string
+	PodExecMaxDuration  time.Duration
+	PodExecRecordingDir string
+
+	// PodDisruptionBudget management (needs KUBE_ENABLED). PDBTemplatesFile
+	// adds to or overrides the built-in budget templates.
+	PDBsEnabled      bool
+	PDBTemplatesFile string
+
+	// Server-side kustomize rendering for CI pre-flights. KustomizeRepositories
+	// maps repository names to archive URLs with a {ref} placeholder; output
+	// is checked against AdmissionPolicyFile.
+	KustomizeEnabled      bool
+	KustomizeRepositories map[string]string
+	KustomizeToken        string
+
+	// Golden-path service scaffolding. With ScaffoldGitURL set, skeletons
+	// can also be pushed as a branch to that repository over Git HTTP.
+	ScaffoldEnabled        bool
+	ScaffoldRegistry       string
+	ScaffoldGitURL         string
+	ScaffoldGitBaseBranch  string
+	ScaffoldGitUsername    string
+	ScaffoldGitToken       string
+	ScaffoldGitAuthorName  string
+	ScaffoldGitAuthorEmail string
+
+	// Terraform runs for platform-owned workspaces listed in
+	// InfraWorkspacesFile, on Terraform Cloud/Enterprise (TFC*) or Atlantis.
+	// Workspaces without their own groups are open to InfraGroups.
+	InfraEnabled        bool
+	InfraWorkspacesFile string
+	InfraGroups         []string
+	TFCURL              string
+	TFCOrganization     string
+	TFCToken            string
+	AtlantisURL         string
+	AtlantisToken       string
+	AtlantisVCS         string
+	AtlantisTimeout     time.Duration
+
+	// Embedded controller manager reconciling platform CRDs (needs KUBE_ENABLED)
+	ControllerEnabled        bool
+	ControllerLeaderElection bool
+
+	// Admission webhooks on a separate TLS listener
+	AdmissionEnabled    bool
+	AdmissionPort       int
+	AdmissionCertFile   string
+	AdmissionKeyFile    string
+	AdmissionPolicyFile string
+
+	// custom.metrics.k8s.io adapter for HPAs, on its own TLS listener (needs KUBE_ENABLED).
+	// CustomMetrics maps exposed metric names to scraped Prometheus families.
+	CustomMetricsEnabled    bool
+	CustomMetricsPort       int
+	CustomMetricsCertFile   string
+	CustomMetricsKeyFile    string
+	CustomMetrics           map[string]string
+	CustomMetricsScrapePort int
+
+	// ProxyRoutesFile points to a JSON list of reverse-proxy routes.
+	ProxyRoutesFile string
+
+	// malformed holds the environment variables Load could not parse
+	malformed []error
 }
 
+// Run modes.
+const (
+	// ModeAPI serves the public API (and optionally embedded controllers).
+	ModeAPI = "api"
+	// ModeController runs only the controllers plus the admin listener, so
+	// the reconcile plane scales independently of the API plane.
+	ModeController = "controller"
+	// ModeMigrate applies pending database migrations and exits, for a Job
+	// or init container ahead of a rollout.
+	ModeMigrate = "migrate"
+	// ModeVerifyAudit verifies the audit log's hash chain and exits,
+	// non-zero if it is broken, for a scheduled compliance check.
+	ModeVerifyAudit = "verify-audit"
+)
+
+// Store backends.
+const (
+	// StoreMemory keeps entities in process memory, lost on restart.
+	StoreMemory = "memory"
+	// StorePostgres keeps entities in the PostgreSQL database at DatabaseURL.
+	StorePostgres = "postgres"
+)
+
+// Event bus backends.
+const (
+	// EventsMemory delivers events within the process only.
+	EventsMemory = "memory"
+	// EventsNATS also keeps events in NATS JetStream and shares them with
+	// the other replicas.
+	EventsNATS = "nats"
+)
+
+// Encryption master key providers.
+const (
+	// EncryptionLocal keeps base64-encoded AES-256 master keys in the
+	// environment, for development.
+	EncryptionLocal = "local"
+	// EncryptionVault wraps data keys with Vault's transit engine.
+	EncryptionVault = "vault"
+)
+
 // Load reads configuration from environment variables with sensible production defaults.
 func Load() *Config {
-	return &Config{
+	cfg := &Config{
 		ServiceName: getEnv("SERVICE_NAME", "platform-api"),
 		Version:     getEnv("SERVICE_VERSION", "1.0.0"),
 		Environment: getEnv("ENVIRONMENT", "development"),
+		Mode:        getEnv("RUN_MODE", ModeAPI),
+		DevMode:     getEnvBool("DEV_MODE", false),
 
 		Port:         getEnvInt("PORT", 9090),
 		ReadTimeout:  getEnvDuration("READ_TIMEOUT", 5*time.Second),
 		WriteTimeout: getEnvDuration("WRITE_TIMEOUT", 10*time.Second),
 		IdleTimeout:  getEnvDuration("IDLE_TIMEOUT", 120*time.Second),
 
+		ReadHeaderTimeout: getEnvDuration("READ_HEADER_TIMEOUT", 2*time.Second),
+		MaxHeaderBytes:    getEnvInt("MAX_HEADER_BYTES", 1<<20),
+		TCPKeepAlive:      getEnvDuration("TCP_KEEPALIVE", 15*time.Second),
+		MaxConns:          getEnvInt("MAX_CONNS", 0),
+
+		AdminPort:         getEnvInt("ADMIN_PORT", 9091),
+		AdminReadTimeout:  getEnvDuration("ADMIN_READ_TIMEOUT", 5*time.Second),
+		AdminWriteTimeout: getEnvDuration("ADMIN_WRITE_TIMEOUT", 60*time.Second),
+
+		EnableH2C:  getEnvBool("ENABLE_H2C", false),
+		EnableGRPC: getEnvBool("ENABLE_GRPC", false),
+
+		TLSCertFile: getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:  getEnv("TLS_KEY_FILE", ""),
+		EnableHTTP3: getEnvBool("ENABLE_HTTP3", false),
+
+		TLSReloadInterval: getEnvDuration("TLS_RELOAD_INTERVAL", 30*time.Second),
+
 		ShutdownTimeout: getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+		ShutdownDelay:   getEnvDuration("SHUTDOWN_DELAY", 5*time.Second),
+
+		ReusePort:      getEnvBool("REUSE_PORT", false),
+		RestartTimeout: getEnvDuration("RESTART_TIMEOUT", 30*time.Second),
+
+		OutboundDialTimeout:           getEnvDuration("OUTBOUND_DIAL_TIMEOUT", 5*time.Second),
+		OutboundTLSHandshakeTimeout:   getEnvDuration("OUTBOUND_TLS_HANDSHAKE_TIMEOUT", 5*time.Second),
+		OutboundResponseHeaderTimeout: getEnvDuration("OUTBOUND_RESPONSE_HEADER_TIMEOUT", 15*time.Second),
+		OutboundIdleConnTimeout:       getEnvDuration("OUTBOUND_IDLE_CONN_TIMEOUT", 90*time.Second),
+		OutboundMaxIdleConns:          getEnvInt("OUTBOUND_MAX_IDLE_CONNS", 100),
+		OutboundMaxIdleConnsPerHost:   getEnvInt("OUTBOUND_MAX_IDLE_CONNS_PER_HOST", 10),
+		OutboundMaxConnsPerHost:       getEnvInt("OUTBOUND_MAX_CONNS_PER_HOST", 0),
+		OutboundHTTP2:                 getEnvBool("OUTBOUND_HTTP2", true),
+		OutboundHTTP2PingInterval:     getEnvDuration("OUTBOUND_HTTP2_PING_INTERVAL", 30*time.Second),
+		OutboundHTTP2PingTimeout:      getEnvDuration("OUTBOUND_HTTP2_PING_TIMEOUT", 15*time.Second),
+
+		WorkerPoolSize:  getEnvInt("WORKER_POOL_SIZE", 0),
+		WorkerPoolQueue: getEnvInt("WORKER_POOL_QUEUE", 64),
+
+		LoadShedEnabled:          getEnvBool("LOAD_SHED_ENABLED", false),
+		LoadShedLatencyTarget:    getEnvDuration("LOAD_SHED_LATENCY_TARGET", 500*time.Millisecond),
+		LoadShedCPUThreshold:     getEnvFloat("LOAD_SHED_CPU_THRESHOLD", 0.9),
+		LoadShedInterval:         getEnvDuration("LOAD_SHED_INTERVAL", time.Second),
+		LoadShedLowPriorityPaths: getEnvList("LOAD_SHED_LOW_PRIORITY_PATHS"),
+
+		LatencyBudgets:       getEnvMap("LATENCY_BUDGETS"),
+		LatencyBudgetDefault: getEnvDuration("LATENCY_BUDGET_DEFAULT", 0),
+		TraceURLTemplate:     getEnv("TRACE_URL_TEMPLATE", ""),
+
+		CgroupLimits:     getEnvBool("CGROUP_LIMITS", true),
+		MemoryLimitRatio: getEnvFloat("MEMORY_LIMIT_RATIO", 0.9),
+
+		MemoryWatchdogEnabled:  getEnvBool("MEMORY_WATCHDOG_ENABLED", false),
+		MemoryWatchdogInterval: getEnvDuration("MEMORY_WATCHDOG_INTERVAL", time.Second),
+		MemoryWatchdogGC:       getEnvFloat("MEMORY_WATCHDOG_GC", 0.8),
+		MemoryWatchdogCaches:   getEnvFloat("MEMORY_WATCHDOG_CACHES", 0.85),
+		MemoryWatchdogNotReady: getEnvFloat("MEMORY_WATCHDOG_NOT_READY", 0.9),
+		MemoryWatchdogShutdown: getEnvFloat("MEMORY_WATCHDOG_SHUTDOWN", 0.95),
+
+		GoroutineLeakDetection: getEnvBool("GOROUTINE_LEAK_DETECTION", false),
+		GoroutineLeakInterval:  getEnvDuration("GOROUTINE_LEAK_INTERVAL", 30*time.Second),
+		GoroutineLeakBaseline:  getEnvInt("GOROUTINE_LEAK_BASELINE", 0),
+		GoroutineLeakTolerance: getEnvInt("GOROUTINE_LEAK_TOLERANCE", 1000),
+		GoroutineLeakWindow:    getEnvInt("GOROUTINE_LEAK_WINDOW", 10),
+
+		WarmupTimeout: getEnvDuration("WARMUP_TIMEOUT", 2*time.Minute),
+
+		StartupTimeout:        getEnvDuration("STARTUP_TIMEOUT", 2*time.Minute),
+		StartupAttemptTimeout: getEnvDuration("STARTUP_ATTEMPT_TIMEOUT", 10*time.Second),
+		StartupBackoffBase:    getEnvDuration("STARTUP_BACKOFF_BASE", 500*time.Millisecond),
+		StartupBackoffMax:     getEnvDuration("STARTUP_BACKOFF_MAX", 15*time.Second),
 
 		LogLevel: getEnv("LOG_LEVEL", "info"),
+
+		JSONCodec: getEnv("JSON_CODEC", "std"),
+
+		RedactionEnabled:        getEnvBool("REDACTION_ENABLED", false),
+		RedactionRulesFile:      getEnv("REDACTION_RULES_FILE", ""),
+		RedactionReloadInterval: getEnvDuration("REDACTION_RELOAD_INTERVAL", 30*time.Second),
+
+		SIEMEnabled:      getEnvBool("SIEM_ENABLED", false),
+		SIEMBackend:      getEnv("SIEM_BACKEND", "splunk"),
+		SIEMURL:          getEnv("SIEM_URL", ""),
+		SIEMToken:        getEnv("SIEM_TOKEN", ""),
+		SIEMIndex:        getEnv("SIEM_INDEX", ""),
+		SIEMFormat:       getEnv("SIEM_FORMAT", "json"),
+		SIEMBatchSize:    getEnvInt("SIEM_BATCH_SIZE", 100),
+		SIEMBatchTimeout: getEnvDuration("SIEM_BATCH_TIMEOUT", 2*time.Second),
+		SIEMBufferSize:   getEnvInt("SIEM_BUFFER_SIZE", 10000),
+
+		StaticEnabled: getEnvBool("STATIC_ENABLED", false),
+		StaticDir:     getEnv("STATIC_DIR", ""),
+		StaticPrefix:  getEnv("STATIC_PATH_PREFIX", "/portal"),
+
+		APIExplorerEnabled: getEnvBool("API_EXPLORER_ENABLED", false),
+
+		VirtualHosts: getEnvMap("VIRTUAL_HOSTS"),
+
+		GraphQLMaxDepth:       getEnvInt("GRAPHQL_MAX_DEPTH", 8),
+		GraphQLMaxQueryLength: getEnvInt("GRAPHQL_MAX_QUERY_LENGTH", 10000),
+		GraphQLMaxParallelism: getEnvInt("GRAPHQL_MAX_PARALLELISM", 10),
+
+		WebhookGitHubSecret:      getEnv("WEBHOOK_GITHUB_SECRET", ""),
+		WebhookHarborSecret:      getEnv("WEBHOOK_HARBOR_SECRET", ""),
+		WebhookAlertmanagerToken: getEnv("WEBHOOK_ALERTMANAGER_TOKEN", ""),
+		WebhookReplayWindow:      getEnvDuration("WEBHOOK_REPLAY_WINDOW", 24*time.Hour),
+
+		WebhookDispatchURLs:     getEnvList("WEBHOOK_DISPATCH_URLS"),
+		WebhookDispatchEvents:   getEnvList("WEBHOOK_DISPATCH_EVENTS"),
+		WebhookDispatchBuffer:   getEnvInt("WEBHOOK_DISPATCH_BUFFER", 1000),
+		WebhookSigningAlgorithm: getEnv("WEBHOOK_SIGNING_ALGORITHM", "hmac-sha256"),
+		WebhookKeyGrace:         getEnvDuration("WEBHOOK_KEY_GRACE", 24*time.Hour),
+
+		StoreBackend:            getEnv("STORE_BACKEND", StoreMemory),
+		StoreSeedFile:           getEnv("STORE_SEED_FILE", ""),
+		DatabaseURL:             getEnv("DATABASE_URL", ""),
+		DatabaseMaxOpenConns:    getEnvInt("DATABASE_MAX_OPEN_CONNS", 10),
+		DatabaseMaxIdleConns:    getEnvInt("DATABASE_MAX_IDLE_CONNS", 5),
+		DatabaseConnMaxLifetime: getEnvDuration("DATABASE_CONN_MAX_LIFETIME", 30*time.Minute),
+		DatabaseConnMaxIdleTime: getEnvDuration("DATABASE_CONN_MAX_IDLE_TIME", 5*time.Minute),
+		DatabasePingTimeout:     getEnvDuration("DATABASE_PING_TIMEOUT", time.Second),
+		DatabaseAutoMigrate:     getEnvBool("DATABASE_AUTO_MIGRATE", false),
+
+		DatabaseReplicaURLs:          getEnvList("DATABASE_REPLICA_URLS"),
+		DatabaseReplicaMaxLag:        getEnvDuration("DATABASE_REPLICA_MAX_LAG", 10*time.Second),
+		DatabaseReplicaCheckInterval: getEnvDuration("DATABASE_REPLICA_CHECK_INTERVAL", 5*time.Second),
+
+		ResourcesAPIEnabled:  getEnvBool("RESOURCES_API_ENABLED", false),
+		ResourcesAdminGroups: getEnvList("RESOURCES_ADMIN_GROUPS"),
+
+		SearchEnabled: getEnvBool("SEARCH_ENABLED", false),
+
+		BackupEnabled:        getEnvBool("BACKUP_ENABLED", false),
+		BackupAdminGroups:    getEnvList("BACKUP_ADMIN_GROUPS"),
+		BackupMaxImportBytes: getEnvInt("BACKUP_MAX_IMPORT_BYTES", 64<<20),
+
+		RedisAddrs:            getEnvList("REDIS_ADDRS"),
+		RedisMode:             getEnv("REDIS_MODE", "standalone"),
+		RedisMasterName:       getEnv("REDIS_MASTER_NAME", ""),
+		RedisUsername:         getEnv("REDIS_USERNAME", ""),
+		RedisPassword:         getEnv("REDIS_PASSWORD", ""),
+		RedisSentinelPassword: getEnv("REDIS_SENTINEL_PASSWORD", ""),
+		RedisDB:               getEnvInt("REDIS_DB", 0),
+		RedisTLS:              getEnvBool("REDIS_TLS", false),
+		RedisTLSCAFile:        getEnv("REDIS_TLS_CA_FILE", ""),
+		RedisKeyPrefix:        getEnv("REDIS_KEY_PREFIX", "platform-api:"),
+		RedisPoolSize:         getEnvInt("REDIS_POOL_SIZE", 0),
+		IdempotencyTTL:        getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+		RateLimit:             getEnvInt("RATE_LIMIT", 0),
+		RateLimitWindow:       getEnvDuration("RATE_LIMIT_WINDOW", time.Minute),
+		ResponseCachePaths:    getEnvList("RESPONSE_CACHE_PATHS"),
+		ResponseCacheTTL:      getEnvDuration("RESPONSE_CACHE_TTL", 30*time.Second),
+
+		KafkaEnabled:        getEnvBool("KAFKA_ENABLED", false),
+		KafkaBrokers:        getEnvList("KAFKA_BROKERS"),
+		KafkaUsername:       getEnv("KAFKA_USERNAME", ""),
+		KafkaPassword:       getEnv("KAFKA_PASSWORD", ""),
+		KafkaSASLMechanism:  getEnv("KAFKA_SASL_MECHANISM", "SCRAM-SHA-512"),
+		KafkaTLS:            getEnvBool("KAFKA_TLS", false),
+		KafkaEventsTopic:    getEnv("KAFKA_EVENTS_TOPIC", "platform.events"),
+		KafkaAuditTopic:     getEnv("KAFKA_AUDIT_TOPIC", "platform.audit"),
+		KafkaBatchTimeout:   getEnvDuration("KAFKA_BATCH_TIMEOUT", time.Second),
+		KafkaBufferSize:     getEnvInt("KAFKA_BUFFER_SIZE", 10000),
+		KafkaConsumerGroup:  getEnv("KAFKA_CONSUMER_GROUP", ""),
+		KafkaConsumerTopics: getEnvList("KAFKA_CONSUMER_TOPICS"),
+
+		EventsHistorySize: getEnvInt("EVENTS_HISTORY_SIZE", 1000),
+		EventsMaxWait:     getEnvDuration("EVENTS_MAX_WAIT", 60*time.Second),
+
+		EventsBackend:     getEnv("EVENTS_BACKEND", EventsMemory),
+		NATSURL:           getEnv("NATS_URL", "nats://nats:4222"),
+		NATSToken:         getEnv("NATS_TOKEN", ""),
+		NATSStream:        getEnv("NATS_STREAM", "PLATFORM_EVENTS"),
+		NATSSubjectPrefix: getEnv("NATS_SUBJECT_PREFIX", "platform.events"),
+		NATSMaxAge:        getEnvDuration("NATS_MAX_AGE", 7*24*time.Hour),
+		NATSReplicas:      getEnvInt("NATS_REPLICAS", 1),
+
+		OutboxEnabled:   getEnvBool("OUTBOX_ENABLED", false),
+		OutboxInterval:  getEnvDuration("OUTBOX_INTERVAL", time.Second),
+		OutboxBatchSize: getEnvInt("OUTBOX_BATCH_SIZE", 100),
+		OutboxRetention: getEnvDuration("OUTBOX_RETENTION", 7*24*time.Hour),
+
+		QueueEnabled:      getEnvBool("QUEUE_ENABLED", false),
+		QueueAdminGroups:  getEnvList("QUEUE_ADMIN_GROUPS"),
+		QueueWorkers:      getEnvInt("QUEUE_WORKERS", 4),
+		QueuePollInterval: getEnvDuration("QUEUE_POLL_INTERVAL", time.Second),
+		QueueLease:        getEnvDuration("QUEUE_LEASE", 5*time.Minute),
+		QueueMaxAttempts:  getEnvInt("QUEUE_MAX_ATTEMPTS", 5),
+		QueueBackoffBase:  getEnvDuration("QUEUE_BACKOFF_BASE", 10*time.Second),
+		QueueBackoffMax:   getEnvDuration("QUEUE_BACKOFF_MAX", 10*time.Minute),
+		QueueRetention:    getEnvDuration("QUEUE_RETENTION", 7*24*time.Hour),
+
+		ObjectStoreEnabled:         getEnvBool("OBJECTSTORE_ENABLED", false),
+		ObjectStoreEndpoint:        getEnv("OBJECTSTORE_ENDPOINT", "http://minio:9000"),
+		ObjectStorePublicEndpoint:  getEnv("OBJECTSTORE_PUBLIC_ENDPOINT", ""),
+		ObjectStoreRegion:          getEnv("OBJECTSTORE_REGION", "us-east-1"),
+		ObjectStoreBucket:          getEnv("OBJECTSTORE_BUCKET", "platform-artifacts"),
+		ObjectStorePathStyle:       getEnvBool("OBJECTSTORE_PATH_STYLE", true),
+		ObjectStorePrefix:          getEnv("OBJECTSTORE_PREFIX", ""),
+		ObjectStoreAccessKeyID:     getEnv("OBJECTSTORE_ACCESS_KEY_ID", ""),
+		ObjectStoreSecretAccessKey: getEnv("OBJECTSTORE_SECRET_ACCESS_KEY", ""),
+		ObjectStoreSessionToken:    getEnv("OBJECTSTORE_SESSION_TOKEN", ""),
+		ObjectStorePresignExpiry:   getEnvDuration("OBJECTSTORE_PRESIGN_EXPIRY", 15*time.Minute),
+
+		AgentMode:              getEnvBool("AGENT_MODE", false),
+		AgentCentralAddr:       getEnv("AGENT_CENTRAL_ADDR", ""),
+		AgentReportInterval:    getEnvDuration("AGENT_REPORT_INTERVAL", 15*time.Second),
+		AgentTLS:               getEnvBool("AGENT_TLS", false),
+		AgentTokenFile:         getEnv("AGENT_TOKEN_FILE", "/var/run/secrets/tokens/platform-agent"),
+		AgentTokenAudience:     getEnv("AGENT_TOKEN_AUDIENCE", "platform-agent"),
+		AgentHubReportInterval: getEnvDuration("AGENT_HUB_REPORT_INTERVAL", 0),
+		AgentHubServiceAccount: getEnv("AGENT_HUB_SERVICE_ACCOUNT", "platform-agent"),
+
+		PodName:           getEnv("POD_NAME", ""),
+		PodNamespace:      getEnv("POD_NAMESPACE", inClusterNamespace()),
+		NodeName:          getEnv("NODE_NAME", ""),
+		PodServiceAccount: getEnv("POD_SERVICE_ACCOUNT", ""),
+		PodLabelsFile:     getEnv("POD_LABELS_FILE", "/etc/podinfo/labels"),
+
+		KubeEnabled:      getEnvBool("KUBE_ENABLED", false),
+		Kubeconfig:       getEnv("KUBECONFIG", ""),
+		KubeQPS:          getEnvFloat("KUBE_QPS", 20),
+		KubeBurst:        getEnvInt("KUBE_BURST", 40),
+		KubeResyncPeriod: getEnvDuration("KUBE_RESYNC_PERIOD", 10*time.Minute),
+		KubeNamespaces:   getEnvList("KUBE_NAMESPACES"),
+
+		KubeClusterName:             getEnv("KUBE_CLUSTER_NAME", "local"),
+		KubeContexts:                getEnvList("KUBE_CONTEXTS"),
+		KubeClusterSecretSelector:   getEnv("KUBE_CLUSTER_SECRET_SELECTOR", ""),
+		KubeClusterSecretsNamespace: getEnv("KUBE_CLUSTER_SECRETS_NAMESPACE", ""),
+		KubeClusterHeader:           getEnv("KUBE_CLUSTER_HEADER", "X-Cluster"),
+
+		AuthProxyUserHeader:   getEnv("AUTH_PROXY_USER_HEADER", "X-Forwarded-User"),
+		AuthProxyGroupsHeader: getEnv("AUTH_PROXY_GROUPS_HEADER", "X-Forwarded-Groups"),
+		AuthProxyTrustedCIDRs: getEnvList("AUTH_PROXY_TRUSTED_CIDRS"),
+		AuthProxyClientCAFile: getEnv("AUTH_PROXY_CLIENT_CA_FILE", ""),
+		RBACEnabled:           getEnvBool("RBAC_ENABLED", false),
+		RBACGroupRoles:        getEnvMap("RBAC_GROUP_ROLES"),
+		TokensEnabled:         getEnvBool("TOKENS_ENABLED", false),
+		TokensDefaultTTL:      getEnvDuration("TOKENS_DEFAULT_TTL", 30*24*time.Hour),
+		TokensMaxTTL:          getEnvDuration("TOKENS_MAX_TTL", 90*24*time.Hour),
+		SCIMURL:               getEnv("SCIM_URL", ""),
+		SCIMToken:             getEnv("SCIM_TOKEN", ""),
+		CredentialsEnabled:    getEnvBool("CREDENTIALS_ENABLED", false),
+		EncryptionProvider:    getEnv("ENCRYPTION_PROVIDER", ""),
+		EncryptionKeys:        getEnvMap("ENCRYPTION_KEYS"),
+		EncryptionActiveKey:   getEnv("ENCRYPTION_ACTIVE_KEY", ""),
+		EncryptionVaultAddr:   getEnv("ENCRYPTION_VAULT_ADDR", "http://vault.vault.svc:8200"),
+		EncryptionVaultToken:  getEnv("ENCRYPTION_VAULT_TOKEN", ""),
+		EncryptionVaultMount:  getEnv("ENCRYPTION_VAULT_MOUNT", "transit"),
+		EncryptionVaultKey:    getEnv("ENCRYPTION_VAULT_KEY", "platform"),
+		OPAEnabled:            getEnvBool("OPA_ENABLED", false),
+		OPAURL:                getEnv("OPA_URL", "http://localhost:8181"),
+		OPAAuthzPath:          getEnv("OPA_AUTHZ_PATH", "platform/authz"),
+		OPAAdmissionPath:      getEnv("OPA_ADMISSION_PATH", "platform/admission"),
+		OPAPolicyNamespace:    getEnv("OPA_POLICY_NAMESPACE", ""),
+		OPAFailOpen:           getEnvBool("OPA_FAIL_OPEN", false),
+		OPALogAllowed:         getEnvBool("OPA_LOG_ALLOWED", false),
+		OAuth2TokenURL:        getEnv("OAUTH2_TOKEN_URL", ""),
+		OAuth2ClientID:        getEnv("OAUTH2_CLIENT_ID", ""),
+		OAuth2ClientSecret:    getEnv("OAUTH2_CLIENT_SECRET", ""),
+		OAuth2Scopes:          getEnvList("OAUTH2_SCOPES"),
+		OAuth2Audience:        getEnv("OAUTH2_AUDIENCE", ""),
+		OAuth2Clients:         getEnvList("OAUTH2_CLIENTS"),
+		SessionsEnabled:       getEnvBool("SESSIONS_ENABLED", false),
+		OIDCIssuerURL:         getEnv("OIDC_ISSUER_URL", ""),
+		OIDCClientID:          getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:      getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:       getEnv("OIDC_REDIRECT_URL", ""),
+		OIDCScopes:            getEnvList("OIDC_SCOPES"),
+		OIDCUserClaim:         getEnv("OIDC_USER_CLAIM", "preferred_username"),
+		OIDCGroupsClaim:       getEnv("OIDC_GROUPS_CLAIM", "groups"),
+		OIDCKeysRefresh:       getEnvDuration("OIDC_JWKS_REFRESH_INTERVAL", 15*time.Minute),
+		OIDCKeysGrace:         getEnvDuration("OIDC_JWKS_GRACE_PERIOD", time.Hour),
+		SessionSecrets:        getEnvList("SESSION_SECRETS"),
+		SessionCookieName:     getEnv("SESSION_COOKIE_NAME", "platform_session"),
+		SessionIdleTimeout:    getEnvDuration("SESSION_IDLE_TIMEOUT", time.Hour),
+		SessionMaxAge:         getEnvDuration("SESSION_MAX_AGE", 12*time.Hour),
+		SessionSameSite:       getEnv("SESSION_SAME_SITE", "lax"),
+		SessionInsecure:       getEnvBool("SESSION_INSECURE_COOKIES", false),
+		SPIFFEEnabled:         getEnvBool("SPIFFE_ENABLED", false),
+		SPIFFEEndpointSocket:  getEnv("SPIFFE_ENDPOINT_SOCKET", "unix:///run/spire/sockets/agent.sock"),
+		SPIFFETrustDomains:    getEnvList("SPIFFE_TRUST_DOMAINS"),
+		SPIFFEPrincipals:      getEnvMap("SPIFFE_PRINCIPALS"),
+		SPIFFEGroups:          getEnvList("SPIFFE_GROUPS"),
+		AbuseProtection:       getEnvBool("ABUSE_PROTECTION_ENABLED", false),
+		AbuseMaxFailures:      getEnvInt("ABUSE_MAX_FAILURES", 10),
+		AbuseFailureWindow:    getEnvDuration("ABUSE_FAILURE_WINDOW", 10*time.Minute),
+		AbuseLockout:          getEnvDuration("ABUSE_LOCKOUT", time.Minute),
+		AbuseMaxLockout:       getEnvDuration("ABUSE_MAX_LOCKOUT", time.Hour),
+		AbuseSpikeMin:         getEnvInt("ABUSE_SPIKE_MIN", 50),
+		AbuseSpikeFactor:      getEnvFloat("ABUSE_SPIKE_FACTOR", 4),
+		PodLogsMaxTailLines:   getEnvInt("POD_LOGS_MAX_TAIL_LINES", 5000),
+		NodeMetricsEnabled:    getEnvBool("NODE_METRICS_ENABLED", true),
+
+		FeatureFlags:          getEnvMap("FEATURE_FLAGS"),
+		FeatureFlagsConfigMap: getEnv("FEATURE_FLAGS_CONFIGMAP", ""),
+
+		LocksEnabled:    getEnvBool("LOCKS_ENABLED", false),
+		LocksNamespace:  getEnv("LOCKS_NAMESPACE", ""),
+		LocksDefaultTTL: getEnvDuration("LOCKS_DEFAULT_TTL", time.Minute),
+		LocksMaxTTL:     getEnvDuration("LOCKS_MAX_TTL", time.Hour),
+
+		ArgoCDURL:   getEnv("ARGOCD_URL", ""),
+		ArgoCDToken: getEnv("ARGOCD_TOKEN", ""),
+
+		HelmInventoryEnabled: getEnvBool("HELM_INVENTORY_ENABLED", false),
+		HelmRepositories:     getEnvMap("HELM_REPOSITORIES"),
+		HelmRepoRefresh:      getEnvDuration("HELM_REPO_REFRESH", 15*time.Minute),
+
+		CatalogEnabled: getEnvBool("CATALOG_ENABLED", false),
+
+		OnboardingEnabled:          getEnvBool("ONBOARDING_ENABLED", false),
+		OnboardingDefaultQuota:     getEnvMap("ONBOARDING_DEFAULT_QUOTA"),
+		OnboardingPullSecret:       getEnv("ONBOARDING_PULL_SECRET", ""),
+		OnboardingIngressNamespace: getEnv("ONBOARDING_INGRESS_NAMESPACE", ""),
+		OnboardingTimeout:          getEnvDuration("ONBOARDING_TIMEOUT", 2*time.Minute),
+
+		JobsEnabled:       getEnvBool("JOBS_ENABLED", false),
+		JobsTemplatesFile: getEnv("JOBS_TEMPLATES_FILE", "/etc/platform/job-templates.json"),
+		JobsTTL:           getEnvDuration("JOBS_TTL", time.Hour),
+
+		QuotaReportEnabled:     getEnvBool("QUOTA_REPORT_ENABLED", false),
+		QuotaReportInterval:    getEnvDuration("QUOTA_REPORT_INTERVAL", 5*time.Minute),
+		QuotaHistoryRetention:  getEnvDuration("QUOTA_HISTORY_RETENTION", 7*24*time.Hour),
+		QuotaWarnThreshold:     getEnvFloat("QUOTA_WARN_THRESHOLD", 0.8),
+		QuotaCriticalThreshold: getEnvFloat("QUOTA_CRITICAL_THRESHOLD", 0.95),
+
+		NodeOpsEnabled:         getEnvBool("NODE_OPS_ENABLED", false),
+		NodeOpsGroups:          getEnvList("NODE_OPS_GROUPS"),
+		NodeOpsEvictionTimeout: getEnvDuration("NODE_OPS_EVICTION_TIMEOUT", 2*time.Minute),
+		NodeOpsDrainTimeout:    getEnvDuration("NODE_OPS_DRAIN_TIMEOUT", 15*time.Minute),
+
+		RegistryEnabled:         getEnvBool("REGISTRY_ENABLED", false),
+		Registries:              getEnvMap("REGISTRIES"),
+		RegistryCredentialsFile: getEnv("REGISTRY_CREDENTIALS_FILE", ""),
+		RegistryRefresh:         getEnvDuration("REGISTRY_REFRESH", 15*time.Minute),
+
+		CostsEnabled:        getEnvBool("COSTS_ENABLED", false),
+		CostsCurrency:       getEnv("COSTS_CURRENCY", "USD"),
+		CostsCPUCoreHour:    getEnvFloat("COSTS_CPU_CORE_HOUR", 0.0316),
+		CostsMemoryGiBHour:  getEnvFloat("COSTS_MEMORY_GIB_HOUR", 0.0042),
+		CostsPricingURL:     getEnv("COSTS_PRICING_URL", ""),
+		CostsPricingRefresh: getEnvDuration("COSTS_PRICING_REFRESH", time.Hour),
+
+		PodExecEnabled:      getEnvBool("POD_EXEC_ENABLED", false),
+		PodExecCommands:     getEnvList("POD_EXEC_COMMANDS"),
+		PodExecMaxDuration:  getEnvDuration("POD_EXEC_MAX_DURATION", time.Hour),
+		PodExecRecordingDir: getEnv("POD_EXEC_RECORDING_DIR", ""),
+
+		PDBsEnabled:      getEnvBool("PDBS_ENABLED", false),
+		PDBTemplatesFile: getEnv("PDB_TEMPLATES_FILE", ""),
+
+		KustomizeEnabled:      getEnvBool("KUSTOMIZE_ENABLED", false),
+		KustomizeRepositories: getEnvMap("KUSTOMIZE_REPOSITORIES"),
+		KustomizeToken:        getEnv("KUSTOMIZE_TOKEN", ""),
+
+		ScaffoldEnabled:        getEnvBool("SCAFFOLD_ENABLED", false),
+		ScaffoldRegistry:       getEnv("SCAFFOLD_REGISTRY", ""),
+		ScaffoldGitURL:         getEnv("SCAFFOLD_GIT_URL", ""),
+		ScaffoldGitBaseBranch:  getEnv("SCAFFOLD_GIT_BASE_BRANCH", "main"),
+		ScaffoldGitUsername:    getEnv("SCAFFOLD_GIT_USERNAME", ""),
+		ScaffoldGitToken:       getEnv("SCAFFOLD_GIT_TOKEN", ""),
+		ScaffoldGitAuthorName:  getEnv("SCAFFOLD_GIT_AUTHOR_NAME", "Platform Scaffolder"),
+		ScaffoldGitAuthorEmail: getEnv("SCAFFOLD_GIT_AUTHOR_EMAIL", "platform@localhost"),
+
+		InfraEnabled:        getEnvBool("INFRA_ENABLED", false),
+		InfraWorkspacesFile: getEnv("INFRA_WORKSPACES_FILE", "/etc/platform/infra-workspaces.json"),
+		InfraGroups:         getEnvList("INFRA_GROUPS"),
+		TFCURL:              getEnv("TFC_URL", "https://app.terraform.io"),
+		TFCOrganization:     getEnv("TFC_ORGANIZATION", ""),
+		TFCToken:            getEnv("TFC_TOKEN", ""),
+		AtlantisURL:         getEnv("ATLANTIS_URL", ""),
+		AtlantisToken:       getEnv("ATLANTIS_TOKEN", ""),
+		AtlantisVCS:         getEnv("ATLANTIS_VCS", "Github"),
+		AtlantisTimeout:     getEnvDuration("ATLANTIS_TIMEOUT", 30*time.Minute),
+
+		ControllerEnabled:        getEnvBool("CONTROLLER_ENABLED", false),
+		ControllerLeaderElection: getEnvBool("CONTROLLER_LEADER_ELECTION", true),
+
+		AdmissionEnabled:    getEnvBool("ADMISSION_ENABLED", false),
+		AdmissionPort:       getEnvInt("ADMISSION_PORT", 8443),
+		AdmissionCertFile:   getEnv("ADMISSION_CERT_FILE", "/etc/admission/tls.crt"),
+		AdmissionKeyFile:    getEnv("ADMISSION_KEY_FILE", "/etc/admission/tls.key"),
+		AdmissionPolicyFile: getEnv("ADMISSION_POLICY_FILE", ""),
+
+		CustomMetricsEnabled:    getEnvBool("CUSTOM_METRICS_ENABLED", false),
+		CustomMetricsPort:       getEnvInt("CUSTOM_METRICS_PORT", 6443),
+		CustomMetricsCertFile:   getEnv("CUSTOM_METRICS_CERT_FILE", "/etc/custom-metrics/tls.crt"),
+		CustomMetricsKeyFile:    getEnv("CUSTOM_METRICS_KEY_FILE", "/etc/custom-metrics/tls.key"),
+		CustomMetrics:           getEnvMap("CUSTOM_METRICS"),
+		CustomMetricsScrapePort: getEnvInt("CUSTOM_METRICS_SCRAPE_PORT", 9091),
+
+		ProxyRoutesFile: getEnv("PROXY_ROUTES_FILE", ""),
+	}
+	cfg.malformed = takeMalformed()
+	return cfg
+}
+
+// TLSEnabled reports whether a certificate and key are configured.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// inClusterNamespace returns the pod's namespace from the mounted service
+// account token, or "" outside a cluster.
+func inClusterNamespace() string {
+	b, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
+	if err != nil {
+		return ""
 	}
+	return strings.TrimSpace(string(b))
 }
 
 // getEnv retrieves an environment variable or returns a default value.
@@ -57,19 +1118,70 @@ func getEnv(key, defaultValue string) string {
 // getEnvInt retrieves an integer environment variable or returns a default value.
 func getEnvInt(key string, defaultValue int) int {
 	if value, exists := os.LookupEnv(key); exists {
-		if intVal, err := strconv.Atoi(value); err == nil {
+		intVal, err := strconv.Atoi(value)
+		if err == nil {
 			return intVal
 		}
+		recordMalformed(key, err)
 	}
 	return defaultValue
 }
 
+// getEnvFloat retrieves a float environment variable or returns a default value.
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value, exists := os.LookupEnv(key); exists {
+		floatVal, err := strconv.ParseFloat(value, 64)
+		if err == nil {
+			return floatVal
+		}
+		recordMalformed(key, err)
+	}
+	return defaultValue
+}
+
+// getEnvBool retrieves a boolean environment variable or returns a default value.
+func getEnvBool(key string, defaultValue bool) bool {
+	if value, exists := os.LookupEnv(key); exists {
+		boolVal, err := strconv.ParseBool(value)
+		if err == nil {
+			return boolVal
+		}
+		recordMalformed(key, err)
+	}
+	return defaultValue
+}
+
+// getEnvMap parses a "key=value,key=value" environment variable.
+func getEnvMap(key string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && k != "" {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// getEnvList parses a comma-separated environment variable.
+func getEnvList(key string) []string {
+	var result []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
 // getEnvDuration retrieves a duration environment variable or returns a default value.
 func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
 	if value, exists := os.LookupEnv(key); exists {
-		if duration, err := time.ParseDuration(value); err == nil {
+		duration, err := time.ParseDuration(value)
+		if err == nil {
 			return duration
 		}
+		recordMalformed(key, err)
 	}
 	return defaultValue
 }
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Validate reports the settings that keep the service from starting:
+// unknown choices and features enabled without the settings they need.
+// It does not open the files or reach the services the settings name.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, msg string) {
+		if !ok {
+			errs = append(errs, errors.New(msg))
+		}
+	}
+	oneOf := func(key, value string, allowed ...string) {
+		if !slices.Contains(allowed, value) {
+			errs = append(errs, fmt.Errorf("%s must be one of %v, got %q", key, allowed, value))
+		}
+	}
+
+	oneOf("RUN_MODE", c.Mode, ModeAPI, ModeController, ModeMigrate, ModeVerifyAudit)
+	oneOf("STORE_BACKEND", c.StoreBackend, StoreMemory, StorePostgres)
+	oneOf("EVENTS_BACKEND", c.EventsBackend, EventsMemory, EventsNATS)
+	check(c.StoreSeedFile == "" || c.StoreBackend == StoreMemory, "STORE_SEED_FILE requires STORE_BACKEND=memory")
+	check(!c.DevMode || c.Environment != "production", "DEV_MODE cannot run with ENVIRONMENT=production")
+	for _, cidr := range c.AuthProxyTrustedCIDRs {
+		_, err := netip.ParsePrefix(cidr)
+		check(err == nil, fmt.Sprintf("AUTH_PROXY_TRUSTED_CIDRS: invalid CIDR %q", cidr))
+	}
+	if c.AuthProxyClientCAFile != "" {
+		check(c.TLSEnabled(), "AUTH_PROXY_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE")
+		check(!c.SPIFFEEnabled, "AUTH_PROXY_CLIENT_CA_FILE cannot be combined with SPIFFE_ENABLED, which verifies client certificates itself")
+	}
+
+	if c.SIEMEnabled {
+		check(c.SIEMURL != "", "SIEM_ENABLED requires SIEM_URL")
+		oneOf("SIEM_FORMAT", c.SIEMFormat, "json", "cef")
+		oneOf("SIEM_BACKEND", c.SIEMBackend, "splunk", "elastic")
+		check(c.SIEMBackend != "elastic" || c.SIEMIndex != "", "SIEM_BACKEND=elastic requires SIEM_INDEX")
+	}
+	if c.KafkaEnabled {
+		check(len(c.KafkaBrokers) > 0, "KAFKA_ENABLED requires KAFKA_BROKERS")
+		if c.KafkaUsername != "" {
+			oneOf("KAFKA_SASL_MECHANISM", c.KafkaSASLMechanism, "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512")
+		}
+	}
+	if len(c.OAuth2Clients) > 0 {
+		check(c.OAuth2TokenURL != "" && c.OAuth2ClientID != "", "OAUTH2_CLIENTS requires OAUTH2_TOKEN_URL and OAUTH2_CLIENT_ID")
+	}
+
+	if c.RBACEnabled {
+		check(len(c.RBACGroupRoles) > 0, "RBAC_ENABLED requires RBAC_GROUP_ROLES")
+	}
+	check(!c.TokensEnabled || c.RBACEnabled, "TOKENS_ENABLED requires RBAC_ENABLED")
+	check(!c.TokensEnabled || c.SCIMURL != "", "TOKENS_ENABLED requires SCIM_URL to look up token owners' groups")
+	check(!c.CredentialsEnabled || c.RBACEnabled, "CREDENTIALS_ENABLED requires RBAC_ENABLED")
+	if len(c.WebhookDispatchURLs) > 0 {
+		check(c.RBACEnabled, "WEBHOOK_DISPATCH_URLS requires RBAC_ENABLED")
+		oneOf("WEBHOOK_SIGNING_ALGORITHM", c.WebhookSigningAlgorithm, "hmac-sha256", "ed25519")
+	}
+	if c.SessionsEnabled {
+		check(c.OIDCIssuerURL != "" && c.OIDCClientID != "" && c.OIDCRedirectURL != "",
+			"SESSIONS_ENABLED requires OIDC_ISSUER_URL, OIDC_CLIENT_ID and OIDC_REDIRECT_URL")
+		oneOf("SESSION_SAME_SITE", c.SessionSameSite, "lax", "strict")
+	}
+	if c.QueueEnabled {
+		check(len(c.QueueAdminGroups) > 0, "QUEUE_ENABLED requires QUEUE_ADMIN_GROUPS")
+	}
+	if c.ResourcesAPIEnabled {
+		check(len(c.ResourcesAdminGroups) > 0, "RESOURCES_API_ENABLED requires RESOURCES_ADMIN_GROUPS")
+	}
+	if c.BackupEnabled {
+		check(len(c.BackupAdminGroups) > 0, "BACKUP_ENABLED requires BACKUP_ADMIN_GROUPS")
+	}
+
+	// Features served from the cluster
+	for _, f := range []struct {
+		enabled bool
+		key     string
+	}{
+		{c.HelmInventoryEnabled, "HELM_INVENTORY_ENABLED"},
+		{c.CatalogEnabled, "CATALOG_ENABLED"},
+		{c.OnboardingEnabled, "ONBOARDING_ENABLED"},
+		{c.JobsEnabled, "JOBS_ENABLED"},
+		{c.QuotaReportEnabled, "QUOTA_REPORT_ENABLED"},
+		{c.NodeOpsEnabled, "NODE_OPS_ENABLED"},
+		{c.RegistryEnabled, "REGISTRY_ENABLED"},
+		{c.CostsEnabled, "COSTS_ENABLED"},
+		{c.PodExecEnabled, "POD_EXEC_ENABLED"},
+		{c.PDBsEnabled, "PDBS_ENABLED"},
+		{c.LocksEnabled, "LOCKS_ENABLED"},
+		{c.CustomMetricsEnabled, "CUSTOM_METRICS_ENABLED"},
+		{c.FeatureFlagsConfigMap != "", "FEATURE_FLAGS_CONFIGMAP"},
+		{c.OPAEnabled && c.OPAPolicyNamespace != "", "OPA_POLICY_NAMESPACE"},
+		{c.ControllerEnabled, "CONTROLLER_ENABLED"},
+		{c.ArgoCDURL != "", "ARGOCD_URL"},
+	} {
+		check(!f.enabled || c.KubeEnabled, f.key+" requires KUBE_ENABLED")
+	}
+	if c.NodeOpsEnabled {
+		check(len(c.NodeOpsGroups) > 0, "NODE_OPS_ENABLED requires NODE_OPS_GROUPS")
+	}
+	if c.PodExecEnabled {
+		check(len(c.PodExecCommands) > 0, "POD_EXEC_ENABLED requires POD_EXEC_COMMANDS")
+	}
+	if c.LocksEnabled {
+		check(c.LocksNamespace != "" || c.PodNamespace != "", "LOCKS_ENABLED requires LOCKS_NAMESPACE or POD_NAMESPACE")
+	}
+
+	for pattern, value := range c.LatencyBudgets {
+		if _, err := time.ParseDuration(value); err != nil {
+			errs = append(errs, fmt.Errorf("LATENCY_BUDGETS: route %q: %w", pattern, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Malformed returns the environment variables Load could not parse. Each
+// fell back to its default, so the service still starts.
+func (c *Config) Malformed() []error {
+	return c.malformed
+}
+
+// malformed collects the parse errors of the Load in progress.
+var malformed struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+func recordMalformed(key string, err error) {
+	malformed.mu.Lock()
+	defer malformed.mu.Unlock()
+	malformed.errs = append(malformed.errs, fmt.Errorf("%s: %w", key, err))
+}
+
+// takeMalformed returns and clears the collected parse errors.
+func takeMalformed() []error {
+	malformed.mu.Lock()
+	defer malformed.mu.Unlock()
+	errs := malformed.errs
+	malformed.errs = nil
+	return errs
+}
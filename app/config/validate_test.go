@@ -0,0 +1,52 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	t.Setenv("JOBS_ENABLED", "true")
+	t.Setenv("SESSION_SAME_SITE", "none")
+	t.Setenv("SESSIONS_ENABLED", "true")
+	t.Setenv("PORT", "abc")
+	t.Setenv("DEV_MODE", "true")
+	t.Setenv("ENVIRONMENT", "production")
+	t.Setenv("AUTH_PROXY_TRUSTED_CIDRS", "10.0.0.0/8,proxy")
+	t.Setenv("KAFKA_ENABLED", "true")
+	cfg := Load()
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected errors")
+	}
+	for _, want := range []string{
+		"JOBS_ENABLED requires KUBE_ENABLED",
+		"SESSIONS_ENABLED requires OIDC_ISSUER_URL",
+		`SESSION_SAME_SITE must be one of [lax strict], got "none"`,
+		"DEV_MODE cannot run with ENVIRONMENT=production",
+		`AUTH_PROXY_TRUSTED_CIDRS: invalid CIDR "proxy"`,
+		"KAFKA_ENABLED requires KAFKA_BROKERS",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %v", want, err)
+		}
+	}
+	if cfg.Port != 9090 || len(cfg.Malformed()) != 1 || !strings.HasPrefix(cfg.Malformed()[0].Error(), "PORT: ") {
+		t.Errorf("expected PORT to fall back to 9090 and be reported, got %d and %v", cfg.Port, cfg.Malformed())
+	}
+
+	if err := Load().Validate(); err == nil || len(Load().Malformed()) != 1 {
+		t.Errorf("expected each Load to report its own malformed settings")
+	}
+}
+
+func TestValidateDefaults(t *testing.T) {
+	cfg := Load()
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected the defaults to be valid, got %v", err)
+	}
+	if len(cfg.Malformed()) != 0 {
+		t.Errorf("expected no malformed settings, got %v", cfg.Malformed())
+	}
+}
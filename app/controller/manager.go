@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/go-logr/zapr"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	platformv1alpha1 "github.com/virenpatel/k8s-platform-engineering-lab/app/api/v1alpha1"
+)
+
+// Options configures the controller manager.
+type Options struct {
+	// LeaderElection ensures only one replica reconciles at a time.
+	LeaderElection          bool
+	LeaderElectionNamespace string
+	LeaderElectionID        string
+}
+
+// NewScheme returns a scheme with the built-in and platform types.
+func NewScheme() (*runtime.Scheme, error) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	if err := platformv1alpha1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	return scheme, nil
+}
+
+// NewManager builds a controller-runtime manager with every platform
+// reconciler registered. Start it with Manager.Start.
+func NewManager(cfg *rest.Config, opts Options, logger *zap.Logger) (ctrl.Manager, error) {
+	ctrl.SetLogger(zapr.NewLogger(logger.Named("controller")))
+
+	scheme, err := NewScheme()
+	if err != nil {
+		return nil, fmt.Errorf("controller: build scheme: %w", err)
+	}
+
+	id := opts.LeaderElectionID
+	if id == "" {
+		id = "platform-api-controller"
+	}
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme: scheme,
+		// Metrics and probes are served by the admin listener, which also
+		// gathers controller-runtime's metrics registry.
+		Metrics:                       metricsserver.Options{BindAddress: "0"},
+		HealthProbeBindAddress:        "0",
+		LeaderElection:                opts.LeaderElection,
+		LeaderElectionID:              id,
+		LeaderElectionNamespace:       opts.LeaderElectionNamespace,
+		LeaderElectionReleaseOnCancel: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("controller: create manager: %w", err)
+	}
+
+	if err := (&PlatformServiceReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		return nil, fmt.Errorf("controller: setup platformservice: %w", err)
+	}
+	return mgr, nil
+}
@@ -0,0 +1,286 @@
+// Package controller holds the reconcilers that turn platform custom
+// resources into native Kubernetes objects, making the service a platform
+// operator.
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	platformv1alpha1 "github.com/virenpatel/k8s-platform-engineering-lab/app/api/v1alpha1"
+)
+
+const (
+	defaultPort    = 8080
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedByValue = "platform-api"
+	nameLabel      = "app.kubernetes.io/name"
+)
+
+var serviceMonitorGVK = schema.GroupVersionKind{
+	Group:   "monitoring.coreos.com",
+	Version: "v1",
+	Kind:    "ServiceMonitor",
+}
+
+// PlatformServiceReconciler materialises PlatformService resources.
+type PlatformServiceReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// SetupWithManager registers the reconciler and the owned types it watches.
+func (r *PlatformServiceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&platformv1alpha1.PlatformService{}).
+		Owns(&appsv1.Deployment{}).
+		Owns(&corev1.Service{}).
+		Owns(&networkingv1.Ingress{}).
+		Named("platformservice").
+		Complete(r)
+}
+
+// Reconcile brings the owned objects in line with the PlatformService spec
+// and reports rollout status.
+func (r *PlatformServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	var ps platformv1alpha1.PlatformService
+	if err := r.Get(ctx, req.NamespacedName, &ps); err != nil {
+		// Deleted: owned objects are garbage collected via owner references
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	deploy, err := r.reconcileDeployment(ctx, &ps)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("reconcile deployment: %w", err)
+	}
+	if err := r.reconcileService(ctx, &ps); err != nil {
+		return ctrl.Result{}, fmt.Errorf("reconcile service: %w", err)
+	}
+	if err := r.reconcileIngress(ctx, &ps); err != nil {
+		return ctrl.Result{}, fmt.Errorf("reconcile ingress: %w", err)
+	}
+	if err := r.reconcileServiceMonitor(ctx, &ps); err != nil {
+		if !meta.IsNoMatchError(err) {
+			return ctrl.Result{}, fmt.Errorf("reconcile servicemonitor: %w", err)
+		}
+		logger.Info("prometheus operator not installed, skipping ServiceMonitor")
+	}
+
+	return ctrl.Result{}, r.updateStatus(ctx, &ps, deploy)
+}
+
+func labelsFor(ps *platformv1alpha1.PlatformService) map[string]string {
+	return map[string]string{
+		nameLabel:      ps.Name,
+		managedByLabel: managedByValue,
+	}
+}
+
+func portFor(ps *platformv1alpha1.PlatformService) int32 {
+	if ps.Spec.Port > 0 {
+		return ps.Spec.Port
+	}
+	return defaultPort
+}
+
+func (r *PlatformServiceReconciler) reconcileDeployment(ctx context.Context, ps *platformv1alpha1.PlatformService) (*appsv1.Deployment, error) {
+	deploy := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: ps.Name, Namespace: ps.Namespace}}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, deploy, func() error {
+		labels := labelsFor(ps)
+		replicas := int32(1)
+		if ps.Spec.Replicas != nil {
+			replicas = *ps.Spec.Replicas
+		}
+
+		deploy.Labels = labels
+		deploy.Spec.Replicas = &replicas
+		deploy.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{nameLabel: ps.Name}}
+		deploy.Spec.Template.Labels = labels
+
+		container := corev1.Container{
+			Name:      "app",
+			Image:     ps.Spec.Image,
+			Ports:     []corev1.ContainerPort{{Name: "http", ContainerPort: portFor(ps)}},
+			Env:       ps.Spec.Env,
+			Resources: ps.Spec.Resources,
+		}
+		// Keep fields defaulted by the API server (e.g. imagePullPolicy)
+		// from being reset on every reconcile.
+		if existing := deploy.Spec.Template.Spec.Containers; len(existing) == 1 {
+			container.ImagePullPolicy = existing[0].ImagePullPolicy
+			container.TerminationMessagePath = existing[0].TerminationMessagePath
+			container.TerminationMessagePolicy = existing[0].TerminationMessagePolicy
+		}
+		deploy.Spec.Template.Spec.Containers = []corev1.Container{container}
+
+		return controllerutil.SetControllerReference(ps, deploy, r.Scheme)
+	})
+	return deploy, err
+}
+
+func (r *PlatformServiceReconciler) reconcileService(ctx context.Context, ps *platformv1alpha1.PlatformService) error {
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: ps.Name, Namespace: ps.Namespace}}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, svc, func() error {
+		svc.Labels = labelsFor(ps)
+		svc.Spec.Selector = map[string]string{nameLabel: ps.Name}
+		svc.Spec.Ports = []corev1.ServicePort{{
+			Name:       "http",
+			Port:       80,
+			TargetPort: intstr.FromString("http"),
+			Protocol:   corev1.ProtocolTCP,
+		}}
+		if obs := ps.Spec.Observability; obs != nil && obs.MetricsPort > 0 && obs.MetricsPort != portFor(ps) {
+			svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{
+				Name:       "metrics",
+				Port:       obs.MetricsPort,
+				TargetPort: intstr.FromInt32(obs.MetricsPort),
+				Protocol:   corev1.ProtocolTCP,
+			})
+		}
+		return controllerutil.SetControllerReference(ps, svc, r.Scheme)
+	})
+	return err
+}
+
+func (r *PlatformServiceReconciler) reconcileIngress(ctx context.Context, ps *platformv1alpha1.PlatformService) error {
+	ing := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: ps.Name, Namespace: ps.Namespace}}
+	spec := ps.Spec.Ingress
+	if spec == nil {
+		return r.deleteOwned(ctx, ps, ing)
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, ing, func() error {
+		path := spec.Path
+		if path == "" {
+			path = "/"
+		}
+		pathType := networkingv1.PathTypePrefix
+
+		ing.Labels = labelsFor(ps)
+		ing.Spec = networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{{
+				Host: spec.Host,
+				IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+					Paths: []networkingv1.HTTPIngressPath{{
+						Path:     path,
+						PathType: &pathType,
+						Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+							Name: ps.Name,
+							Port: networkingv1.ServiceBackendPort{Name: "http"},
+						}},
+					}},
+				}},
+			}},
+		}
+		if spec.ClassName != "" {
+			ing.Spec.IngressClassName = &spec.ClassName
+		}
+		if spec.TLSSecretName != "" {
+			ing.Spec.TLS = []networkingv1.IngressTLS{{Hosts: []string{spec.Host}, SecretName: spec.TLSSecretName}}
+		}
+		return controllerutil.SetControllerReference(ps, ing, r.Scheme)
+	})
+	return err
+}
+
+// reconcileServiceMonitor uses an unstructured object so the Prometheus
+// Operator types are not a build dependency.
+func (r *PlatformServiceReconciler) reconcileServiceMonitor(ctx context.Context, ps *platformv1alpha1.PlatformService) error {
+	sm := &unstructured.Unstructured{}
+	sm.SetGroupVersionKind(serviceMonitorGVK)
+	sm.SetName(ps.Name)
+	sm.SetNamespace(ps.Namespace)
+
+	obs := ps.Spec.Observability
+	if obs == nil || !obs.Metrics {
+		return r.deleteOwned(ctx, ps, sm)
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, sm, func() error {
+		port := "http"
+		if obs.MetricsPort > 0 && obs.MetricsPort != portFor(ps) {
+			port = "metrics"
+		}
+		path := obs.MetricsPath
+		if path == "" {
+			path = "/metrics"
+		}
+		endpoint := map[string]any{"port": port, "path": path}
+		if obs.ScrapeInterval != "" {
+			endpoint["interval"] = obs.ScrapeInterval
+		}
+
+		sm.SetLabels(labelsFor(ps))
+		if err := unstructured.SetNestedField(sm.Object, map[string]any{
+			"selector":  map[string]any{"matchLabels": map[string]any{nameLabel: ps.Name}},
+			"endpoints": []any{endpoint},
+		}, "spec"); err != nil {
+			return err
+		}
+		return controllerutil.SetControllerReference(ps, sm, r.Scheme)
+	})
+	return err
+}
+
+// deleteOwned deletes obj, named by its key, only if ps controls it: an
+// object with the same name created by someone else is left alone.
+func (r *PlatformServiceReconciler) deleteOwned(ctx context.Context, ps *platformv1alpha1.PlatformService, obj client.Object) error {
+	if err := r.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(obj, ps) {
+		return nil
+	}
+	// The precondition keeps a replacement created since the Get
+	uid := obj.GetUID()
+	return client.IgnoreNotFound(r.Delete(ctx, obj, client.Preconditions{UID: &uid}))
+}
+
+func (r *PlatformServiceReconciler) updateStatus(ctx context.Context, ps *platformv1alpha1.PlatformService, deploy *appsv1.Deployment) error {
+	desired := int32(1)
+	if deploy.Spec.Replicas != nil {
+		desired = *deploy.Spec.Replicas
+	}
+
+	ps.Status.ObservedGeneration = ps.Generation
+	ps.Status.ReadyReplicas = deploy.Status.ReadyReplicas
+	ps.Status.URL = ""
+	if ing := ps.Spec.Ingress; ing != nil {
+		scheme := "http"
+		if ing.TLSSecretName != "" {
+			scheme = "https"
+		}
+		ps.Status.URL = scheme + "://" + ing.Host
+	}
+
+	cond := metav1.Condition{
+		Type:               platformv1alpha1.ConditionReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             "RollingOut",
+		Message:            fmt.Sprintf("%d/%d replicas ready", deploy.Status.ReadyReplicas, desired),
+		ObservedGeneration: ps.Generation,
+	}
+	if deploy.Status.ReadyReplicas >= desired {
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = "Available"
+	}
+	meta.SetStatusCondition(&ps.Status.Conditions, cond)
+
+	return r.Status().Update(ctx, ps)
+}
@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	platformv1alpha1 "github.com/virenpatel/k8s-platform-engineering-lab/app/api/v1alpha1"
+)
+
+func TestReconcileMaterialisesObjects(t *testing.T) {
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	replicas := int32(3)
+	ps := &platformv1alpha1.PlatformService{
+		ObjectMeta: metav1.ObjectMeta{Name: "billing", Namespace: "team-a", Generation: 1},
+		Spec: platformv1alpha1.PlatformServiceSpec{
+			Image:    "registry.internal/billing:1.2.0",
+			Replicas: &replicas,
+			Ingress:  &platformv1alpha1.IngressSpec{Host: "billing.example.com", TLSSecretName: "billing-tls"},
+		},
+	}
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(ps).
+		WithStatusSubresource(ps).
+		Build()
+	r := &PlatformServiceReconciler{Client: c, Scheme: scheme}
+
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "team-a", Name: "billing"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var deploy appsv1.Deployment
+	if err := c.Get(ctx, key, &deploy); err != nil {
+		t.Fatalf("expected deployment: %v", err)
+	}
+	if *deploy.Spec.Replicas != 3 {
+		t.Errorf("expected 3 replicas, got %d", *deploy.Spec.Replicas)
+	}
+	if img := deploy.Spec.Template.Spec.Containers[0].Image; img != ps.Spec.Image {
+		t.Errorf("expected image %s, got %s", ps.Spec.Image, img)
+	}
+	if len(deploy.OwnerReferences) != 1 || deploy.OwnerReferences[0].Name != "billing" {
+		t.Errorf("expected owner reference to billing, got %+v", deploy.OwnerReferences)
+	}
+
+	if err := c.Get(ctx, key, &corev1.Service{}); err != nil {
+		t.Errorf("expected service: %v", err)
+	}
+	if err := c.Get(ctx, key, &networkingv1.Ingress{}); err != nil {
+		t.Errorf("expected ingress: %v", err)
+	}
+
+	var got platformv1alpha1.PlatformService
+	if err := c.Get(ctx, key, &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Status.URL != "https://billing.example.com" {
+		t.Errorf("expected https URL, got %q", got.Status.URL)
+	}
+	if meta.IsStatusConditionTrue(got.Status.Conditions, platformv1alpha1.ConditionReady) {
+		t.Error("expected Ready=False before replicas are ready")
+	}
+}
+
+func TestReconcileLeavesUnownedObjects(t *testing.T) {
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// No ingress or metrics in the spec, but objects of the same name
+	// created by someone else exist
+	ps := &platformv1alpha1.PlatformService{
+		ObjectMeta: metav1.ObjectMeta{Name: "billing", Namespace: "team-a", Generation: 1, UID: "ps-uid"},
+		Spec:       platformv1alpha1.PlatformServiceSpec{Image: "registry.internal/billing:1.2.0"},
+	}
+	ing := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "billing", Namespace: "team-a"}}
+	sm := &unstructured.Unstructured{}
+	sm.SetGroupVersionKind(serviceMonitorGVK)
+	sm.SetName("billing")
+	sm.SetNamespace("team-a")
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(ps, ing, sm).
+		WithStatusSubresource(ps).
+		Build()
+	r := &PlatformServiceReconciler{Client: c, Scheme: scheme}
+
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "team-a", Name: "billing"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.Get(ctx, key, &networkingv1.Ingress{}); err != nil {
+		t.Errorf("expected the unowned ingress to survive: %v", err)
+	}
+	got := &unstructured.Unstructured{}
+	got.SetGroupVersionKind(serviceMonitorGVK)
+	if err := c.Get(ctx, key, got); err != nil {
+		t.Errorf("expected the unowned ServiceMonitor to survive: %v", err)
+	}
+
+	// Once the PlatformService controls the ingress, dropping it deletes it
+	owned := &networkingv1.Ingress{}
+	if err := c.Get(ctx, key, owned); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ctrl.SetControllerReference(ps, owned, scheme); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.Update(ctx, owned); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.Get(ctx, key, &networkingv1.Ingress{}); err == nil {
+		t.Error("expected the owned ingress to be deleted")
+	}
+}
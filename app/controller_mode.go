@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/app"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/config"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/controller"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/handlers"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/kube"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/lifecycle"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/redact"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/server"
+)
+
+// runController runs only the reconcile plane: the controller manager with
+// its informers, plus the admin listener for probes, metrics, and pprof. No
+// public API, gRPC, or webhook listeners are started.
+func runController(cfg *config.Config, redactor *redact.Redactor, logger *zap.Logger) {
+	logger.Info("starting platform controller",
+		zap.String("version", cfg.Version),
+		zap.String("environment", cfg.Environment),
+		zap.Int("admin_port", cfg.AdminPort),
+		zap.Bool("leader_election", cfg.ControllerLeaderElection),
+	)
+
+	shutdown := lifecycle.New(logger)
+
+	kubeClient, err := kube.New(app.KubeOptions(cfg), logger)
+	if err != nil {
+		logger.Fatal("failed to configure Kubernetes client", zap.Error(err))
+	}
+	mgr, err := controller.NewManager(kubeClient.Config(), controller.Options{
+		LeaderElection:          cfg.ControllerLeaderElection,
+		LeaderElectionNamespace: cfg.PodNamespace,
+	}, logger)
+	if err != nil {
+		logger.Fatal("failed to configure controller manager", zap.Error(err))
+	}
+
+	// Ready once the API server is reachable and the manager's caches are
+	// warm; followers in leader election are ready too
+	healthHandler := handlers.NewHealthHandler(logger, cfg)
+	healthHandler.AddReadinessCheck("kubernetes", kubeClient.Check)
+	healthHandler.AddReadinessCheck("informers", func(ctx context.Context) error {
+		if !mgr.GetCache().WaitForCacheSync(ctx) {
+			return errors.New("informer caches not synced")
+		}
+		return nil
+	})
+
+	if redactor != nil {
+		go redactor.Watch(context.Background(), cfg.RedactionReloadInterval)
+	}
+	adminServer := app.NewAdminServer(cfg, middleware.RequestID(
+		middleware.Recovery(logger, app.NewAdminMux(healthHandler, redactor)),
+	), logger)
+	if err := adminServer.Listen(server.ListenOptions{ReusePort: cfg.ReusePort, KeepAlive: cfg.TCPKeepAlive}); err != nil {
+		logger.Fatal("failed to bind admin listener", zap.Error(err))
+	}
+	adminServer.Start()
+	shutdown.OnShutdown("admin-listener", lifecycle.PhaseFinal, 0, adminServer.Shutdown)
+
+	app.StartManager(mgr, shutdown, logger)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-quit
+	logger.Info("received shutdown signal", zap.String("signal", sig.String()))
+	healthHandler.SetNotReady()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := shutdown.Shutdown(ctx); err != nil {
+		logger.Error("shutdown completed with errors", zap.Error(err))
+		return
+	}
+	logger.Info("controller stopped gracefully")
+}
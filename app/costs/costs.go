@@ -0,0 +1,376 @@
+// Package costs estimates the monthly cost of each namespace and workload
+// from pod resource requests, limits and metrics-server usage, priced with
+// configured per-CPU and per-GiB rates or rates fetched from a pricing URL.
+package costs
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	metricsv "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+const (
+	// HoursPerMonth is the average month (365 × 24 / 12).
+	HoursPerMonth = 730
+	// metricsTimeout bounds the metrics-server call; without it only the
+	// usage columns are missing.
+	metricsTimeout = 5 * time.Second
+	gib            = 1 << 30
+)
+
+// Resources is an amount of CPU and memory.
+type Resources struct {
+	CPUCores  float64 `json:"cpu_cores"`
+	MemoryGiB float64 `json:"memory_gib"`
+}
+
+func (r *Resources) add(o Resources) {
+	r.CPUCores += o.CPUCores
+	r.MemoryGiB += o.MemoryGiB
+}
+
+// Estimate is the resources and monthly cost of a set of pods.
+type Estimate struct {
+	Pods     int        `json:"pods"`
+	Requests Resources  `json:"requests"`
+	Limits   Resources  `json:"limits"`
+	Usage    *Resources `json:"usage,omitempty"`
+	// Monthly costs of the requests, the limits and the current usage.
+	RequestsCost float64  `json:"requests_monthly"`
+	LimitsCost   float64  `json:"limits_monthly"`
+	UsageCost    *float64 `json:"usage_monthly,omitempty"`
+	// MonthlyCost prices, per pod and resource, the larger of request and
+	// usage: reserved capacity is paid for, and so is bursting above it.
+	MonthlyCost float64 `json:"monthly_cost"`
+}
+
+func (e *Estimate) add(o Estimate) {
+	e.Pods += o.Pods
+	e.Requests.add(o.Requests)
+	e.Limits.add(o.Limits)
+	if o.Usage != nil {
+		if e.Usage == nil {
+			e.Usage, e.UsageCost = &Resources{}, new(float64)
+		}
+		e.Usage.add(*o.Usage)
+		*e.UsageCost += *o.UsageCost
+	}
+	e.RequestsCost += o.RequestsCost
+	e.LimitsCost += o.LimitsCost
+	e.MonthlyCost += o.MonthlyCost
+}
+
+func (e *Estimate) round() {
+	e.RequestsCost = round2(e.RequestsCost)
+	e.LimitsCost = round2(e.LimitsCost)
+	e.MonthlyCost = round2(e.MonthlyCost)
+	if e.UsageCost != nil {
+		*e.UsageCost = round2(*e.UsageCost)
+	}
+}
+
+// Workload is the estimate of the pods owned by one workload. Pods without
+// an owner are reported as kind Pod.
+type Workload struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	Estimate
+}
+
+// Namespace is the estimate of one namespace.
+type Namespace struct {
+	Namespace string `json:"namespace"`
+	Estimate
+	Workloads []Workload `json:"workloads,omitempty"`
+}
+
+// Report is the cost of the allowed namespaces.
+type Report struct {
+	Rates         Rates `json:"rates"`
+	HoursPerMonth int   `json:"hours_per_month"`
+	// MetricsAvailable is false when metrics-server could not be queried;
+	// estimates then use requests only.
+	MetricsAvailable bool        `json:"metrics_available"`
+	Total            Estimate    `json:"total"`
+	Namespaces       []Namespace `json:"namespaces"`
+}
+
+// Estimator computes cost reports from the informer cache.
+type Estimator struct {
+	pods        corelisters.PodLister
+	replicaSets appslisters.ReplicaSetLister
+	jobs        batchlisters.JobLister
+	metrics     metricsv.Interface
+	pricing     *Pricing
+	allowed     map[string]bool
+	logger      *zap.Logger
+}
+
+// New registers the Pod, ReplicaSet and Job informers on factory; the
+// factory must be started afterwards. metrics may be nil, in which case
+// usage is never reported. An empty namespaces list allows all namespaces.
+func New(factory informers.SharedInformerFactory, metrics metricsv.Interface, pricing *Pricing, namespaces []string, logger *zap.Logger) *Estimator {
+	e := &Estimator{
+		pods:        factory.Core().V1().Pods().Lister(),
+		replicaSets: factory.Apps().V1().ReplicaSets().Lister(),
+		jobs:        factory.Batch().V1().Jobs().Lister(),
+		metrics:     metrics,
+		pricing:     pricing,
+		logger:      logger,
+	}
+	if len(namespaces) > 0 {
+		e.allowed = make(map[string]bool, len(namespaces))
+		for _, ns := range namespaces {
+			e.allowed[ns] = true
+		}
+	}
+	return e
+}
+
+// Register mounts the cost endpoints on mux.
+func (e *Estimator) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/costs", e.list)
+	mux.HandleFunc("GET /api/v1/costs/{namespace}", e.get)
+}
+
+// list serves the aggregate report, most expensive namespace first.
+// ?workloads=true includes the per-workload breakdown.
+func (e *Estimator) list(w http.ResponseWriter, r *http.Request) {
+	report, err := e.Report(r.Context(), "")
+	if err != nil {
+		http.Error(w, "failed to list pods", http.StatusInternalServerError)
+		return
+	}
+	if r.URL.Query().Get("workloads") != "true" {
+		for i := range report.Namespaces {
+			report.Namespaces[i].Workloads = nil
+		}
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+func (e *Estimator) get(w http.ResponseWriter, r *http.Request) {
+	ns := r.PathValue("namespace")
+	if e.allowed != nil && !e.allowed[ns] {
+		http.Error(w, "namespace not allowed", http.StatusForbidden)
+		return
+	}
+	report, err := e.Report(r.Context(), ns)
+	if err != nil {
+		http.Error(w, "failed to list pods", http.StatusInternalServerError)
+		return
+	}
+	if len(report.Namespaces) == 0 {
+		report.Namespaces = []Namespace{{Namespace: ns, Workloads: []Workload{}}}
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Rates            Rates `json:"rates"`
+		HoursPerMonth    int   `json:"hours_per_month"`
+		MetricsAvailable bool  `json:"metrics_available"`
+		Namespace
+	}{report.Rates, report.HoursPerMonth, report.MetricsAvailable, report.Namespaces[0]})
+}
+
+// Report estimates the cost of running pods in the allowed namespaces, or
+// only in namespace if set.
+func (e *Estimator) Report(ctx context.Context, namespace string) (Report, error) {
+	var (
+		pods []*corev1.Pod
+		err  error
+	)
+	if namespace != "" {
+		pods, err = e.pods.Pods(namespace).List(labels.Everything())
+	} else {
+		pods, err = e.pods.List(labels.Everything())
+	}
+	if err != nil {
+		return Report{}, err
+	}
+	rates := e.pricing.Rates()
+	usage, ok := e.usage(ctx, namespace)
+
+	namespaces := make(map[string]*Namespace)
+	workloads := make(map[string]map[[2]string]*Workload)
+	for _, p := range pods {
+		if e.allowed != nil && !e.allowed[p.Namespace] {
+			continue
+		}
+		if p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		var used *Resources
+		if ok {
+			u := usage[p.Namespace+"/"+p.Name]
+			used = &u
+		}
+		est := estimate(p, used, rates)
+
+		ns := namespaces[p.Namespace]
+		if ns == nil {
+			ns = &Namespace{Namespace: p.Namespace}
+			namespaces[p.Namespace] = ns
+			workloads[p.Namespace] = make(map[[2]string]*Workload)
+		}
+		ns.add(est)
+		kind, name := e.owner(p)
+		wl := workloads[p.Namespace][[2]string{kind, name}]
+		if wl == nil {
+			wl = &Workload{Kind: kind, Name: name}
+			workloads[p.Namespace][[2]string{kind, name}] = wl
+		}
+		wl.add(est)
+	}
+
+	report := Report{Rates: rates, HoursPerMonth: HoursPerMonth, MetricsAvailable: ok, Namespaces: []Namespace{}}
+	for name, ns := range namespaces {
+		ns.Workloads = make([]Workload, 0, len(workloads[name]))
+		for _, wl := range workloads[name] {
+			wl.round()
+			ns.Workloads = append(ns.Workloads, *wl)
+		}
+		sort.Slice(ns.Workloads, func(i, j int) bool {
+			a, b := ns.Workloads[i], ns.Workloads[j]
+			if a.MonthlyCost != b.MonthlyCost {
+				return a.MonthlyCost > b.MonthlyCost
+			}
+			return a.Kind+"/"+a.Name < b.Kind+"/"+b.Name
+		})
+		report.Total.add(ns.Estimate)
+		ns.round()
+		report.Namespaces = append(report.Namespaces, *ns)
+	}
+	report.Total.round()
+	sort.Slice(report.Namespaces, func(i, j int) bool {
+		a, b := report.Namespaces[i], report.Namespaces[j]
+		if a.MonthlyCost != b.MonthlyCost {
+			return a.MonthlyCost > b.MonthlyCost
+		}
+		return a.Namespace < b.Namespace
+	})
+	return report, nil
+}
+
+// estimate prices one pod. used is nil when usage is unknown.
+func estimate(p *corev1.Pod, used *Resources, rates Rates) Estimate {
+	price := func(r Resources) float64 {
+		return (r.CPUCores*rates.CPUCoreHour + r.MemoryGiB*rates.MemoryGiBHour) * HoursPerMonth
+	}
+	est := Estimate{
+		Pods:     1,
+		Requests: podResources(p, func(c corev1.ResourceRequirements) corev1.ResourceList { return c.Requests }),
+		Limits:   podResources(p, func(c corev1.ResourceRequirements) corev1.ResourceList { return c.Limits }),
+	}
+	est.RequestsCost = price(est.Requests)
+	est.LimitsCost = price(est.Limits)
+	basis := est.Requests
+	if used != nil {
+		cost := price(*used)
+		est.Usage, est.UsageCost = used, &cost
+		basis.CPUCores = math.Max(basis.CPUCores, used.CPUCores)
+		basis.MemoryGiB = math.Max(basis.MemoryGiB, used.MemoryGiB)
+	}
+	est.MonthlyCost = price(basis)
+	return est
+}
+
+// podResources is the pod's effective amount as the scheduler sees it: the
+// larger of the containers' sum and any single init container, plus
+// overhead.
+func podResources(p *corev1.Pod, list func(corev1.ResourceRequirements) corev1.ResourceList) Resources {
+	var sum, initMax Resources
+	for _, c := range p.Spec.Containers {
+		sum.add(toResources(list(c.Resources)))
+	}
+	for _, c := range p.Spec.InitContainers {
+		r := toResources(list(c.Resources))
+		initMax.CPUCores = math.Max(initMax.CPUCores, r.CPUCores)
+		initMax.MemoryGiB = math.Max(initMax.MemoryGiB, r.MemoryGiB)
+	}
+	out := Resources{
+		CPUCores:  math.Max(sum.CPUCores, initMax.CPUCores),
+		MemoryGiB: math.Max(sum.MemoryGiB, initMax.MemoryGiB),
+	}
+	out.add(toResources(p.Spec.Overhead))
+	return out
+}
+
+func toResources(rl corev1.ResourceList) Resources {
+	cpu, mem := rl[corev1.ResourceCPU], rl[corev1.ResourceMemory]
+	return Resources{
+		CPUCores:  float64(cpu.MilliValue()) / 1000,
+		MemoryGiB: float64(mem.Value()) / gib,
+	}
+}
+
+// owner resolves a pod to the workload that manages it, following
+// ReplicaSets to their Deployment and Jobs to their CronJob.
+func (e *Estimator) owner(p *corev1.Pod) (kind, name string) {
+	ref := metav1.GetControllerOf(p)
+	if ref == nil {
+		return "Pod", p.Name
+	}
+	switch ref.Kind {
+	case "ReplicaSet":
+		if rs, err := e.replicaSets.ReplicaSets(p.Namespace).Get(ref.Name); err == nil {
+			if parent := metav1.GetControllerOf(rs); parent != nil {
+				return parent.Kind, parent.Name
+			}
+		}
+	case "Job":
+		if job, err := e.jobs.Jobs(p.Namespace).Get(ref.Name); err == nil {
+			if parent := metav1.GetControllerOf(job); parent != nil {
+				return parent.Kind, parent.Name
+			}
+		}
+	}
+	return ref.Kind, ref.Name
+}
+
+// usage fetches current pod usage from metrics-server, keyed by
+// namespace/name. ok is false if metrics-server is not configured or the
+// call failed.
+func (e *Estimator) usage(ctx context.Context, namespace string) (map[string]Resources, bool) {
+	if e.metrics == nil {
+		return nil, false
+	}
+	ctx, cancel := context.WithTimeout(ctx, metricsTimeout)
+	defer cancel()
+	list, err := e.metrics.MetricsV1beta1().PodMetricses(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		e.logger.Warn("failed to fetch pod metrics", zap.Error(err))
+		return nil, false
+	}
+	out := make(map[string]Resources, len(list.Items))
+	for _, m := range list.Items {
+		var r Resources
+		for _, c := range m.Containers {
+			r.add(toResources(c.Usage))
+		}
+		out[m.Namespace+"/"+m.Name] = r
+	}
+	return out, true
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
@@ -0,0 +1,166 @@
+package costs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	metricsv "k8s.io/metrics/pkg/client/clientset/versioned"
+	metricsfake "k8s.io/metrics/pkg/client/clientset/versioned/fake"
+)
+
+var rates = Rates{Currency: "USD", CPUCoreHour: 0.04, MemoryGiBHour: 0.005}
+
+func pod(ns, name, owner, cpu, mem string) *corev1.Pod {
+	p := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name: "app",
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu), corev1.ResourceMemory: resource.MustParse(mem)},
+				Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse(mem)},
+			},
+		}}},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	if owner != "" {
+		p.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: owner, Controller: new(true)}}
+	}
+	return p
+}
+
+func newTestMux(t *testing.T, usage map[string]corev1.ResourceList, objs ...runtime.Object) *http.ServeMux {
+	t.Helper()
+	factory := informers.NewSharedInformerFactory(fake.NewClientset(objs...), 0)
+
+	var metrics metricsv.Interface
+	if usage != nil {
+		mc := metricsfake.NewSimpleClientset()
+		mc.PrependReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+			list := &metricsv1beta1.PodMetricsList{}
+			for key, u := range usage {
+				ns, name, _ := strings.Cut(key, "/")
+				list.Items = append(list.Items, metricsv1beta1.PodMetrics{
+					ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name},
+					Containers: []metricsv1beta1.ContainerMetrics{{Name: "app", Usage: u}},
+				})
+			}
+			return true, list, nil
+		})
+		metrics = mc
+	}
+	e := New(factory, metrics, NewPricing(rates, "", nil, zap.NewNop()), []string{"team-a", "team-b"}, zap.NewNop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		factory.Shutdown()
+	})
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+
+	mux := http.NewServeMux()
+	e.Register(mux)
+	return mux
+}
+
+func get(t *testing.T, mux *http.ServeMux, path string, out any) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if out != nil {
+		json.Unmarshal(rec.Body.Bytes(), out)
+	}
+	return rec.Code
+}
+
+func TestReportUsesLargerOfRequestAndUsage(t *testing.T) {
+	rs := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "team-a", Name: "web-7c9",
+		OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "web", Controller: new(true)}},
+	}}
+	mux := newTestMux(t,
+		map[string]corev1.ResourceList{
+			// web-1 bursts to 2 cores above its 1-core request
+			"team-a/web-1": {corev1.ResourceCPU: resource.MustParse("2"), corev1.ResourceMemory: resource.MustParse("1Gi")},
+			"team-a/web-2": {corev1.ResourceCPU: resource.MustParse("500m"), corev1.ResourceMemory: resource.MustParse("1Gi")},
+		},
+		rs,
+		pod("team-a", "web-1", "web-7c9", "1", "2Gi"),
+		pod("team-a", "web-2", "web-7c9", "1", "2Gi"),
+		pod("team-b", "debug", "", "250m", "1Gi"),
+		pod("kube-system", "dns", "", "4", "4Gi"),
+	)
+
+	var report Report
+	if code := get(t, mux, "/api/v1/costs?workloads=true", &report); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if !report.MetricsAvailable || len(report.Namespaces) != 2 {
+		t.Fatalf("expected two allowed namespaces with metrics, got %+v", report)
+	}
+	a := report.Namespaces[0]
+	if a.Namespace != "team-a" || a.Pods != 2 {
+		t.Fatalf("expected team-a first, got %+v", a)
+	}
+	// (2 + 1) cores × 0.04 + (2 + 2) GiB × 0.005, for 730 hours
+	if want := round2((3*0.04 + 4*0.005) * HoursPerMonth); a.MonthlyCost != want {
+		t.Errorf("expected monthly cost %.2f, got %.2f", want, a.MonthlyCost)
+	}
+	if want := round2((2*0.04 + 4*0.005) * HoursPerMonth); a.RequestsCost != want {
+		t.Errorf("expected requests cost %.2f, got %.2f", want, a.RequestsCost)
+	}
+	if len(a.Workloads) != 1 || a.Workloads[0].Kind != "Deployment" || a.Workloads[0].Name != "web" {
+		t.Errorf("expected pods rolled up to Deployment web, got %+v", a.Workloads)
+	}
+	if report.Total.Pods != 3 {
+		t.Errorf("expected 3 pods in total, got %d", report.Total.Pods)
+	}
+}
+
+func TestNamespaceReportWithoutMetrics(t *testing.T) {
+	mux := newTestMux(t, nil, pod("team-b", "debug", "", "500m", "1Gi"))
+
+	var ns struct {
+		MetricsAvailable bool `json:"metrics_available"`
+		Namespace
+	}
+	if code := get(t, mux, "/api/v1/costs/team-b", &ns); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if ns.MetricsAvailable || ns.Usage != nil || ns.MonthlyCost != ns.RequestsCost {
+		t.Errorf("expected request-based estimate, got %+v", ns)
+	}
+	if len(ns.Workloads) != 1 || ns.Workloads[0].Kind != "Pod" {
+		t.Errorf("expected bare pod workload, got %+v", ns.Workloads)
+	}
+	if code := get(t, mux, "/api/v1/costs/kube-system", nil); code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", code)
+	}
+}
+
+func TestPricingRefreshFromURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"cpu_core_hour":0.031,"memory_gib_hour":0.004}`))
+	}))
+	defer srv.Close()
+
+	p := NewPricing(rates, srv.URL, srv.Client(), zap.NewNop())
+	p.Refresh(t.Context())
+	if got := p.Rates(); got.CPUCoreHour != 0.031 || got.Currency != "USD" {
+		t.Errorf("expected fetched rates with configured currency, got %+v", got)
+	}
+}
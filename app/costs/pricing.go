@@ -0,0 +1,103 @@
+package costs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Rates are the prices a cost estimate is based on.
+type Rates struct {
+	Currency      string  `json:"currency"`
+	CPUCoreHour   float64 `json:"cpu_core_hour"`
+	MemoryGiBHour float64 `json:"memory_gib_hour"`
+}
+
+// Pricing holds the current rates: the configured ones, replaced by those
+// published at a pricing URL when one is set.
+type Pricing struct {
+	url    string
+	client *http.Client
+	logger *zap.Logger
+
+	mu    sync.RWMutex
+	rates Rates
+}
+
+// NewPricing creates a pricing source starting from rates. With a url, Run
+// periodically fetches rates from it, as JSON in the shape of Rates (for
+// example a small service in front of the cloud provider's price list).
+func NewPricing(rates Rates, url string, client *http.Client, logger *zap.Logger) *Pricing {
+	return &Pricing{url: url, client: client, logger: logger, rates: rates}
+}
+
+// Rates returns the current rates.
+func (p *Pricing) Rates() Rates {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.rates
+}
+
+// Run refreshes the rates every interval until ctx is cancelled. Without a
+// pricing URL it returns immediately.
+func (p *Pricing) Run(ctx context.Context, interval time.Duration) {
+	if p.url == "" {
+		return
+	}
+	p.Refresh(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.Refresh(ctx)
+		}
+	}
+}
+
+// Refresh fetches the rates once. On failure the previous rates stay.
+func (p *Pricing) Refresh(ctx context.Context) {
+	rates, err := p.fetch(ctx)
+	if err != nil {
+		p.logger.Warn("failed to refresh pricing", zap.String("url", p.url), zap.Error(err))
+		return
+	}
+	p.mu.Lock()
+	if rates.Currency == "" {
+		rates.Currency = p.rates.Currency
+	}
+	p.rates = rates
+	p.mu.Unlock()
+}
+
+func (p *Pricing) fetch(ctx context.Context) (Rates, error) {
+	var rates Rates
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return rates, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return rates, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return rates, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&rates); err != nil {
+		return rates, fmt.Errorf("decode rates: %w", err)
+	}
+	if rates.CPUCoreHour < 0 || rates.MemoryGiBHour < 0 || (rates.CPUCoreHour == 0 && rates.MemoryGiBHour == 0) {
+		return rates, fmt.Errorf("invalid rates %+v", rates)
+	}
+	return rates, nil
+}
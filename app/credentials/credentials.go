@@ -0,0 +1,214 @@
+// Package credentials keeps tenants' secrets, such as registry passwords
+// and third-party API keys, in the platform database, sealed with the
+// encryption package. Values are write-only through the API; platform
+// components read them with Reveal. After the master key is rotated, the
+// re-encryption job moves every credential to the new key.
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/encryption"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/queue"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+// JobType is the queue job type of re-encryption runs.
+const JobType = "credentials.reencrypt"
+
+// batchSize is how many credentials a re-encryption run reads at a time.
+const batchSize = 100
+
+// maxValueBytes bounds a credential's value.
+const maxValueBytes = 64 << 10
+
+// validName matches credential names: lowercase DNS labels, so that they
+// can name Kubernetes Secret keys too.
+var validName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// ErrInvalid is returned for credentials with an invalid name or value.
+var ErrInvalid = errs.New(errs.Invalid, "invalid credential")
+
+var resealedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "credentials_resealed_total",
+	Help: "Credentials processed by re-encryption runs by result (resealed, changed or error).",
+}, []string{"result"})
+
+// Service stores and reveals credentials.
+type Service struct {
+	repo    store.CredentialRepository
+	tenants store.TenantRepository
+	enc     *encryption.Encryptor
+	queue   *queue.Queue
+	logger  *zap.Logger
+}
+
+// New creates a service sealing the credentials of tenants with enc.
+func New(repo store.CredentialRepository, tenants store.TenantRepository, enc *encryption.Encryptor, logger *zap.Logger) *Service {
+	return &Service{repo: repo, tenants: tenants, enc: enc, logger: logger}
+}
+
+// UseQueue runs re-encryption as jobs of q, registering the JobType
+// handler, so that a run cut short by a restart resumes. Call it before q
+// runs.
+func (s *Service) UseQueue(q *queue.Queue) {
+	s.queue = q
+	q.Handle(JobType, func(ctx context.Context, _ store.QueueJob) error {
+		_, err := s.Reencrypt(ctx)
+		return err
+	})
+}
+
+// aad binds a sealed value to its credential, so that it cannot be copied
+// to another one.
+func aad(c *store.Credential) []byte {
+	return []byte(c.ID + "/" + c.TenantID + "/" + c.Name)
+}
+
+// Put seals value and stores it as the tenant's credential name, creating
+// or replacing it, and reports whether it was created.
+func (s *Service) Put(ctx context.Context, tenantID, name, description string, value []byte, actor string) (*store.Credential, bool, error) {
+	switch {
+	case !validName.MatchString(name):
+		return nil, false, fmt.Errorf("%w: name must be a lowercase DNS label", ErrInvalid)
+	case len(value) == 0 || len(value) > maxValueBytes:
+		return nil, false, fmt.Errorf("%w: value must be 1 to %d bytes", ErrInvalid, maxValueBytes)
+	}
+	if _, err := s.tenants.Get(ctx, tenantID); err != nil {
+		return nil, false, err
+	}
+	// The ID is part of the sealed value's aad, so a replaced credential
+	// keeps its ID
+	id := uuid.NewString()
+	if existing, err := s.repo.Get(ctx, tenantID, name); err == nil {
+		id = existing.ID
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return nil, false, err
+	}
+	c := &store.Credential{ID: id, TenantID: tenantID, Name: name, Description: description, UpdatedBy: actor}
+	sealed, err := s.enc.Seal(ctx, value, aad(c))
+	if err != nil {
+		return nil, false, err
+	}
+	c.Value = sealed
+	if c.KeyID, err = encryption.KeyID(sealed); err != nil {
+		return nil, false, err
+	}
+	created, err := s.repo.Put(ctx, c)
+	if err != nil {
+		return nil, false, err
+	}
+	if c.ID != id {
+		// Created concurrently with another ID: seal again for that one
+		return s.Put(ctx, tenantID, name, description, value, actor)
+	}
+	return c, created, nil
+}
+
+// Reveal returns the plaintext of the tenant's credential name.
+func (s *Service) Reveal(ctx context.Context, tenantID, name string) ([]byte, error) {
+	c, err := s.repo.Get(ctx, tenantID, name)
+	if err != nil {
+		return nil, err
+	}
+	return s.enc.Open(ctx, c.Value, aad(c))
+}
+
+// List returns the tenant's credentials, without their values.
+func (s *Service) List(ctx context.Context, tenantID string) ([]store.Credential, error) {
+	if _, err := s.tenants.Get(ctx, tenantID); err != nil {
+		return nil, err
+	}
+	return s.repo.List(ctx, tenantID)
+}
+
+// Delete removes the tenant's credential name.
+func (s *Service) Delete(ctx context.Context, tenantID, name string) error {
+	return s.repo.Delete(ctx, tenantID, name)
+}
+
+// StartReencrypt queues a re-encryption run, or runs it now without a
+// queue. It returns the queued job, or nil and the number of credentials
+// resealed.
+func (s *Service) StartReencrypt(ctx context.Context) (*store.QueueJob, int, error) {
+	if s.queue != nil {
+		job, err := s.queue.Enqueue(ctx, JobType, nil)
+		return job, 0, err
+	}
+	n, err := s.Reencrypt(ctx)
+	return nil, n, err
+}
+
+// Reencrypt rewraps every credential not sealed with the current master
+// key and reports how many it resealed. Credentials changed meanwhile are
+// skipped: their new value already uses the current key. It goes on past
+// credentials that fail and returns the first error at the end, so one
+// bad value does not hold up the rest.
+func (s *Service) Reencrypt(ctx context.Context) (int, error) {
+	current, err := s.enc.CurrentKeyID(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		resealed int
+		firstErr error
+		after    string
+	)
+	for {
+		batch, err := s.repo.NotSealedWith(ctx, current, after, batchSize)
+		if err != nil {
+			return resealed, err
+		}
+		for _, c := range batch {
+			after = c.ID
+			ok, err := s.reseal(ctx, c)
+			if err != nil {
+				resealedTotal.WithLabelValues("error").Inc()
+				s.logger.Error("failed to reseal credential",
+					zap.String("tenant_id", c.TenantID), zap.String("name", c.Name), zap.Error(err))
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			if ok {
+				resealed++
+			}
+		}
+		if len(batch) < batchSize {
+			break
+		}
+	}
+	s.logger.Info("credentials re-encrypted", zap.String("key_id", current), zap.Int("resealed", resealed))
+	return resealed, firstErr
+}
+
+// reseal rewraps c's value and reports whether it stored the result.
+func (s *Service) reseal(ctx context.Context, c store.Credential) (bool, error) {
+	value, changed, err := s.enc.Rewrap(ctx, c.Value)
+	if err != nil || !changed {
+		return false, err
+	}
+	keyID, err := encryption.KeyID(value)
+	if err != nil {
+		return false, err
+	}
+	switch err := s.repo.Reseal(ctx, c.ID, c.Value, value, keyID); {
+	case errors.Is(err, store.ErrVersionConflict), errors.Is(err, store.ErrNotFound):
+		resealedTotal.WithLabelValues("changed").Inc()
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	resealedTotal.WithLabelValues("resealed").Inc()
+	return true, nil
+}
@@ -0,0 +1,100 @@
+package credentials
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/encryption"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/mocks"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+func keyring(t *testing.T, active string) *encryption.Encryptor {
+	t.Helper()
+	keys := map[string]string{}
+	for _, id := range []string{"k1", "k2"} {
+		keys[id] = base64.StdEncoding.EncodeToString([]byte(strings.Repeat(id, 16)))
+	}
+	k, err := encryption.NewKeyring(keys, active)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return encryption.New(k)
+}
+
+func TestPutRevealAndReencrypt(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	tenant := &store.Tenant{Name: "payments", Owner: "alice"}
+	if err := st.Tenants.Create(ctx, tenant); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svc := New(st.Credentials, st.Tenants, keyring(t, "k1"), zap.NewNop())
+
+	if _, _, err := svc.Put(ctx, tenant.ID, "Bad_Name", "", []byte("x"), "alice"); err == nil {
+		t.Error("expected an invalid name to be refused")
+	}
+	if _, _, err := svc.Put(ctx, "missing", "registry", "", []byte("x"), "alice"); err == nil {
+		t.Error("expected an unknown tenant to be refused")
+	}
+	c, created, err := svc.Put(ctx, tenant.ID, "registry", "pull secret", []byte("hunter2"), "alice")
+	if err != nil || !created || c.KeyID != "k1" {
+		t.Fatalf("expected the credential created with k1, got %+v %v %v", c, created, err)
+	}
+	stored, _ := st.Credentials.Get(ctx, tenant.ID, "registry")
+	if strings.Contains(stored.Value, "hunter2") {
+		t.Fatal("expected the value sealed at rest")
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		svc.Put(ctx, tenant.ID, name, "", []byte("v-"+name), "alice")
+	}
+
+	// After rotating to k2, the re-encryption run moves every credential
+	svc = New(st.Credentials, st.Tenants, keyring(t, "k2"), zap.NewNop())
+	n, err := svc.Reencrypt(ctx)
+	if err != nil || n != 4 {
+		t.Fatalf("expected 4 credentials resealed, got %d %v", n, err)
+	}
+	if left, _ := st.Credentials.NotSealedWith(ctx, "k2", "", 0); len(left) != 0 {
+		t.Errorf("expected no credentials left on k1, got %d", len(left))
+	}
+	if n, _ := svc.Reencrypt(ctx); n != 0 {
+		t.Errorf("expected a second run to do nothing, got %d", n)
+	}
+	if v, err := svc.Reveal(ctx, tenant.ID, "registry"); err != nil || string(v) != "hunter2" {
+		t.Errorf("expected hunter2, got %q %v", v, err)
+	}
+
+	// Replacing keeps the ID the value is bound to
+	again, created, err := svc.Put(ctx, tenant.ID, "registry", "", []byte("hunter3"), "bob")
+	if err != nil || created || again.ID != c.ID {
+		t.Fatalf("expected the credential replaced in place, got %+v %v %v", again, created, err)
+	}
+	if v, _ := svc.Reveal(ctx, tenant.ID, "registry"); string(v) != "hunter3" {
+		t.Errorf("expected hunter3, got %q", v)
+	}
+}
+
+func TestPutWithoutKeyService(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	tenants := mocks.NewMockTenantRepository(ctrl)
+	tenants.EXPECT().Get(gomock.Any(), "t1").Return(&store.Tenant{ID: "t1"}, nil)
+	repo := mocks.NewMockCredentialRepository(ctrl)
+	repo.EXPECT().Get(gomock.Any(), "t1", "registry").Return(nil, store.ErrNotFound)
+	// Nothing is stored when the value cannot be sealed
+	repo.EXPECT().Put(gomock.Any(), gomock.Any()).Times(0)
+	keys := mocks.NewMockKeyWrapper(ctrl)
+	sealed := errors.New("vault is sealed")
+	keys.EXPECT().Wrap(gomock.Any(), gomock.Any()).Return("", nil, sealed)
+
+	svc := New(repo, tenants, encryption.New(keys), zap.NewNop())
+	if _, _, err := svc.Put(t.Context(), "t1", "registry", "", []byte("hunter2"), "alice"); !errors.Is(err, sealed) {
+		t.Errorf("expected the key service error, got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package credentials
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+// Handler serves the credential endpoints. Access is decided by the rbac
+// rules for credentials:read, credentials:write and credentials:rotate.
+type Handler struct {
+	svc     *Service
+	headers authz.Headers
+	logger  *zap.Logger
+}
+
+// NewHandler creates the credential endpoints for svc.
+func NewHandler(svc *Service, headers authz.Headers, logger *zap.Logger) *Handler {
+	return &Handler{svc: svc, headers: headers, logger: logger}
+}
+
+// Register mounts the endpoints on mux:
+//
+//	GET    /api/v1/tenants/{id}/credentials          the tenant's credentials, without values
+//	PUT    /api/v1/tenants/{id}/credentials/{name}   create or replace a credential
+//	DELETE /api/v1/tenants/{id}/credentials/{name}   delete a credential
+//	POST   /api/v1/admin/credentials/reencrypt       reseal credentials with the current master key
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/tenants/{id}/credentials", h.list)
+	mux.HandleFunc("PUT /api/v1/tenants/{id}/credentials/{name}", h.put)
+	mux.HandleFunc("DELETE /api/v1/tenants/{id}/credentials/{name}", h.delete)
+	mux.HandleFunc("POST /api/v1/admin/credentials/reencrypt", h.reencrypt)
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	items, err := h.svc.List(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+type putRequest struct {
+	Description string `json:"description"`
+	Value       string `json:"value"`
+}
+
+func (h *Handler) put(w http.ResponseWriter, r *http.Request) {
+	var req putRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*maxValueBytes)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	c, created, err := h.svc.Put(r.Context(), r.PathValue("id"), r.PathValue("name"), req.Description,
+		[]byte(req.Value), h.headers.Identity(r).User)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	h.audit(r, "credential stored", zap.String("tenant_id", c.TenantID), zap.String("name", c.Name),
+		zap.String("key_id", c.KeyID), zap.Bool("created", created))
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, c)
+}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
+	tenantID, name := r.PathValue("id"), r.PathValue("name")
+	if err := h.svc.Delete(r.Context(), tenantID, name); err != nil {
+		h.fail(w, err)
+		return
+	}
+	h.audit(r, "credential deleted", zap.String("tenant_id", tenantID), zap.String("name", name))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) reencrypt(w http.ResponseWriter, r *http.Request) {
+	job, n, err := h.svc.StartReencrypt(r.Context())
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	if job != nil {
+		h.audit(r, "credential re-encryption queued", zap.String("job_id", job.ID))
+		w.Header().Set("Location", "/api/v1/jobs/"+job.ID)
+		writeJSON(w, http.StatusAccepted, job)
+		return
+	}
+	h.audit(r, "credentials re-encrypted", zap.Int("resealed", n))
+	writeJSON(w, http.StatusOK, map[string]int{"resealed": n})
+}
+
+func (h *Handler) audit(r *http.Request, msg string, fields ...zap.Field) {
+	id := h.headers.Identity(r)
+	h.logger.Info(msg, append([]zap.Field{
+		zap.String("audit", "credentials"),
+		zap.String("request_id", middleware.GetRequestID(r.Context())),
+		zap.String("user", id.User),
+		zap.Strings("groups", id.Groups),
+	}, fields...)...)
+}
+
+func (h *Handler) fail(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, store.ErrNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	default:
+		h.logger.Error("credential request failed", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
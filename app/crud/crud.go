@@ -0,0 +1,337 @@
+// Package crud serves list, get, create, update and delete endpoints for a
+// resource type, so every resource the API exposes validates input,
+// paginates lists and guards against lost updates the same way. A resource
+// type implements Resource on its API representation and provides a Backend
+// storing it; Handler does the HTTP side.
+package crud
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 500
+)
+
+// Errors a Backend returns, possibly wrapped, to get the matching response.
+// Other errors of kind errs.NotFound, errs.Invalid or errs.Unavailable get
+// the response of their kind too.
+var (
+	ErrNotFound = errs.New(errs.NotFound, "not found")
+	ErrExists   = errs.New(errs.Conflict, "already exists")
+	// ErrStale is returned for writes carrying a version other than the
+	// stored one.
+	ErrStale = errs.New(errs.Conflict, "modified concurrently")
+	// ErrInvalid is returned for writes the backend refuses as invalid;
+	// its message is shown to the client.
+	ErrInvalid = errs.New(errs.Invalid, "invalid")
+)
+
+// Resource is implemented by pointers to a resource type's API
+// representation.
+type Resource interface {
+	// Key identifies the resource in its URL and orders list pages.
+	Key() string
+	SetKey(key string)
+	// Version changes whenever the resource is written. A write carrying a
+	// version only succeeds if it is still the stored one.
+	Version() string
+	SetVersion(version string)
+	// Validate checks a resource decoded from a request body.
+	Validate() error
+}
+
+// Pointer constrains the type parameter of Handler to pointers to T
+// implementing Resource.
+type Pointer[T any] interface {
+	*T
+	Resource
+}
+
+// Backend stores resources of type T. Writes fill in the stored state, such
+// as generated keys and the new version.
+type Backend[T any] interface {
+	// List returns the resources matching the filters in query, in any
+	// order.
+	List(ctx context.Context, query url.Values) ([]T, error)
+	Get(ctx context.Context, key string) (*T, error)
+	Create(ctx context.Context, item *T) error
+	// Update replaces the resource with item's key, failing with ErrStale
+	// if item carries a version that is no longer current.
+	Update(ctx context.Context, item *T) error
+	// Delete removes key, failing with ErrStale if version is set and no
+	// longer current.
+	Delete(ctx context.Context, key, version string) error
+}
+
+// Options configures a Handler.
+type Options struct {
+	// Path is the collection's URL path, such as /api/v1/tenants.
+	Path string
+	// Kind names the resource in responses, such as "tenant".
+	Kind string
+	// Authorize decides whether the caller may perform verb (create, update
+	// or delete) on the resource with key, writing the error response when
+	// it returns false. Nil allows every write. Reads are not authorised.
+	Authorize func(w http.ResponseWriter, r *http.Request, verb, key string) bool
+	// Actor names the caller making a write, passed to the backend in its
+	// context for ActorFrom. Nil leaves it empty.
+	Actor func(r *http.Request) string
+	// RequireVersion refuses updates and deletes that carry no version with
+	// 428 Precondition Required, so clients cannot overwrite blindly.
+	RequireVersion bool
+	// MaxBodyBytes bounds request bodies; 0 means 256 KiB.
+	MaxBodyBytes int64
+}
+
+type actorKey struct{}
+
+// ActorFrom returns the caller making the write in ctx, as named by
+// Options.Actor.
+func ActorFrom(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// Handler serves a collection of resources of type T:
+//
+//	GET    <path>?limit=&continue=  page of resources, ordered by key
+//	GET    <path>/{key}             one resource
+//	POST   <path>                   create
+//	PUT    <path>/{key}             update
+//	DELETE <path>/{key}             delete
+//
+// The version is returned in the ETag header and in the body. Writes take
+// it from an If-Match header, or else from the body.
+type Handler[T any, P Pointer[T]] struct {
+	backend Backend[T]
+	opts    Options
+	logger  *zap.Logger
+}
+
+// New creates a handler serving backend's resources.
+func New[T any, P Pointer[T]](backend Backend[T], opts Options, logger *zap.Logger) *Handler[T, P] {
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = 256 << 10
+	}
+	return &Handler[T, P]{backend: backend, opts: opts, logger: logger}
+}
+
+// Register mounts the endpoints on mux.
+func (h *Handler[T, P]) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET "+h.opts.Path, h.list)
+	mux.HandleFunc("GET "+h.opts.Path+"/{key}", h.get)
+	mux.HandleFunc("POST "+h.opts.Path, h.create)
+	mux.HandleFunc("PUT "+h.opts.Path+"/{key}", h.update)
+	mux.HandleFunc("DELETE "+h.opts.Path+"/{key}", h.delete)
+}
+
+type listResponse[T any] struct {
+	Items []T `json:"items"`
+	// Continue is passed back as the continue parameter to get the next
+	// page; empty on the last page.
+	Continue string `json:"continue,omitempty"`
+}
+
+// list returns a page of resources ordered by key, starting after the key
+// in the continue token. Keys rather than offsets keep pages stable as
+// resources come and go.
+func (h *Handler[T, P]) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := defaultLimit
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxLimit)
+	}
+	var after string
+	if s := q.Get("continue"); s != "" {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			http.Error(w, "invalid continue token", http.StatusBadRequest)
+			return
+		}
+		after = string(b)
+	}
+
+	items, err := h.backend.List(r.Context(), q)
+	if err != nil {
+		h.fail(w, "list", err)
+		return
+	}
+	key := func(item *T) string { return P(item).Key() }
+	slices.SortFunc(items, func(a, b T) int { return strings.Compare(key(&a), key(&b)) })
+	start := 0
+	if after != "" {
+		start, _ = slices.BinarySearchFunc(items, after, func(item T, k string) int {
+			if c := strings.Compare(key(&item), k); c != 0 {
+				return c
+			}
+			// Land just past an exact match
+			return -1
+		})
+	}
+	items = items[start:]
+
+	resp := listResponse[T]{Items: items}
+	if len(items) > limit {
+		resp.Items = items[:limit]
+		resp.Continue = base64.RawURLEncoding.EncodeToString([]byte(key(&resp.Items[limit-1])))
+	}
+	if resp.Items == nil {
+		resp.Items = []T{}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler[T, P]) get(w http.ResponseWriter, r *http.Request) {
+	item, err := h.backend.Get(r.Context(), r.PathValue("key"))
+	if err != nil {
+		h.fail(w, "get", err)
+		return
+	}
+	h.write(w, http.StatusOK, item)
+}
+
+func (h *Handler[T, P]) create(w http.ResponseWriter, r *http.Request) {
+	item, ok := h.decode(w, r)
+	if !ok {
+		return
+	}
+	if h.opts.Authorize != nil && !h.opts.Authorize(w, r, "create", P(item).Key()) {
+		return
+	}
+	if err := h.backend.Create(h.writeContext(r), item); err != nil {
+		h.fail(w, "create", err)
+		return
+	}
+	w.Header().Set("Location", h.opts.Path+"/"+url.PathEscape(P(item).Key()))
+	h.write(w, http.StatusCreated, item)
+}
+
+func (h *Handler[T, P]) update(w http.ResponseWriter, r *http.Request) {
+	item, ok := h.decode(w, r)
+	if !ok {
+		return
+	}
+	if !h.checkVersion(w, P(item).Version()) {
+		return
+	}
+	if h.opts.Authorize != nil && !h.opts.Authorize(w, r, "update", P(item).Key()) {
+		return
+	}
+	if err := h.backend.Update(h.writeContext(r), item); err != nil {
+		h.fail(w, "update", err)
+		return
+	}
+	h.write(w, http.StatusOK, item)
+}
+
+func (h *Handler[T, P]) delete(w http.ResponseWriter, r *http.Request) {
+	key, version := r.PathValue("key"), ifMatch(r)
+	if !h.checkVersion(w, version) {
+		return
+	}
+	if h.opts.Authorize != nil && !h.opts.Authorize(w, r, "delete", key) {
+		return
+	}
+	if err := h.backend.Delete(h.writeContext(r), key, version); err != nil {
+		h.fail(w, "delete", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeContext returns the context for a backend write, carrying the
+// actor.
+func (h *Handler[T, P]) writeContext(r *http.Request) context.Context {
+	if h.opts.Actor == nil {
+		return r.Context()
+	}
+	return context.WithValue(r.Context(), actorKey{}, h.opts.Actor(r))
+}
+
+// decode reads and validates the resource in the body. The key in the path
+// and the version in If-Match take precedence over those in the body.
+func (h *Handler[T, P]) decode(w http.ResponseWriter, r *http.Request) (*T, bool) {
+	item := new(T)
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, h.opts.MaxBodyBytes)).Decode(item); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+	if key := r.PathValue("key"); key != "" {
+		P(item).SetKey(key)
+	}
+	if version := ifMatch(r); version != "" {
+		P(item).SetVersion(version)
+	}
+	if err := P(item).Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return item, true
+}
+
+func (h *Handler[T, P]) checkVersion(w http.ResponseWriter, version string) bool {
+	if h.opts.RequireVersion && version == "" {
+		http.Error(w, "an If-Match header or resource_version is required", http.StatusPreconditionRequired)
+		return false
+	}
+	return true
+}
+
+// ifMatch returns the version in the If-Match header, which holds an ETag
+// as written by write.
+func ifMatch(r *http.Request) string {
+	return strings.Trim(strings.TrimPrefix(r.Header.Get("If-Match"), "W/"), `"`)
+}
+
+func (h *Handler[T, P]) write(w http.ResponseWriter, status int, item *T) {
+	if v := P(item).Version(); v != "" {
+		w.Header().Set("ETag", strconv.Quote(v))
+	}
+	writeJSON(w, status, item)
+}
+
+func (h *Handler[T, P]) fail(w http.ResponseWriter, op string, err error) {
+	switch {
+	case errors.Is(err, errs.NotFound):
+		http.Error(w, h.opts.Kind+" not found", http.StatusNotFound)
+	case errors.Is(err, ErrExists):
+		http.Error(w, h.opts.Kind+" already exists", http.StatusConflict)
+	case errors.Is(err, ErrStale):
+		http.Error(w, h.opts.Kind+" was modified; reload and retry", http.StatusConflict)
+	case errors.Is(err, errs.Invalid):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, errs.Unavailable):
+		h.logger.Warn("resource backend unavailable", zap.String("kind", h.opts.Kind), zap.String("op", op), zap.Error(err))
+		http.Error(w, fmt.Sprintf("failed to %s %s; retry later", op, h.opts.Kind), http.StatusServiceUnavailable)
+	default:
+		h.logger.Error("resource operation failed", zap.String("kind", h.opts.Kind), zap.String("op", op), zap.Error(err))
+		http.Error(w, fmt.Sprintf("failed to %s %s", op, h.opts.Kind), http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
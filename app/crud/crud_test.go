@@ -0,0 +1,199 @@
+package crud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+type note struct {
+	Name string `json:"name"`
+	Text string `json:"text"`
+	RV   string `json:"resource_version,omitempty"`
+}
+
+func (n *note) Key() string          { return n.Name }
+func (n *note) SetKey(name string)   { n.Name = name }
+func (n *note) Version() string      { return n.RV }
+func (n *note) SetVersion(rv string) { n.RV = rv }
+
+func (n *note) Validate() error {
+	if n.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+type notes struct {
+	mu    sync.Mutex
+	items map[string]note
+	seq   int
+}
+
+func (b *notes) List(ctx context.Context, q url.Values) ([]note, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []note
+	for _, n := range b.items {
+		if q.Get("text") == "" || n.Text == q.Get("text") {
+			out = append(out, n)
+		}
+	}
+	return out, nil
+}
+
+func (b *notes) Get(ctx context.Context, name string) (*note, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n, ok := b.items[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &n, nil
+}
+
+func (b *notes) Create(ctx context.Context, n *note) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.items[n.Name]; ok {
+		return ErrExists
+	}
+	b.seq++
+	n.RV = strconv.Itoa(b.seq)
+	b.items[n.Name] = *n
+	return nil
+}
+
+func (b *notes) Update(ctx context.Context, n *note) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	existing, ok := b.items[n.Name]
+	if !ok {
+		return ErrNotFound
+	}
+	if n.RV != "" && n.RV != existing.RV {
+		return fmt.Errorf("note %s: %w", n.Name, ErrStale)
+	}
+	b.seq++
+	n.RV = strconv.Itoa(b.seq)
+	b.items[n.Name] = *n
+	return nil
+}
+
+func (b *notes) Delete(ctx context.Context, name, rv string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	existing, ok := b.items[name]
+	if !ok {
+		return ErrNotFound
+	}
+	if rv != "" && rv != existing.RV {
+		return ErrStale
+	}
+	delete(b.items, name)
+	return nil
+}
+
+func newMux(opts Options) *http.ServeMux {
+	opts.Path, opts.Kind = "/api/v1/notes", "note"
+	mux := http.NewServeMux()
+	New[note](&notes{items: map[string]note{}}, opts, zap.NewNop()).Register(mux)
+	return mux
+}
+
+func do(mux *http.ServeMux, method, path, body string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestWrites(t *testing.T) {
+	mux := newMux(Options{RequireVersion: true})
+
+	rec := do(mux, http.MethodPost, "/api/v1/notes", `{"name":"a","text":"hello"}`)
+	if rec.Code != http.StatusCreated || rec.Header().Get("Location") != "/api/v1/notes/a" || rec.Header().Get("ETag") != `"1"` {
+		t.Fatalf("expected 201 with a location and ETag, got %d %v: %s", rec.Code, rec.Header(), rec.Body)
+	}
+	if rec := do(mux, http.MethodPost, "/api/v1/notes", `{"name":"a"}`); rec.Code != http.StatusConflict {
+		t.Errorf("expected a duplicate to conflict, got %d", rec.Code)
+	}
+	if rec := do(mux, http.MethodPost, "/api/v1/notes", `{"text":"x"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected an invalid note to be refused, got %d", rec.Code)
+	}
+
+	if rec := do(mux, http.MethodPut, "/api/v1/notes/a", `{"text":"blind"}`); rec.Code != http.StatusPreconditionRequired {
+		t.Errorf("expected an update without a version to be refused, got %d", rec.Code)
+	}
+	rec = do(mux, http.MethodPut, "/api/v1/notes/a", `{"text":"edited"}`, "If-Match", `"1"`)
+	var n note
+	json.NewDecoder(rec.Body).Decode(&n)
+	if rec.Code != http.StatusOK || n.Name != "a" || n.RV != "2" {
+		t.Fatalf("expected the update to take the path's key and bump the version, got %d %+v", rec.Code, n)
+	}
+	if rec := do(mux, http.MethodPut, "/api/v1/notes/a", `{"text":"late","resource_version":"1"}`); rec.Code != http.StatusConflict {
+		t.Errorf("expected a stale version to conflict, got %d", rec.Code)
+	}
+	if rec := do(mux, http.MethodDelete, "/api/v1/notes/a", "", "If-Match", `"1"`); rec.Code != http.StatusConflict {
+		t.Errorf("expected a stale delete to conflict, got %d", rec.Code)
+	}
+	if rec := do(mux, http.MethodDelete, "/api/v1/notes/a", "", "If-Match", `"2"`); rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rec.Code)
+	}
+	if rec := do(mux, http.MethodGet, "/api/v1/notes/a", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after deleting, got %d", rec.Code)
+	}
+
+	denied := newMux(Options{Authorize: func(w http.ResponseWriter, r *http.Request, verb, key string) bool {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return false
+	}})
+	if rec := do(denied, http.MethodPost, "/api/v1/notes", `{"name":"a"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("expected the authorizer to refuse the write, got %d", rec.Code)
+	}
+}
+
+func TestListPages(t *testing.T) {
+	mux := newMux(Options{})
+	for _, name := range []string{"e", "b", "d", "a", "c"} {
+		do(mux, http.MethodPost, "/api/v1/notes", `{"name":"`+name+`","text":"x"}`)
+	}
+	do(mux, http.MethodPost, "/api/v1/notes", `{"name":"f","text":"y"}`)
+
+	var names []string
+	path := "/api/v1/notes?text=x&limit=2"
+	for pages := 0; pages < 5; pages++ {
+		rec := do(mux, http.MethodGet, path, "")
+		var resp struct {
+			Items    []note
+			Continue string
+		}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		for _, n := range resp.Items {
+			names = append(names, n.Name)
+		}
+		if resp.Continue == "" {
+			break
+		}
+		path = "/api/v1/notes?text=x&limit=2&continue=" + resp.Continue
+	}
+	if strings.Join(names, ",") != "a,b,c,d,e" {
+		t.Errorf("expected the filtered notes in order across pages, got %v", names)
+	}
+	if rec := do(mux, http.MethodGet, "/api/v1/notes?limit=0", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected an invalid limit to be refused, got %d", rec.Code)
+	}
+}
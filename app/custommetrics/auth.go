@@ -0,0 +1,72 @@
+package custommetrics
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// authConfigMap is where the API server publishes how extension API
+// servers authenticate the aggregator.
+const authConfigMap = "extension-apiserver-authentication"
+
+// Authentication is the aggregator's front-proxy client certificate
+// configuration from the extension-apiserver-authentication ConfigMap.
+type Authentication struct {
+	// ClientCAs verify the aggregator's client certificate; set them on
+	// the server's TLS config.
+	ClientCAs *x509.CertPool
+	// AllowedNames are the accepted certificate common names. Empty accepts
+	// any certificate ClientCAs signed, as the API server does.
+	AllowedNames []string
+}
+
+// LoadAuthentication reads the front-proxy CA and allowed names from the
+// extension-apiserver-authentication ConfigMap in kube-system.
+func LoadAuthentication(ctx context.Context, cs kubernetes.Interface) (*Authentication, error) {
+	cm, err := cs.CoreV1().ConfigMaps(metav1.NamespaceSystem).Get(ctx, authConfigMap, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", authConfigMap, err)
+	}
+	ca := cm.Data["requestheader-client-ca-file"]
+	if ca == "" {
+		return nil, fmt.Errorf("%s has no requestheader-client-ca-file", authConfigMap)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(ca)) {
+		return nil, errors.New("requestheader-client-ca-file has no PEM certificates")
+	}
+	auth := &Authentication{ClientCAs: pool}
+	if names := cm.Data["requestheader-allowed-names"]; names != "" {
+		if err := json.Unmarshal([]byte(names), &auth.AllowedNames); err != nil {
+			return nil, fmt.Errorf("parse requestheader-allowed-names: %w", err)
+		}
+	}
+	return auth, nil
+}
+
+// authenticate admits only requests whose client certificate the TLS
+// handshake verified against the front-proxy CA and whose common name is
+// allowed: the API must only be reachable through the aggregator.
+func (a *Adapter) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			writeStatus(w, http.StatusUnauthorized, metav1.StatusReasonUnauthorized, "verified client certificate required")
+			return
+		}
+		cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		if len(a.opts.AllowedNames) > 0 && !slices.Contains(a.opts.AllowedNames, cn) {
+			writeStatus(w, http.StatusForbidden, metav1.StatusReasonForbidden,
+				fmt.Sprintf("client certificate %q is not allowed", cn))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,300 @@
+// Package custommetrics serves selected application metrics through the
+// custom.metrics.k8s.io API so HorizontalPodAutoscalers can scale on
+// platform signals (in-flight requests, queue depth) instead of CPU.
+//
+// The kube-aggregator proxies the API group to this server (see the
+// APIService in the docs) and is the only client admitted: requests need a
+// client certificate from the aggregator's front-proxy CA. Values are read per pod by scraping each pod's
+// Prometheus endpoint and summing the samples of the mapped metric family.
+package custommetrics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	cmv1beta2 "k8s.io/metrics/pkg/apis/custom_metrics/v1beta2"
+)
+
+// GroupVersion is the API group version served.
+const GroupVersion = "custom.metrics.k8s.io/v1beta2"
+
+const (
+	basePath = "/apis/" + GroupVersion
+	// scrapeConcurrency bounds parallel pod scrapes per request.
+	scrapeConcurrency = 16
+)
+
+var scrapesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "custom_metrics_scrapes_total",
+	Help: "Pod scrapes performed for custom metrics requests, by result.",
+}, []string{"result"})
+
+// DefaultMetrics is served when no mapping is configured.
+var DefaultMetrics = map[string]string{
+	"in_flight_requests": "http_server_requests_in_flight",
+	"queue_depth":        "workpool_queue_depth",
+}
+
+// Options configures the adapter.
+type Options struct {
+	// Metrics maps the metric name exposed to HPAs to the Prometheus metric
+	// family scraped from pods, e.g. "in_flight_requests" →
+	// "http_server_requests_in_flight".
+	Metrics map[string]string
+	// ScrapePort and ScrapePath locate each pod's Prometheus endpoint.
+	ScrapePort int
+	ScrapePath string
+	// Namespaces limits which namespaces can be queried (empty = all).
+	Namespaces []string
+	// AllowedNames are the client certificate common names admitted, from
+	// Authentication (empty = any verified certificate).
+	AllowedNames []string
+}
+
+// Adapter implements the pods subset of custom.metrics.k8s.io.
+type Adapter struct {
+	pods    corelisters.PodLister
+	client  *http.Client
+	opts    Options
+	allowed map[string]bool
+	logger  *zap.Logger
+}
+
+// New registers a Pod informer on factory; the factory must be started
+// afterwards.
+func New(factory informers.SharedInformerFactory, client *http.Client, opts Options, logger *zap.Logger) *Adapter {
+	if opts.ScrapePath == "" {
+		opts.ScrapePath = "/metrics"
+	}
+	a := &Adapter{
+		pods:   factory.Core().V1().Pods().Lister(),
+		client: client,
+		opts:   opts,
+		logger: logger,
+	}
+	if len(opts.Namespaces) > 0 {
+		a.allowed = make(map[string]bool, len(opts.Namespaces))
+		for _, ns := range opts.Namespaces {
+			a.allowed[ns] = true
+		}
+	}
+	return a
+}
+
+// Handler returns the routes proxied by the aggregator. The server's TLS
+// config must verify client certificates against Authentication.ClientCAs;
+// only /healthz is served without one.
+func (a *Adapter) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET "+basePath, a.authenticate(http.HandlerFunc(a.discovery)))
+	mux.Handle("GET "+basePath+"/namespaces/{ns}/pods/{name}/{metric}", a.authenticate(http.HandlerFunc(a.podMetric)))
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return mux
+}
+
+func (a *Adapter) discovery(w http.ResponseWriter, _ *http.Request) {
+	names := make([]string, 0, len(a.opts.Metrics))
+	for name := range a.opts.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := metav1.APIResourceList{
+		TypeMeta:     metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+		GroupVersion: GroupVersion,
+	}
+	for _, name := range names {
+		list.APIResources = append(list.APIResources, metav1.APIResource{
+			Name:       "pods/" + name,
+			Namespaced: true,
+			Kind:       "MetricValueList",
+			Verbs:      []string{"get"},
+		})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (a *Adapter) podMetric(w http.ResponseWriter, r *http.Request) {
+	ns, name, metric := r.PathValue("ns"), r.PathValue("name"), r.PathValue("metric")
+
+	family, ok := a.opts.Metrics[metric]
+	if !ok {
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, fmt.Sprintf("metric %q is not served", metric))
+		return
+	}
+	if a.allowed != nil && !a.allowed[ns] {
+		writeStatus(w, http.StatusForbidden, metav1.StatusReasonForbidden, "namespace not allowed")
+		return
+	}
+
+	var pods []*corev1.Pod
+	if name == cmv1beta2.AllObjects {
+		selector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+		if err != nil {
+			writeStatus(w, http.StatusBadRequest, metav1.StatusReasonBadRequest, "invalid labelSelector: "+err.Error())
+			return
+		}
+		if pods, err = a.pods.Pods(ns).List(selector); err != nil {
+			writeStatus(w, http.StatusInternalServerError, metav1.StatusReasonInternalError, "failed to list pods")
+			return
+		}
+	} else {
+		pod, err := a.pods.Pods(ns).Get(name)
+		if err != nil {
+			writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, fmt.Sprintf("pod %q not found", name))
+			return
+		}
+		pods = []*corev1.Pod{pod}
+	}
+
+	items := a.collect(r.Context(), pods, metric, family)
+	if name != cmv1beta2.AllObjects && len(items) == 0 {
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound,
+			fmt.Sprintf("metric %q unavailable for pod %q", metric, name))
+		return
+	}
+	writeJSON(w, http.StatusOK, cmv1beta2.MetricValueList{
+		TypeMeta: metav1.TypeMeta{Kind: "MetricValueList", APIVersion: GroupVersion},
+		Items:    items,
+	})
+}
+
+// collect scrapes running pods in parallel. Pods that cannot be scraped are
+// left out, which the HPA treats as missing data.
+func (a *Adapter) collect(ctx context.Context, pods []*corev1.Pod, metric, family string) []cmv1beta2.MetricValue {
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		items = make([]cmv1beta2.MetricValue, 0, len(pods))
+		sem   = make(chan struct{}, scrapeConcurrency)
+	)
+	for _, pod := range pods {
+		if pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" || pod.DeletionTimestamp != nil {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			value, err := a.scrape(ctx, pod.Status.PodIP, family)
+			if err != nil {
+				scrapesTotal.WithLabelValues("error").Inc()
+				a.logger.Debug("custom metrics scrape failed",
+					zap.String("namespace", pod.Namespace),
+					zap.String("pod", pod.Name),
+					zap.Error(err),
+				)
+				return
+			}
+			scrapesTotal.WithLabelValues("ok").Inc()
+
+			mu.Lock()
+			defer mu.Unlock()
+			items = append(items, cmv1beta2.MetricValue{
+				DescribedObject: corev1.ObjectReference{
+					Kind:       "Pod",
+					APIVersion: "/v1",
+					Namespace:  pod.Namespace,
+					Name:       pod.Name,
+				},
+				Metric:    cmv1beta2.MetricIdentifier{Name: metric},
+				Timestamp: metav1.NewTime(time.Now()),
+				Value:     *resource.NewMilliQuantity(int64(value*1000), resource.DecimalSI),
+			})
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].DescribedObject.Name < items[j].DescribedObject.Name
+	})
+	return items
+}
+
+// scrape returns the sum of all gauge, counter or untyped samples of family
+// exposed by the pod at ip.
+func (a *Adapter) scrape(ctx context.Context, ip, family string) (float64, error) {
+	url := "http://" + net.JoinHostPort(ip, strconv.Itoa(a.opts.ScrapePort)) + a.opts.ScrapePath
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", string(expfmt.NewFormat(expfmt.TypeTextPlain)))
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	parser := expfmt.NewTextParser(model.UTF8Validation)
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	mf, ok := families[family]
+	if !ok {
+		return 0, fmt.Errorf("metric family %q not exposed", family)
+	}
+	return sum(mf), nil
+}
+
+func sum(mf *dto.MetricFamily) float64 {
+	var total float64
+	for _, m := range mf.GetMetric() {
+		switch {
+		case m.Gauge != nil:
+			total += m.GetGauge().GetValue()
+		case m.Counter != nil:
+			total += m.GetCounter().GetValue()
+		case m.Untyped != nil:
+			total += m.GetUntyped().GetValue()
+		}
+	}
+	return total
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
+
+// writeStatus replies with a metav1.Status, which is what API clients expect
+// on error.
+func writeStatus(w http.ResponseWriter, code int, reason metav1.StatusReason, msg string) {
+	writeJSON(w, code, metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusFailure,
+		Code:     int32(code),
+		Reason:   reason,
+		Message:  msg,
+	})
+}
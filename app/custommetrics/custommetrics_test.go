@@ -0,0 +1,190 @@
+package custommetrics
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	cmv1beta2 "k8s.io/metrics/pkg/apis/custom_metrics/v1beta2"
+)
+
+func runningPod(name, ip string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: name, Labels: map[string]string{"app": "api"}},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning, PodIP: ip},
+	}
+}
+
+func newAdapter(t *testing.T, pods ...*corev1.Pod) http.Handler {
+	t.Helper()
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("# TYPE http_server_requests_in_flight gauge\nhttp_server_requests_in_flight 7\n"))
+	}))
+	t.Cleanup(target.Close)
+	_, port, _ := net.SplitHostPort(target.Listener.Addr().String())
+	scrapePort, _ := strconv.Atoi(port)
+
+	cs := fake.NewClientset()
+	for _, p := range pods {
+		cs.Tracker().Add(p)
+	}
+	factory := informers.NewSharedInformerFactory(cs, 0)
+	a := New(factory, target.Client(), Options{
+		Metrics:      map[string]string{"in_flight_requests": "http_server_requests_in_flight"},
+		ScrapePort:   scrapePort,
+		AllowedNames: []string{"front-proxy-client"},
+	}, zap.NewNop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+	t.Cleanup(func() {
+		cancel()
+		factory.Shutdown()
+	})
+	return a.Handler()
+}
+
+// clientCert returns a self-signed certificate for cn and its PEM.
+func clientCert(t *testing.T, cn string) (*x509.Certificate, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// getAs requests path as a client whose certificate for cn the TLS
+// handshake verified; an empty cn sends no certificate.
+func getAs(t *testing.T, h http.Handler, path, cn string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if cn != "" {
+		cert, _ := clientCert(t, cn)
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func get(t *testing.T, h http.Handler, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	return getAs(t, h, path, "front-proxy-client")
+}
+
+func TestDiscovery(t *testing.T) {
+	h := newAdapter(t)
+	rec := get(t, h, basePath)
+	var list metav1.APIResourceList
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(list.APIResources) != 1 || list.APIResources[0].Name != "pods/in_flight_requests" {
+		t.Errorf("expected pods/in_flight_requests, got %+v", list.APIResources)
+	}
+}
+
+func TestPodMetricsBySelector(t *testing.T) {
+	pending := runningPod("api-2", "")
+	pending.Status.Phase = corev1.PodPending
+	h := newAdapter(t, runningPod("api-1", "127.0.0.1"), pending)
+
+	rec := get(t, h, basePath+"/namespaces/team-a/pods/*/in_flight_requests?labelSelector=app%3Dapi")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var list cmv1beta2.MetricValueList
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(list.Items) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(list.Items))
+	}
+	if got := list.Items[0].Value.Value(); got != 7 {
+		t.Errorf("expected value 7, got %d", got)
+	}
+	if got := list.Items[0].DescribedObject.Name; got != "api-1" {
+		t.Errorf("expected api-1, got %q", got)
+	}
+}
+
+func TestUnknownMetric(t *testing.T) {
+	h := newAdapter(t, runningPod("api-1", "127.0.0.1"))
+	if rec := get(t, h, basePath+"/namespaces/team-a/pods/api-1/queue_depth"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestRequiresAggregatorCertificate(t *testing.T) {
+	h := newAdapter(t)
+	if rec := getAs(t, h, basePath, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a client certificate, got %d", rec.Code)
+	}
+	if rec := getAs(t, h, basePath, "mallory"); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a name not allowed, got %d", rec.Code)
+	}
+	if rec := getAs(t, h, "/healthz", ""); rec.Code != http.StatusOK {
+		t.Errorf("expected /healthz without a certificate, got %d", rec.Code)
+	}
+}
+
+func TestLoadAuthentication(t *testing.T) {
+	ca, caPEM := clientCert(t, "front-proxy-ca")
+	cs := fake.NewClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: metav1.NamespaceSystem, Name: authConfigMap},
+		Data: map[string]string{
+			"requestheader-client-ca-file": string(caPEM),
+			"requestheader-allowed-names":  `["front-proxy-client"]`,
+		},
+	})
+	auth, err := LoadAuthentication(context.Background(), cs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(auth.AllowedNames) != 1 || auth.AllowedNames[0] != "front-proxy-client" {
+		t.Errorf("expected allowed name front-proxy-client, got %v", auth.AllowedNames)
+	}
+	if _, err := ca.Verify(x509.VerifyOptions{Roots: auth.ClientCAs, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Errorf("expected the CA in the pool: %v", err)
+	}
+
+	if _, err := LoadAuthentication(context.Background(), fake.NewClientset()); err == nil {
+		t.Error("expected error without the ConfigMap")
+	}
+}
@@ -0,0 +1,102 @@
+// Package dev lets contributors run the whole platform API on a laptop with
+// no external dependencies. It provides the defaults the --dev flag applies
+// (memory store and event bus, the Kubernetes features, debug logs and the
+// API explorer), sample fixtures for the store, a fake cluster seeded with
+// matching workloads that allows every access review, and a middleware that
+// serves requests without an identity as the developer.
+//
+// Nothing here is safe for a shared deployment: anyone who can reach the
+// service can do anything.
+package dev
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	authzv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/access"
+)
+
+// User and Group are the identity of requests that arrive without one.
+// Group administers every feature the dev defaults enable.
+const (
+	User  = "developer"
+	Group = "platform-admins"
+)
+
+// Defaults are the settings --dev applies. Settings already in the
+// environment win, so a contributor can, say, point the store at a local
+// PostgreSQL and keep the rest.
+var Defaults = map[string]string{
+	"DEV_MODE":             "true",
+	"API_EXPLORER_ENABLED": "true",
+	"ENVIRONMENT":          "development",
+	"LOG_LEVEL":            "debug",
+	"STORE_BACKEND":        "memory",
+	"EVENTS_BACKEND":       "memory",
+	"KUBE_ENABLED":         "true",
+	// The explorer, on this machine, may name other users
+	"AUTH_PROXY_TRUSTED_CIDRS": "127.0.0.0/8,::1/128",
+	// Features that run against the fake cluster and the memory store
+	"RESOURCES_API_ENABLED":  "true",
+	"RESOURCES_ADMIN_GROUPS": Group,
+	"SEARCH_ENABLED":         "true",
+	"PDBS_ENABLED":           "true",
+	"QUOTA_REPORT_ENABLED":   "true",
+	"NODE_OPS_ENABLED":       "true",
+	"NODE_OPS_GROUPS":        Group,
+	"LOCKS_ENABLED":          "true",
+	"LOCKS_NAMESPACE":        PlatformNamespace,
+}
+
+// UseDefaults sets the Defaults missing from the environment, before the
+// configuration is loaded, and returns the keys it set in order.
+func UseDefaults() ([]string, error) {
+	var set []string
+	for key, value := range Defaults {
+		if _, ok := os.LookupEnv(key); ok {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return nil, fmt.Errorf("dev: set %s: %w", key, err)
+		}
+		set = append(set, key)
+	}
+	slices.Sort(set)
+	return set, nil
+}
+
+// Clientset returns a fake clientset holding objects that allows every
+// SubjectAccessReview, so the developer may do anything in the cluster.
+func Clientset(objects ...runtime.Object) *fake.Clientset {
+	cs := fake.NewClientset(objects...)
+	cs.PrependReactor("create", "subjectaccessreviews", func(a k8stesting.Action) (bool, runtime.Object, error) {
+		sar := a.(k8stesting.CreateAction).GetObject().(*authzv1.SubjectAccessReview)
+		sar.Status.Allowed = true
+		sar.Status.Reason = "dev mode allows everything"
+		return true, sar, nil
+	})
+	return cs
+}
+
+// Identity serves requests that carry no user in userHeader as User in
+// Group, standing in for the authenticating proxy. Requests naming a user
+// keep it, so other users can still be tried; AUTH_PROXY_TRUSTED_CIDRS
+// must trust the client for the header to get this far.
+func Identity(userHeader, groupsHeader string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimSpace(r.Header.Get(userHeader)) == "" {
+			r = r.Clone(access.FromProxy(r.Context()))
+			r.Header.Set(userHeader, User)
+			r.Header.Set(groupsHeader, Group)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
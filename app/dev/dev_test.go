@@ -0,0 +1,103 @@
+package dev
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	authzv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+func TestUseDefaultsKeepsEnvironment(t *testing.T) {
+	for key := range Defaults {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+	t.Setenv("STORE_BACKEND", "postgres")
+
+	set, err := UseDefaults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := os.Getenv("STORE_BACKEND"); got != "postgres" {
+		t.Errorf("expected the environment's store backend kept, got %q", got)
+	}
+	if got := os.Getenv("DEV_MODE"); got != "true" {
+		t.Errorf("expected DEV_MODE defaulted, got %q", got)
+	}
+	if len(set) != len(Defaults)-1 || set[0] != "API_EXPLORER_ENABLED" {
+		t.Errorf("expected every default but STORE_BACKEND set, sorted, got %v", set)
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	var user, groups string
+	h := Identity("X-Forwarded-User", "X-Forwarded-Groups", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, groups = r.Header.Get("X-Forwarded-User"), r.Header.Get("X-Forwarded-Groups")
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if user != User || groups != Group {
+		t.Errorf("expected anonymous requests to be the developer, got %q %q", user, groups)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Forwarded-User", "mallory")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if user != "mallory" || groups != "" {
+		t.Errorf("expected a named user kept as is, got %q %q", user, groups)
+	}
+}
+
+func TestSampleData(t *testing.T) {
+	seed, err := Seed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := store.NewMemory()
+	if err := seed.Apply(context.Background(), st); err != nil {
+		t.Fatalf("expected the seed to apply to an empty store: %v", err)
+	}
+
+	cs := Clientset(Objects()...)
+	// Each tenant's namespace is in the cluster
+	for _, tenant := range seed.Tenants {
+		ns := tenant.Labels["namespace"]
+		if _, err := cs.CoreV1().Namespaces().Get(t.Context(), ns, metav1.GetOptions{}); err != nil {
+			t.Errorf("expected namespace %s of tenant %s: %v", ns, tenant.Name, err)
+		}
+	}
+	pods, err := cs.CoreV1().Pods("payments").List(t.Context(), metav1.ListOptions{LabelSelector: "app=ledger"})
+	if err != nil || len(pods.Items) != 3 {
+		t.Errorf("expected a pod per ledger replica, got %v %v", pods, err)
+	}
+
+	review, err := cs.AuthorizationV1().SubjectAccessReviews().Create(t.Context(), &authzv1.SubjectAccessReview{
+		Spec: authzv1.SubjectAccessReviewSpec{User: "anyone", ResourceAttributes: &authzv1.ResourceAttributes{Verb: "delete", Resource: "nodes"}},
+	}, metav1.CreateOptions{})
+	if err != nil || !review.Status.Allowed {
+		t.Errorf("expected every review allowed, got %+v %v", review, err)
+	}
+}
+
+func TestExplorer(t *testing.T) {
+	h := Explorer(ExplorerOptions{Service: "platform-api", UserHeader: "X-Forwarded-User", GroupsHeader: "X-Forwarded-Groups"})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/explorer", nil))
+
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("expected an HTML page, got %d %v", rec.Code, rec.Header())
+	}
+	for _, want := range []string{"platform-api API explorer", `"X-Forwarded-User"`, `data-path="/api/v1/workloads/deployments"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %s in the page", want)
+		}
+	}
+}
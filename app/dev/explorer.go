@@ -0,0 +1,97 @@
+package dev
+
+import (
+	"bytes"
+	_ "embed"
+	"html/template"
+	"net/http"
+	"strconv"
+)
+
+//go:embed explorer.html
+var explorerPage string
+
+var explorerTemplate = template.Must(template.New("explorer").Parse(explorerPage))
+
+// ExplorerOptions configures the explorer page.
+type ExplorerOptions struct {
+	// Service names the API in the page title.
+	Service string
+	// UserHeader and GroupsHeader carry the identity the page sends
+	// requests as.
+	UserHeader   string
+	GroupsHeader string
+}
+
+// Example is a request the explorer offers to fill in.
+type Example struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+// ExampleGroup is a titled list of examples.
+type ExampleGroup struct {
+	Name     string
+	Requests []Example
+}
+
+// Examples are the explorer's sample requests, against the sample data.
+var Examples = []ExampleGroup{
+	{"Service", []Example{
+		{Method: http.MethodGet, Path: "/api/v1/info"},
+		{Method: http.MethodGet, Path: "/api/v1/status"},
+		{Method: http.MethodGet, Path: "/api/v1/features"},
+		{Method: http.MethodGet, Path: "/api/v1/events"},
+	}},
+	{"Tenants and services", []Example{
+		{Method: http.MethodGet, Path: "/api/v1/tenants"},
+		{Method: http.MethodPost, Path: "/api/v1/tenants", Body: `{"name": "checkout", "display_name": "Checkout", "owner": "team-checkout"}`},
+		{Method: http.MethodGet, Path: "/api/v1/tenants/payments/history"},
+		{Method: http.MethodGet, Path: "/api/v1/environments"},
+		{Method: http.MethodGet, Path: "/api/v1/search?q=ledger"},
+		{Method: http.MethodPost, Path: "/graphql", Body: `{"query": "{ tenants { name services { name } } }"}`},
+	}},
+	{"Cluster", []Example{
+		{Method: http.MethodGet, Path: "/api/v1/workloads/deployments"},
+		{Method: http.MethodGet, Path: "/api/v1/nodes"},
+		{Method: http.MethodGet, Path: "/api/v1/namespaces/payments/events"},
+		{Method: http.MethodGet, Path: "/api/v1/namespaces/payments/pods/ledger-0/logs"},
+		{Method: http.MethodGet, Path: "/api/v1/quotas"},
+		{Method: http.MethodPost, Path: "/api/v1/authz/check", Body: `{"checks": [{"verb": "delete", "resource": "pods", "namespace": "payments"}]}`},
+	}},
+	{"Disruption budgets", []Example{
+		{Method: http.MethodGet, Path: "/api/v1/pdbs/templates"},
+		{Method: http.MethodPost, Path: "/api/v1/namespaces/payments/pdbs", Body: `{"template": "one-at-a-time", "kind": "Deployment", "name": "ledger"}`},
+		{Method: http.MethodGet, Path: "/api/v1/namespaces/payments/pdbs"},
+		{Method: http.MethodGet, Path: "/api/v1/pdbs/findings"},
+	}},
+	{"Operations", []Example{
+		{Method: http.MethodPost, Path: "/api/v1/admin/nodes/dev-node-2/cordon"},
+		{Method: http.MethodPost, Path: "/api/v1/admin/nodes/dev-node-2/uncordon"},
+		{Method: http.MethodPost, Path: "/api/v1/locks/release-train", Body: `{"holder": "developer", "ttl": "5m"}`},
+		{Method: http.MethodGet, Path: "/api/v1/locks/release-train"},
+	}},
+}
+
+// Explorer serves a page for sending requests to the API as any user,
+// starting from the Examples. It is rendered once, up front.
+func Explorer(opts ExplorerOptions) http.Handler {
+	var buf bytes.Buffer
+	err := explorerTemplate.Execute(&buf, struct {
+		ExplorerOptions
+		User   string
+		Groups []ExampleGroup
+	}{opts, User, Examples})
+	if err != nil {
+		// The template and its data are fixed, so this is a bug
+		panic("dev: render explorer: " + err.Error())
+	}
+	page := buf.Bytes()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Length", strconv.Itoa(len(page)))
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(page)
+	})
+}
@@ -0,0 +1,203 @@
+package dev
+
+import (
+	_ "embed"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+// PlatformNamespace is the sample cluster's namespace for the platform's
+// own objects, such as locks.
+const PlatformNamespace = "platform"
+
+//go:embed seed.json
+var seed []byte
+
+// Seed returns the sample store fixtures: the payments and search tenants,
+// their services, and what is deployed where.
+func Seed() (*store.Seed, error) {
+	return store.ParseSeed(seed)
+}
+
+// workload is a sample Deployment, matching the production deployments in
+// the seed.
+type workload struct {
+	namespace, name, image string
+	replicas               int32
+}
+
+var workloads = []workload{
+	{"payments", "ledger", "registry.example.com/payments/ledger:1.2.0", 3},
+	{"payments", "gateway", "registry.example.com/payments/gateway:2.0.4", 2},
+	{"search", "indexer", "registry.example.com/search/indexer:0.9.1", 1},
+}
+
+var nodeNames = []string{"dev-node-1", "dev-node-2"}
+
+// Objects returns the sample cluster: a namespace per seeded tenant with
+// its workloads, their pods spread over two nodes, a quota per tenant and
+// a warning event.
+func Objects() []runtime.Object {
+	created := metav1.NewTime(time.Now().Add(-24 * time.Hour).Truncate(time.Second))
+	var objects []runtime.Object
+	for _, name := range nodeNames {
+		objects = append(objects, node(name, created))
+	}
+	objects = append(objects, namespace(PlatformNamespace, created))
+
+	tenants := map[string]bool{}
+	pods := 0
+	for _, w := range workloads {
+		if !tenants[w.namespace] {
+			tenants[w.namespace] = true
+			objects = append(objects, namespace(w.namespace, created), quota(w.namespace, created))
+		}
+		objects = append(objects, deployment(w, created))
+		for i := range w.replicas {
+			objects = append(objects, pod(w, i, nodeNames[pods%len(nodeNames)], created))
+			pods++
+		}
+	}
+	objects = append(objects, &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Namespace: "payments", Name: "gateway.backoff", CreationTimestamp: created},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: "payments", Name: "gateway-1"},
+		Type:           corev1.EventTypeWarning,
+		Reason:         "BackOff",
+		Message:        "Back-off restarting failed container gateway",
+		Count:          3,
+		FirstTimestamp: created,
+		LastTimestamp:  metav1.NewTime(time.Now().Truncate(time.Second)),
+	})
+	return objects
+}
+
+func namespace(name string, created metav1.Time) *corev1.Namespace {
+	return &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: created},
+		Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceActive},
+	}
+}
+
+func node(name string, created metav1.Time) *corev1.Node {
+	capacity := corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("4"),
+		corev1.ResourceMemory: resource.MustParse("16Gi"),
+		corev1.ResourcePods:   resource.MustParse("110"),
+	}
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			UID:               types.UID(name + "-uid"),
+			CreationTimestamp: created,
+			Labels: map[string]string{
+				"kubernetes.io/hostname":           name,
+				"node.kubernetes.io/instance-type": "dev.large",
+			},
+		},
+		Status: corev1.NodeStatus{
+			Capacity:    capacity,
+			Allocatable: capacity,
+			Conditions:  []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+			NodeInfo:    corev1.NodeSystemInfo{KubeletVersion: "v1.31.0", OSImage: "dev"},
+		},
+	}
+}
+
+func deployment(w workload, created metav1.Time) *appsv1.Deployment {
+	labels := map[string]string{"app": w.name}
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         w.namespace,
+			Name:              w.name,
+			UID:               types.UID(w.namespace + "-" + w.name + "-uid"),
+			CreationTimestamp: created,
+			Labels:            labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &w.replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{container(w)}},
+			},
+		},
+		Status: appsv1.DeploymentStatus{
+			Replicas:          w.replicas,
+			ReadyReplicas:     w.replicas,
+			AvailableReplicas: w.replicas,
+			UpdatedReplicas:   w.replicas,
+		},
+	}
+}
+
+func pod(w workload, i int32, nodeName string, created metav1.Time) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         w.namespace,
+			Name:              fmt.Sprintf("%s-%d", w.name, i),
+			UID:               types.UID(fmt.Sprintf("%s-%s-%d-uid", w.namespace, w.name, i)),
+			CreationTimestamp: created,
+			Labels:            map[string]string{"app": w.name},
+		},
+		Spec: corev1.PodSpec{NodeName: nodeName, Containers: []corev1.Container{container(w)}},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: w.name, Image: w.image, Ready: true, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: created}}},
+			},
+		},
+	}
+}
+
+func container(w workload) corev1.Container {
+	return corev1.Container{
+		Name:  w.name,
+		Image: w.image,
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("250m"),
+				corev1.ResourceMemory: resource.MustParse("512Mi"),
+			},
+		},
+	}
+}
+
+// quota is a tenant's quota, used up to the requests of its sample pods.
+func quota(ns string, created metav1.Time) *corev1.ResourceQuota {
+	cpu, memory := resource.MustParse("0"), resource.MustParse("0")
+	for _, w := range workloads {
+		if w.namespace != ns {
+			continue
+		}
+		requests := container(w).Resources.Requests
+		for range w.replicas {
+			cpu.Add(requests[corev1.ResourceCPU])
+			memory.Add(requests[corev1.ResourceMemory])
+		}
+	}
+	hard := corev1.ResourceList{
+		corev1.ResourceRequestsCPU:    resource.MustParse("2"),
+		corev1.ResourceRequestsMemory: resource.MustParse("4Gi"),
+	}
+	return &corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "tenant-quota", CreationTimestamp: created},
+		Spec:       corev1.ResourceQuotaSpec{Hard: hard},
+		Status: corev1.ResourceQuotaStatus{
+			Hard: hard,
+			Used: corev1.ResourceList{
+				corev1.ResourceRequestsCPU:    cpu,
+				corev1.ResourceRequestsMemory: memory,
+			},
+		},
+	}
+}
@@ -0,0 +1,210 @@
+// Package encryption seals secrets for storage with envelope encryption.
+// Every value gets its own AES-256-GCM data key. A master key wraps the
+// data key, and the wrapped key is stored with the ciphertext. The master
+// key stays in a KeyWrapper: Vault's transit engine, or a local keyring
+// for development. Rotating the master key only needs the data keys
+// rewrapped (see Rewrap), not the values re-encrypted.
+//
+// A sealed value is a string of four dot-separated base64url fields:
+//
+//	v1.<master key ID>.<wrapped data key>.<nonce and ciphertext>
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// version prefixes sealed values in the current format.
+const version = "v1"
+
+// dataKeySize is the size of AES-256 data keys.
+const dataKeySize = 32
+
+var (
+	// ErrMalformed is returned for values that are not sealed values.
+	ErrMalformed = errors.New("encryption: malformed sealed value")
+	// ErrUnknownKey is returned when a value's master key is not available.
+	ErrUnknownKey = errors.New("encryption: unknown master key")
+)
+
+var operationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "encryption_operations_total",
+	Help: "Envelope encryption operations by operation (seal, open or rewrap) and result.",
+}, []string{"operation", "result"})
+
+// KeyWrapper holds the master key that wraps data keys.
+type KeyWrapper interface {
+	// Wrap encrypts dataKey with the current master key and returns that
+	// key's ID, which identifies its version.
+	Wrap(ctx context.Context, dataKey []byte) (keyID string, wrapped []byte, err error)
+	// Unwrap decrypts a data key wrapped by the master key keyID.
+	Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+	// CurrentKeyID returns the ID Wrap would return now.
+	CurrentKeyID(ctx context.Context) (string, error)
+}
+
+// Encryptor seals and opens values.
+type Encryptor struct {
+	keys KeyWrapper
+}
+
+// New creates an encryptor wrapping data keys with keys.
+func New(keys KeyWrapper) *Encryptor {
+	return &Encryptor{keys: keys}
+}
+
+// CurrentKeyID returns the ID of the master key new values are sealed with.
+func (e *Encryptor) CurrentKeyID(ctx context.Context) (string, error) {
+	return e.keys.CurrentKeyID(ctx)
+}
+
+// Seal encrypts plaintext under a new data key. aad, such as the ID of the
+// record holding the value, is authenticated but not stored: Open needs
+// the same aad, so a sealed value copied to another record fails to open.
+func (e *Encryptor) Seal(ctx context.Context, plaintext, aad []byte) (string, error) {
+	sealed, err := e.seal(ctx, plaintext, aad)
+	observe("seal", err)
+	return sealed, err
+}
+
+func (e *Encryptor) seal(ctx context.Context, plaintext, aad []byte) (string, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	keyID, wrapped, err := e.keys.Wrap(ctx, dataKey)
+	if err != nil {
+		return "", fmt.Errorf("wrap data key: %w", err)
+	}
+	return format(keyID, wrapped, gcm.Seal(nonce, nonce, plaintext, aad)), nil
+}
+
+// Open decrypts a value sealed with aad.
+func (e *Encryptor) Open(ctx context.Context, sealed string, aad []byte) ([]byte, error) {
+	plaintext, err := e.open(ctx, sealed, aad)
+	observe("open", err)
+	return plaintext, err
+}
+
+func (e *Encryptor) open(ctx context.Context, sealed string, aad []byte) ([]byte, error) {
+	keyID, wrapped, ciphertext, err := parse(sealed)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := e.keys.Unwrap(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: decrypt value: %w", err)
+	}
+	return plaintext, nil
+}
+
+// Rewrap rewraps the data key of sealed with the current master key,
+// leaving the ciphertext as it is. It reports false and returns sealed
+// unchanged if it already uses the current key.
+func (e *Encryptor) Rewrap(ctx context.Context, sealed string) (string, bool, error) {
+	out, changed, err := e.rewrap(ctx, sealed)
+	if changed || err != nil {
+		observe("rewrap", err)
+	}
+	return out, changed, err
+}
+
+func (e *Encryptor) rewrap(ctx context.Context, sealed string) (string, bool, error) {
+	keyID, wrapped, ciphertext, err := parse(sealed)
+	if err != nil {
+		return "", false, err
+	}
+	current, err := e.keys.CurrentKeyID(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	if keyID == current {
+		return sealed, false, nil
+	}
+	dataKey, err := e.keys.Unwrap(ctx, keyID, wrapped)
+	if err != nil {
+		return "", false, fmt.Errorf("unwrap data key: %w", err)
+	}
+	newID, rewrapped, err := e.keys.Wrap(ctx, dataKey)
+	if err != nil {
+		return "", false, fmt.Errorf("wrap data key: %w", err)
+	}
+	return format(newID, rewrapped, ciphertext), true, nil
+}
+
+// KeyID returns the ID of the master key that sealed sealed.
+func KeyID(sealed string) (string, error) {
+	keyID, _, _, err := parse(sealed)
+	return keyID, err
+}
+
+func format(keyID string, wrapped, ciphertext []byte) string {
+	enc := base64.RawURLEncoding
+	return strings.Join([]string{
+		version,
+		enc.EncodeToString([]byte(keyID)),
+		enc.EncodeToString(wrapped),
+		enc.EncodeToString(ciphertext),
+	}, ".")
+}
+
+func parse(sealed string) (keyID string, wrapped, ciphertext []byte, err error) {
+	parts := strings.Split(sealed, ".")
+	if len(parts) != 4 || parts[0] != version {
+		return "", nil, nil, ErrMalformed
+	}
+	enc := base64.RawURLEncoding
+	id, err1 := enc.DecodeString(parts[1])
+	wrapped, err2 := enc.DecodeString(parts[2])
+	ciphertext, err3 := enc.DecodeString(parts[3])
+	if err1 != nil || err2 != nil || err3 != nil || len(id) == 0 {
+		return "", nil, nil, ErrMalformed
+	}
+	return string(id), wrapped, ciphertext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func observe(op string, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	operationsTotal.WithLabelValues(op, result).Inc()
+}
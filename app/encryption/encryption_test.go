@@ -0,0 +1,117 @@
+package encryption
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32)))
+}
+
+func TestSealOpenAndRotate(t *testing.T) {
+	ctx := context.Background()
+	old, err := NewKeyring(map[string]string{"k1": testKey('a')}, "k1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sealed, err := New(old).Seal(ctx, []byte("hunter2"), []byte("cred-1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(sealed, "hunter2") {
+		t.Fatal("expected the value encrypted")
+	}
+	if _, err := New(old).Open(ctx, sealed, []byte("cred-2")); err == nil {
+		t.Error("expected a value moved to another record to fail to open")
+	}
+
+	// Rotate: k2 wraps new keys, k1 still unwraps old ones
+	rotated, err := NewKeyring(map[string]string{"k1": testKey('a'), "k2": testKey('b')}, "k2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	enc := New(rotated)
+	rewrapped, changed, err := enc.Rewrap(ctx, sealed)
+	if err != nil || !changed {
+		t.Fatalf("expected the value rewrapped, got %v %v", changed, err)
+	}
+	if id, _ := KeyID(rewrapped); id != "k2" {
+		t.Errorf("expected key k2, got %q", id)
+	}
+	if _, changed, _ := enc.Rewrap(ctx, rewrapped); changed {
+		t.Error("expected a value on the current key left alone")
+	}
+	// k1 can now be dropped
+	retired, _ := NewKeyring(map[string]string{"k2": testKey('b')}, "k2")
+	if plaintext, err := New(retired).Open(ctx, rewrapped, []byte("cred-1")); err != nil || string(plaintext) != "hunter2" {
+		t.Errorf("expected hunter2, got %q %v", plaintext, err)
+	}
+	if _, err := New(retired).Open(ctx, sealed, []byte("cred-1")); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected ErrUnknownKey, got %v", err)
+	}
+	if _, err := KeyID("plaintext"); !errors.Is(err, ErrMalformed) {
+		t.Errorf("expected ErrMalformed, got %v", err)
+	}
+	if _, err := NewKeyring(map[string]string{"k1": "c2hvcnQ="}, "k1"); err == nil {
+		t.Error("expected a short key to be refused")
+	}
+}
+
+func TestVault(t *testing.T) {
+	// A fake transit engine that "encrypts" by prefixing the version
+	version := 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/v1/transit/encrypt/platform":
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+				"ciphertext": "vault:v" + string(rune('0'+version)) + ":" + body["plaintext"],
+			}})
+		case "/v1/transit/decrypt/platform":
+			_, plaintext, _ := strings.Cut(strings.TrimPrefix(body["ciphertext"], "vault:"), ":")
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"plaintext": plaintext}})
+		case "/v1/transit/keys/platform":
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"latest_version": version}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	enc := New(NewVault(srv.URL, "root", "transit", "platform", srv.Client()))
+	sealed, err := enc.Seal(ctx, []byte("hunter2"), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id, _ := KeyID(sealed); id != "vault:platform:v1" {
+		t.Errorf("expected key vault:platform:v1, got %q", id)
+	}
+	version = 2
+	rewrapped, changed, err := enc.Rewrap(ctx, sealed)
+	if id, _ := KeyID(rewrapped); err != nil || !changed || id != "vault:platform:v2" {
+		t.Errorf("expected the value moved to v2, got %q %v %v", id, changed, err)
+	}
+	if plaintext, err := enc.Open(ctx, rewrapped, nil); err != nil || string(plaintext) != "hunter2" {
+		t.Errorf("expected hunter2, got %q %v", plaintext, err)
+	}
+
+	denied := New(NewVault(srv.URL, "wrong", "transit", "platform", srv.Client()))
+	var vaultErr *VaultError
+	if _, err := denied.Seal(ctx, []byte("x"), nil); !errors.As(err, &vaultErr) || vaultErr.Errors[0] != "permission denied" {
+		t.Errorf("expected Vault's error, got %v", err)
+	}
+}
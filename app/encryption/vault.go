@@ -0,0 +1,144 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// VaultError is a non-2xx response from Vault.
+type VaultError struct {
+	StatusCode int
+	Errors     []string
+}
+
+func (e *VaultError) Error() string {
+	return fmt.Sprintf("vault: status %d: %s", e.StatusCode, strings.Join(e.Errors, "; "))
+}
+
+// Vault is a KeyWrapper backed by a key of Vault's transit secrets engine;
+// the master key never leaves Vault. Rotating the transit key in Vault
+// makes Wrap use its new version, and rewrapping moves values to it. Key
+// IDs are "vault:<key>:v<version>".
+type Vault struct {
+	baseURL string
+	token   string
+	mount   string
+	key     string
+	http    *http.Client
+}
+
+// NewVault creates a wrapper for the transit key named key, under the
+// engine mounted at mount (usually "transit") of the Vault server at
+// baseURL. token needs the encrypt and decrypt capabilities on the key,
+// and read on its configuration.
+func NewVault(baseURL, token, mount, key string, hc *http.Client) *Vault {
+	return &Vault{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		mount:   strings.Trim(mount, "/"),
+		key:     key,
+		http:    hc,
+	}
+}
+
+// Wrap implements KeyWrapper.
+func (v *Vault) Wrap(ctx context.Context, dataKey []byte) (string, []byte, error) {
+	var resp struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+			KeyVersion int    `json:"key_version"`
+		} `json:"data"`
+	}
+	body := map[string]string{"plaintext": base64.StdEncoding.EncodeToString(dataKey)}
+	if err := v.do(ctx, http.MethodPost, "encrypt", body, &resp); err != nil {
+		return "", nil, err
+	}
+	// The ciphertext starts with its key version, "vault:v3:..."
+	version, _, ok := strings.Cut(strings.TrimPrefix(resp.Data.Ciphertext, "vault:"), ":")
+	if !ok {
+		return "", nil, fmt.Errorf("vault: unexpected ciphertext format")
+	}
+	return v.keyID(version), []byte(resp.Data.Ciphertext), nil
+}
+
+// Unwrap implements KeyWrapper.
+func (v *Vault) Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	if !strings.HasPrefix(keyID, v.keyID("")) {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	var resp struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	if err := v.do(ctx, http.MethodPost, "decrypt", map[string]string{"ciphertext": string(wrapped)}, &resp); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+}
+
+// CurrentKeyID implements KeyWrapper.
+func (v *Vault) CurrentKeyID(ctx context.Context) (string, error) {
+	var resp struct {
+		Data struct {
+			LatestVersion int `json:"latest_version"`
+		} `json:"data"`
+	}
+	if err := v.do(ctx, http.MethodGet, "keys", nil, &resp); err != nil {
+		return "", err
+	}
+	return v.keyID(fmt.Sprintf("v%d", resp.Data.LatestVersion)), nil
+}
+
+// Check reports whether Vault serves the key, for the readiness probe.
+func (v *Vault) Check(ctx context.Context) error {
+	_, err := v.CurrentKeyID(ctx)
+	return err
+}
+
+func (v *Vault) keyID(version string) string {
+	return "vault:" + v.key + ":" + version
+}
+
+// do calls the transit endpoint op ("encrypt", "decrypt" or "keys") of
+// the key.
+func (v *Vault) do(ctx context.Context, method, op string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(buf)
+	}
+	path := "/v1/" + v.mount + "/" + op + "/" + url.PathEscape(v.key)
+	req, err := http.NewRequestWithContext(ctx, method, v.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := v.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// Vault errors look like {"errors": ["..."]}
+		vaultErr := &VaultError{StatusCode: resp.StatusCode}
+		json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(vaultErr)
+		return vaultErr
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,167 @@
+// Package errs classifies errors by kind, so that the layer answering a
+// request can choose its status without knowing which layer failed. A
+// store, the Kubernetes client or a domain package returns an error of a
+// kind (errors.Is(err, errs.NotFound)); a handler maps it to an HTTP
+// status, the gRPC server to a status code.
+//
+// Packages keep their own sentinel errors, declared with New so that they
+// are of a kind as well:
+//
+//	var ErrNotFound = errs.New(errs.NotFound, "lock not found")
+//
+// and errors from elsewhere are classified with Wrap or Errorf.
+package errs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The kinds of error. Test for them with errors.Is.
+var (
+	// NotFound: the entity does not exist.
+	NotFound = errors.New("not found")
+	// Conflict: the request clashes with the current state, such as an
+	// existing name, a stale version or a lock held by someone else.
+	Conflict = errors.New("conflict")
+	// Invalid: the request is malformed or breaks a rule; the message says
+	// why and is meant for the caller.
+	Invalid = errors.New("invalid")
+	// Unauthorized: the caller is not authenticated.
+	Unauthorized = errors.New("unauthorized")
+	// Forbidden: the caller is authenticated but not allowed.
+	Forbidden = errors.New("forbidden")
+	// Unavailable: a dependency is down or overloaded; the request may
+	// succeed later.
+	Unavailable = errors.New("unavailable")
+)
+
+var kinds = []error{NotFound, Conflict, Invalid, Unauthorized, Forbidden, Unavailable}
+
+// kindError is an error of a kind. Its message is its own, or err's.
+type kindError struct {
+	kind error
+	msg  string
+	err  error
+}
+
+func (e *kindError) Error() string {
+	if e.err != nil {
+		return e.err.Error()
+	}
+	return e.msg
+}
+
+func (e *kindError) Unwrap() []error {
+	if e.err != nil {
+		return []error{e.kind, e.err}
+	}
+	return []error{e.kind}
+}
+
+// New returns an error of kind with msg, typically a package's sentinel.
+func New(kind error, msg string) error {
+	return &kindError{kind: kind, msg: msg}
+}
+
+// Errorf formats an error of kind as fmt.Errorf does; errors wrapped with
+// %w stay visible to errors.Is and errors.As.
+func Errorf(kind error, format string, args ...any) error {
+	return &kindError{kind: kind, err: fmt.Errorf(format, args...)}
+}
+
+// Wrap classifies err as kind, keeping its message and chain. It returns
+// nil if err is nil.
+func Wrap(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// Kind returns the kind of err, or nil if it has none. A deadline that
+// passed counts as Unavailable.
+func Kind(err error) error {
+	for _, k := range kinds {
+		if errors.Is(err, k) {
+			return k
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return Unavailable
+	}
+	return nil
+}
+
+// HTTPStatus returns the response status for err: 500 if it has no kind.
+func HTTPStatus(err error) int {
+	switch Kind(err) {
+	case NotFound:
+		return http.StatusNotFound
+	case Conflict:
+		return http.StatusConflict
+	case Invalid:
+		return http.StatusBadRequest
+	case Unauthorized:
+		return http.StatusUnauthorized
+	case Forbidden:
+		return http.StatusForbidden
+	case Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// GRPCCode returns the status code for err: a gRPC status error's own
+// code, or Unknown if it has no kind.
+func GRPCCode(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	if s, ok := status.FromError(err); ok {
+		return s.Code()
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	}
+	switch Kind(err) {
+	case NotFound:
+		return codes.NotFound
+	case Conflict:
+		return codes.Aborted
+	case Invalid:
+		return codes.InvalidArgument
+	case Unauthorized:
+		return codes.Unauthenticated
+	case Forbidden:
+		return codes.PermissionDenied
+	case Unavailable:
+		return codes.Unavailable
+	}
+	return codes.Unknown
+}
+
+// GRPCStatus turns err into a gRPC status error. Errors of a kind keep
+// their message; others become Internal, since their message may carry
+// details the caller should not see. Status errors pass through.
+func GRPCStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	code := GRPCCode(err)
+	if code == codes.Unknown {
+		return status.Error(codes.Internal, "internal server error")
+	}
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,79 @@
+package errs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestKinds(t *testing.T) {
+	errLocked := New(Conflict, "lock is held by another holder")
+	tests := []struct {
+		name string
+		err  error
+		kind error
+		http int
+		grpc codes.Code
+	}{
+		{"sentinel", errLocked, Conflict, http.StatusConflict, codes.Aborted},
+		{"wrapped sentinel", fmt.Errorf("acquire deploy: %w", errLocked), Conflict, http.StatusConflict, codes.Aborted},
+		{"errorf", Errorf(Invalid, "limit %d out of range", 900), Invalid, http.StatusBadRequest, codes.InvalidArgument},
+		{"wrap", Wrap(NotFound, io.EOF), NotFound, http.StatusNotFound, codes.NotFound},
+		{"unauthorized", New(Unauthorized, "token expired"), Unauthorized, http.StatusUnauthorized, codes.Unauthenticated},
+		{"forbidden", New(Forbidden, "missing permission"), Forbidden, http.StatusForbidden, codes.PermissionDenied},
+		{"unavailable", New(Unavailable, "pool saturated"), Unavailable, http.StatusServiceUnavailable, codes.Unavailable},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), Unavailable, http.StatusServiceUnavailable, codes.DeadlineExceeded},
+		{"unclassified", io.ErrUnexpectedEOF, nil, http.StatusInternalServerError, codes.Unknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if k := Kind(tt.err); k != tt.kind {
+				t.Errorf("expected kind %v, got %v", tt.kind, k)
+			}
+			if s := HTTPStatus(tt.err); s != tt.http {
+				t.Errorf("expected HTTP status %d, got %d", tt.http, s)
+			}
+			if c := GRPCCode(tt.err); c != tt.grpc {
+				t.Errorf("expected gRPC code %v, got %v", tt.grpc, c)
+			}
+		})
+	}
+}
+
+func TestWrapKeepsChain(t *testing.T) {
+	err := Errorf(Unavailable, "dial postgres: %w", io.ErrClosedPipe)
+	if err.Error() != "dial postgres: io: read/write on closed pipe" {
+		t.Errorf("expected the formatted message, got %q", err)
+	}
+	if !errors.Is(err, io.ErrClosedPipe) || !errors.Is(err, Unavailable) {
+		t.Error("expected both the kind and the wrapped error in the chain")
+	}
+	if Wrap(NotFound, nil) != nil {
+		t.Error("expected wrapping nil to give nil")
+	}
+	if sentinel := New(NotFound, "session not found"); sentinel.Error() != "session not found" || errors.Is(sentinel, Conflict) {
+		t.Errorf("expected the sentinel's own message and kind only, got %q", sentinel)
+	}
+}
+
+func TestGRPCStatus(t *testing.T) {
+	if s := status.Convert(GRPCStatus(New(NotFound, "tenant not found"))); s.Code() != codes.NotFound || s.Message() != "tenant not found" {
+		t.Errorf("expected NotFound with the message, got %v", s)
+	}
+	if s := status.Convert(GRPCStatus(errors.New("pq: password authentication failed"))); s.Code() != codes.Internal || s.Message() != "internal server error" {
+		t.Errorf("expected an unclassified error hidden behind Internal, got %v", s)
+	}
+	original := status.Error(codes.ResourceExhausted, "slow down")
+	if GRPCStatus(original) != original {
+		t.Error("expected status errors to pass through")
+	}
+	if GRPCStatus(nil) != nil {
+		t.Error("expected nil to stay nil")
+	}
+}
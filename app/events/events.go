@@ -0,0 +1,113 @@
+// Package events is the internal event bus. Components publish domain events
+// (webhook deliveries, provisioning results, security events) and other
+// components subscribe to them without knowing about each other.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event is a single message on the bus.
+type Event struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Source string          `json:"source"`
+	Time   time.Time       `json:"time"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+// New builds an event with a fresh ID and timestamp. data is marshalled to
+// JSON; a json.RawMessage is used as-is.
+func New(eventType, source string, data any) (Event, error) {
+	raw, ok := data.(json.RawMessage)
+	if !ok && data != nil {
+		var err error
+		if raw, err = json.Marshal(data); err != nil {
+			return Event{}, err
+		}
+	}
+	return Event{
+		ID:     uuid.NewString(),
+		Type:   eventType,
+		Source: source,
+		Time:   time.Now().UTC(),
+		Data:   raw,
+	}, nil
+}
+
+// remoteKey marks contexts delivering another instance's events.
+type remoteKey struct{}
+
+// WithRemote marks ctx as delivering an event another instance published,
+// so components forwarding events elsewhere do not send it on again.
+func WithRemote(ctx context.Context) context.Context {
+	return context.WithValue(ctx, remoteKey{}, true)
+}
+
+// IsRemote reports whether ctx was marked by WithRemote.
+func IsRemote(ctx context.Context) bool {
+	return ctx.Value(remoteKey{}) != nil
+}
+
+// Handler receives published events.
+type Handler func(ctx context.Context, e Event)
+
+// Publisher publishes events. Components that only emit events take one
+// rather than a Bus.
+type Publisher interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+// Bus publishes events to subscribers.
+type Bus interface {
+	Publisher
+	// Subscribe registers h for every event and returns a function that
+	// removes the subscription.
+	Subscribe(h Handler) (unsubscribe func())
+}
+
+// MemoryBus delivers events synchronously to in-process subscribers.
+type MemoryBus struct {
+	mu     sync.RWMutex
+	nextID int
+	subs   map[int]Handler
+}
+
+// NewMemoryBus creates an in-process bus.
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{subs: make(map[int]Handler)}
+}
+
+// Publish calls every subscriber in turn. Subscribers must not block.
+func (b *MemoryBus) Publish(ctx context.Context, e Event) error {
+	b.mu.RLock()
+	handlers := make([]Handler, 0, len(b.subs))
+	for _, h := range b.subs {
+		handlers = append(handlers, h)
+	}
+	b.mu.RUnlock()
+
+	for _, h := range handlers {
+		h(ctx, e)
+	}
+	return nil
+}
+
+// Subscribe implements Bus.
+func (b *MemoryBus) Subscribe(h Handler) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.nextID
+	b.nextID++
+	b.subs[id] = h
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs, id)
+	}
+}
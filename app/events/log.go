@@ -0,0 +1,107 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// Entry is an event with its position in a Log.
+type Entry struct {
+	Cursor uint64 `json:"cursor"`
+	Event
+}
+
+// Log keeps the most recent events in a ring buffer so clients can resume
+// from a cursor. Cursors increase monotonically from 1.
+type Log struct {
+	mu      sync.Mutex
+	entries []Entry
+	size    int
+	last    uint64
+	notify  chan struct{}
+}
+
+// NewLog creates a log retaining up to size events.
+func NewLog(size int) *Log {
+	if size <= 0 {
+		size = 1
+	}
+	return &Log{size: size, notify: make(chan struct{})}
+}
+
+// Record appends e to the log. Its signature matches Handler so a Log can be
+// subscribed to a Bus directly.
+func (l *Log) Record(_ context.Context, e Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.last++
+	if len(l.entries) == l.size {
+		copy(l.entries, l.entries[1:])
+		l.entries = l.entries[:l.size-1]
+	}
+	l.entries = append(l.entries, Entry{Cursor: l.last, Event: e})
+
+	// Wake every waiter; they re-check under the lock
+	close(l.notify)
+	l.notify = make(chan struct{})
+}
+
+// Cursor returns the cursor of the newest event (0 when empty).
+func (l *Log) Cursor() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.last
+}
+
+// Since returns up to limit events after cursor. truncated is true when
+// events after cursor have already been evicted from the buffer. A cursor
+// beyond the newest event, from before a restart, resets to the oldest
+// retained event and reports truncated.
+func (l *Log) Since(cursor uint64, limit int) (entries []Entry, truncated bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entries, truncated, _ = l.since(cursor, limit)
+	return entries, truncated
+}
+
+// Wait blocks until events after cursor exist or ctx is done, then returns
+// them as Since does. On timeout it returns no events and a nil error.
+func (l *Log) Wait(ctx context.Context, cursor uint64, limit int) ([]Entry, bool, error) {
+	for {
+		l.mu.Lock()
+		entries, truncated, notify := l.since(cursor, limit)
+		l.mu.Unlock()
+		if len(entries) > 0 {
+			return entries, truncated, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, false, nil
+			}
+			return nil, false, ctx.Err()
+		case <-notify:
+		}
+	}
+}
+
+func (l *Log) since(cursor uint64, limit int) ([]Entry, bool, chan struct{}) {
+	if len(l.entries) == 0 || cursor == l.last {
+		return nil, false, l.notify
+	}
+
+	oldest := l.entries[0].Cursor
+	// A cursor beyond the newest event predates a restart
+	truncated := cursor > l.last || cursor+1 < oldest
+	start := 0
+	if !truncated {
+		start = int(cursor + 1 - oldest)
+	}
+	tail := l.entries[start:]
+	if limit > 0 && len(tail) > limit {
+		tail = tail[:limit]
+	}
+	return append([]Entry(nil), tail...), truncated, l.notify
+}
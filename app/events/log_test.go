@@ -0,0 +1,125 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func record(l *Log, n int) {
+	for range n {
+		e, _ := New("test.event", "test", nil)
+		l.Record(context.Background(), e)
+	}
+}
+
+func TestLogSinceTruncates(t *testing.T) {
+	l := NewLog(3)
+	record(l, 5)
+
+	entries, truncated := l.Since(0, 0)
+	if !truncated {
+		t.Error("expected truncated when cursor is older than the buffer")
+	}
+	if len(entries) != 3 || entries[0].Cursor != 3 {
+		t.Errorf("expected cursors 3..5, got %+v", entries)
+	}
+
+	entries, truncated = l.Since(4, 0)
+	if truncated || len(entries) != 1 || entries[0].Cursor != 5 {
+		t.Errorf("expected only cursor 5, got %+v (truncated=%v)", entries, truncated)
+	}
+}
+
+func TestLogWaitWakesOnRecord(t *testing.T) {
+	l := NewLog(10)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		record(l, 1)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	entries, _, err := l.Wait(ctx, 0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected 1 event, got %d", len(entries))
+	}
+}
+
+func TestPollHandlerTimesOut(t *testing.T) {
+	l := NewLog(10)
+	record(l, 2)
+	h := NewPollHandler(l, time.Minute)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/events?since=2&wait=20ms", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var resp pollResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Events) != 0 {
+		t.Errorf("expected no events, got %d", len(resp.Events))
+	}
+	if resp.Cursor != "2" {
+		t.Errorf("expected cursor 2, got %s", resp.Cursor)
+	}
+}
+
+func TestPollHandlerRejectsBadCursor(t *testing.T) {
+	h := NewPollHandler(NewLog(1), time.Minute)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/events?since=abc", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestLogSinceResetsCursorBeyondHead(t *testing.T) {
+	l := NewLog(10)
+	record(l, 2)
+
+	entries, truncated := l.Since(50, 0)
+	if !truncated || len(entries) != 2 || entries[0].Cursor != 1 {
+		t.Errorf("expected cursors 1..2 and truncated, got %+v (truncated=%v)", entries, truncated)
+	}
+}
+
+func TestPollHandlerReturnsEventsRecordedWhileWaitingBeyondHead(t *testing.T) {
+	// After a restart the client's cursor is ahead of the new log
+	l := NewLog(10)
+	h := NewPollHandler(l, time.Minute)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		record(l, 2)
+	}()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/events?since=50&wait=1s", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var resp pollResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Events) == 0 || resp.Events[0].Cursor != 1 {
+		t.Fatalf("expected events from cursor 1, got %+v", resp.Events)
+	}
+	if !resp.Truncated {
+		t.Error("expected truncated after a cursor reset")
+	}
+	if want := strconv.FormatUint(resp.Events[len(resp.Events)-1].Cursor, 10); resp.Cursor != want {
+		t.Errorf("expected cursor %s, got %s", want, resp.Cursor)
+	}
+}
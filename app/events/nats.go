@@ -0,0 +1,338 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+var natsPublishDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "events_nats_publish_duration_seconds",
+	Help:    "Time for JetStream to acknowledge a stored event, by result.",
+	Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+}, []string{"result"})
+
+var errNATSDisconnected = errors.New("not connected to nats")
+
+// originHeader carries the publishing bus's ID, so a bus skips its own
+// events when its consumer delivers them back.
+const originHeader = "Platform-Origin"
+
+// NATSOptions configures a NATSBus.
+type NATSOptions struct {
+	// URL is nats://[user:password@]host:port, or tls://... to require TLS.
+	URL   string
+	Token string
+	// Stream is the JetStream stream keeping events under
+	// "<SubjectPrefix>.<event type>". It is created when missing, keeping
+	// events for MaxAge on Replicas servers.
+	Stream        string
+	SubjectPrefix string
+	MaxAge        time.Duration
+	Replicas      int
+	// Name identifies the connection in NATS monitoring.
+	Name string
+	// Consumer names this instance's durable consumer, so events stored
+	// while it was down are delivered when it comes back. Characters NATS
+	// does not allow in names are replaced; empty picks a random name.
+	Consumer string
+	// AckTimeout bounds the wait for JetStream to store an event.
+	AckTimeout time.Duration
+}
+
+// NATSBus delivers events to in-process subscribers like MemoryBus and
+// also stores them in a NATS JetStream stream, so they outlive restarts
+// and other services can consume them. Events other instances publish on
+// the stream's subjects reach local subscribers through a durable
+// consumer, with a context marked by WithRemote.
+type NATSBus struct {
+	local    *MemoryBus
+	opts     NATSOptions
+	origin   string
+	consumer string
+	logger   *zap.Logger
+
+	mu       sync.Mutex
+	nc       *nats.Conn // nil until Connect succeeds
+	js       jetstream.JetStream
+	consumed jetstream.ConsumeContext
+}
+
+// NewNATSBus connects to NATS and makes sure the stream exists. Lost
+// connections are re-established in the background; events published
+// meanwhile still reach local subscribers, but Publish reports them as not
+// stored.
+func NewNATSBus(ctx context.Context, opts NATSOptions, logger *zap.Logger) (*NATSBus, error) {
+	b, err := NewDisconnectedNATSBus(opts, logger)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.Connect(ctx); err != nil {
+		b.Shutdown(ctx)
+		return nil, err
+	}
+	return b, nil
+}
+
+// NewDisconnectedNATSBus creates the bus without connecting; until Connect
+// succeeds it behaves as while a lost connection is re-established.
+func NewDisconnectedNATSBus(opts NATSOptions, logger *zap.Logger) (*NATSBus, error) {
+	if _, err := url.Parse(opts.URL); err != nil {
+		return nil, fmt.Errorf("parse nats url: %w", err)
+	}
+	if opts.AckTimeout <= 0 {
+		opts.AckTimeout = 5 * time.Second
+	}
+	consumer := opts.Consumer
+	if consumer == "" {
+		consumer = uuid.NewString()
+	}
+	return &NATSBus{
+		local:    NewMemoryBus(),
+		opts:     opts,
+		origin:   uuid.NewString(),
+		consumer: nameToken(consumer),
+		logger:   logger,
+	}, nil
+}
+
+// Connect connects to NATS unless it is connected, makes sure the stream
+// and this instance's consumer exist, and starts consuming. It may be
+// called again after it fails.
+func (b *NATSBus) Connect(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.nc == nil {
+		nc, err := nats.Connect(b.opts.URL,
+			nats.Name(b.opts.Name),
+			nats.Token(b.opts.Token),
+			nats.MaxReconnects(-1),
+			nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+				b.logger.Warn("nats connection lost, reconnecting", zap.Error(err))
+			}),
+			nats.ReconnectHandler(b.reconnected),
+		)
+		if err != nil {
+			return fmt.Errorf("connect to nats: %w", err)
+		}
+		js, err := jetstream.New(nc)
+		if err != nil {
+			nc.Close()
+			return err
+		}
+		b.nc, b.js = nc, js
+	}
+	if err := b.ensureStream(ctx); err != nil {
+		return fmt.Errorf("ensure stream %s: %w", b.opts.Stream, err)
+	}
+	if b.consumed == nil {
+		consumer, err := b.ensureConsumer(ctx)
+		if err != nil {
+			return fmt.Errorf("ensure consumer %s: %w", b.consumer, err)
+		}
+		consumed, err := consumer.Consume(b.deliver, jetstream.ConsumeErrHandler(func(_ jetstream.ConsumeContext, err error) {
+			b.logger.Debug("jetstream consumer error", zap.Error(err))
+		}))
+		if err != nil {
+			return fmt.Errorf("consume %s: %w", b.consumer, err)
+		}
+		b.consumed = consumed
+	}
+	return nil
+}
+
+// reconnected re-creates the stream and consumer, which a server restarted
+// with memory storage has lost; consuming resumes by name.
+func (b *NATSBus) reconnected(*nats.Conn) {
+	b.logger.Info("reconnected to nats")
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), b.opts.AckTimeout)
+		defer cancel()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.js == nil {
+			return
+		}
+		if err := b.ensureStream(ctx); err != nil {
+			b.logger.Warn("failed to ensure jetstream stream", zap.String("stream", b.opts.Stream), zap.Error(err))
+			return
+		}
+		if _, err := b.ensureConsumer(ctx); err != nil {
+			b.logger.Warn("failed to ensure jetstream consumer", zap.String("consumer", b.consumer), zap.Error(err))
+		}
+	}()
+}
+
+// Publish delivers e to local subscribers, then stores it in the stream.
+// Events from other instances (see WithRemote) are only delivered locally.
+func (b *NATSBus) Publish(ctx context.Context, e Event) error {
+	b.local.Publish(ctx, e)
+	if IsRemote(ctx) {
+		return nil
+	}
+	b.mu.Lock()
+	nc, js := b.nc, b.js
+	b.mu.Unlock()
+	if js == nil || !nc.IsConnected() {
+		return fmt.Errorf("store event in jetstream: %w", errNATSDisconnected)
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(b.opts.SubjectPrefix + "." + subjectToken(e.Type))
+	msg.Header.Set(originHeader, b.origin)
+	msg.Data = data
+
+	// Stored even when the publishing request is cancelled
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), b.opts.AckTimeout)
+	defer cancel()
+	start := time.Now()
+	_, err = js.PublishMsg(ctx, msg, jetstream.WithMsgID(e.ID))
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	natsPublishDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+	if err != nil {
+		return fmt.Errorf("store event in jetstream: %w", err)
+	}
+	return nil
+}
+
+// Subscribe implements Bus.
+func (b *NATSBus) Subscribe(h Handler) func() {
+	return b.local.Subscribe(h)
+}
+
+// Check reports whether JetStream answers, for readiness probes.
+func (b *NATSBus) Check(ctx context.Context) error {
+	b.mu.Lock()
+	js := b.js
+	b.mu.Unlock()
+	if js == nil {
+		return errNATSDisconnected
+	}
+	_, err := js.AccountInfo(ctx)
+	return err
+}
+
+// Shutdown stops consuming and drains the connection, so acknowledgements
+// in flight are sent, waiting until it is closed or ctx expires.
+func (b *NATSBus) Shutdown(ctx context.Context) error {
+	b.mu.Lock()
+	nc, consumed := b.nc, b.consumed
+	b.mu.Unlock()
+	if consumed != nil {
+		consumed.Stop()
+	}
+	if nc == nil {
+		return nil
+	}
+	closed := make(chan struct{})
+	nc.SetClosedHandler(func(*nats.Conn) { close(closed) })
+	if err := nc.Drain(); err != nil {
+		nc.Close()
+		return nil
+	}
+	select {
+	case <-closed:
+		return nil
+	case <-ctx.Done():
+		nc.Close()
+		return ctx.Err()
+	}
+}
+
+// ensureStream creates the stream unless it exists. An existing stream's
+// configuration is left alone, so operators can tune it.
+func (b *NATSBus) ensureStream(ctx context.Context) error {
+	_, err := b.js.Stream(ctx, b.opts.Stream)
+	if !errors.Is(err, jetstream.ErrStreamNotFound) {
+		return err
+	}
+	_, err = b.js.CreateStream(ctx, jetstream.StreamConfig{
+		Name:       b.opts.Stream,
+		Subjects:   []string{b.opts.SubjectPrefix + ".>"},
+		Retention:  jetstream.LimitsPolicy,
+		Storage:    jetstream.FileStorage,
+		MaxAge:     b.opts.MaxAge,
+		Replicas:   max(b.opts.Replicas, 1),
+		Duplicates: 2 * time.Minute,
+	})
+	if err == nil {
+		b.logger.Info("created jetstream stream", zap.String("stream", b.opts.Stream))
+	}
+	return err
+}
+
+// ensureConsumer creates or updates this instance's durable consumer. It
+// starts at new events and is removed once inactive for as long as events
+// are kept, since there is nothing left for it to resume.
+func (b *NATSBus) ensureConsumer(ctx context.Context) (jetstream.Consumer, error) {
+	cfg := jetstream.ConsumerConfig{
+		Durable:       b.consumer,
+		FilterSubject: b.opts.SubjectPrefix + ".>",
+		DeliverPolicy: jetstream.DeliverNewPolicy,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       30 * time.Second,
+	}
+	if b.opts.MaxAge > 0 {
+		cfg.InactiveThreshold = b.opts.MaxAge
+	}
+	return b.js.CreateOrUpdateConsumer(ctx, b.opts.Stream, cfg)
+}
+
+// deliver passes an event from the consumer to the local subscribers,
+// skipping this bus's own, and acknowledges it.
+func (b *NATSBus) deliver(m jetstream.Msg) {
+	if m.Headers().Get(originHeader) == b.origin {
+		m.Ack()
+		return
+	}
+	var e Event
+	if err := json.Unmarshal(m.Data(), &e); err != nil || e.Type == "" {
+		b.logger.Debug("ignoring invalid event from nats", zap.String("subject", m.Subject()))
+		m.Term()
+		return
+	}
+	b.local.Publish(WithRemote(context.Background()), e)
+	m.Ack()
+}
+
+// subjectToken makes an event type safe to use in a subject.
+func subjectToken(eventType string) string {
+	if eventType == "" {
+		return "unknown"
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n', '*', '>':
+			return '_'
+		}
+		return r
+	}, eventType)
+}
+
+// nameToken makes s safe to use as a JetStream consumer name.
+func nameToken(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n', '*', '>', '.', '/', '\\':
+			return '_'
+		}
+		return r
+	}, s)
+}
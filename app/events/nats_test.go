@@ -0,0 +1,168 @@
+package events
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.uber.org/zap"
+)
+
+// runNATS starts an in-process NATS server with JetStream on port (-1 for
+// any), keeping its store in dir.
+func runNATS(t *testing.T, port int, dir string) *server.Server {
+	t.Helper()
+	srv, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: port, JetStream: true, StoreDir: dir, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatalf("nats server: %v", err)
+	}
+	srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	t.Cleanup(srv.Shutdown)
+	return srv
+}
+
+// streamInfo reads the stream's state directly from the server.
+func streamInfo(t *testing.T, url string) *jetstream.StreamInfo {
+	t.Helper()
+	nc, err := nats.Connect(url)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer nc.Close()
+	js, _ := jetstream.New(nc)
+	s, err := js.Stream(t.Context(), "EVENTS")
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	return s.CachedInfo()
+}
+
+func receive(t *testing.T, ch <-chan Event) Event {
+	t.Helper()
+	select {
+	case e := <-ch:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("event not delivered")
+		return Event{}
+	}
+}
+
+func TestNATSBus(t *testing.T) {
+	srv := runNATS(t, -1, t.TempDir())
+	opts := NATSOptions{URL: srv.ClientURL(), Stream: "EVENTS", SubjectPrefix: "platform.events", MaxAge: time.Hour}
+	ctx := t.Context()
+	aOpts, bOpts := opts, opts
+	aOpts.Consumer, bOpts.Consumer = "platform-api.a", "platform-api.b"
+	a, err := NewNATSBus(ctx, aOpts, zap.NewNop())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer a.Shutdown(ctx)
+	b, err := NewNATSBus(ctx, bOpts, zap.NewNop())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info := streamInfo(t, srv.ClientURL()); info.Config.MaxAge != time.Hour || info.Config.Subjects[0] != "platform.events.>" {
+		t.Errorf("unexpected stream configuration %+v", info.Config)
+	}
+
+	local := make(chan bool, 10)
+	a.Subscribe(func(ctx context.Context, e Event) { local <- IsRemote(ctx) })
+	remote := make(chan Event, 10)
+	b.Subscribe(func(ctx context.Context, e Event) {
+		if !IsRemote(ctx) {
+			t.Errorf("expected a's event to be remote on b")
+		}
+		remote <- e
+	})
+
+	e, _ := New("tenant.created", "onboarding", map[string]string{"name": "team-a"})
+	if err := a.Publish(ctx, e); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := <-local; got {
+		t.Error("expected the local subscriber to be called with a local context")
+	}
+	if got := receive(t, remote); got.ID != e.ID {
+		t.Errorf("expected %s on b, got %+v", e.ID, got)
+	}
+
+	// Publishing again under the same ID is dropped as a duplicate
+	if err := a.Publish(ctx, e); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	<-local
+	if n := streamInfo(t, srv.ClientURL()).State.Msgs; n != 1 {
+		t.Errorf("expected 1 stored event, got %d", n)
+	}
+
+	// Events from elsewhere are only delivered locally
+	a.Publish(WithRemote(ctx), e)
+	if got := <-local; !got {
+		t.Error("expected the remote marker to be kept")
+	}
+
+	// a never receives its own events back
+	select {
+	case <-local:
+		t.Error("a received its own event")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// b's durable consumer resumes where it left off
+	b.Shutdown(ctx)
+	e2, _ := New("tenant.deleted", "onboarding", nil)
+	if err := a.Publish(ctx, e2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	<-local
+	b, err = NewNATSBus(ctx, bOpts, zap.NewNop())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer b.Shutdown(ctx)
+	resumed := make(chan Event, 10)
+	b.Subscribe(func(_ context.Context, e Event) { resumed <- e })
+	if got := receive(t, resumed); got.ID != e2.ID {
+		t.Errorf("expected %s after resuming, got %+v", e2.ID, got)
+	}
+}
+
+func TestNATSBusReconnects(t *testing.T) {
+	dir := t.TempDir()
+	srv := runNATS(t, -1, dir)
+	port := srv.Addr().(*net.TCPAddr).Port
+	ctx := t.Context()
+	bus, err := NewNATSBus(ctx, NATSOptions{URL: srv.ClientURL(), Stream: "EVENTS", SubjectPrefix: "platform.events", MaxAge: time.Hour}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer bus.Shutdown(ctx)
+
+	srv.Shutdown()
+	srv.WaitForShutdown()
+	e, _ := New("tenant.created", "onboarding", nil)
+	if err := bus.Publish(ctx, e); err == nil {
+		t.Error("expected an error while disconnected")
+	}
+
+	runNATS(t, port, dir)
+	deadline := time.Now().Add(10 * time.Second)
+	for bus.Check(ctx) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("did not reconnect")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err := bus.Publish(ctx, e); err != nil {
+		t.Errorf("expected publishing to work after reconnecting, got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package events
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+)
+
+const pollLimit = 100
+
+// pollResponse is the JSON body of the events endpoint.
+type pollResponse struct {
+	Events []Entry `json:"events"`
+	// Cursor is passed back as ?since= on the next request.
+	Cursor string `json:"cursor"`
+	// Truncated means events between since and the first returned event
+	// were evicted; the client should resynchronise its state.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// NewPollHandler serves GET /api/v1/events. Without ?wait= it returns events
+// after ?since= immediately. With ?wait=30s it holds the request open until
+// an event arrives or the wait elapses (long polling), for clients behind
+// proxies that break SSE or WebSockets. wait is capped at maxWait.
+func NewPollHandler(log *Log, maxWait time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		var cursor uint64
+		if s := q.Get("since"); s != "" {
+			c, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				http.Error(w, "invalid since cursor", http.StatusBadRequest)
+				return
+			}
+			cursor = c
+		}
+
+		var wait time.Duration
+		if s := q.Get("wait"); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil || d < 0 {
+				http.Error(w, "invalid wait duration", http.StatusBadRequest)
+				return
+			}
+			wait = min(d, maxWait)
+		}
+
+		var (
+			entries   []Entry
+			truncated bool
+		)
+		if wait > 0 {
+			// The server's WriteTimeout is shorter than a typical poll
+			rc := http.NewResponseController(w)
+			_ = rc.SetWriteDeadline(time.Now().Add(wait + 10*time.Second))
+
+			ctx, cancel := context.WithTimeout(r.Context(), wait)
+			defer cancel()
+			var err error
+			entries, truncated, err = log.Wait(ctx, cursor, pollLimit)
+			if err != nil {
+				// Client went away
+				return
+			}
+		} else {
+			entries, truncated = log.Since(cursor, pollLimit)
+		}
+
+		// Only the events returned advance the cursor; a cursor from before
+		// a restart is reset by the log once events exist
+		next := cursor
+		if len(entries) > 0 {
+			next = entries[len(entries)-1].Cursor
+		}
+		if entries == nil {
+			entries = []Entry{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		codec.Encode(w, pollResponse{
+			Events:    entries,
+			Cursor:    strconv.FormatUint(next, 10),
+			Truncated: truncated,
+		})
+	})
+}
@@ -0,0 +1,144 @@
+// Package featureflags holds the service's boolean feature flags. Defaults
+// come from configuration; a named ConfigMap, when configured, overrides them
+// live so operators can flip flags cluster-wide with kubectl edit.
+package featureflags
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+)
+
+var flagEnabled = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "feature_flag_enabled",
+	Help: "1 when a feature flag is enabled.",
+}, []string{"flag"})
+
+// Flags is safe for concurrent use.
+type Flags struct {
+	logger *zap.Logger
+
+	mu        sync.RWMutex
+	defaults  map[string]bool
+	overrides map[string]bool
+}
+
+// New creates flags from defaults ("true"/"false" etc., as accepted by
+// strconv.ParseBool). Unparseable values are logged and ignored.
+func New(defaults map[string]string, logger *zap.Logger) *Flags {
+	f := &Flags{logger: logger, defaults: parse(defaults, logger)}
+	f.export()
+	return f
+}
+
+// Enabled reports whether the named flag is on. Unknown flags are off.
+func (f *Flags) Enabled(name string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if v, ok := f.overrides[name]; ok {
+		return v
+	}
+	return f.defaults[name]
+}
+
+// All returns the effective value of every known flag.
+func (f *Flags) All() map[string]bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	out := maps.Clone(f.defaults)
+	if out == nil {
+		out = make(map[string]bool)
+	}
+	maps.Copy(out, f.overrides)
+	return out
+}
+
+// ServeHTTP lists the effective flags as JSON.
+func (f *Flags) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	codec.Encode(w, map[string]any{"flags": f.All()})
+}
+
+// WatchConfigMap overrides defaults with the data of namespace/name and
+// follows changes until ctx is cancelled. The informer watches only that one
+// ConfigMap. Deleting the ConfigMap reverts to defaults.
+func (f *Flags) WatchConfigMap(ctx context.Context, cs kubernetes.Interface, namespace, name string, resync time.Duration) error {
+	informer := coreinformers.NewFilteredConfigMapInformer(cs, namespace, resync, cache.Indexers{},
+		func(o *metav1.ListOptions) {
+			o.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		},
+	)
+
+	apply := func(obj any) {
+		if cm, ok := obj.(*corev1.ConfigMap); ok {
+			f.setOverrides(cm.Data)
+		}
+	}
+	if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    apply,
+		UpdateFunc: func(_, obj any) { apply(obj) },
+		DeleteFunc: func(any) { f.setOverrides(nil) },
+	}); err != nil {
+		return err
+	}
+
+	go informer.Run(ctx.Done())
+	f.logger.Info("watching feature flag configmap",
+		zap.String("namespace", namespace),
+		zap.String("name", name),
+	)
+	return nil
+}
+
+func (f *Flags) setOverrides(data map[string]string) {
+	overrides := parse(data, f.logger)
+
+	f.mu.Lock()
+	previous := f.overrides
+	f.overrides = overrides
+	f.mu.Unlock()
+
+	if !maps.Equal(previous, overrides) {
+		f.logger.Info("feature flags updated", zap.Any("overrides", overrides))
+	}
+	f.export()
+}
+
+func (f *Flags) export() {
+	flagEnabled.Reset()
+	for name, on := range f.All() {
+		v := 0.0
+		if on {
+			v = 1
+		}
+		flagEnabled.WithLabelValues(name).Set(v)
+	}
+}
+
+func parse(data map[string]string, logger *zap.Logger) map[string]bool {
+	out := make(map[string]bool, len(data))
+	for name, raw := range data {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			logger.Warn("ignoring invalid feature flag value", zap.String("flag", name), zap.String("value", raw))
+			continue
+		}
+		out[name] = v
+	}
+	return out
+}
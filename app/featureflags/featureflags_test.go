@@ -0,0 +1,60 @@
+package featureflags
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	f := New(map[string]string{"new-ui": "true", "beta": "nope"}, zap.NewNop())
+	if !f.Enabled("new-ui") {
+		t.Error("expected new-ui enabled")
+	}
+	if f.Enabled("beta") || f.Enabled("unknown") {
+		t.Error("expected invalid and unknown flags disabled")
+	}
+}
+
+func TestConfigMapOverridesLive(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "platform", Name: "flags"},
+		Data:       map[string]string{"new-ui": "false"},
+	}
+	cs := fake.NewClientset(cm)
+	f := New(map[string]string{"new-ui": "true"}, zap.NewNop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := f.WatchConfigMap(ctx, cs, "platform", "flags", 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitFor(t, func() bool { return !f.Enabled("new-ui") })
+
+	cm.Data = map[string]string{"new-ui": "true", "dark-mode": "true"}
+	if _, err := cs.CoreV1().ConfigMaps("platform").Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitFor(t, func() bool { return f.Enabled("dark-mode") && f.Enabled("new-ui") })
+
+	if err := cs.CoreV1().ConfigMaps("platform").Delete(ctx, "flags", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitFor(t, func() bool { return !f.Enabled("dark-mode") })
+}
@@ -0,0 +1,75 @@
+// Package graph serves the platform data model (tenants, services,
+// deployments) over GraphQL for portal teams. The schema is defined in
+// schema.graphql and resolved against the store.
+package graph
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+
+	"github.com/graph-gophers/graphql-go"
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+//go:embed schema.graphql
+var schema string
+
+// Limits bound the cost of a single query.
+type Limits struct {
+	MaxDepth       int
+	MaxQueryLength int
+	MaxParallelism int
+}
+
+// Handler executes GraphQL queries posted as JSON.
+type Handler struct {
+	schema *graphql.Schema
+	logger *zap.Logger
+}
+
+// NewHandler parses the schema and binds it to st.
+func NewHandler(st *store.Store, limits Limits, logger *zap.Logger) (*Handler, error) {
+	s, err := graphql.ParseSchema(schema, &resolver{store: st},
+		graphql.MaxDepth(limits.MaxDepth),
+		graphql.MaxQueryLength(limits.MaxQueryLength),
+		graphql.MaxParallelism(limits.MaxParallelism),
+		graphql.Tracer(metricsTracer{logger: logger}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{schema: s, logger: logger}, nil
+}
+
+type request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// ServeHTTP handles POST /graphql.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req request
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		codec.Encode(w, map[string]string{"error": "invalid request body"})
+		return
+	}
+
+	resp := h.schema.Exec(r.Context(), req.Query, req.OperationName, req.Variables)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	codec.Encode(w, resp)
+}
@@ -0,0 +1,77 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+func testHandler(t *testing.T) *Handler {
+	t.Helper()
+	st := store.NewMemory()
+	ctx := context.Background()
+
+	tenant := &store.Tenant{Name: "payments", DisplayName: "Payments", Owner: "team-payments"}
+	st.Tenants.Create(ctx, tenant)
+	svc := &store.Service{TenantID: tenant.ID, Name: "ledger", Owner: "team-payments"}
+	st.Services.Create(ctx, svc)
+	st.Deployments.Create(ctx, &store.Deployment{ServiceID: svc.ID, Environment: "prod", Version: "1.2.0", Replicas: 3})
+
+	h, err := NewHandler(st, Limits{MaxDepth: 4, MaxQueryLength: 2000, MaxParallelism: 10}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+	return h
+}
+
+func exec(t *testing.T, h *Handler, query string) map[string]any {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"query": query})
+	req := httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var resp map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return resp
+}
+
+func TestQueryTenants(t *testing.T) {
+	h := testHandler(t)
+
+	resp := exec(t, h, `{ tenants { name services { name deployments { version replicas } } } }`)
+	if resp["errors"] != nil {
+		t.Fatalf("unexpected errors: %v", resp["errors"])
+	}
+
+	tenants := resp["data"].(map[string]any)["tenants"].([]any)
+	if len(tenants) != 1 {
+		t.Fatalf("expected 1 tenant, got %d", len(tenants))
+	}
+	services := tenants[0].(map[string]any)["services"].([]any)
+	deployments := services[0].(map[string]any)["deployments"].([]any)
+	if v := deployments[0].(map[string]any)["version"]; v != "1.2.0" {
+		t.Errorf("expected version '1.2.0', got '%v'", v)
+	}
+}
+
+func TestQueryDepthLimit(t *testing.T) {
+	h := testHandler(t)
+
+	resp := exec(t, h, `{ tenants { services { tenant { services { name } } } } }`)
+	if resp["errors"] == nil {
+		t.Error("expected depth limit error")
+	}
+}
@@ -0,0 +1,134 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+// resolver is the root Query resolver.
+type resolver struct {
+	store *store.Store
+}
+
+func (r *resolver) Tenants(ctx context.Context) ([]*tenantResolver, error) {
+	tenants, err := r.store.Tenants.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*tenantResolver, len(tenants))
+	for i := range tenants {
+		out[i] = &tenantResolver{t: tenants[i], store: r.store}
+	}
+	return out, nil
+}
+
+func (r *resolver) Tenant(ctx context.Context, args struct{ ID graphql.ID }) (*tenantResolver, error) {
+	t, err := r.store.Tenants.Get(ctx, string(args.ID))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tenantResolver{t: *t, store: r.store}, nil
+}
+
+func (r *resolver) Services(ctx context.Context, args struct{ TenantID *graphql.ID }) ([]*serviceResolver, error) {
+	tenantID := ""
+	if args.TenantID != nil {
+		tenantID = string(*args.TenantID)
+	}
+	return listServices(ctx, r.store, tenantID)
+}
+
+func (r *resolver) Service(ctx context.Context, args struct{ ID graphql.ID }) (*serviceResolver, error) {
+	s, err := r.store.Services.Get(ctx, string(args.ID))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &serviceResolver{s: *s, store: r.store}, nil
+}
+
+func listServices(ctx context.Context, st *store.Store, tenantID string) ([]*serviceResolver, error) {
+	services, err := st.Services.List(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*serviceResolver, len(services))
+	for i := range services {
+		out[i] = &serviceResolver{s: services[i], store: st}
+	}
+	return out, nil
+}
+
+type tenantResolver struct {
+	t     store.Tenant
+	store *store.Store
+}
+
+func (t *tenantResolver) ID() graphql.ID      { return graphql.ID(t.t.ID) }
+func (t *tenantResolver) Name() string        { return t.t.Name }
+func (t *tenantResolver) DisplayName() string { return t.t.DisplayName }
+func (t *tenantResolver) Owner() string       { return t.t.Owner }
+func (t *tenantResolver) CreatedAt() string   { return t.t.CreatedAt.Format(time.RFC3339) }
+
+func (t *tenantResolver) Services(ctx context.Context) ([]*serviceResolver, error) {
+	return listServices(ctx, t.store, t.t.ID)
+}
+
+type serviceResolver struct {
+	s     store.Service
+	store *store.Store
+}
+
+func (s *serviceResolver) ID() graphql.ID      { return graphql.ID(s.s.ID) }
+func (s *serviceResolver) Name() string        { return s.s.Name }
+func (s *serviceResolver) Description() string { return s.s.Description }
+func (s *serviceResolver) Owner() string       { return s.s.Owner }
+func (s *serviceResolver) Repository() string  { return s.s.Repository }
+
+func (s *serviceResolver) Tenant(ctx context.Context) (*tenantResolver, error) {
+	t, err := s.store.Tenants.Get(ctx, s.s.TenantID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tenantResolver{t: *t, store: s.store}, nil
+}
+
+func (s *serviceResolver) Deployments(ctx context.Context, args struct{ Environment *string }) ([]*deploymentResolver, error) {
+	deployments, err := s.store.Deployments.List(ctx, s.s.ID)
+	if err != nil {
+		return nil, err
+	}
+	var out []*deploymentResolver
+	for _, d := range deployments {
+		if args.Environment != nil && d.Environment != *args.Environment {
+			continue
+		}
+		out = append(out, &deploymentResolver{d: d})
+	}
+	return out, nil
+}
+
+type deploymentResolver struct {
+	d store.Deployment
+}
+
+func (d *deploymentResolver) ID() graphql.ID      { return graphql.ID(d.d.ID) }
+func (d *deploymentResolver) Environment() string { return d.d.Environment }
+func (d *deploymentResolver) Version() string     { return d.d.Version }
+func (d *deploymentResolver) Image() string       { return d.d.Image }
+func (d *deploymentResolver) Replicas() int32     { return int32(d.d.Replicas) }
+func (d *deploymentResolver) Status() string      { return d.d.Status }
+func (d *deploymentResolver) DeployedAt() string  { return d.d.DeployedAt.Format(time.RFC3339) }
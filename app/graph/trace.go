@@ -0,0 +1,65 @@
+package graph
+
+import (
+	"context"
+	"time"
+
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/graph-gophers/graphql-go/introspection"
+	"github.com/graph-gophers/graphql-go/trace/tracer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+)
+
+var (
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "graphql_query_duration_seconds",
+		Help:    "GraphQL query execution time by operation name.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation"})
+	fieldErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "graphql_field_errors_total",
+		Help: "GraphQL resolver errors by type and field.",
+	}, []string{"type", "field"})
+)
+
+// metricsTracer records query latency and resolver errors, and logs failed
+// queries with the request ID so they can be correlated with access logs.
+type metricsTracer struct {
+	logger *zap.Logger
+}
+
+var _ tracer.Tracer = metricsTracer{}
+
+func (t metricsTracer) TraceQuery(ctx context.Context, query, operation string, _ map[string]any, _ map[string]*introspection.Type) (context.Context, tracer.QueryFinishFunc) {
+	start := time.Now()
+	return ctx, func(errs []*gqlerrors.QueryError) {
+		op := operation
+		if op == "" {
+			op = "anonymous"
+		}
+		queryDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+		if len(errs) > 0 {
+			t.logger.Warn("graphql query failed",
+				zap.String("request_id", middleware.GetRequestID(ctx)),
+				zap.String("operation", op),
+				zap.Int("errors", len(errs)),
+				zap.String("first_error", errs[0].Message),
+			)
+		}
+	}
+}
+
+func (t metricsTracer) TraceField(ctx context.Context, _, typeName, fieldName string, trivial bool, _ map[string]any) (context.Context, tracer.FieldFinishFunc) {
+	if trivial {
+		return ctx, func(*gqlerrors.QueryError) {}
+	}
+	return ctx, func(err *gqlerrors.QueryError) {
+		if err != nil {
+			fieldErrors.WithLabelValues(typeName, fieldName).Inc()
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+)
+
+// maxPooledBuffer keeps the odd large response from pinning its buffer in
+// the pool.
+const maxPooledBuffer = 64 << 10
+
+// encodeFailure is the body of a response that failed to encode.
+var encodeFailure = []byte(`{"error":"failed to encode response"}` + "\n")
+
+// encoder is a buffer with an encoder of the codec in use writing into it,
+// reused across requests so that the probes and /api/v1/info allocate next
+// to nothing.
+type encoder struct {
+	buf   bytes.Buffer
+	codec codec.Codec
+	enc   codec.Encoder
+}
+
+var encoders = sync.Pool{New: func() any { return &encoder{} }}
+
+func getEncoder() *encoder {
+	e := encoders.Get().(*encoder)
+	if c := codec.Default(); e.codec != c {
+		e.codec, e.enc = c, c.NewEncoder(&e.buf)
+	}
+	return e
+}
+
+func putEncoder(e *encoder) {
+	if e.buf.Cap() > maxPooledBuffer {
+		return
+	}
+	e.buf.Reset()
+	encoders.Put(e)
+}
+
+// writeJSON writes v as the JSON body of a response with status. It is
+// encoded into a pooled buffer first, so the response has a
+// Content-Length and a value that fails to encode is a 500, not a
+// truncated body.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	e := getEncoder()
+	defer putEncoder(e)
+	if err := e.enc.Encode(v); err != nil {
+		writeBody(w, http.StatusInternalServerError, encodeFailure)
+		return
+	}
+	writeBody(w, status, e.buf.Bytes())
+}
+
+func writeBody(w http.ResponseWriter, status int, body []byte) {
+	h := w.Header()
+	h.Set("Content-Type", "application/json")
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	w.Write(body)
+}
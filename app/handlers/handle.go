@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+)
+
+// NoContent is the response type of endpoints that answer 204 with no
+// body.
+type NoContent struct{}
+
+// Validator is implemented by request types that check themselves after
+// decoding.
+type Validator interface {
+	Validate() error
+}
+
+// Option tunes an endpoint built by Handle.
+type Option func(*endpoint)
+
+// WithStatus sets the status of successful responses (default 200).
+func WithStatus(status int) Option {
+	return func(e *endpoint) { e.status = status }
+}
+
+// WithMaxBodyBytes bounds the request body (default 64 KiB).
+func WithMaxBodyBytes(n int64) Option {
+	return func(e *endpoint) { e.maxBody = n }
+}
+
+type endpoint struct {
+	status  int
+	maxBody int64
+}
+
+// Handle adapts fn, an endpoint written against typed values, to an
+// http.Handler that does the rest the same way for every endpoint:
+//
+//   - It decodes a Req from the request: the JSON body, if there is one,
+//     then the struct fields tagged path:"name", query:"name" or
+//     header:"Name" from the path values, query and headers. Tagged fields
+//     may be strings, string slices (repeated parameters), bools, numbers
+//     or durations. A body or value that does not decode is a 400.
+//   - If Req implements Validator, a validation error is a 400 with its
+//     message.
+//   - An error from fn gets the status of its errs kind and its message.
+//     Other errors are logged and answered with a bare 500, so internals
+//     do not leak. A request canceled by the client is not answered.
+//   - Resp is encoded as JSON with status 200 (or WithStatus), or as an
+//     empty 204 if Resp is NoContent.
+//
+// Authorization stays in middleware wrapping the handler; fn sees what it
+// needs through its context.
+func Handle[Req, Resp any](logger *zap.Logger, fn func(context.Context, Req) (Resp, error), opts ...Option) http.Handler {
+	e := endpoint{status: http.StatusOK, maxBody: 64 << 10}
+	for _, opt := range opts {
+		opt(&e)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Req
+		if err := decode(w, r, &req, e.maxBody); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if v, ok := any(&req).(Validator); ok {
+			if err := v.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		resp, err := fn(r.Context(), req)
+		if err != nil {
+			fail(w, r, logger, err)
+			return
+		}
+		if _, ok := any(resp).(NoContent); ok {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, e.status, resp)
+	})
+}
+
+// fail answers err by its kind.
+func fail(w http.ResponseWriter, r *http.Request, logger *zap.Logger, err error) {
+	if errors.Is(err, context.Canceled) && r.Context().Err() != nil {
+		return
+	}
+	status := errs.HTTPStatus(err)
+	if status == http.StatusInternalServerError {
+		logger.Error("request failed", zap.String("method", r.Method), zap.String("path", r.URL.Path), zap.Error(err))
+		http.Error(w, "internal error", status)
+		return
+	}
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "1")
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// decode fills req from r's body, path values, query and headers.
+func decode(w http.ResponseWriter, r *http.Request, req any, maxBody int64) error {
+	if r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0 {
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBody)).Decode(req)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return errors.New("invalid request body")
+		}
+	}
+	v := reflect.ValueOf(req).Elem()
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	for _, f := range fieldsOf(v.Type()) {
+		var values []string
+		switch f.source {
+		case "path":
+			if s := r.PathValue(f.name); s != "" {
+				values = []string{s}
+			}
+		case "query":
+			values = r.URL.Query()[f.name]
+		case "header":
+			values = r.Header.Values(f.name)
+		}
+		if len(values) == 0 {
+			continue
+		}
+		if err := set(v.FieldByIndex(f.index), values); err != nil {
+			return fmt.Errorf("invalid %s", f.name)
+		}
+	}
+	return nil
+}
+
+// field is a struct field filled from the request outside the body.
+type field struct {
+	index  []int
+	source string
+	name   string
+}
+
+var fieldCache sync.Map // reflect.Type -> []field
+
+func fieldsOf(t reflect.Type) []field {
+	if fs, ok := fieldCache.Load(t); ok {
+		return fs.([]field)
+	}
+	var fs []field
+	for _, sf := range reflect.VisibleFields(t) {
+		if !sf.IsExported() {
+			continue
+		}
+		for _, source := range []string{"path", "query", "header"} {
+			if name, ok := sf.Tag.Lookup(source); ok {
+				fs = append(fs, field{index: sf.Index, source: source, name: name})
+				break
+			}
+		}
+	}
+	fieldCache.Store(t, fs)
+	return fs
+}
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+// set parses values into f.
+func set(f reflect.Value, values []string) error {
+	s := values[len(values)-1]
+	switch {
+	case f.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+		return nil
+	case f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.String:
+		f.Set(reflect.ValueOf(append([]string(nil), values...)).Convert(f.Type()))
+		return nil
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", f.Type())
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+)
+
+type scaleRequest struct {
+	Namespace string        `path:"namespace"`
+	Name      string        `path:"name"`
+	DryRun    bool          `query:"dry_run"`
+	Timeout   time.Duration `query:"timeout"`
+	Fields    []string      `query:"field"`
+	User      string        `header:"X-Forwarded-User"`
+	Replicas  int           `json:"replicas"`
+}
+
+func (req *scaleRequest) Validate() error {
+	if req.Replicas < 0 {
+		return errors.New("replicas must not be negative")
+	}
+	return nil
+}
+
+type scaleResponse struct {
+	Request scaleRequest `json:"request"`
+}
+
+func TestHandle(t *testing.T) {
+	var scaled scaleRequest
+	mux := http.NewServeMux()
+	mux.Handle("PUT /namespaces/{namespace}/deployments/{name}/scale", Handle(zap.NewNop(), func(ctx context.Context, req scaleRequest) (scaleResponse, error) {
+		switch req.Name {
+		case "missing":
+			return scaleResponse{}, errs.New(errs.NotFound, "deployment not found")
+		case "locked":
+			return scaleResponse{}, errs.Errorf(errs.Conflict, "deployment %s is locked by a rollout", req.Name)
+		case "broken":
+			return scaleResponse{}, errors.New("dial tcp 10.0.0.1:6443: connection refused")
+		}
+		scaled = req
+		return scaleResponse{Request: req}, nil
+	}, WithStatus(http.StatusAccepted)))
+	do := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, path, strings.NewReader(body))
+		req.Header.Set("X-Forwarded-User", "alice")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("/namespaces/payments/deployments/api/scale?dry_run=true&timeout=30s&field=a&field=b", `{"replicas":3}`)
+	if rec.Code != http.StatusAccepted || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("expected 202 with JSON, got %d: %s", rec.Code, rec.Body)
+	}
+	want := scaleRequest{Namespace: "payments", Name: "api", DryRun: true, Timeout: 30 * time.Second,
+		Fields: []string{"a", "b"}, User: "alice", Replicas: 3}
+	if scaled.Namespace != want.Namespace || scaled.Name != want.Name || !scaled.DryRun || scaled.Timeout != want.Timeout ||
+		len(scaled.Fields) != 2 || scaled.User != want.User || scaled.Replicas != want.Replicas {
+		t.Errorf("expected %+v decoded, got %+v", want, scaled)
+	}
+	var resp scaleResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.Request.Replicas != 3 {
+		t.Errorf("expected the response encoded, got %+v %v", resp, err)
+	}
+
+	tests := []struct {
+		name, path, body string
+		status           int
+		message          string
+	}{
+		{"bad body", "/namespaces/payments/deployments/api/scale", `{"replicas":`, http.StatusBadRequest, "invalid request body"},
+		{"bad query", "/namespaces/payments/deployments/api/scale?timeout=soon", `{}`, http.StatusBadRequest, "invalid timeout"},
+		{"invalid", "/namespaces/payments/deployments/api/scale", `{"replicas":-1}`, http.StatusBadRequest, "replicas must not be negative"},
+		{"not found", "/namespaces/payments/deployments/missing/scale", `{}`, http.StatusNotFound, "deployment not found"},
+		{"conflict", "/namespaces/payments/deployments/locked/scale", `{}`, http.StatusConflict, "deployment locked is locked by a rollout"},
+		{"unclassified", "/namespaces/payments/deployments/broken/scale", `{}`, http.StatusInternalServerError, "internal error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(tt.path, tt.body)
+			if rec.Code != tt.status || strings.TrimSpace(rec.Body.String()) != tt.message {
+				t.Errorf("expected %d %q, got %d %q", tt.status, tt.message, rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestHandleNoContent(t *testing.T) {
+	h := Handle(zap.NewNop(), func(ctx context.Context, _ struct{}) (NoContent, error) {
+		return NoContent{}, nil
+	})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/v1/things/1", nil))
+	if rec.Code != http.StatusNoContent || rec.Body.Len() != 0 {
+		t.Errorf("expected an empty 204, got %d %q", rec.Code, rec.Body)
+	}
+
+	h = Handle(zap.NewNop(), func(ctx context.Context, _ struct{}) (NoContent, error) {
+		return NoContent{}, errs.New(errs.Unavailable, "work pool saturated")
+	})
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/v1/things/1", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 503 with Retry-After, got %d %v", rec.Code, rec.Header())
+	}
+}
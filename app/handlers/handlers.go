@@ -2,24 +2,45 @@
 package handlers
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
+	"math"
 	"net/http"
 	"runtime"
+	"runtime/debug"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/cgroup"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
 	"github.com/virenpatel/k8s-platform-engineering-lab/app/config"
 
 	"go.uber.org/zap"
 )
 
+// readinessCheckTimeout bounds each dependency check during a probe.
+const readinessCheckTimeout = 2 * time.Second
+
+// ReadinessCheck reports whether a dependency is usable. A non-nil error
+// marks the service not ready.
+type ReadinessCheck func(ctx context.Context) error
+
+type namedCheck struct {
+	name string
+	fn   ReadinessCheck
+}
+
 // HealthHandler manages Kubernetes health and readiness probes.
 type HealthHandler struct {
 	logger    *zap.Logger
 	cfg       *config.Config
 	ready     atomic.Bool
 	startTime time.Time
+
+	mu     sync.RWMutex
+	checks []namedCheck
 }
 
 // NewHealthHandler creates a new health handler, marking the service as ready.
@@ -39,23 +60,34 @@ func (h *HealthHandler) SetNotReady() {
 	h.logger.Info("service marked as not ready")
 }
 
+// AddReadinessCheck registers a dependency check run on every /readyz probe.
+func (h *HealthHandler) AddReadinessCheck(name string, fn ReadinessCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, namedCheck{name: name, fn: fn})
+}
+
 // livenessResponse is the JSON response for the liveness probe.
 type livenessResponse struct {
 	Status    string `json:"status"`
 	Timestamp string `json:"timestamp"`
 }
 
+// livenessPrefix is the liveness response up to its timestamp, which is
+// all that changes between probes.
+var livenessPrefix = []byte(`{"status":"alive","timestamp":"`)
+
 // Liveness handles the /healthz endpoint.
 // Kubernetes uses this to determine if the container needs to be restarted.
+// The body is the JSON encoding of a livenessResponse, assembled from
+// livenessPrefix and the time, without reflection.
 func (h *HealthHandler) Liveness(w http.ResponseWriter, r *http.Request) {
-	resp := livenessResponse{
-		Status:    "alive",
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(resp)
+	e := getEncoder()
+	defer putEncoder(e)
+	e.buf.Write(livenessPrefix)
+	e.buf.Write(time.Now().UTC().AppendFormat(e.buf.AvailableBuffer(), time.RFC3339))
+	e.buf.WriteString("\"}\n")
+	writeBody(w, http.StatusOK, e.buf.Bytes())
 }
 
 // readinessResponse is the JSON response for the readiness probe.
@@ -69,12 +101,31 @@ type readinessResponse struct {
 type check struct {
 	Name   string `json:"name"`
 	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
 }
 
 // Readiness handles the /readyz endpoint.
 // Kubernetes uses this to determine if the pod should receive traffic.
 func (h *HealthHandler) Readiness(w http.ResponseWriter, r *http.Request) {
 	isReady := h.ready.Load()
+	checks := []check{{Name: "server", Status: boolToStatus(isReady)}}
+
+	h.mu.RLock()
+	registered := h.checks
+	h.mu.RUnlock()
+	for _, c := range registered {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessCheckTimeout)
+		err := c.fn(ctx)
+		cancel()
+
+		result := check{Name: c.name, Status: boolToStatus(err == nil)}
+		if err != nil {
+			isReady = false
+			result.Error = err.Error()
+			h.logger.Warn("readiness check failed", zap.String("check", c.name), zap.Error(err))
+		}
+		checks = append(checks, result)
+	}
 
 	status := "ready"
 	httpStatus := http.StatusOK
@@ -87,14 +138,10 @@ func (h *HealthHandler) Readiness(w http.ResponseWriter, r *http.Request) {
 		Status:    status,
 		Uptime:    time.Since(h.startTime).Round(time.Second).String(),
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
-		Checks: []check{
-			{Name: "server", Status: boolToStatus(isReady)},
-		},
+		Checks:    checks,
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(httpStatus)
-	json.NewEncoder(w).Encode(resp)
+	writeJSON(w, httpStatus, resp)
 }
 
 func boolToStatus(b bool) string {
@@ -111,41 +158,94 @@ type APIHandler struct {
 	logger    *zap.Logger
 	cfg       *config.Config
 	startTime time.Time
+
+	// info is the /api/v1/info response without its pod and closing
+	// brace: everything but the pod labels is fixed at startup. Without
+	// a labels file nothing changes, and infoBody is the whole response.
+	info     []byte
+	infoBody []byte
+	status   http.Handler
+
+	// Limits are the container limits the runtime was sized to, shown by
+	// Status; nil when not derived.
+	Limits *cgroup.Limits
+	// Degraded lists the optional dependencies that are down, shown by
+	// Status; nil when none are tracked.
+	Degraded func() []string
 }
 
 // NewAPIHandler creates a new API handler.
 func NewAPIHandler(logger *zap.Logger, cfg *config.Config) *APIHandler {
-	return &APIHandler{
+	info, _ := codec.Default().Marshal(infoResponse{
+		Service:     cfg.ServiceName,
+		Version:     cfg.Version,
+		Environment: cfg.Environment,
+		GoVersion:   runtime.Version(),
+		OS:          runtime.GOOS,
+		Arch:        runtime.GOARCH,
+	})
+	a := &APIHandler{
 		logger:    logger,
 		cfg:       cfg,
 		startTime: time.Now(),
+		info:      info[:len(info)-1],
+	}
+	a.status = Handle(logger, a.runtimeStatus)
+	if cfg.PodLabelsFile == "" {
+		e := getEncoder()
+		if a.encodeInfo(e, nil) == nil {
+			a.infoBody = bytes.Clone(e.buf.Bytes())
+		}
+		putEncoder(e)
 	}
+	return a
 }
 
 // infoResponse is the response for the /api/v1/info endpoint.
 type infoResponse struct {
-	Service     string `json:"service"`
-	Version     string `json:"version"`
-	Environment string `json:"environment"`
-	GoVersion   string `json:"go_version"`
-	OS          string `json:"os"`
-	Arch        string `json:"arch"`
+	Service     string   `json:"service"`
+	Version     string   `json:"version"`
+	Environment string   `json:"environment"`
+	GoVersion   string   `json:"go_version"`
+	OS          string   `json:"os"`
+	Arch        string   `json:"arch"`
+	Pod         *podInfo `json:"pod,omitempty"`
 }
 
-// Info returns service metadata.
+// Info returns service metadata, the JSON encoding of an infoResponse.
 func (a *APIHandler) Info(w http.ResponseWriter, r *http.Request) {
-	resp := infoResponse{
-		Service:     a.cfg.ServiceName,
-		Version:     a.cfg.Version,
-		Environment: a.cfg.Environment,
-		GoVersion:   runtime.Version(),
-		OS:          runtime.GOOS,
-		Arch:        runtime.GOARCH,
+	if a.infoBody != nil {
+		writeBody(w, http.StatusOK, a.infoBody)
+		return
+	}
+	e := getEncoder()
+	defer putEncoder(e)
+	if err := a.encodeInfo(e, readPodLabels(a.cfg.PodLabelsFile)); err != nil {
+		writeBody(w, http.StatusInternalServerError, encodeFailure)
+		return
 	}
+	writeBody(w, http.StatusOK, e.buf.Bytes())
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(resp)
+// encodeInfo writes the info response with the pod labels into e.
+func (a *APIHandler) encodeInfo(e *encoder, labels map[string]string) error {
+	e.buf.Write(a.info)
+	pod := &podInfo{
+		Name:           a.cfg.PodName,
+		Namespace:      a.cfg.PodNamespace,
+		Node:           a.cfg.NodeName,
+		ServiceAccount: a.cfg.PodServiceAccount,
+		Labels:         labels,
+	}
+	if !pod.empty() {
+		e.buf.WriteString(`,"pod":`)
+		if err := e.enc.Encode(pod); err != nil {
+			return err
+		}
+		e.buf.Truncate(e.buf.Len() - 1)
+	}
+	e.buf.WriteString("}\n")
+	return nil
 }
 
 // statusResponse is the response for the /api/v1/status endpoint.
@@ -155,10 +255,20 @@ type statusResponse struct {
 	Goroutines  int    `json:"goroutines"`
 	MemoryAlloc string `json:"memory_alloc_mb"`
 	Timestamp   string `json:"timestamp"`
+
+	GOMAXPROCS int            `json:"gomaxprocs"`
+	GOMEMLIMIT string         `json:"gomemlimit_mb,omitempty"`
+	Limits     *cgroup.Limits `json:"limits,omitempty"`
+
+	Degraded []string `json:"degraded,omitempty"`
 }
 
 // Status returns runtime status of the service.
 func (a *APIHandler) Status(w http.ResponseWriter, r *http.Request) {
+	a.status.ServeHTTP(w, r)
+}
+
+func (a *APIHandler) runtimeStatus(context.Context, struct{}) (statusResponse, error) {
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
 
@@ -168,16 +278,23 @@ func (a *APIHandler) Status(w http.ResponseWriter, r *http.Request) {
 		Goroutines:  runtime.NumGoroutine(),
 		MemoryAlloc: formatBytes(memStats.Alloc),
 		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		GOMAXPROCS:  runtime.GOMAXPROCS(0),
+		Limits:      a.Limits,
+	}
+	if a.Degraded != nil {
+		if resp.Degraded = a.Degraded(); len(resp.Degraded) > 0 {
+			resp.Status = "degraded"
+		}
+	}
+	if limit := debug.SetMemoryLimit(-1); limit != math.MaxInt64 {
+		resp.GOMEMLIMIT = formatBytes(uint64(limit))
 	}
 
 	a.logger.Debug("status check",
 		zap.Int("goroutines", resp.Goroutines),
 		zap.String("memory", resp.MemoryAlloc),
 	)
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(resp)
+	return resp, nil
 }
 
 func formatBytes(b uint64) string {
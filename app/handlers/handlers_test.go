@@ -1,9 +1,16 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"testing"
 
 	"github.com/virenpatel/k8s-platform-engineering-lab/app/config"
@@ -78,6 +85,30 @@ func TestReadiness(t *testing.T) {
 	}
 }
 
+func TestReadinessChecks(t *testing.T) {
+	handler := NewHealthHandler(testLogger(), testConfig())
+	handler.AddReadinessCheck("database", func(context.Context) error {
+		return errors.New("connection refused")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+	rec := httptest.NewRecorder()
+
+	handler.Readiness(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", rec.Code)
+	}
+
+	var resp readinessResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Checks) != 2 || resp.Checks[1].Status != "fail" {
+		t.Errorf("expected failing database check, got %+v", resp.Checks)
+	}
+}
+
 func TestInfo(t *testing.T) {
 	handler := NewAPIHandler(testLogger(), testConfig())
 
@@ -102,6 +133,88 @@ func TestInfo(t *testing.T) {
 	}
 }
 
+func TestInfoPodMetadata(t *testing.T) {
+	labelsFile := filepath.Join(t.TempDir(), "labels")
+	os.WriteFile(labelsFile, []byte("app=\"platform-api\"\npod-template-hash=\"7d9f\"\n"), 0o644)
+
+	cfg := testConfig()
+	cfg.PodName = "platform-api-7d9f-x2k4p"
+	cfg.PodNamespace = "platform"
+	cfg.NodeName = "node-1"
+	cfg.PodLabelsFile = labelsFile
+	handler := NewAPIHandler(testLogger(), cfg)
+
+	rec := httptest.NewRecorder()
+	handler.Info(rec, httptest.NewRequest(http.MethodGet, "/api/v1/info", nil))
+
+	var resp infoResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Pod == nil {
+		t.Fatal("expected pod metadata")
+	}
+	if resp.Pod.Name != cfg.PodName || resp.Pod.Node != "node-1" {
+		t.Errorf("expected pod %s on node-1, got %+v", cfg.PodName, resp.Pod)
+	}
+	if resp.Pod.Labels["app"] != "platform-api" {
+		t.Errorf("expected label app=platform-api, got %v", resp.Pod.Labels)
+	}
+}
+
+// The assembled responses must stay byte for byte what encoding/json
+// produces for their types.
+func TestPrecomputedResponses(t *testing.T) {
+	cfg := testConfig()
+	cfg.ServiceName = `api "<beta>"`
+	cfg.PodName = "platform-api-7d9f-x2k4p"
+	handler := NewAPIHandler(testLogger(), cfg)
+
+	rec := httptest.NewRecorder()
+	handler.Info(rec, httptest.NewRequest(http.MethodGet, "/api/v1/info", nil))
+	var want bytes.Buffer
+	json.NewEncoder(&want).Encode(infoResponse{
+		Service:     cfg.ServiceName,
+		Version:     cfg.Version,
+		Environment: cfg.Environment,
+		GoVersion:   runtime.Version(),
+		OS:          runtime.GOOS,
+		Arch:        runtime.GOARCH,
+		Pod:         &podInfo{Name: cfg.PodName},
+	})
+	if rec.Body.String() != want.String() || rec.Header().Get("Content-Length") != strconv.Itoa(want.Len()) {
+		t.Errorf("info = %q, want %q", rec.Body, want.String())
+	}
+
+	rec = httptest.NewRecorder()
+	NewHealthHandler(testLogger(), cfg).Liveness(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	var resp livenessResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	want.Reset()
+	json.NewEncoder(&want).Encode(resp)
+	if rec.Body.String() != want.String() || resp.Timestamp == "" {
+		t.Errorf("liveness = %q, want %q", rec.Body, want.String())
+	}
+}
+
+func BenchmarkLiveness(b *testing.B) {
+	handler := NewHealthHandler(zap.NewNop(), testConfig())
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	b.ReportAllocs()
+	for b.Loop() {
+		handler.Liveness(httptest.NewRecorder(), req)
+	}
+}
+
+func BenchmarkInfo(b *testing.B) {
+	handler := NewAPIHandler(zap.NewNop(), testConfig())
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/info", nil)
+	b.ReportAllocs()
+	for b.Loop() {
+		handler.Info(httptest.NewRecorder(), req)
+	}
+}
+
 func TestStatus(t *testing.T) {
 	handler := NewAPIHandler(testLogger(), testConfig())
 
@@ -123,6 +236,22 @@ func TestStatus(t *testing.T) {
 	}
 }
 
+func TestStatusDegraded(t *testing.T) {
+	handler := NewAPIHandler(testLogger(), testConfig())
+	handler.Degraded = func() []string { return []string{"objectstore"} }
+
+	rec := httptest.NewRecorder()
+	handler.Status(rec, httptest.NewRequest(http.MethodGet, "/api/v1/status", nil))
+
+	var resp statusResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Status != "degraded" || len(resp.Degraded) != 1 || resp.Degraded[0] != "objectstore" {
+		t.Errorf("expected degraded objectstore, got %q %v", resp.Status, resp.Degraded)
+	}
+}
+
 func TestFormatBytes(t *testing.T) {
 	tests := []struct {
 		input    uint64
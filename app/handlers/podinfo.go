@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// podInfo identifies the replica that answered a request. Values come from
+// the Kubernetes Downward API: env vars for name, namespace, node, and
+// service account, and a downwardAPI volume file for labels.
+type podInfo struct {
+	Name           string            `json:"name,omitempty"`
+	Namespace      string            `json:"namespace,omitempty"`
+	Node           string            `json:"node,omitempty"`
+	ServiceAccount string            `json:"service_account,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+}
+
+// empty reports whether no metadata was found, i.e. not running in a pod.
+func (p *podInfo) empty() bool {
+	return p.Name == "" && p.Namespace == "" && p.Node == "" && p.ServiceAccount == "" && len(p.Labels) == 0
+}
+
+// readPodLabels parses a Downward API labels file (key="value" per line).
+// The kubelet rewrites the file when labels change, so it is read per call.
+func readPodLabels(path string) map[string]string {
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	labels := make(map[string]string)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		key, quoted, ok := strings.Cut(strings.TrimSpace(sc.Text()), "=")
+		if !ok {
+			continue
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			value = quoted
+		}
+		labels[key] = value
+	}
+	return labels
+}
@@ -0,0 +1,195 @@
+// Package helmreleases lists Helm releases across namespaces with their
+// chart, version and a digest of the user-supplied values, and flags
+// releases whose chart has a newer version in the configured repositories.
+// Releases are read with the Helm SDK's Secret storage driver, the default
+// for Helm 3 and 4.
+package helmreleases
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"go.uber.org/zap"
+	"helm.sh/helm/v4/pkg/release"
+	rspb "helm.sh/helm/v4/pkg/release/v1"
+	"helm.sh/helm/v4/pkg/storage/driver"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+)
+
+// Release is the inventory view of the latest revision of a release.
+type Release struct {
+	Name         string    `json:"name"`
+	Namespace    string    `json:"namespace"`
+	Revision     int       `json:"revision"`
+	Status       string    `json:"status"`
+	Chart        string    `json:"chart"`
+	ChartVersion string    `json:"chart_version"`
+	AppVersion   string    `json:"app_version,omitempty"`
+	Updated      time.Time `json:"updated"`
+	// ValuesDigest is a sha256 of the user-supplied values, so identical
+	// configuration can be spotted across clusters without exposing values.
+	ValuesDigest string `json:"values_digest"`
+
+	LatestChartVersion string `json:"latest_chart_version,omitempty"`
+	Repository         string `json:"repository,omitempty"`
+	UpgradeAvailable   bool   `json:"upgrade_available"`
+}
+
+// Inventory reads releases from the cluster.
+type Inventory struct {
+	clientset  kubernetes.Interface
+	namespaces []string
+	allowed    map[string]bool
+	repos      *Repositories
+	logger     *zap.Logger
+}
+
+// New creates an inventory. An empty namespaces list reads all namespaces;
+// repos may be nil to skip the latest-version comparison.
+func New(cs kubernetes.Interface, namespaces []string, repos *Repositories, logger *zap.Logger) *Inventory {
+	inv := &Inventory{clientset: cs, namespaces: namespaces, repos: repos, logger: logger}
+	if len(namespaces) > 0 {
+		inv.allowed = make(map[string]bool, len(namespaces))
+		for _, ns := range namespaces {
+			inv.allowed[ns] = true
+		}
+	}
+	return inv
+}
+
+// Register mounts the inventory endpoint on mux.
+func (inv *Inventory) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/helm/releases", inv.list)
+}
+
+// List returns the latest revision of every release in namespace ("" for
+// every allowed namespace), sorted by namespace and name.
+func (inv *Inventory) List(namespace string) ([]Release, error) {
+	namespaces := []string{namespace}
+	if namespace == "" && len(inv.namespaces) > 0 {
+		namespaces = inv.namespaces
+	}
+
+	latest := make(map[string]*rspb.Release)
+	for _, ns := range namespaces {
+		store := driver.NewSecrets(inv.clientset.CoreV1().Secrets(ns))
+		rels, err := store.List(func(release.Releaser) bool { return true })
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rels {
+			rel, ok := r.(*rspb.Release)
+			if !ok {
+				continue
+			}
+			key := rel.Namespace + "/" + rel.Name
+			if cur, ok := latest[key]; !ok || rel.Version > cur.Version {
+				latest[key] = rel
+			}
+		}
+	}
+
+	out := make([]Release, 0, len(latest))
+	for _, rel := range latest {
+		out = append(out, inv.toRelease(rel))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Namespace != out[j].Namespace {
+			return out[i].Namespace < out[j].Namespace
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out, nil
+}
+
+func (inv *Inventory) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	ns := q.Get("namespace")
+	if ns != "" && inv.allowed != nil && !inv.allowed[ns] {
+		http.Error(w, "namespace not allowed", http.StatusForbidden)
+		return
+	}
+
+	releases, err := inv.List(ns)
+	if err != nil {
+		inv.logger.Error("failed to list helm releases", zap.Error(err))
+		http.Error(w, "failed to list helm releases", http.StatusInternalServerError)
+		return
+	}
+
+	status, outdated := q.Get("status"), q.Get("outdated") == "true"
+	items := releases[:0]
+	for _, rel := range releases {
+		if status != "" && rel.Status != status {
+			continue
+		}
+		if outdated && !rel.UpgradeAvailable {
+			continue
+		}
+		items = append(items, rel)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	codec.Encode(w, map[string]any{"items": items})
+}
+
+func (inv *Inventory) toRelease(rel *rspb.Release) Release {
+	out := Release{
+		Name:         rel.Name,
+		Namespace:    rel.Namespace,
+		Revision:     rel.Version,
+		ValuesDigest: valuesDigest(rel.Config),
+	}
+	if rel.Info != nil {
+		out.Status = rel.Info.Status.String()
+		out.Updated = rel.Info.LastDeployed
+	}
+	if rel.Chart != nil && rel.Chart.Metadata != nil {
+		out.Chart = rel.Chart.Metadata.Name
+		out.ChartVersion = rel.Chart.Metadata.Version
+		out.AppVersion = rel.Chart.Metadata.AppVersion
+	}
+	if inv.repos != nil && out.Chart != "" {
+		if version, repository, ok := inv.repos.Latest(out.Chart); ok {
+			out.LatestChartVersion = version
+			out.Repository = repository
+			out.UpgradeAvailable = newer(version, out.ChartVersion)
+		}
+	}
+	return out
+}
+
+// valuesDigest hashes values as JSON, which orders map keys, so the digest
+// is stable across reads.
+func valuesDigest(values map[string]any) string {
+	if len(values) == 0 {
+		values = map[string]any{}
+	}
+	raw, err := json.Marshal(values)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(raw)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// newer reports whether version a is greater than b. Unparseable versions
+// are never newer.
+func newer(a, b string) bool {
+	va, err := semver.NewVersion(a)
+	if err != nil {
+		return false
+	}
+	vb, err := semver.NewVersion(b)
+	if err != nil {
+		return true
+	}
+	return va.GreaterThan(vb)
+}
@@ -0,0 +1,97 @@
+package helmreleases
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+	chart "helm.sh/helm/v4/pkg/chart/v2"
+	"helm.sh/helm/v4/pkg/release/common"
+	rspb "helm.sh/helm/v4/pkg/release/v1"
+	"helm.sh/helm/v4/pkg/storage/driver"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const index = `apiVersion: v1
+entries:
+  redis:
+  - name: redis
+    version: 19.1.0
+    urls: [redis-19.1.0.tgz]
+  - name: redis
+    version: 20.0.0-rc.1
+    urls: [redis-20.0.0-rc.1.tgz]
+  - name: redis
+    version: 18.0.0
+    urls: [redis-18.0.0.tgz]
+`
+
+func storeRelease(t *testing.T, cs *fake.Clientset, ns, name string, revision int, status common.Status, chartVersion string, values map[string]any) {
+	t.Helper()
+	rel := &rspb.Release{
+		Name:      name,
+		Namespace: ns,
+		Version:   revision,
+		Info:      &rspb.Info{Status: status},
+		Chart:     &chart.Chart{Metadata: &chart.Metadata{Name: "redis", Version: chartVersion, AppVersion: "7.2"}},
+		Config:    values,
+	}
+	key := fmt.Sprintf("sh.helm.release.v1.%s.v%d", name, revision)
+	if err := driver.NewSecrets(cs.CoreV1().Secrets(ns)).Create(key, rel); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestListLatestRevisionWithDrift(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte(index))
+	}))
+	defer srv.Close()
+	repos := NewRepositories(map[string]string{"bitnami": srv.URL}, srv.Client(), zap.NewNop())
+	repos.Refresh(context.Background())
+
+	cs := fake.NewClientset()
+	storeRelease(t, cs, "team-a", "cache", 1, common.StatusSuperseded, "18.0.0", nil)
+	storeRelease(t, cs, "team-a", "cache", 2, common.StatusDeployed, "18.0.0", map[string]any{"replicas": 3})
+	storeRelease(t, cs, "team-b", "cache", 1, common.StatusDeployed, "19.1.0", map[string]any{"replicas": 3})
+
+	releases, err := New(cs, nil, repos, zap.NewNop()).List("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(releases) != 2 {
+		t.Fatalf("expected 2 releases, got %d", len(releases))
+	}
+
+	a, b := releases[0], releases[1]
+	if a.Namespace != "team-a" || a.Revision != 2 || a.Status != "deployed" {
+		t.Errorf("expected team-a revision 2 deployed, got %+v", a)
+	}
+	if a.LatestChartVersion != "19.1.0" || !a.UpgradeAvailable {
+		t.Errorf("expected upgrade to 19.1.0 for team-a, got %+v", a)
+	}
+	if b.UpgradeAvailable {
+		t.Errorf("expected team-b to be current, got %+v", b)
+	}
+	if a.ValuesDigest != b.ValuesDigest {
+		t.Errorf("expected identical values digests, got %s and %s", a.ValuesDigest, b.ValuesDigest)
+	}
+}
+
+func TestListNamespaceFilter(t *testing.T) {
+	cs := fake.NewClientset()
+	storeRelease(t, cs, "team-a", "cache", 1, common.StatusDeployed, "18.0.0", nil)
+	storeRelease(t, cs, "team-b", "cache", 1, common.StatusDeployed, "18.0.0", nil)
+
+	mux := http.NewServeMux()
+	New(cs, []string{"team-a"}, nil, zap.NewNop()).Register(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/helm/releases?namespace=team-b", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,136 @@
+package helmreleases
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	repo "helm.sh/helm/v4/pkg/repo/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// maxIndexSize bounds a downloaded index.yaml; large public repositories
+// are tens of megabytes.
+const maxIndexSize = 64 << 20
+
+// Repositories caches the index of each configured chart repository so
+// releases can be compared with the latest published chart version.
+type Repositories struct {
+	urls   map[string]string
+	client *http.Client
+	logger *zap.Logger
+
+	mu      sync.RWMutex
+	indexes map[string]*repo.IndexFile
+}
+
+// NewRepositories creates a cache for the repositories in urls (name → base
+// URL). Call Refresh or Run to populate it.
+func NewRepositories(urls map[string]string, client *http.Client, logger *zap.Logger) *Repositories {
+	return &Repositories{
+		urls:    urls,
+		client:  client,
+		logger:  logger,
+		indexes: make(map[string]*repo.IndexFile),
+	}
+}
+
+// Run refreshes the indexes every interval until ctx is cancelled.
+func (r *Repositories) Run(ctx context.Context, interval time.Duration) {
+	r.Refresh(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Refresh(ctx)
+		}
+	}
+}
+
+// Refresh downloads every index. A repository that fails keeps its previous
+// index.
+func (r *Repositories) Refresh(ctx context.Context) {
+	for name, url := range r.urls {
+		index, err := r.fetch(ctx, url)
+		if err != nil {
+			r.logger.Warn("failed to refresh chart repository index",
+				zap.String("repository", name),
+				zap.String("url", url),
+				zap.Error(err),
+			)
+			continue
+		}
+		r.mu.Lock()
+		r.indexes[name] = index
+		r.mu.Unlock()
+	}
+}
+
+// Latest returns the newest stable version of chart across repositories and
+// the repository that publishes it.
+func (r *Repositories) Latest(chart string) (version, repository string, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.indexes))
+	for name := range r.indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cv, err := r.indexes[name].Get(chart, "")
+		if err != nil {
+			continue
+		}
+		if !ok || newer(cv.Version, version) {
+			version, repository, ok = cv.Version, name, true
+		}
+	}
+	return version, repository, ok
+}
+
+func (r *Repositories) fetch(ctx context.Context, baseURL string) (*repo.IndexFile, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(baseURL, "/")+"/index.yaml", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxIndexSize))
+	if err != nil {
+		return nil, err
+	}
+
+	index := &repo.IndexFile{}
+	if err := yaml.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("parse index: %w", err)
+	}
+	// Drop malformed entries, as helm's own loader does
+	for name, versions := range index.Entries {
+		valid := versions[:0]
+		for _, v := range versions {
+			if v != nil && v.Metadata != nil {
+				valid = append(valid, v)
+			}
+		}
+		index.Entries[name] = valid
+	}
+	index.SortEntries()
+	return index, nil
+}
@@ -0,0 +1,82 @@
+package httpclient
+
+import (
+	"sync"
+	"time"
+)
+
+// BreakerConfig tunes a circuit breaker.
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens the circuit.
+	FailureThreshold int
+	// OpenDuration is how long the circuit stays open before a trial request.
+	OpenDuration time.Duration
+}
+
+// Breaker is a consecutive-failure circuit breaker. When open, requests are
+// rejected until OpenDuration passes; then a single trial is let through
+// (half-open) and its outcome closes or re-opens the circuit.
+type Breaker struct {
+	threshold    int
+	openDuration time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+// NewBreaker creates a closed breaker.
+func NewBreaker(cfg BreakerConfig) *Breaker {
+	return &Breaker{
+		threshold:    cfg.FailureThreshold,
+		openDuration: cfg.OpenDuration,
+	}
+}
+
+// Allow reports whether a request may be sent.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return true
+	}
+	if time.Since(b.openedAt) < b.openDuration || b.trial {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// Record updates the breaker with the outcome of a request.
+func (b *Breaker) Record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if success {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
+
+// Cancel releases a request let through without recording an outcome,
+// such as one its caller cancelled, so a half-open breaker lets the next
+// trial through.
+func (b *Breaker) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// Open reports whether the circuit is currently open.
+func (b *Breaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.threshold > 0 && b.failures >= b.threshold
+}
@@ -0,0 +1,139 @@
+// Package httpclient builds the HTTP clients used for every outbound call:
+// pooled connections with sane timeouts, retries with jittered backoff for
+// idempotent requests, per-host circuit breaking, request ID propagation,
+// optional OAuth2 client-credentials tokens, and Prometheus metrics, down
+// to connection pool, DNS, dial and TLS handshake timings. Do not use
+// http.DefaultClient in this codebase.
+package httpclient
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Options configures a client.
+type Options struct {
+	// Timeout bounds a whole request including retries (0 means no limit).
+	Timeout time.Duration
+
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	MaxIdleConns          int
+	MaxIdleConnsPerHost   int
+	// MaxConnsPerHost caps connections per host, idle or not (0 means no
+	// limit); requests beyond it wait for one, which shows as pool wait
+	// time in the metrics.
+	MaxConnsPerHost int
+
+	// HTTP2 negotiates HTTP/2 with TLS servers that offer it.
+	HTTP2 bool
+	// HTTP2PingInterval sends a ping on an HTTP/2 connection idle that
+	// long, and HTTP2PingTimeout closes it when the answer takes longer,
+	// so a connection silently dropped by a NAT or load balancer is not
+	// reused (0 means no pings).
+	HTTP2PingInterval time.Duration
+	HTTP2PingTimeout  time.Duration
+
+	// Retries is the number of extra attempts for idempotent requests.
+	Retries        int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+
+	// Breaker is applied per destination host.
+	Breaker BreakerConfig
+
+	// Auth, when set, supplies a bearer token for every request that has
+	// no Authorization header of its own.
+	Auth TokenSource
+}
+
+// DefaultOptions returns conservative defaults for in-cluster dependencies.
+func DefaultOptions() Options {
+	return Options{
+		Timeout:               30 * time.Second,
+		DialTimeout:           5 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 15 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		HTTP2:                 true,
+		HTTP2PingInterval:     30 * time.Second,
+		HTTP2PingTimeout:      15 * time.Second,
+		Retries:               2,
+		RetryBaseDelay:        100 * time.Millisecond,
+		RetryMaxDelay:         2 * time.Second,
+		Breaker: BreakerConfig{
+			FailureThreshold: 5,
+			OpenDuration:     30 * time.Second,
+		},
+	}
+}
+
+// NewTransport returns a pooled transport without retries or breaking, for
+// callers (like the reverse proxy) that implement their own policies.
+func NewTransport(opts Options) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   opts.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     opts.HTTP2,
+		TLSHandshakeTimeout:   opts.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+		MaxIdleConns:          opts.MaxIdleConns,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       opts.MaxConnsPerHost,
+		ExpectContinueTimeout: time.Second,
+	}
+	if opts.HTTP2 {
+		t.HTTP2 = &http.HTTP2Config{
+			SendPingTimeout: opts.HTTP2PingInterval,
+			PingTimeout:     opts.HTTP2PingTimeout,
+		}
+	} else {
+		t.Protocols = new(http.Protocols)
+		t.Protocols.SetHTTP1(true)
+	}
+	return t
+}
+
+// New returns a client for calls to one dependency. name labels the client's
+// metrics (e.g. "argocd", "registry").
+func New(name string, opts Options, logger *zap.Logger) *http.Client {
+	return &http.Client{
+		Timeout:   opts.Timeout,
+		Transport: Wrap(name, NewTransport(opts), opts, logger),
+	}
+}
+
+// Wrap layers instrumentation, authentication, retries, and circuit
+// breaking onto base.
+func Wrap(name string, base http.RoundTripper, opts Options, logger *zap.Logger) http.RoundTripper {
+	var rt http.RoundTripper = &breakerTransport{
+		client:   name,
+		base:     base,
+		cfg:      opts.Breaker,
+		breakers: make(map[string]*Breaker),
+	}
+	rt = &retryTransport{
+		client:    name,
+		base:      rt,
+		retries:   opts.Retries,
+		baseDelay: opts.RetryBaseDelay,
+		maxDelay:  opts.RetryMaxDelay,
+		logger:    logger,
+	}
+	if opts.Auth != nil {
+		rt = &authTransport{base: rt, tokens: opts.Auth}
+	}
+	return &instrumentedTransport{client: name, base: rt}
+}
@@ -0,0 +1,309 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+)
+
+func testOptions() Options {
+	opts := DefaultOptions()
+	opts.RetryBaseDelay = time.Millisecond
+	opts.RetryMaxDelay = 5 * time.Millisecond
+	return opts
+}
+
+func TestRetriesIdempotentRequests(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	client := New("test", testOptions(), zap.NewNop())
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200, got %d", resp.StatusCode)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("expected 3 calls, got %d", got)
+	}
+}
+
+func TestDoesNotRetryPost(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	client := New("test", testOptions(), zap.NewNop())
+	resp, err := client.Post(srv.URL, "text/plain", strings.NewReader("x"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("expected 1 call, got %d", got)
+	}
+}
+
+func TestRetriesPostWithIdempotencyKey(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "x" {
+			t.Errorf("attempt %d: expected body %q, got %q", calls.Load()+1, "x", body)
+		}
+		if calls.Add(1) < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	client := New("test", testOptions(), zap.NewNop())
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("x"))
+	req.Header.Set("Idempotency-Key", "k1")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("expected 201, got %d", resp.StatusCode)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("expected 2 calls, got %d", got)
+	}
+}
+
+func TestCircuitOpensPerHost(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	opts := testOptions()
+	opts.Retries = 0
+	opts.Breaker = BreakerConfig{FailureThreshold: 2, OpenDuration: time.Minute}
+	client := New("test", opts, zap.NewNop())
+
+	for range 2 {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	_, err := client.Get(srv.URL)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen, got %v", err)
+	}
+}
+
+func TestCancelledTrialReleasesCircuit(t *testing.T) {
+	var calls atomic.Int32
+	probing := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusInternalServerError)
+		case 2:
+			// The half-open trial hangs until its caller gives up
+			close(probing)
+			<-r.Context().Done()
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer srv.Close()
+
+	opts := testOptions()
+	opts.Retries = 0
+	opts.Breaker = BreakerConfig{FailureThreshold: 1, OpenDuration: 10 * time.Millisecond}
+	client := New("test", opts, zap.NewNop())
+
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-probing
+		cancel()
+	}()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if _, err := client.Do(req); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the trial cancelled, got %v", err)
+	}
+
+	resp, err = client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("expected the next call let through as the trial, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestBackoffBounded(t *testing.T) {
+	for attempt := range 10 {
+		if d := backoff(attempt, 100*time.Millisecond, time.Second); d < 0 || d > time.Second {
+			t.Errorf("expected backoff within [0, 1s], got %v", d)
+		}
+	}
+}
+
+func TestConnectionMetrics(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	opts := testOptions()
+	opts.HTTP2 = false
+	base := NewTransport(opts)
+	base.TLSClientConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig
+	if base.Protocols == nil || base.Protocols.HTTP2() {
+		t.Fatal("HTTP/2 not disabled")
+	}
+	client := &http.Client{Transport: Wrap("conntest", base, opts, zap.NewNop())}
+	for range 2 {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	// One new connection, dialed and handshaken, then reused
+	host := strings.TrimPrefix(srv.URL, "https://")
+	for name, c := range map[string]prometheus.Collector{
+		"new conn wait":    connWait.WithLabelValues("conntest", host, "false").(prometheus.Histogram),
+		"reused conn wait": connWait.WithLabelValues("conntest", host, "true").(prometheus.Histogram),
+		"dial":             dialDuration.WithLabelValues("conntest", host, "ok").(prometheus.Histogram),
+		"tls handshake":    tlsDuration.WithLabelValues("conntest", host, "ok").(prometheus.Histogram),
+	} {
+		if n := sampleCount(t, c); n != 1 {
+			t.Errorf("%s: %d observations, want 1", name, n)
+		}
+	}
+}
+
+func sampleCount(t *testing.T, c prometheus.Collector) uint64 {
+	t.Helper()
+	ch := make(chan prometheus.Metric, 1)
+	c.Collect(ch)
+	var m dto.Metric
+	if err := (<-ch).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestClientCredentials(t *testing.T) {
+	var issued atomic.Int32
+	issuer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		r.ParseForm()
+		if id != "platform" || secret != "s3cret" || r.Form.Get("grant_type") != "client_credentials" ||
+			r.Form.Get("scope") != "opa.read registry.read" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid_client"}`))
+			return
+		}
+		fmt.Fprintf(w, `{"access_token":"tok-%d","token_type":"Bearer","expires_in":3600}`, issued.Add(1))
+	}))
+	defer issuer.Close()
+
+	var revoked atomic.Value
+	revoked.Store("")
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if auth == "Bearer "+revoked.Load().(string) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(auth + " " + string(body)))
+	}))
+	defer api.Close()
+
+	tokens := NewClientCredentials(ClientCredentialsConfig{
+		TokenURL: issuer.URL, ClientID: "platform", ClientSecret: "s3cret", Scopes: []string{"opa.read", "registry.read"},
+	}, New("oauth2", testOptions(), zap.NewNop()))
+	now := time.Now()
+	tokens.now = func() time.Time { return now }
+	opts := testOptions()
+	opts.Auth = tokens
+	client := New("test", opts, zap.NewNop())
+
+	call := func(body string) string {
+		t.Helper()
+		resp, err := client.Post(api.URL, "text/plain", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+		got, _ := io.ReadAll(resp.Body)
+		return string(got)
+	}
+	if got := call("a") + "|" + call("b"); got != "Bearer tok-1 a|Bearer tok-1 b" || issued.Load() != 1 {
+		t.Errorf("expected one cached token, got %q after %d fetches", got, issued.Load())
+	}
+	revoked.Store("tok-1")
+	if got := call("c"); got != "Bearer tok-2 c" {
+		t.Errorf("expected a rejected token replaced and the body replayed, got %q", got)
+	}
+	now = now.Add(59*time.Minute + 45*time.Second)
+	if got := call("d"); got != "Bearer tok-3 d" {
+		t.Errorf("expected the token refreshed ahead of expiry, got %q", got)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, api.URL, nil)
+	req.Header.Set("Authorization", "Bearer own")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(got) != "Bearer own " {
+		t.Errorf("expected the request's own credentials kept, got %q", got)
+	}
+
+	bad := NewClientCredentials(ClientCredentialsConfig{TokenURL: issuer.URL, ClientID: "other"}, New("oauth2", testOptions(), zap.NewNop()))
+	var tokenErr *TokenError
+	if _, err := bad.Token(t.Context()); !errors.As(err, &tokenErr) || tokenErr.Code != "invalid_client" {
+		t.Errorf("expected invalid_client, got %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	// refreshLeeway is how long before expiry a cached token is replaced,
+	// so that it does not expire in flight.
+	refreshLeeway = 30 * time.Second
+	// defaultTokenTTL is how long a token is cached when the issuer does
+	// not say when it expires.
+	defaultTokenTTL = 5 * time.Minute
+)
+
+var tokenRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_client_token_requests_total",
+	Help: "Client-credentials token requests to the issuer by result (ok or error).",
+}, []string{"result"})
+
+// TokenSource supplies bearer tokens for outbound requests.
+type TokenSource interface {
+	// Token returns a valid token, fetching a new one when needed.
+	Token(ctx context.Context) (string, error)
+	// Invalidate drops token if it is still the cached one, after a
+	// server rejected it.
+	Invalidate(token string)
+}
+
+// TokenError is an error response from the token endpoint.
+type TokenError struct {
+	StatusCode  int
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *TokenError) Error() string {
+	msg := fmt.Sprintf("oauth2: token endpoint: status %d", e.StatusCode)
+	if e.Code != "" {
+		msg += ": " + e.Code
+	}
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	return msg
+}
+
+// ClientCredentialsConfig configures a ClientCredentials.
+type ClientCredentialsConfig struct {
+	// TokenURL is the issuer's token endpoint.
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	// Scopes and Audience are requested with every token; Audience is
+	// for issuers such as Auth0 that need it.
+	Scopes   []string
+	Audience string
+}
+
+// ClientCredentials is a TokenSource obtaining tokens with the OAuth2
+// client-credentials grant (RFC 6749 section 4.4). A token is cached and
+// shared by every request until shortly before it expires; concurrent
+// requests then wait for one fetch rather than each fetching.
+type ClientCredentials struct {
+	cfg  ClientCredentialsConfig
+	http *http.Client
+	now  func() time.Time
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// NewClientCredentials creates a token source fetching tokens with hc,
+// which must not itself use the source.
+func NewClientCredentials(cfg ClientCredentialsConfig, hc *http.Client) *ClientCredentials {
+	return &ClientCredentials{cfg: cfg, http: hc, now: time.Now}
+}
+
+// Token implements TokenSource.
+func (c *ClientCredentials) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && c.now().Before(c.expiry) {
+		return c.token, nil
+	}
+	token, ttl, err := c.fetch(ctx)
+	if err != nil {
+		tokenRequestsTotal.WithLabelValues("error").Inc()
+		return "", err
+	}
+	tokenRequestsTotal.WithLabelValues("ok").Inc()
+	// Refresh ahead of expiry, but keep short-lived tokens for at least
+	// half their lifetime
+	c.token, c.expiry = token, c.now().Add(ttl-min(refreshLeeway, ttl/2))
+	return token, nil
+}
+
+// Invalidate implements TokenSource.
+func (c *ClientCredentials) Invalidate(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == token {
+		c.token = ""
+	}
+}
+
+func (c *ClientCredentials) fetch(ctx context.Context) (string, time.Duration, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.cfg.Scopes, " "))
+	}
+	if c.cfg.Audience != "" {
+		form.Set("audience", c.cfg.Audience)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// Section 2.3.1: credentials are form-encoded before basic auth
+	req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("oauth2: token endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+	body := io.LimitReader(resp.Body, 1<<20)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		tokenErr := &TokenError{StatusCode: resp.StatusCode}
+		json.NewDecoder(body).Decode(tokenErr)
+		return "", 0, tokenErr
+	}
+	var out struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(body).Decode(&out); err != nil {
+		return "", 0, fmt.Errorf("oauth2: decode token response: %w", err)
+	}
+	if out.AccessToken == "" || (out.TokenType != "" && !strings.EqualFold(out.TokenType, "bearer")) {
+		return "", 0, fmt.Errorf("oauth2: token endpoint returned no bearer token")
+	}
+	ttl := defaultTokenTTL
+	if out.ExpiresIn > 0 {
+		ttl = time.Duration(out.ExpiresIn) * time.Second
+	}
+	return out.AccessToken, ttl, nil
+}
+
+// authTransport attaches bearer tokens. A 401 invalidates the token and,
+// when the body can be replayed, the request is sent once more with a
+// fresh one, in case the issuer revoked the cached token early.
+type authTransport struct {
+	base   http.RoundTripper
+	tokens TokenSource
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Requests carrying their own credentials keep them
+	if req.Header.Get("Authorization") != "" {
+		return t.base.RoundTrip(req)
+	}
+	token, err := t.tokens.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(withToken(req, req.Body, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	t.tokens.Invalidate(token)
+	body := req.Body
+	if body != nil && body != http.NoBody {
+		if req.GetBody == nil {
+			return resp, nil
+		}
+		if body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+	fresh, err := t.tokens.Token(req.Context())
+	if err != nil || fresh == token {
+		return resp, nil
+	}
+	resp.Body.Close()
+	return t.base.RoundTrip(withToken(req, body, fresh))
+}
+
+func withToken(req *http.Request, body io.ReadCloser, token string) *http.Request {
+	req = req.Clone(req.Context())
+	req.Body = body
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
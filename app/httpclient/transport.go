@@ -0,0 +1,293 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_client_requests_total",
+		Help: "Outbound HTTP requests by client, host, method, and status code.",
+	}, []string{"client", "host", "method", "code"})
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_client_request_duration_seconds",
+		Help:    "Outbound HTTP request latency including retries.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"client", "host"})
+	retriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_client_retries_total",
+		Help: "Outbound HTTP request retries by client and host.",
+	}, []string{"client", "host"})
+	circuitOpen = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_client_circuit_open",
+		Help: "1 when the circuit breaker for a destination host is open.",
+	}, []string{"client", "host"})
+
+	// Connection timings, per attempt: where a slow call spent its time
+	// before the request was even sent
+	connWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_client_conn_wait_seconds",
+		Help:    "Time to get a connection from the pool, by client, host and whether it was reused; a new one includes DNS, dial and TLS.",
+		Buckets: connBuckets,
+	}, []string{"client", "host", "reused"})
+	dnsDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_client_dns_duration_seconds",
+		Help:    "DNS lookups for new connections, by client, host and result.",
+		Buckets: connBuckets,
+	}, []string{"client", "host", "result"})
+	dialDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_client_dial_duration_seconds",
+		Help:    "TCP connects for new connections, by client, host and result.",
+		Buckets: connBuckets,
+	}, []string{"client", "host", "result"})
+	tlsDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_client_tls_handshake_duration_seconds",
+		Help:    "TLS handshakes for new connections, by client, host and result.",
+		Buckets: connBuckets,
+	}, []string{"client", "host", "result"})
+)
+
+var connBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+
+// ErrCircuitOpen is returned when the destination host's circuit is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// instrumentedTransport propagates the request ID and records metrics.
+type instrumentedTransport struct {
+	client string
+	base   http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if id := middleware.GetRequestID(req.Context()); id != "unknown" && req.Header.Get("X-Request-ID") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("X-Request-ID", id)
+	}
+
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), t.trace(req.URL.Host)))
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	requestDuration.WithLabelValues(t.client, req.URL.Host).Observe(time.Since(start).Seconds())
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	requestsTotal.WithLabelValues(t.client, req.URL.Host, req.Method, code).Inc()
+	return resp, err
+}
+
+// trace records the connection timings of each attempt to host.
+func (t *instrumentedTransport) trace(host string) *httptrace.ClientTrace {
+	var getConn, dnsStart, tlsStart time.Time
+	// Dual-stack dials race an IPv4 and an IPv6 connect
+	var mu sync.Mutex
+	connectStart := map[string]time.Time{}
+	return &httptrace.ClientTrace{
+		GetConn: func(string) { getConn = time.Now() },
+		GotConn: func(info httptrace.GotConnInfo) {
+			if !getConn.IsZero() {
+				connWait.WithLabelValues(t.client, host, strconv.FormatBool(info.Reused)).Observe(time.Since(getConn).Seconds())
+			}
+		},
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			dnsDuration.WithLabelValues(t.client, host, result(info.Err)).Observe(time.Since(dnsStart).Seconds())
+		},
+		ConnectStart: func(_, addr string) {
+			mu.Lock()
+			connectStart[addr] = time.Now()
+			mu.Unlock()
+		},
+		ConnectDone: func(_, addr string, err error) {
+			mu.Lock()
+			start := connectStart[addr]
+			mu.Unlock()
+			dialDuration.WithLabelValues(t.client, host, result(err)).Observe(time.Since(start).Seconds())
+		},
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			tlsDuration.WithLabelValues(t.client, host, result(err)).Observe(time.Since(tlsStart).Seconds())
+		},
+	}
+}
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// retryTransport retries idempotent requests on transport errors and
+// 502/503/504 with exponential backoff and full jitter.
+type retryTransport struct {
+	client    string
+	base      http.RoundTripper
+	retries   int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	logger    *zap.Logger
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isIdempotent(req) || t.retries <= 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	var (
+		resp *http.Response
+		err  error
+	)
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			if req.Body != nil && req.GetBody != nil {
+				body, gerr := req.GetBody()
+				if gerr != nil {
+					return nil, gerr
+				}
+				req = req.Clone(req.Context())
+				req.Body = body
+			}
+			retriesTotal.WithLabelValues(t.client, req.URL.Host).Inc()
+		}
+
+		resp, err = t.base.RoundTrip(req)
+		if !shouldRetry(resp, err) || attempt >= t.retries {
+			return resp, err
+		}
+		if errors.Is(err, ErrCircuitOpen) {
+			return nil, err
+		}
+
+		delay := backoff(attempt, t.baseDelay, t.maxDelay)
+		if resp != nil {
+			if ra := retryAfter(resp); ra > 0 && ra <= t.maxDelay {
+				delay = ra
+			}
+			resp.Body.Close()
+		}
+		t.logger.Debug("retrying outbound request",
+			zap.String("client", t.client),
+			zap.String("host", req.URL.Host),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("delay", delay),
+		)
+
+		if err := sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// breakerTransport keeps one circuit breaker per destination host.
+type breakerTransport struct {
+	client string
+	base   http.RoundTripper
+	cfg    BreakerConfig
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+func (t *breakerTransport) breaker(host string) *Breaker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.breakers[host]
+	if !ok {
+		b = NewBreaker(t.cfg)
+		t.breakers[host] = b
+	}
+	return b
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	b := t.breaker(host)
+	if !b.Allow() {
+		return nil, fmt.Errorf("%s: %w", host, ErrCircuitOpen)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	// Caller cancellations say nothing about the dependency's health
+	if err != nil && req.Context().Err() != nil {
+		b.Cancel()
+		return resp, err
+	}
+	b.Record(err == nil && resp.StatusCode < 500)
+
+	open := 0.0
+	if b.Open() {
+		open = 1
+	}
+	circuitOpen.WithLabelValues(t.client, host).Set(open)
+	return resp, err
+}
+
+// isIdempotent reports whether r may be sent again. POST and PATCH qualify
+// when they carry an Idempotency-Key, which the server uses to replay the
+// first response instead of applying the write twice.
+func isIdempotent(r *http.Request) bool {
+	replayable := r.Body == nil || r.Body == http.NoBody || r.GetBody != nil
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return replayable
+	case http.MethodPost, http.MethodPatch:
+		return replayable && r.Header.Get("Idempotency-Key") != ""
+	}
+	return false
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return false
+}
+
+// backoff returns an exponential delay with full jitter.
+func backoff(attempt int, base, max time.Duration) time.Duration {
+	d := base << attempt
+	if d <= 0 || d > max {
+		d = max
+	}
+	return time.Duration(rand.Int64N(int64(d) + 1))
+}
+
+func retryAfter(resp *http.Response) time.Duration {
+	secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,293 @@
+package infra
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+)
+
+// ErrBusy is returned when a workspace already has a plan or apply running.
+var ErrBusy = errs.New(errs.Conflict, "workspace has a run in progress")
+
+// atlantisHistory bounds the runs kept per workspace.
+const atlantisHistory = 50
+
+// Atlantis runs workspaces through the Atlantis API (/api/plan and
+// /api/apply). Atlantis answers those calls synchronously and keeps no run
+// history, so runs are executed in the background and remembered in memory
+// until restart.
+type Atlantis struct {
+	url     string
+	token   string
+	vcs     string
+	client  *http.Client
+	timeout time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu   sync.Mutex
+	runs map[string]*atlantisRun
+	// order holds run IDs per workspace, oldest first
+	order map[string][]string
+}
+
+type atlantisRun struct {
+	run Run
+	ws  Workspace
+}
+
+// NewAtlantis creates an Atlantis backend. vcs is the repository host type
+// Atlantis expects ("Github", "Gitlab", ...), and timeout bounds one plan or
+// apply; the client should not time out sooner.
+func NewAtlantis(url, token, vcs string, timeout time.Duration, client *http.Client) *Atlantis {
+	if vcs == "" {
+		vcs = "Github"
+	}
+	if timeout <= 0 {
+		timeout = 30 * time.Minute
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Atlantis{
+		url:     strings.TrimSuffix(url, "/"),
+		token:   token,
+		vcs:     vcs,
+		client:  client,
+		timeout: timeout,
+		ctx:     ctx,
+		cancel:  cancel,
+		runs:    make(map[string]*atlantisRun),
+		order:   make(map[string][]string),
+	}
+}
+
+// CreateRun starts a plan in the background. A new plan replaces the
+// workspace's plan file, so an earlier run still waiting for an apply is
+// discarded.
+func (a *Atlantis) CreateRun(_ context.Context, ws *Workspace, opts RunOptions) (*Run, error) {
+	if opts.Destroy {
+		return nil, fmt.Errorf("destroy runs are %w", ErrUnsupported)
+	}
+	var b [8]byte
+	rand.Read(b[:])
+	r := &atlantisRun{
+		run: Run{
+			ID:            "atl-" + hex.EncodeToString(b[:]),
+			Workspace:     ws.Name,
+			Backend:       BackendAtlantis,
+			Status:        StatusPlanning,
+			BackendStatus: StatusPlanning,
+			Message:       opts.Message,
+			PlanOnly:      opts.PlanOnly,
+			CreatedAt:     time.Now().UTC(),
+		},
+		ws: *ws,
+	}
+
+	a.mu.Lock()
+	for _, id := range a.order[ws.Name] {
+		prev := a.runs[id]
+		switch prev.run.Status {
+		case StatusPlanning, StatusApplying:
+			a.mu.Unlock()
+			return nil, ErrBusy
+		case StatusPlanned:
+			prev.run.Status, prev.run.BackendStatus = StatusDiscarded, StatusDiscarded
+		}
+	}
+	a.runs[r.run.ID] = r
+	a.order[ws.Name] = append(a.order[ws.Name], r.run.ID)
+	if n := len(a.order[ws.Name]); n > atlantisHistory {
+		for _, id := range a.order[ws.Name][:n-atlantisHistory] {
+			delete(a.runs, id)
+		}
+		a.order[ws.Name] = slices.Clone(a.order[ws.Name][n-atlantisHistory:])
+	}
+	run := r.run
+	a.wg.Add(1)
+	a.mu.Unlock()
+
+	go a.execute(r, "plan")
+	return &run, nil
+}
+
+// GetRun returns a run started since the last restart.
+func (a *Atlantis) GetRun(_ context.Context, id string) (*Run, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	r, ok := a.runs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	run := r.run
+	return &run, nil
+}
+
+// ListRuns returns the newest runs of ws started since the last restart.
+func (a *Atlantis) ListRuns(_ context.Context, ws *Workspace, limit int) ([]Run, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ids := a.order[ws.Name]
+	runs := make([]Run, 0, min(limit, len(ids)))
+	for i := len(ids) - 1; i >= 0 && len(runs) < limit; i-- {
+		runs = append(runs, a.runs[ids[i]].run)
+	}
+	return runs, nil
+}
+
+// ApplyRun applies a planned run in the background.
+func (a *Atlantis) ApplyRun(_ context.Context, id, _ string) error {
+	a.mu.Lock()
+	r, ok := a.runs[id]
+	if !ok {
+		a.mu.Unlock()
+		return ErrNotFound
+	}
+	if r.run.Status != StatusPlanned {
+		a.mu.Unlock()
+		return ErrNotApplyable
+	}
+	r.run.Status, r.run.BackendStatus = StatusApplying, StatusApplying
+	a.wg.Add(1)
+	a.mu.Unlock()
+
+	go a.execute(r, "apply")
+	return nil
+}
+
+// Outputs is not offered by the Atlantis API.
+func (a *Atlantis) Outputs(context.Context, *Workspace) ([]Output, error) {
+	return nil, ErrUnsupported
+}
+
+// Shutdown cancels running plans and applies and waits for them to stop or
+// ctx to expire.
+func (a *Atlantis) Shutdown(ctx context.Context) error {
+	a.cancel()
+	done := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// atlantisResult is the answer to /api/plan and /api/apply.
+type atlantisResult struct {
+	Failure        string
+	ProjectResults []struct {
+		Failure string
+		// Error is a marshalled Go error, usually {} even when set
+		Error       json.RawMessage
+		PlanSuccess *struct {
+			TerraformOutput string
+		}
+		ApplySuccess string
+	}
+}
+
+func (a *Atlantis) execute(r *atlantisRun, command string) {
+	defer a.wg.Done()
+	ctx, cancel := context.WithTimeout(a.ctx, a.timeout)
+	defer cancel()
+
+	res, err := a.call(ctx, command, &r.ws)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	run := &r.run
+	if err != nil {
+		run.Status, run.BackendStatus = StatusErrored, StatusErrored
+		run.Output = err.Error()
+		return
+	}
+	var outputs []string
+	for _, p := range res.ProjectResults {
+		switch {
+		case p.PlanSuccess != nil:
+			outputs = append(outputs, p.PlanSuccess.TerraformOutput)
+		case p.ApplySuccess != "":
+			outputs = append(outputs, p.ApplySuccess)
+		}
+	}
+	run.Output = strings.Join(outputs, "\n")
+	if command == "apply" {
+		run.Status = StatusApplied
+	} else {
+		changes := !strings.Contains(run.Output, "No changes.")
+		run.HasChanges = &changes
+		run.Status = StatusPlanned
+		if run.PlanOnly || !changes {
+			run.Status = StatusFinished
+		}
+	}
+	run.BackendStatus = run.Status
+}
+
+// call runs command for ws and returns an error carrying the Terraform
+// output when Atlantis reports a failure.
+func (a *Atlantis) call(ctx context.Context, command string, ws *Workspace) (*atlantisResult, error) {
+	data, err := json.Marshal(map[string]any{
+		"Repository": ws.Repository,
+		"Ref":        ws.Ref,
+		"Type":       a.vcs,
+		"Paths":      []map[string]string{{"Directory": ws.Directory, "Workspace": ws.TerraformWorkspace}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url+"/api/"+command, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Atlantis-Token", a.token)
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, err
+	}
+	var res atlantisResult
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("atlantis %s: %d %s", command, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var failures []string
+	if res.Failure != "" {
+		failures = append(failures, res.Failure)
+	}
+	for _, p := range res.ProjectResults {
+		if p.Failure != "" {
+			failures = append(failures, p.Failure)
+		}
+		if e := string(p.Error); e != "" && e != "null" && e != "{}" {
+			failures = append(failures, e)
+		}
+	}
+	if resp.StatusCode != http.StatusOK && len(failures) == 0 {
+		failures = append(failures, http.StatusText(resp.StatusCode))
+	}
+	if len(failures) > 0 {
+		return nil, fmt.Errorf("atlantis %s failed: %s", command, strings.Join(failures, "\n"))
+	}
+	return &res, nil
+}
@@ -0,0 +1,381 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+)
+
+// runsPerWorkspace bounds the runs listed per workspace.
+const runsPerWorkspace = 20
+
+var runsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "infra_runs_total",
+	Help: "Terraform run actions by backend, action and result.",
+}, []string{"backend", "action", "result"})
+
+// Options configures the handler.
+type Options struct {
+	Workspaces []Workspace
+	// Groups may use workspaces that do not list their own groups.
+	Groups []string
+	// UserHeader and GroupsHeader carry the caller's identity, set by the
+	// authenticating proxy.
+	UserHeader   string
+	GroupsHeader string
+}
+
+// Handler serves the infrastructure run endpoints.
+type Handler struct {
+	backends   map[string]Backend
+	workspaces map[string]*Workspace
+	groups     []string
+	headers    authz.Headers
+	bus        events.Publisher
+	logger     *zap.Logger
+}
+
+type runRequest struct {
+	Workspace string `json:"workspace"`
+	RunOptions
+}
+
+type applyRequest struct {
+	Comment string `json:"comment"`
+}
+
+// New creates a handler running workspaces on backends, keyed by backend
+// kind. Every workspace's backend must be configured.
+func New(backends map[string]Backend, bus events.Publisher, opts Options, logger *zap.Logger) (*Handler, error) {
+	h := &Handler{
+		backends:   backends,
+		workspaces: make(map[string]*Workspace, len(opts.Workspaces)),
+		groups:     opts.Groups,
+		headers:    authz.Headers{User: opts.UserHeader, Groups: opts.GroupsHeader},
+		bus:        bus,
+		logger:     logger,
+	}
+	for i := range opts.Workspaces {
+		ws := &opts.Workspaces[i]
+		if backends[ws.Backend] == nil {
+			return nil, fmt.Errorf("workspace %s: backend %s is not configured", ws.Name, ws.Backend)
+		}
+		h.workspaces[ws.Name] = ws
+	}
+	return h, nil
+}
+
+// Register mounts the infrastructure endpoints on mux:
+//
+//	GET  /api/v1/infra/workspaces                  workspaces the caller may use
+//	GET  /api/v1/infra/workspaces/{name}/outputs   current state outputs
+//	GET  /api/v1/infra/runs                        newest runs (?workspace= filters)
+//	POST /api/v1/infra/runs                        start a plan
+//	GET  /api/v1/infra/runs/{id}                   run status
+//	POST /api/v1/infra/runs/{id}/apply             apply a planned run
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/infra/workspaces", h.listWorkspaces)
+	mux.HandleFunc("GET /api/v1/infra/workspaces/{name}/outputs", h.outputs)
+	mux.HandleFunc("GET /api/v1/infra/runs", h.listRuns)
+	mux.HandleFunc("POST /api/v1/infra/runs", h.createRun)
+	mux.HandleFunc("GET /api/v1/infra/runs/{id}", h.getRun)
+	mux.HandleFunc("POST /api/v1/infra/runs/{id}/apply", h.applyRun)
+}
+
+func (h *Handler) listWorkspaces(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.identity(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, h.permitted(id))
+}
+
+func (h *Handler) outputs(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.identity(w, r)
+	if !ok {
+		return
+	}
+	ws, ok := h.workspace(w, r, id, r.PathValue("name"))
+	if !ok {
+		return
+	}
+	outputs, err := h.backends[ws.Backend].Outputs(r.Context(), ws)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, outputs)
+}
+
+func (h *Handler) listRuns(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.identity(w, r)
+	if !ok {
+		return
+	}
+	workspaces := h.permitted(id)
+	if name := r.URL.Query().Get("workspace"); name != "" {
+		ws, ok := h.workspace(w, r, id, name)
+		if !ok {
+			return
+		}
+		workspaces = []*Workspace{ws}
+	}
+	runs := []Run{}
+	for _, ws := range workspaces {
+		wsRuns, err := h.backends[ws.Backend].ListRuns(r.Context(), ws, runsPerWorkspace)
+		if err != nil {
+			h.fail(w, fmt.Errorf("list runs of %s: %w", ws.Name, err))
+			return
+		}
+		runs = append(runs, wsRuns...)
+	}
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].CreatedAt.After(runs[j].CreatedAt) })
+	writeJSON(w, http.StatusOK, runs)
+}
+
+func (h *Handler) createRun(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.identity(w, r)
+	if !ok {
+		return
+	}
+	var req runRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Workspace == "" {
+		http.Error(w, "workspace is required", http.StatusBadRequest)
+		return
+	}
+	ws, ok := h.workspace(w, r, id, req.Workspace)
+	if !ok {
+		return
+	}
+	// The backend's own history should say who asked for the run
+	if req.Message == "" {
+		req.Message = "Queued via the platform API"
+	}
+	req.Message = fmt.Sprintf("%s (requested by %s)", req.Message, id.User)
+
+	run, err := h.backends[ws.Backend].CreateRun(r.Context(), ws, req.RunOptions)
+	h.record(r.Context(), id, "create", ws, run, err)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	w.Header().Set("Location", "/api/v1/infra/runs/"+run.ID)
+	writeJSON(w, http.StatusCreated, run)
+}
+
+func (h *Handler) getRun(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.identity(w, r)
+	if !ok {
+		return
+	}
+	if run, _, ok := h.run(w, r, id); ok {
+		writeJSON(w, http.StatusOK, run)
+	}
+}
+
+func (h *Handler) applyRun(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.identity(w, r)
+	if !ok {
+		return
+	}
+	var req applyRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Comment == "" {
+		req.Comment = "Applied via the platform API"
+	}
+	run, ws, ok := h.run(w, r, id)
+	if !ok {
+		return
+	}
+	if run.PlanOnly {
+		http.Error(w, "plan-only runs cannot be applied", http.StatusConflict)
+		return
+	}
+	backend := h.backends[ws.Backend]
+	err := backend.ApplyRun(r.Context(), run.ID, fmt.Sprintf("%s (by %s)", req.Comment, id.User))
+	h.record(r.Context(), id, "apply", ws, run, err)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	if updated, err := backend.GetRun(r.Context(), run.ID); err == nil {
+		run = updated
+	}
+	writeJSON(w, http.StatusAccepted, run)
+}
+
+// run looks a run up on every backend and checks the caller may use its
+// workspace. Runs of workspaces the platform does not own are not found.
+func (h *Handler) run(w http.ResponseWriter, r *http.Request, id authz.Identity) (*Run, *Workspace, bool) {
+	runID := r.PathValue("id")
+	kinds := make([]string, 0, len(h.backends))
+	for kind := range h.backends {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		run, err := h.backends[kind].GetRun(r.Context(), runID)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			h.fail(w, err)
+			return nil, nil, false
+		}
+		ws, ok := h.workspaces[run.Workspace]
+		if !ok || ws.Backend != kind {
+			break
+		}
+		if !h.allowed(id, ws) {
+			h.deny(w, r, id)
+			return nil, nil, false
+		}
+		return run, ws, true
+	}
+	http.Error(w, "run not found", http.StatusNotFound)
+	return nil, nil, false
+}
+
+// workspace returns the named workspace if the caller may use it.
+func (h *Handler) workspace(w http.ResponseWriter, r *http.Request, id authz.Identity, name string) (*Workspace, bool) {
+	ws, ok := h.workspaces[name]
+	if !ok {
+		http.Error(w, "workspace not found", http.StatusNotFound)
+		return nil, false
+	}
+	if !h.allowed(id, ws) {
+		h.deny(w, r, id)
+		return nil, false
+	}
+	return ws, true
+}
+
+// permitted returns the workspaces the caller may use, sorted by name.
+func (h *Handler) permitted(id authz.Identity) []*Workspace {
+	workspaces := []*Workspace{}
+	for _, ws := range h.workspaces {
+		if h.allowed(id, ws) {
+			workspaces = append(workspaces, ws)
+		}
+	}
+	sort.Slice(workspaces, func(i, j int) bool { return workspaces[i].Name < workspaces[j].Name })
+	return workspaces
+}
+
+func (h *Handler) allowed(id authz.Identity, ws *Workspace) bool {
+	groups := ws.Groups
+	if len(groups) == 0 {
+		groups = h.groups
+	}
+	for _, g := range id.Groups {
+		if slices.Contains(groups, g) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handler) identity(w http.ResponseWriter, r *http.Request) (authz.Identity, bool) {
+	id := h.headers.Identity(r)
+	if id.User == "" {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return id, false
+	}
+	return id, true
+}
+
+func (h *Handler) deny(w http.ResponseWriter, r *http.Request, id authz.Identity) {
+	h.logger.Warn("infra operation denied",
+		zap.String("audit", "infra"),
+		zap.String("request_id", middleware.GetRequestID(r.Context())),
+		zap.String("user", id.User),
+		zap.Strings("groups", id.Groups),
+		zap.String("path", r.URL.Path),
+	)
+	http.Error(w, "forbidden", http.StatusForbidden)
+}
+
+// record audits a run action, counts it and publishes an event on success.
+func (h *Handler) record(ctx context.Context, id authz.Identity, action string, ws *Workspace, run *Run, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	runsTotal.WithLabelValues(ws.Backend, action, result).Inc()
+
+	fields := []zap.Field{
+		zap.String("audit", "infra"),
+		zap.String("request_id", middleware.GetRequestID(ctx)),
+		zap.String("user", id.User),
+		zap.Strings("groups", id.Groups),
+		zap.String("action", action),
+		zap.String("workspace", ws.Name),
+		zap.String("backend", ws.Backend),
+	}
+	if err != nil {
+		h.logger.Warn("infra run action failed", append(fields, zap.Error(err))...)
+		return
+	}
+	fields = append(fields, zap.String("run", run.ID))
+	h.logger.Info("infra run action", fields...)
+
+	eventType := "infra.run.created"
+	if action == "apply" {
+		eventType = "infra.run.apply_requested"
+	}
+	e, err := events.New(eventType, "infra", map[string]any{
+		"run":       run.ID,
+		"workspace": ws.Name,
+		"backend":   ws.Backend,
+		"plan_only": run.PlanOnly,
+		"destroy":   run.Destroy,
+		"user":      id.User,
+	})
+	if err != nil {
+		return
+	}
+	if err := h.bus.Publish(ctx, e); err != nil {
+		h.logger.Warn("failed to publish infra event", zap.Error(err))
+	}
+}
+
+func (h *Handler) fail(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrBusy), errors.Is(err, ErrNotApplyable):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrUnsupported):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+	default:
+		h.logger.Error("infra backend request failed", zap.Error(err))
+		http.Error(w, "infra backend request failed", http.StatusBadGateway)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
@@ -0,0 +1,170 @@
+// Package infra triggers Terraform plans and applies for platform-owned
+// workspaces on Terraform Cloud (or Enterprise) and Atlantis, and surfaces
+// run status and workspace outputs, so cloud infrastructure is provisioned
+// through the same API as Kubernetes resources.
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+)
+
+// Backend kinds a workspace runs on.
+const (
+	BackendTFC      = "tfc"
+	BackendAtlantis = "atlantis"
+)
+
+// Normalised run statuses; Run.BackendStatus keeps the backend's own.
+const (
+	StatusPending  = "pending"
+	StatusPlanning = "planning"
+	// StatusPlanned runs wait for an apply.
+	StatusPlanned  = "planned"
+	StatusApplying = "applying"
+	StatusApplied  = "applied"
+	// StatusFinished runs were plan-only or had no changes to apply.
+	StatusFinished  = "finished"
+	StatusErrored   = "errored"
+	StatusCanceled  = "canceled"
+	StatusDiscarded = "discarded"
+)
+
+var (
+	// ErrNotFound is returned for runs and workspaces the backend does not
+	// know.
+	ErrNotFound = errs.New(errs.NotFound, "not found")
+	// ErrUnsupported is returned for operations a backend cannot perform.
+	ErrUnsupported = errors.New("not supported by the workspace backend")
+	// ErrNotApplyable is returned when applying a run that is not waiting
+	// for one.
+	ErrNotApplyable = errs.New(errs.Conflict, "run is not waiting to be applied")
+)
+
+// Workspace is a platform-owned Terraform workspace.
+type Workspace struct {
+	// Name identifies the workspace in the API. For Terraform Cloud it is
+	// also the workspace name in the organization.
+	Name        string `json:"name"`
+	Backend     string `json:"backend"`
+	Description string `json:"description,omitempty"`
+	// Groups may trigger and read runs; empty falls back to the handler's
+	// default groups.
+	Groups []string `json:"groups,omitempty"`
+
+	// Atlantis only: the repository and ref to plan, the project directory
+	// in it, and the Terraform workspace (default "default").
+	Repository         string `json:"repository,omitempty"`
+	Ref                string `json:"ref,omitempty"`
+	Directory          string `json:"directory,omitempty"`
+	TerraformWorkspace string `json:"terraform_workspace,omitempty"`
+}
+
+// LoadWorkspaces reads a JSON array of workspaces from path.
+func LoadWorkspaces(path string) ([]Workspace, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read infra workspaces: %w", err)
+	}
+	var workspaces []Workspace
+	if err := json.Unmarshal(data, &workspaces); err != nil {
+		return nil, fmt.Errorf("parse infra workspaces: %w", err)
+	}
+	seen := make(map[string]bool, len(workspaces))
+	for i := range workspaces {
+		ws := &workspaces[i]
+		if err := ws.validate(); err != nil {
+			return nil, fmt.Errorf("workspace %d: %w", i, err)
+		}
+		if seen[ws.Name] {
+			return nil, fmt.Errorf("workspace %d: duplicate name %q", i, ws.Name)
+		}
+		seen[ws.Name] = true
+	}
+	return workspaces, nil
+}
+
+func (ws *Workspace) validate() error {
+	if ws.Name == "" {
+		return errors.New("name is required")
+	}
+	switch ws.Backend {
+	case BackendTFC:
+	case BackendAtlantis:
+		if ws.Repository == "" || ws.Ref == "" {
+			return fmt.Errorf("workspace %s: atlantis workspaces need repository and ref", ws.Name)
+		}
+		if ws.Directory == "" {
+			ws.Directory = "."
+		}
+		if ws.TerraformWorkspace == "" {
+			ws.TerraformWorkspace = "default"
+		}
+	default:
+		return fmt.Errorf("workspace %s: backend must be %s or %s", ws.Name, BackendTFC, BackendAtlantis)
+	}
+	return nil
+}
+
+// RunOptions describe a run to start.
+type RunOptions struct {
+	Message string `json:"message"`
+	// PlanOnly runs can never be applied.
+	PlanOnly bool `json:"plan_only"`
+	Destroy  bool `json:"destroy"`
+}
+
+// Run is one plan (and possibly apply) of a workspace.
+type Run struct {
+	ID            string `json:"id"`
+	Workspace     string `json:"workspace"`
+	Backend       string `json:"backend"`
+	Status        string `json:"status"`
+	BackendStatus string `json:"backend_status"`
+	Message       string `json:"message"`
+	PlanOnly      bool   `json:"plan_only"`
+	Destroy       bool   `json:"destroy"`
+	// HasChanges is set once the plan is known.
+	HasChanges *bool     `json:"has_changes,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	// URL links to the run in the backend's UI, if it has one.
+	URL string `json:"url,omitempty"`
+	// Output is the Terraform output of the last step, where the backend
+	// returns it.
+	Output string `json:"output,omitempty"`
+}
+
+// Done reports whether the run has stopped.
+func (r *Run) Done() bool {
+	switch r.Status {
+	case StatusApplied, StatusFinished, StatusErrored, StatusCanceled, StatusDiscarded:
+		return true
+	}
+	return false
+}
+
+// Output is a root module output of a workspace's current state.
+type Output struct {
+	Name      string `json:"name"`
+	Type      string `json:"type,omitempty"`
+	Sensitive bool   `json:"sensitive"`
+	// Value is omitted for sensitive outputs.
+	Value any `json:"value,omitempty"`
+}
+
+// Backend runs Terraform for workspaces.
+type Backend interface {
+	CreateRun(ctx context.Context, ws *Workspace, opts RunOptions) (*Run, error)
+	// GetRun returns the run; its Workspace is the backend workspace name
+	// and is checked against the configured workspaces by the caller.
+	GetRun(ctx context.Context, id string) (*Run, error)
+	ListRuns(ctx context.Context, ws *Workspace, limit int) ([]Run, error)
+	ApplyRun(ctx context.Context, id, comment string) error
+	Outputs(ctx context.Context, ws *Workspace) ([]Output, error)
+}
@@ -0,0 +1,238 @@
+package infra
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+)
+
+func newMux(t *testing.T, backends map[string]Backend, workspaces []Workspace) *http.ServeMux {
+	t.Helper()
+	h, err := New(backends, events.NewMemoryBus(), Options{
+		Workspaces:   workspaces,
+		Groups:       []string{"platform-admins"},
+		UserHeader:   "X-Forwarded-User",
+		GroupsHeader: "X-Forwarded-Groups",
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mux := http.NewServeMux()
+	h.Register(mux)
+	return mux
+}
+
+func do(mux *http.ServeMux, method, target, groups, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("X-Forwarded-User", "alice")
+	req.Header.Set("X-Forwarded-Groups", groups)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLoadWorkspaces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "workspaces.json")
+	os.WriteFile(path, []byte(`[
+		{"name":"network","backend":"tfc"},
+		{"name":"dns","backend":"atlantis","repository":"acme/infra","ref":"main"}
+	]`), 0o600)
+	workspaces, err := LoadWorkspaces(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ws := workspaces[1]; ws.Directory != "." || ws.TerraformWorkspace != "default" {
+		t.Errorf("expected atlantis defaults, got %+v", ws)
+	}
+
+	for _, content := range []string{
+		`[{"name":"dns","backend":"atlantis"}]`,
+		`[{"name":"network","backend":"spacelift"}]`,
+		`[{"name":"network","backend":"tfc"},{"name":"network","backend":"tfc"}]`,
+	} {
+		os.WriteFile(path, []byte(content), 0o600)
+		if _, err := LoadWorkspaces(path); err == nil {
+			t.Errorf("%s: expected an error", content)
+		}
+	}
+}
+
+func TestTerraformCloudRuns(t *testing.T) {
+	var message, comment string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			http.Error(w, `{"errors":[{"title":"unauthorized"}]}`, http.StatusUnauthorized)
+			return
+		}
+		run := func(id, ws, status string) string {
+			return `{"data":{"id":"` + id + `","attributes":{"status":"` + status + `","message":"m","created-at":"2026-10-01T10:00:00Z","has-changes":true},` +
+				`"relationships":{"workspace":{"data":{"id":"` + ws + `"}}}}}`
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v2/organizations/acme/workspaces/network":
+			w.Write([]byte(`{"data":{"id":"ws-1","attributes":{"name":"network"}}}`))
+		case "GET /api/v2/workspaces/ws-1":
+			w.Write([]byte(`{"data":{"id":"ws-1","attributes":{"name":"network"}}}`))
+		case "GET /api/v2/workspaces/ws-2":
+			w.Write([]byte(`{"data":{"id":"ws-2","attributes":{"name":"billing"}}}`))
+		case "POST /api/v2/runs":
+			var body struct {
+				Data struct {
+					Attributes struct {
+						Message string `json:"message"`
+					} `json:"attributes"`
+				} `json:"data"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			message = body.Data.Attributes.Message
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(run("run-1", "ws-1", "pending")))
+		case "GET /api/v2/runs/run-1":
+			w.Write([]byte(run("run-1", "ws-1", "planned")))
+		case "GET /api/v2/runs/run-2":
+			w.Write([]byte(run("run-2", "ws-2", "planned")))
+		case "POST /api/v2/runs/run-1/actions/apply":
+			var body struct{ Comment string }
+			json.NewDecoder(r.Body).Decode(&body)
+			comment = body.Comment
+			w.WriteHeader(http.StatusAccepted)
+		case "GET /api/v2/workspaces/ws-1/current-state-version-outputs":
+			w.Write([]byte(`{"data":[
+				{"attributes":{"name":"vpc_id","sensitive":false,"type":"string","value":"vpc-123"}},
+				{"attributes":{"name":"db_password","sensitive":true,"type":"string","value":"hunter2"}}
+			]}`))
+		default:
+			http.Error(w, `{"errors":[{"status":"404","title":"not found"}]}`, http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	tfc := &TerraformCloud{URL: srv.URL, Organization: "acme", Token: "s3cret", Client: srv.Client()}
+	mux := newMux(t, map[string]Backend{BackendTFC: tfc}, []Workspace{{Name: "network", Backend: BackendTFC}})
+
+	if rec := do(mux, http.MethodPost, "/api/v1/infra/runs", "developers", `{"workspace":"network"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 outside the workspace groups, got %d", rec.Code)
+	}
+	rec := do(mux, http.MethodPost, "/api/v1/infra/runs", "platform-admins", `{"workspace":"network","message":"Widen subnets"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if message != "Widen subnets (requested by alice)" {
+		t.Errorf("unexpected run message %q", message)
+	}
+
+	rec = do(mux, http.MethodGet, "/api/v1/infra/runs/run-1", "platform-admins", "")
+	var run Run
+	json.Unmarshal(rec.Body.Bytes(), &run)
+	if run.Status != StatusPlanned || run.Workspace != "network" || run.HasChanges == nil || !*run.HasChanges {
+		t.Errorf("expected a planned run with changes, got %+v", run)
+	}
+	// Runs of workspaces the platform does not own stay hidden
+	if rec := do(mux, http.MethodGet, "/api/v1/infra/runs/run-2", "platform-admins", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a foreign workspace's run, got %d", rec.Code)
+	}
+
+	if rec := do(mux, http.MethodPost, "/api/v1/infra/runs/run-1/apply", "platform-admins", ""); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if comment != "Applied via the platform API (by alice)" {
+		t.Errorf("unexpected apply comment %q", comment)
+	}
+
+	rec = do(mux, http.MethodGet, "/api/v1/infra/workspaces/network/outputs", "platform-admins", "")
+	var outputs []Output
+	json.Unmarshal(rec.Body.Bytes(), &outputs)
+	if len(outputs) != 2 || outputs[0].Value != "vpc-123" || !outputs[1].Sensitive || outputs[1].Value != nil {
+		t.Errorf("expected sensitive values to be hidden, got %+v", outputs)
+	}
+}
+
+func TestAtlantisRuns(t *testing.T) {
+	release := make(chan struct{})
+	var commands []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Atlantis-Token") != "s3cret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var body struct {
+			Repository string
+			Paths      []struct{ Directory, Workspace string }
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		commands = append(commands, r.URL.Path+" "+body.Repository+" "+body.Paths[0].Directory)
+		switch r.URL.Path {
+		case "/api/plan":
+			<-release
+			w.Write([]byte(`{"Error":null,"Failure":"","ProjectResults":[{"Error":null,"Failure":"","PlanSuccess":{"TerraformOutput":"Plan: 1 to add, 0 to change, 0 to destroy."}}]}`))
+		case "/api/apply":
+			w.Write([]byte(`{"Error":null,"Failure":"","ProjectResults":[{"Error":null,"Failure":"","ApplySuccess":"Apply complete! Resources: 1 added."}]}`))
+		}
+	}))
+	defer srv.Close()
+	atlantis := NewAtlantis(srv.URL, "s3cret", "Github", time.Minute, srv.Client())
+	t.Cleanup(func() { atlantis.Shutdown(t.Context()) })
+	mux := newMux(t, map[string]Backend{BackendAtlantis: atlantis}, []Workspace{{
+		Name: "dns", Backend: BackendAtlantis, Repository: "acme/infra", Ref: "main", Directory: "dns", TerraformWorkspace: "default",
+	}})
+
+	if rec := do(mux, http.MethodPost, "/api/v1/infra/runs", "platform-admins", `{"workspace":"dns","destroy":true}`); rec.Code != http.StatusNotImplemented {
+		t.Errorf("expected 501 for a destroy run, got %d", rec.Code)
+	}
+	rec := do(mux, http.MethodPost, "/api/v1/infra/runs", "platform-admins", `{"workspace":"dns"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var run Run
+	json.Unmarshal(rec.Body.Bytes(), &run)
+	if rec := do(mux, http.MethodPost, "/api/v1/infra/runs", "platform-admins", `{"workspace":"dns"}`); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 while a plan runs, got %d", rec.Code)
+	}
+	if rec := do(mux, http.MethodPost, "/api/v1/infra/runs/"+run.ID+"/apply", "platform-admins", ""); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 applying an unfinished plan, got %d", rec.Code)
+	}
+	close(release)
+
+	wait := func(status string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			rec := do(mux, http.MethodGet, "/api/v1/infra/runs/"+run.ID, "platform-admins", "")
+			json.Unmarshal(rec.Body.Bytes(), &run)
+			if run.Status == status {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("run did not reach %s: %+v", status, run)
+	}
+	wait(StatusPlanned)
+	if !strings.Contains(run.Output, "1 to add") {
+		t.Errorf("expected the plan output, got %q", run.Output)
+	}
+	if rec := do(mux, http.MethodPost, "/api/v1/infra/runs/"+run.ID+"/apply", "platform-admins", ""); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	wait(StatusApplied)
+
+	rec = do(mux, http.MethodGet, "/api/v1/infra/runs?workspace=dns", "platform-admins", "")
+	var runs []Run
+	json.Unmarshal(rec.Body.Bytes(), &runs)
+	if len(runs) != 1 || runs[0].ID != run.ID {
+		t.Errorf("expected the run in the history, got %+v", runs)
+	}
+	if len(commands) != 2 || commands[0] != "/api/plan acme/infra dns" || commands[1] != "/api/apply acme/infra dns" {
+		t.Errorf("unexpected atlantis calls %v", commands)
+	}
+	if rec := do(mux, http.MethodGet, "/api/v1/infra/workspaces/dns/outputs", "platform-admins", ""); rec.Code != http.StatusNotImplemented {
+		t.Errorf("expected 501 for atlantis outputs, got %d", rec.Code)
+	}
+}
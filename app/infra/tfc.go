@@ -0,0 +1,313 @@
+package infra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TerraformCloud runs workspaces of one Terraform Cloud (or Enterprise)
+// organization through its JSON:API.
+type TerraformCloud struct {
+	// URL is the instance, https://app.terraform.io for Terraform Cloud.
+	URL          string
+	Organization string
+	// Token is a team or user token allowed to queue and apply runs.
+	Token  string
+	Client *http.Client
+
+	mu sync.Mutex
+	// ids and names cache workspace name <-> ID lookups
+	ids   map[string]string
+	names map[string]string
+}
+
+// tfcError is a non-2xx answer from the API.
+type tfcError struct {
+	status int
+	detail string
+}
+
+func (e *tfcError) Error() string {
+	return fmt.Sprintf("terraform cloud: %d %s", e.status, e.detail)
+}
+
+type tfcRun struct {
+	ID         string `json:"id"`
+	Attributes struct {
+		Status    string    `json:"status"`
+		Message   string    `json:"message"`
+		CreatedAt time.Time `json:"created-at"`
+		// HasChanges is only meaningful once the plan finished
+		HasChanges bool `json:"has-changes"`
+		PlanOnly   bool `json:"plan-only"`
+		IsDestroy  bool `json:"is-destroy"`
+	} `json:"attributes"`
+	Relationships struct {
+		Workspace struct {
+			Data struct {
+				ID string `json:"id"`
+			} `json:"data"`
+		} `json:"workspace"`
+	} `json:"relationships"`
+}
+
+// CreateRun queues a run. Runs wait for ApplyRun unless the workspace
+// auto-applies.
+func (t *TerraformCloud) CreateRun(ctx context.Context, ws *Workspace, opts RunOptions) (*Run, error) {
+	id, err := t.workspaceID(ctx, ws.Name)
+	if err != nil {
+		return nil, err
+	}
+	body := map[string]any{"data": map[string]any{
+		"type": "runs",
+		"attributes": map[string]any{
+			"message":    opts.Message,
+			"plan-only":  opts.PlanOnly,
+			"is-destroy": opts.Destroy,
+		},
+		"relationships": map[string]any{
+			"workspace": map[string]any{"data": map[string]string{"type": "workspaces", "id": id}},
+		},
+	}}
+	var out struct {
+		Data tfcRun `json:"data"`
+	}
+	if err := t.do(ctx, http.MethodPost, "/runs", body, &out); err != nil {
+		return nil, err
+	}
+	return t.convert(&out.Data, ws.Name), nil
+}
+
+// GetRun returns a run of any workspace in the organization.
+func (t *TerraformCloud) GetRun(ctx context.Context, id string) (*Run, error) {
+	var out struct {
+		Data tfcRun `json:"data"`
+	}
+	if err := t.do(ctx, http.MethodGet, "/runs/"+url.PathEscape(id), nil, &out); err != nil {
+		return nil, err
+	}
+	name, err := t.workspaceName(ctx, out.Data.Relationships.Workspace.Data.ID)
+	if err != nil {
+		return nil, err
+	}
+	return t.convert(&out.Data, name), nil
+}
+
+// ListRuns returns the newest runs of ws.
+func (t *TerraformCloud) ListRuns(ctx context.Context, ws *Workspace, limit int) ([]Run, error) {
+	id, err := t.workspaceID(ctx, ws.Name)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Data []tfcRun `json:"data"`
+	}
+	if err := t.do(ctx, http.MethodGet, fmt.Sprintf("/workspaces/%s/runs?page%%5Bsize%%5D=%d", id, limit), nil, &out); err != nil {
+		return nil, err
+	}
+	runs := make([]Run, 0, len(out.Data))
+	for i := range out.Data {
+		runs = append(runs, *t.convert(&out.Data[i], ws.Name))
+	}
+	return runs, nil
+}
+
+// ApplyRun confirms a planned run.
+func (t *TerraformCloud) ApplyRun(ctx context.Context, id, comment string) error {
+	err := t.do(ctx, http.MethodPost, "/runs/"+url.PathEscape(id)+"/actions/apply", map[string]string{"comment": comment}, nil)
+	var apiErr *tfcError
+	if errors.As(err, &apiErr) && apiErr.status == http.StatusConflict {
+		return ErrNotApplyable
+	}
+	return err
+}
+
+// Outputs returns the outputs of ws's current state version.
+func (t *TerraformCloud) Outputs(ctx context.Context, ws *Workspace) ([]Output, error) {
+	id, err := t.workspaceID(ctx, ws.Name)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Data []struct {
+			Attributes struct {
+				Name      string          `json:"name"`
+				Sensitive bool            `json:"sensitive"`
+				Type      json.RawMessage `json:"type"`
+				Value     any             `json:"value"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := t.do(ctx, http.MethodGet, "/workspaces/"+id+"/current-state-version-outputs", nil, &out); err != nil {
+		return nil, err
+	}
+	outputs := make([]Output, 0, len(out.Data))
+	for _, o := range out.Data {
+		output := Output{Name: o.Attributes.Name, Sensitive: o.Attributes.Sensitive}
+		// Primitive types are strings, complex ones a type expression
+		var typ string
+		if json.Unmarshal(o.Attributes.Type, &typ) == nil {
+			output.Type = typ
+		} else {
+			output.Type = string(o.Attributes.Type)
+		}
+		if !output.Sensitive {
+			output.Value = o.Attributes.Value
+		}
+		outputs = append(outputs, output)
+	}
+	return outputs, nil
+}
+
+func (t *TerraformCloud) workspaceID(ctx context.Context, name string) (string, error) {
+	t.mu.Lock()
+	id, ok := t.ids[name]
+	t.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+	var out struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := t.do(ctx, http.MethodGet, "/organizations/"+url.PathEscape(t.Organization)+"/workspaces/"+url.PathEscape(name), nil, &out); err != nil {
+		return "", fmt.Errorf("workspace %s: %w", name, err)
+	}
+	t.remember(name, out.Data.ID)
+	return out.Data.ID, nil
+}
+
+func (t *TerraformCloud) workspaceName(ctx context.Context, id string) (string, error) {
+	t.mu.Lock()
+	name, ok := t.names[id]
+	t.mu.Unlock()
+	if ok {
+		return name, nil
+	}
+	var out struct {
+		Data struct {
+			Attributes struct {
+				Name string `json:"name"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := t.do(ctx, http.MethodGet, "/workspaces/"+url.PathEscape(id), nil, &out); err != nil {
+		return "", fmt.Errorf("workspace %s: %w", id, err)
+	}
+	t.remember(out.Data.Attributes.Name, id)
+	return out.Data.Attributes.Name, nil
+}
+
+func (t *TerraformCloud) remember(name, id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.ids == nil {
+		t.ids = make(map[string]string)
+		t.names = make(map[string]string)
+	}
+	t.ids[name] = id
+	t.names[id] = name
+}
+
+func (t *TerraformCloud) convert(r *tfcRun, workspace string) *Run {
+	run := &Run{
+		ID:            r.ID,
+		Workspace:     workspace,
+		Backend:       BackendTFC,
+		Status:        tfcStatus(r.Attributes.Status),
+		BackendStatus: r.Attributes.Status,
+		Message:       r.Attributes.Message,
+		PlanOnly:      r.Attributes.PlanOnly,
+		Destroy:       r.Attributes.IsDestroy,
+		CreatedAt:     r.Attributes.CreatedAt,
+		URL:           fmt.Sprintf("%s/app/%s/workspaces/%s/runs/%s", strings.TrimSuffix(t.URL, "/"), t.Organization, workspace, r.ID),
+	}
+	switch run.Status {
+	case StatusPlanned, StatusApplying, StatusApplied, StatusFinished:
+		run.HasChanges = new(r.Attributes.HasChanges)
+	}
+	return run
+}
+
+// tfcStatus maps the Terraform Cloud run states onto the normalised ones.
+func tfcStatus(status string) string {
+	switch status {
+	case "pending", "fetching", "fetching_completed", "queuing", "plan_queued", "pre_plan_running", "pre_plan_completed":
+		return StatusPending
+	case "planning", "cost_estimating", "policy_checking", "post_plan_running":
+		return StatusPlanning
+	case "planned", "cost_estimated", "policy_checked", "policy_override", "policy_soft_failed", "post_plan_completed":
+		return StatusPlanned
+	case "confirmed", "apply_queued", "queuing_apply", "pre_apply_running", "pre_apply_completed", "applying":
+		return StatusApplying
+	case "applied":
+		return StatusApplied
+	case "planned_and_finished", "planned_and_saved":
+		return StatusFinished
+	case "canceled", "force_canceled":
+		return StatusCanceled
+	case "discarded":
+		return StatusDiscarded
+	default:
+		return StatusErrored
+	}
+}
+
+func (t *TerraformCloud) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(t.URL, "/")+"/api/v2"+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+t.Token)
+	req.Header.Set("Accept", "application/vnd.api+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/vnd.api+json")
+	}
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var e struct {
+			Errors []struct {
+				Detail string `json:"detail"`
+				Title  string `json:"title"`
+			} `json:"errors"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&e)
+		detail := http.StatusText(resp.StatusCode)
+		if len(e.Errors) > 0 {
+			detail = e.Errors[0].Title
+			if e.Errors[0].Detail != "" {
+				detail = e.Errors[0].Detail
+			}
+		}
+		return &tfcError{status: resp.StatusCode, detail: detail}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
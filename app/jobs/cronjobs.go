@@ -0,0 +1,432 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+	authzv1 "k8s.io/api/authorization/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/utils/ptr"
+)
+
+// maxCronJobName leaves room for the 11-character suffix the CronJob
+// controller appends to Job names.
+const maxCronJobName = 52
+
+var cronJobOpsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "cronjob_operations_total",
+	Help: "CronJob management operations by operation and result.",
+}, []string{"operation", "result"})
+
+// CronJobRequest creates or replaces a platform-managed CronJob.
+type CronJobRequest struct {
+	Name     string            `json:"name"`
+	Template string            `json:"template"`
+	Params   map[string]string `json:"params"`
+	// Schedule is a standard five-field cron expression or a descriptor
+	// such as "@daily".
+	Schedule string `json:"schedule"`
+	// TimeZone is an IANA name, e.g. "Europe/London" (empty = controller's
+	// local time, usually UTC).
+	TimeZone string `json:"time_zone,omitempty"`
+	Suspend  bool   `json:"suspend,omitempty"`
+}
+
+// CronJobStatus is the API view of a platform-managed CronJob.
+type CronJobStatus struct {
+	Name               string            `json:"name"`
+	Namespace          string            `json:"namespace"`
+	Template           string            `json:"template"`
+	Params             map[string]string `json:"params,omitempty"`
+	Schedule           string            `json:"schedule"`
+	TimeZone           string            `json:"time_zone,omitempty"`
+	Suspended          bool              `json:"suspended"`
+	ChangedBy          string            `json:"changed_by,omitempty"`
+	Active             int               `json:"active"`
+	LastScheduleTime   *time.Time        `json:"last_schedule_time,omitempty"`
+	LastSuccessfulTime *time.Time        `json:"last_successful_time,omitempty"`
+	NextRun            *time.Time        `json:"next_run,omitempty"`
+	Created            time.Time         `json:"created"`
+}
+
+func (h *Handler) listCronJobs(w http.ResponseWriter, r *http.Request) {
+	ns := r.PathValue("ns")
+	if _, ok := h.authorize(w, r, cronJobAttrs(ns, "list", "")); !ok {
+		return
+	}
+	cached, ok := fromCache(w, r, h.cronJobsInformer)
+	if !ok {
+		return
+	}
+	var cronJobs []*batchv1.CronJob
+	var err error
+	if cached {
+		cronJobs, err = h.cronJobs.CronJobs(ns).List(templated)
+	} else {
+		var list *batchv1.CronJobList
+		list, err = h.clientset.BatchV1().CronJobs(ns).List(r.Context(), metav1.ListOptions{LabelSelector: TemplateLabel})
+		if err == nil {
+			for i := range list.Items {
+				cronJobs = append(cronJobs, &list.Items[i])
+			}
+		}
+	}
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	now := time.Now()
+	items := make([]CronJobStatus, 0, len(cronJobs))
+	for _, cj := range cronJobs {
+		items = append(items, toCronJobStatus(cj, now))
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+func (h *Handler) getCronJob(w http.ResponseWriter, r *http.Request) {
+	cj, ok := h.lookupCronJob(w, r, "get")
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, toCronJobStatus(cj, time.Now()))
+}
+
+func (h *Handler) createCronJob(w http.ResponseWriter, r *http.Request) {
+	ns := r.PathValue("ns")
+	var req CronJobRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if errs := validation.IsDNS1123Subdomain(req.Name); len(errs) > 0 || len(req.Name) > maxCronJobName {
+		cronJobOpsTotal.WithLabelValues("create", "bad_request").Inc()
+		http.Error(w, fmt.Sprintf("name must be a DNS subdomain of at most %d characters", maxCronJobName), http.StatusBadRequest)
+		return
+	}
+	id, ok := h.authorize(w, r, cronJobAttrs(ns, "create", ""))
+	if !ok {
+		cronJobOpsTotal.WithLabelValues("create", "forbidden").Inc()
+		return
+	}
+	cj := &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: req.Name, Namespace: ns}}
+	if err := h.applyCronJob(cj, req, id.User); err != nil {
+		cronJobOpsTotal.WithLabelValues("create", "bad_request").Inc()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	created, err := h.clientset.BatchV1().CronJobs(ns).Create(r.Context(), cj, metav1.CreateOptions{})
+	if err != nil {
+		cronJobOpsTotal.WithLabelValues("create", "error").Inc()
+		if apierrors.IsAlreadyExists(err) {
+			http.Error(w, "cronjob already exists", http.StatusConflict)
+			return
+		}
+		h.fail(w, err)
+		return
+	}
+	cronJobOpsTotal.WithLabelValues("create", "ok").Inc()
+	h.auditCronJob("cronjob created", created, id.User)
+	writeJSON(w, http.StatusCreated, toCronJobStatus(created, time.Now()))
+}
+
+// updateCronJob replaces the template, parameters and schedule of an
+// existing CronJob. The name in the body, if any, is ignored.
+func (h *Handler) updateCronJob(w http.ResponseWriter, r *http.Request) {
+	var req CronJobRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	cj, ok := h.lookupCronJob(w, r, "update")
+	if !ok {
+		cronJobOpsTotal.WithLabelValues("update", "rejected").Inc()
+		return
+	}
+	user := h.headers.Identity(r).User
+	if err := h.applyCronJob(cj, req, user); err != nil {
+		cronJobOpsTotal.WithLabelValues("update", "bad_request").Inc()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	updated, err := h.clientset.BatchV1().CronJobs(cj.Namespace).Update(r.Context(), cj, metav1.UpdateOptions{})
+	if err != nil {
+		cronJobOpsTotal.WithLabelValues("update", "error").Inc()
+		h.failUpdate(w, err)
+		return
+	}
+	cronJobOpsTotal.WithLabelValues("update", "ok").Inc()
+	h.auditCronJob("cronjob updated", updated, user)
+	writeJSON(w, http.StatusOK, toCronJobStatus(updated, time.Now()))
+}
+
+func (h *Handler) suspendCronJob(suspend bool) http.HandlerFunc {
+	op := "resume"
+	if suspend {
+		op = "suspend"
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		cj, ok := h.lookupCronJob(w, r, "update")
+		if !ok {
+			cronJobOpsTotal.WithLabelValues(op, "rejected").Inc()
+			return
+		}
+		user := h.headers.Identity(r).User
+		cj.Spec.Suspend = ptr.To(suspend)
+		cj.Annotations[SubmittedByAnnotation] = user
+		updated, err := h.clientset.BatchV1().CronJobs(cj.Namespace).Update(r.Context(), cj, metav1.UpdateOptions{})
+		if err != nil {
+			cronJobOpsTotal.WithLabelValues(op, "error").Inc()
+			h.failUpdate(w, err)
+			return
+		}
+		cronJobOpsTotal.WithLabelValues(op, "ok").Inc()
+		h.auditCronJob("cronjob "+op+"d", updated, user)
+		writeJSON(w, http.StatusOK, toCronJobStatus(updated, time.Now()))
+	}
+}
+
+// triggerCronJob runs the CronJob now, like kubectl create job --from. The
+// Job is owned by the CronJob so it is deleted along with it.
+func (h *Handler) triggerCronJob(w http.ResponseWriter, r *http.Request) {
+	cj, ok := h.lookupCronJob(w, r, "get")
+	if !ok {
+		cronJobOpsTotal.WithLabelValues("trigger", "rejected").Inc()
+		return
+	}
+	id, ok := h.authorize(w, r, authzv1.ResourceAttributes{
+		Namespace: cj.Namespace,
+		Verb:      "create",
+		Group:     "batch",
+		Resource:  "jobs",
+	})
+	if !ok {
+		cronJobOpsTotal.WithLabelValues("trigger", "rejected").Inc()
+		return
+	}
+
+	labels := make(map[string]string, len(cj.Spec.JobTemplate.Labels))
+	for k, v := range cj.Spec.JobTemplate.Labels {
+		labels[k] = v
+	}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: cj.Name + "-manual-",
+			Namespace:    cj.Namespace,
+			Labels:       labels,
+			Annotations: map[string]string{
+				"cronjob.kubernetes.io/instantiate": "manual",
+				SubmittedByAnnotation:               id.User,
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(cj, batchv1.SchemeGroupVersion.WithKind("CronJob")),
+			},
+		},
+		Spec: *cj.Spec.JobTemplate.Spec.DeepCopy(),
+	}
+	created, err := h.clientset.BatchV1().Jobs(cj.Namespace).Create(r.Context(), job, metav1.CreateOptions{})
+	if err != nil {
+		cronJobOpsTotal.WithLabelValues("trigger", "error").Inc()
+		h.fail(w, err)
+		return
+	}
+	cronJobOpsTotal.WithLabelValues("trigger", "ok").Inc()
+	h.auditCronJob("cronjob triggered", cj, id.User, zap.String("job", created.Name))
+	h.publish(r.Context(), created, id.User)
+	writeJSON(w, http.StatusCreated, toStatus(created))
+}
+
+func (h *Handler) deleteCronJob(w http.ResponseWriter, r *http.Request) {
+	cj, ok := h.lookupCronJob(w, r, "delete")
+	if !ok {
+		cronJobOpsTotal.WithLabelValues("delete", "rejected").Inc()
+		return
+	}
+	err := h.clientset.BatchV1().CronJobs(cj.Namespace).Delete(r.Context(), cj.Name, metav1.DeleteOptions{
+		PropagationPolicy: ptr.To(metav1.DeletePropagationBackground),
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		cronJobOpsTotal.WithLabelValues("delete", "error").Inc()
+		h.fail(w, err)
+		return
+	}
+	cronJobOpsTotal.WithLabelValues("delete", "ok").Inc()
+	h.auditCronJob("cronjob deleted", cj, h.headers.Identity(r).User)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// applyCronJob renders req onto cj, keeping its name, namespace and
+// resourceVersion.
+func (h *Handler) applyCronJob(cj *batchv1.CronJob, req CronJobRequest, user string) error {
+	tmpl, ok := h.templates[req.Template]
+	if !ok {
+		return errors.New("unknown template")
+	}
+	command, args, err := tmpl.render(req.Params)
+	if err != nil {
+		return err
+	}
+	if _, err := parseSchedule(req.Schedule, req.TimeZone); err != nil {
+		return err
+	}
+	params, err := json.Marshal(req.Params)
+	if err != nil {
+		return err
+	}
+
+	spec, labels := h.jobSpec(tmpl, command, args)
+	cj.Labels = labels
+	if cj.Annotations == nil {
+		cj.Annotations = map[string]string{}
+	}
+	cj.Annotations[SubmittedByAnnotation] = user
+	cj.Annotations[ParamsAnnotation] = string(params)
+	cj.Spec = batchv1.CronJobSpec{
+		Schedule:                   req.Schedule,
+		Suspend:                    ptr.To(req.Suspend),
+		ConcurrencyPolicy:          batchv1.ForbidConcurrent,
+		SuccessfulJobsHistoryLimit: ptr.To(int32(3)),
+		FailedJobsHistoryLimit:     ptr.To(int32(1)),
+		JobTemplate: batchv1.JobTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: labels},
+			Spec:       spec,
+		},
+	}
+	if req.TimeZone != "" {
+		cj.Spec.TimeZone = ptr.To(req.TimeZone)
+	}
+	return nil
+}
+
+// lookupCronJob authorises verb on the named CronJob and fetches it, from
+// the cache for GET requests; the caller may modify it. Only CronJobs
+// created through this API are visible.
+func (h *Handler) lookupCronJob(w http.ResponseWriter, r *http.Request, verb string) (*batchv1.CronJob, bool) {
+	ns, name := r.PathValue("ns"), r.PathValue("name")
+	if _, ok := h.authorize(w, r, cronJobAttrs(ns, verb, name)); !ok {
+		return nil, false
+	}
+	cached := false
+	if r.Method == http.MethodGet {
+		var ok bool
+		if cached, ok = fromCache(w, r, h.cronJobsInformer); !ok {
+			return nil, false
+		}
+	}
+	var cj *batchv1.CronJob
+	var err error
+	if cached {
+		if cj, err = h.cronJobs.CronJobs(ns).Get(name); err == nil {
+			cj = cj.DeepCopy()
+		}
+	} else {
+		cj, err = h.clientset.BatchV1().CronJobs(ns).Get(r.Context(), name, metav1.GetOptions{})
+	}
+	if err != nil {
+		h.fail(w, err)
+		return nil, false
+	}
+	if _, ok := cj.Labels[TemplateLabel]; !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return nil, false
+	}
+	if cj.Annotations == nil {
+		cj.Annotations = map[string]string{}
+	}
+	return cj, true
+}
+
+func (h *Handler) auditCronJob(msg string, cj *batchv1.CronJob, user string, fields ...zap.Field) {
+	h.logger.Info(msg, append([]zap.Field{
+		zap.String("audit", "jobs"),
+		zap.String("user", user),
+		zap.String("namespace", cj.Namespace),
+		zap.String("cronjob", cj.Name),
+		zap.String("template", cj.Labels[TemplateLabel]),
+		zap.String("schedule", cj.Spec.Schedule),
+		zap.Bool("suspended", ptr.Deref(cj.Spec.Suspend, false)),
+	}, fields...)...)
+}
+
+// failUpdate reports a lost optimistic-concurrency race as a conflict so
+// the caller can retry.
+func (h *Handler) failUpdate(w http.ResponseWriter, err error) {
+	if apierrors.IsConflict(err) {
+		http.Error(w, "cronjob was modified concurrently, retry", http.StatusConflict)
+		return
+	}
+	h.fail(w, err)
+}
+
+func cronJobAttrs(ns, verb, name string) authzv1.ResourceAttributes {
+	return authzv1.ResourceAttributes{
+		Namespace: ns,
+		Verb:      verb,
+		Group:     "batch",
+		Resource:  "cronjobs",
+		Name:      name,
+	}
+}
+
+// parseSchedule validates schedule the way the CronJob controller will,
+// returning the parsed schedule in tz.
+func parseSchedule(schedule, tz string) (cron.Schedule, error) {
+	if schedule == "" {
+		return nil, errors.New("schedule is required")
+	}
+	if strings.Contains(schedule, "TZ") {
+		return nil, errors.New("set time_zone instead of CRON_TZ or TZ in the schedule")
+	}
+	if tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil {
+			return nil, fmt.Errorf("unknown time zone %q", tz)
+		}
+		schedule = "CRON_TZ=" + tz + " " + schedule
+	}
+	sched, err := cron.ParseStandard(schedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule: %w", err)
+	}
+	return sched, nil
+}
+
+func toCronJobStatus(cj *batchv1.CronJob, now time.Time) CronJobStatus {
+	s := CronJobStatus{
+		Name:      cj.Name,
+		Namespace: cj.Namespace,
+		Template:  cj.Labels[TemplateLabel],
+		Schedule:  cj.Spec.Schedule,
+		TimeZone:  ptr.Deref(cj.Spec.TimeZone, ""),
+		Suspended: ptr.Deref(cj.Spec.Suspend, false),
+		ChangedBy: cj.Annotations[SubmittedByAnnotation],
+		Active:    len(cj.Status.Active),
+		Created:   cj.CreationTimestamp.Time,
+	}
+	if raw := cj.Annotations[ParamsAnnotation]; raw != "" {
+		_ = json.Unmarshal([]byte(raw), &s.Params)
+	}
+	if cj.Status.LastScheduleTime != nil {
+		s.LastScheduleTime = ptr.To(cj.Status.LastScheduleTime.Time)
+	}
+	if cj.Status.LastSuccessfulTime != nil {
+		s.LastSuccessfulTime = ptr.To(cj.Status.LastSuccessfulTime.Time)
+	}
+	if !s.Suspended {
+		if sched, err := parseSchedule(s.Schedule, s.TimeZone); err == nil {
+			s.NextRun = ptr.To(sched.Next(now))
+		}
+	}
+	return s
+}
@@ -0,0 +1,78 @@
+package jobs
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseScheduleValidation(t *testing.T) {
+	for _, tc := range []struct {
+		schedule, tz string
+		ok           bool
+	}{
+		{"*/15 * * * *", "", true},
+		{"@daily", "Europe/London", true},
+		{"0 3 * * *", "Mars/Olympus", false},
+		{"CRON_TZ=UTC 0 3 * * *", "", false},
+		{"61 * * * *", "", false},
+		{"", "", false},
+	} {
+		_, err := parseSchedule(tc.schedule, tc.tz)
+		if (err == nil) != tc.ok {
+			t.Errorf("schedule %q tz %q: expected ok=%v, got %v", tc.schedule, tc.tz, tc.ok, err)
+		}
+	}
+}
+
+func TestCronJobLifecycle(t *testing.T) {
+	mux, cs := newMux(t)
+	base := "/api/v1/namespaces/team-a/cronjobs"
+
+	rec := do(mux, http.MethodPost, base, `{"name":"nightly-migrate","template":"db-migrate","params":{"version":"7"},"schedule":"0 3 * * *"}`, "team-a")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	var s CronJobStatus
+	json.NewDecoder(rec.Body).Decode(&s)
+	if s.NextRun == nil || s.Params["version"] != "7" || s.ChangedBy != "alice" {
+		t.Errorf("expected next run, params and author, got %+v", s)
+	}
+
+	if rec := do(mux, http.MethodPost, base+"/nightly-migrate/suspend", "", "team-a"); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	cj, _ := cs.BatchV1().CronJobs("team-a").Get(t.Context(), "nightly-migrate", metav1.GetOptions{})
+	if !*cj.Spec.Suspend {
+		t.Error("expected cronjob to be suspended")
+	}
+
+	if rec := do(mux, http.MethodPost, base+"/nightly-migrate/trigger", "", "team-a"); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	jobs, _ := cs.BatchV1().Jobs("team-a").List(t.Context(), metav1.ListOptions{})
+	if len(jobs.Items) != 1 || jobs.Items[0].OwnerReferences[0].Name != "nightly-migrate" {
+		t.Fatalf("expected one job owned by the cronjob, got %+v", jobs.Items)
+	}
+	if jobs.Items[0].Spec.Template.Spec.Containers[0].Args[0] != "--target=7" {
+		t.Errorf("expected job to inherit rendered args, got %v", jobs.Items[0].Spec.Template.Spec.Containers[0].Args)
+	}
+}
+
+func TestCronJobRejectsInvalidInput(t *testing.T) {
+	mux, _ := newMux(t, &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "legacy", Namespace: "team-a"}})
+	base := "/api/v1/namespaces/team-a/cronjobs"
+
+	if rec := do(mux, http.MethodPost, base, `{"name":"x","template":"db-migrate","params":{"version":"7"},"schedule":"every day"}`, "team-a"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for bad schedule, got %d", rec.Code)
+	}
+	if rec := do(mux, http.MethodPost, base, `{"name":"Bad_Name","template":"db-migrate","params":{"version":"7"},"schedule":"@daily"}`, "team-a"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for bad name, got %d", rec.Code)
+	}
+	if rec := do(mux, http.MethodPost, base+"/legacy/trigger", "", "team-a"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unmanaged cronjob, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,584 @@
+// Package jobs lets teams run one-off and scheduled tasks as Kubernetes
+// Jobs and CronJobs without kubectl access. Both are built from a vetted
+// template library: callers pick a template and fill in its parameters,
+// while the image, resources and pod security settings stay fixed. Finished
+// Jobs are garbage-collected by the TTL-after-finished controller.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	authzv1 "k8s.io/api/authorization/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/kube"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+)
+
+const (
+	// TemplateLabel records which template a Job was built from.
+	TemplateLabel = "platform.io/job-template"
+	// SubmittedByAnnotation records the user who submitted the Job or last
+	// changed the CronJob.
+	SubmittedByAnnotation = "platform.io/submitted-by"
+	// ParamsAnnotation stores a CronJob's parameter values as JSON.
+	ParamsAnnotation = "platform.io/job-params"
+
+	jobNameLabel = "batch.kubernetes.io/job-name"
+)
+
+// templated selects the Jobs and CronJobs built from a template.
+var templated = func() labels.Selector {
+	req, _ := labels.NewRequirement(TemplateLabel, selection.Exists, nil)
+	return labels.NewSelector().Add(*req)
+}()
+
+var submissionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "job_submissions_total",
+	Help: "Templated Job submissions by template and result.",
+}, []string{"template", "result"})
+
+// Options configures the handler.
+type Options struct {
+	// Namespaces limits where Jobs can be run (empty = all).
+	Namespaces []string
+	// UserHeader and GroupsHeader carry the caller's identity, set by the
+	// authenticating proxy.
+	UserHeader   string
+	GroupsHeader string
+	// TTL is how long finished Jobs are kept when the template sets none.
+	TTL time.Duration
+}
+
+// Handler serves the Job submission API.
+type Handler struct {
+	clientset kubernetes.Interface
+	reviewer  *authz.Reviewer
+	headers   authz.Headers
+	templates map[string]*Template
+	bus       events.Publisher
+	opts      Options
+	allowed   map[string]bool
+	logger    *zap.Logger
+
+	// Without a factory, the listers and informers are nil and every read
+	// is live.
+	jobs             batchlisters.JobLister
+	jobsInformer     cache.SharedIndexInformer
+	cronJobs         batchlisters.CronJobLister
+	cronJobsInformer cache.SharedIndexInformer
+}
+
+// New creates a Job handler over templates. It registers the Job and
+// CronJob informers on factory, which must be started afterwards, for GET
+// requests to read from; factory may be nil, making every read live.
+func New(cs kubernetes.Interface, factory informers.SharedInformerFactory, templates []Template, bus events.Publisher, opts Options, logger *zap.Logger) *Handler {
+	h := &Handler{
+		clientset: cs,
+		reviewer:  authz.NewReviewer(cs),
+		headers:   authz.Headers{User: opts.UserHeader, Groups: opts.GroupsHeader},
+		templates: make(map[string]*Template, len(templates)),
+		bus:       bus,
+		opts:      opts,
+		logger:    logger,
+	}
+	for i := range templates {
+		h.templates[templates[i].Name] = &templates[i]
+	}
+	if factory != nil {
+		jobs, cronJobs := factory.Batch().V1().Jobs(), factory.Batch().V1().CronJobs()
+		h.jobs, h.jobsInformer = jobs.Lister(), jobs.Informer()
+		h.cronJobs, h.cronJobsInformer = cronJobs.Lister(), cronJobs.Informer()
+	}
+	if len(opts.Namespaces) > 0 {
+		h.allowed = make(map[string]bool, len(opts.Namespaces))
+		for _, ns := range opts.Namespaces {
+			h.allowed[ns] = true
+		}
+	}
+	return h
+}
+
+// Register mounts the handler on mux.
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/jobs/templates", h.listTemplates)
+	mux.HandleFunc("GET /api/v1/namespaces/{ns}/jobs", h.list)
+	mux.HandleFunc("POST /api/v1/namespaces/{ns}/jobs", h.submit)
+	mux.HandleFunc("GET /api/v1/namespaces/{ns}/jobs/{name}", h.get)
+	mux.HandleFunc("DELETE /api/v1/namespaces/{ns}/jobs/{name}", h.delete)
+	mux.HandleFunc("GET /api/v1/namespaces/{ns}/jobs/{name}/logs", h.logs)
+
+	mux.HandleFunc("GET /api/v1/namespaces/{ns}/cronjobs", h.listCronJobs)
+	mux.HandleFunc("POST /api/v1/namespaces/{ns}/cronjobs", h.createCronJob)
+	mux.HandleFunc("GET /api/v1/namespaces/{ns}/cronjobs/{name}", h.getCronJob)
+	mux.HandleFunc("PUT /api/v1/namespaces/{ns}/cronjobs/{name}", h.updateCronJob)
+	mux.HandleFunc("DELETE /api/v1/namespaces/{ns}/cronjobs/{name}", h.deleteCronJob)
+	mux.HandleFunc("POST /api/v1/namespaces/{ns}/cronjobs/{name}/suspend", h.suspendCronJob(true))
+	mux.HandleFunc("POST /api/v1/namespaces/{ns}/cronjobs/{name}/resume", h.suspendCronJob(false))
+	mux.HandleFunc("POST /api/v1/namespaces/{ns}/cronjobs/{name}/trigger", h.triggerCronJob)
+}
+
+// Status is the API view of a submitted Job.
+type Status struct {
+	Name           string     `json:"name"`
+	Namespace      string     `json:"namespace"`
+	Template       string     `json:"template"`
+	SubmittedBy    string     `json:"submitted_by,omitempty"`
+	Phase          string     `json:"phase"`
+	Active         int32      `json:"active"`
+	Succeeded      int32      `json:"succeeded"`
+	Failed         int32      `json:"failed"`
+	Created        time.Time  `json:"created"`
+	StartTime      *time.Time `json:"start_time,omitempty"`
+	CompletionTime *time.Time `json:"completion_time,omitempty"`
+	Message        string     `json:"message,omitempty"`
+}
+
+type submitRequest struct {
+	Template string            `json:"template"`
+	Params   map[string]string `json:"params"`
+}
+
+func (h *Handler) listTemplates(w http.ResponseWriter, r *http.Request) {
+	out := make([]*Template, 0, len(h.templates))
+	for _, t := range h.templates {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	writeJSON(w, http.StatusOK, map[string]any{"items": out})
+}
+
+func (h *Handler) submit(w http.ResponseWriter, r *http.Request) {
+	ns := r.PathValue("ns")
+
+	var req submitRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	tmpl, ok := h.templates[req.Template]
+	if !ok {
+		submissionsTotal.WithLabelValues("unknown", "bad_request").Inc()
+		http.Error(w, "unknown template", http.StatusBadRequest)
+		return
+	}
+	command, args, err := tmpl.render(req.Params)
+	if err != nil {
+		submissionsTotal.WithLabelValues(tmpl.Name, "bad_request").Inc()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, ok := h.authorize(w, r, authzv1.ResourceAttributes{
+		Namespace: ns,
+		Verb:      "create",
+		Group:     "batch",
+		Resource:  "jobs",
+	})
+	if !ok {
+		submissionsTotal.WithLabelValues(tmpl.Name, "forbidden").Inc()
+		return
+	}
+
+	job := h.buildJob(ns, tmpl, command, args, id.User)
+	created, err := h.clientset.BatchV1().Jobs(ns).Create(r.Context(), job, metav1.CreateOptions{})
+	if err != nil {
+		submissionsTotal.WithLabelValues(tmpl.Name, "error").Inc()
+		h.logger.Warn("job submission failed",
+			zap.String("namespace", ns),
+			zap.String("template", tmpl.Name),
+			zap.Error(err),
+		)
+		h.fail(w, err)
+		return
+	}
+	submissionsTotal.WithLabelValues(tmpl.Name, "ok").Inc()
+	h.logger.Info("job submitted",
+		zap.String("namespace", ns),
+		zap.String("job", created.Name),
+		zap.String("template", tmpl.Name),
+		zap.String("user", id.User),
+	)
+	h.publish(r.Context(), created, id.User)
+
+	writeJSON(w, http.StatusCreated, toStatus(created))
+}
+
+func (h *Handler) buildJob(ns string, tmpl *Template, command, args []string, user string) *batchv1.Job {
+	spec, labels := h.jobSpec(tmpl, command, args)
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: tmpl.Name + "-",
+			Namespace:    ns,
+			Labels:       labels,
+			Annotations:  map[string]string{SubmittedByAnnotation: user},
+		},
+		Spec: spec,
+	}
+}
+
+// jobSpec builds the restricted Job spec for tmpl, shared by one-off Jobs
+// and CronJobs.
+func (h *Handler) jobSpec(tmpl *Template, command, args []string) (batchv1.JobSpec, map[string]string) {
+	ttl := time.Duration(tmpl.TTL)
+	if ttl == 0 {
+		ttl = h.opts.TTL
+	}
+	labels := map[string]string{
+		TemplateLabel:                  tmpl.Name,
+		"app.kubernetes.io/managed-by": "platform-api",
+	}
+	return batchv1.JobSpec{
+		BackoffLimit:            ptr.To(tmpl.BackoffLimit),
+		ActiveDeadlineSeconds:   ptr.To(int64(time.Duration(tmpl.Timeout).Seconds())),
+		TTLSecondsAfterFinished: ptr.To(int32(ttl.Seconds())),
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: labels},
+			Spec: corev1.PodSpec{
+				RestartPolicy:      corev1.RestartPolicyNever,
+				ServiceAccountName: tmpl.ServiceAccount,
+				SecurityContext: &corev1.PodSecurityContext{
+					RunAsNonRoot:   ptr.To(true),
+					SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+				},
+				Containers: []corev1.Container{{
+					Name:      "job",
+					Image:     tmpl.Image,
+					Command:   command,
+					Args:      args,
+					Resources: tmpl.Resources,
+					SecurityContext: &corev1.SecurityContext{
+						AllowPrivilegeEscalation: ptr.To(false),
+						Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+					},
+				}},
+			},
+		},
+	}, labels
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	ns := r.PathValue("ns")
+	if _, ok := h.authorize(w, r, authzv1.ResourceAttributes{
+		Namespace: ns,
+		Verb:      "list",
+		Group:     "batch",
+		Resource:  "jobs",
+	}); !ok {
+		return
+	}
+	cached, ok := fromCache(w, r, h.jobsInformer)
+	if !ok {
+		return
+	}
+	var jobs []*batchv1.Job
+	var err error
+	if cached {
+		jobs, err = h.jobs.Jobs(ns).List(templated)
+	} else {
+		var list *batchv1.JobList
+		list, err = h.clientset.BatchV1().Jobs(ns).List(r.Context(), metav1.ListOptions{LabelSelector: TemplateLabel})
+		if err == nil {
+			for i := range list.Items {
+				jobs = append(jobs, &list.Items[i])
+			}
+		}
+	}
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	items := make([]Status, 0, len(jobs))
+	for _, job := range jobs {
+		items = append(items, toStatus(job))
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Created.After(items[j].Created) })
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.lookup(w, r, "get")
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, toStatus(job))
+}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.lookup(w, r, "delete")
+	if !ok {
+		return
+	}
+	err := h.clientset.BatchV1().Jobs(job.Namespace).Delete(r.Context(), job.Name, metav1.DeleteOptions{
+		PropagationPolicy: ptr.To(metav1.DeletePropagationBackground),
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		h.fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logs streams the output of the Job's most recent pod. ?follow=true keeps
+// the stream open until the container exits.
+func (h *Handler) logs(w http.ResponseWriter, r *http.Request) {
+	ns, name := r.PathValue("ns"), r.PathValue("name")
+	job, ok := h.lookup(w, r, "get")
+	if !ok {
+		return
+	}
+	pods, err := h.clientset.CoreV1().Pods(ns).List(r.Context(), metav1.ListOptions{
+		LabelSelector: jobNameLabel + "=" + name,
+	})
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	if len(pods.Items) == 0 {
+		http.Error(w, "job has no pods yet", http.StatusNotFound)
+		return
+	}
+	pod := latestPod(pods.Items)
+	if _, ok := h.authorize(w, r, authzv1.ResourceAttributes{
+		Namespace:   ns,
+		Verb:        "get",
+		Resource:    "pods",
+		Subresource: "log",
+		Name:        pod.Name,
+	}); !ok {
+		return
+	}
+
+	follow := r.URL.Query().Get("follow") == "true"
+	stream, err := h.clientset.CoreV1().Pods(ns).GetLogs(pod.Name, &corev1.PodLogOptions{
+		Container: "job",
+		Follow:    follow,
+	}).Stream(r.Context())
+	if err != nil {
+		h.logger.Warn("job log stream failed", zap.String("job", job.Name), zap.Error(err))
+		h.fail(w, err)
+		return
+	}
+	defer stream.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	rc := http.NewResponseController(w)
+	if follow {
+		_ = rc.SetWriteDeadline(time.Time{})
+	}
+	if _, err := io.Copy(flushWriter{w, rc}, stream); err != nil && !errors.Is(err, context.Canceled) {
+		h.logger.Debug("job log stream ended", zap.String("job", job.Name), zap.Error(err))
+	}
+}
+
+// lookup authorises verb on the named Job and fetches it, from the cache
+// for GET requests. Only Jobs created through this API are visible.
+func (h *Handler) lookup(w http.ResponseWriter, r *http.Request, verb string) (*batchv1.Job, bool) {
+	ns, name := r.PathValue("ns"), r.PathValue("name")
+	if _, ok := h.authorize(w, r, authzv1.ResourceAttributes{
+		Namespace: ns,
+		Verb:      verb,
+		Group:     "batch",
+		Resource:  "jobs",
+		Name:      name,
+	}); !ok {
+		return nil, false
+	}
+	cached := false
+	if r.Method == http.MethodGet {
+		var ok bool
+		if cached, ok = fromCache(w, r, h.jobsInformer); !ok {
+			return nil, false
+		}
+	}
+	var job *batchv1.Job
+	var err error
+	if cached {
+		job, err = h.jobs.Jobs(ns).Get(name)
+	} else {
+		job, err = h.clientset.BatchV1().Jobs(ns).Get(r.Context(), name, metav1.GetOptions{})
+	}
+	if err != nil {
+		h.fail(w, err)
+		return nil, false
+	}
+	if _, ok := job.Labels[TemplateLabel]; !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return nil, false
+	}
+	return job, true
+}
+
+// fromCache reports whether r may be read from informer's cache, which is
+// nil without a factory. An invalid ?freshness= gets a 400 and ok false.
+func fromCache(w http.ResponseWriter, r *http.Request, informer cache.SharedIndexInformer) (cached, ok bool) {
+	freshness, err := kube.ParseFreshness(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false, false
+	}
+	return informer != nil && freshness.Cached(informer), true
+}
+
+// authorize checks the namespace allow-list and asks the API server whether
+// the caller may perform attrs.
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request, attrs authzv1.ResourceAttributes) (authz.Identity, bool) {
+	id := h.headers.Identity(r)
+	if id.User == "" {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return id, false
+	}
+
+	audit := h.logger.With(
+		zap.String("audit", "jobs"),
+		zap.String("request_id", middleware.GetRequestID(r.Context())),
+		zap.String("user", id.User),
+		zap.Strings("groups", id.Groups),
+		zap.String("namespace", attrs.Namespace),
+		zap.String("verb", attrs.Verb),
+		zap.String("resource", attrs.Resource),
+		zap.String("name", attrs.Name),
+	)
+
+	if h.allowed != nil && !h.allowed[attrs.Namespace] {
+		audit.Warn("job access denied", zap.String("reason", "namespace not allowed"))
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return id, false
+	}
+	allowed, reason, err := h.reviewer.Allowed(r.Context(), id, attrs)
+	if err != nil {
+		audit.Error("job authorization failed", zap.Error(err))
+		http.Error(w, "authorization check failed", http.StatusBadGateway)
+		return id, false
+	}
+	if !allowed {
+		audit.Warn("job access denied", zap.String("reason", reason))
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return id, false
+	}
+	audit.Info("job access granted")
+	return id, true
+}
+
+func (h *Handler) publish(ctx context.Context, job *batchv1.Job, user string) {
+	e, err := events.New("job.submitted", "jobs", map[string]string{
+		"namespace": job.Namespace,
+		"job":       job.Name,
+		"template":  job.Labels[TemplateLabel],
+		"user":      user,
+	})
+	if err != nil {
+		return
+	}
+	if err := h.bus.Publish(ctx, e); err != nil {
+		h.logger.Warn("failed to publish job event", zap.Error(err))
+	}
+}
+
+func (h *Handler) fail(w http.ResponseWriter, err error) {
+	switch err = kube.Classify(err); {
+	case errors.Is(err, errs.NotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, errs.Forbidden):
+		http.Error(w, "forbidden", http.StatusForbidden)
+	case errors.Is(err, errs.Invalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errs.Unavailable):
+		h.logger.Warn("kubernetes API unavailable", zap.Error(err))
+		http.Error(w, "kubernetes API unavailable", http.StatusServiceUnavailable)
+	default:
+		h.logger.Error("kubernetes request failed", zap.Error(err))
+		http.Error(w, "kubernetes request failed", http.StatusBadGateway)
+	}
+}
+
+func toStatus(job *batchv1.Job) Status {
+	s := Status{
+		Name:        job.Name,
+		Namespace:   job.Namespace,
+		Template:    job.Labels[TemplateLabel],
+		SubmittedBy: job.Annotations[SubmittedByAnnotation],
+		Phase:       "Pending",
+		Active:      job.Status.Active,
+		Succeeded:   job.Status.Succeeded,
+		Failed:      job.Status.Failed,
+		Created:     job.CreationTimestamp.Time,
+	}
+	if job.Status.StartTime != nil {
+		s.StartTime = ptr.To(job.Status.StartTime.Time)
+	}
+	if job.Status.CompletionTime != nil {
+		s.CompletionTime = ptr.To(job.Status.CompletionTime.Time)
+	}
+	if job.Status.Active > 0 {
+		s.Phase = "Running"
+	}
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			s.Phase = "Succeeded"
+		case batchv1.JobFailed:
+			s.Phase = "Failed"
+			s.Message = c.Message
+		}
+	}
+	return s
+}
+
+func latestPod(pods []corev1.Pod) *corev1.Pod {
+	latest := &pods[0]
+	for i := range pods[1:] {
+		if pods[i+1].CreationTimestamp.After(latest.CreationTimestamp.Time) {
+			latest = &pods[i+1]
+		}
+	}
+	return latest
+}
+
+// flushWriter flushes after every write so followed logs reach the client
+// as they are produced.
+type flushWriter struct {
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	_ = f.rc.Flush()
+	return n, err
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
@@ -0,0 +1,237 @@
+package jobs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	authzv1 "k8s.io/api/authorization/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+)
+
+const templatesJSON = `[{
+	"name": "db-migrate",
+	"image": "registry.example.com/migrate:1.4",
+	"args": ["--target=${version}", "--dry-run=${dry_run}"],
+	"parameters": [
+		{"name": "version", "required": true, "pattern": "[0-9]+"},
+		{"name": "dry_run", "default": "false", "pattern": "true|false"}
+	],
+	"backoff_limit": 1,
+	"timeout": "10m"
+}]`
+
+func loadTemplates(t *testing.T) []Template {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "templates.json")
+	if err := os.WriteFile(path, []byte(templatesJSON), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	templates, err := LoadTemplates(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return templates
+}
+
+func newMux(t *testing.T, objs ...runtime.Object) (*http.ServeMux, *fake.Clientset) {
+	t.Helper()
+	return newCachedMux(t, nil, objs...)
+}
+
+// newCachedMux serves GET requests from informers over a clientset holding
+// cached, unless it is nil, and the rest from one holding objs.
+func newCachedMux(t *testing.T, cached []runtime.Object, objs ...runtime.Object) (*http.ServeMux, *fake.Clientset) {
+	t.Helper()
+	var factory informers.SharedInformerFactory
+	if cached != nil {
+		factory = informers.NewSharedInformerFactory(fake.NewClientset(cached...), 0)
+	}
+	// Members of team-a may do anything in team-a
+	cs := fake.NewClientset(objs...)
+	cs.PrependReactor("create", "subjectaccessreviews", func(a k8stesting.Action) (bool, runtime.Object, error) {
+		sar := a.(k8stesting.CreateAction).GetObject().(*authzv1.SubjectAccessReview)
+		for _, g := range sar.Spec.Groups {
+			if g == "team-a" && sar.Spec.ResourceAttributes.Namespace == "team-a" {
+				sar.Status.Allowed = true
+			}
+		}
+		return true, sar, nil
+	})
+
+	mux := http.NewServeMux()
+	New(cs, factory, loadTemplates(t), events.NewMemoryBus(), Options{
+		UserHeader:   "X-Forwarded-User",
+		GroupsHeader: "X-Forwarded-Groups",
+		TTL:          time.Hour,
+	}, zap.NewNop()).Register(mux)
+	if factory != nil {
+		t.Cleanup(factory.Shutdown)
+		factory.Start(t.Context().Done())
+		factory.WaitForCacheSync(t.Context().Done())
+	}
+	return mux, cs
+}
+
+func do(mux *http.ServeMux, method, path, body, groups string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-Forwarded-User", "alice")
+	req.Header.Set("X-Forwarded-Groups", groups)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLoadTemplatesRejectsUndeclaredParameter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "templates.json")
+	os.WriteFile(path, []byte(`[{"name":"x","image":"busybox","args":["${missing}"]}]`), 0o600)
+	if _, err := LoadTemplates(path); err == nil {
+		t.Error("expected error for undeclared parameter")
+	}
+}
+
+func TestRenderValidatesParameters(t *testing.T) {
+	tmpl := loadTemplates(t)[0]
+
+	_, args, err := tmpl.render(map[string]string{"version": "42"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if args[0] != "--target=42" || args[1] != "--dry-run=false" {
+		t.Errorf("expected rendered args with default, got %v", args)
+	}
+	if _, _, err := tmpl.render(map[string]string{}); err == nil {
+		t.Error("expected error for missing required parameter")
+	}
+	if _, _, err := tmpl.render(map[string]string{"version": "42; rm -rf /"}); err == nil {
+		t.Error("expected error for value not matching pattern")
+	}
+	if _, _, err := tmpl.render(map[string]string{"version": "42", "image": "evil"}); err == nil {
+		t.Error("expected error for unknown parameter")
+	}
+}
+
+func TestSubmitCreatesRestrictedJob(t *testing.T) {
+	mux, cs := newMux(t)
+
+	rec := do(mux, http.MethodPost, "/api/v1/namespaces/team-a/jobs", `{"template":"db-migrate","params":{"version":"7"}}`, "team-a")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+
+	jobs, _ := cs.BatchV1().Jobs("team-a").List(t.Context(), metav1.ListOptions{})
+	if len(jobs.Items) != 1 {
+		t.Fatalf("expected 1 job, got %d", len(jobs.Items))
+	}
+	job := jobs.Items[0]
+	if job.Labels[TemplateLabel] != "db-migrate" || job.Annotations[SubmittedByAnnotation] != "alice" {
+		t.Errorf("expected template label and submitter, got %v %v", job.Labels, job.Annotations)
+	}
+	if *job.Spec.TTLSecondsAfterFinished != 3600 {
+		t.Errorf("expected TTL 3600, got %d", *job.Spec.TTLSecondsAfterFinished)
+	}
+	if *job.Spec.ActiveDeadlineSeconds != 600 {
+		t.Errorf("expected deadline 600, got %d", *job.Spec.ActiveDeadlineSeconds)
+	}
+	pod := job.Spec.Template.Spec
+	if !*pod.SecurityContext.RunAsNonRoot || *pod.Containers[0].SecurityContext.AllowPrivilegeEscalation {
+		t.Error("expected restricted pod security settings")
+	}
+	if pod.Containers[0].Args[0] != "--target=7" {
+		t.Errorf("expected rendered args, got %v", pod.Containers[0].Args)
+	}
+}
+
+func TestSubmitRequiresAuthorization(t *testing.T) {
+	mux, _ := newMux(t)
+	body := `{"template":"db-migrate","params":{"version":"7"}}`
+
+	if rec := do(mux, http.MethodPost, "/api/v1/namespaces/team-b/jobs", body, "team-a"); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", rec.Code)
+	}
+	if rec := do(mux, http.MethodPost, "/api/v1/namespaces/team-a/jobs", `{"template":"shell"}`, "team-a"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown template, got %d", rec.Code)
+	}
+}
+
+func TestGetReportsPhaseAndHidesUnmanagedJobs(t *testing.T) {
+	mux, _ := newMux(t,
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "db-migrate-abc", Namespace: "team-a", Labels: map[string]string{TemplateLabel: "db-migrate"}},
+			Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "BackoffLimitExceeded"},
+			}},
+		},
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "cronjob-123", Namespace: "team-a"}},
+	)
+
+	rec := do(mux, http.MethodGet, "/api/v1/namespaces/team-a/jobs/db-migrate-abc", "", "team-a")
+	var s Status
+	json.NewDecoder(rec.Body).Decode(&s)
+	if s.Phase != "Failed" || s.Message != "BackoffLimitExceeded" {
+		t.Errorf("expected Failed phase, got %+v", s)
+	}
+	if rec := do(mux, http.MethodGet, "/api/v1/namespaces/team-a/jobs/cronjob-123", "", "team-a"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unmanaged job, got %d", rec.Code)
+	}
+}
+
+func TestListReadsCacheUnlessLive(t *testing.T) {
+	job := func(name string) *batchv1.Job {
+		return &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "team-a", Labels: map[string]string{TemplateLabel: "db-migrate"}}}
+	}
+	unmanaged := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "cronjob-123", Namespace: "team-a"}}
+	mux, _ := newCachedMux(t, []runtime.Object{job("a"), unmanaged}, job("a"), job("b"), unmanaged)
+
+	for path, want := range map[string]int{
+		"/api/v1/namespaces/team-a/jobs":                 1,
+		"/api/v1/namespaces/team-a/jobs?freshness=live":  2,
+		"/api/v1/namespaces/team-a/jobs?freshness=1h":    2, // the cache's age is not tracked
+		"/api/v1/namespaces/team-a/jobs?freshness=never": -1,
+	} {
+		rec := do(mux, http.MethodGet, path, "", "team-a")
+		if want < 0 {
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("GET %s = %d, want 400", path, rec.Code)
+			}
+			continue
+		}
+		var resp struct{ Items []Status }
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if len(resp.Items) != want {
+			t.Errorf("GET %s returned %d jobs, want %d", path, len(resp.Items), want)
+		}
+	}
+	if rec := do(mux, http.MethodGet, "/api/v1/namespaces/team-a/jobs/b", "", "team-a"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a job not in the cache yet, got %d", rec.Code)
+	}
+}
+
+func TestLogsStreamsLatestPod(t *testing.T) {
+	mux, _ := newMux(t,
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "db-migrate-abc", Namespace: "team-a", Labels: map[string]string{TemplateLabel: "db-migrate"}}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "db-migrate-abc-1", Namespace: "team-a", Labels: map[string]string{jobNameLabel: "db-migrate-abc"}}},
+	)
+
+	rec := do(mux, http.MethodGet, "/api/v1/namespaces/team-a/jobs/db-migrate-abc/logs", "", "team-a")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec.Body.Len() == 0 {
+		t.Error("expected log output")
+	}
+}
@@ -0,0 +1,172 @@
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Template is a vetted Job definition. Callers choose a template by name and
+// supply parameter values; they cannot change the image, resources or
+// security settings.
+type Template struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Image       string `json:"image"`
+	// Command and Args may reference parameters as ${name}.
+	Command    []string    `json:"command,omitempty"`
+	Args       []string    `json:"args,omitempty"`
+	Parameters []Parameter `json:"parameters,omitempty"`
+
+	Resources      corev1.ResourceRequirements `json:"resources"`
+	ServiceAccount string                      `json:"service_account,omitempty"`
+	// BackoffLimit is the number of retries before the Job is failed.
+	BackoffLimit int32 `json:"backoff_limit"`
+	// Timeout becomes the Job's activeDeadlineSeconds.
+	Timeout Duration `json:"timeout"`
+	// TTL overrides how long finished Jobs are kept (0 = handler default).
+	TTL Duration `json:"ttl"`
+}
+
+// Parameter is a caller-supplied value substituted into Command and Args.
+type Parameter struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Default     string `json:"default,omitempty"`
+	// Pattern is a regular expression the whole value must match.
+	Pattern string `json:"pattern,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// Duration is a time.Duration that marshals to and from strings like "5m".
+type Duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"5m\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+var (
+	paramRef  = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+	paramName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// LoadTemplates reads a JSON array of templates from path.
+func LoadTemplates(path string) ([]Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read job templates: %w", err)
+	}
+	var templates []Template
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return nil, fmt.Errorf("parse job templates: %w", err)
+	}
+	seen := make(map[string]bool, len(templates))
+	for i := range templates {
+		if err := templates[i].validate(); err != nil {
+			return nil, fmt.Errorf("template %d: %w", i, err)
+		}
+		if seen[templates[i].Name] {
+			return nil, fmt.Errorf("template %d: duplicate name %q", i, templates[i].Name)
+		}
+		seen[templates[i].Name] = true
+	}
+	return templates, nil
+}
+
+func (t *Template) validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if t.Image == "" {
+		return fmt.Errorf("template %s has no image", t.Name)
+	}
+	if t.BackoffLimit < 0 {
+		return fmt.Errorf("template %s: backoff_limit must not be negative", t.Name)
+	}
+	declared := make(map[string]bool, len(t.Parameters))
+	for i := range t.Parameters {
+		p := &t.Parameters[i]
+		if !paramName.MatchString(p.Name) {
+			return fmt.Errorf("template %s: invalid parameter name %q", t.Name, p.Name)
+		}
+		if p.Pattern != "" {
+			re, err := regexp.Compile("^(?:" + p.Pattern + ")$")
+			if err != nil {
+				return fmt.Errorf("template %s: parameter %s: %w", t.Name, p.Name, err)
+			}
+			p.re = re
+		}
+		declared[p.Name] = true
+	}
+	for _, s := range append(append([]string{}, t.Command...), t.Args...) {
+		for _, m := range paramRef.FindAllStringSubmatch(s, -1) {
+			if !declared[m[1]] {
+				return fmt.Errorf("template %s references undeclared parameter %s", t.Name, m[1])
+			}
+		}
+	}
+	if t.Timeout == 0 {
+		t.Timeout = Duration(time.Hour)
+	}
+	return nil
+}
+
+// render substitutes params into the template's command and args. Unknown
+// parameters, missing required ones and values not matching their pattern
+// are rejected.
+func (t *Template) render(params map[string]string) (command, args []string, err error) {
+	values := make(map[string]string, len(t.Parameters))
+	for _, p := range t.Parameters {
+		v, ok := params[p.Name]
+		if !ok {
+			if p.Required {
+				return nil, nil, fmt.Errorf("parameter %s is required", p.Name)
+			}
+			v = p.Default
+		}
+		if p.re != nil && !p.re.MatchString(v) {
+			return nil, nil, fmt.Errorf("parameter %s does not match %s", p.Name, p.Pattern)
+		}
+		values[p.Name] = v
+	}
+	for name := range params {
+		if _, ok := values[name]; !ok {
+			return nil, nil, fmt.Errorf("unknown parameter %s", name)
+		}
+	}
+	expand := func(in []string) []string {
+		if in == nil {
+			return nil
+		}
+		out := make([]string, len(in))
+		for i, s := range in {
+			out[i] = paramRef.ReplaceAllStringFunc(s, func(ref string) string {
+				return values[strings.TrimSuffix(strings.TrimPrefix(ref, "${"), "}")]
+			})
+		}
+		return out
+	}
+	return expand(t.Command), expand(t.Args), nil
+}
@@ -0,0 +1,467 @@
+// Package jwks verifies JSON Web Tokens against an issuer's published JSON
+// Web Key Set. The key set is cached: lookups are served from memory and a
+// set older than the refresh interval is refetched in the background, so
+// callers never wait on the issuer for a known key. A token signed with an
+// unknown key ID triggers a refetch at once, which is how newly rotated
+// keys are picked up, and keys the issuer has dropped stay usable for a
+// grace period, so that tokens they signed shortly before rotation still
+// verify. When the issuer cannot be reached, the last set keeps being
+// served for up to MaxStale.
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+)
+
+var (
+	// ErrUnknownKey is returned for tokens signed with a key the set does
+	// not hold, even after a refetch.
+	ErrUnknownKey = errs.New(errs.Unauthorized, "jwks: unknown signing key")
+	// ErrInvalidToken is returned for malformed tokens and bad signatures.
+	ErrInvalidToken = errs.New(errs.Unauthorized, "jwks: invalid token")
+)
+
+var (
+	refreshesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jwks_refreshes_total",
+		Help: "Key set fetches by key set and result (ok or error).",
+	}, []string{"jwks", "result"})
+	lookupsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jwks_lookups_total",
+		Help: "Signing key lookups by key set and result (hit, grace, refreshed or miss).",
+	}, []string{"jwks", "result"})
+	keysGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "jwks_keys",
+		Help: "Cached signing keys by key set and state (current or grace).",
+	}, []string{"jwks", "state"})
+	lastRefresh = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "jwks_last_refresh_timestamp_seconds",
+		Help: "Time of the last successful key set fetch by key set.",
+	}, []string{"jwks"})
+)
+
+// Options configures a Cache.
+type Options struct {
+	// RefreshInterval is how old the set may get before a lookup refetches
+	// it in the background (default 15m).
+	RefreshInterval time.Duration
+	// MinRefreshInterval limits refetches for unknown key IDs, so that
+	// tokens with made-up key IDs cannot flood the issuer (default 30s).
+	MinRefreshInterval time.Duration
+	// Grace is how long keys dropped from the set stay usable (default 1h).
+	Grace time.Duration
+	// MaxStale is how long the last set is served while the issuer cannot
+	// be reached (default 24h).
+	MaxStale time.Duration
+}
+
+// key is a cached verification key.
+type key struct {
+	public crypto.PublicKey
+	// alg, when the JWK names one, is the only algorithm accepted.
+	alg string
+	// dropped is when the key left the set, zero while it is current.
+	dropped time.Time
+}
+
+// Cache holds an issuer's key set.
+type Cache struct {
+	name     string
+	endpoint func(context.Context) (string, error)
+	http     *http.Client
+	opts     Options
+	logger   *zap.Logger
+	now      func() time.Time
+
+	// fetch serializes fetches; mu guards the fields below it.
+	fetch      sync.Mutex
+	mu         sync.RWMutex
+	keys       map[string]*key
+	fetched    time.Time
+	attempted  time.Time
+	refreshing bool
+}
+
+// New creates a cache for the key set named name in metrics. endpoint
+// returns the set's URL, such as an OpenID provider's jwks_uri.
+func New(name string, endpoint func(context.Context) (string, error), hc *http.Client, opts Options, logger *zap.Logger) *Cache {
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = 15 * time.Minute
+	}
+	if opts.MinRefreshInterval <= 0 {
+		opts.MinRefreshInterval = 30 * time.Second
+	}
+	if opts.Grace <= 0 {
+		opts.Grace = time.Hour
+	}
+	if opts.MaxStale < opts.RefreshInterval {
+		opts.MaxStale = max(24*time.Hour, opts.RefreshInterval)
+	}
+	return &Cache{
+		name:     name,
+		endpoint: endpoint,
+		http:     hc,
+		opts:     opts,
+		logger:   logger,
+		now:      time.Now,
+		keys:     make(map[string]*key),
+	}
+}
+
+// Check reports whether a usable key set is held, fetching it the first
+// time, for the readiness probe.
+func (c *Cache) Check(ctx context.Context) error {
+	c.mu.RLock()
+	fetched, attempted := c.fetched, c.attempted
+	c.mu.RUnlock()
+	if fetched.IsZero() {
+		if err := c.refresh(ctx, attempted); err != nil {
+			return err
+		}
+		c.mu.RLock()
+		fetched = c.fetched
+		c.mu.RUnlock()
+		if fetched.IsZero() {
+			return errors.New("jwks: no key set fetched yet")
+		}
+	}
+	if age := c.now().Sub(fetched); age > c.opts.MaxStale {
+		return fmt.Errorf("jwks: key set not refreshed for %s", age.Round(time.Second))
+	}
+	return nil
+}
+
+// lookup returns the key kid, or nil. It starts a background refresh when
+// the set is due.
+func (c *Cache) lookup(kid string) (*key, string) {
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.fetched.IsZero() && now.Sub(c.fetched) >= c.opts.RefreshInterval && !c.refreshing &&
+		now.Sub(c.attempted) >= c.opts.MinRefreshInterval {
+		c.refreshing = true
+		since := c.attempted
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := c.refresh(ctx, since); err != nil {
+				c.logger.Warn("failed to refresh key set", zap.String("jwks", c.name), zap.Error(err))
+			}
+			c.mu.Lock()
+			c.refreshing = false
+			c.mu.Unlock()
+		}()
+	}
+	if !c.fetched.IsZero() && now.Sub(c.fetched) > c.opts.MaxStale {
+		return nil, "miss"
+	}
+	if kid == "" && len(c.keys) == 1 {
+		// Issuers with a single key may leave kid out
+		for id := range c.keys {
+			kid = id
+		}
+	}
+	k, ok := c.keys[kid]
+	switch {
+	case !ok:
+		return nil, "miss"
+	case k.dropped.IsZero():
+		return k, "hit"
+	case now.Sub(k.dropped) < c.opts.Grace:
+		return k, "grace"
+	default:
+		return nil, "miss"
+	}
+}
+
+// key returns the verification key kid, refetching the set when it does
+// not hold it.
+func (c *Cache) key(ctx context.Context, kid string) (*key, error) {
+	k, result := c.lookup(kid)
+	if k == nil {
+		c.mu.RLock()
+		since := c.attempted
+		c.mu.RUnlock()
+		if c.now().Sub(since) >= c.opts.MinRefreshInterval {
+			if err := c.refresh(ctx, since); err != nil {
+				c.logger.Warn("failed to refresh key set", zap.String("jwks", c.name), zap.Error(err))
+			}
+			if k, _ = c.lookup(kid); k != nil {
+				result = "refreshed"
+			}
+		}
+	}
+	lookupsTotal.WithLabelValues(c.name, result).Inc()
+	if k == nil {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, kid)
+	}
+	return k, nil
+}
+
+// refresh fetches the set, unless another fetch was attempted after since,
+// the last attempt the caller saw.
+func (c *Cache) refresh(ctx context.Context, since time.Time) error {
+	c.fetch.Lock()
+	defer c.fetch.Unlock()
+	c.mu.Lock()
+	if c.attempted.After(since) {
+		c.mu.Unlock()
+		return nil
+	}
+	c.attempted = c.now()
+	c.mu.Unlock()
+
+	set, err := c.get(ctx)
+	if err != nil {
+		refreshesTotal.WithLabelValues(c.name, "error").Inc()
+		return err
+	}
+	refreshesTotal.WithLabelValues(c.name, "ok").Inc()
+
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for kid, k := range c.keys {
+		if _, ok := set[kid]; ok {
+			continue
+		}
+		switch {
+		case k.dropped.IsZero():
+			k.dropped = now
+		case now.Sub(k.dropped) >= c.opts.Grace:
+			delete(c.keys, kid)
+		}
+	}
+	for kid, k := range set {
+		c.keys[kid] = k
+	}
+	c.fetched = now
+	keysGauge.WithLabelValues(c.name, "current").Set(float64(len(set)))
+	keysGauge.WithLabelValues(c.name, "grace").Set(float64(len(c.keys) - len(set)))
+	lastRefresh.WithLabelValues(c.name).Set(float64(now.Unix()))
+	return nil
+}
+
+// jwk is a JSON Web Key (RFC 7517) of the kinds used for signing.
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// get fetches and parses the set. Keys that are not signing keys, or not
+// of a supported type, are left out.
+func (c *Cache) get(ctx context.Context) (map[string]*key, error) {
+	url, err := c.endpoint(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks: fetching %s: status %d", url, resp.StatusCode)
+	}
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("jwks: decoding %s: %w", url, err)
+	}
+	set := make(map[string]*key, len(doc.Keys))
+	for _, j := range doc.Keys {
+		if j.Use != "" && j.Use != "sig" {
+			continue
+		}
+		public, err := j.publicKey()
+		if err != nil {
+			c.logger.Debug("skipping key", zap.String("jwks", c.name), zap.String("kid", j.Kid), zap.Error(err))
+			continue
+		}
+		set[j.Kid] = &key{public: public, alg: j.Alg}
+	}
+	if len(set) == 0 {
+		return nil, fmt.Errorf("jwks: %s holds no usable signing keys", url)
+	}
+	return set, nil
+}
+
+func (j *jwk) publicKey() (crypto.PublicKey, error) {
+	field := func(s string) ([]byte, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("invalid %s key parameter", j.Kty)
+		}
+		return b, nil
+	}
+	switch j.Kty {
+	case "RSA":
+		n, err := field(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := field(j.E)
+		if err != nil || len(e) > 4 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		curve := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}[j.Crv]
+		if curve == nil {
+			return nil, fmt.Errorf("unsupported curve %q", j.Crv)
+		}
+		x, err := field(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := field(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, errors.New("invalid EC point")
+		}
+		// ecdsa.ParseUncompressedPublicKey checks the point is on the curve
+		return ecdsa.ParseUncompressedPublicKey(curve, append(append([]byte{4}, x...), y...))
+	case "OKP":
+		x, err := field(j.X)
+		if err != nil || j.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("unsupported OKP key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", j.Kty)
+	}
+}
+
+// Verify checks the signature of a compact JWS, such as a JWT, against the
+// key set and returns its payload. It does not look at the claims.
+func (c *Cache) Verify(ctx context.Context, token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+	payload, err1 := base64.RawURLEncoding.DecodeString(parts[1])
+	sig, err2 := base64.RawURLEncoding.DecodeString(parts[2])
+	if err1 != nil || err2 != nil {
+		return nil, ErrInvalidToken
+	}
+	k, err := c.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if k.alg != "" && k.alg != header.Alg {
+		return nil, fmt.Errorf("%w: key %q is for %s, not %s", ErrInvalidToken, header.Kid, k.alg, header.Alg)
+	}
+	if err := verify(header.Alg, k.public, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return payload, nil
+}
+
+// verify checks sig over signed with the JWS algorithm alg. "none" and
+// HMAC algorithms are refused.
+func verify(alg string, public crypto.PublicKey, signed, sig []byte) error {
+	digest := func(h crypto.Hash) []byte {
+		var w hash.Hash
+		switch h {
+		case crypto.SHA384:
+			w = sha512.New384()
+		case crypto.SHA512:
+			w = sha512.New()
+		default:
+			w = sha256.New()
+		}
+		w.Write(signed)
+		return w.Sum(nil)
+	}
+	hashes := map[string]crypto.Hash{"256": crypto.SHA256, "384": crypto.SHA384, "512": crypto.SHA512}
+	family, bits := alg[:min(2, len(alg))], alg[min(2, len(alg)):]
+	h, ok := hashes[bits]
+	switch {
+	case alg == "EdDSA":
+		pub, ok := public.(ed25519.PublicKey)
+		if !ok || !ed25519.Verify(pub, signed, sig) {
+			return errors.New("bad signature")
+		}
+		return nil
+	case !ok:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	case family == "RS", family == "PS":
+		pub, ok := public.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key does not fit %s", alg)
+		}
+		if family == "PS" {
+			return rsa.VerifyPSS(pub, h, digest(h), sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+		return rsa.VerifyPKCS1v15(pub, h, digest(h), sig)
+	case family == "ES":
+		pub, ok := public.(*ecdsa.PublicKey)
+		curve := map[string]elliptic.Curve{"256": elliptic.P256(), "384": elliptic.P384(), "512": elliptic.P521()}[bits]
+		if !ok || pub.Curve != curve {
+			return fmt.Errorf("key does not fit %s", alg)
+		}
+		// JWS ECDSA signatures are r and s, each padded to the curve size
+		size := (curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return fmt.Errorf("key does not fit %s", alg)
+		}
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest(h), r, s) {
+			return errors.New("bad signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+}
@@ -0,0 +1,155 @@
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var b64 = base64.RawURLEncoding.EncodeToString
+
+// issuer serves a key set that tests can change or take down.
+type issuer struct {
+	mu      sync.Mutex
+	keys    string
+	down    bool
+	fetches int
+}
+
+func (i *issuer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.fetches++
+	if i.down {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintf(w, `{"keys":[%s]}`, i.keys)
+}
+
+func (i *issuer) set(keys string, down bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.keys, i.down = keys, down
+}
+
+func TestKeyRotation(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	old := fmt.Sprintf(`{"kty":"RSA","kid":"old","use":"sig","alg":"RS256","n":%q,"e":%q}`,
+		b64(rsaKey.N.Bytes()), b64(big.NewInt(int64(rsaKey.E)).Bytes()))
+	ecPoint, _ := ecKey.PublicKey.Bytes()
+	current := fmt.Sprintf(`{"kty":"EC","kid":"new","crv":"P-256","x":%q,"y":%q}`,
+		b64(ecPoint[1:33]), b64(ecPoint[33:]))
+	encryption := `{"kty":"RSA","kid":"enc","use":"enc","n":"AQAB","e":"AQAB"}`
+
+	sign := func(kid, alg string) string {
+		signed := b64(fmt.Appendf(nil, `{"alg":%q,"kid":%q}`, alg, kid)) + "." + b64([]byte(`{"sub":"alice"}`))
+		digest := sha256.Sum256([]byte(signed))
+		var sig []byte
+		if alg == "RS256" {
+			sig, _ = rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+		} else {
+			r, s, _ := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+			sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+		return signed + "." + b64(sig)
+	}
+
+	iss := &issuer{}
+	iss.set(old+","+encryption, false)
+	srv := httptest.NewServer(iss)
+	defer srv.Close()
+	var clock atomic.Int64
+	clock.Store(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC).UnixNano())
+	advance := func(d time.Duration) { clock.Add(int64(d)) }
+	c := New("test", func(context.Context) (string, error) { return srv.URL, nil }, srv.Client(), Options{
+		RefreshInterval: 10 * time.Minute,
+		Grace:           time.Hour,
+		MaxStale:        2 * time.Hour,
+	}, zap.NewNop())
+	c.now = func() time.Time { return time.Unix(0, clock.Load()) }
+	ctx := t.Context()
+	verify := func(token string) error {
+		payload, err := c.Verify(ctx, token)
+		if err == nil && string(payload) != `{"sub":"alice"}` {
+			t.Fatalf("payload = %s", payload)
+		}
+		return err
+	}
+
+	if err := c.Check(ctx); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if err := verify(sign("old", "RS256")); err != nil {
+		t.Fatalf("old key: %v", err)
+	}
+	parts := strings.Split(sign("old", "RS256"), ".")
+	if err := verify(parts[0] + "." + b64([]byte(`{"sub":"mallory"}`)) + "." + parts[2]); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("tampered token: %v", err)
+	}
+	if err := verify(b64([]byte(`{"alg":"none","kid":"old"}`)) + "." + b64([]byte(`{}`)) + "."); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("unsigned token: %v", err)
+	}
+	if err := verify(sign("enc", "RS256")); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("encryption key used for a signature: %v", err)
+	}
+
+	// The issuer rotates: the new key is fetched when a token needs it, and
+	// the old one stays usable for the grace period
+	iss.set(current, false)
+	advance(time.Minute)
+	if err := verify(sign("new", "ES256")); err != nil {
+		t.Fatalf("rotated key: %v", err)
+	}
+	if err := verify(sign("old", "RS256")); err != nil {
+		t.Errorf("old key within the grace period: %v", err)
+	}
+	advance(time.Hour)
+	if err := verify(sign("old", "RS256")); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("old key after the grace period: %v", err)
+	}
+
+	// While the issuer is down, the last set is served until it is too old
+	iss.set(current, true)
+	advance(30 * time.Minute)
+	if err := verify(sign("new", "ES256")); err != nil {
+		t.Errorf("issuer unavailable: %v", err)
+	}
+	if err := c.Check(ctx); err != nil {
+		t.Errorf("Check with a recent set: %v", err)
+	}
+	advance(3 * time.Hour)
+	if err := c.Check(ctx); err == nil {
+		t.Error("expected Check to fail once the set is too old")
+	}
+	iss.mu.Lock()
+	fetches := iss.fetches
+	iss.mu.Unlock()
+	if fetches > 6 {
+		t.Errorf("issuer fetched %d times", fetches)
+	}
+}
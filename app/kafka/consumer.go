@@ -0,0 +1,146 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+)
+
+// ConsumerOptions configures a Consumer.
+type ConsumerOptions struct {
+	Group  string
+	Topics []string
+	// Instance names this member of the group in broker logs.
+	Instance string
+	// Producer is this instance's producer name; events it produced are
+	// skipped, as they were already published locally.
+	Producer string
+	// PollTimeout is how long one fetch waits for records.
+	PollTimeout time.Duration
+}
+
+// Consumer joins a consumer group and publishes the events it receives on
+// the local bus, marked with events.WithRemote. Offsets are committed
+// after each fetched batch is published.
+type Consumer struct {
+	client *kgo.Client
+	bus    events.Publisher
+	opts   ConsumerOptions
+	logger *zap.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewConsumer creates a consumer connecting to the brokers in conn; Start
+// begins consuming. A group new to a topic starts at its end.
+func NewConsumer(conn Options, bus events.Publisher, opts ConsumerOptions, logger *zap.Logger) (*Consumer, error) {
+	if opts.PollTimeout <= 0 {
+		opts.PollTimeout = 5 * time.Second
+	}
+	kopts, err := conn.clientOptions()
+	if err != nil {
+		return nil, err
+	}
+	client, err := kgo.NewClient(append(kopts,
+		kgo.ClientID(opts.Instance),
+		kgo.ConsumerGroup(opts.Group),
+		kgo.ConsumeTopics(opts.Topics...),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtEnd()),
+		kgo.DisableAutoCommit(),
+		kgo.FetchMaxWait(opts.PollTimeout),
+	)...)
+	if err != nil {
+		return nil, fmt.Errorf("create kafka consumer: %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Consumer{client: client, bus: bus, opts: opts, logger: logger, ctx: ctx, cancel: cancel}, nil
+}
+
+// Start consumes in the background until Shutdown.
+func (c *Consumer) Start() {
+	c.wg.Add(1)
+	go c.run()
+}
+
+// Shutdown stops consuming, waits for the batch in hand or ctx to expire,
+// and leaves the group.
+func (c *Consumer) Shutdown(ctx context.Context) error {
+	c.cancel()
+	defer c.client.Close()
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run polls until Shutdown. The client rejoins the group and retries
+// brokers itself; errors are only logged.
+func (c *Consumer) run() {
+	defer c.wg.Done()
+	c.logger.Info("kafka consumer joining group",
+		zap.String("group", c.opts.Group),
+		zap.Strings("topics", c.opts.Topics),
+	)
+	for {
+		fetches := c.client.PollFetches(c.ctx)
+		if c.ctx.Err() != nil || fetches.IsClientClosed() {
+			return
+		}
+		fetches.EachError(func(topic string, partition int32, err error) {
+			c.logger.Warn("kafka fetch failed",
+				zap.String("topic", topic),
+				zap.Int32("partition", partition),
+				zap.Error(err),
+			)
+		})
+		if fetches.NumRecords() == 0 {
+			continue
+		}
+		ctx := events.WithRemote(c.ctx)
+		fetches.EachRecord(func(r *kgo.Record) {
+			consumedTotal.WithLabelValues(r.Topic, c.handle(ctx, r.Value)).Inc()
+		})
+		// Committed even when Shutdown began meanwhile, as the batch is published
+		commitCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := c.client.CommitUncommittedOffsets(commitCtx); err != nil {
+			c.logger.Warn("failed to commit kafka offsets", zap.String("group", c.opts.Group), zap.Error(err))
+		}
+		cancel()
+	}
+}
+
+// handle publishes an event envelope and returns the result for metrics.
+func (c *Consumer) handle(ctx context.Context, value []byte) string {
+	var env Envelope
+	if json.Unmarshal(value, &env) != nil {
+		return "invalid"
+	}
+	if env.Schema != SchemaEvent || env.Producer == c.opts.Producer {
+		return "skipped"
+	}
+	var e events.Event
+	if env.Version > SchemaVersion || json.Unmarshal(env.Payload, &e) != nil || e.Type == "" {
+		return "invalid"
+	}
+	if err := c.bus.Publish(ctx, e); err != nil {
+		c.logger.Warn("failed to publish consumed event", zap.String("type", e.Type), zap.Error(err))
+		return "error"
+	}
+	return "published"
+}
@@ -0,0 +1,145 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+// maxAttempts bounds the tries to produce one message before it is
+// counted as failed.
+const maxAttempts = 3
+
+// ProducerOptions configures a Producer.
+type ProducerOptions struct {
+	// EventsTopic receives bus events and AuditTopic audit records; an
+	// empty topic turns that stream off.
+	EventsTopic string
+	AuditTopic  string
+	// BatchTimeout is how long a message may wait for others to share its
+	// produce request.
+	BatchTimeout time.Duration
+	// BufferSize is how many messages may wait to be sent; further
+	// messages are dropped rather than blocking the caller.
+	BufferSize int
+	// Producer identifies this instance in the envelopes.
+	Producer string
+}
+
+// Producer sends messages to Kafka in batches from the client's
+// background loop. Delivery is at least once.
+type Producer struct {
+	client   *kgo.Client
+	opts     ProducerOptions
+	logger   *zap.Logger
+	stopping atomic.Bool
+}
+
+// NewProducer creates a producer connecting to the brokers in conn.
+func NewProducer(conn Options, opts ProducerOptions, logger *zap.Logger) (*Producer, error) {
+	if opts.BatchTimeout <= 0 {
+		opts.BatchTimeout = time.Second
+	}
+	kopts, err := conn.clientOptions()
+	if err != nil {
+		return nil, err
+	}
+	client, err := kgo.NewClient(append(kopts,
+		kgo.ClientID(opts.Producer),
+		kgo.ProducerLinger(opts.BatchTimeout),
+		kgo.MaxBufferedRecords(max(opts.BufferSize, 1)),
+		kgo.RecordRetries(maxAttempts),
+	)...)
+	if err != nil {
+		return nil, fmt.Errorf("create kafka producer: %w", err)
+	}
+	return &Producer{client: client, opts: opts, logger: logger}, nil
+}
+
+// HandleEvent queues a bus event for EventsTopic, keyed by its source so
+// one source's events stay in order. Subscribe it to the bus. Events from
+// other instances (see events.WithRemote) are not produced again.
+func (p *Producer) HandleEvent(ctx context.Context, e events.Event) {
+	if p.opts.EventsTopic == "" || events.IsRemote(ctx) {
+		return
+	}
+	p.enqueue(p.opts.EventsTopic, e.Source, SchemaEvent, e)
+}
+
+// AuditRepository wraps inner so recorded audit events are also queued for
+// AuditTopic, keyed by resource.
+func (p *Producer) AuditRepository(inner store.AuditRepository) store.AuditRepository {
+	if p.opts.AuditTopic == "" {
+		return inner
+	}
+	return &auditRepository{AuditRepository: inner, producer: p}
+}
+
+type auditRepository struct {
+	store.AuditRepository
+	producer *Producer
+}
+
+func (r *auditRepository) Record(ctx context.Context, e *store.AuditEvent) error {
+	if err := r.AuditRepository.Record(ctx, e); err != nil {
+		return err
+	}
+	r.producer.enqueue(r.producer.opts.AuditTopic, e.Resource, SchemaAudit, e)
+	return nil
+}
+
+func (p *Producer) enqueue(topic, key, schema string, payload any) {
+	if p.stopping.Load() {
+		messagesTotal.WithLabelValues(topic, "dropped").Inc()
+		return
+	}
+	data, err := json.Marshal(payload)
+	if err == nil {
+		data, err = json.Marshal(Envelope{
+			Schema:   schema,
+			Version:  SchemaVersion,
+			Producer: p.opts.Producer,
+			Payload:  data,
+		})
+	}
+	if err != nil {
+		p.logger.Warn("failed to encode kafka message", zap.String("topic", topic), zap.Error(err))
+		return
+	}
+
+	start := time.Now()
+	record := &kgo.Record{Topic: topic, Key: []byte(key), Value: data}
+	p.client.TryProduce(context.Background(), record, func(_ *kgo.Record, err error) {
+		switch {
+		case errors.Is(err, kgo.ErrMaxBuffered):
+			messagesTotal.WithLabelValues(topic, "dropped").Inc()
+			return
+		case err != nil:
+			messagesTotal.WithLabelValues(topic, "failed").Inc()
+			produceDuration.WithLabelValues(topic, "error").Observe(time.Since(start).Seconds())
+			p.logger.Warn("failed to produce to kafka", zap.String("topic", topic), zap.Error(err))
+			return
+		}
+		messagesTotal.WithLabelValues(topic, "delivered").Inc()
+		produceDuration.WithLabelValues(topic, "success").Observe(time.Since(start).Seconds())
+	})
+}
+
+// Shutdown stops accepting messages and sends those queued, waiting for
+// them or ctx to expire, then closes the client.
+func (p *Producer) Shutdown(ctx context.Context) error {
+	if p.stopping.Swap(true) {
+		return nil
+	}
+	defer p.client.Close()
+	return p.client.Flush(ctx)
+}
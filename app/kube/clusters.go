@@ -0,0 +1,114 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Cluster secret keys. A cluster secret holds a kubeconfig for the cluster
+// under ClusterKubeconfigKey; ClusterNameKey, if present, overrides the
+// cluster name, which defaults to the secret's name.
+const (
+	ClusterKubeconfigKey = "kubeconfig"
+	ClusterNameKey       = "name"
+)
+
+// Clusters is the set of clusters the service talks to: the local one,
+// whose client the rest of the service uses, and remote ones added at
+// startup.
+type Clusters struct {
+	local   string
+	clients map[string]*Client
+}
+
+// NewClusters creates a set holding the local cluster under name.
+func NewClusters(name string, local *Client) *Clusters {
+	local.cluster = name
+	return &Clusters{local: name, clients: map[string]*Client{name: local}}
+}
+
+// Add adds a remote cluster. Names must be unique.
+func (cs *Clusters) Add(name string, c *Client) error {
+	if name == "" {
+		return fmt.Errorf("kube: cluster name is empty")
+	}
+	if _, ok := cs.clients[name]; ok {
+		return fmt.Errorf("kube: duplicate cluster %q", name)
+	}
+	c.cluster = name
+	cs.clients[name] = c
+	return nil
+}
+
+// AddContexts adds one cluster per kubeconfig context, named after it.
+// opts.Kubeconfig selects the kubeconfig as for New.
+func (cs *Clusters) AddContexts(contexts []string, opts Options, logger *zap.Logger) error {
+	for _, name := range contexts {
+		o := opts
+		o.Context = name
+		c, err := New(o, logger.With(zap.String("cluster", name)))
+		if err != nil {
+			return err
+		}
+		if err := cs.Add(name, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddSecrets adds one cluster per Secret in namespace matching selector,
+// read once through the local cluster. The service account needs list on
+// secrets in that namespace.
+func (cs *Clusters) AddSecrets(ctx context.Context, namespace, selector string, opts Options, logger *zap.Logger) error {
+	secrets, err := cs.clients[cs.local].Clientset.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("kube: list cluster secrets: %w", err)
+	}
+	for _, s := range secrets.Items {
+		kubeconfig, ok := s.Data[ClusterKubeconfigKey]
+		if !ok {
+			return fmt.Errorf("kube: cluster secret %s/%s has no %q key", s.Namespace, s.Name, ClusterKubeconfigKey)
+		}
+		name := s.Name
+		if n := s.Data[ClusterNameKey]; len(n) > 0 {
+			name = string(n)
+		}
+		c, err := NewFromKubeconfig(kubeconfig, opts, logger.With(zap.String("cluster", name)))
+		if err != nil {
+			return fmt.Errorf("kube: cluster secret %s/%s: %w", s.Namespace, s.Name, err)
+		}
+		if err := cs.Add(name, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Local returns the local cluster's name.
+func (cs *Clusters) Local() string {
+	return cs.local
+}
+
+// Get returns the named cluster's client.
+func (cs *Clusters) Get(name string) (*Client, bool) {
+	c, ok := cs.clients[name]
+	return c, ok
+}
+
+// Names returns the cluster names, the local cluster first and the rest
+// sorted.
+func (cs *Clusters) Names() []string {
+	names := make([]string, 0, len(cs.clients))
+	for name := range cs.clients {
+		if name != cs.local {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append([]string{cs.local}, names...)
+}
@@ -0,0 +1,38 @@
+package kube
+
+import (
+	"errors"
+	"net"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+)
+
+// Classify gives an error from the API server its errs kind, so handlers
+// can answer without inspecting Kubernetes status reasons. Errors that
+// already have a kind, and those it does not recognise, are returned as
+// they are.
+func Classify(err error) error {
+	if err == nil || errs.Kind(err) != nil {
+		return err
+	}
+	var netErr net.Error
+	switch {
+	case apierrors.IsNotFound(err):
+		return errs.Wrap(errs.NotFound, err)
+	case apierrors.IsAlreadyExists(err), apierrors.IsConflict(err):
+		return errs.Wrap(errs.Conflict, err)
+	case apierrors.IsInvalid(err), apierrors.IsBadRequest(err):
+		return errs.Wrap(errs.Invalid, err)
+	case apierrors.IsUnauthorized(err):
+		return errs.Wrap(errs.Unauthorized, err)
+	case apierrors.IsForbidden(err):
+		return errs.Wrap(errs.Forbidden, err)
+	case apierrors.IsServiceUnavailable(err), apierrors.IsTooManyRequests(err),
+		apierrors.IsServerTimeout(err), apierrors.IsTimeout(err),
+		errors.As(err, &netErr):
+		return errs.Wrap(errs.Unavailable, err)
+	}
+	return err
+}
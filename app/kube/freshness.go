@@ -0,0 +1,186 @@
+package kube
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Read sources counted in kube_reads_total.
+const (
+	SourceCache = "cache"
+	SourceLive  = "live"
+)
+
+var (
+	readsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_reads_total",
+		Help: "Reads served by the Kubernetes read endpoints, by cluster, kind and source (cache or live).",
+	}, []string{"cluster", "kind", "source"})
+
+	syncedDesc = prometheus.NewDesc("kube_informer_cache_synced",
+		"Whether the informer cache of a kind has synced (1) or not (0).",
+		[]string{"cluster", "kind"}, nil)
+	ageDesc = prometheus.NewDesc("kube_informer_cache_age_seconds",
+		"Time since the informer cache of a kind last heard from the API server: an event or a watch bookmark.",
+		[]string{"cluster", "kind"}, nil)
+)
+
+func init() {
+	prometheus.MustRegister(caches)
+}
+
+// Freshness is how fresh a read must be, from the ?freshness= parameter:
+//
+//	cached      from the informer cache, however old (the default)
+//	live        from the API server
+//	<duration>  from the cache if it heard from the API server within the
+//	            duration, e.g. 30s, else from the API server
+type Freshness struct {
+	live   bool
+	maxAge time.Duration
+}
+
+// Live is the freshness of a read that must go to the API server.
+var Live = Freshness{live: true}
+
+// ParseFreshness reads the ?freshness= parameter of r.
+func ParseFreshness(r *http.Request) (Freshness, error) {
+	switch v := r.URL.Query().Get("freshness"); v {
+	case "", "cached":
+		return Freshness{}, nil
+	case "live":
+		return Live, nil
+	default:
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return Freshness{}, fmt.Errorf("invalid freshness %q: want cached, live or a duration", v)
+		}
+		return Freshness{maxAge: d}, nil
+	}
+}
+
+// Cached reports whether a read wanting f may be served from informer's
+// cache, and counts the read by where it will be served from. A cache
+// that has not synced never serves reads.
+func (f Freshness) Cached(informer cache.SharedInformer) bool {
+	t := caches.lookup(informer)
+	ok := !f.live && informer.HasSynced() && (f.maxAge == 0 || t.age(informer) <= f.maxAge)
+	source := SourceCache
+	if !ok {
+		source = SourceLive
+	}
+	readsTotal.WithLabelValues(t.cluster, t.kind, source).Inc()
+	return ok
+}
+
+// tracked is an informer whose cache age is tracked.
+type tracked struct {
+	cluster, kind string
+
+	mu      sync.Mutex
+	version string
+	seen    time.Time
+}
+
+// age returns the time since informer last heard from the API server. The
+// reflector records the resource version of every event and bookmark, so a
+// new version means it heard from it since the last look.
+func (t *tracked) age(informer cache.SharedInformer) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if v := informer.LastSyncResourceVersion(); v != t.version {
+		t.version, t.seen = v, time.Now()
+	}
+	return time.Since(t.seen)
+}
+
+func (t *tracked) heard(informer cache.SharedInformer) {
+	t.mu.Lock()
+	t.version, t.seen = informer.LastSyncResourceVersion(), time.Now()
+	t.mu.Unlock()
+}
+
+// cacheSet is the set of tracked informers, collected as cache metrics.
+type cacheSet struct {
+	mu        sync.Mutex
+	informers map[cache.SharedInformer]*tracked
+}
+
+var caches = &cacheSet{informers: map[cache.SharedInformer]*tracked{}}
+
+// track starts tracking the started informers of c's factory not tracked
+// yet.
+func (cs *cacheSet) track(c *Client, types map[reflect.Type]bool) {
+	for typ := range types {
+		obj, ok := reflect.New(typ.Elem()).Interface().(runtime.Object)
+		if !ok {
+			continue
+		}
+		informer := c.Informers.InformerFor(obj, nil)
+		cs.mu.Lock()
+		_, exists := cs.informers[informer]
+		t := &tracked{cluster: c.cluster, kind: typ.Elem().Name(), seen: time.Now()}
+		if !exists {
+			cs.informers[informer] = t
+		}
+		cs.mu.Unlock()
+		if exists {
+			continue
+		}
+		t.heard(informer)
+		// Resyncs replay the cache and carry the same resource version
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(any) { t.heard(informer) },
+			UpdateFunc: func(old, new any) {
+				if resourceVersion(old) != resourceVersion(new) {
+					t.heard(informer)
+				}
+			},
+			DeleteFunc: func(any) { t.heard(informer) },
+		})
+	}
+}
+
+func (cs *cacheSet) lookup(informer cache.SharedInformer) *tracked {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if t, ok := cs.informers[informer]; ok {
+		return t
+	}
+	// Not started through a Client: its age is unknown, so it only serves
+	// reads without a maximum age
+	return &tracked{kind: "unknown", version: informer.LastSyncResourceVersion()}
+}
+
+func (cs *cacheSet) Describe(ch chan<- *prometheus.Desc) {
+	ch <- syncedDesc
+	ch <- ageDesc
+}
+
+func (cs *cacheSet) Collect(ch chan<- prometheus.Metric) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for informer, t := range cs.informers {
+		synced := 0.0
+		if informer.HasSynced() {
+			synced = 1
+		}
+		ch <- prometheus.MustNewConstMetric(syncedDesc, prometheus.GaugeValue, synced, t.cluster, t.kind)
+		ch <- prometheus.MustNewConstMetric(ageDesc, prometheus.GaugeValue, t.age(informer).Seconds(), t.cluster, t.kind)
+	}
+}
+
+func resourceVersion(obj any) string {
+	if o, ok := obj.(interface{ GetResourceVersion() string }); ok {
+		return o.GetResourceVersion()
+	}
+	return ""
+}
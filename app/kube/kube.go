@@ -0,0 +1,192 @@
+// Package kube connects the service to the Kubernetes API. It builds a
+// client-go clientset from in-cluster config (or KUBECONFIG when running
+// locally), owns the shared informer factory that read paths should use
+// instead of live LIST calls, and exposes an API server readiness check.
+// Further clusters, from kubeconfig contexts or cluster secrets, are held
+// in a Clusters set.
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Options configures the client.
+type Options struct {
+	// Kubeconfig is used when not running in a cluster. Empty means the
+	// default loading rules ($KUBECONFIG, then ~/.kube/config).
+	Kubeconfig string
+	// Context selects a kubeconfig context instead of the current one. When
+	// set, the kubeconfig is used even inside a cluster.
+	Context string
+	// QPS and Burst bound client-side request rate to the API server.
+	QPS   float32
+	Burst int
+	// ResyncPeriod is the shared informer resync interval.
+	ResyncPeriod time.Duration
+	// UserAgent identifies this service in API server audit logs.
+	UserAgent string
+}
+
+// Client bundles the clientset with the shared informer factory.
+type Client struct {
+	Clientset kubernetes.Interface
+	Informers informers.SharedInformerFactory
+
+	config *rest.Config
+	logger *zap.Logger
+	// cluster names the cluster in cache metrics, once in a Clusters set.
+	cluster string
+}
+
+// Access is what the service manages of its connection to a cluster: the
+// informers' lifecycle and the API server's health. Requests themselves go
+// through the clientset, which client-go fakes (fake.NewClientset); Client
+// implements Access.
+type Access interface {
+	Start(ctx context.Context) error
+	WaitForSync(ctx context.Context) error
+	Shutdown(ctx context.Context) error
+	Check(ctx context.Context) error
+}
+
+var _ Access = (*Client)(nil)
+
+// New builds a client. It does not contact the API server.
+func New(opts Options, logger *zap.Logger) (*Client, error) {
+	cfg, inCluster, err := restConfig(opts.Kubeconfig, opts.Context)
+	if err != nil {
+		return nil, fmt.Errorf("kube: %w", err)
+	}
+	return newForConfig(cfg, inCluster, opts, logger)
+}
+
+// NewFromKubeconfig builds a client from kubeconfig content, e.g. a
+// cluster secret. It does not contact the API server.
+func NewFromKubeconfig(kubeconfig []byte, opts Options, logger *zap.Logger) (*Client, error) {
+	cfg, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("kube: %w", err)
+	}
+	return newForConfig(cfg, false, opts, logger)
+}
+
+func newForConfig(cfg *rest.Config, inCluster bool, opts Options, logger *zap.Logger) (*Client, error) {
+	cfg.QPS = opts.QPS
+	cfg.Burst = opts.Burst
+	if opts.UserAgent != "" {
+		cfg.UserAgent = opts.UserAgent
+	}
+
+	cs, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("kube: %w", err)
+	}
+
+	logger.Info("kubernetes client configured",
+		zap.String("host", cfg.Host),
+		zap.String("context", opts.Context),
+		zap.Bool("in_cluster", inCluster),
+		zap.Float32("qps", cfg.QPS),
+		zap.Int("burst", cfg.Burst),
+	)
+
+	return NewForClientset(cs, cfg, opts.ResyncPeriod, logger), nil
+}
+
+// NewForClientset wraps an existing clientset, e.g. a fake one in tests.
+// cfg may be nil.
+func NewForClientset(cs kubernetes.Interface, cfg *rest.Config, resync time.Duration, logger *zap.Logger) *Client {
+	return &Client{
+		Clientset: cs,
+		Informers: informers.NewSharedInformerFactory(cs, resync),
+		config:    cfg,
+		logger:    logger,
+	}
+}
+
+// Config returns the REST config the clientset was built from (nil for
+// wrapped clientsets).
+func (c *Client) Config() *rest.Config {
+	return c.config
+}
+
+// Start runs every informer requested from the factory so far and waits
+// for their caches to sync. Informers requested later need another Start.
+func (c *Client) Start(ctx context.Context) error {
+	c.Informers.Start(ctx.Done())
+	return c.WaitForSync(ctx)
+}
+
+// WaitForSync waits for the caches of the started informers to sync, or
+// for ctx to be done. Unlike Start's, its ctx does not stop the informers.
+func (c *Client) WaitForSync(ctx context.Context) error {
+	synced := c.Informers.WaitForCacheSync(ctx.Done())
+	for typ, ok := range synced {
+		if !ok {
+			return fmt.Errorf("kube: informer cache for %v did not sync", typ)
+		}
+	}
+	caches.track(c, synced)
+	return nil
+}
+
+// Shutdown stops informers started by Start. ctx must already be cancelled
+// (or be cancelled soon) for informers to exit.
+func (c *Client) Shutdown(context.Context) error {
+	c.Informers.Shutdown()
+	return nil
+}
+
+// Check verifies API server connectivity via its /readyz endpoint. It is
+// suitable as a readiness check.
+func (c *Client) Check(ctx context.Context) error {
+	rc := c.Clientset.Discovery().RESTClient()
+	if rc == nil {
+		// Fake clientsets have no REST client; the version request goes
+		// through their reactors instead
+		if _, err := c.Clientset.Discovery().ServerVersion(); err != nil {
+			return fmt.Errorf("kubernetes API server: %w", err)
+		}
+		return nil
+	}
+	body, err := rc.Get().AbsPath("/readyz").DoRaw(ctx)
+	if err != nil {
+		return fmt.Errorf("kubernetes API server: %w", err)
+	}
+	if string(body) != "ok" {
+		return fmt.Errorf("kubernetes API server not ready: %s", body)
+	}
+	return nil
+}
+
+func restConfig(kubeconfig, kubeContext string) (*rest.Config, bool, error) {
+	if kubeContext == "" {
+		cfg, err := rest.InClusterConfig()
+		if err == nil {
+			return cfg, true, nil
+		}
+		if !errors.Is(err, rest.ErrNotInCluster) {
+			return nil, false, err
+		}
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if kubeconfig != "" {
+		rules.ExplicitPath = kubeconfig
+	}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: kubeContext}
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return nil, false, err
+	}
+	return cfg, false, nil
+}
@@ -0,0 +1,134 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+)
+
+func TestStartSyncsInformers(t *testing.T) {
+	cs := fake.NewClientset(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "platform"},
+	})
+	c := NewForClientset(cs, nil, 0, zap.NewNop())
+	lister := c.Informers.Core().V1().Namespaces().Lister()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer func() {
+		cancel()
+		c.Shutdown(ctx)
+	}()
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	namespaces, err := lister.List(labels.Everything())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(namespaces) != 1 {
+		t.Errorf("expected 1 namespace, got %d", len(namespaces))
+	}
+}
+
+func TestCheckFakeClientset(t *testing.T) {
+	cs := fake.NewClientset()
+	c := NewForClientset(cs, nil, 0, zap.NewNop())
+	if err := c.Check(t.Context()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	cs.PrependReactor("get", "version", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+	if err := c.Check(t.Context()); err == nil {
+		t.Error("expected an error from an unreachable API server")
+	}
+}
+
+const remoteKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: prod
+  cluster: {server: "https://prod.example.com:6443"}
+users:
+- name: platform
+  user: {token: secret}
+contexts:
+- name: prod
+  context: {cluster: prod, user: platform}
+current-context: prod
+`
+
+func TestClustersFromSecrets(t *testing.T) {
+	secret := func(name string, data map[string]string) *corev1.Secret {
+		s := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "platform", Name: name, Labels: map[string]string{"platform.io/cluster": "true"}},
+			Data:       map[string][]byte{},
+		}
+		for k, v := range data {
+			s.Data[k] = []byte(v)
+		}
+		return s
+	}
+	cs := fake.NewClientset(
+		secret("prod-eu", map[string]string{ClusterKubeconfigKey: remoteKubeconfig}),
+		secret("cluster-7f3a", map[string]string{ClusterKubeconfigKey: remoteKubeconfig, ClusterNameKey: "staging"}),
+	)
+	clusters := NewClusters("local", NewForClientset(cs, nil, 0, zap.NewNop()))
+
+	if err := clusters.AddSecrets(t.Context(), "platform", "platform.io/cluster=true", Options{QPS: 5, Burst: 10}, zap.NewNop()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := clusters.Names(); len(got) != 3 || got[0] != "local" || got[1] != "prod-eu" || got[2] != "staging" {
+		t.Errorf("expected local first then sorted remotes, got %v", got)
+	}
+	if c, ok := clusters.Get("staging"); !ok || c.Config().Host != "https://prod.example.com:6443" || c.Config().QPS != 5 {
+		t.Errorf("expected staging client from its kubeconfig, got %+v", c)
+	}
+	if err := clusters.Add("prod-eu", nil); err == nil {
+		t.Error("expected duplicate cluster name to be rejected")
+	}
+}
+
+func TestClassify(t *testing.T) {
+	gr := schema.GroupResource{Group: "batch", Resource: "jobs"}
+	tests := []struct {
+		err  error
+		kind error
+	}{
+		{apierrors.NewNotFound(gr, "migrate"), errs.NotFound},
+		{apierrors.NewAlreadyExists(gr, "migrate"), errs.Conflict},
+		{apierrors.NewConflict(gr, "migrate", errors.New("stale")), errs.Conflict},
+		{apierrors.NewBadRequest("bad selector"), errs.Invalid},
+		{apierrors.NewForbidden(gr, "migrate", errors.New("no rbac")), errs.Forbidden},
+		{apierrors.NewUnauthorized("token expired"), errs.Unauthorized},
+		{apierrors.NewTooManyRequests("slow down", 1), errs.Unavailable},
+		{apierrors.NewServiceUnavailable("etcd"), errs.Unavailable},
+		{apierrors.NewInternalError(errors.New("boom")), nil},
+	}
+	for _, tt := range tests {
+		err := Classify(tt.err)
+		if errs.Kind(err) != tt.kind {
+			t.Errorf("expected %v to be of kind %v, got %v", tt.err, tt.kind, errs.Kind(err))
+		}
+		if !errors.Is(err, tt.err) || err.Error() != tt.err.Error() {
+			t.Errorf("expected the API error kept in the chain, got %v", err)
+		}
+	}
+	if Classify(nil) != nil {
+		t.Error("expected nil to stay nil")
+	}
+}
@@ -0,0 +1,127 @@
+package kustomize
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// maxArchiveSize bounds the extracted size of a source archive, uploaded
+// or downloaded.
+const maxArchiveSize = 32 << 20
+
+// sourceRoot is where a source is extracted in the in-memory filesystem.
+const sourceRoot = "/src"
+
+// validRef matches branch, tag and commit names; ".." is rejected apart.
+var validRef = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+
+var errTooLarge = fmt.Errorf("archive exceeds %d bytes", maxArchiveSize)
+
+// fetch downloads ref of the repository from its archive URL template and
+// extracts it. Hosting services wrap archives in a top-level directory,
+// which is stripped.
+func (h *Handler) fetch(ctx context.Context, repository, ref string) (filesys.FileSystem, error) {
+	tmpl := h.repositories[repository]
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.ReplaceAll(tmpl, "{ref}", ref), nil)
+	if err != nil {
+		return nil, err
+	}
+	if h.token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return extract(resp.Body, true)
+}
+
+// extract unpacks a tar archive, gzip-compressed or not, into an in-memory
+// filesystem under sourceRoot. Only regular files are kept, so links cannot
+// point outside the source. With strip set, the single top-level directory
+// every entry shares is removed from the paths.
+func extract(r io.Reader, strip bool) (filesys.FileSystem, error) {
+	br := bufio.NewReader(r)
+	var src io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		src = zr
+	}
+
+	files := make(map[string][]byte)
+	var total int64
+	tr := tar.NewReader(src)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "/"))
+		if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("archive entry %q escapes the archive", hdr.Name)
+		}
+		total += hdr.Size
+		if total > maxArchiveSize {
+			return nil, errTooLarge
+		}
+		data, err := io.ReadAll(io.LimitReader(tr, hdr.Size))
+		if err != nil {
+			return nil, fmt.Errorf("read archive: %w", err)
+		}
+		files[name] = data
+	}
+	if len(files) == 0 {
+		return nil, errors.New("archive contains no files")
+	}
+
+	prefix := ""
+	if strip {
+		prefix = commonDir(files)
+	}
+	fs := filesys.MakeFsInMemory()
+	for name, data := range files {
+		if err := fs.WriteFile(path.Join(sourceRoot, strings.TrimPrefix(name, prefix)), data); err != nil {
+			return nil, err
+		}
+	}
+	return fs, nil
+}
+
+// commonDir returns "dir/" if every file is under the same top-level
+// directory, or "".
+func commonDir(files map[string][]byte) string {
+	prefix := ""
+	for name := range files {
+		dir, _, ok := strings.Cut(name, "/")
+		if !ok || (prefix != "" && prefix != dir+"/") {
+			return ""
+		}
+		prefix = dir + "/"
+	}
+	return prefix
+}
@@ -0,0 +1,401 @@
+// Package kustomize renders kustomize overlays server-side, from a ref of a
+// configured Git repository or an uploaded tarball, and checks the output
+// against the admission policy, so CI pipelines can pre-flight a deployment
+// through the platform API before applying it.
+package kustomize
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/yaml"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/admission"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/objectstore"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/workpool"
+)
+
+// maxRenders bounds concurrent renders; each holds its source in memory.
+const maxRenders = 4
+
+var rendersTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "kustomize_renders_total",
+	Help: "Kustomize overlay renders by source and result.",
+}, []string{"source", "result"})
+
+// Options configures the handler.
+type Options struct {
+	// Repositories maps repository names to archive URLs in which {ref} is
+	// replaced by the requested branch, tag or commit, e.g.
+	// https://api.github.com/repos/acme/deploy/tarball/{ref}.
+	Repositories map[string]string
+	// Token is sent as a bearer token when downloading archives.
+	Token string
+	// Objects keeps manifests of renders that ask to store them,
+	// downloadable for ObjectExpiry; nil disables storing.
+	Objects      *objectstore.Client
+	ObjectExpiry time.Duration
+	// UserHeader and GroupsHeader carry the caller's identity, set by the
+	// authenticating proxy.
+	UserHeader   string
+	GroupsHeader string
+	// Workers runs the builds; nil runs them on the request goroutines.
+	Workers *workpool.Pool
+}
+
+// Handler serves the render endpoint.
+type Handler struct {
+	repositories map[string]string
+	token        string
+	objects      *objectstore.Client
+	expiry       time.Duration
+	client       *http.Client
+	policy       *admission.Policy
+	headers      authz.Headers
+	renders      chan struct{}
+	workers      *workpool.Pool
+	logger       *zap.Logger
+}
+
+// New creates a render handler downloading archives with client. Rendered
+// resources are checked against policy; a nil policy allows everything.
+func New(client *http.Client, policy *admission.Policy, opts Options, logger *zap.Logger) *Handler {
+	if policy == nil {
+		policy = &admission.Policy{}
+	}
+	return &Handler{
+		repositories: opts.Repositories,
+		token:        opts.Token,
+		objects:      opts.Objects,
+		expiry:       opts.ObjectExpiry,
+		client:       client,
+		policy:       policy,
+		headers:      authz.Headers{User: opts.UserHeader, Groups: opts.GroupsHeader},
+		renders:      make(chan struct{}, maxRenders),
+		workers:      opts.Workers,
+		logger:       logger,
+	}
+}
+
+// Register mounts the kustomize endpoints on mux.
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/kustomize/repositories", h.listRepositories)
+	mux.HandleFunc("POST /api/v1/kustomize/render", h.render)
+}
+
+func (h *Handler) listRepositories(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(h.repositories))
+	for name := range h.repositories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	writeJSON(w, http.StatusOK, map[string]any{"items": names})
+}
+
+// renderRequest selects an overlay in a configured repository.
+type renderRequest struct {
+	Repository string `json:"repository"`
+	Ref        string `json:"ref"`
+	// Path is the overlay directory, relative to the repository root.
+	Path string `json:"path"`
+	// Namespace is the deployment target, assumed for resources that set
+	// none when checking the policy.
+	Namespace string `json:"namespace"`
+	// Store keeps the manifests in the object store and returns a
+	// download URL instead of inlining them.
+	Store bool `json:"store"`
+}
+
+// Resource is one rendered object and the policy rules it breaks.
+type Resource struct {
+	APIVersion string   `json:"api_version"`
+	Kind       string   `json:"kind"`
+	Namespace  string   `json:"namespace,omitempty"`
+	Name       string   `json:"name"`
+	Violations []string `json:"violations,omitempty"`
+}
+
+// Result is a rendered overlay.
+type Result struct {
+	// Manifests is the multi-document YAML kustomize build prints, unless
+	// the request stored it as Object.
+	Manifests string                 `json:"manifests,omitempty"`
+	Object    *objectstore.Presigned `json:"object,omitempty"`
+	Resources []Resource             `json:"resources"`
+	// Allowed is false if any resource breaks the admission policy.
+	Allowed bool `json:"allowed"`
+}
+
+// render builds an overlay from a repository ref (a JSON body) or from an
+// uploaded tar archive (a gzip or tar body, with ?path=, ?namespace= and
+// ?store=).
+// Policy violations do not fail the request; they are reported per
+// resource and in Allowed.
+func (h *Handler) render(w http.ResponseWriter, r *http.Request) {
+	id := h.headers.Identity(r)
+	if id.User == "" {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var req renderRequest
+	source := "repository"
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if _, ok := h.repositories[req.Repository]; !ok {
+			http.Error(w, "unknown repository", http.StatusBadRequest)
+			return
+		}
+		if !validRef.MatchString(req.Ref) || strings.Contains(req.Ref, "..") {
+			http.Error(w, "invalid ref", http.StatusBadRequest)
+			return
+		}
+	case "application/gzip", "application/x-gzip", "application/x-tar":
+		source = "upload"
+		req.Path, req.Namespace = r.URL.Query().Get("path"), r.URL.Query().Get("namespace")
+		req.Store = r.URL.Query().Get("store") == "true"
+	default:
+		http.Error(w, "content type must be application/json, application/gzip or application/x-tar", http.StatusUnsupportedMediaType)
+		return
+	}
+	if strings.Contains(req.Path, "..") {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	if req.Store && h.objects == nil {
+		http.Error(w, "no object store configured", http.StatusBadRequest)
+		return
+	}
+	dir := path.Join(sourceRoot, path.Clean("/"+req.Path))
+
+	audit := h.logger.With(
+		zap.String("audit", "kustomize"),
+		zap.String("request_id", middleware.GetRequestID(r.Context())),
+		zap.String("user", id.User),
+		zap.Strings("groups", id.Groups),
+		zap.String("source", source),
+		zap.String("repository", req.Repository),
+		zap.String("ref", req.Ref),
+		zap.String("path", req.Path),
+	)
+
+	select {
+	case h.renders <- struct{}{}:
+		defer func() { <-h.renders }()
+	case <-r.Context().Done():
+		return
+	}
+
+	var (
+		fs  filesys.FileSystem
+		err error
+	)
+	if source == "repository" {
+		fs, err = h.fetch(r.Context(), req.Repository, req.Ref)
+		if err != nil {
+			rendersTotal.WithLabelValues(source, "error").Inc()
+			audit.Warn("failed to fetch kustomize source", zap.Error(err))
+			http.Error(w, "failed to fetch repository archive: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+	} else {
+		fs, err = extract(http.MaxBytesReader(w, r.Body, maxArchiveSize), false)
+		if err != nil {
+			rendersTotal.WithLabelValues(source, "error").Inc()
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) || errors.Is(err, errTooLarge) {
+				http.Error(w, errTooLarge.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var res *Result
+	err = h.workers.Do(r.Context(), "kustomize", func() (err error) {
+		res, err = h.build(fs, dir, req.Namespace)
+		return err
+	})
+	if workpool.Error(w, err) {
+		rendersTotal.WithLabelValues(source, "error").Inc()
+		return
+	}
+	if err != nil {
+		rendersTotal.WithLabelValues(source, "error").Inc()
+		audit.Info("kustomize overlay failed to render", zap.Error(err))
+		http.Error(w, strings.ReplaceAll(err.Error(), sourceRoot+"/", ""), http.StatusUnprocessableEntity)
+		return
+	}
+	if req.Store {
+		key := path.Join(objectstore.ManifestPrefix, uuid.NewString(), "manifests.yaml")
+		if res.Object, err = h.objects.Upload(r.Context(), key, "application/yaml", []byte(res.Manifests), h.expiry); err != nil {
+			rendersTotal.WithLabelValues(source, "error").Inc()
+			audit.Warn("failed to store rendered manifests", zap.Error(err))
+			http.Error(w, "failed to store rendered manifests", http.StatusBadGateway)
+			return
+		}
+		res.Manifests = ""
+	}
+	result := "allowed"
+	if !res.Allowed {
+		result = "denied"
+	}
+	rendersTotal.WithLabelValues(source, result).Inc()
+	audit.Info("kustomize overlay rendered",
+		zap.Int("resources", len(res.Resources)),
+		zap.Bool("allowed", res.Allowed),
+		zap.Bool("stored", req.Store),
+	)
+	writeJSON(w, http.StatusOK, res)
+}
+
+// build runs kustomize on the overlay in dir and checks every resource.
+func (h *Handler) build(fs filesys.FileSystem, dir, namespace string) (*Result, error) {
+	if err := checkLocal(fs, dir, make(map[string]bool)); err != nil {
+		return nil, err
+	}
+	m, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(fs, dir)
+	if err != nil {
+		return nil, err
+	}
+	manifests, err := m.AsYaml()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Result{Manifests: string(manifests), Resources: []Resource{}, Allowed: true}
+	for _, obj := range m.Resources() {
+		raw, err := obj.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		out := Resource{
+			APIVersion: obj.GetApiVersion(),
+			Kind:       obj.GetKind(),
+			Namespace:  obj.GetNamespace(),
+			Name:       obj.GetName(),
+		}
+		ns := out.Namespace
+		if ns == "" {
+			ns = namespace
+		}
+		if out.Violations, err = h.policy.Check(out.Kind, ns, raw); err != nil {
+			return nil, fmt.Errorf("decode %s %s: %w", out.Kind, out.Name, err)
+		}
+		if len(out.Violations) > 0 {
+			res.Allowed = false
+		}
+		res.Resources = append(res.Resources, out)
+	}
+	return res, nil
+}
+
+// checkLocal requires every file and directory the kustomization in dir
+// and the ones it builds on refer to be in the source. Kustomize would
+// otherwise clone remote bases and download URLs from the server.
+func checkLocal(fs filesys.FileSystem, dir string, seen map[string]bool) error {
+	if seen[dir] {
+		return nil
+	}
+	seen[dir] = true
+	var file string
+	for _, name := range konfig.RecognizedKustomizationFileNames() {
+		if fs.Exists(filepath.Join(dir, name)) {
+			file = filepath.Join(dir, name)
+			break
+		}
+	}
+	if file == "" {
+		// kustomize reports the missing kustomization itself
+		return nil
+	}
+	data, err := fs.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var k types.Kustomization
+	if err := yaml.Unmarshal(data, &k); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	for _, ref := range references(&k) {
+		// Inline patches and transformer configs are not paths
+		if ref == "" || strings.Contains(ref, "\n") {
+			continue
+		}
+		p := filepath.Join(dir, ref)
+		if !fs.Exists(p) {
+			return fmt.Errorf("%s: %q is not in the source; remote and absolute references are not supported", file, ref)
+		}
+		if fs.IsDir(p) {
+			if err := checkLocal(fs, p, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// references lists the paths a kustomization loads.
+func references(k *types.Kustomization) []string {
+	refs := slices.Concat(k.Resources, k.Components, k.Bases, k.Crds, k.Configurations, k.Generators, k.Transformers, k.Validators)
+	for _, p := range slices.Concat(k.Patches, k.PatchesJson6902) {
+		refs = append(refs, p.Path)
+	}
+	for _, p := range k.PatchesStrategicMerge {
+		refs = append(refs, string(p))
+	}
+	for _, r := range k.Replacements {
+		refs = append(refs, r.Path)
+	}
+	var sources []types.KvPairSources
+	for _, g := range k.ConfigMapGenerator {
+		sources = append(sources, g.KvPairSources)
+	}
+	for _, g := range k.SecretGenerator {
+		sources = append(sources, g.KvPairSources)
+	}
+	for _, s := range sources {
+		for _, f := range s.FileSources {
+			// "key=path" or "path"
+			if _, p, ok := strings.Cut(f, "="); ok {
+				f = p
+			}
+			refs = append(refs, f)
+		}
+		refs = append(refs, s.EnvSources...)
+		refs = append(refs, s.EnvSource)
+	}
+	return append(refs, k.OpenAPI["path"])
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
@@ -0,0 +1,135 @@
+package kustomize
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/admission"
+)
+
+var overlay = map[string]string{
+	"base/kustomization.yaml": "resources:\n- deployment.yaml\n",
+	"base/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  selector:
+    matchLabels: {app: web}
+  template:
+    metadata:
+      labels: {app: web}
+    spec:
+      containers:
+      - name: web
+        image: registry.internal/web:1.0
+`,
+	"overlays/prod/kustomization.yaml": "resources:\n- ../../base\nnamespace: team-a\nimages:\n- name: registry.internal/web\n  newName: docker.io/web\n",
+	"overlays/dev/kustomization.yaml":  "resources:\n- ../../base\n- https://example.com/extra.yaml\n",
+}
+
+func tarball(t *testing.T, prefix string, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: prefix + name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	zw.Close()
+	return buf.Bytes()
+}
+
+func newMux(t *testing.T, repoURL string) *http.ServeMux {
+	t.Helper()
+	policy := &admission.Policy{AllowedRegistries: []string{"registry.internal/"}}
+	mux := http.NewServeMux()
+	New(http.DefaultClient, policy, Options{
+		Repositories: map[string]string{"deploy": repoURL + "/archive/{ref}.tar.gz"},
+		Token:        "s3cret",
+		UserHeader:   "X-Forwarded-User",
+	}, zap.NewNop()).Register(mux)
+	return mux
+}
+
+func post(mux *http.ServeMux, target, contentType string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Forwarded-User", "ci")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRenderUpload(t *testing.T) {
+	mux := newMux(t, "http://unused")
+	archive := tarball(t, "", overlay)
+
+	rec := post(mux, "/api/v1/kustomize/render?path=base&namespace=team-a", "application/gzip", archive)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var res Result
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !res.Allowed || len(res.Resources) != 1 || !strings.Contains(res.Manifests, "kind: Deployment") {
+		t.Errorf("expected the base to render and pass, got %+v", res)
+	}
+
+	// The prod overlay swaps in an image from a registry the policy refuses
+	rec = post(mux, "/api/v1/kustomize/render?path=overlays/prod", "application/gzip", archive)
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Allowed || res.Resources[0].Namespace != "team-a" || len(res.Resources[0].Violations) != 1 {
+		t.Errorf("expected a registry violation, got %+v", res)
+	}
+
+	rec = post(mux, "/api/v1/kustomize/render?path=overlays/dev", "application/gzip", archive)
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "remote") {
+		t.Errorf("expected remote resources to be refused, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := post(mux, "/api/v1/kustomize/render?path=../etc", "application/gzip", archive); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a path leaving the source, got %d", rec.Code)
+	}
+}
+
+func TestRenderRepository(t *testing.T) {
+	archive := tarball(t, "deploy-main/", overlay)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/archive/main.tar.gz" || r.Header.Get("Authorization") != "Bearer s3cret" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(archive)
+	}))
+	defer srv.Close()
+	mux := newMux(t, srv.URL)
+
+	rec := post(mux, "/api/v1/kustomize/render", "application/json", []byte(`{"repository":"deploy","ref":"main","path":"base"}`))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := post(mux, "/api/v1/kustomize/render", "application/json", []byte(`{"repository":"deploy","ref":"v2","path":"base"}`)); rec.Code != http.StatusBadGateway {
+		t.Errorf("expected 502 for a missing ref, got %d", rec.Code)
+	}
+	if rec := post(mux, "/api/v1/kustomize/render", "application/json", []byte(`{"repository":"other","ref":"main"}`)); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown repository, got %d", rec.Code)
+	}
+	if rec := post(mux, "/api/v1/kustomize/render", "application/json", []byte(`{"repository":"deploy","ref":"../main"}`)); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid ref, got %d", rec.Code)
+	}
+}
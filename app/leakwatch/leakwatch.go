@@ -0,0 +1,182 @@
+// Package leakwatch detects goroutine leaks. A leak shows as a goroutine
+// count that keeps growing, well above what the service needs when idle,
+// while request spikes come and go.
+//
+// The detector samples the count every interval. The count is suspected of
+// leaking once it has stayed above the baseline plus a tolerance for a whole
+// window of samples and grown over it. It then captures a goroutine profile,
+// grouped by stack, which is served until the next suspicion: the stack
+// with thousands of goroutines is usually the leak.
+package leakwatch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+)
+
+// Event types published on the bus.
+const (
+	EventSuspected = "goroutines.leak_suspected"
+	EventCleared   = "goroutines.leak_cleared"
+)
+
+var (
+	baselineGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "goroutine_leak_baseline",
+		Help: "Goroutine count taken as normal for the service.",
+	})
+	suspectedGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "goroutine_leak_suspected",
+		Help: "Whether the goroutine count is suspected of leaking (1) or not (0).",
+	})
+	alertsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "goroutine_leak_alerts_total",
+		Help: "Times a goroutine leak was suspected.",
+	})
+)
+
+// Options configures a Detector.
+type Options struct {
+	Interval time.Duration
+	// Baseline is the normal goroutine count; 0 takes the first sample.
+	Baseline int
+	// Tolerance is how far above the baseline the count may go.
+	Tolerance int
+	// Window is how many samples in a row the count must stay above the
+	// baseline plus the tolerance.
+	Window int
+}
+
+// Detector watches the goroutine count; start it with Run.
+type Detector struct {
+	opts   Options
+	bus    events.Publisher
+	logger *zap.Logger
+	count  func() int
+
+	mu        sync.Mutex
+	baseline  int
+	samples   []int
+	suspected bool
+	profile   []byte
+}
+
+// New creates a detector. bus may be nil.
+func New(opts Options, bus events.Publisher, logger *zap.Logger) *Detector {
+	if opts.Interval <= 0 {
+		opts.Interval = 30 * time.Second
+	}
+	opts.Window = max(opts.Window, 2)
+	baselineGauge.Set(float64(opts.Baseline))
+	return &Detector{opts: opts, bus: bus, logger: logger, count: runtime.NumGoroutine, baseline: opts.Baseline}
+}
+
+// Run samples the goroutine count every interval until ctx is done.
+func (d *Detector) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.sample(ctx)
+		}
+	}
+}
+
+func (d *Detector) sample(ctx context.Context) {
+	n := d.count()
+	d.mu.Lock()
+	if d.baseline == 0 {
+		d.baseline = n
+		baselineGauge.Set(float64(n))
+	}
+	d.samples = append(d.samples, n)
+	if len(d.samples) > d.opts.Window {
+		d.samples = d.samples[1:]
+	}
+	limit := d.baseline + d.opts.Tolerance
+	above := len(d.samples) == d.opts.Window
+	for _, s := range d.samples {
+		above = above && s > limit
+	}
+	grew := d.samples[len(d.samples)-1] > d.samples[0]
+
+	var typ string
+	switch {
+	case !d.suspected && above && grew:
+		d.suspected = true
+		d.profile = capture(n)
+		typ = EventSuspected
+	case d.suspected && n <= limit:
+		d.suspected = false
+		typ = EventCleared
+	}
+	d.mu.Unlock()
+	if typ == "" {
+		return
+	}
+
+	fields := []zap.Field{zap.Int("goroutines", n), zap.Int("baseline", d.baseline), zap.Int("tolerance", d.opts.Tolerance)}
+	if typ == EventSuspected {
+		suspectedGauge.Set(1)
+		alertsTotal.Inc()
+		d.logger.Warn("goroutine leak suspected, profile captured", fields...)
+	} else {
+		suspectedGauge.Set(0)
+		d.logger.Info("goroutine count back to normal", fields...)
+	}
+	d.publish(ctx, typ, n)
+}
+
+// capture returns the goroutine profile, one entry per distinct stack.
+func capture(n int) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# captured %s with %d goroutines\n", time.Now().UTC().Format(time.RFC3339), n)
+	pprof.Lookup("goroutine").WriteTo(&buf, 1)
+	return buf.Bytes()
+}
+
+func (d *Detector) publish(ctx context.Context, typ string, n int) {
+	if d.bus == nil {
+		return
+	}
+	e, err := events.New(typ, "leakwatch", map[string]int{
+		"goroutines": n,
+		"baseline":   d.baseline,
+		"tolerance":  d.opts.Tolerance,
+	})
+	if err != nil {
+		return
+	}
+	if err := d.bus.Publish(ctx, e); err != nil {
+		d.logger.Warn("failed to publish goroutine leak event", zap.Error(err))
+	}
+}
+
+// ServeHTTP serves the profile captured at the last suspected leak, 404
+// before there is one.
+func (d *Detector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	profile := d.profile
+	d.mu.Unlock()
+	if profile == nil {
+		http.Error(w, "no goroutine leak suspected yet", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(profile)
+}
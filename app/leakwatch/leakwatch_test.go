@@ -0,0 +1,65 @@
+package leakwatch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+)
+
+func TestDetector(t *testing.T) {
+	bus := events.NewMemoryBus()
+	var published []string
+	bus.Subscribe(func(_ context.Context, e events.Event) { published = append(published, e.Type) })
+	d := New(Options{Tolerance: 50, Window: 3}, bus, zap.NewNop())
+	var n int
+	d.count = func() int { return n }
+	sample := func(counts ...int) {
+		for _, c := range counts {
+			n = c
+			d.sample(t.Context())
+		}
+	}
+	profile := func() int {
+		rec := httptest.NewRecorder()
+		d.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/goroutines/leak", nil))
+		return rec.Code
+	}
+
+	// The first sample is the baseline; a spike that falls back or levels
+	// off is no leak
+	sample(100, 300, 80, 200, 200, 200)
+	if d.baseline != 100 || d.suspected || profile() != http.StatusNotFound {
+		t.Fatalf("spikes: baseline %d, suspected %v", d.baseline, d.suspected)
+	}
+
+	// Sustained growth is, and a profile is captured
+	sample(300, 400)
+	if !d.suspected {
+		t.Fatal("growth not suspected")
+	}
+	rec := httptest.NewRecorder()
+	d.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/goroutines/leak", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "goroutine profile") {
+		t.Errorf("profile: %d %.100s", rec.Code, rec.Body.String())
+	}
+
+	// Until the count falls back within the tolerance
+	sample(500, 160)
+	if !d.suspected {
+		t.Error("cleared above the tolerance")
+	}
+	sample(140)
+	if d.suspected || profile() != http.StatusOK {
+		t.Error("not cleared, or profile dropped")
+	}
+	if want := []string{EventSuspected, EventCleared}; !slices.Equal(published, want) {
+		t.Errorf("published %v, want %v", published, want)
+	}
+}
@@ -0,0 +1,123 @@
+// Package lifecycle coordinates graceful shutdown. Components register hooks
+// (stop listeners, flush audit buffers, close DB pools, stop informers) that
+// run in phase order, each bounded by its own timeout.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Phase orders shutdown hooks. Lower phases run first; hooks within a phase
+// run in registration order.
+type Phase int
+
+const (
+	// PhaseListeners stops accepting traffic and drains in-flight requests.
+	PhaseListeners Phase = iota * 10
+	// PhaseWorkers stops background workers and consumers.
+	PhaseWorkers
+	// PhaseFlush flushes buffered data (audit events, outgoing batches).
+	PhaseFlush
+	// PhaseClose releases connections to external systems (DB pools, informers).
+	PhaseClose
+	// PhaseFinal runs last, e.g. the admin listener so probes stay reachable.
+	PhaseFinal
+)
+
+// Hook is a single shutdown step.
+type Hook struct {
+	Name    string
+	Phase   Phase
+	Timeout time.Duration
+	Fn      func(ctx context.Context) error
+
+	seq int
+}
+
+// Registry collects shutdown hooks.
+type Registry struct {
+	logger *zap.Logger
+
+	mu    sync.Mutex
+	hooks []Hook
+}
+
+// New creates an empty registry.
+func New(logger *zap.Logger) *Registry {
+	return &Registry{logger: logger}
+}
+
+// OnShutdown registers fn to run in phase with the given timeout. A zero
+// timeout means the hook is bounded only by the overall shutdown deadline.
+func (r *Registry) OnShutdown(name string, phase Phase, timeout time.Duration, fn func(ctx context.Context) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = append(r.hooks, Hook{
+		Name:    name,
+		Phase:   phase,
+		Timeout: timeout,
+		Fn:      fn,
+		seq:     len(r.hooks),
+	})
+}
+
+// Shutdown runs every hook in order. A failing or slow hook is logged and
+// does not stop later hooks. The returned error joins all hook failures.
+func (r *Registry) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	hooks := make([]Hook, len(r.hooks))
+	copy(hooks, r.hooks)
+	r.mu.Unlock()
+
+	sort.SliceStable(hooks, func(i, j int) bool {
+		if hooks[i].Phase != hooks[j].Phase {
+			return hooks[i].Phase < hooks[j].Phase
+		}
+		return hooks[i].seq < hooks[j].seq
+	})
+
+	var errs []error
+	for _, h := range hooks {
+		if err := r.run(ctx, h); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", h.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Registry) run(ctx context.Context, h Hook) error {
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- h.Fn(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	fields := []zap.Field{
+		zap.String("hook", h.Name),
+		zap.Duration("duration", time.Since(start)),
+	}
+	if err != nil {
+		r.logger.Error("shutdown hook failed", append(fields, zap.Error(err))...)
+		return err
+	}
+	r.logger.Info("shutdown hook completed", fields...)
+	return nil
+}
@@ -0,0 +1,64 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestShutdownOrder(t *testing.T) {
+	r := New(zap.NewNop())
+	var order []string
+	record := func(name string) func(context.Context) error {
+		return func(context.Context) error {
+			order = append(order, name)
+			return nil
+		}
+	}
+
+	r.OnShutdown("close-db", PhaseClose, 0, record("close-db"))
+	r.OnShutdown("admin", PhaseFinal, 0, record("admin"))
+	r.OnShutdown("public", PhaseListeners, 0, record("public"))
+	r.OnShutdown("flush-audit", PhaseFlush, 0, record("flush-audit"))
+	r.OnShutdown("stop-informers", PhaseClose, 0, record("stop-informers"))
+
+	if err := r.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"public", "flush-audit", "close-db", "stop-informers", "admin"}
+	if len(order) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, order)
+	}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, order)
+			break
+		}
+	}
+}
+
+func TestShutdownHookTimeout(t *testing.T) {
+	r := New(zap.NewNop())
+	ran := false
+
+	r.OnShutdown("stuck", PhaseWorkers, 10*time.Millisecond, func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	r.OnShutdown("after", PhaseClose, 0, func(context.Context) error {
+		ran = true
+		return nil
+	})
+
+	err := r.Shutdown(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if !ran {
+		t.Error("expected later hooks to run after a timeout")
+	}
+}
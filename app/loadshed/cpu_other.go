@@ -0,0 +1,10 @@
+//go:build !unix
+
+package loadshed
+
+import "time"
+
+// processCPU is unavailable here; the CPU signal stays off.
+func processCPU() (time.Duration, bool) {
+	return 0, false
+}
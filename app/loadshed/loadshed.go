@@ -0,0 +1,299 @@
+// Package loadshed rejects requests early when the service is overloaded,
+// least important first, so that the requests it does accept are served
+// within their latency target instead of all of them slowing down.
+//
+// Every interval the controller looks at the p99 latency of the requests
+// served in it and at the CPU utilization of the process. While either is
+// over its threshold the shed level rises additively; once both are back
+// under, it decays. The level decides which requests are turned away:
+//
+//	level 0 to 0.5   a proportion of low-priority requests (2 x level)
+//	level 0.5 to 1   all low-priority requests and a proportion of normal ones
+//
+// High-priority requests (the admin API) and critical ones (probes and
+// metrics) are never shed.
+package loadshed
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// Priorities, from most to least important.
+const (
+	PriorityCritical = "critical"
+	PriorityHigh     = "high"
+	PriorityNormal   = "normal"
+	PriorityLow      = "low"
+)
+
+// PriorityHeader lets a client lower the priority of its request, e.g.
+// for batch jobs and prefetching. Raising it is not possible.
+const PriorityHeader = "X-Request-Priority"
+
+const (
+	// raise and decay are how much the level moves per interval.
+	raise = 0.1
+	decay = 0.05
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "loadshed_requests_total",
+		Help: "Requests by priority and decision (admitted or shed).",
+	}, []string{"priority", "decision"})
+	levelGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "loadshed_level",
+		Help: "Shed level, from 0 (nothing shed) to 1 (all low and normal priority requests shed).",
+	})
+	p99Gauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "loadshed_latency_p99_seconds",
+		Help: "p99 latency of the requests served in the last interval.",
+	})
+	cpuGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "loadshed_cpu_utilization",
+		Help: "CPU utilization of the process in the last interval, from 0 to 1.",
+	})
+	overloadedGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "loadshed_overloaded",
+		Help: "Whether the last interval was over the threshold of signal (latency or cpu).",
+	}, []string{"signal"})
+)
+
+// Options configures a Shedder.
+type Options struct {
+	// LatencyTarget is the p99 latency above which requests are shed.
+	LatencyTarget time.Duration
+	// CPUThreshold is the CPU utilization, from 0 to 1, above which
+	// requests are shed; 0 disables the CPU signal.
+	CPUThreshold float64
+	// Interval is how often the signals are evaluated.
+	Interval time.Duration
+	// LowPriorityPaths are path prefixes of low-priority requests.
+	LowPriorityPaths []string
+}
+
+// Shedder is the load-shedding controller and its middleware.
+type Shedder struct {
+	opts   Options
+	logger *zap.Logger
+
+	// level is a float64's bits, read on every request.
+	level atomic.Uint64
+
+	mu        sync.Mutex
+	latencies histogram
+
+	cpu    cpuSampler
+	random func() float64
+}
+
+// New creates a shedder; start its controller with Run.
+func New(opts Options, logger *zap.Logger) *Shedder {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	return &Shedder{opts: opts, logger: logger, random: rand.Float64}
+}
+
+// Run evaluates the signals every interval until ctx is done.
+func (s *Shedder) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+	s.cpu.sample()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			p99 := s.latencies.quantile(0.99)
+			s.latencies.reset()
+			s.mu.Unlock()
+			s.evaluate(p99, s.cpu.sample())
+		}
+	}
+}
+
+// evaluate moves the shed level for one interval's p99 latency and CPU
+// utilization.
+func (s *Shedder) evaluate(p99 time.Duration, cpu float64) {
+	slow := p99 > s.opts.LatencyTarget
+	busy := s.opts.CPUThreshold > 0 && cpu > s.opts.CPUThreshold
+	p99Gauge.Set(p99.Seconds())
+	cpuGauge.Set(cpu)
+	overloadedGauge.WithLabelValues("latency").Set(boolToFloat(slow))
+	overloadedGauge.WithLabelValues("cpu").Set(boolToFloat(busy))
+
+	previous := s.Level()
+	level := previous - decay
+	if slow || busy {
+		level = previous + raise
+	}
+	level = math.Round(min(max(level, 0), 1)*100) / 100
+	s.level.Store(math.Float64bits(level))
+	levelGauge.Set(level)
+	switch {
+	case previous == 0 && level > 0:
+		s.logger.Warn("shedding load",
+			zap.Duration("p99", p99),
+			zap.Float64("cpu", cpu),
+			zap.Duration("latency_target", s.opts.LatencyTarget),
+			zap.Float64("cpu_threshold", s.opts.CPUThreshold),
+		)
+	case previous > 0 && level == 0:
+		s.logger.Info("stopped shedding load")
+	}
+}
+
+// Level returns the shed level, from 0 to 1.
+func (s *Shedder) Level() float64 {
+	return math.Float64frombits(s.level.Load())
+}
+
+// Priority classifies r.
+func (s *Shedder) Priority(r *http.Request) string {
+	switch {
+	case r.URL.Path == "/healthz" || r.URL.Path == "/readyz" || r.URL.Path == "/livez" || r.URL.Path == "/metrics":
+		return PriorityCritical
+	case strings.HasPrefix(r.URL.Path, "/api/v1/admin/"):
+		return PriorityHigh
+	case strings.EqualFold(r.Header.Get(PriorityHeader), PriorityLow):
+		return PriorityLow
+	}
+	for _, prefix := range s.opts.LowPriorityPaths {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return PriorityLow
+		}
+	}
+	return PriorityNormal
+}
+
+// admit decides whether a request of priority is served at the current
+// level.
+func (s *Shedder) admit(priority string) bool {
+	level := s.Level()
+	var p float64
+	switch priority {
+	case PriorityLow:
+		p = min(2*level, 1)
+	case PriorityNormal:
+		p = max(2*level-1, 0)
+	}
+	return p == 0 || s.random() >= p
+}
+
+// Middleware sheds requests before they reach next, answering 503 with a
+// Retry-After, and records the latency of those it serves. Streams and
+// upgraded connections are served without being timed.
+func (s *Shedder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		priority := s.Priority(r)
+		if !s.admit(priority) {
+			requestsTotal.WithLabelValues(priority, "shed").Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(max(int(s.opts.Interval.Seconds()), 1)))
+			http.Error(w, "service overloaded, try again later", http.StatusServiceUnavailable)
+			return
+		}
+		requestsTotal.WithLabelValues(priority, "admitted").Inc()
+		if r.Header.Get("Upgrade") != "" || strings.Contains(r.Header.Get("Accept"), "text/event-stream") ||
+			r.URL.Query().Get("watch") == "true" || r.URL.Query().Get("follow") == "true" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		d := time.Since(start)
+		s.mu.Lock()
+		s.latencies.observe(d)
+		s.mu.Unlock()
+	})
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// histogram counts latencies in buckets growing by a quarter from 1ms,
+// enough to tell a p99 within 25%.
+type histogram struct {
+	counts [64]uint64
+	total  uint64
+}
+
+const firstBucket = time.Millisecond
+
+func bucketOf(d time.Duration) int {
+	if d <= firstBucket {
+		return 0
+	}
+	i := int(math.Ceil(math.Log(float64(d)/float64(firstBucket)) / math.Log(1.25)))
+	return min(i, len(histogram{}.counts)-1)
+}
+
+func bucketBound(i int) time.Duration {
+	return time.Duration(float64(firstBucket) * math.Pow(1.25, float64(i)))
+}
+
+func (h *histogram) observe(d time.Duration) {
+	h.counts[bucketOf(d)]++
+	h.total++
+}
+
+// quantile returns the upper bound of the bucket holding the q quantile,
+// or 0 without observations.
+func (h *histogram) quantile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(h.total)))
+	var seen uint64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			return bucketBound(i)
+		}
+	}
+	return bucketBound(len(h.counts) - 1)
+}
+
+func (h *histogram) reset() {
+	*h = histogram{}
+}
+
+// cpuSampler measures the process's CPU utilization between samples: the
+// CPU time it used over the time GOMAXPROCS CPUs could have given it.
+type cpuSampler struct {
+	used time.Duration
+	at   time.Time
+}
+
+func (c *cpuSampler) sample() float64 {
+	used, ok := processCPU()
+	if !ok {
+		return 0
+	}
+	now := time.Now()
+	dUsed, dWall := used-c.used, now.Sub(c.at)
+	first := c.at.IsZero()
+	c.used, c.at = used, now
+	if first || dWall <= 0 {
+		return 0
+	}
+	return min(max(dUsed.Seconds()/(dWall.Seconds()*float64(runtime.GOMAXPROCS(0))), 0), 1)
+}
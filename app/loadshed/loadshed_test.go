@@ -0,0 +1,84 @@
+package loadshed
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestShedder(t *testing.T) {
+	s := New(Options{LatencyTarget: 100 * time.Millisecond, CPUThreshold: 0.9, LowPriorityPaths: []string{"/api/v1/reports/"}}, zap.NewNop())
+	s.random = func() float64 { return 0.5 }
+	h := s.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	do := func(path string, header ...string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if len(header) == 2 {
+			req.Header.Set(header[0], header[1])
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Under the thresholds nothing is shed, and the level stays at 0
+	s.evaluate(50*time.Millisecond, 0.5)
+	if s.Level() != 0 || do("/api/v1/reports/cost") != http.StatusOK {
+		t.Fatalf("idle: level %v", s.Level())
+	}
+
+	// Either signal raises the level; low priority goes first
+	for range 3 {
+		s.evaluate(200*time.Millisecond, 0.5)
+	}
+	s.evaluate(0, 0.95)
+	if s.Level() != 0.4 {
+		t.Fatalf("level = %v, want 0.4", s.Level())
+	}
+	for _, tc := range []struct {
+		path, header, value string
+		want                int
+	}{
+		{path: "/api/v1/reports/cost", want: http.StatusServiceUnavailable},
+		{path: "/api/v1/tenants", header: PriorityHeader, value: "low", want: http.StatusServiceUnavailable},
+		{path: "/api/v1/tenants", want: http.StatusOK},
+	} {
+		if got := do(tc.path, tc.header, tc.value); got != tc.want {
+			t.Errorf("level 0.4, %s %s: %d, want %d", tc.path, tc.value, got, tc.want)
+		}
+	}
+
+	// At the top normal priority is shed too, but never admin or probes
+	for range 10 {
+		s.evaluate(time.Second, 0)
+	}
+	for path, want := range map[string]int{
+		"/api/v1/tenants":       http.StatusServiceUnavailable,
+		"/api/v1/admin/tenants": http.StatusOK,
+		"/healthz":              http.StatusOK,
+		"/metrics":              http.StatusOK,
+	} {
+		if got := do(path); got != want {
+			t.Errorf("level 1, %s: %d, want %d", path, got, want)
+		}
+	}
+
+	// The level decays once the signals recover
+	for range 20 {
+		s.evaluate(10*time.Millisecond, 0.1)
+	}
+	if s.Level() != 0 || do("/api/v1/reports/cost") != http.StatusOK {
+		t.Errorf("recovered: level %v", s.Level())
+	}
+
+	// The p99 of the served requests is within a bucket of the truth
+	var hist histogram
+	for i := range 1000 {
+		hist.observe(time.Duration(i+1) * time.Millisecond)
+	}
+	if p99 := hist.quantile(0.99); p99 < 990*time.Millisecond || p99 > 1240*time.Millisecond {
+		t.Errorf("p99 = %v", p99)
+	}
+}
@@ -0,0 +1,173 @@
+package locks
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+)
+
+// Handler serves the /api/v1/locks endpoints:
+//
+//	GET    /api/v1/locks/{name}                 current state
+//	POST   /api/v1/locks/{name}                 acquire  {"holder": "...", "ttl": "5m"}
+//	PUT    /api/v1/locks/{name}                 renew    {"holder": "...", "ttl": "5m"}
+//	DELETE /api/v1/locks/{name}?holder=...      release
+//
+// Every call needs an authenticated user. A lock is taken on behalf of
+// the caller, who alone can renew or release it.
+type Handler struct {
+	manager *Manager
+	headers authz.Headers
+	logger  *zap.Logger
+}
+
+// NewHandler creates the HTTP handler for m, reading the caller from
+// headers.
+func NewHandler(m *Manager, headers authz.Headers, logger *zap.Logger) *Handler {
+	return &Handler{manager: m, headers: headers, logger: logger}
+}
+
+// Register mounts the handler on mux.
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/locks/{name}", h.get)
+	mux.HandleFunc("POST /api/v1/locks/{name}", h.acquire)
+	mux.HandleFunc("PUT /api/v1/locks/{name}", h.renew)
+	mux.HandleFunc("DELETE /api/v1/locks/{name}", h.release)
+}
+
+type lockRequest struct {
+	Holder string `json:"holder"`
+	TTL    string `json:"ttl"`
+}
+
+// caller returns the authenticated user, or writes an error.
+func (h *Handler) caller(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user := h.headers.Identity(r).User
+	if user == "" {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return "", false
+	}
+	return user, true
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.caller(w, r); !ok {
+		return
+	}
+	name, ok := lockName(w, r)
+	if !ok {
+		return
+	}
+	lock, err := h.manager.Get(r.Context(), name)
+	h.respond(w, lock, err)
+}
+
+func (h *Handler) acquire(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.caller(w, r)
+	if !ok {
+		return
+	}
+	name, ok := lockName(w, r)
+	if !ok {
+		return
+	}
+	req, ttl, ok := decode(w, r)
+	if !ok {
+		return
+	}
+	lock, err := h.manager.Acquire(r.Context(), name, user, req.Holder, ttl)
+	h.respond(w, lock, err)
+}
+
+func (h *Handler) renew(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.caller(w, r)
+	if !ok {
+		return
+	}
+	name, ok := lockName(w, r)
+	if !ok {
+		return
+	}
+	req, ttl, ok := decode(w, r)
+	if !ok {
+		return
+	}
+	lock, err := h.manager.Renew(r.Context(), name, user, req.Holder, ttl)
+	h.respond(w, lock, err)
+}
+
+func (h *Handler) release(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.caller(w, r)
+	if !ok {
+		return
+	}
+	name, ok := lockName(w, r)
+	if !ok {
+		return
+	}
+	holder := r.URL.Query().Get("holder")
+	if holder == "" {
+		http.Error(w, "holder is required", http.StatusBadRequest)
+		return
+	}
+	if err := h.manager.Release(r.Context(), name, user, holder); err != nil {
+		h.respond(w, Lock{}, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) respond(w http.ResponseWriter, lock Lock, err error) {
+	status := http.StatusOK
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, "lock not found", http.StatusNotFound)
+		return
+	case errors.Is(err, ErrHeld), errors.Is(err, ErrNotHeld):
+		// The body still describes the lock so callers can see who holds it
+		status = http.StatusConflict
+	case err != nil:
+		h.logger.Error("lock operation failed", zap.String("lock", lock.Name), zap.Error(err))
+		http.Error(w, "lock operation failed", http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, lock)
+}
+
+func lockName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name := r.PathValue("name")
+	if err := ValidateName(name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	return name, true
+}
+
+func decode(w http.ResponseWriter, r *http.Request) (lockRequest, time.Duration, bool) {
+	var req lockRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return req, 0, false
+	}
+	if req.Holder == "" {
+		http.Error(w, "holder is required", http.StatusBadRequest)
+		return req, 0, false
+	}
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl <= 0 {
+			http.Error(w, "invalid ttl", http.StatusBadRequest)
+			return req, 0, false
+		}
+	}
+	return req, ttl, true
+}
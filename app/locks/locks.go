@@ -0,0 +1,315 @@
+// Package locks implements named, expiring locks on coordination.k8s.io
+// Leases so CI jobs and scripts can serialise exclusive operations (one
+// migration at a time, one deploy per environment) through the platform API.
+package locks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	coordinationclient "k8s.io/client-go/kubernetes/typed/coordination/v1"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+)
+
+const (
+	leasePrefix = "platform-lock-"
+	lockLabel   = "platform.io/lock"
+	// ownerAnnotation records the user who took the lock; only they can
+	// renew or release it
+	ownerAnnotation = "platform.io/lock-owner"
+)
+
+var (
+	// ErrHeld means another holder owns an unexpired lock.
+	ErrHeld = errs.New(errs.Conflict, "lock is held by another holder")
+	// ErrNotHeld means the caller does not own the lock it tried to renew or release.
+	ErrNotHeld = errs.New(errs.Conflict, "lock is not held by caller")
+	// ErrNotFound means no lease exists for the lock.
+	ErrNotFound = errs.New(errs.NotFound, "lock not found")
+)
+
+var operationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "platform_lock_operations_total",
+	Help: "Lock operations by operation and result.",
+}, []string{"op", "result"})
+
+// Lock is the state of a named lock. Holder names the job holding it and
+// Owner the authenticated user who took it for the job.
+type Lock struct {
+	Name       string    `json:"name"`
+	Holder     string    `json:"holder"`
+	Owner      string    `json:"owner"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	RenewedAt  time.Time `json:"renewed_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Options configures the manager.
+type Options struct {
+	// Namespace holds the Lease objects.
+	Namespace string
+	// DefaultTTL applies when a request omits the TTL.
+	DefaultTTL time.Duration
+	// MaxTTL caps requested TTLs.
+	MaxTTL time.Duration
+}
+
+// Manager acquires, renews and releases locks.
+type Manager struct {
+	clientset kubernetes.Interface
+	opts      Options
+	logger    *zap.Logger
+	now       func() time.Time
+}
+
+// New creates a lock manager.
+func New(cs kubernetes.Interface, opts Options, logger *zap.Logger) *Manager {
+	return &Manager{clientset: cs, opts: opts, logger: logger, now: time.Now}
+}
+
+// ValidateName checks that name can be used as a lock name.
+func ValidateName(name string) error {
+	if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+		return fmt.Errorf("invalid lock name %q: %s", name, errs[0])
+	}
+	return nil
+}
+
+// Get returns the current state of a lock. Expired locks are still returned;
+// callers compare ExpiresAt.
+func (m *Manager) Get(ctx context.Context, name string) (Lock, error) {
+	lease, err := m.leases().Get(ctx, leasePrefix+name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return Lock{}, ErrNotFound
+	}
+	if err != nil {
+		return Lock{}, err
+	}
+	return toLock(name, lease), nil
+}
+
+// Acquire takes the lock for holder, on behalf of owner, for ttl. It
+// succeeds when the lock is free, expired, or already held by holder for
+// owner (which also renews it). On ErrHeld the current lock is returned.
+func (m *Manager) Acquire(ctx context.Context, name, owner, holder string, ttl time.Duration) (lock Lock, err error) {
+	defer func() { observe("acquire", err) }()
+
+	ttl = m.ttl(ttl)
+	now := metav1.NewMicroTime(m.now())
+	leases := m.leases()
+
+	lease, err := leases.Get(ctx, leasePrefix+name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        leasePrefix + name,
+				Namespace:   m.opts.Namespace,
+				Labels:      map[string]string{lockLabel: "true"},
+				Annotations: map[string]string{ownerAnnotation: owner},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &holder,
+				LeaseDurationSeconds: seconds(ttl),
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		created, err := leases.Create(ctx, lease, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			return m.current(ctx, name)
+		}
+		if err != nil {
+			return Lock{}, err
+		}
+		m.logger.Info("lock acquired", zap.String("lock", name), zap.String("holder", holder),
+			zap.String("owner", owner), zap.Duration("ttl", ttl))
+		return toLock(name, created), nil
+	}
+	if err != nil {
+		return Lock{}, err
+	}
+
+	current := toLock(name, lease)
+	taken := !current.heldBy(owner, holder)
+	if taken {
+		if current.ExpiresAt.After(now.Time) {
+			return current, ErrHeld
+		}
+		lease.Spec.AcquireTime = &now
+		t := int32(1)
+		if lease.Spec.LeaseTransitions != nil {
+			t = *lease.Spec.LeaseTransitions + 1
+		}
+		lease.Spec.LeaseTransitions = &t
+	}
+	if lease.Annotations == nil {
+		lease.Annotations = map[string]string{}
+	}
+	lease.Annotations[ownerAnnotation] = owner
+	lease.Spec.HolderIdentity = &holder
+	lease.Spec.LeaseDurationSeconds = seconds(ttl)
+	lease.Spec.RenewTime = &now
+
+	updated, err := leases.Update(ctx, lease, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		return m.current(ctx, name)
+	}
+	if err != nil {
+		return Lock{}, err
+	}
+	if taken {
+		m.logger.Info("lock acquired",
+			zap.String("lock", name),
+			zap.String("holder", holder),
+			zap.String("owner", owner),
+			zap.String("previous_holder", current.Holder),
+			zap.Duration("ttl", ttl),
+		)
+	}
+	return toLock(name, updated), nil
+}
+
+// Renew extends a lock held by holder for owner. A lock that expired but
+// has not been taken by anyone else can still be renewed.
+func (m *Manager) Renew(ctx context.Context, name, owner, holder string, ttl time.Duration) (lock Lock, err error) {
+	defer func() { observe("renew", err) }()
+
+	lease, err := m.leases().Get(ctx, leasePrefix+name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return Lock{}, ErrNotFound
+	}
+	if err != nil {
+		return Lock{}, err
+	}
+	if current := toLock(name, lease); !current.heldBy(owner, holder) {
+		return current, ErrNotHeld
+	}
+
+	now := metav1.NewMicroTime(m.now())
+	lease.Spec.LeaseDurationSeconds = seconds(m.ttl(ttl))
+	lease.Spec.RenewTime = &now
+	updated, err := m.leases().Update(ctx, lease, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		// Someone else touched the lease since our read; report its new state
+		current, gerr := m.Get(ctx, name)
+		if gerr != nil {
+			return Lock{}, gerr
+		}
+		return current, ErrNotHeld
+	}
+	if err != nil {
+		return Lock{}, err
+	}
+	return toLock(name, updated), nil
+}
+
+// Release deletes a lock held by holder for owner.
+func (m *Manager) Release(ctx context.Context, name, owner, holder string) (err error) {
+	defer func() { observe("release", err) }()
+
+	lease, err := m.leases().Get(ctx, leasePrefix+name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !toLock(name, lease).heldBy(owner, holder) {
+		return ErrNotHeld
+	}
+
+	err = m.leases().Delete(ctx, lease.Name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &lease.ResourceVersion},
+	})
+	if apierrors.IsConflict(err) {
+		return ErrNotHeld
+	}
+	if apierrors.IsNotFound(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	m.logger.Info("lock released", zap.String("lock", name), zap.String("holder", holder))
+	return nil
+}
+
+// current reports the state of a lock after losing a race for it.
+func (m *Manager) current(ctx context.Context, name string) (Lock, error) {
+	lock, err := m.Get(ctx, name)
+	if err != nil {
+		return Lock{}, err
+	}
+	return lock, ErrHeld
+}
+
+func (m *Manager) leases() coordinationclient.LeaseInterface {
+	return m.clientset.CoordinationV1().Leases(m.opts.Namespace)
+}
+
+func (m *Manager) ttl(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		ttl = m.opts.DefaultTTL
+	}
+	if m.opts.MaxTTL > 0 && ttl > m.opts.MaxTTL {
+		ttl = m.opts.MaxTTL
+	}
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	return ttl
+}
+
+// heldBy reports whether the lock is held by holder for owner. Leases
+// without an owner belong to nobody and can only expire.
+func (l Lock) heldBy(owner, holder string) bool {
+	return l.Owner != "" && l.Owner == owner && l.Holder == holder
+}
+
+func toLock(name string, lease *coordinationv1.Lease) Lock {
+	l := Lock{Name: name, Owner: lease.Annotations[ownerAnnotation]}
+	if lease.Spec.HolderIdentity != nil {
+		l.Holder = *lease.Spec.HolderIdentity
+	}
+	if lease.Spec.AcquireTime != nil {
+		l.AcquiredAt = lease.Spec.AcquireTime.Time
+	}
+	if lease.Spec.RenewTime != nil {
+		l.RenewedAt = lease.Spec.RenewTime.Time
+		if lease.Spec.LeaseDurationSeconds != nil {
+			l.ExpiresAt = l.RenewedAt.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+		}
+	}
+	return l
+}
+
+func seconds(d time.Duration) *int32 {
+	s := int32(d / time.Second)
+	return &s
+}
+
+func observe(op string, err error) {
+	result := "ok"
+	switch {
+	case errors.Is(err, ErrHeld):
+		result = "held"
+	case errors.Is(err, ErrNotHeld):
+		result = "not_held"
+	case errors.Is(err, ErrNotFound):
+		result = "not_found"
+	case err != nil:
+		result = "error"
+	}
+	operationsTotal.WithLabelValues(op, result).Inc()
+}
@@ -0,0 +1,144 @@
+package locks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+)
+
+func newManager() (*Manager, *time.Time) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := New(fake.NewClientset(), Options{Namespace: "platform", DefaultTTL: time.Minute, MaxTTL: time.Hour}, zap.NewNop())
+	m.now = func() time.Time { return now }
+	return m, &now
+}
+
+func TestAcquireExclusive(t *testing.T) {
+	m, now := newManager()
+	ctx := context.Background()
+
+	if _, err := m.Acquire(ctx, "migrate", "alice", "job-a", time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lock, err := m.Acquire(ctx, "migrate", "alice", "job-b", time.Minute)
+	if !errors.Is(err, ErrHeld) {
+		t.Fatalf("expected ErrHeld, got %v", err)
+	}
+	if lock.Holder != "job-a" {
+		t.Errorf("expected holder job-a, got %q", lock.Holder)
+	}
+
+	// Re-acquiring by the holder is idempotent
+	if _, err := m.Acquire(ctx, "migrate", "alice", "job-a", time.Minute); err != nil {
+		t.Errorf("expected re-acquire to succeed, got %v", err)
+	}
+
+	*now = now.Add(2 * time.Minute)
+	lock, err = m.Acquire(ctx, "migrate", "alice", "job-b", time.Minute)
+	if err != nil {
+		t.Fatalf("expected expired lock to be taken over, got %v", err)
+	}
+	if lock.Holder != "job-b" {
+		t.Errorf("expected holder job-b, got %q", lock.Holder)
+	}
+}
+
+func TestRenewAndRelease(t *testing.T) {
+	m, now := newManager()
+	ctx := context.Background()
+
+	if _, err := m.Acquire(ctx, "deploy", "alice", "job-a", time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := m.Renew(ctx, "deploy", "alice", "job-b", time.Minute); !errors.Is(err, ErrNotHeld) {
+		t.Errorf("expected ErrNotHeld, got %v", err)
+	}
+
+	*now = now.Add(30 * time.Second)
+	lock, err := m.Renew(ctx, "deploy", "alice", "job-a", 5*time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := now.Add(5 * time.Minute); !lock.ExpiresAt.Equal(want) {
+		t.Errorf("expected expiry %v, got %v", want, lock.ExpiresAt)
+	}
+
+	if err := m.Release(ctx, "deploy", "alice", "job-b"); !errors.Is(err, ErrNotHeld) {
+		t.Errorf("expected ErrNotHeld, got %v", err)
+	}
+	// Another user cannot touch the lock, even naming the same holder
+	if _, err := m.Renew(ctx, "deploy", "bob", "job-a", time.Minute); !errors.Is(err, ErrNotHeld) {
+		t.Errorf("expected ErrNotHeld for another owner, got %v", err)
+	}
+	if err := m.Release(ctx, "deploy", "bob", "job-a"); !errors.Is(err, ErrNotHeld) {
+		t.Errorf("expected ErrNotHeld for another owner, got %v", err)
+	}
+	if _, err := m.Acquire(ctx, "deploy", "bob", "job-a", time.Minute); !errors.Is(err, ErrHeld) {
+		t.Errorf("expected ErrHeld for another owner, got %v", err)
+	}
+
+	if err := m.Release(ctx, "deploy", "alice", "job-a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := m.Get(ctx, "deploy"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound after release, got %v", err)
+	}
+}
+
+func TestTTLCapped(t *testing.T) {
+	m, now := newManager()
+	lock, err := m.Acquire(context.Background(), "long", "alice", "job-a", 24*time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := now.Add(time.Hour); !lock.ExpiresAt.Equal(want) {
+		t.Errorf("expected expiry capped at %v, got %v", want, lock.ExpiresAt)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	m, _ := newManager()
+	mux := http.NewServeMux()
+	NewHandler(m, authz.Headers{User: "X-Auth-User"}, zap.NewNop()).Register(mux)
+
+	do := func(user, method, path, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if user != "" {
+			req.Header.Set("X-Auth-User", user)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := do("", http.MethodPost, "/api/v1/locks/migrate", `{"holder":"job-a"}`); code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", code)
+	}
+	if code := do("alice", http.MethodPost, "/api/v1/locks/migrate", `{"holder":"job-a","ttl":"5m"}`); code != http.StatusOK {
+		t.Errorf("expected 200, got %d", code)
+	}
+	if code := do("alice", http.MethodPost, "/api/v1/locks/migrate", `{"holder":"job-b"}`); code != http.StatusConflict {
+		t.Errorf("expected 409, got %d", code)
+	}
+	if code := do("alice", http.MethodPost, "/api/v1/locks/Bad_Name", `{"holder":"job-b"}`); code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", code)
+	}
+	if code := do("bob", http.MethodDelete, "/api/v1/locks/migrate?holder=job-a", ""); code != http.StatusConflict {
+		t.Errorf("expected 409 releasing another user's lock, got %d", code)
+	}
+	if code := do("alice", http.MethodDelete, "/api/v1/locks/migrate?holder=job-a", ""); code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", code)
+	}
+	if code := do("alice", http.MethodGet, "/api/v1/locks/migrate", ""); code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", code)
+	}
+}
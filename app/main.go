@@ -3,101 +3,105 @@
 package main
 
 import (
-	"context"
-	"fmt"
-	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
 
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/app"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/cgroup"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
 	"github.com/virenpatel/k8s-platform-engineering-lab/app/config"
-	"github.com/virenpatel/k8s-platform-engineering-lab/app/handlers"
 	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/redact"
 
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 )
 
 func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// setup loads the configuration, running mode unless it is empty, and
+// prepares what every mode shares: the logger, the redactor, the JSON
+// codec and the runtime's container limits.
+func setup(mode string) (*config.Config, *redact.Redactor, *cgroup.Limits, *zap.Logger) {
 	// ─── Load Configuration ──────────────────────────────────────────
 	cfg := config.Load()
+	if mode != "" {
+		cfg.Mode = mode
+	}
 
 	// ─── Initialize Structured Logger ────────────────────────────────
 	logger := middleware.NewLogger(cfg.LogLevel, cfg.Environment)
-	defer logger.Sync()
-
-	logger.Info("starting platform API service",
-		zap.String("version", cfg.Version),
-		zap.String("environment", cfg.Environment),
-		zap.Int("port", cfg.Port),
-	)
-
-	// ─── Initialize Handlers ─────────────────────────────────────────
-	healthHandler := handlers.NewHealthHandler(logger, cfg)
-	apiHandler := handlers.NewAPIHandler(logger, cfg)
-
-	// ─── Configure Routes ────────────────────────────────────────────
-	mux := http.NewServeMux()
-
-	// Health & readiness probes (Kubernetes)
-	mux.HandleFunc("/healthz", healthHandler.Liveness)
-	mux.HandleFunc("/readyz", healthHandler.Readiness)
-
-	// Prometheus metrics endpoint
-	mux.Handle("/metrics", promhttp.Handler())
-
-	// Root endpoint (optional catch-all for testing)
-	mux.HandleFunc("/", apiHandler.Info)
-
-	// Application API routes
-	mux.HandleFunc("/api/v1/info", apiHandler.Info)
-	mux.HandleFunc("/api/v1/status", apiHandler.Status)
-
-	// ─── Apply Middleware ────────────────────────────────────────────
-	handler := middleware.RequestID(
-		middleware.Logging(logger,
-			middleware.Recovery(logger,
-				middleware.CORS(mux),
-			),
-		),
-	)
-
-	// ─── Create Server ───────────────────────────────────────────────
-	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", cfg.Port),
-		Handler:      handler,
-		ReadTimeout:  cfg.ReadTimeout,
-		WriteTimeout: cfg.WriteTimeout,
-		IdleTimeout:  cfg.IdleTimeout,
+	for _, err := range cfg.Malformed() {
+		logger.Warn("ignoring malformed setting, using its default", zap.Error(err))
 	}
 
-	// ─── Start Server (non-blocking) ─────────────────────────────────
-	go func() {
-		logger.Info("server listening", zap.String("addr", server.Addr))
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Fatal("server failed to start", zap.Error(err))
+	// Sensitive data is masked before it is logged, audited or served for
+	// debugging; the redactor itself logs unmasked
+	var redactor *redact.Redactor
+	if cfg.RedactionEnabled {
+		var err error
+		if redactor, err = redact.New(cfg.RedactionRulesFile, logger); err != nil {
+			logger.Fatal("invalid redaction policy", zap.Error(err))
 		}
-	}()
-
-	// ─── Graceful Shutdown ───────────────────────────────────────────
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	sig := <-quit
-
-	logger.Info("received shutdown signal", zap.String("signal", sig.String()))
+		logger = logger.WithOptions(zap.WrapCore(redactor.WrapCore))
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
-	defer cancel()
+	if err := codec.Use(cfg.JSONCodec); err != nil {
+		logger.Fatal("invalid JSON_CODEC", zap.Error(err))
+	}
 
-	// Mark service as not ready (Kubernetes will stop sending traffic)
-	healthHandler.SetNotReady()
+	// Before anything sizes itself by GOMAXPROCS
+	var limits *cgroup.Limits
+	if cfg.CgroupLimits {
+		l, err := cgroup.Read(cgroup.Root)
+		if err != nil {
+			logger.Warn("failed to read cgroup limits", zap.Error(err))
+		}
+		l = cgroup.Apply(l, cfg.MemoryLimitRatio)
+		limits = &l
+		logger.Info("runtime sized to container limits",
+			zap.Float64("cpu_quota", l.CPUQuota),
+			zap.Int64("memory_limit_bytes", l.MemoryLimit),
+			zap.Int("gomaxprocs", l.GOMAXPROCS),
+			zap.String("gomaxprocs_source", l.GOMAXPROCSSource),
+			zap.Int64("gomemlimit_bytes", l.GOMEMLIMIT),
+			zap.String("gomemlimit_source", l.GOMEMLIMITSource),
+		)
+	}
+	return cfg, redactor, limits, logger
+}
 
-	// Allow in-flight requests to drain
-	logger.Info("draining connections", zap.Duration("timeout", cfg.ShutdownTimeout))
+// run runs mode, or the mode RUN_MODE selects if mode is empty.
+func run(mode string) {
+	cfg, redactor, limits, logger := setup(mode)
+	defer logger.Sync()
 
-	if err := server.Shutdown(ctx); err != nil {
-		logger.Error("forced shutdown", zap.Error(err))
+	switch cfg.Mode {
+	case config.ModeAPI:
+		runServe(cfg, redactor, limits, logger)
+	case config.ModeController:
+		runController(cfg, redactor, logger)
+	case config.ModeMigrate:
+		runMigrate(cfg, logger)
+	case config.ModeVerifyAudit:
+		runVerifyAudit(cfg, logger)
+	default:
+		logger.Fatal("unknown run mode", zap.String("mode", cfg.Mode))
 	}
+}
 
+// runServe serves the public API, plus whatever the configuration embeds:
+// controllers, webhooks, gRPC and the admin listener.
+func runServe(cfg *config.Config, redactor *redact.Redactor, limits *cgroup.Limits, logger *zap.Logger) {
+	a, err := app.New(cfg, app.Options{Logger: logger, Redactor: redactor, Limits: limits})
+	if err != nil {
+		logger.Fatal("failed to assemble service", zap.Error(err))
+	}
+	// Exiting non-zero on a failed start lets Kubernetes back off restarts
+	if err := a.Run(); err != nil {
+		logger.Fatal("service stopped with errors", zap.Error(err))
+	}
 	logger.Info("server stopped gracefully")
 }
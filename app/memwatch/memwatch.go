@@ -0,0 +1,300 @@
+// Package memwatch keeps the service clear of the OOM killer. A watchdog
+// compares the process's memory with the container's limit every interval
+// and, as it gets closer, takes stronger measures:
+//
+//	gc          collect garbage and return freed memory to the OS
+//	caches      also drop the caches registered with OnPressure
+//	not-ready   also fail readiness, so no new traffic arrives
+//	shutdown    shut down gracefully, while there is memory left to drain
+//
+// A SIGKILL from the OOM killer drops every in-flight request; a graceful
+// shutdown lets them finish and Kubernetes restarts the container all the
+// same. Each stage publishes an event, and the watchdog steps back down once
+// memory falls a margin below the stage's threshold.
+package memwatch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"runtime/debug"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+)
+
+// Stage is how close memory is to the limit.
+type Stage int
+
+const (
+	StageNormal Stage = iota
+	StageGC
+	StageCaches
+	StageNotReady
+	StageShutdown
+)
+
+var stageNames = [...]string{"normal", "gc", "caches", "not-ready", "shutdown"}
+
+func (s Stage) String() string { return stageNames[s] }
+
+// Event types published on the bus.
+const (
+	EventPressure  = "memory.pressure"
+	EventRecovered = "memory.recovered"
+)
+
+// margin is how far, as a fraction of the limit, memory must fall below a
+// stage's threshold before the watchdog steps back down.
+const margin = 0.05
+
+var (
+	usageGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "memwatch_usage_bytes",
+		Help: "Memory used by the process: its resident set, or the Go runtime's memory where that is unknown.",
+	})
+	heapGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "memwatch_heap_bytes",
+		Help: "Bytes of live and not yet collected heap objects.",
+	})
+	limitGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "memwatch_limit_bytes",
+		Help: "The container's memory limit.",
+	})
+	stageGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "memwatch_stage",
+		Help: "Watchdog stage: 0 normal, 1 gc, 2 caches, 3 not-ready, 4 shutdown.",
+	})
+	actionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "memwatch_actions_total",
+		Help: "Protective actions taken, by action (gc, drop-cache, not-ready or shutdown).",
+	}, []string{"action"})
+)
+
+// Options configures a Watchdog. Thresholds are fractions of Limit.
+type Options struct {
+	// Limit is the container's memory limit in bytes.
+	Limit    int64
+	Interval time.Duration
+
+	GCThreshold       float64
+	CachesThreshold   float64
+	NotReadyThreshold float64
+	ShutdownThreshold float64
+
+	// Shutdown starts the service's graceful shutdown.
+	Shutdown func()
+}
+
+// Watchdog watches memory; start it with Run.
+type Watchdog struct {
+	opts   Options
+	bus    events.Publisher
+	logger *zap.Logger
+
+	stage atomic.Int32
+	usage func() (usage, heap int64)
+
+	mu     sync.Mutex
+	caches []namedDrop
+}
+
+type namedDrop struct {
+	name string
+	drop func()
+}
+
+// New creates a watchdog. bus may be nil.
+func New(opts Options, bus events.Publisher, logger *zap.Logger) *Watchdog {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	limitGauge.Set(float64(opts.Limit))
+	return &Watchdog{opts: opts, bus: bus, logger: logger, usage: readUsage}
+}
+
+// OnPressure registers drop to free a cache from the caches stage on.
+func (w *Watchdog) OnPressure(name string, drop func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.caches = append(w.caches, namedDrop{name: name, drop: drop})
+}
+
+// Stage returns the current stage.
+func (w *Watchdog) Stage() Stage {
+	return Stage(w.stage.Load())
+}
+
+// Check is a readiness check failing from the not-ready stage on.
+func (w *Watchdog) Check(context.Context) error {
+	if w.Stage() >= StageNotReady {
+		return errors.New("memory close to the container limit")
+	}
+	return nil
+}
+
+// Run checks memory every interval until ctx is done.
+func (w *Watchdog) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.check(ctx)
+		}
+	}
+}
+
+func (w *Watchdog) check(ctx context.Context) {
+	usage, heap := w.usage()
+	usageGauge.Set(float64(usage))
+	heapGauge.Set(float64(heap))
+
+	ratio := float64(usage) / float64(w.opts.Limit)
+	previous := w.Stage()
+	stage := w.stageFor(ratio)
+	switch {
+	case previous == StageShutdown:
+		return
+	case stage < previous && ratio > w.threshold(previous)-margin:
+		// Not far enough below to step down yet
+		return
+	case stage == previous:
+		return
+	}
+	w.stage.Store(int32(stage))
+	stageGauge.Set(float64(stage))
+
+	fields := []zap.Field{
+		zap.Stringer("stage", stage),
+		zap.Int64("usage_bytes", usage),
+		zap.Int64("heap_bytes", heap),
+		zap.Int64("limit_bytes", w.opts.Limit),
+	}
+	if stage < previous {
+		w.logger.Info("memory pressure eased", fields...)
+		if stage == StageNormal {
+			w.publish(ctx, EventRecovered, stage, usage)
+		}
+		return
+	}
+	w.logger.Warn("memory pressure", fields...)
+	w.publish(ctx, EventPressure, stage, usage)
+	w.act(stage)
+}
+
+// act takes the measures of stage.
+func (w *Watchdog) act(stage Stage) {
+	if stage >= StageCaches {
+		w.mu.Lock()
+		caches := w.caches
+		w.mu.Unlock()
+		for _, c := range caches {
+			c.drop()
+			actionsTotal.WithLabelValues("drop-cache").Inc()
+			w.logger.Info("dropped cache under memory pressure", zap.String("cache", c.name))
+		}
+	}
+	// After dropping caches, so that their memory is collected too
+	debug.FreeOSMemory()
+	actionsTotal.WithLabelValues("gc").Inc()
+	if stage >= StageNotReady {
+		actionsTotal.WithLabelValues("not-ready").Inc()
+	}
+	if stage == StageShutdown {
+		actionsTotal.WithLabelValues("shutdown").Inc()
+		w.logger.Error("shutting down before the OOM killer does")
+		if w.opts.Shutdown != nil {
+			w.opts.Shutdown()
+		}
+	}
+}
+
+func (w *Watchdog) stageFor(ratio float64) Stage {
+	for stage := StageShutdown; stage > StageNormal; stage-- {
+		if ratio >= w.threshold(stage) {
+			return stage
+		}
+	}
+	return StageNormal
+}
+
+func (w *Watchdog) threshold(stage Stage) float64 {
+	switch stage {
+	case StageGC:
+		return w.opts.GCThreshold
+	case StageCaches:
+		return w.opts.CachesThreshold
+	case StageNotReady:
+		return w.opts.NotReadyThreshold
+	case StageShutdown:
+		return w.opts.ShutdownThreshold
+	}
+	return 0
+}
+
+func (w *Watchdog) publish(ctx context.Context, typ string, stage Stage, usage int64) {
+	if w.bus == nil {
+		return
+	}
+	e, err := events.New(typ, "memwatch", map[string]any{
+		"stage":       stage.String(),
+		"usage_bytes": usage,
+		"limit_bytes": w.opts.Limit,
+	})
+	if err != nil {
+		return
+	}
+	if err := w.bus.Publish(ctx, e); err != nil {
+		w.logger.Warn("failed to publish memory event", zap.Error(err))
+	}
+}
+
+var samples = []metrics.Sample{
+	{Name: "/memory/classes/heap/objects:bytes"},
+	{Name: "/memory/classes/total:bytes"},
+	{Name: "/memory/classes/heap/released:bytes"},
+}
+
+// readUsage returns the resident set size of the process, or the memory the
+// Go runtime has mapped and not released where that is unknown, and the
+// heap.
+func readUsage() (usage, heap int64) {
+	s := make([]metrics.Sample, len(samples))
+	copy(s, samples)
+	metrics.Read(s)
+	heap = int64(s[0].Value.Uint64())
+	if rss := residentSet(); rss > 0 {
+		return rss, heap
+	}
+	return int64(s[1].Value.Uint64() - s[2].Value.Uint64()), heap
+}
+
+// residentSet reads the resident set size from /proc/self/statm, 0 where
+// there is none.
+func residentSet() int64 {
+	b, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) < 2 {
+		return 0
+	}
+	pages, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return pages * int64(os.Getpagesize())
+}
@@ -0,0 +1,67 @@
+package memwatch
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+)
+
+func TestWatchdog(t *testing.T) {
+	bus := events.NewMemoryBus()
+	var published []string
+	bus.Subscribe(func(_ context.Context, e events.Event) { published = append(published, e.Type) })
+	shutdowns := 0
+	w := New(Options{
+		Limit:             1000,
+		GCThreshold:       0.8,
+		CachesThreshold:   0.85,
+		NotReadyThreshold: 0.9,
+		ShutdownThreshold: 0.95,
+		Shutdown:          func() { shutdowns++ },
+	}, bus, zap.NewNop())
+	drops := 0
+	w.OnPressure("test", func() { drops++ })
+	var used int64
+	w.usage = func() (int64, int64) { return used, used / 2 }
+	step := func(usage int64, want Stage) {
+		t.Helper()
+		used = usage
+		w.check(t.Context())
+		if w.Stage() != want {
+			t.Fatalf("at %d: stage %v, want %v", usage, w.Stage(), want)
+		}
+	}
+
+	step(500, StageNormal)
+	step(820, StageGC)
+	if drops != 0 || w.Check(t.Context()) != nil {
+		t.Fatalf("gc stage: %d drops, check %v", drops, w.Check(t.Context()))
+	}
+	step(910, StageNotReady)
+	if drops != 1 || w.Check(t.Context()) == nil {
+		t.Fatalf("not-ready stage: %d drops, check %v", drops, w.Check(t.Context()))
+	}
+
+	// Stepping down takes a margin below the threshold
+	step(880, StageNotReady)
+	step(840, StageGC)
+	if w.Check(t.Context()) != nil {
+		t.Error("still not ready at the gc stage")
+	}
+	step(100, StageNormal)
+
+	// Shutdown is final
+	step(960, StageShutdown)
+	step(100, StageShutdown)
+	if shutdowns != 1 || drops != 2 {
+		t.Errorf("%d shutdowns, %d drops", shutdowns, drops)
+	}
+	want := []string{EventPressure, EventPressure, EventRecovered, EventPressure}
+	if !slices.Equal(published, want) {
+		t.Errorf("published %v, want %v", published, want)
+	}
+}
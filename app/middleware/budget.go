@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+var budgetViolations = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_server_latency_budget_violations_total",
+	Help: "Requests served slower than their route's latency budget, by route.",
+}, []string{"route"})
+
+// LatencyBudget checks how long next, a ServeMux, takes to serve each
+// request against the budget of the route it matched. budgets is keyed by
+// route pattern as registered, e.g. "GET /api/v1/workloads"; other routes
+// get fallback, and a budget of 0 exempts a route. A slow request is logged
+// with a link to its trace, built from traceURL by replacing "{trace_id}",
+// and counted in http_server_latency_budget_violations_total.
+func LatencyBudget(budgets map[string]time.Duration, fallback time.Duration, traceURL string, logger *zap.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		wrapped := newResponseWriter(w)
+		defer wrapped.release()
+
+		next.ServeHTTP(wrapped, r)
+
+		// The mux sets the pattern on the request it was given
+		if r.Pattern == "" {
+			return
+		}
+		budget, ok := budgets[r.Pattern]
+		if !ok {
+			budget = fallback
+		}
+		duration := time.Since(start)
+		if budget <= 0 || duration <= budget {
+			return
+		}
+		budgetViolations.WithLabelValues(r.Pattern).Inc()
+		traceID := TraceID(r)
+		fields := []zap.Field{
+			zap.String("request_id", GetRequestID(r.Context())),
+			zap.String("route", r.Pattern),
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Int("status", wrapped.statusCode),
+			zap.Duration("duration", duration),
+			zap.Duration("budget", budget),
+			zap.String("trace_id", traceID),
+		}
+		if traceURL != "" {
+			fields = append(fields, zap.String("trace_url", strings.ReplaceAll(traceURL, "{trace_id}", traceID)))
+		}
+		logger.Warn("latency budget exceeded", fields...)
+	})
+}
+
+// TraceID returns the trace ID of the W3C traceparent header, or the
+// request ID for requests outside a trace.
+func TraceID(r *http.Request) string {
+	// version-traceid-parentid-flags
+	parts := strings.Split(r.Header.Get("traceparent"), "-")
+	if len(parts) == 4 && len(parts[1]) == 32 && strings.Trim(parts[1], "0") != "" {
+		return parts[1]
+	}
+	return GetRequestID(r.Context())
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLatencyBudget(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /slow/{id}", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusAccepted)
+	})
+	mux.HandleFunc("GET /exempt", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	})
+	mux.HandleFunc("GET /default", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	})
+	mux.HandleFunc("GET /fast", func(w http.ResponseWriter, r *http.Request) {})
+
+	core, logs := observer.New(zapcore.WarnLevel)
+	budgets := map[string]time.Duration{"GET /slow/{id}": 5 * time.Millisecond, "GET /exempt": 0}
+	h := LatencyBudget(budgets, 10*time.Millisecond, "https://traces.example.com/trace/{trace_id}", zap.New(core), mux)
+
+	serve(h, http.MethodGet, "/slow/1", "", "", "traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	serve(h, http.MethodGet, "/exempt", "", "", "traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	serve(h, http.MethodGet, "/default", "", "")
+	serve(h, http.MethodGet, "/fast", "", "")
+	serve(h, http.MethodGet, "/missing", "", "")
+
+	if got := testutil.ToFloat64(budgetViolations.WithLabelValues("GET /slow/{id}")); got != 1 {
+		t.Errorf("violations of GET /slow/{id} = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(budgetViolations.WithLabelValues("GET /default")); got != 1 {
+		t.Errorf("violations of GET /default = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(budgetViolations.WithLabelValues("GET /exempt")); got != 0 {
+		t.Errorf("violations of exempt route = %v, want 0", got)
+	}
+	entries := logs.FilterMessage("latency budget exceeded").All()
+	if len(entries) != 2 {
+		t.Fatalf("got %d slow request records, want 2", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields["route"] != "GET /slow/{id}" || fields["status"] != int64(http.StatusAccepted) {
+		t.Errorf("route, status = %v, %v", fields["route"], fields["status"])
+	}
+	if want := "https://traces.example.com/trace/4bf92f3577b34da6a3ce929d0e0e4736"; fields["trace_url"] != want {
+		t.Errorf("trace_url = %v, want %s", fields["trace_url"], want)
+	}
+}
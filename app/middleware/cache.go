@@ -0,0 +1,294 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/cache"
+)
+
+// maxCapturedBytes caps the responses kept for replay; larger ones pass
+// through uncached.
+const maxCapturedBytes = 1 << 20
+
+// idempotencyLockTTL bounds how long a crashed replica's in-progress
+// marker blocks retries of the same key.
+const idempotencyLockTTL = 5 * time.Minute
+
+// replayedHeaders are the response headers kept with a stored response.
+var replayedHeaders = []string{"Content-Type", "Content-Encoding", "Location", "ETag"}
+
+// storedResponse is a response kept in the cache for replay.
+type storedResponse struct {
+	// Fingerprint identifies the request that produced an idempotent
+	// response, so a key reused for a different request is refused.
+	Fingerprint string      `json:"fingerprint,omitempty"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+}
+
+func (s *storedResponse) write(w http.ResponseWriter) {
+	for k, v := range s.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(s.Status)
+	w.Write(s.Body)
+}
+
+// captureWriter passes a response through while keeping a copy of it.
+type captureWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+	// incomplete is set when the body outgrew maxCapturedBytes or was
+	// flushed as a stream, so the copy must not be replayed.
+	incomplete bool
+}
+
+func (cw *captureWriter) WriteHeader(code int) {
+	if cw.status == 0 {
+		cw.status = code
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *captureWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if !cw.incomplete {
+		if cw.body.Len()+len(b) > maxCapturedBytes {
+			cw.incomplete = true
+			cw.body.Reset()
+		} else {
+			cw.body.Write(b)
+		}
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *captureWriter) Flush() {
+	cw.incomplete = true
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *captureWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *captureWriter) stored(fingerprint string) ([]byte, bool) {
+	if cw.status == 0 || cw.incomplete {
+		return nil, false
+	}
+	header := http.Header{}
+	for _, k := range replayedHeaders {
+		if v := cw.Header().Values(k); len(v) > 0 {
+			header[k] = v
+		}
+	}
+	b, err := json.Marshal(storedResponse{Fingerprint: fingerprint, Status: cw.status, Header: header, Body: cw.body.Bytes()})
+	return b, err == nil
+}
+
+// clientKey identifies the caller: the authenticated user when the proxy
+// sets userHeader, otherwise the remote address.
+func clientKey(r *http.Request, userHeader string) string {
+	if user := r.Header.Get(userHeader); user != "" {
+		return "user:" + user
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func hash(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		io.WriteString(h, p)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Idempotency makes writes carrying an Idempotency-Key header safe to
+// retry: the first response below 500 is kept for ttl and replayed to
+// retries of the same key by the same caller. A retry arriving while the
+// first request runs gets 409, and reusing a key for a different request
+// gets 422. Cache failures let requests through unprotected.
+func Idempotency(c cache.Cache, ttl time.Duration, userHeader string, logger *zap.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idemKey := r.Header.Get("Idempotency-Key")
+		if idemKey == "" || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(idemKey) > 255 {
+			http.Error(w, `{"error":"Idempotency-Key must be at most 255 characters"}`, http.StatusBadRequest)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxCapturedBytes))
+		if err != nil {
+			http.Error(w, `{"error":"failed to read request body"}`, http.StatusBadRequest)
+			return
+		}
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		fingerprint := hash(r.Method, r.URL.RequestURI(), string(body))
+		key := "idempotency:" + hash(clientKey(r, userHeader), idemKey)
+		warn := func(msg string, err error) {
+			logger.Warn(msg,
+				zap.String("request_id", GetRequestID(r.Context())),
+				zap.String("path", r.URL.Path),
+				zap.Error(err),
+			)
+		}
+
+		ctx := r.Context()
+		if b, err := c.Get(ctx, key); err == nil {
+			var stored storedResponse
+			if err := json.Unmarshal(b, &stored); err == nil {
+				if stored.Fingerprint != fingerprint {
+					http.Error(w, `{"error":"Idempotency-Key was already used for a different request"}`, http.StatusUnprocessableEntity)
+					return
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				stored.write(w)
+				return
+			}
+		} else if !errors.Is(err, cache.ErrMiss) {
+			warn("idempotency cache unavailable", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		acquired, err := c.SetNX(ctx, key+":lock", []byte(GetRequestID(ctx)), idempotencyLockTTL)
+		if err != nil {
+			warn("idempotency cache unavailable", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !acquired {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, `{"error":"a request with this Idempotency-Key is in progress"}`, http.StatusConflict)
+			return
+		}
+		// Finish bookkeeping even when the client has gone away
+		bg := context.WithoutCancel(ctx)
+		defer c.Delete(bg, key+":lock")
+
+		cw := &captureWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r)
+		if cw.status >= http.StatusInternalServerError {
+			return
+		}
+		if b, ok := cw.stored(fingerprint); ok {
+			if err := c.Set(bg, key, b, ttl); err != nil {
+				warn("failed to store idempotent response", err)
+			}
+		}
+	})
+}
+
+// RateLimit allows each caller (see clientKey) limit requests per fixed
+// window, answering 429 beyond that. Cache failures let requests through.
+func RateLimit(c cache.Cache, limit int, window time.Duration, userHeader string, logger *zap.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now().Truncate(window)
+		reset := int(time.Until(start.Add(window)).Seconds()) + 1
+		key := "ratelimit:" + clientKey(r, userHeader) + ":" + strconv.FormatInt(start.Unix(), 10)
+		n, err := c.Incr(r.Context(), key, window)
+		if err != nil {
+			logger.Warn("rate limit cache unavailable",
+				zap.String("request_id", GetRequestID(r.Context())),
+				zap.Error(err),
+			)
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(max(int64(limit)-n, 0), 10))
+		w.Header().Set("X-RateLimit-Reset", strconv.Itoa(reset))
+		if n > int64(limit) {
+			w.Header().Set("Retry-After", strconv.Itoa(reset))
+			http.Error(w, `{"error":"rate limit exceeded"}`, http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ResponseCache serves GET requests under the path prefixes from the cache
+// for ttl. Responses vary by URL and by the values of the vary headers, so
+// callers with different identities never share an entry. Only complete
+// 200 responses are kept; "Cache-Control: no-cache" on the request skips
+// the lookup.
+func ResponseCache(c cache.Cache, ttl time.Duration, prefixes, vary []string, logger *zap.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !hasPrefix(r.URL.Path, prefixes) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		parts := []string{r.URL.RequestURI()}
+		for _, h := range vary {
+			parts = append(parts, r.Header.Get(h))
+		}
+		key := "response:" + hash(parts...)
+
+		ctx := r.Context()
+		if !strings.Contains(r.Header.Get("Cache-Control"), "no-cache") {
+			if b, err := c.Get(ctx, key); err == nil {
+				var stored storedResponse
+				if err := json.Unmarshal(b, &stored); err == nil {
+					w.Header().Set("X-Cache", "HIT")
+					stored.write(w)
+					return
+				}
+			} else if !errors.Is(err, cache.ErrMiss) {
+				logger.Warn("response cache unavailable",
+					zap.String("request_id", GetRequestID(ctx)),
+					zap.Error(err),
+				)
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		w.Header().Set("X-Cache", "MISS")
+		cw := &captureWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r)
+		if cw.status != http.StatusOK || strings.Contains(cw.Header().Get("Cache-Control"), "no-store") {
+			return
+		}
+		if b, ok := cw.stored(""); ok {
+			if err := c.Set(context.WithoutCancel(ctx), key, b, ttl); err != nil {
+				logger.Warn("failed to cache response", zap.String("path", r.URL.Path), zap.Error(err))
+			}
+		}
+	})
+}
+
+func hasPrefix(path string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/cache"
+)
+
+func serve(h http.Handler, method, target, user, body string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("X-Forwarded-User", user)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotency(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	h := Idempotency(cache.NewMemory(), time.Hour, "X-Forwarded-User", zap.NewNop(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		if string(body) == "slow" {
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"call":%d}`, n)
+	}))
+
+	first := serve(h, http.MethodPost, "/api/v1/tenants", "alice", `{"name":"a"}`, "Idempotency-Key", "k1")
+	retry := serve(h, http.MethodPost, "/api/v1/tenants", "alice", `{"name":"a"}`, "Idempotency-Key", "k1")
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("expected the first response replayed, got %d %s", retry.Code, retry.Body.String())
+	}
+	if rec := serve(h, http.MethodPost, "/api/v1/tenants", "alice", `{"name":"b"}`, "Idempotency-Key", "k1"); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 reusing a key for another request, got %d", rec.Code)
+	}
+	// Keys are scoped to the caller
+	if rec := serve(h, http.MethodPost, "/api/v1/tenants", "bob", `{"name":"a"}`, "Idempotency-Key", "k1"); rec.Body.String() != `{"call":2}` {
+		t.Errorf("expected bob's request to run, got %s", rec.Body.String())
+	}
+	serve(h, http.MethodPost, "/api/v1/tenants", "alice", `{"name":"a"}`)
+	if calls.Load() != 3 {
+		t.Errorf("expected 3 handler calls, got %d", calls.Load())
+	}
+
+	done := make(chan struct{})
+	go func() {
+		serve(h, http.MethodPost, "/api/v1/tenants", "alice", "slow", "Idempotency-Key", "k2")
+		close(done)
+	}()
+	for calls.Load() != 4 {
+		time.Sleep(time.Millisecond)
+	}
+	if rec := serve(h, http.MethodPost, "/api/v1/tenants", "alice", "slow", "Idempotency-Key", "k2"); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 while the first request runs, got %d", rec.Code)
+	}
+	close(release)
+	<-done
+}
+
+func TestRateLimit(t *testing.T) {
+	h := RateLimit(cache.NewMemory(), 2, time.Hour, "X-Forwarded-User", zap.NewNop(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		rec := serve(h, http.MethodGet, "/api/v1/services", "alice", "")
+		if rec.Code != want {
+			t.Errorf("request %d: expected %d, got %d", i+1, want, rec.Code)
+		}
+		if i == 2 && (rec.Header().Get("Retry-After") == "" || rec.Header().Get("X-RateLimit-Remaining") != "0") {
+			t.Errorf("expected rate limit headers, got %v", rec.Header())
+		}
+	}
+	if rec := serve(h, http.MethodGet, "/api/v1/services", "bob", ""); rec.Code != http.StatusOK {
+		t.Errorf("expected another caller to have its own limit, got %d", rec.Code)
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	var calls atomic.Int32
+	h := ResponseCache(cache.NewMemory(), time.Hour, []string{"/api/v1/catalog"}, []string{"X-Forwarded-User"}, zap.NewNop(),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %d", r.Header.Get("X-Forwarded-User"), calls.Add(1))
+		}))
+
+	serve(h, http.MethodGet, "/api/v1/catalog?q=redis", "alice", "")
+	rec := serve(h, http.MethodGet, "/api/v1/catalog?q=redis", "alice", "")
+	if rec.Body.String() != "alice 1" || rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("expected a cache hit, got %q (%s)", rec.Body.String(), rec.Header().Get("X-Cache"))
+	}
+	for _, rec := range []*httptest.ResponseRecorder{
+		serve(h, http.MethodGet, "/api/v1/catalog?q=redis", "bob", ""),
+		serve(h, http.MethodGet, "/api/v1/catalog?q=kafka", "alice", ""),
+		serve(h, http.MethodGet, "/api/v1/catalog?q=redis", "alice", "", "Cache-Control", "no-cache"),
+		serve(h, http.MethodGet, "/api/v1/services", "alice", ""),
+	} {
+		if rec.Header().Get("X-Cache") == "HIT" {
+			t.Errorf("unexpected cache hit: %q", rec.Body.String())
+		}
+	}
+	if calls.Load() != 5 {
+		t.Errorf("expected 5 handler calls, got %d", calls.Load())
+	}
+}
@@ -3,20 +3,35 @@ package middleware
 
 import (
 	"context"
+	"crypto/rand"
 	"fmt"
+	"io"
 	"net/http"
 	"runtime/debug"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
+var requestsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "http_server_requests_in_flight",
+	Help: "Requests currently being served by the public listener.",
+})
+
 // key type prevents collisions in context values.
 type key int
 
 const requestIDKey key = 0
 
+// requestIDHeader is canonical, so that setting and reading it does not
+// allocate a canonical copy on every request.
+const requestIDHeader = "X-Request-Id"
+
 // GetRequestID extracts the request ID from the context.
 func GetRequestID(ctx context.Context) string {
 	if id, ok := ctx.Value(requestIDKey).(string); ok {
@@ -29,25 +44,47 @@ func GetRequestID(ctx context.Context) string {
 func RequestID(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Use incoming header if present (from load balancer or gateway)
-		id := r.Header.Get("X-Request-ID")
+		id := r.Header.Get(requestIDHeader)
 		if id == "" {
-			id = uuid.New().String()
+			id = newRequestID()
 		}
 
 		ctx := context.WithValue(r.Context(), requestIDKey, id)
-		w.Header().Set("X-Request-ID", id)
+		w.Header().Set(requestIDHeader, id)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// newRequestID returns a random (version 4) UUID. Unlike uuid.New, it
+// reads the random bytes into an array on the stack, leaving the string as
+// the only allocation.
+func newRequestID() string {
+	var id uuid.UUID
+	rand.Read(id[:])
+	id[6] = id[6]&0x0f | 0x40 // version 4
+	id[8] = id[8]&0x3f | 0x80 // RFC 4122 variant
+	return id.String()
+}
+
 // responseWriter wraps http.ResponseWriter to capture the status code.
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
 }
 
+var responseWriters = sync.Pool{New: func() any { return new(responseWriter) }}
+
+// newResponseWriter wraps w in a pooled responseWriter; release it once
+// the handler has returned.
 func newResponseWriter(w http.ResponseWriter) *responseWriter {
-	return &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	rw := responseWriters.Get().(*responseWriter)
+	rw.ResponseWriter, rw.statusCode = w, http.StatusOK
+	return rw
+}
+
+func (rw *responseWriter) release() {
+	rw.ResponseWriter = nil
+	responseWriters.Put(rw)
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
@@ -55,16 +92,44 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// ReadFrom lets io.Copy, and so http.ServeContent, reach the connection's
+// ReadFrom, which sends files with sendfile(2).
+func (rw *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	return io.Copy(rw.ResponseWriter, src)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer for
+// flushing and per-request deadlines.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// accessLogFields is the number of fields in an access log line.
+const accessLogFields = 7
+
+// fieldSlices holds the field slices of access log lines. The cores write
+// fields out before Write returns, so a slice is reused once it has.
+var fieldSlices = sync.Pool{New: func() any {
+	fields := make([]zap.Field, 0, accessLogFields)
+	return &fields
+}}
+
 // Logging provides structured request/response logging.
 func Logging(logger *zap.Logger, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		wrapped := newResponseWriter(w)
+		defer wrapped.release()
 
 		next.ServeHTTP(wrapped, r)
 
 		duration := time.Since(start)
-		logger.Info("request completed",
+		ce := logger.Check(zap.InfoLevel, "request completed")
+		if ce == nil {
+			return
+		}
+		fields := fieldSlices.Get().(*[]zap.Field)
+		*fields = append((*fields)[:0],
 			zap.String("request_id", GetRequestID(r.Context())),
 			zap.String("method", r.Method),
 			zap.String("path", r.URL.Path),
@@ -73,6 +138,9 @@ func Logging(logger *zap.Logger, next http.Handler) http.Handler {
 			zap.String("remote_addr", r.RemoteAddr),
 			zap.String("user_agent", r.UserAgent()),
 		)
+		ce.Write(*fields...)
+		clear(*fields)
+		fieldSlices.Put(fields)
 	})
 }
 
@@ -97,12 +165,30 @@ func Recovery(logger *zap.Logger, next http.Handler) http.Handler {
 	})
 }
 
+// InFlight tracks the number of requests currently being served.
+func InFlight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestsInFlight.Inc()
+		defer requestsInFlight.Dec()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The CORS header values are shared by all responses rather than
+// allocated for each; Header.Add appends to a copy, as they are full.
+var (
+	corsOrigin  = []string{"*"}
+	corsMethods = []string{"GET, POST, OPTIONS"}
+	corsHeaders = []string{"Content-Type, X-Request-ID, Idempotency-Key"}
+)
+
 // CORS adds Cross-Origin Resource Sharing headers.
 func CORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Request-ID")
+		h := w.Header()
+		h["Access-Control-Allow-Origin"] = corsOrigin
+		h["Access-Control-Allow-Methods"] = corsMethods
+		h["Access-Control-Allow-Headers"] = corsHeaders
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
@@ -113,6 +199,17 @@ func CORS(next http.Handler) http.Handler {
 	})
 }
 
+// AltSvc advertises alternative protocols (e.g. HTTP/3) on every response.
+// setHeaders is typically (*http3.Server).SetQUICHeaders.
+func AltSvc(setHeaders func(http.Header) error, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor < 3 {
+			_ = setHeaders(w.Header())
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // NewLogger creates a production or development logger based on environment.
 func NewLogger(level, environment string) *zap.Logger {
 	var logger *zap.Logger
@@ -129,6 +226,7 @@ func NewLogger(level, environment string) *zap.Logger {
 		// Development: human-readable, colored output
 		cfg := zap.NewDevelopmentConfig()
 		cfg.Level = parseLogLevel(level)
+		cfg.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
 		logger, err = cfg.Build()
 	}
 
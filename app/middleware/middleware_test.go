@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// discardWriter is a ResponseWriter that allocates nothing itself, so the
+// benchmarks count the middleware's allocations only.
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+func benchmark(b *testing.B, h http.Handler) {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/info", nil)
+	w := &discardWriter{header: make(http.Header)}
+	b.ReportAllocs()
+	for b.Loop() {
+		clear(w.header)
+		h.ServeHTTP(w, req)
+	}
+}
+
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+// discardLogger encodes every entry, as in production, and writes it
+// nowhere.
+func discardLogger() *zap.Logger {
+	enc := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	return zap.New(zapcore.NewCore(enc, zapcore.AddSync(discard{}), zap.InfoLevel))
+}
+
+type discard struct{}
+
+func (discard) Write(b []byte) (int, error) { return len(b), nil }
+
+func BenchmarkRequestID(b *testing.B) {
+	benchmark(b, RequestID(ok))
+}
+
+func BenchmarkLogging(b *testing.B) {
+	benchmark(b, Logging(discardLogger(), ok))
+}
+
+func BenchmarkChain(b *testing.B) {
+	logger := discardLogger()
+	benchmark(b, InFlight(RequestID(Logging(logger, Recovery(logger, CORS(ok))))))
+}
+
+func TestRequestID(t *testing.T) {
+	id, err := uuid.Parse(newRequestID())
+	if err != nil || id.Version() != 4 || id.Variant() != uuid.RFC4122 {
+		t.Fatalf("request ID %s: version %d, variant %s, error %v", id, id.Version(), id.Variant(), err)
+	}
+
+	var got string
+	h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = GetRequestID(r.Context())
+	}))
+	rec := serve(h, http.MethodGet, "/", "", "", "X-Request-ID", "abc")
+	if got != "abc" || rec.Header().Get("X-Request-ID") != "abc" {
+		t.Errorf("request ID %q, header %q, want the incoming abc", got, rec.Header().Get("X-Request-ID"))
+	}
+}
+
+func TestLoggingAllocations(t *testing.T) {
+	h := Logging(discardLogger(), ok)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/info", nil)
+	w := &discardWriter{header: make(http.Header)}
+	if n := testing.AllocsPerRun(100, func() { h.ServeHTTP(w, req) }); n != 0 {
+		t.Errorf("Logging allocates %v times per request, want 0", n)
+	}
+}
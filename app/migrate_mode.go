@@ -0,0 +1,24 @@
+package main
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/app"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/config"
+)
+
+// runMigrate applies pending database migrations and exits, so schema
+// changes can run as a Job or init container ahead of the API rollout.
+func runMigrate(cfg *config.Config, logger *zap.Logger) {
+	if cfg.StoreBackend != config.StorePostgres {
+		logger.Fatal("migrate mode requires STORE_BACKEND=postgres")
+	}
+	database, err := app.OpenDatabase(cfg)
+	if err != nil {
+		logger.Fatal("failed to connect to database", zap.Error(err))
+	}
+	defer database.Close()
+	if err := app.MigrateDatabase(database, logger); err != nil {
+		logger.Fatal("database migration failed", zap.Error(err))
+	}
+}
@@ -0,0 +1,87 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/virenpatel/k8s-platform-engineering-lab/app/encryption (interfaces: KeyWrapper)
+//
+// Generated by this command:
+//
+//	mockgen -destination=encryption.go -package=mocks github.com/virenpatel/k8s-platform-engineering-lab/app/encryption KeyWrapper
+//
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockKeyWrapper is a mock of KeyWrapper interface.
+type MockKeyWrapper struct {
+	ctrl     *gomock.Controller
+	recorder *MockKeyWrapperMockRecorder
+	isgomock struct{}
+}
+
+// MockKeyWrapperMockRecorder is the mock recorder for MockKeyWrapper.
+type MockKeyWrapperMockRecorder struct {
+	mock *MockKeyWrapper
+}
+
+// NewMockKeyWrapper creates a new mock instance.
+func NewMockKeyWrapper(ctrl *gomock.Controller) *MockKeyWrapper {
+	mock := &MockKeyWrapper{ctrl: ctrl}
+	mock.recorder = &MockKeyWrapperMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockKeyWrapper) EXPECT() *MockKeyWrapperMockRecorder {
+	return m.recorder
+}
+
+// CurrentKeyID mocks base method.
+func (m *MockKeyWrapper) CurrentKeyID(ctx context.Context) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CurrentKeyID", ctx)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CurrentKeyID indicates an expected call of CurrentKeyID.
+func (mr *MockKeyWrapperMockRecorder) CurrentKeyID(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CurrentKeyID", reflect.TypeOf((*MockKeyWrapper)(nil).CurrentKeyID), ctx)
+}
+
+// Unwrap mocks base method.
+func (m *MockKeyWrapper) Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unwrap", ctx, keyID, wrapped)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Unwrap indicates an expected call of Unwrap.
+func (mr *MockKeyWrapperMockRecorder) Unwrap(ctx, keyID, wrapped any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unwrap", reflect.TypeOf((*MockKeyWrapper)(nil).Unwrap), ctx, keyID, wrapped)
+}
+
+// Wrap mocks base method.
+func (m *MockKeyWrapper) Wrap(ctx context.Context, dataKey []byte) (string, []byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Wrap", ctx, dataKey)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].([]byte)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Wrap indicates an expected call of Wrap.
+func (mr *MockKeyWrapperMockRecorder) Wrap(ctx, dataKey any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Wrap", reflect.TypeOf((*MockKeyWrapper)(nil).Wrap), ctx, dataKey)
+}
@@ -0,0 +1,1298 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/virenpatel/k8s-platform-engineering-lab/app/store (interfaces: TenantRepository,EnvironmentRepository,ServiceRepository,DeploymentRepository,QuotaUsageRepository,ProvisioningRepository,AuditRepository,HistoryRepository,SearchRepository,RoleAssignmentRepository,TokenRepository,CredentialRepository,WebhookKeyRepository,QueueRepository,OutboxRepository)
+//
+// Generated by this command:
+//
+//	mockgen -destination=store.go -package=mocks github.com/virenpatel/k8s-platform-engineering-lab/app/store TenantRepository,EnvironmentRepository,ServiceRepository,DeploymentRepository,QuotaUsageRepository,ProvisioningRepository,AuditRepository,HistoryRepository,SearchRepository,RoleAssignmentRepository,TokenRepository,CredentialRepository,WebhookKeyRepository,QueueRepository,OutboxRepository
+//
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	store "github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockTenantRepository is a mock of TenantRepository interface.
+type MockTenantRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockTenantRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockTenantRepositoryMockRecorder is the mock recorder for MockTenantRepository.
+type MockTenantRepositoryMockRecorder struct {
+	mock *MockTenantRepository
+}
+
+// NewMockTenantRepository creates a new mock instance.
+func NewMockTenantRepository(ctrl *gomock.Controller) *MockTenantRepository {
+	mock := &MockTenantRepository{ctrl: ctrl}
+	mock.recorder = &MockTenantRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTenantRepository) EXPECT() *MockTenantRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockTenantRepository) Create(ctx context.Context, t *store.Tenant) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, t)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockTenantRepositoryMockRecorder) Create(ctx, t any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockTenantRepository)(nil).Create), ctx, t)
+}
+
+// Delete mocks base method.
+func (m *MockTenantRepository) Delete(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockTenantRepositoryMockRecorder) Delete(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockTenantRepository)(nil).Delete), ctx, id)
+}
+
+// Get mocks base method.
+func (m *MockTenantRepository) Get(ctx context.Context, id string) (*store.Tenant, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, id)
+	ret0, _ := ret[0].(*store.Tenant)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockTenantRepositoryMockRecorder) Get(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockTenantRepository)(nil).Get), ctx, id)
+}
+
+// List mocks base method.
+func (m *MockTenantRepository) List(ctx context.Context) ([]store.Tenant, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx)
+	ret0, _ := ret[0].([]store.Tenant)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockTenantRepositoryMockRecorder) List(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockTenantRepository)(nil).List), ctx)
+}
+
+// Update mocks base method.
+func (m *MockTenantRepository) Update(ctx context.Context, t *store.Tenant) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, t)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockTenantRepositoryMockRecorder) Update(ctx, t any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockTenantRepository)(nil).Update), ctx, t)
+}
+
+// MockEnvironmentRepository is a mock of EnvironmentRepository interface.
+type MockEnvironmentRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockEnvironmentRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockEnvironmentRepositoryMockRecorder is the mock recorder for MockEnvironmentRepository.
+type MockEnvironmentRepositoryMockRecorder struct {
+	mock *MockEnvironmentRepository
+}
+
+// NewMockEnvironmentRepository creates a new mock instance.
+func NewMockEnvironmentRepository(ctrl *gomock.Controller) *MockEnvironmentRepository {
+	mock := &MockEnvironmentRepository{ctrl: ctrl}
+	mock.recorder = &MockEnvironmentRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockEnvironmentRepository) EXPECT() *MockEnvironmentRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockEnvironmentRepository) Create(ctx context.Context, e *store.Environment) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, e)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockEnvironmentRepositoryMockRecorder) Create(ctx, e any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockEnvironmentRepository)(nil).Create), ctx, e)
+}
+
+// Delete mocks base method.
+func (m *MockEnvironmentRepository) Delete(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockEnvironmentRepositoryMockRecorder) Delete(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockEnvironmentRepository)(nil).Delete), ctx, id)
+}
+
+// Get mocks base method.
+func (m *MockEnvironmentRepository) Get(ctx context.Context, id string) (*store.Environment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, id)
+	ret0, _ := ret[0].(*store.Environment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockEnvironmentRepositoryMockRecorder) Get(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockEnvironmentRepository)(nil).Get), ctx, id)
+}
+
+// List mocks base method.
+func (m *MockEnvironmentRepository) List(ctx context.Context) ([]store.Environment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx)
+	ret0, _ := ret[0].([]store.Environment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockEnvironmentRepositoryMockRecorder) List(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockEnvironmentRepository)(nil).List), ctx)
+}
+
+// Update mocks base method.
+func (m *MockEnvironmentRepository) Update(ctx context.Context, e *store.Environment) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, e)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockEnvironmentRepositoryMockRecorder) Update(ctx, e any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockEnvironmentRepository)(nil).Update), ctx, e)
+}
+
+// MockServiceRepository is a mock of ServiceRepository interface.
+type MockServiceRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockServiceRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockServiceRepositoryMockRecorder is the mock recorder for MockServiceRepository.
+type MockServiceRepositoryMockRecorder struct {
+	mock *MockServiceRepository
+}
+
+// NewMockServiceRepository creates a new mock instance.
+func NewMockServiceRepository(ctrl *gomock.Controller) *MockServiceRepository {
+	mock := &MockServiceRepository{ctrl: ctrl}
+	mock.recorder = &MockServiceRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockServiceRepository) EXPECT() *MockServiceRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockServiceRepository) Create(ctx context.Context, s *store.Service) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, s)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockServiceRepositoryMockRecorder) Create(ctx, s any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockServiceRepository)(nil).Create), ctx, s)
+}
+
+// Delete mocks base method.
+func (m *MockServiceRepository) Delete(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockServiceRepositoryMockRecorder) Delete(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockServiceRepository)(nil).Delete), ctx, id)
+}
+
+// Get mocks base method.
+func (m *MockServiceRepository) Get(ctx context.Context, id string) (*store.Service, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, id)
+	ret0, _ := ret[0].(*store.Service)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockServiceRepositoryMockRecorder) Get(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockServiceRepository)(nil).Get), ctx, id)
+}
+
+// List mocks base method.
+func (m *MockServiceRepository) List(ctx context.Context, tenantID string) ([]store.Service, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, tenantID)
+	ret0, _ := ret[0].([]store.Service)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockServiceRepositoryMockRecorder) List(ctx, tenantID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockServiceRepository)(nil).List), ctx, tenantID)
+}
+
+// Update mocks base method.
+func (m *MockServiceRepository) Update(ctx context.Context, s *store.Service) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, s)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockServiceRepositoryMockRecorder) Update(ctx, s any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockServiceRepository)(nil).Update), ctx, s)
+}
+
+// MockDeploymentRepository is a mock of DeploymentRepository interface.
+type MockDeploymentRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockDeploymentRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockDeploymentRepositoryMockRecorder is the mock recorder for MockDeploymentRepository.
+type MockDeploymentRepositoryMockRecorder struct {
+	mock *MockDeploymentRepository
+}
+
+// NewMockDeploymentRepository creates a new mock instance.
+func NewMockDeploymentRepository(ctrl *gomock.Controller) *MockDeploymentRepository {
+	mock := &MockDeploymentRepository{ctrl: ctrl}
+	mock.recorder = &MockDeploymentRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDeploymentRepository) EXPECT() *MockDeploymentRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockDeploymentRepository) Create(ctx context.Context, d *store.Deployment) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, d)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockDeploymentRepositoryMockRecorder) Create(ctx, d any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockDeploymentRepository)(nil).Create), ctx, d)
+}
+
+// Get mocks base method.
+func (m *MockDeploymentRepository) Get(ctx context.Context, id string) (*store.Deployment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, id)
+	ret0, _ := ret[0].(*store.Deployment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockDeploymentRepositoryMockRecorder) Get(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockDeploymentRepository)(nil).Get), ctx, id)
+}
+
+// List mocks base method.
+func (m *MockDeploymentRepository) List(ctx context.Context, serviceID string) ([]store.Deployment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, serviceID)
+	ret0, _ := ret[0].([]store.Deployment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockDeploymentRepositoryMockRecorder) List(ctx, serviceID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockDeploymentRepository)(nil).List), ctx, serviceID)
+}
+
+// MockQuotaUsageRepository is a mock of QuotaUsageRepository interface.
+type MockQuotaUsageRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockQuotaUsageRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockQuotaUsageRepositoryMockRecorder is the mock recorder for MockQuotaUsageRepository.
+type MockQuotaUsageRepositoryMockRecorder struct {
+	mock *MockQuotaUsageRepository
+}
+
+// NewMockQuotaUsageRepository creates a new mock instance.
+func NewMockQuotaUsageRepository(ctrl *gomock.Controller) *MockQuotaUsageRepository {
+	mock := &MockQuotaUsageRepository{ctrl: ctrl}
+	mock.recorder = &MockQuotaUsageRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockQuotaUsageRepository) EXPECT() *MockQuotaUsageRepositoryMockRecorder {
+	return m.recorder
+}
+
+// History mocks base method.
+func (m *MockQuotaUsageRepository) History(ctx context.Context, namespace string, since time.Time) ([]store.QuotaSample, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "History", ctx, namespace, since)
+	ret0, _ := ret[0].([]store.QuotaSample)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// History indicates an expected call of History.
+func (mr *MockQuotaUsageRepositoryMockRecorder) History(ctx, namespace, since any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "History", reflect.TypeOf((*MockQuotaUsageRepository)(nil).History), ctx, namespace, since)
+}
+
+// Prune mocks base method.
+func (m *MockQuotaUsageRepository) Prune(ctx context.Context, before time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Prune", ctx, before)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Prune indicates an expected call of Prune.
+func (mr *MockQuotaUsageRepositoryMockRecorder) Prune(ctx, before any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Prune", reflect.TypeOf((*MockQuotaUsageRepository)(nil).Prune), ctx, before)
+}
+
+// Record mocks base method.
+func (m *MockQuotaUsageRepository) Record(ctx context.Context, samples []store.QuotaSample) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Record", ctx, samples)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Record indicates an expected call of Record.
+func (mr *MockQuotaUsageRepositoryMockRecorder) Record(ctx, samples any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Record", reflect.TypeOf((*MockQuotaUsageRepository)(nil).Record), ctx, samples)
+}
+
+// MockProvisioningRepository is a mock of ProvisioningRepository interface.
+type MockProvisioningRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockProvisioningRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockProvisioningRepositoryMockRecorder is the mock recorder for MockProvisioningRepository.
+type MockProvisioningRepositoryMockRecorder struct {
+	mock *MockProvisioningRepository
+}
+
+// NewMockProvisioningRepository creates a new mock instance.
+func NewMockProvisioningRepository(ctrl *gomock.Controller) *MockProvisioningRepository {
+	mock := &MockProvisioningRepository{ctrl: ctrl}
+	mock.recorder = &MockProvisioningRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockProvisioningRepository) EXPECT() *MockProvisioningRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockProvisioningRepository) Create(ctx context.Context, r *store.ProvisioningRecord) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, r)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockProvisioningRepositoryMockRecorder) Create(ctx, r any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockProvisioningRepository)(nil).Create), ctx, r)
+}
+
+// Get mocks base method.
+func (m *MockProvisioningRepository) Get(ctx context.Context, id string) (*store.ProvisioningRecord, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, id)
+	ret0, _ := ret[0].(*store.ProvisioningRecord)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockProvisioningRepositoryMockRecorder) Get(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockProvisioningRepository)(nil).Get), ctx, id)
+}
+
+// List mocks base method.
+func (m *MockProvisioningRepository) List(ctx context.Context, tenantID string) ([]store.ProvisioningRecord, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, tenantID)
+	ret0, _ := ret[0].([]store.ProvisioningRecord)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockProvisioningRepositoryMockRecorder) List(ctx, tenantID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockProvisioningRepository)(nil).List), ctx, tenantID)
+}
+
+// Update mocks base method.
+func (m *MockProvisioningRepository) Update(ctx context.Context, r *store.ProvisioningRecord) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, r)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockProvisioningRepositoryMockRecorder) Update(ctx, r any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockProvisioningRepository)(nil).Update), ctx, r)
+}
+
+// MockAuditRepository is a mock of AuditRepository interface.
+type MockAuditRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockAuditRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockAuditRepositoryMockRecorder is the mock recorder for MockAuditRepository.
+type MockAuditRepositoryMockRecorder struct {
+	mock *MockAuditRepository
+}
+
+// NewMockAuditRepository creates a new mock instance.
+func NewMockAuditRepository(ctrl *gomock.Controller) *MockAuditRepository {
+	mock := &MockAuditRepository{ctrl: ctrl}
+	mock.recorder = &MockAuditRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAuditRepository) EXPECT() *MockAuditRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Chain mocks base method.
+func (m *MockAuditRepository) Chain(ctx context.Context, afterSeq int64, limit int) ([]store.AuditEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Chain", ctx, afterSeq, limit)
+	ret0, _ := ret[0].([]store.AuditEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Chain indicates an expected call of Chain.
+func (mr *MockAuditRepositoryMockRecorder) Chain(ctx, afterSeq, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Chain", reflect.TypeOf((*MockAuditRepository)(nil).Chain), ctx, afterSeq, limit)
+}
+
+// Head mocks base method.
+func (m *MockAuditRepository) Head(ctx context.Context) (int64, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Head", ctx)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Head indicates an expected call of Head.
+func (mr *MockAuditRepositoryMockRecorder) Head(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Head", reflect.TypeOf((*MockAuditRepository)(nil).Head), ctx)
+}
+
+// List mocks base method.
+func (m *MockAuditRepository) List(ctx context.Context, f store.AuditFilter) ([]store.AuditEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, f)
+	ret0, _ := ret[0].([]store.AuditEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockAuditRepositoryMockRecorder) List(ctx, f any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockAuditRepository)(nil).List), ctx, f)
+}
+
+// Record mocks base method.
+func (m *MockAuditRepository) Record(ctx context.Context, e *store.AuditEvent) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Record", ctx, e)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Record indicates an expected call of Record.
+func (mr *MockAuditRepositoryMockRecorder) Record(ctx, e any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Record", reflect.TypeOf((*MockAuditRepository)(nil).Record), ctx, e)
+}
+
+// MockHistoryRepository is a mock of HistoryRepository interface.
+type MockHistoryRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockHistoryRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockHistoryRepositoryMockRecorder is the mock recorder for MockHistoryRepository.
+type MockHistoryRepositoryMockRecorder struct {
+	mock *MockHistoryRepository
+}
+
+// NewMockHistoryRepository creates a new mock instance.
+func NewMockHistoryRepository(ctrl *gomock.Controller) *MockHistoryRepository {
+	mock := &MockHistoryRepository{ctrl: ctrl}
+	mock.recorder = &MockHistoryRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockHistoryRepository) EXPECT() *MockHistoryRepositoryMockRecorder {
+	return m.recorder
+}
+
+// List mocks base method.
+func (m *MockHistoryRepository) List(ctx context.Context, resource, id string) ([]store.Change, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, resource, id)
+	ret0, _ := ret[0].([]store.Change)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockHistoryRepositoryMockRecorder) List(ctx, resource, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockHistoryRepository)(nil).List), ctx, resource, id)
+}
+
+// Record mocks base method.
+func (m *MockHistoryRepository) Record(ctx context.Context, c *store.Change) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Record", ctx, c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Record indicates an expected call of Record.
+func (mr *MockHistoryRepositoryMockRecorder) Record(ctx, c any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Record", reflect.TypeOf((*MockHistoryRepository)(nil).Record), ctx, c)
+}
+
+// MockSearchRepository is a mock of SearchRepository interface.
+type MockSearchRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockSearchRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockSearchRepositoryMockRecorder is the mock recorder for MockSearchRepository.
+type MockSearchRepositoryMockRecorder struct {
+	mock *MockSearchRepository
+}
+
+// NewMockSearchRepository creates a new mock instance.
+func NewMockSearchRepository(ctrl *gomock.Controller) *MockSearchRepository {
+	mock := &MockSearchRepository{ctrl: ctrl}
+	mock.recorder = &MockSearchRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSearchRepository) EXPECT() *MockSearchRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Search mocks base method.
+func (m *MockSearchRepository) Search(ctx context.Context, query string, limit int) ([]store.SearchHit, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Search", ctx, query, limit)
+	ret0, _ := ret[0].([]store.SearchHit)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Search indicates an expected call of Search.
+func (mr *MockSearchRepositoryMockRecorder) Search(ctx, query, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockSearchRepository)(nil).Search), ctx, query, limit)
+}
+
+// MockRoleAssignmentRepository is a mock of RoleAssignmentRepository interface.
+type MockRoleAssignmentRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockRoleAssignmentRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockRoleAssignmentRepositoryMockRecorder is the mock recorder for MockRoleAssignmentRepository.
+type MockRoleAssignmentRepositoryMockRecorder struct {
+	mock *MockRoleAssignmentRepository
+}
+
+// NewMockRoleAssignmentRepository creates a new mock instance.
+func NewMockRoleAssignmentRepository(ctrl *gomock.Controller) *MockRoleAssignmentRepository {
+	mock := &MockRoleAssignmentRepository{ctrl: ctrl}
+	mock.recorder = &MockRoleAssignmentRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRoleAssignmentRepository) EXPECT() *MockRoleAssignmentRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockRoleAssignmentRepository) Create(ctx context.Context, a *store.RoleAssignment) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, a)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockRoleAssignmentRepositoryMockRecorder) Create(ctx, a any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockRoleAssignmentRepository)(nil).Create), ctx, a)
+}
+
+// Delete mocks base method.
+func (m *MockRoleAssignmentRepository) Delete(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockRoleAssignmentRepositoryMockRecorder) Delete(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockRoleAssignmentRepository)(nil).Delete), ctx, id)
+}
+
+// ForIdentity mocks base method.
+func (m *MockRoleAssignmentRepository) ForIdentity(ctx context.Context, user string, groups []string) ([]store.RoleAssignment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ForIdentity", ctx, user, groups)
+	ret0, _ := ret[0].([]store.RoleAssignment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ForIdentity indicates an expected call of ForIdentity.
+func (mr *MockRoleAssignmentRepositoryMockRecorder) ForIdentity(ctx, user, groups any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ForIdentity", reflect.TypeOf((*MockRoleAssignmentRepository)(nil).ForIdentity), ctx, user, groups)
+}
+
+// List mocks base method.
+func (m *MockRoleAssignmentRepository) List(ctx context.Context, subjectKind, subject string) ([]store.RoleAssignment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, subjectKind, subject)
+	ret0, _ := ret[0].([]store.RoleAssignment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockRoleAssignmentRepositoryMockRecorder) List(ctx, subjectKind, subject any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockRoleAssignmentRepository)(nil).List), ctx, subjectKind, subject)
+}
+
+// MockTokenRepository is a mock of TokenRepository interface.
+type MockTokenRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockTokenRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockTokenRepositoryMockRecorder is the mock recorder for MockTokenRepository.
+type MockTokenRepositoryMockRecorder struct {
+	mock *MockTokenRepository
+}
+
+// NewMockTokenRepository creates a new mock instance.
+func NewMockTokenRepository(ctrl *gomock.Controller) *MockTokenRepository {
+	mock := &MockTokenRepository{ctrl: ctrl}
+	mock.recorder = &MockTokenRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTokenRepository) EXPECT() *MockTokenRepositoryMockRecorder {
+	return m.recorder
+}
+
+// ByHash mocks base method.
+func (m *MockTokenRepository) ByHash(ctx context.Context, hash string) (*store.APIToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ByHash", ctx, hash)
+	ret0, _ := ret[0].(*store.APIToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ByHash indicates an expected call of ByHash.
+func (mr *MockTokenRepositoryMockRecorder) ByHash(ctx, hash any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ByHash", reflect.TypeOf((*MockTokenRepository)(nil).ByHash), ctx, hash)
+}
+
+// Create mocks base method.
+func (m *MockTokenRepository) Create(ctx context.Context, t *store.APIToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, t)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockTokenRepositoryMockRecorder) Create(ctx, t any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockTokenRepository)(nil).Create), ctx, t)
+}
+
+// Get mocks base method.
+func (m *MockTokenRepository) Get(ctx context.Context, id string) (*store.APIToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, id)
+	ret0, _ := ret[0].(*store.APIToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockTokenRepositoryMockRecorder) Get(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockTokenRepository)(nil).Get), ctx, id)
+}
+
+// List mocks base method.
+func (m *MockTokenRepository) List(ctx context.Context, owner string) ([]store.APIToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, owner)
+	ret0, _ := ret[0].([]store.APIToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockTokenRepositoryMockRecorder) List(ctx, owner any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockTokenRepository)(nil).List), ctx, owner)
+}
+
+// Revoke mocks base method.
+func (m *MockTokenRepository) Revoke(ctx context.Context, id string, at time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Revoke", ctx, id, at)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Revoke indicates an expected call of Revoke.
+func (mr *MockTokenRepositoryMockRecorder) Revoke(ctx, id, at any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Revoke", reflect.TypeOf((*MockTokenRepository)(nil).Revoke), ctx, id, at)
+}
+
+// Touch mocks base method.
+func (m *MockTokenRepository) Touch(ctx context.Context, id string, at time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Touch", ctx, id, at)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Touch indicates an expected call of Touch.
+func (mr *MockTokenRepositoryMockRecorder) Touch(ctx, id, at any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Touch", reflect.TypeOf((*MockTokenRepository)(nil).Touch), ctx, id, at)
+}
+
+// MockCredentialRepository is a mock of CredentialRepository interface.
+type MockCredentialRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockCredentialRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockCredentialRepositoryMockRecorder is the mock recorder for MockCredentialRepository.
+type MockCredentialRepositoryMockRecorder struct {
+	mock *MockCredentialRepository
+}
+
+// NewMockCredentialRepository creates a new mock instance.
+func NewMockCredentialRepository(ctrl *gomock.Controller) *MockCredentialRepository {
+	mock := &MockCredentialRepository{ctrl: ctrl}
+	mock.recorder = &MockCredentialRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCredentialRepository) EXPECT() *MockCredentialRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockCredentialRepository) Delete(ctx context.Context, tenantID, name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, tenantID, name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockCredentialRepositoryMockRecorder) Delete(ctx, tenantID, name any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockCredentialRepository)(nil).Delete), ctx, tenantID, name)
+}
+
+// Get mocks base method.
+func (m *MockCredentialRepository) Get(ctx context.Context, tenantID, name string) (*store.Credential, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, tenantID, name)
+	ret0, _ := ret[0].(*store.Credential)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockCredentialRepositoryMockRecorder) Get(ctx, tenantID, name any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockCredentialRepository)(nil).Get), ctx, tenantID, name)
+}
+
+// List mocks base method.
+func (m *MockCredentialRepository) List(ctx context.Context, tenantID string) ([]store.Credential, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, tenantID)
+	ret0, _ := ret[0].([]store.Credential)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockCredentialRepositoryMockRecorder) List(ctx, tenantID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockCredentialRepository)(nil).List), ctx, tenantID)
+}
+
+// NotSealedWith mocks base method.
+func (m *MockCredentialRepository) NotSealedWith(ctx context.Context, keyID, afterID string, limit int) ([]store.Credential, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NotSealedWith", ctx, keyID, afterID, limit)
+	ret0, _ := ret[0].([]store.Credential)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NotSealedWith indicates an expected call of NotSealedWith.
+func (mr *MockCredentialRepositoryMockRecorder) NotSealedWith(ctx, keyID, afterID, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NotSealedWith", reflect.TypeOf((*MockCredentialRepository)(nil).NotSealedWith), ctx, keyID, afterID, limit)
+}
+
+// Put mocks base method.
+func (m *MockCredentialRepository) Put(ctx context.Context, c *store.Credential) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Put", ctx, c)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Put indicates an expected call of Put.
+func (mr *MockCredentialRepositoryMockRecorder) Put(ctx, c any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Put", reflect.TypeOf((*MockCredentialRepository)(nil).Put), ctx, c)
+}
+
+// Reseal mocks base method.
+func (m *MockCredentialRepository) Reseal(ctx context.Context, id, old, value, keyID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reseal", ctx, id, old, value, keyID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Reseal indicates an expected call of Reseal.
+func (mr *MockCredentialRepositoryMockRecorder) Reseal(ctx, id, old, value, keyID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reseal", reflect.TypeOf((*MockCredentialRepository)(nil).Reseal), ctx, id, old, value, keyID)
+}
+
+// MockWebhookKeyRepository is a mock of WebhookKeyRepository interface.
+type MockWebhookKeyRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockWebhookKeyRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockWebhookKeyRepositoryMockRecorder is the mock recorder for MockWebhookKeyRepository.
+type MockWebhookKeyRepositoryMockRecorder struct {
+	mock *MockWebhookKeyRepository
+}
+
+// NewMockWebhookKeyRepository creates a new mock instance.
+func NewMockWebhookKeyRepository(ctrl *gomock.Controller) *MockWebhookKeyRepository {
+	mock := &MockWebhookKeyRepository{ctrl: ctrl}
+	mock.recorder = &MockWebhookKeyRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockWebhookKeyRepository) EXPECT() *MockWebhookKeyRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockWebhookKeyRepository) Create(ctx context.Context, k *store.WebhookKey) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, k)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockWebhookKeyRepositoryMockRecorder) Create(ctx, k any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockWebhookKeyRepository)(nil).Create), ctx, k)
+}
+
+// List mocks base method.
+func (m *MockWebhookKeyRepository) List(ctx context.Context) ([]store.WebhookKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx)
+	ret0, _ := ret[0].([]store.WebhookKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockWebhookKeyRepositoryMockRecorder) List(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockWebhookKeyRepository)(nil).List), ctx)
+}
+
+// Prune mocks base method.
+func (m *MockWebhookKeyRepository) Prune(ctx context.Context, before time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Prune", ctx, before)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Prune indicates an expected call of Prune.
+func (mr *MockWebhookKeyRepositoryMockRecorder) Prune(ctx, before any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Prune", reflect.TypeOf((*MockWebhookKeyRepository)(nil).Prune), ctx, before)
+}
+
+// Retire mocks base method.
+func (m *MockWebhookKeyRepository) Retire(ctx context.Context, keep string, at time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Retire", ctx, keep, at)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Retire indicates an expected call of Retire.
+func (mr *MockWebhookKeyRepositoryMockRecorder) Retire(ctx, keep, at any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Retire", reflect.TypeOf((*MockWebhookKeyRepository)(nil).Retire), ctx, keep, at)
+}
+
+// MockQueueRepository is a mock of QueueRepository interface.
+type MockQueueRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockQueueRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockQueueRepositoryMockRecorder is the mock recorder for MockQueueRepository.
+type MockQueueRepositoryMockRecorder struct {
+	mock *MockQueueRepository
+}
+
+// NewMockQueueRepository creates a new mock instance.
+func NewMockQueueRepository(ctrl *gomock.Controller) *MockQueueRepository {
+	mock := &MockQueueRepository{ctrl: ctrl}
+	mock.recorder = &MockQueueRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockQueueRepository) EXPECT() *MockQueueRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Claim mocks base method.
+func (m *MockQueueRepository) Claim(ctx context.Context, worker string, types []string, limit int, now, leaseUntil time.Time) ([]store.QueueJob, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Claim", ctx, worker, types, limit, now, leaseUntil)
+	ret0, _ := ret[0].([]store.QueueJob)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Claim indicates an expected call of Claim.
+func (mr *MockQueueRepositoryMockRecorder) Claim(ctx, worker, types, limit, now, leaseUntil any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Claim", reflect.TypeOf((*MockQueueRepository)(nil).Claim), ctx, worker, types, limit, now, leaseUntil)
+}
+
+// Enqueue mocks base method.
+func (m *MockQueueRepository) Enqueue(ctx context.Context, j *store.QueueJob) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Enqueue", ctx, j)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Enqueue indicates an expected call of Enqueue.
+func (mr *MockQueueRepositoryMockRecorder) Enqueue(ctx, j any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Enqueue", reflect.TypeOf((*MockQueueRepository)(nil).Enqueue), ctx, j)
+}
+
+// Finish mocks base method.
+func (m *MockQueueRepository) Finish(ctx context.Context, worker string, j *store.QueueJob) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Finish", ctx, worker, j)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Finish indicates an expected call of Finish.
+func (mr *MockQueueRepositoryMockRecorder) Finish(ctx, worker, j any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Finish", reflect.TypeOf((*MockQueueRepository)(nil).Finish), ctx, worker, j)
+}
+
+// Get mocks base method.
+func (m *MockQueueRepository) Get(ctx context.Context, id string) (*store.QueueJob, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, id)
+	ret0, _ := ret[0].(*store.QueueJob)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockQueueRepositoryMockRecorder) Get(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockQueueRepository)(nil).Get), ctx, id)
+}
+
+// List mocks base method.
+func (m *MockQueueRepository) List(ctx context.Context, f store.QueueFilter) ([]store.QueueJob, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, f)
+	ret0, _ := ret[0].([]store.QueueJob)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockQueueRepositoryMockRecorder) List(ctx, f any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockQueueRepository)(nil).List), ctx, f)
+}
+
+// Prune mocks base method.
+func (m *MockQueueRepository) Prune(ctx context.Context, before time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Prune", ctx, before)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Prune indicates an expected call of Prune.
+func (mr *MockQueueRepositoryMockRecorder) Prune(ctx, before any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Prune", reflect.TypeOf((*MockQueueRepository)(nil).Prune), ctx, before)
+}
+
+// Retry mocks base method.
+func (m *MockQueueRepository) Retry(ctx context.Context, id string, now time.Time) (*store.QueueJob, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Retry", ctx, id, now)
+	ret0, _ := ret[0].(*store.QueueJob)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Retry indicates an expected call of Retry.
+func (mr *MockQueueRepositoryMockRecorder) Retry(ctx, id, now any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Retry", reflect.TypeOf((*MockQueueRepository)(nil).Retry), ctx, id, now)
+}
+
+// MockOutboxRepository is a mock of OutboxRepository interface.
+type MockOutboxRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockOutboxRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockOutboxRepositoryMockRecorder is the mock recorder for MockOutboxRepository.
+type MockOutboxRepositoryMockRecorder struct {
+	mock *MockOutboxRepository
+}
+
+// NewMockOutboxRepository creates a new mock instance.
+func NewMockOutboxRepository(ctrl *gomock.Controller) *MockOutboxRepository {
+	mock := &MockOutboxRepository{ctrl: ctrl}
+	mock.recorder = &MockOutboxRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockOutboxRepository) EXPECT() *MockOutboxRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Add mocks base method.
+func (m_2 *MockOutboxRepository) Add(ctx context.Context, m *store.OutboxMessage) error {
+	m_2.ctrl.T.Helper()
+	ret := m_2.ctrl.Call(m_2, "Add", ctx, m)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Add indicates an expected call of Add.
+func (mr *MockOutboxRepositoryMockRecorder) Add(ctx, m any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockOutboxRepository)(nil).Add), ctx, m)
+}
+
+// MarkSent mocks base method.
+func (m *MockOutboxRepository) MarkSent(ctx context.Context, ids []string, at time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkSent", ctx, ids, at)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkSent indicates an expected call of MarkSent.
+func (mr *MockOutboxRepositoryMockRecorder) MarkSent(ctx, ids, at any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkSent", reflect.TypeOf((*MockOutboxRepository)(nil).MarkSent), ctx, ids, at)
+}
+
+// Pending mocks base method.
+func (m *MockOutboxRepository) Pending(ctx context.Context, limit int) ([]store.OutboxMessage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Pending", ctx, limit)
+	ret0, _ := ret[0].([]store.OutboxMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Pending indicates an expected call of Pending.
+func (mr *MockOutboxRepositoryMockRecorder) Pending(ctx, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Pending", reflect.TypeOf((*MockOutboxRepository)(nil).Pending), ctx, limit)
+}
+
+// Prune mocks base method.
+func (m *MockOutboxRepository) Prune(ctx context.Context, before time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Prune", ctx, before)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Prune indicates an expected call of Prune.
+func (mr *MockOutboxRepositoryMockRecorder) Prune(ctx, before any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Prune", reflect.TypeOf((*MockOutboxRepository)(nil).Prune), ctx, before)
+}
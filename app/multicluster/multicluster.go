@@ -0,0 +1,291 @@
+// Package multicluster serves the cluster-scoped read endpoints (workload
+// catalog, warning events, node inventory, disruption budget findings) for
+// every configured cluster, selected by path (/api/v1/clusters/{cluster}/...)
+// or header, and views that aggregate health and the workload catalog across
+// clusters.
+package multicluster
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/labels"
+	metricsv "k8s.io/metrics/pkg/client/clientset/versioned"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/clusterevents"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/kube"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/nodes"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/pdbs"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/workloads"
+)
+
+// checkTimeout bounds each cluster's readiness check in the health view.
+const checkTimeout = 5 * time.Second
+
+// Options configures the handler.
+type Options struct {
+	// Namespaces limits the namespaces read in every cluster (empty = all).
+	Namespaces []string
+	// Header selects a cluster for the unprefixed cluster-scoped paths; see
+	// Middleware.
+	Header string
+	// Metrics is the local cluster's metrics-server client (may be nil).
+	// Remote node inventories report capacity only.
+	Metrics metricsv.Interface
+}
+
+// member is one cluster's client and read endpoints.
+type member struct {
+	client  *kube.Client
+	catalog *workloads.Catalog
+	budgets *pdbs.Validator
+	routes  *http.ServeMux
+}
+
+// Handler routes cluster-scoped requests to the selected cluster and serves
+// the aggregated views.
+type Handler struct {
+	local   string
+	names   []string
+	members map[string]member
+	header  string
+	logger  *zap.Logger
+
+	// check is the readiness check of a cluster, replaceable in tests.
+	check func(ctx context.Context, c *kube.Client) error
+}
+
+// New registers the workload, event, node and disruption budget informers
+// on every cluster's factory. The local cluster's factory is started by its
+// owner; remote ones by Start.
+func New(clusters *kube.Clusters, opts Options, logger *zap.Logger) *Handler {
+	h := &Handler{
+		local:   clusters.Local(),
+		names:   clusters.Names(),
+		members: make(map[string]member),
+		header:  opts.Header,
+		logger:  logger,
+		check:   func(ctx context.Context, c *kube.Client) error { return c.Check(ctx) },
+	}
+	for _, name := range h.names {
+		c, _ := clusters.Get(name)
+		var metrics metricsv.Interface
+		if name == h.local {
+			metrics = opts.Metrics
+		}
+		m := member{
+			client:  c,
+			catalog: workloads.New(c.Clientset, c.Informers, opts.Namespaces),
+			budgets: pdbs.NewValidator(c.Informers, opts.Namespaces),
+			routes:  http.NewServeMux(),
+		}
+		m.catalog.Register(m.routes)
+		m.budgets.Register(m.routes)
+		clusterevents.New(c.Clientset, c.Informers, opts.Namespaces).Register(m.routes)
+		nodes.New(c.Clientset, c.Informers, metrics, logger.With(zap.String("cluster", name))).Register(m.routes)
+		h.members[name] = m
+	}
+	return h
+}
+
+// Start starts the remote clusters' informers in the background. A remote
+// cluster that is down does not hold up startup; its endpoints return
+// empty lists until its caches sync.
+func (h *Handler) Start(ctx context.Context) {
+	for _, name := range h.names[1:] {
+		c := h.members[name].client
+		go func() {
+			if err := c.Start(ctx); err != nil {
+				h.logger.Warn("remote cluster informers did not sync", zap.String("cluster", name), zap.Error(err))
+			}
+		}()
+	}
+}
+
+// Shutdown stops the remote clusters' informers.
+func (h *Handler) Shutdown(ctx context.Context) error {
+	for _, name := range h.names[1:] {
+		h.members[name].client.Shutdown(ctx)
+	}
+	return nil
+}
+
+// Register mounts the cluster endpoints on mux:
+//
+//	GET /api/v1/clusters              every cluster's health and workload counts
+//	GET /api/v1/clusters/{cluster}/…  a cluster-scoped endpoint of one cluster
+//	GET /api/v1/workloads             the workload catalog across clusters
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/clusters", h.list)
+	mux.HandleFunc("GET /api/v1/clusters/{cluster}/", h.route)
+	mux.HandleFunc("GET /api/v1/workloads", h.workloads)
+}
+
+// Middleware serves requests carrying the cluster header from that
+// cluster's endpoints, so /api/v1/nodes with "X-Cluster: prod" reads prod.
+// Requests without the header, or naming the local cluster, go to next;
+// paths that are not cluster-scoped get 404 for remote clusters.
+func (h *Handler) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.Header.Get(h.header)
+		if name == "" || name == h.local {
+			next.ServeHTTP(w, r)
+			return
+		}
+		m, ok := h.members[name]
+		if !ok {
+			http.Error(w, "unknown cluster", http.StatusNotFound)
+			return
+		}
+		m.routes.ServeHTTP(w, r)
+	})
+}
+
+// route serves /api/v1/clusters/{cluster}/rest as /api/v1/rest on the
+// cluster's endpoints.
+func (h *Handler) route(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("cluster")
+	m, ok := h.members[name]
+	if !ok {
+		http.Error(w, "unknown cluster", http.StatusNotFound)
+		return
+	}
+	r2 := r.Clone(r.Context())
+	r2.URL.Path = "/api/v1/" + strings.TrimPrefix(r.URL.Path, "/api/v1/clusters/"+name+"/")
+	r2.URL.RawPath = ""
+	m.routes.ServeHTTP(w, r2)
+}
+
+// Status is one cluster's entry in the health view.
+type Status struct {
+	Name         string `json:"name"`
+	Local        bool   `json:"local"`
+	Ready        bool   `json:"ready"`
+	Error        string `json:"error,omitempty"`
+	Deployments  int    `json:"deployments"`
+	StatefulSets int    `json:"statefulsets"`
+	// PDBFindings counts the cluster's disruption budget findings by
+	// severity; see package pdbs.
+	PDBFindings map[string]int `json:"pdb_findings"`
+}
+
+// list checks every cluster's API server concurrently and reports its
+// readiness with workload counts and disruption budget findings from its
+// informer cache.
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	items := make([]Status, len(h.names))
+	var wg sync.WaitGroup
+	for i, name := range h.names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			items[i] = h.status(r.Context(), name)
+		}()
+	}
+	wg.Wait()
+
+	ready := 0
+	for _, s := range items {
+		if s.Ready {
+			ready++
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"items": items,
+		"total": len(items),
+		"ready": ready,
+	})
+}
+
+func (h *Handler) status(ctx context.Context, name string) Status {
+	m := h.members[name]
+	s := Status{Name: name, Local: name == h.local}
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	if err := h.check(ctx, m.client); err != nil {
+		s.Error = err.Error()
+	} else {
+		s.Ready = true
+	}
+	if items, err := m.catalog.List("", labels.Everything()); err == nil {
+		for _, wl := range items {
+			if wl.Kind == "Deployment" {
+				s.Deployments++
+			} else {
+				s.StatefulSets++
+			}
+		}
+	}
+	if findings, err := m.budgets.Findings(""); err == nil {
+		s.PDBFindings = pdbs.Summary(findings)
+	}
+	return s
+}
+
+// Workload is a catalog entry tagged with its cluster.
+type Workload struct {
+	Cluster string `json:"cluster"`
+	workloads.Workload
+}
+
+// workloads lists Deployments and StatefulSets from every cluster, sorted
+// by cluster, namespace and name. ?cluster=, ?namespace=, ?kind= and
+// ?labelSelector= filter the list.
+func (h *Handler) workloads(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	cluster, namespace, kind := q.Get("cluster"), q.Get("namespace"), q.Get("kind")
+	if cluster != "" {
+		if _, ok := h.members[cluster]; !ok {
+			http.Error(w, "unknown cluster", http.StatusNotFound)
+			return
+		}
+	}
+	selector := labels.Everything()
+	if s := q.Get("labelSelector"); s != "" {
+		sel, err := labels.Parse(s)
+		if err != nil {
+			http.Error(w, "invalid labelSelector: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		selector = sel
+	}
+
+	items := []Workload{}
+	for _, name := range h.names {
+		if cluster != "" && name != cluster {
+			continue
+		}
+		list, err := h.members[name].catalog.List(namespace, selector)
+		if err != nil {
+			http.Error(w, "failed to list workloads", http.StatusInternalServerError)
+			return
+		}
+		for _, wl := range list {
+			if kind == "" || strings.EqualFold(wl.Kind, kind) {
+				items = append(items, Workload{Cluster: name, Workload: wl})
+			}
+		}
+	}
+	slices.SortFunc(items, func(a, b Workload) int {
+		return cmp.Or(
+			strings.Compare(a.Cluster, b.Cluster),
+			strings.Compare(a.Namespace, b.Namespace),
+			strings.Compare(a.Name, b.Name),
+			strings.Compare(a.Kind, b.Kind),
+		)
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
@@ -0,0 +1,136 @@
+package multicluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/kube"
+)
+
+func deployment(ns, name string) *appsv1.Deployment {
+	return &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name}}
+}
+
+func newTestHandler(t *testing.T) http.Handler {
+	t.Helper()
+	local := kube.NewForClientset(fake.NewClientset(deployment("team-a", "web")), nil, 0, zap.NewNop())
+	prod := kube.NewForClientset(fake.NewClientset(
+		deployment("team-a", "web"),
+		deployment("team-a", "api"),
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "prod-node-1"}},
+	), nil, 0, zap.NewNop())
+	clusters := kube.NewClusters("local", local)
+	clusters.Add("prod", prod)
+
+	h := New(clusters, Options{Namespaces: []string{"team-a"}, Header: "X-Cluster"}, zap.NewNop())
+	h.check = func(_ context.Context, c *kube.Client) error {
+		if c == prod {
+			return errors.New("kubernetes API server: connection refused")
+		}
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		local.Shutdown(ctx)
+		h.Shutdown(ctx)
+	})
+	for _, c := range []*kube.Client{local, prod} {
+		if err := c.Start(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	h.Register(mux)
+	mux.HandleFunc("GET /api/v1/nodes", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"items":"local"}`))
+	})
+	return h.Middleware(mux)
+}
+
+func get(t *testing.T, h http.Handler, path, cluster string, out any) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if cluster != "" {
+		req.Header.Set("X-Cluster", cluster)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("bad response %q: %v", rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+func TestRoutesByPathAndHeader(t *testing.T) {
+	h := newTestHandler(t)
+
+	var page struct {
+		Items []struct{ Name string } `json:"items"`
+	}
+	if code := get(t, h, "/api/v1/clusters/prod/workloads/deployments", "", &page); code != http.StatusOK || len(page.Items) != 2 {
+		t.Fatalf("expected prod's 2 deployments by path, got %d %+v", code, page)
+	}
+	if code := get(t, h, "/api/v1/clusters/local/workloads/deployments", "", &page); code != http.StatusOK || len(page.Items) != 1 {
+		t.Fatalf("expected local's deployment by path, got %d %+v", code, page)
+	}
+	if code := get(t, h, "/api/v1/nodes", "prod", &page); code != http.StatusOK || len(page.Items) != 1 || page.Items[0].Name != "prod-node-1" {
+		t.Errorf("expected prod nodes by header, got %d %+v", code, page)
+	}
+
+	var local struct{ Items string }
+	if code := get(t, h, "/api/v1/nodes", "local", &local); code != http.StatusOK || local.Items != "local" {
+		t.Errorf("expected the local cluster header to pass through, got %d %+v", code, local)
+	}
+	if code := get(t, h, "/api/v1/nodes", "dev", nil); code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown cluster header, got %d", code)
+	}
+	if code := get(t, h, "/api/v1/clusters/dev/nodes", "", nil); code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown cluster path, got %d", code)
+	}
+}
+
+func TestAggregatedViews(t *testing.T) {
+	h := newTestHandler(t)
+
+	var health struct {
+		Items []Status `json:"items"`
+		Total int      `json:"total"`
+		Ready int      `json:"ready"`
+	}
+	if code := get(t, h, "/api/v1/clusters", "", &health); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if health.Total != 2 || health.Ready != 1 {
+		t.Errorf("expected 1 of 2 clusters ready, got %+v", health)
+	}
+	if prod := health.Items[1]; prod.Name != "prod" || prod.Ready || prod.Error == "" || prod.Deployments != 2 || prod.PDBFindings == nil {
+		t.Errorf("unexpected prod status %+v", prod)
+	}
+
+	var workloads struct {
+		Items []Workload `json:"items"`
+	}
+	if code := get(t, h, "/api/v1/workloads", "", &workloads); code != http.StatusOK || len(workloads.Items) != 3 {
+		t.Fatalf("expected 3 workloads across clusters, got %d %+v", code, workloads)
+	}
+	if first := workloads.Items[0]; first.Cluster != "local" || first.Name != "web" {
+		t.Errorf("expected items sorted by cluster, got %+v", first)
+	}
+	if get(t, h, "/api/v1/workloads?cluster=prod&kind=deployment", "", &workloads); len(workloads.Items) != 2 {
+		t.Errorf("expected prod's deployments, got %+v", workloads.Items)
+	}
+}
@@ -0,0 +1,451 @@
+// Package nodeops cordons, drains and uncordons nodes on behalf of operators
+// who have no node-level kubectl rights. Drains evict pods through the
+// Eviction API so PodDisruptionBudgets are respected, run in the background
+// with per-pod progress, and every operation is written to the audit log and
+// published on the event bus.
+package nodeops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+)
+
+var (
+	// ErrInProgress is returned when the node is already being drained.
+	ErrInProgress = errs.New(errs.Conflict, "drain already in progress")
+	// ErrNotFound is returned for unknown nodes or drains.
+	ErrNotFound = errs.New(errs.NotFound, "not found")
+)
+
+var operationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "node_operations_total",
+	Help: "Node cordon, uncordon and drain operations by result.",
+}, []string{"operation", "result"})
+
+// Status of a drain or of one pod within it.
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+
+	PodPending  Status = "pending"
+	PodEvicting Status = "evicting"
+	// PodBlocked means a PodDisruptionBudget is refusing the eviction; it
+	// is retried until the eviction timeout.
+	PodBlocked Status = "blocked"
+	PodEvicted Status = "evicted"
+	PodFailed  Status = "failed"
+)
+
+// DrainRequest tunes one drain.
+type DrainRequest struct {
+	// Force evicts pods that no controller will recreate.
+	Force bool `json:"force"`
+	// DeleteEmptyDirData evicts pods using emptyDir volumes, losing the data.
+	DeleteEmptyDirData bool `json:"delete_emptydir_data"`
+}
+
+// PodState is the progress of one pod's eviction.
+type PodState struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Status    Status `json:"status"`
+	Message   string `json:"message,omitempty"`
+}
+
+// Drain is one drain run.
+type Drain struct {
+	Node       string     `json:"node"`
+	User       string     `json:"user"`
+	Status     Status     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	Pods       []PodState `json:"pods"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Options configures the engine.
+type Options struct {
+	// EvictionTimeout bounds the eviction of one pod, including retries
+	// while a PodDisruptionBudget blocks it and the wait for termination.
+	EvictionTimeout time.Duration
+	// Timeout bounds a whole drain.
+	Timeout time.Duration
+}
+
+// Engine runs node operations and keeps the latest drain per node.
+type Engine struct {
+	clientset kubernetes.Interface
+	bus       events.Publisher
+	opts      Options
+	logger    *zap.Logger
+	// pollInterval paces eviction retries and termination checks
+	pollInterval time.Duration
+
+	mu     sync.Mutex
+	drains map[string]*run
+	wg     sync.WaitGroup
+}
+
+type run struct {
+	drain  Drain
+	cancel context.CancelFunc
+	// changed is closed and replaced on every update so followers wake up
+	changed chan struct{}
+}
+
+// New creates a node operations engine.
+func New(cs kubernetes.Interface, bus events.Publisher, opts Options, logger *zap.Logger) *Engine {
+	if opts.EvictionTimeout <= 0 {
+		opts.EvictionTimeout = 2 * time.Minute
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 15 * time.Minute
+	}
+	return &Engine{
+		clientset:    cs,
+		bus:          bus,
+		opts:         opts,
+		logger:       logger,
+		pollInterval: 2 * time.Second,
+		drains:       make(map[string]*run),
+	}
+}
+
+// Cordon marks node unschedulable.
+func (e *Engine) Cordon(ctx context.Context, node, user string) error {
+	err := e.setUnschedulable(ctx, node, true)
+	e.record(ctx, "cordon", node, user, err)
+	return err
+}
+
+// Uncordon makes node schedulable again. It fails with ErrInProgress while
+// the node is being drained.
+func (e *Engine) Uncordon(ctx context.Context, node, user string) error {
+	e.mu.Lock()
+	r, ok := e.drains[node]
+	running := ok && r.drain.Status == StatusRunning
+	e.mu.Unlock()
+	if running {
+		return ErrInProgress
+	}
+	err := e.setUnschedulable(ctx, node, false)
+	e.record(ctx, "uncordon", node, user, err)
+	return err
+}
+
+func (e *Engine) setUnschedulable(ctx context.Context, node string, unschedulable bool) error {
+	patch := fmt.Appendf(nil, `{"spec":{"unschedulable":%t}}`, unschedulable)
+	_, err := e.clientset.CoreV1().Nodes().Patch(ctx, node, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	if apierrors.IsNotFound(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// StartDrain cordons node and evicts its pods in the background. ctx only
+// carries request-scoped values; the run is bounded by Options.Timeout.
+func (e *Engine) StartDrain(ctx context.Context, node, user string, req DrainRequest) (Drain, error) {
+	if _, err := e.clientset.CoreV1().Nodes().Get(ctx, node, metav1.GetOptions{}); err != nil {
+		if apierrors.IsNotFound(err) {
+			return Drain{}, ErrNotFound
+		}
+		return Drain{}, err
+	}
+
+	e.mu.Lock()
+	if r, ok := e.drains[node]; ok && r.drain.Status == StatusRunning {
+		snapshot := copyDrain(&r.drain)
+		e.mu.Unlock()
+		return snapshot, ErrInProgress
+	}
+	runCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), e.opts.Timeout)
+	r := &run{
+		drain:   Drain{Node: node, User: user, Status: StatusRunning, Pods: []PodState{}, StartedAt: time.Now().UTC()},
+		cancel:  cancel,
+		changed: make(chan struct{}),
+	}
+	e.drains[node] = r
+	snapshot := copyDrain(&r.drain)
+	e.wg.Add(1)
+	e.mu.Unlock()
+
+	e.record(ctx, "drain.started", node, user, nil)
+	go func() {
+		defer e.wg.Done()
+		defer cancel()
+		err := e.drain(runCtx, r, req)
+		e.finish(runCtx, r, err)
+	}()
+	return snapshot, nil
+}
+
+// CancelDrain stops a running drain. Pods already evicted stay evicted and
+// the node stays cordoned.
+func (e *Engine) CancelDrain(node string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	r, ok := e.drains[node]
+	if !ok || r.drain.Status != StatusRunning {
+		return ErrNotFound
+	}
+	r.cancel()
+	return nil
+}
+
+// Get returns the latest drain of node and a channel closed on its next
+// change.
+func (e *Engine) Get(node string) (Drain, <-chan struct{}, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	r, ok := e.drains[node]
+	if !ok {
+		return Drain{}, nil, false
+	}
+	return copyDrain(&r.drain), r.changed, true
+}
+
+// Shutdown cancels running drains and waits for them to stop or ctx to
+// expire.
+func (e *Engine) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	for _, r := range e.drains {
+		r.cancel()
+	}
+	e.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *Engine) drain(ctx context.Context, r *run, req DrainRequest) error {
+	node := r.drain.Node
+	if err := e.setUnschedulable(ctx, node, true); err != nil {
+		return fmt.Errorf("cordon: %w", err)
+	}
+
+	list, err := e.clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", node).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("list pods: %w", err)
+	}
+	var pods []corev1.Pod
+	for _, p := range list.Items {
+		skip, err := checkPod(&p, req)
+		if err != nil {
+			return err
+		}
+		if !skip {
+			pods = append(pods, p)
+		}
+	}
+
+	e.update(r, func(d *Drain) {
+		for _, p := range pods {
+			d.Pods = append(d.Pods, PodState{Namespace: p.Namespace, Name: p.Name, Status: PodPending})
+		}
+	})
+
+	// Evict concurrently, as kubectl does; PDBs serialise where needed
+	var wg sync.WaitGroup
+	for i := range pods {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.evict(ctx, r, i, &pods[i])
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, p := range r.snapshotPods(&e.mu) {
+		if p.Status != PodEvicted {
+			return fmt.Errorf("pod %s/%s was not evicted", p.Namespace, p.Name)
+		}
+	}
+	return nil
+}
+
+// checkPod decides whether p must be evicted. DaemonSet, mirror and
+// finished pods are skipped; unmanaged and emptyDir pods need the
+// corresponding request flag.
+func checkPod(p *corev1.Pod, req DrainRequest) (skip bool, err error) {
+	if _, ok := p.Annotations[corev1.MirrorPodAnnotationKey]; ok {
+		return true, nil
+	}
+	if p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed {
+		return true, nil
+	}
+	ctrl := metav1.GetControllerOf(p)
+	if ctrl != nil && ctrl.Kind == "DaemonSet" {
+		return true, nil
+	}
+	if ctrl == nil && !req.Force {
+		return false, fmt.Errorf("pod %s/%s is not managed by a controller (set force to evict it)", p.Namespace, p.Name)
+	}
+	for _, v := range p.Spec.Volumes {
+		if v.EmptyDir != nil && !req.DeleteEmptyDirData {
+			return false, fmt.Errorf("pod %s/%s uses emptyDir volume %s (set delete_emptydir_data to evict it)", p.Namespace, p.Name, v.Name)
+		}
+	}
+	return false, nil
+}
+
+// evict retries the eviction while a PodDisruptionBudget blocks it, then
+// waits for the pod to terminate.
+func (e *Engine) evict(ctx context.Context, r *run, i int, p *corev1.Pod) {
+	ctx, cancel := context.WithTimeout(ctx, e.opts.EvictionTimeout)
+	defer cancel()
+	setPod := func(status Status, msg string) {
+		e.update(r, func(d *Drain) { d.Pods[i].Status, d.Pods[i].Message = status, msg })
+	}
+
+	setPod(PodEvicting, "")
+	eviction := &policyv1.Eviction{ObjectMeta: metav1.ObjectMeta{Namespace: p.Namespace, Name: p.Name}}
+	for {
+		err := e.clientset.PolicyV1().Evictions(p.Namespace).Evict(ctx, eviction)
+		if err == nil || apierrors.IsNotFound(err) {
+			break
+		}
+		if !apierrors.IsTooManyRequests(err) {
+			setPod(PodFailed, err.Error())
+			return
+		}
+		setPod(PodBlocked, "blocked by PodDisruptionBudget")
+		if !sleep(ctx, e.pollInterval) {
+			setPod(PodFailed, "eviction timed out while blocked by PodDisruptionBudget")
+			return
+		}
+	}
+
+	setPod(PodEvicting, "waiting for termination")
+	for {
+		current, err := e.clientset.CoreV1().Pods(p.Namespace).Get(ctx, p.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) || (err == nil && current.UID != p.UID) {
+			setPod(PodEvicted, "")
+			return
+		}
+		if !sleep(ctx, e.pollInterval) {
+			setPod(PodFailed, "timed out waiting for termination")
+			return
+		}
+	}
+}
+
+func (e *Engine) finish(ctx context.Context, r *run, err error) {
+	now := time.Now().UTC()
+	e.update(r, func(d *Drain) {
+		d.FinishedAt = &now
+		switch {
+		case err == nil:
+			d.Status = StatusSucceeded
+		case errors.Is(err, context.Canceled):
+			d.Status = StatusCancelled
+			d.Error = "cancelled"
+		default:
+			d.Status = StatusFailed
+			d.Error = err.Error()
+		}
+	})
+	e.record(context.WithoutCancel(ctx), "drain."+string(r.snapshotStatus(&e.mu)), r.drain.Node, r.drain.User, err)
+}
+
+func (e *Engine) update(r *run, fn func(*Drain)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fn(&r.drain)
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+func (r *run) snapshotPods(mu *sync.Mutex) []PodState {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]PodState(nil), r.drain.Pods...)
+}
+
+func (r *run) snapshotStatus(mu *sync.Mutex) Status {
+	mu.Lock()
+	defer mu.Unlock()
+	return r.drain.Status
+}
+
+// record writes the audit log entry, counts the operation and publishes
+// node.<operation>.
+func (e *Engine) record(ctx context.Context, operation, node, user string, err error) {
+	audit := e.logger.With(
+		zap.String("audit", "nodeops"),
+		zap.String("operation", operation),
+		zap.String("node", node),
+		zap.String("user", user),
+	)
+	result := "ok"
+	if err != nil {
+		result = "error"
+		audit.Warn("node operation failed", zap.Error(err))
+	} else {
+		audit.Info("node operation")
+	}
+	operationsTotal.WithLabelValues(operation, result).Inc()
+
+	data := map[string]string{"node": node, "user": user}
+	if err != nil {
+		data["error"] = err.Error()
+	}
+	ev, evErr := events.New("node."+operation, "nodeops", data)
+	if evErr != nil {
+		return
+	}
+	if err := e.bus.Publish(ctx, ev); err != nil {
+		e.logger.Warn("failed to publish node event", zap.Error(err))
+	}
+}
+
+func copyDrain(d *Drain) Drain {
+	out := *d
+	out.Pods = append([]PodState{}, d.Pods...)
+	return out
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
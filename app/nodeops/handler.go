@@ -0,0 +1,183 @@
+package nodeops
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+)
+
+// Handler serves the node operation endpoints to members of the operator
+// groups.
+type Handler struct {
+	engine  *Engine
+	headers authz.Headers
+	groups  []string
+	logger  *zap.Logger
+}
+
+// NewHandler creates a handler that admits callers in any of groups, as
+// asserted by the authenticating proxy.
+func NewHandler(engine *Engine, headers authz.Headers, groups []string, logger *zap.Logger) *Handler {
+	return &Handler{engine: engine, headers: headers, groups: groups, logger: logger}
+}
+
+// Register mounts the node operation endpoints on mux:
+//
+//	POST   /api/v1/admin/nodes/{name}/cordon     mark unschedulable
+//	POST   /api/v1/admin/nodes/{name}/uncordon   mark schedulable
+//	POST   /api/v1/admin/nodes/{name}/drain      cordon and evict pods
+//	GET    /api/v1/admin/nodes/{name}/drain      latest drain (?follow=true streams NDJSON)
+//	DELETE /api/v1/admin/nodes/{name}/drain      cancel a running drain
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/v1/admin/nodes/{name}/cordon", h.cordon)
+	mux.HandleFunc("POST /api/v1/admin/nodes/{name}/uncordon", h.uncordon)
+	mux.HandleFunc("POST /api/v1/admin/nodes/{name}/drain", h.startDrain)
+	mux.HandleFunc("GET /api/v1/admin/nodes/{name}/drain", h.drainStatus)
+	mux.HandleFunc("DELETE /api/v1/admin/nodes/{name}/drain", h.cancelDrain)
+}
+
+func (h *Handler) cordon(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+	if err := h.engine.Cordon(r.Context(), r.PathValue("name"), user); err != nil {
+		h.fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) uncordon(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+	if err := h.engine.Uncordon(r.Context(), r.PathValue("name"), user); err != nil {
+		h.fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) startDrain(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+	var req DrainRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	d, err := h.engine.StartDrain(r.Context(), r.PathValue("name"), user, req)
+	if errors.Is(err, ErrInProgress) {
+		writeJSON(w, http.StatusConflict, d)
+		return
+	}
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	w.Header().Set("Location", r.URL.Path)
+	writeJSON(w, http.StatusAccepted, d)
+}
+
+// drainStatus returns the latest drain. With ?follow=true it writes one
+// JSON snapshot per line on every change until the drain finishes.
+func (h *Handler) drainStatus(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorize(w, r); !ok {
+		return
+	}
+	d, changed, ok := h.engine.Get(r.PathValue("name"))
+	if !ok {
+		http.Error(w, "no drain for node", http.StatusNotFound)
+		return
+	}
+	if r.URL.Query().Get("follow") != "true" {
+		writeJSON(w, http.StatusOK, d)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-store")
+	rc := http.NewResponseController(w)
+	// A drain can outlive the server's WriteTimeout
+	_ = rc.SetWriteDeadline(time.Time{})
+	enc := codec.Default().NewEncoder(w)
+	for {
+		if err := enc.Encode(d); err != nil {
+			return
+		}
+		_ = rc.Flush()
+		if d.Status != StatusRunning {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-changed:
+		}
+		d, changed, _ = h.engine.Get(d.Node)
+	}
+}
+
+func (h *Handler) cancelDrain(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorize(w, r); !ok {
+		return
+	}
+	if err := h.engine.CancelDrain(r.PathValue("name")); err != nil {
+		http.Error(w, "no running drain for node", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// authorize admits callers in one of the operator groups and returns the
+// user name for the audit trail.
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := h.headers.Identity(r)
+	if id.User == "" {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return "", false
+	}
+	for _, g := range id.Groups {
+		if slices.Contains(h.groups, g) {
+			return id.User, true
+		}
+	}
+	h.logger.Warn("node operation denied",
+		zap.String("audit", "nodeops"),
+		zap.String("user", id.User),
+		zap.Strings("groups", id.Groups),
+		zap.String("path", r.URL.Path),
+	)
+	http.Error(w, "forbidden", http.StatusForbidden)
+	return "", false
+}
+
+func (h *Handler) fail(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, "node not found", http.StatusNotFound)
+	case errors.Is(err, ErrInProgress):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		h.logger.Error("node operation failed", zap.Error(err))
+		http.Error(w, "kubernetes request failed", http.StatusBadGateway)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
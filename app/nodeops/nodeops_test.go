@@ -0,0 +1,155 @@
+package nodeops
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+)
+
+func pod(name, ownerKind string) *corev1.Pod {
+	p := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: name, UID: types.UID("uid-" + name)},
+		Spec:       corev1.PodSpec{NodeName: "node-a"},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	if ownerKind != "" {
+		p.OwnerReferences = []metav1.OwnerReference{{Kind: ownerKind, Name: "owner", Controller: new(true)}}
+	}
+	return p
+}
+
+// newEngine returns an engine whose evictions are refused with 429 blocked
+// times (as a PodDisruptionBudget would) before the pod is deleted.
+func newEngine(t *testing.T, blocked int32, objs ...runtime.Object) (*Engine, *fake.Clientset) {
+	t.Helper()
+	objs = append(objs, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}})
+	cs := fake.NewClientset(objs...)
+	var attempts atomic.Int32
+	cs.PrependReactor("create", "pods", func(a k8stesting.Action) (bool, runtime.Object, error) {
+		if a.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		if attempts.Add(1) <= blocked {
+			return true, nil, apierrors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 0)
+		}
+		name := a.(k8stesting.CreateAction).GetObject().(metav1.Object).GetName()
+		return true, nil, cs.Tracker().Delete(corev1.SchemeGroupVersion.WithResource("pods"), a.GetNamespace(), name)
+	})
+	e := New(cs, events.NewMemoryBus(), Options{EvictionTimeout: 2 * time.Second, Timeout: 5 * time.Second}, zap.NewNop())
+	e.pollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { e.Shutdown(context.Background()) })
+	return e, cs
+}
+
+func wait(t *testing.T, e *Engine, node string) Drain {
+	t.Helper()
+	for {
+		d, changed, _ := e.Get(node)
+		if d.Status != StatusRunning {
+			return d
+		}
+		select {
+		case <-changed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("drain did not finish")
+		}
+	}
+}
+
+func TestDrainEvictsThroughPDBAndSkipsDaemonSets(t *testing.T) {
+	e, cs := newEngine(t, 2, pod("web-1", "ReplicaSet"), pod("agent", "DaemonSet"))
+
+	if _, err := e.StartDrain(t.Context(), "node-a", "alice", DrainRequest{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d := wait(t, e, "node-a")
+	if d.Status != StatusSucceeded || len(d.Pods) != 1 || d.Pods[0].Status != PodEvicted {
+		t.Fatalf("expected web-1 evicted, got %+v", d)
+	}
+	node, _ := cs.CoreV1().Nodes().Get(t.Context(), "node-a", metav1.GetOptions{})
+	if !node.Spec.Unschedulable {
+		t.Error("expected node to be cordoned")
+	}
+	if _, err := cs.CoreV1().Pods("team-a").Get(t.Context(), "agent", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected DaemonSet pod to remain, got %v", err)
+	}
+}
+
+func TestDrainFailsOnBlockedEvictionTimeout(t *testing.T) {
+	e, _ := newEngine(t, 1000, pod("web-1", "ReplicaSet"))
+	e.opts.EvictionTimeout = 100 * time.Millisecond
+
+	e.StartDrain(t.Context(), "node-a", "alice", DrainRequest{})
+	d := wait(t, e, "node-a")
+	if d.Status != StatusFailed || d.Pods[0].Status != PodFailed {
+		t.Errorf("expected failed drain, got %+v", d)
+	}
+}
+
+func TestDrainRefusesUnmanagedPodsWithoutForce(t *testing.T) {
+	e, _ := newEngine(t, 0, pod("debug", ""))
+
+	e.StartDrain(t.Context(), "node-a", "alice", DrainRequest{})
+	if d := wait(t, e, "node-a"); d.Status != StatusFailed || !strings.Contains(d.Error, "force") {
+		t.Errorf("expected failure mentioning force, got %+v", d)
+	}
+	e.StartDrain(t.Context(), "node-a", "alice", DrainRequest{Force: true})
+	if d := wait(t, e, "node-a"); d.Status != StatusSucceeded {
+		t.Errorf("expected forced drain to succeed, got %+v", d)
+	}
+}
+
+func TestHandlerRequiresOperatorGroupAndStreamsProgress(t *testing.T) {
+	e, _ := newEngine(t, 0, pod("web-1", "ReplicaSet"))
+	mux := http.NewServeMux()
+	NewHandler(e, authz.Headers{User: "X-Forwarded-User", Groups: "X-Forwarded-Groups"}, []string{"sre"}, zap.NewNop()).Register(mux)
+
+	do := func(method, path, groups string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-Forwarded-User", "alice")
+		req.Header.Set("X-Forwarded-Groups", groups)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodPost, "/api/v1/admin/nodes/node-a/drain", "developers"); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api/v1/admin/nodes/node-a/drain", "sre"); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body)
+	}
+
+	rec := do(http.MethodGet, "/api/v1/admin/nodes/node-a/drain?follow=true", "sre")
+	var last Drain
+	lines := 0
+	sc := bufio.NewScanner(rec.Body)
+	for sc.Scan() {
+		lines++
+		json.Unmarshal(sc.Bytes(), &last)
+	}
+	if lines == 0 || last.Status != StatusSucceeded {
+		t.Errorf("expected stream ending in succeeded, got %d lines, last %+v", lines, last)
+	}
+	if rec := do(http.MethodPost, "/api/v1/admin/nodes/node-b/cordon", "sre"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown node, got %d", rec.Code)
+	}
+}
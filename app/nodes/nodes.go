@@ -0,0 +1,304 @@
+// Package nodes serves a node inventory for capacity reviews: capacity,
+// allocatable resources, taints, labels and kubelet versions from the shared
+// informer cache (or the API server, with ?freshness=), joined with live
+// usage from metrics-server.
+package nodes
+
+import (
+	"context"
+	"encoding/csv"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/kube"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	metricsv "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+// metricsTimeout bounds the metrics-server call so a slow or missing
+// metrics-server only costs the usage columns.
+const metricsTimeout = 5 * time.Second
+
+// Node is one inventory entry. CPU is in millicores and memory in bytes.
+type Node struct {
+	Name           string            `json:"name"`
+	Roles          []string          `json:"roles,omitempty"`
+	Ready          bool              `json:"ready"`
+	Unschedulable  bool              `json:"unschedulable"`
+	KubeletVersion string            `json:"kubelet_version"`
+	OSImage        string            `json:"os_image"`
+	Architecture   string            `json:"architecture"`
+	InstanceType   string            `json:"instance_type,omitempty"`
+	Zone           string            `json:"zone,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Taints         []corev1.Taint    `json:"taints,omitempty"`
+	Capacity       Resources         `json:"capacity"`
+	Allocatable    Resources         `json:"allocatable"`
+	// Usage and Utilization are nil when metrics-server has no sample.
+	Usage       *Resources   `json:"usage,omitempty"`
+	Utilization *Utilization `json:"utilization,omitempty"`
+	Created     time.Time    `json:"created"`
+}
+
+// Resources is a node's CPU, memory and pod counts.
+type Resources struct {
+	CPUMillis   int64 `json:"cpu_millis"`
+	MemoryBytes int64 `json:"memory_bytes"`
+	Pods        int64 `json:"pods,omitempty"`
+}
+
+// Utilization is usage as a percentage of allocatable.
+type Utilization struct {
+	CPUPercent    float64 `json:"cpu_percent"`
+	MemoryPercent float64 `json:"memory_percent"`
+}
+
+type listResponse struct {
+	Items []Node `json:"items"`
+	// MetricsAvailable is false when metrics-server could not be queried.
+	MetricsAvailable bool `json:"metrics_available"`
+}
+
+// Inventory lists nodes from the informer cache.
+type Inventory struct {
+	clientset kubernetes.Interface
+	nodes     corelisters.NodeLister
+	informer  cache.SharedIndexInformer
+	metrics   metricsv.Interface
+	logger    *zap.Logger
+}
+
+// New registers the Node informer on factory; the factory must be started
+// afterwards. cs serves the reads that must be fresher than the cache.
+// metrics may be nil, in which case usage is never reported.
+func New(cs kubernetes.Interface, factory informers.SharedInformerFactory, metrics metricsv.Interface, logger *zap.Logger) *Inventory {
+	nodes := factory.Core().V1().Nodes()
+	return &Inventory{
+		clientset: cs,
+		nodes:     nodes.Lister(),
+		informer:  nodes.Informer(),
+		metrics:   metrics,
+		logger:    logger,
+	}
+}
+
+// Register mounts the inventory endpoints on mux.
+func (inv *Inventory) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/nodes", inv.list)
+	mux.HandleFunc("GET /api/v1/nodes/{name}", inv.get)
+}
+
+// list serves all nodes, optionally filtered with ?selector= (a label
+// selector). ?format=csv returns a spreadsheet-friendly export.
+func (inv *Inventory) list(w http.ResponseWriter, r *http.Request) {
+	sel := labels.Everything()
+	if s := r.URL.Query().Get("selector"); s != "" {
+		var err error
+		if sel, err = labels.Parse(s); err != nil {
+			http.Error(w, "invalid selector", http.StatusBadRequest)
+			return
+		}
+	}
+	freshness, err := kube.ParseFreshness(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var nodes []*corev1.Node
+	if freshness.Cached(inv.informer) {
+		nodes, err = inv.nodes.List(sel)
+	} else {
+		var list *corev1.NodeList
+		list, err = inv.clientset.CoreV1().Nodes().List(r.Context(), metav1.ListOptions{LabelSelector: sel.String()})
+		if err == nil {
+			for i := range list.Items {
+				nodes = append(nodes, &list.Items[i])
+			}
+		}
+	}
+	if err != nil {
+		http.Error(w, "failed to list nodes", http.StatusInternalServerError)
+		return
+	}
+	usage, ok := inv.usage(r.Context())
+
+	items := make([]Node, 0, len(nodes))
+	for _, n := range nodes {
+		items = append(items, toNode(n, usage))
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+
+	if r.URL.Query().Get("format") == "csv" {
+		writeCSV(w, items)
+		return
+	}
+	writeJSON(w, http.StatusOK, listResponse{Items: items, MetricsAvailable: ok})
+}
+
+func (inv *Inventory) get(w http.ResponseWriter, r *http.Request) {
+	freshness, err := kube.ParseFreshness(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var n *corev1.Node
+	if freshness.Cached(inv.informer) {
+		n, err = inv.nodes.Get(r.PathValue("name"))
+	} else {
+		n, err = inv.clientset.CoreV1().Nodes().Get(r.Context(), r.PathValue("name"), metav1.GetOptions{})
+	}
+	if apierrors.IsNotFound(err) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to get node", http.StatusInternalServerError)
+		return
+	}
+	usage, _ := inv.usage(r.Context())
+	writeJSON(w, http.StatusOK, toNode(n, usage))
+}
+
+// usage fetches current node usage from metrics-server, keyed by node name.
+// ok is false if metrics-server is not configured or the call failed.
+func (inv *Inventory) usage(ctx context.Context) (map[string]Resources, bool) {
+	if inv.metrics == nil {
+		return nil, false
+	}
+	ctx, cancel := context.WithTimeout(ctx, metricsTimeout)
+	defer cancel()
+	list, err := inv.metrics.MetricsV1beta1().NodeMetricses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		inv.logger.Warn("failed to fetch node metrics", zap.Error(err))
+		return nil, false
+	}
+	out := make(map[string]Resources, len(list.Items))
+	for _, m := range list.Items {
+		out[m.Name] = resources(m.Usage)
+	}
+	return out, true
+}
+
+func toNode(n *corev1.Node, usage map[string]Resources) Node {
+	out := Node{
+		Name:           n.Name,
+		Unschedulable:  n.Spec.Unschedulable,
+		KubeletVersion: n.Status.NodeInfo.KubeletVersion,
+		OSImage:        n.Status.NodeInfo.OSImage,
+		Architecture:   n.Status.NodeInfo.Architecture,
+		InstanceType:   n.Labels[corev1.LabelInstanceTypeStable],
+		Zone:           n.Labels[corev1.LabelTopologyZone],
+		Labels:         n.Labels,
+		Taints:         n.Spec.Taints,
+		Capacity:       resources(n.Status.Capacity),
+		Allocatable:    resources(n.Status.Allocatable),
+		Created:        n.CreationTimestamp.Time,
+	}
+	for k := range n.Labels {
+		if role, ok := strings.CutPrefix(k, "node-role.kubernetes.io/"); ok && role != "" {
+			out.Roles = append(out.Roles, role)
+		}
+	}
+	sort.Strings(out.Roles)
+	for _, c := range n.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			out.Ready = c.Status == corev1.ConditionTrue
+		}
+	}
+	if u, ok := usage[n.Name]; ok {
+		out.Usage = &u
+		out.Utilization = &Utilization{
+			CPUPercent:    percent(u.CPUMillis, out.Allocatable.CPUMillis),
+			MemoryPercent: percent(u.MemoryBytes, out.Allocatable.MemoryBytes),
+		}
+	}
+	return out
+}
+
+func resources(rl corev1.ResourceList) Resources {
+	return Resources{
+		CPUMillis:   quantity(rl, corev1.ResourceCPU).MilliValue(),
+		MemoryBytes: quantity(rl, corev1.ResourceMemory).Value(),
+		Pods:        quantity(rl, corev1.ResourcePods).Value(),
+	}
+}
+
+func quantity(rl corev1.ResourceList, name corev1.ResourceName) *resource.Quantity {
+	q := rl[name]
+	return &q
+}
+
+func percent(used, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	// Round to one decimal place
+	return float64(used*1000/total) / 10
+}
+
+var csvHeader = []string{
+	"name", "roles", "ready", "unschedulable", "kubelet_version", "instance_type", "zone",
+	"cpu_capacity_m", "cpu_allocatable_m", "cpu_usage_m", "cpu_percent",
+	"memory_capacity_bytes", "memory_allocatable_bytes", "memory_usage_bytes", "memory_percent",
+	"pods_allocatable", "taints",
+}
+
+func writeCSV(w http.ResponseWriter, items []Node) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="nodes.csv"`)
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for _, n := range items {
+		var cpuUsage, cpuPct, memUsage, memPct string
+		if n.Usage != nil {
+			cpuUsage = strconv.FormatInt(n.Usage.CPUMillis, 10)
+			memUsage = strconv.FormatInt(n.Usage.MemoryBytes, 10)
+			cpuPct = strconv.FormatFloat(n.Utilization.CPUPercent, 'f', 1, 64)
+			memPct = strconv.FormatFloat(n.Utilization.MemoryPercent, 'f', 1, 64)
+		}
+		taints := make([]string, 0, len(n.Taints))
+		for _, t := range n.Taints {
+			taints = append(taints, t.ToString())
+		}
+		cw.Write([]string{
+			n.Name,
+			strings.Join(n.Roles, ";"),
+			strconv.FormatBool(n.Ready),
+			strconv.FormatBool(n.Unschedulable),
+			n.KubeletVersion,
+			n.InstanceType,
+			n.Zone,
+			strconv.FormatInt(n.Capacity.CPUMillis, 10),
+			strconv.FormatInt(n.Allocatable.CPUMillis, 10),
+			cpuUsage,
+			cpuPct,
+			strconv.FormatInt(n.Capacity.MemoryBytes, 10),
+			strconv.FormatInt(n.Allocatable.MemoryBytes, 10),
+			memUsage,
+			memPct,
+			strconv.FormatInt(n.Allocatable.Pods, 10),
+			strings.Join(taints, ";"),
+		})
+	}
+	cw.Flush()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
@@ -0,0 +1,146 @@
+package nodes
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	metricsfake "k8s.io/metrics/pkg/client/clientset/versioned/fake"
+)
+
+func node(name string) *corev1.Node {
+	rl := corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("4"),
+		corev1.ResourceMemory: resource.MustParse("16Gi"),
+		corev1.ResourcePods:   resource.MustParse("110"),
+	}
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{
+			"node-role.kubernetes.io/worker": "",
+			corev1.LabelTopologyZone:         "eu-west-1a",
+		}},
+		Spec: corev1.NodeSpec{Taints: []corev1.Taint{{Key: "dedicated", Value: "batch", Effect: corev1.TaintEffectNoSchedule}}},
+		Status: corev1.NodeStatus{
+			Capacity:    rl,
+			Allocatable: rl,
+			NodeInfo:    corev1.NodeSystemInfo{KubeletVersion: "v1.37.1"},
+			Conditions:  []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+		},
+	}
+}
+
+func newTestMux(t *testing.T, metricsErr error, objs ...runtime.Object) *http.ServeMux {
+	t.Helper()
+	cs := fake.NewClientset(objs...)
+	factory := informers.NewSharedInformerFactory(cs, 0)
+
+	// The fake tracker cannot map NodeMetrics to the "nodes" resource
+	mc := metricsfake.NewSimpleClientset()
+	mc.PrependReactor("list", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if metricsErr != nil {
+			return true, nil, metricsErr
+		}
+		return true, &metricsv1beta1.NodeMetricsList{Items: []metricsv1beta1.NodeMetrics{{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+			Usage: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("1"),
+				corev1.ResourceMemory: resource.MustParse("8Gi"),
+			},
+		}}}, nil
+	})
+	inv := New(cs, factory, mc, zap.NewNop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		factory.Shutdown()
+	})
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+
+	mux := http.NewServeMux()
+	inv.Register(mux)
+	return mux
+}
+
+func TestListJoinsUsage(t *testing.T) {
+	mux := newTestMux(t, nil, node("node-a"), node("node-b"))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/nodes", nil))
+	var resp listResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+
+	if !resp.MetricsAvailable || len(resp.Items) != 2 {
+		t.Fatalf("expected 2 nodes with metrics, got %+v", resp)
+	}
+	a := resp.Items[0]
+	if a.Utilization == nil || a.Utilization.CPUPercent != 25 || a.Utilization.MemoryPercent != 50 {
+		t.Errorf("expected 25%% cpu and 50%% memory, got %+v", a.Utilization)
+	}
+	if len(a.Roles) != 1 || a.Roles[0] != "worker" || a.Zone != "eu-west-1a" || !a.Ready {
+		t.Errorf("expected worker role, zone and ready, got %+v", a)
+	}
+	if resp.Items[1].Usage != nil {
+		t.Errorf("expected no usage for node-b, got %+v", resp.Items[1].Usage)
+	}
+}
+
+func TestGetLive(t *testing.T) {
+	mux := newTestMux(t, nil, node("node-a"))
+
+	for path, want := range map[string]int{
+		"/api/v1/nodes/node-a?freshness=live":   http.StatusOK,
+		"/api/v1/nodes/node-b?freshness=live":   http.StatusNotFound,
+		"/api/v1/nodes/node-a?freshness=-1s":    http.StatusBadRequest,
+		"/api/v1/nodes/node-a?freshness=cached": http.StatusOK,
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want {
+			t.Errorf("GET %s = %d, want %d", path, rec.Code, want)
+		}
+	}
+}
+
+func TestListDegradesWithoutMetricsServer(t *testing.T) {
+	mux := newTestMux(t, errors.New("the server is currently unable to handle the request"), node("node-a"))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/nodes", nil))
+	var resp listResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusOK || resp.MetricsAvailable || len(resp.Items) != 1 {
+		t.Errorf("expected inventory without metrics, got %d %+v", rec.Code, resp)
+	}
+}
+
+func TestListExportsCSV(t *testing.T) {
+	mux := newTestMux(t, nil, node("node-a"))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/nodes?format=csv", nil))
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 2 || rows[1][0] != "node-a" || rows[1][10] != "25.0" {
+		t.Errorf("expected header and node-a row at 25.0%%, got %v", rows)
+	}
+	if rows[1][16] != "dedicated=batch:NoSchedule" {
+		t.Errorf("expected taint column, got %q", rows[1][16])
+	}
+}
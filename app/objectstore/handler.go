@@ -0,0 +1,199 @@
+package objectstore
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+)
+
+// UploadPrefix is where clients may upload through presigned PUT URLs:
+// each user only under UploadPrefix + <user> + "/".
+const UploadPrefix = "uploads/"
+
+// Prefixes of objects the service writes itself. Rendered manifests are
+// readable by every caller; scaffolds only by members of the team group
+// under ScaffoldPrefix + <team> + "/".
+const (
+	ManifestPrefix = "manifests/"
+	ScaffoldPrefix = "scaffolds/"
+)
+
+// HandlerOptions configures the presigning endpoints.
+type HandlerOptions struct {
+	// Expiry is the validity of presigned URLs when a request sets none.
+	Expiry time.Duration
+	// UserHeader and GroupsHeader carry the caller's identity, set by the
+	// authenticating proxy.
+	UserHeader   string
+	GroupsHeader string
+}
+
+// Handler serves presigned URLs for the bucket.
+type Handler struct {
+	client  *Client
+	expiry  time.Duration
+	headers authz.Headers
+	logger  *zap.Logger
+}
+
+// NewHandler creates the presigning handler.
+func NewHandler(client *Client, opts HandlerOptions, logger *zap.Logger) *Handler {
+	if opts.Expiry <= 0 {
+		opts.Expiry = 15 * time.Minute
+	}
+	return &Handler{
+		client:  client,
+		expiry:  min(opts.Expiry, MaxPresignExpiry),
+		headers: authz.Headers{User: opts.UserHeader, Groups: opts.GroupsHeader},
+		logger:  logger,
+	}
+}
+
+// Register mounts the object endpoints on mux:
+//
+//	POST /api/v1/objects/presign   presigned GET or PUT URL for a key
+//	GET  /api/v1/objects/{key...}  redirect to a presigned download URL
+//
+// Callers read only their own uploads and the objects the service wrote
+// for them; see readable.
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/v1/objects/presign", h.presign)
+	mux.HandleFunc("GET /api/v1/objects/{key...}", h.download)
+}
+
+type presignRequest struct {
+	Key    string `json:"key"`
+	Method string `json:"method"`
+	// ExpiresIn is a duration such as "15m"; empty uses the default.
+	ExpiresIn string `json:"expires_in"`
+}
+
+// Presigned is a URL granting one operation on one object.
+type Presigned struct {
+	Key       string    `json:"key"`
+	Method    string    `json:"method"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (h *Handler) presign(w http.ResponseWriter, r *http.Request) {
+	id := h.headers.Identity(r)
+	if id.User == "" {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+	var req presignRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Method == "" {
+		req.Method = http.MethodGet
+	}
+	req.Method = strings.ToUpper(req.Method)
+	if req.Method != http.MethodGet && req.Method != http.MethodPut {
+		http.Error(w, "method must be GET or PUT", http.StatusBadRequest)
+		return
+	}
+	if !ValidKey(req.Key) {
+		http.Error(w, ErrInvalidKey.Error(), http.StatusBadRequest)
+		return
+	}
+	expiry := h.expiry
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d < time.Second || d > MaxPresignExpiry {
+			http.Error(w, "expires_in must be a duration between 1s and "+MaxPresignExpiry.String(), http.StatusBadRequest)
+			return
+		}
+		expiry = d
+	}
+	if req.Method == http.MethodPut && !strings.HasPrefix(req.Key, UploadPrefix+id.User+"/") {
+		http.Error(w, "uploads are only allowed under "+UploadPrefix+id.User+"/", http.StatusForbidden)
+		return
+	}
+	if req.Method == http.MethodGet && !readable(id, req.Key) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	url, expiresAt, err := h.client.Presign(r.Context(), req.Method, req.Key, expiry)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.logger.Info("object URL presigned",
+		zap.String("audit", "objectstore"),
+		zap.String("request_id", middleware.GetRequestID(r.Context())),
+		zap.String("user", id.User),
+		zap.String("method", req.Method),
+		zap.String("key", req.Key),
+		zap.Duration("expiry", expiry),
+	)
+	writeJSON(w, http.StatusOK, Presigned{Key: req.Key, Method: req.Method, URL: url, ExpiresAt: expiresAt})
+}
+
+// download redirects to a presigned URL after checking the object exists,
+// so a missing key is a 404 from the service rather than an XML error
+// from the bucket.
+func (h *Handler) download(w http.ResponseWriter, r *http.Request) {
+	id := h.headers.Identity(r)
+	if id.User == "" {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+	key := r.PathValue("key")
+	if !ValidKey(key) {
+		http.Error(w, ErrInvalidKey.Error(), http.StatusBadRequest)
+		return
+	}
+	// Checked before the lookup, so other keys' existence does not leak
+	if !readable(id, key) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if _, err := h.client.Stat(r.Context(), key); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "object not found", http.StatusNotFound)
+			return
+		}
+		h.logger.Warn("failed to look up object", zap.String("key", key), zap.Error(err))
+		http.Error(w, "object store unavailable", http.StatusBadGateway)
+		return
+	}
+	url, _, err := h.client.Presign(r.Context(), http.MethodGet, key, h.expiry)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+}
+
+// readable reports whether id may download key: its own uploads, rendered
+// manifests, and scaffolds of teams it is a member of.
+func readable(id authz.Identity, key string) bool {
+	switch {
+	case strings.HasPrefix(key, UploadPrefix+id.User+"/"), strings.HasPrefix(key, ManifestPrefix):
+		return true
+	case strings.HasPrefix(key, ScaffoldPrefix):
+		team, _, ok := strings.Cut(strings.TrimPrefix(key, ScaffoldPrefix), "/")
+		return ok && slices.Contains(id.Groups, team)
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
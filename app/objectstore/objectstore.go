@@ -0,0 +1,338 @@
+// Package objectstore keeps large artifacts (rendered manifests, scaffolding
+// outputs, exports) in an S3-compatible bucket such as AWS S3 or MinIO, and
+// hands out presigned URLs so clients transfer them directly with the
+// bucket instead of through the service.
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+)
+
+// MaxPresignExpiry is the longest validity SigV4 allows a presigned URL.
+const MaxPresignExpiry = 7 * 24 * time.Hour
+
+var (
+	// ErrNotFound is returned for missing objects.
+	ErrNotFound = errs.New(errs.NotFound, "object not found")
+	// ErrInvalidKey is returned for keys that are empty, too long or
+	// contain empty or dot segments.
+	ErrInvalidKey = errs.New(errs.Invalid, "invalid object key")
+)
+
+var requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "objectstore_request_duration_seconds",
+	Help:    "Object store request latency by operation and result.",
+	Buckets: prometheus.ExponentialBuckets(0.005, 2, 14),
+}, []string{"operation", "result"})
+
+// Options configures a Client.
+type Options struct {
+	// Endpoint is the S3 API base URL, e.g. https://s3.eu-west-1.amazonaws.com
+	// or http://minio:9000.
+	Endpoint string
+	// PublicEndpoint is the base URL presigned URLs point at, for when
+	// clients reach the bucket under another name than the service does.
+	// Empty uses Endpoint.
+	PublicEndpoint string
+	Region         string
+	Bucket         string
+	// PathStyle addresses the bucket as <endpoint>/<bucket> (MinIO)
+	// instead of <bucket>.<endpoint host> (S3 virtual-hosted style).
+	PathStyle bool
+	// Prefix is prepended to every key, so several services can share a
+	// bucket.
+	Prefix string
+
+	// AccessKeyID, SecretAccessKey and SessionToken are static
+	// credentials. Without them the AWS SDK's default credential chain is
+	// used.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// Object describes a stored object.
+type Object struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// APIError is a non-2xx response from the object store.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("objectstore: status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("objectstore: status %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Client reads and writes objects in one bucket.
+type Client struct {
+	endpoint *url.URL
+	public   *url.URL
+	opts     Options
+	http     *http.Client
+	creds    aws.CredentialsProvider
+	signer   *v4.Signer
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// New creates a client sending requests through hc.
+func New(hc *http.Client, opts Options) (*Client, error) {
+	endpoint, err := parseEndpoint(opts.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	public := endpoint
+	if opts.PublicEndpoint != "" {
+		if public, err = parseEndpoint(opts.PublicEndpoint); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case opts.Bucket == "":
+		return nil, errors.New("objectstore: bucket is required")
+	case opts.Region == "":
+		return nil, errors.New("objectstore: region is required")
+	}
+	creds, err := credentialsProvider(context.Background(), hc, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{endpoint: endpoint, public: public, opts: opts, http: hc, creds: creds, signer: v4.NewSigner(), now: time.Now}, nil
+}
+
+func parseEndpoint(raw string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSuffix(raw, "/"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("objectstore: invalid endpoint %q", raw)
+	}
+	return u, nil
+}
+
+// ValidKey reports whether key can name an object.
+func ValidKey(key string) bool {
+	if key == "" || len(key) > 1024 || !utf8.ValidString(key) {
+		return false
+	}
+	for seg := range strings.SplitSeq(key, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// objectURL returns the URL of key (or of the bucket when key is empty)
+// under base.
+func (c *Client) objectURL(base *url.URL, key string) *url.URL {
+	u := *base
+	p := u.Path
+	if c.opts.PathStyle {
+		p += "/" + c.opts.Bucket
+	} else {
+		u.Host = c.opts.Bucket + "." + u.Host
+	}
+	if key != "" {
+		p += "/" + c.opts.Prefix + key
+	}
+	if p == "" {
+		p = "/"
+	}
+	u.Path = p
+	u.RawPath = escapePath(p)
+	return &u
+}
+
+// Put stores data under key.
+func (c *Client) Put(ctx context.Context, key, contentType string, data []byte) error {
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	resp, err := c.do(ctx, "put", http.MethodPut, key, header, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Upload stores data under key and presigns a download URL for it, valid
+// for expiry.
+func (c *Client) Upload(ctx context.Context, key, contentType string, data []byte, expiry time.Duration) (*Presigned, error) {
+	if err := c.Put(ctx, key, contentType, data); err != nil {
+		return nil, err
+	}
+	url, expiresAt, err := c.Presign(ctx, http.MethodGet, key, expiry)
+	if err != nil {
+		return nil, err
+	}
+	return &Presigned{Key: key, Method: http.MethodGet, URL: url, ExpiresAt: expiresAt}, nil
+}
+
+// Get opens key for reading; the caller closes the body.
+func (c *Client) Get(ctx context.Context, key string) (io.ReadCloser, *Object, error) {
+	if !ValidKey(key) {
+		return nil, nil, ErrInvalidKey
+	}
+	resp, err := c.do(ctx, "get", http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.Body, objectFromHeader(key, resp), nil
+}
+
+// Stat returns key's metadata.
+func (c *Client) Stat(ctx context.Context, key string) (*Object, error) {
+	if !ValidKey(key) {
+		return nil, ErrInvalidKey
+	}
+	resp, err := c.do(ctx, "stat", http.MethodHead, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return objectFromHeader(key, resp), nil
+}
+
+// Delete removes key; deleting a missing object succeeds.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+	resp, err := c.do(ctx, "delete", http.MethodDelete, key, nil, nil)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Check reports whether the bucket is reachable with the configured
+// credentials, for readiness probes.
+func (c *Client) Check(ctx context.Context) error {
+	resp, err := c.do(ctx, "check", http.MethodHead, "", nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Presign returns a URL that lets its holder perform method (GET or PUT)
+// on key until expiry passes, without credentials of their own.
+func (c *Client) Presign(ctx context.Context, method, key string, expiry time.Duration) (string, time.Time, error) {
+	if !ValidKey(key) {
+		return "", time.Time{}, ErrInvalidKey
+	}
+	if method != http.MethodGet && method != http.MethodPut {
+		return "", time.Time{}, fmt.Errorf("objectstore: cannot presign %s", method)
+	}
+	if expiry <= 0 || expiry > MaxPresignExpiry {
+		return "", time.Time{}, fmt.Errorf("objectstore: expiry must be between 1s and %s", MaxPresignExpiry)
+	}
+	now := c.now().UTC()
+	u := c.objectURL(c.public, key)
+	query, err := c.presign(ctx, method, u, now, expiry)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	u.RawQuery = query
+	return u.String(), now.Add(expiry).Truncate(time.Second), nil
+}
+
+func (c *Client) do(ctx context.Context, op, method, key string, header http.Header, body []byte) (*http.Response, error) {
+	u := c.objectURL(c.endpoint, key)
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), r)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if err := c.sign(req, body, c.now().UTC()); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := c.http.Do(req)
+	result := "success"
+	switch {
+	case err != nil:
+		result = "error"
+	case resp.StatusCode == http.StatusNotFound:
+		result = "not_found"
+	case resp.StatusCode >= 300:
+		result = "error"
+	}
+	requestDuration.WithLabelValues(op, result).Observe(time.Since(start).Seconds())
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, apiError(resp)
+	}
+	return resp, nil
+}
+
+func apiError(resp *http.Response) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	// HEAD responses have no body, leaving only the status
+	xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body)
+	return &APIError{StatusCode: resp.StatusCode, Code: body.Code, Message: body.Message}
+}
+
+func objectFromHeader(key string, resp *http.Response) *Object {
+	o := &Object{
+		Key:         key,
+		Size:        max(resp.ContentLength, 0),
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag:        strings.Trim(resp.Header.Get("ETag"), `"`),
+	}
+	o.LastModified, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return o
+}
@@ -0,0 +1,109 @@
+package objectstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+// unsignedPayload stands in for the body hash of presigned requests, whose
+// body is not known when signing.
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// credentialsProvider returns the static keys of opts when set, or the
+// AWS SDK's default credential chain: environment, shared config, IRSA web
+// identity or the instance role.
+func credentialsProvider(ctx context.Context, hc *http.Client, opts Options) (aws.CredentialsProvider, error) {
+	if opts.AccessKeyID != "" || opts.SecretAccessKey != "" {
+		if opts.AccessKeyID == "" || opts.SecretAccessKey == "" {
+			return nil, errors.New("objectstore: access key ID and secret access key must be set together")
+		}
+		return credentials.NewStaticCredentialsProvider(opts.AccessKeyID, opts.SecretAccessKey, opts.SessionToken), nil
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithHTTPClient(hc))
+	if err != nil {
+		return nil, fmt.Errorf("objectstore: load AWS configuration: %w", err)
+	}
+	return cfg.Credentials, nil
+}
+
+// signOptions addresses objects as S3 does: their paths are escaped once,
+// not twice as for other services.
+func signOptions(o *v4.SignerOptions) {
+	o.DisableURIPathEscaping = true
+}
+
+// sign adds AWS Signature Version 4 headers for the s3 service.
+func (c *Client) sign(req *http.Request, body []byte, now time.Time) error {
+	creds, err := c.creds.Retrieve(req.Context())
+	if err != nil {
+		return fmt.Errorf("objectstore: retrieve credentials: %w", err)
+	}
+	payloadHash := hexSHA256(body)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	return c.signer.SignHTTP(req.Context(), creds, req, payloadHash, "s3", c.opts.Region, now, signOptions)
+}
+
+// presign returns the query string authorizing method on u for expiry.
+// Only the host header is signed, so clients may send any others.
+func (c *Client) presign(ctx context.Context, method string, u *url.URL, now time.Time, expiry time.Duration) (string, error) {
+	creds, err := c.creds.Retrieve(ctx)
+	if err != nil {
+		return "", fmt.Errorf("objectstore: retrieve credentials: %w", err)
+	}
+	q := url.Values{}
+	q.Set("X-Amz-Expires", strconv.Itoa(int(expiry.Seconds())))
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	signed, _, err := c.signer.PresignHTTP(ctx, creds, req, unsignedPayload, "s3", c.opts.Region, now, signOptions)
+	if err != nil {
+		return "", err
+	}
+	su, err := url.Parse(signed)
+	if err != nil {
+		return "", err
+	}
+	return su.RawQuery, nil
+}
+
+// escapePath encodes an object path, keeping the slashes.
+func escapePath(p string) string {
+	return uriEncode(p, false)
+}
+
+// uriEncode percent-encodes everything but unreserved characters, and
+// slashes unless encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case 'A' <= ch && ch <= 'Z', 'a' <= ch && ch <= 'z', '0' <= ch && ch <= '9',
+			ch == '-', ch == '_', ch == '.', ch == '~', ch == '/' && !encodeSlash:
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+func hexSHA256(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,65 @@
+package onboarding
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+)
+
+// Register mounts the onboarding endpoints on mux:
+//
+//	POST /api/v1/tenants/{tenant}/onboarding   start (or re-run) onboarding
+//	GET  /api/v1/tenants/{tenant}/onboarding   latest run with per-step status
+func (e *Engine) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/v1/tenants/{tenant}/onboarding", e.start)
+	mux.HandleFunc("GET /api/v1/tenants/{tenant}/onboarding", e.status)
+}
+
+func (e *Engine) start(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Tenant = r.PathValue("tenant")
+
+	wf, err := e.Start(r.Context(), req)
+	switch {
+	case errors.Is(err, ErrInProgress):
+		writeJSON(w, http.StatusConflict, wf)
+	case errors.Is(err, errs.Invalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case err != nil:
+		// The queue could not take the run; the request itself is fine
+		e.logger.Error("failed to start onboarding", zap.String("tenant", req.Tenant), zap.Error(err))
+		status := http.StatusInternalServerError
+		if errs.Kind(err) == errs.Unavailable {
+			status = http.StatusServiceUnavailable
+			w.Header().Set("Retry-After", "1")
+		}
+		http.Error(w, "failed to start onboarding", status)
+	default:
+		w.Header().Set("Location", r.URL.Path)
+		writeJSON(w, http.StatusAccepted, wf)
+	}
+}
+
+func (e *Engine) status(w http.ResponseWriter, r *http.Request) {
+	wf, ok := e.Get(r.PathValue("tenant"))
+	if !ok {
+		http.Error(w, "no onboarding run for tenant", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, wf)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
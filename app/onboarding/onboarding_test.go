@@ -0,0 +1,270 @@
+package onboarding
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/queue"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+func newEngine(cs *fake.Clientset) (*Engine, *store.Store) {
+	st := store.NewMemory()
+	e := New(cs, st.Tenants, events.NewMemoryBus(), Options{
+		DefaultQuota:       map[string]string{"pods": "50"},
+		PullSecretSource:   "platform/registry-creds",
+		IngressNamespace:   "ingress-nginx",
+		ReservedNamespaces: []string{"platform"},
+	}, zap.NewNop())
+	return e, st
+}
+
+func pullSecret() *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "platform", Name: "registry-creds"},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{}}`)},
+	}
+}
+
+func wait(t *testing.T, e *Engine, tenant string) Workflow {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		t.Fatalf("workflow did not finish: %v", err)
+	}
+	wf, _ := e.Get(tenant)
+	return wf
+}
+
+func TestOnboardingProvisionsTenant(t *testing.T) {
+	cs := fake.NewClientset(pullSecret())
+	e, st := newEngine(cs)
+	ctx := context.Background()
+
+	req := Request{Tenant: "team-a", Owner: "alice", Groups: map[string]string{"team-a-admins": "admin", "sre": "view"}}
+	if _, err := e.Start(ctx, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wf := wait(t, e, "team-a")
+	if wf.Status != StatusSucceeded {
+		t.Fatalf("expected succeeded, got %s: %+v", wf.Status, wf.Steps)
+	}
+
+	if _, err := cs.CoreV1().Namespaces().Get(ctx, "team-a", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected namespace, got %v", err)
+	}
+	if _, err := cs.RbacV1().RoleBindings("team-a").Get(ctx, "platform-tenant-admin", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected admin role binding, got %v", err)
+	}
+	if _, err := cs.CoreV1().Secrets("team-a").Get(ctx, "registry-creds", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected copied pull secret, got %v", err)
+	}
+	nps, _ := cs.NetworkingV1().NetworkPolicies("team-a").List(ctx, metav1.ListOptions{})
+	if len(nps.Items) != 3 {
+		t.Errorf("expected 3 network policies, got %d", len(nps.Items))
+	}
+	tenants, _ := st.Tenants.List(ctx)
+	if len(tenants) != 1 || tenants[0].Owner != "alice" {
+		t.Errorf("expected tenant record owned by alice, got %+v", tenants)
+	}
+
+	// Re-running is idempotent
+	if _, err := e.Start(ctx, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if wf := wait(t, e, "team-a"); wf.Status != StatusSucceeded {
+		t.Errorf("expected re-run to succeed, got %s: %+v", wf.Status, wf.Steps)
+	}
+}
+
+func TestOnboardingCompensatesOnFailure(t *testing.T) {
+	cs := fake.NewClientset(pullSecret())
+	cs.PrependReactor("create", "networkpolicies", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(corev1.Resource("networkpolicies"), "", errors.New("denied"))
+	})
+	e, st := newEngine(cs)
+	ctx := context.Background()
+
+	if _, err := e.Start(ctx, Request{Tenant: "team-b", Groups: map[string]string{"devs": "edit"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wf := wait(t, e, "team-b")
+	if wf.Status != StatusFailed {
+		t.Fatalf("expected failed, got %s", wf.Status)
+	}
+
+	want := map[string]Status{
+		"namespace":         StatusCompensated,
+		"rbac":              StatusCompensated,
+		"quota":             StatusCompensated,
+		"image-pull-secret": StatusCompensated,
+		"network-policies":  StatusFailed,
+		"tenant-record":     StatusPending,
+	}
+	for _, s := range wf.Steps {
+		if s.Status != want[s.Name] {
+			t.Errorf("step %s: expected %s, got %s", s.Name, want[s.Name], s.Status)
+		}
+	}
+	if _, err := cs.CoreV1().Namespaces().Get(ctx, "team-b", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected namespace to be removed, got %v", err)
+	}
+	if tenants, _ := st.Tenants.List(ctx); len(tenants) != 0 {
+		t.Errorf("expected no tenant record, got %+v", tenants)
+	}
+}
+
+func TestOnboardingRetriesQueuedJob(t *testing.T) {
+	cs := fake.NewClientset(pullSecret())
+	attempts := 0
+	cs.PrependReactor("create", "networkpolicies", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if attempts++; attempts == 1 {
+			return true, nil, apierrors.NewServiceUnavailable("try again")
+		}
+		return false, nil, nil
+	})
+	e, st := newEngine(cs)
+	q := queue.New(st.Queue, queue.Options{PollInterval: 10 * time.Millisecond, BackoffBase: time.Millisecond, BackoffMax: time.Millisecond}, zap.NewNop())
+	e.UseQueue(q)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wf, err := e.Start(ctx, Request{Tenant: "team-c", Groups: map[string]string{"devs": "edit"}})
+	if err != nil || wf.Status != StatusPending || wf.JobID == "" {
+		t.Fatalf("expected a pending workflow with its job, got %+v (%v)", wf, err)
+	}
+	if _, err := e.Start(ctx, Request{Tenant: "team-c"}); !errors.Is(err, ErrInProgress) {
+		t.Errorf("expected ErrInProgress while the job is queued, got %v", err)
+	}
+	go q.Run(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, _ := st.Queue.Get(ctx, wf.JobID)
+		if job.Status == store.JobSucceeded {
+			if job.Attempts != 2 {
+				t.Errorf("expected the failed run retried once, got %d attempts", job.Attempts)
+			}
+			break
+		}
+		if job.Status == store.JobDead || time.Now().After(deadline) {
+			t.Fatalf("job did not succeed: %+v", job)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if wf := wait(t, e, "team-c"); wf.Status != StatusSucceeded || wf.JobID == "" {
+		t.Errorf("expected the retried workflow to succeed, got %+v", wf)
+	}
+}
+
+func TestRequestValidation(t *testing.T) {
+	tests := []Request{
+		{Tenant: "Team_A"},
+		{Tenant: "team-a", Groups: map[string]string{"devs": "cluster-admin"}},
+		{Tenant: "team-a", Quota: map[string]string{"requests.cpu": "lots"}},
+		{Tenant: "default"},
+		{Tenant: "kube-system"},
+		{Tenant: "kube-public"},
+	}
+	for _, req := range tests {
+		if err := req.Validate(); err == nil {
+			t.Errorf("expected validation error for %+v", req)
+		}
+	}
+
+	// The platform's own namespace is reserved by the engine
+	e, _ := newEngine(fake.NewClientset())
+	if _, err := e.Start(context.Background(), Request{Tenant: "platform"}); err == nil {
+		t.Error("expected the platform namespace refused")
+	}
+}
+
+// failingQueue refuses every job with err.
+type failingQueue struct {
+	store.QueueRepository
+	err error
+}
+
+func (q failingQueue) Enqueue(context.Context, *store.QueueJob) error { return q.err }
+
+func TestStartStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		tenant  string
+		body    string
+		enqueue error
+		want    int
+	}{
+		{"invalid request", "team-e", `{"groups":{"devs":"cluster-admin"}}`, nil, http.StatusBadRequest},
+		{"reserved tenant", "platform", `{}`, nil, http.StatusBadRequest},
+		{"queue unavailable", "team-e", `{}`, errs.Errorf(errs.Unavailable, "database down"), http.StatusServiceUnavailable},
+		{"queue failed", "team-e", `{}`, errors.New("disk full"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, st := newEngine(fake.NewClientset())
+			e.UseQueue(queue.New(failingQueue{st.Queue, tt.enqueue}, queue.Options{}, zap.NewNop()))
+			mux := http.NewServeMux()
+			e.Register(mux)
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/tenants/"+tt.tenant+"/onboarding", strings.NewReader(tt.body)))
+			if rec.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body)
+			}
+			if _, ok := e.Get(tt.tenant); ok {
+				t.Error("expected no workflow kept")
+			}
+		})
+	}
+}
+
+func TestOnboardingRefusesUnmanagedNamespace(t *testing.T) {
+	for name, nsLabels := range map[string]map[string]string{
+		"unlabelled":       nil,
+		"other tenant":     {tenantLabel: "team-x", managedByLabel: managedBy},
+		"not the platform": {tenantLabel: "team-d", managedByLabel: "helm"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-d", Labels: nsLabels}}
+			cs := fake.NewClientset(pullSecret(), ns)
+			e, st := newEngine(cs)
+			ctx := context.Background()
+
+			if _, err := e.Start(ctx, Request{Tenant: "team-d", Groups: map[string]string{"devs": "admin"}}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			wf := wait(t, e, "team-d")
+			if wf.Status != StatusFailed || wf.Steps[0].Status != StatusFailed {
+				t.Fatalf("expected the namespace step to fail, got %s: %+v", wf.Status, wf.Steps)
+			}
+			got, err := cs.CoreV1().Namespaces().Get(ctx, "team-d", metav1.GetOptions{})
+			if err != nil || len(got.Labels) != len(nsLabels) {
+				t.Errorf("expected the namespace left as it was, got %+v %v", got, err)
+			}
+			if bindings, _ := cs.RbacV1().RoleBindings("team-d").List(ctx, metav1.ListOptions{}); len(bindings.Items) != 0 {
+				t.Errorf("expected no role bindings granted, got %d", len(bindings.Items))
+			}
+			if tenants, _ := st.Tenants.List(ctx); len(tenants) != 0 {
+				t.Errorf("expected no tenant record, got %+v", tenants)
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package onboarding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+const (
+	tenantLabel    = "platform.io/tenant"
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedBy      = "platform-api"
+	quotaName      = "platform-tenant-quota"
+)
+
+// clusterRoles maps request roles to the built-in aggregated ClusterRoles.
+var clusterRoles = map[string]string{"admin": "admin", "edit": "edit", "view": "view"}
+
+// errSkipped marks a step that has nothing to do with the current options.
+var errSkipped = errors.New("skipped")
+
+// step is one unit of the workflow. apply returns an undo function when it
+// created something this run, nil when everything already existed.
+type step struct {
+	name  string
+	apply func(ctx context.Context) (undo func(context.Context) error, err error)
+}
+
+func (e *Engine) steps(req Request) []step {
+	return []step{
+		{"namespace", func(ctx context.Context) (func(context.Context) error, error) { return e.namespace(ctx, req) }},
+		{"rbac", func(ctx context.Context) (func(context.Context) error, error) { return e.roleBindings(ctx, req) }},
+		{"quota", func(ctx context.Context) (func(context.Context) error, error) { return e.quota(ctx, req) }},
+		{"image-pull-secret", func(ctx context.Context) (func(context.Context) error, error) { return e.pullSecret(ctx, req) }},
+		{"network-policies", func(ctx context.Context) (func(context.Context) error, error) { return e.networkPolicies(ctx, req) }},
+		{"tenant-record", func(ctx context.Context) (func(context.Context) error, error) { return e.record(ctx, req) }},
+	}
+}
+
+func labels(tenant string) map[string]string {
+	return map[string]string{tenantLabel: tenant, managedByLabel: managedBy}
+}
+
+func (e *Engine) namespace(ctx context.Context, req Request) (func(context.Context) error, error) {
+	api := e.clientset.CoreV1().Namespaces()
+	existing, err := api.Get(ctx, req.Tenant, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: req.Tenant, Labels: labels(req.Tenant)}}
+		if _, err := api.Create(ctx, ns, metav1.CreateOptions{}); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) error {
+			return ignoreNotFound(api.Delete(ctx, req.Tenant, metav1.DeleteOptions{}))
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Only namespaces the platform created for this tenant are taken over
+	if existing.Labels[managedByLabel] != managedBy || existing.Labels[tenantLabel] != req.Tenant {
+		return nil, fmt.Errorf("namespace %q exists and is not managed by the platform for tenant %q", req.Tenant, req.Tenant)
+	}
+	return nil, nil
+}
+
+func (e *Engine) roleBindings(ctx context.Context, req Request) (func(context.Context) error, error) {
+	byRole := make(map[string][]rbacv1.Subject)
+	for group, role := range req.Groups {
+		byRole[role] = append(byRole[role], rbacv1.Subject{Kind: rbacv1.GroupKind, APIGroup: rbacv1.GroupName, Name: group})
+	}
+
+	api := e.clientset.RbacV1().RoleBindings(req.Tenant)
+	var created []string
+	undo := func(ctx context.Context) error {
+		var errs []error
+		for _, name := range created {
+			errs = append(errs, ignoreNotFound(api.Delete(ctx, name, metav1.DeleteOptions{})))
+		}
+		return errors.Join(errs...)
+	}
+
+	roles := make([]string, 0, len(byRole))
+	for role := range byRole {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+
+	for _, role := range roles {
+		subjects := byRole[role]
+		sort.Slice(subjects, func(i, j int) bool { return subjects[i].Name < subjects[j].Name })
+		rb := &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "platform-tenant-" + role, Namespace: req.Tenant, Labels: labels(req.Tenant)},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: clusterRoles[role]},
+			Subjects:   subjects,
+		}
+		existing, err := api.Get(ctx, rb.Name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			if _, err := api.Create(ctx, rb, metav1.CreateOptions{}); err != nil {
+				return undo, err
+			}
+			created = append(created, rb.Name)
+		case err != nil:
+			return undo, err
+		default:
+			existing.Subjects = rb.Subjects
+			if _, err := api.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+				return undo, err
+			}
+		}
+	}
+	if len(created) == 0 {
+		return nil, nil
+	}
+	return undo, nil
+}
+
+func (e *Engine) quota(ctx context.Context, req Request) (func(context.Context) error, error) {
+	hard := corev1.ResourceList{}
+	for _, limits := range []map[string]string{e.opts.DefaultQuota, req.Quota} {
+		for name, value := range limits {
+			q, err := parseQuantity(name, value)
+			if err != nil {
+				return nil, err
+			}
+			hard[corev1.ResourceName(name)] = q
+		}
+	}
+	if len(hard) == 0 {
+		return nil, errSkipped
+	}
+
+	api := e.clientset.CoreV1().ResourceQuotas(req.Tenant)
+	existing, err := api.Get(ctx, quotaName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		rq := &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: quotaName, Namespace: req.Tenant, Labels: labels(req.Tenant)},
+			Spec:       corev1.ResourceQuotaSpec{Hard: hard},
+		}
+		if _, err := api.Create(ctx, rq, metav1.CreateOptions{}); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) error {
+			return ignoreNotFound(api.Delete(ctx, quotaName, metav1.DeleteOptions{}))
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	existing.Spec.Hard = hard
+	_, err = api.Update(ctx, existing, metav1.UpdateOptions{})
+	return nil, err
+}
+
+func (e *Engine) pullSecret(ctx context.Context, req Request) (func(context.Context) error, error) {
+	if e.opts.PullSecretSource == "" {
+		return nil, errSkipped
+	}
+	srcNS, srcName, ok := strings.Cut(e.opts.PullSecretSource, "/")
+	if !ok {
+		return nil, fmt.Errorf("pull secret source %q is not namespace/name", e.opts.PullSecretSource)
+	}
+	src, err := e.clientset.CoreV1().Secrets(srcNS).Get(ctx, srcName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("read pull secret source: %w", err)
+	}
+
+	api := e.clientset.CoreV1().Secrets(req.Tenant)
+	existing, err := api.Get(ctx, srcName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: srcName, Namespace: req.Tenant, Labels: labels(req.Tenant)},
+			Type:       src.Type,
+			Data:       src.Data,
+		}
+		if _, err := api.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) error {
+			return ignoreNotFound(api.Delete(ctx, srcName, metav1.DeleteOptions{}))
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	existing.Data = src.Data
+	_, err = api.Update(ctx, existing, metav1.UpdateOptions{})
+	return nil, err
+}
+
+func (e *Engine) networkPolicies(ctx context.Context, req Request) (func(context.Context) error, error) {
+	policies := []*networkingv1.NetworkPolicy{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "default-deny-ingress"},
+			Spec: networkingv1.NetworkPolicySpec{
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "allow-same-namespace"},
+			Spec: networkingv1.NetworkPolicySpec{
+				Ingress: []networkingv1.NetworkPolicyIngressRule{{
+					From: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}},
+				}},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			},
+		},
+	}
+	if e.opts.IngressNamespace != "" {
+		policies = append(policies, &networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "allow-ingress-controller"},
+			Spec: networkingv1.NetworkPolicySpec{
+				Ingress: []networkingv1.NetworkPolicyIngressRule{{
+					From: []networkingv1.NetworkPolicyPeer{{NamespaceSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{corev1.LabelMetadataName: e.opts.IngressNamespace},
+					}}},
+				}},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			},
+		})
+	}
+
+	api := e.clientset.NetworkingV1().NetworkPolicies(req.Tenant)
+	var created []string
+	undo := func(ctx context.Context) error {
+		var errs []error
+		for _, name := range created {
+			errs = append(errs, ignoreNotFound(api.Delete(ctx, name, metav1.DeleteOptions{})))
+		}
+		return errors.Join(errs...)
+	}
+
+	for _, np := range policies {
+		np.Namespace = req.Tenant
+		np.Labels = labels(req.Tenant)
+		existing, err := api.Get(ctx, np.Name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			if _, err := api.Create(ctx, np, metav1.CreateOptions{}); err != nil {
+				return undo, err
+			}
+			created = append(created, np.Name)
+		case err != nil:
+			return undo, err
+		default:
+			existing.Spec = np.Spec
+			if _, err := api.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+				return undo, err
+			}
+		}
+	}
+	if len(created) == 0 {
+		return nil, nil
+	}
+	return undo, nil
+}
+
+func (e *Engine) record(ctx context.Context, req Request) (func(context.Context) error, error) {
+	tenants, err := e.tenants.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tenants {
+		if t.Name != req.Tenant {
+			continue
+		}
+		if req.DisplayName != "" {
+			t.DisplayName = req.DisplayName
+		}
+		if req.Owner != "" {
+			t.Owner = req.Owner
+		}
+		return nil, e.tenants.Update(ctx, &t)
+	}
+
+	t := &store.Tenant{
+		Name:        req.Tenant,
+		DisplayName: req.DisplayName,
+		Owner:       req.Owner,
+		Labels:      map[string]string{"namespace": req.Tenant},
+	}
+	if err := e.tenants.Create(ctx, t); err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		if err := e.tenants.Delete(ctx, t.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+		return nil
+	}, nil
+}
+
+func parseQuantity(name, value string) (resource.Quantity, error) {
+	q, err := resource.ParseQuantity(value)
+	if err != nil {
+		return q, fmt.Errorf("quota %q: invalid quantity %q", name, value)
+	}
+	return q, nil
+}
+
+func ignoreNotFound(err error) error {
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,389 @@
+// Package onboarding provisions a tenant in one idempotent workflow: the
+// namespace, RBAC group bindings, resource quota, image pull secret, default
+// NetworkPolicies and the tenant record. Each step reports its own status; if
+// a step fails, objects created by earlier steps of the same run are removed
+// again in reverse order. Objects that already existed are left in place, so
+// re-running onboarding for an existing tenant is safe.
+//
+// With a job queue (see UseQueue) workflows run as durable jobs: a run that
+// fails, or is cut short by a restart, is retried with backoff by whichever
+// replica claims the job.
+package onboarding
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/queue"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+// JobType is the queue job type of onboarding workflows.
+const JobType = "tenant.onboard"
+
+// ErrInProgress is returned when the tenant already has a running workflow.
+var ErrInProgress = errs.New(errs.Conflict, "onboarding already in progress")
+
+var workflowsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "tenant_onboarding_workflows_total",
+	Help: "Completed tenant onboarding workflows by final status.",
+}, []string{"status"})
+
+// Status of a workflow or step.
+type Status string
+
+const (
+	StatusPending     Status = "pending"
+	StatusRunning     Status = "running"
+	StatusSucceeded   Status = "succeeded"
+	StatusFailed      Status = "failed"
+	StatusSkipped     Status = "skipped"
+	StatusCompensated Status = "compensated"
+)
+
+// Request describes the tenant to provision.
+type Request struct {
+	Tenant      string `json:"tenant"`
+	DisplayName string `json:"display_name"`
+	Owner       string `json:"owner"`
+	// Groups maps identity provider groups to a namespace role: admin, edit or view.
+	Groups map[string]string `json:"groups"`
+	// Quota overrides the default ResourceQuota hard limits, e.g. {"requests.cpu": "8"}.
+	Quota map[string]string `json:"quota,omitempty"`
+}
+
+// Validate checks the request before any step runs. Tenants are named
+// after their namespace, so names of the cluster's own namespaces are
+// refused. Its errors are errs.Invalid.
+func (r *Request) Validate() error {
+	if msgs := validation.IsDNS1123Label(r.Tenant); len(msgs) > 0 {
+		return errs.Errorf(errs.Invalid, "invalid tenant name %q: %s", r.Tenant, msgs[0])
+	}
+	if r.Tenant == "default" || strings.HasPrefix(r.Tenant, "kube-") {
+		return errs.Errorf(errs.Invalid, "tenant name %q is reserved for the cluster", r.Tenant)
+	}
+	for group, role := range r.Groups {
+		if _, ok := clusterRoles[role]; !ok {
+			return errs.Errorf(errs.Invalid, "group %q: unknown role %q (want admin, edit or view)", group, role)
+		}
+	}
+	for name, qty := range r.Quota {
+		if _, err := parseQuantity(name, qty); err != nil {
+			return errs.Wrap(errs.Invalid, err)
+		}
+	}
+	return nil
+}
+
+// StepState is the progress of one step.
+type StepState struct {
+	Name       string     `json:"name"`
+	Status     Status     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Workflow is one onboarding run.
+type Workflow struct {
+	Tenant string `json:"tenant"`
+	Status Status `json:"status"`
+	// JobID is the queue job running the workflow, when there is a queue.
+	// Until a worker claims it the workflow is pending.
+	JobID      string      `json:"job_id,omitempty"`
+	Steps      []StepState `json:"steps"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+}
+
+// Options configures the provisioned defaults.
+type Options struct {
+	// DefaultQuota is applied to every tenant namespace; Request.Quota overrides it.
+	DefaultQuota map[string]string
+	// PullSecretSource is "namespace/name" of an image pull secret copied
+	// into each tenant namespace (empty = skip the step).
+	PullSecretSource string
+	// IngressNamespace is allowed to reach tenant pods through the default
+	// NetworkPolicies (empty = same-namespace traffic only).
+	IngressNamespace string
+	// Timeout bounds a whole workflow run.
+	Timeout time.Duration
+	// ReservedNamespaces are namespaces no tenant may be named after, such
+	// as the platform's own.
+	ReservedNamespaces []string
+}
+
+// Engine runs onboarding workflows and keeps the latest run per tenant.
+type Engine struct {
+	clientset kubernetes.Interface
+	tenants   store.TenantRepository
+	bus       events.Publisher
+	queue     *queue.Queue
+	opts      Options
+	logger    *zap.Logger
+
+	mu        sync.Mutex
+	workflows map[string]*Workflow
+	running   sync.WaitGroup
+}
+
+// New creates an onboarding engine.
+func New(cs kubernetes.Interface, tenants store.TenantRepository, bus events.Publisher, opts Options, logger *zap.Logger) *Engine {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 2 * time.Minute
+	}
+	return &Engine{
+		clientset: cs,
+		tenants:   tenants,
+		bus:       bus,
+		opts:      opts,
+		logger:    logger,
+		workflows: make(map[string]*Workflow),
+	}
+}
+
+// UseQueue runs workflows as jobs of q instead of in-process goroutines,
+// registering the JobType handler. Call it before q runs. The queue's
+// lease must cover a run and its compensation, twice Options.Timeout.
+func (e *Engine) UseQueue(q *queue.Queue) {
+	e.queue = q
+	q.Handle(JobType, e.runJob)
+}
+
+// Start validates req and runs the workflow in the background, or queues
+// it when the engine uses a queue. ctx only carries request-scoped values;
+// the run is bounded by Options.Timeout.
+func (e *Engine) Start(ctx context.Context, req Request) (Workflow, error) {
+	if err := e.validate(req); err != nil {
+		return Workflow{}, err
+	}
+	steps := e.steps(req)
+
+	e.mu.Lock()
+	if wf, ok := e.workflows[req.Tenant]; ok && e.inProgress(ctx, wf) {
+		snapshot := copyWorkflow(wf)
+		e.mu.Unlock()
+		return snapshot, ErrInProgress
+	}
+	wf := newWorkflow(req.Tenant, steps)
+	if e.queue != nil {
+		wf.Status = StatusPending
+		e.workflows[req.Tenant] = wf
+		e.mu.Unlock()
+		job, err := e.queue.Enqueue(ctx, JobType, req)
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if err != nil {
+			delete(e.workflows, req.Tenant)
+			return Workflow{}, fmt.Errorf("queue onboarding: %w", err)
+		}
+		// A worker on this replica may have claimed the job already
+		if wf.JobID == "" {
+			wf.JobID = job.ID
+		}
+		return copyWorkflow(wf), nil
+	}
+	e.workflows[req.Tenant] = wf
+	snapshot := copyWorkflow(wf)
+	e.running.Add(1)
+	e.mu.Unlock()
+
+	runCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), e.opts.Timeout)
+	go func() {
+		defer e.running.Done()
+		defer cancel()
+		e.run(runCtx, wf, steps)
+	}()
+	return snapshot, nil
+}
+
+// validate checks req, refusing tenants named after a reserved namespace.
+func (e *Engine) validate(req Request) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	if slices.Contains(e.opts.ReservedNamespaces, req.Tenant) {
+		return errs.Errorf(errs.Invalid, "tenant name %q is reserved for the platform", req.Tenant)
+	}
+	return nil
+}
+
+// runJob runs one attempt of a queued workflow. A failed run is
+// compensated and returned as the job's error, so the queue retries it.
+func (e *Engine) runJob(ctx context.Context, job store.QueueJob) error {
+	var req Request
+	if err := json.Unmarshal(job.Payload, &req); err != nil {
+		return queue.Permanent(fmt.Errorf("decode request: %w", err))
+	}
+	if err := e.validate(req); err != nil {
+		return queue.Permanent(err)
+	}
+	steps := e.steps(req)
+
+	e.mu.Lock()
+	wf, ok := e.workflows[req.Tenant]
+	if !ok || wf.Status != StatusPending || wf.JobID != "" && wf.JobID != job.ID {
+		// Queued on another replica, or a retry of a failed attempt
+		wf = newWorkflow(req.Tenant, steps)
+		e.workflows[req.Tenant] = wf
+	}
+	wf.JobID, wf.Status = job.ID, StatusRunning
+	e.running.Add(1)
+	e.mu.Unlock()
+	defer e.running.Done()
+
+	runCtx, cancel := context.WithTimeout(ctx, e.opts.Timeout)
+	defer cancel()
+	return e.run(runCtx, wf, steps)
+}
+
+// inProgress reports whether wf is running, or queued and not yet
+// finished by a worker on any replica. Called with e.mu held.
+func (e *Engine) inProgress(ctx context.Context, wf *Workflow) bool {
+	if wf.Status == StatusRunning {
+		return true
+	}
+	if wf.Status != StatusPending || e.queue == nil || wf.JobID == "" {
+		return wf.Status == StatusPending
+	}
+	job, err := e.queue.Get(ctx, wf.JobID)
+	return err != nil || job.Status == store.JobQueued || job.Status == store.JobRunning
+}
+
+func newWorkflow(tenant string, steps []step) *Workflow {
+	wf := &Workflow{Tenant: tenant, Status: StatusRunning, StartedAt: time.Now().UTC()}
+	for _, s := range steps {
+		wf.Steps = append(wf.Steps, StepState{Name: s.name, Status: StatusPending})
+	}
+	return wf
+}
+
+// Get returns the latest workflow for tenant.
+func (e *Engine) Get(tenant string) (Workflow, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	wf, ok := e.workflows[tenant]
+	if !ok {
+		return Workflow{}, false
+	}
+	return copyWorkflow(wf), true
+}
+
+// Shutdown waits for running workflows to finish or ctx to expire.
+func (e *Engine) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		e.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run runs the steps, compensating them if one fails, and returns the
+// failed step's error.
+func (e *Engine) run(ctx context.Context, wf *Workflow, steps []step) error {
+	log := e.logger.With(zap.String("tenant", wf.Tenant))
+	var undos []func(context.Context) error
+	undoIdx := make([]int, 0, len(steps))
+
+	failed := -1
+	var failure error
+	for i, s := range steps {
+		e.setStep(wf, i, StatusRunning, nil)
+		undo, err := s.apply(ctx)
+		if undo != nil {
+			// Failed steps may have created part of their objects
+			undos = append(undos, undo)
+			undoIdx = append(undoIdx, i)
+		}
+		if errors.Is(err, errSkipped) {
+			e.setStep(wf, i, StatusSkipped, nil)
+			continue
+		}
+		if err != nil {
+			log.Error("onboarding step failed", zap.String("step", s.name), zap.Error(err))
+			e.setStep(wf, i, StatusFailed, err)
+			failed, failure = i, fmt.Errorf("step %s: %w", s.name, err)
+			break
+		}
+		e.setStep(wf, i, StatusSucceeded, nil)
+	}
+
+	final := StatusSucceeded
+	if failed >= 0 {
+		final = StatusFailed
+		// Compensate with a fresh deadline; the run's may be what failed
+		cctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), e.opts.Timeout)
+		defer cancel()
+		for j := len(undos) - 1; j >= 0; j-- {
+			i := undoIdx[j]
+			if err := undos[j](cctx); err != nil {
+				log.Error("onboarding compensation failed", zap.String("step", steps[i].name), zap.Error(err))
+				e.setStep(wf, i, StatusFailed, fmt.Errorf("compensation: %w", err))
+				continue
+			}
+			if i != failed {
+				e.setStep(wf, i, StatusCompensated, nil)
+			}
+		}
+	}
+
+	e.mu.Lock()
+	now := time.Now().UTC()
+	wf.Status = final
+	wf.FinishedAt = &now
+	e.mu.Unlock()
+
+	workflowsTotal.WithLabelValues(string(final)).Inc()
+	log.Info("onboarding finished", zap.String("status", string(final)))
+
+	eventType := "tenant.onboarded"
+	if failed >= 0 {
+		eventType = "tenant.onboarding_failed"
+	}
+	if ev, err := events.New(eventType, "onboarding", map[string]string{"tenant": wf.Tenant}); err == nil {
+		if err := e.bus.Publish(ctx, ev); err != nil {
+			log.Warn("failed to publish onboarding event", zap.Error(err))
+		}
+	}
+	return failure
+}
+
+func (e *Engine) setStep(wf *Workflow, i int, status Status, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	st := &wf.Steps[i]
+	st.Status = status
+	st.Error = ""
+	if err != nil {
+		st.Error = err.Error()
+	}
+	if status != StatusRunning {
+		now := time.Now().UTC()
+		st.FinishedAt = &now
+	}
+}
+
+func copyWorkflow(wf *Workflow) Workflow {
+	out := *wf
+	out.Steps = append([]StepState(nil), wf.Steps...)
+	return out
+}
@@ -0,0 +1,136 @@
+package opa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// APIError is a non-2xx response from OPA.
+type APIError struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("opa: status %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Decision is the outcome of a policy query.
+type Decision struct {
+	// ID is OPA's decision ID, set when OPA's decision logging is on.
+	ID      string
+	Allow   bool
+	Reasons []string
+}
+
+// Client calls the REST API of an OPA server, typically a sidecar.
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// NewClient creates a client for the OPA server at baseURL, e.g.
+// http://localhost:8181.
+func NewClient(baseURL string, hc *http.Client) *Client {
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), http: hc}
+}
+
+// Decide evaluates the document at path, e.g. "platform/authz", with
+// input. The document is either a boolean or an object with a boolean
+// "allow" and a list of "reasons". An undefined document, such as one
+// whose policy is not loaded, denies.
+func (c *Client) Decide(ctx context.Context, path string, input any) (Decision, error) {
+	var resp struct {
+		DecisionID string          `json:"decision_id"`
+		Result     json.RawMessage `json:"result"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/v1/data/"+strings.Trim(path, "/"), "application/json", map[string]any{"input": input}, &resp); err != nil {
+		return Decision{}, err
+	}
+	d := Decision{ID: resp.DecisionID}
+	if len(resp.Result) == 0 {
+		d.Reasons = []string{fmt.Sprintf("policy %s is undefined", path)}
+		return d, nil
+	}
+	if err := json.Unmarshal(resp.Result, &d.Allow); err == nil {
+		return d, nil
+	}
+	var doc struct {
+		Allow   bool     `json:"allow"`
+		Reasons []string `json:"reasons"`
+	}
+	if err := json.Unmarshal(resp.Result, &doc); err != nil {
+		return Decision{}, fmt.Errorf("opa: %s is neither a boolean nor an allow object", path)
+	}
+	d.Allow, d.Reasons = doc.Allow, doc.Reasons
+	return d, nil
+}
+
+// PutPolicy creates or replaces the Rego module id.
+func (c *Client) PutPolicy(ctx context.Context, id, rego string) error {
+	return c.do(ctx, http.MethodPut, "/v1/policies/"+id, "text/plain", rego, nil)
+}
+
+// DeletePolicy removes the Rego module id; a missing one is not an error.
+func (c *Client) DeletePolicy(ctx context.Context, id string) error {
+	err := c.do(ctx, http.MethodDelete, "/v1/policies/"+id, "", nil, nil)
+	if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// Check reports whether OPA is up and has activated its bundles.
+func (c *Client) Check(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/health?bundles", "", nil, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path, contentType string, body, out any) error {
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	default:
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(buf)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// OPA errors look like {"code": "invalid_parameter", "message": "..."}
+		var apiErr APIError
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(raw, &apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(raw))
+		}
+		apiErr.StatusCode = resp.StatusCode
+		return &apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,194 @@
+// Package opa evaluates authorization and admission decisions against Rego
+// policies in an Open Policy Agent sidecar. Policies reach OPA as bundles
+// OPA pulls itself, or from ConfigMaps the service pushes to OPA's policy
+// API (see WatchPolicies). Decisions are recorded in the audit store, and
+// so reach the Kafka audit topic when one is configured.
+package opa
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	admissionv1 "k8s.io/api/admission/v1"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+var decisionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "opa_decisions_total",
+	Help: "Policy decisions by kind (authz or admission) and result (allowed, denied or error).",
+}, []string{"kind", "result"})
+
+// Options configures an Engine.
+type Options struct {
+	// AuthzPath and AdmissionPath are the data paths queried for API
+	// requests and admission reviews; empty skips the check.
+	AuthzPath     string
+	AdmissionPath string
+	// PathPrefix limits authorization to request paths under it.
+	PathPrefix string
+	// FailOpen allows requests when OPA cannot be reached; by default they
+	// are refused.
+	FailOpen bool
+	// LogAllowed records allowed decisions in the audit store too; denials
+	// and errors are always recorded.
+	LogAllowed bool
+	// UserHeader and GroupsHeader carry the caller's identity, set by the
+	// authenticating proxy.
+	UserHeader   string
+	GroupsHeader string
+}
+
+// Engine asks OPA for decisions and records them.
+type Engine struct {
+	client  *Client
+	audit   store.AuditRepository
+	opts    Options
+	headers authz.Headers
+	logger  *zap.Logger
+}
+
+// New creates an engine querying client and recording decisions in audit.
+func New(client *Client, audit store.AuditRepository, opts Options, logger *zap.Logger) *Engine {
+	return &Engine{
+		client:  client,
+		audit:   audit,
+		opts:    opts,
+		headers: authz.Headers{User: opts.UserHeader, Groups: opts.GroupsHeader},
+		logger:  logger,
+	}
+}
+
+// Check reports whether OPA is ready, for the readiness probe.
+func (e *Engine) Check(ctx context.Context) error {
+	return e.client.Check(ctx)
+}
+
+// RequestInput is the input of authorization queries.
+type RequestInput struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Segments is Path split at slashes, for matching in Rego.
+	Segments  []string            `json:"segments"`
+	Query     map[string][]string `json:"query,omitempty"`
+	User      string              `json:"user,omitempty"`
+	Groups    []string            `json:"groups,omitempty"`
+	RequestID string              `json:"request_id,omitempty"`
+}
+
+// Middleware refuses requests under the path prefix that the AuthzPath
+// policy does not allow.
+func (e *Engine) Middleware(next http.Handler) http.Handler {
+	if e.opts.AuthzPath == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, e.opts.PathPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		id := e.headers.Identity(r)
+		in := RequestInput{
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Segments:  strings.Split(strings.Trim(r.URL.Path, "/"), "/"),
+			Query:     r.URL.Query(),
+			User:      id.User,
+			Groups:    id.Groups,
+			RequestID: middleware.GetRequestID(r.Context()),
+		}
+		allowed, ok := e.decide(r.Context(), "authz", e.opts.AuthzPath, in, event{
+			actor:     id.User,
+			resource:  r.Method + " " + r.URL.Path,
+			requestID: in.RequestID,
+		})
+		switch {
+		case !ok:
+			http.Error(w, "policy engine unavailable", http.StatusServiceUnavailable)
+		case !allowed:
+			http.Error(w, "forbidden", http.StatusForbidden)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// Admit evaluates an admission request against the AdmissionPath policy
+// with the input {"request": req}, as the OPA kube-mgmt convention has it.
+// It matches admission.External.
+func (e *Engine) Admit(ctx context.Context, req *admissionv1.AdmissionRequest) (allowed bool, reason string, err error) {
+	if e.opts.AdmissionPath == "" {
+		return true, "", nil
+	}
+	resource := req.Kind.Kind + " " + req.Name
+	if req.Namespace != "" {
+		resource = req.Kind.Kind + " " + req.Namespace + "/" + req.Name
+	}
+	d, err := e.client.Decide(ctx, e.opts.AdmissionPath, map[string]any{"request": req})
+	e.record(ctx, "admission", e.opts.AdmissionPath, d, err, event{
+		actor:     req.UserInfo.Username,
+		resource:  resource,
+		requestID: string(req.UID),
+	})
+	if err != nil {
+		return e.opts.FailOpen, "policy engine unavailable", err
+	}
+	return d.Allow, strings.Join(d.Reasons, "; "), nil
+}
+
+// event is what a decision is recorded about.
+type event struct {
+	actor, resource, requestID string
+}
+
+// decide queries path and records the decision. ok is false when OPA
+// failed and the engine does not fail open.
+func (e *Engine) decide(ctx context.Context, kind, path string, input any, ev event) (allowed, ok bool) {
+	d, err := e.client.Decide(ctx, path, input)
+	e.record(ctx, kind, path, d, err, ev)
+	if err != nil {
+		return e.opts.FailOpen, e.opts.FailOpen
+	}
+	return d.Allow, true
+}
+
+func (e *Engine) record(ctx context.Context, kind, path string, d Decision, err error, ev event) {
+	outcome := "allowed"
+	switch {
+	case err != nil:
+		outcome = "error"
+		e.logger.Error("policy query failed", zap.String("policy", path), zap.Error(err))
+	case !d.Allow:
+		outcome = "denied"
+	}
+	decisionsTotal.WithLabelValues(kind, outcome).Inc()
+	if outcome == "allowed" && !e.opts.LogAllowed {
+		return
+	}
+	details := map[string]string{"policy": path}
+	if d.ID != "" {
+		details["decision_id"] = d.ID
+	}
+	if len(d.Reasons) > 0 {
+		details["reasons"] = strings.Join(d.Reasons, "; ")
+	}
+	if err != nil {
+		details["error"] = err.Error()
+	}
+	if err := e.audit.Record(context.WithoutCancel(ctx), &store.AuditEvent{
+		Actor:     ev.actor,
+		Action:    "opa." + kind,
+		Resource:  ev.resource,
+		Outcome:   outcome,
+		RequestID: ev.requestID,
+		Details:   details,
+	}); err != nil {
+		e.logger.Warn("failed to record policy decision", zap.Error(err))
+	}
+}
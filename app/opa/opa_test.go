@@ -0,0 +1,148 @@
+package opa
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+// fakeOPA allows GETs, denies everything else with a reason, and keeps
+// the modules put to it.
+type fakeOPA struct {
+	mu       sync.Mutex
+	policies map[string]string
+	down     bool
+}
+
+func (f *fakeOPA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		http.Error(w, `{"code":"internal_error","message":"down"}`, http.StatusInternalServerError)
+		return
+	}
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/data/platform/authz":
+		var body struct{ Input RequestInput }
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Input.Method == http.MethodGet {
+			w.Write([]byte(`{"decision_id":"d1","result":true}`))
+			return
+		}
+		w.Write([]byte(`{"decision_id":"d2","result":{"allow":false,"reasons":["writes are frozen"]}}`))
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/data/platform/admission":
+		w.Write([]byte(`{}`))
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v1/policies/"):
+		rego, _ := io.ReadAll(r.Body)
+		f.policies[strings.TrimPrefix(r.URL.Path, "/v1/policies/")] = string(rego)
+		w.Write([]byte(`{}`))
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v1/policies/"):
+		delete(f.policies, strings.TrimPrefix(r.URL.Path, "/v1/policies/"))
+		w.Write([]byte(`{}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newEngine(t *testing.T, f *fakeOPA, st *store.Store, opts Options) *Engine {
+	t.Helper()
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	opts.AuthzPath, opts.AdmissionPath, opts.PathPrefix = "platform/authz", "platform/admission", "/api/"
+	opts.UserHeader, opts.GroupsHeader = "X-Forwarded-User", "X-Forwarded-Groups"
+	return New(NewClient(srv.URL, srv.Client()), st.Audit, opts, zap.NewNop())
+}
+
+func TestMiddleware(t *testing.T) {
+	f := &fakeOPA{}
+	st := store.NewMemory()
+	h := newEngine(t, f, st, Options{}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	do := func(method, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-Forwarded-User", "alice")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := do(http.MethodGet, "/api/v1/tenants"); code != http.StatusOK {
+		t.Errorf("expected the policy to allow reads, got %d", code)
+	}
+	if code := do(http.MethodPost, "/api/v1/tenants"); code != http.StatusForbidden {
+		t.Errorf("expected the policy to deny writes, got %d", code)
+	}
+	if code := do(http.MethodPost, "/healthz"); code != http.StatusOK {
+		t.Errorf("expected paths outside the prefix to skip the policy, got %d", code)
+	}
+	f.mu.Lock()
+	f.down = true
+	f.mu.Unlock()
+	if code := do(http.MethodGet, "/api/v1/tenants"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected an unreachable OPA to fail closed, got %d", code)
+	}
+
+	// Only the denial and the error are recorded
+	events, err := st.Audit.List(context.Background(), store.AuditFilter{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 audit events, got %d", len(events))
+	}
+	outcomes := map[string]*store.AuditEvent{}
+	for i := range events {
+		outcomes[events[i].Outcome] = &events[i]
+	}
+	denied := outcomes["denied"]
+	if denied == nil || denied.Action != "opa.authz" || denied.Actor != "alice" ||
+		denied.Details["decision_id"] != "d2" || denied.Details["reasons"] != "writes are frozen" {
+		t.Errorf("unexpected denial record: %+v", denied)
+	}
+	if outcomes["error"] == nil {
+		t.Error("expected the failed query recorded")
+	}
+}
+
+func TestAdmitAndPolicySync(t *testing.T) {
+	f := &fakeOPA{policies: map[string]string{}}
+	e := newEngine(t, f, store.NewMemory(), Options{})
+
+	// An undefined admission document denies
+	allowed, reason, err := e.Admit(context.Background(), &admissionv1.AdmissionRequest{Name: "web", Namespace: "team-a"})
+	if err != nil || allowed || !strings.Contains(reason, "undefined") {
+		t.Errorf("expected an undefined policy to deny, got %v %q %v", allowed, reason, err)
+	}
+
+	s := &policySync{client: e.client, logger: zap.NewNop(), loaded: map[string]map[string]bool{}}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "platform", Name: "authz"},
+		Data:       map[string]string{"main.rego": "package platform.authz", "tests.rego": "package t", "README": "x"},
+	}
+	s.apply(context.Background(), cm)
+	if len(f.policies) != 2 || f.policies["configmaps/platform/authz/main"] != "package platform.authz" {
+		t.Fatalf("expected the .rego keys loaded, got %v", f.policies)
+	}
+	delete(cm.Data, "tests.rego")
+	s.apply(context.Background(), cm)
+	if _, ok := f.policies["configmaps/platform/authz/tests"]; ok || len(f.policies) != 1 {
+		t.Errorf("expected the removed key unloaded, got %v", f.policies)
+	}
+	s.remove(context.Background(), "platform/authz", nil)
+	if len(f.policies) != 0 || len(s.loaded) != 0 {
+		t.Errorf("expected the deleted configmap unloaded, got %v", f.policies)
+	}
+}
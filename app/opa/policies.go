@@ -0,0 +1,126 @@
+package opa
+
+import (
+	"context"
+	"maps"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// PolicyLabel marks the ConfigMaps whose .rego keys are loaded into OPA.
+const PolicyLabel = "platform.io/opa-policy"
+
+var policyLoadsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "opa_policy_loads_total",
+	Help: "Rego modules pushed to or removed from OPA by result (loaded, removed or error).",
+}, []string{"result"})
+
+// policySync mirrors ConfigMap policies into OPA.
+type policySync struct {
+	client *Client
+	logger *zap.Logger
+
+	mu sync.Mutex
+	// loaded holds the module IDs pushed for each ConfigMap
+	loaded map[string]map[string]bool
+}
+
+// WatchPolicies pushes the .rego keys of ConfigMaps in namespace labelled
+// PolicyLabel=true to OPA as modules named after the ConfigMap and key,
+// and removes them with their key or ConfigMap. Every resync pushes them
+// again, restoring them after an OPA restart. A module OPA rejects is
+// logged and counted; the rest still load.
+func (e *Engine) WatchPolicies(ctx context.Context, cs kubernetes.Interface, namespace string, resync time.Duration) error {
+	informer := coreinformers.NewFilteredConfigMapInformer(cs, namespace, resync, cache.Indexers{},
+		func(o *metav1.ListOptions) {
+			o.LabelSelector = PolicyLabel + "=true"
+		},
+	)
+	s := &policySync{client: e.client, logger: e.logger, loaded: make(map[string]map[string]bool)}
+	apply := func(obj any) {
+		if cm, ok := obj.(*corev1.ConfigMap); ok {
+			s.apply(ctx, cm)
+		}
+	}
+	if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    apply,
+		UpdateFunc: func(_, obj any) { apply(obj) },
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if cm, ok := obj.(*corev1.ConfigMap); ok {
+				s.remove(ctx, cm.Namespace+"/"+cm.Name, nil)
+			}
+		},
+	}); err != nil {
+		return err
+	}
+
+	go informer.Run(ctx.Done())
+	e.logger.Info("watching policy configmaps",
+		zap.String("namespace", namespace),
+		zap.String("selector", PolicyLabel+"=true"),
+	)
+	return nil
+}
+
+// apply pushes cm's modules and removes those of keys it no longer has.
+func (s *policySync) apply(ctx context.Context, cm *corev1.ConfigMap) {
+	key := cm.Namespace + "/" + cm.Name
+	ids := make(map[string]bool)
+	for name, rego := range cm.Data {
+		if !strings.HasSuffix(name, ".rego") {
+			continue
+		}
+		id := path.Join("configmaps", cm.Namespace, cm.Name, strings.TrimSuffix(name, ".rego"))
+		if err := s.client.PutPolicy(ctx, id, rego); err != nil {
+			policyLoadsTotal.WithLabelValues("error").Inc()
+			s.logger.Error("failed to load policy", zap.String("configmap", key), zap.String("key", name), zap.Error(err))
+			continue
+		}
+		policyLoadsTotal.WithLabelValues("loaded").Inc()
+		ids[id] = true
+	}
+	s.remove(ctx, key, ids)
+}
+
+// remove deletes the modules loaded for the ConfigMap key that are not in
+// keep, and records keep as its modules.
+func (s *policySync) remove(ctx context.Context, key string, keep map[string]bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	remaining := maps.Clone(keep)
+	for id := range s.loaded[key] {
+		if keep[id] {
+			continue
+		}
+		if err := s.client.DeletePolicy(ctx, id); err != nil {
+			policyLoadsTotal.WithLabelValues("error").Inc()
+			s.logger.Error("failed to remove policy", zap.String("configmap", key), zap.String("id", id), zap.Error(err))
+			// Try again on the next change or resync
+			if remaining == nil {
+				remaining = make(map[string]bool)
+			}
+			remaining[id] = true
+			continue
+		}
+		policyLoadsTotal.WithLabelValues("removed").Inc()
+	}
+	if len(remaining) == 0 {
+		delete(s.loaded, key)
+		return
+	}
+	s.loaded[key] = remaining
+}
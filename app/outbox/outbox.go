@@ -0,0 +1,147 @@
+// Package outbox implements the transactional outbox: domain events are
+// written with the changes they describe in one store transaction, and a
+// relay publishes them on the event bus afterwards, so a crash between the
+// two can delay an event but never lose it.
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+var (
+	relayedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "outbox_relayed_total",
+		Help: "Outbox messages handed to the event bus by result (published or error).",
+	}, []string{"result"})
+	relayLag = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "outbox_relay_lag_seconds",
+		Help:    "Time from writing an outbox message to publishing it.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 14),
+	})
+)
+
+// Enqueue writes an event to tx's outbox. It is published once the
+// transaction commits, and never if it rolls back.
+func Enqueue(ctx context.Context, tx store.Repos, eventType, source string, data any) error {
+	e, err := events.New(eventType, source, data)
+	if err != nil {
+		return err
+	}
+	return tx.Outbox.Add(ctx, &store.OutboxMessage{
+		ID:        e.ID,
+		Type:      e.Type,
+		Source:    e.Source,
+		Data:      e.Data,
+		CreatedAt: e.Time,
+	})
+}
+
+// Options configures a Relay.
+type Options struct {
+	// Interval is how often the outbox is polled.
+	Interval time.Duration
+	// BatchSize is how many messages one transaction publishes.
+	BatchSize int
+	// Retention is how long sent messages are kept; 0 keeps them.
+	Retention time.Duration
+}
+
+// Relay publishes pending outbox messages on the bus and marks them sent
+// in the transaction that read them. Delivery is at least once: a message
+// published just before its transaction failed is published again, under
+// the same event ID.
+//
+// Subscribers run while that transaction is open, so they must not start
+// transactions of their own on the memory store, which runs them one at a
+// time.
+type Relay struct {
+	st     *store.Store
+	bus    events.Publisher
+	opts   Options
+	logger *zap.Logger
+	now    func() time.Time
+}
+
+// NewRelay creates a relay; Run starts it.
+func NewRelay(st *store.Store, bus events.Publisher, opts Options, logger *zap.Logger) *Relay {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	opts.BatchSize = max(opts.BatchSize, 1)
+	return &Relay{st: st, bus: bus, opts: opts, logger: logger, now: time.Now}
+}
+
+// Run drains the outbox immediately and then every interval until ctx is
+// done. Sent messages past the retention are pruned hourly.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+	var pruned time.Time
+	for {
+		if err := r.Drain(ctx); err != nil && ctx.Err() == nil {
+			r.logger.Warn("failed to relay outbox messages", zap.Error(err))
+		}
+		if now := r.now(); r.opts.Retention > 0 && now.Sub(pruned) >= time.Hour {
+			if _, err := r.st.Outbox.Prune(ctx, now.Add(-r.opts.Retention)); err != nil && ctx.Err() == nil {
+				r.logger.Warn("failed to prune outbox", zap.Error(err))
+			}
+			pruned = now
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Drain publishes batches until the outbox is empty or publishing fails.
+// Messages stay in order: a failure leaves the failed message and those
+// after it for the next attempt.
+func (r *Relay) Drain(ctx context.Context) error {
+	for {
+		more, err := r.relayBatch(ctx)
+		if err != nil || !more {
+			return err
+		}
+	}
+}
+
+// relayBatch publishes one batch and reports whether it was full.
+func (r *Relay) relayBatch(ctx context.Context) (more bool, err error) {
+	var publishErr error
+	err = r.st.WithTx(ctx, func(tx store.Repos) error {
+		msgs, err := tx.Outbox.Pending(ctx, r.opts.BatchSize)
+		if err != nil {
+			return err
+		}
+		sent := make([]string, 0, len(msgs))
+		for _, m := range msgs {
+			e := events.Event{ID: m.ID, Type: m.Type, Source: m.Source, Time: m.CreatedAt, Data: m.Data}
+			if publishErr = r.bus.Publish(ctx, e); publishErr != nil {
+				relayedTotal.WithLabelValues("error").Inc()
+				break
+			}
+			relayedTotal.WithLabelValues("published").Inc()
+			relayLag.Observe(r.now().Sub(m.CreatedAt).Seconds())
+			sent = append(sent, m.ID)
+		}
+		more = publishErr == nil && len(msgs) == r.opts.BatchSize
+		if len(sent) == 0 {
+			return nil
+		}
+		return tx.Outbox.MarkSent(ctx, sent, r.now().UTC())
+	})
+	if err != nil {
+		return false, err
+	}
+	return more, publishErr
+}
@@ -0,0 +1,80 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+// flakyBus fails the publishes listed in fail, counting from one.
+type flakyBus struct {
+	events.Bus
+	calls     int
+	fail      map[int]bool
+	published []events.Event
+}
+
+func (b *flakyBus) Publish(ctx context.Context, e events.Event) error {
+	b.calls++
+	if b.fail[b.calls] {
+		return errors.New("unavailable")
+	}
+	b.published = append(b.published, e)
+	return nil
+}
+
+func TestRelay(t *testing.T) {
+	ctx := t.Context()
+	st := store.NewMemory()
+	err := st.WithTx(ctx, func(tx store.Repos) error {
+		tenant := &store.Tenant{Name: "team-a"}
+		if err := tx.Tenants.Create(ctx, tenant); err != nil {
+			return err
+		}
+		for _, typ := range []string{"tenant.created", "tenant.labelled", "tenant.owned"} {
+			if err := Enqueue(ctx, tx, typ, "tenants", tenant); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	st.WithTx(ctx, func(tx store.Repos) error {
+		Enqueue(ctx, tx, "tenant.created", "tenants", map[string]string{"name": "team-b"})
+		return errors.New("rolled back")
+	})
+
+	bus := &flakyBus{fail: map[int]bool{2: true}}
+	r := NewRelay(st, bus, Options{BatchSize: 2}, zap.NewNop())
+	if err := r.Drain(ctx); err == nil {
+		t.Error("expected the failed publish to be reported")
+	}
+	if err := r.Drain(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var types []string
+	for _, e := range bus.published {
+		types = append(types, e.Type)
+	}
+	if len(types) != 3 || types[0] != "tenant.created" || types[1] != "tenant.labelled" || types[2] != "tenant.owned" {
+		t.Errorf("expected the committed events once each and in order, got %v", types)
+	}
+	if e := bus.published[0]; e.Source != "tenants" || e.ID == "" || len(e.Data) == 0 {
+		t.Errorf("unexpected event %+v", e)
+	}
+	if pending, _ := st.Outbox.Pending(ctx, 0); len(pending) != 0 {
+		t.Errorf("expected nothing pending, got %+v", pending)
+	}
+
+	if n, _ := st.Outbox.Prune(ctx, time.Now().Add(time.Minute)); n != 3 {
+		t.Errorf("expected the sent messages to be pruned, got %d", n)
+	}
+}
@@ -0,0 +1,379 @@
+// Package pdbs manages PodDisruptionBudgets for teams. Budgets are created
+// for a Deployment or StatefulSet from a vetted template and inspected with
+// their live disruption status, and a validator flags workloads without a
+// budget and budgets that would stall node drains.
+package pdbs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+	authzv1 "k8s.io/api/authorization/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	policylisters "k8s.io/client-go/listers/policy/v1"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/kube"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+)
+
+const (
+	// TemplateLabel records which template a budget was created from.
+	TemplateLabel = "platform.io/pdb-template"
+	// CreatedByAnnotation records the user who created the budget.
+	CreatedByAnnotation = "platform.io/created-by"
+)
+
+// Options configures the handler.
+type Options struct {
+	// Namespaces limits where budgets can be read and created (empty = all).
+	Namespaces []string
+	// UserHeader and GroupsHeader carry the caller's identity, set by the
+	// authenticating proxy.
+	UserHeader   string
+	GroupsHeader string
+}
+
+// Budget is a PodDisruptionBudget with its live status.
+type Budget struct {
+	Namespace      string              `json:"namespace"`
+	Name           string              `json:"name"`
+	Template       string              `json:"template,omitempty"`
+	Selector       string              `json:"selector"`
+	MinAvailable   *intstr.IntOrString `json:"min_available,omitempty"`
+	MaxUnavailable *intstr.IntOrString `json:"max_unavailable,omitempty"`
+	ExpectedPods   int32               `json:"expected_pods"`
+	CurrentHealthy int32               `json:"current_healthy"`
+	DesiredHealthy int32               `json:"desired_healthy"`
+	// DisruptionsAllowed is how many pods may be evicted right now.
+	DisruptionsAllowed int32     `json:"disruptions_allowed"`
+	Created            time.Time `json:"created"`
+	// Findings are the validator's findings involving this budget; only
+	// set when a single budget is inspected.
+	Findings []Finding `json:"findings,omitempty"`
+}
+
+// Handler serves the disruption budget API.
+type Handler struct {
+	clientset kubernetes.Interface
+	reviewer  *authz.Reviewer
+	headers   authz.Headers
+	templates map[string]*Template
+	pdbs      policylisters.PodDisruptionBudgetLister
+	validator *Validator
+	bus       events.Publisher
+	allowed   map[string]bool
+	logger    *zap.Logger
+}
+
+// New creates a budget handler over templates. It registers the informers
+// it reads on factory; the factory must be started afterwards.
+func New(cs kubernetes.Interface, factory informers.SharedInformerFactory, templates []Template, bus events.Publisher, opts Options, logger *zap.Logger) *Handler {
+	h := &Handler{
+		clientset: cs,
+		reviewer:  authz.NewReviewer(cs),
+		headers:   authz.Headers{User: opts.UserHeader, Groups: opts.GroupsHeader},
+		templates: make(map[string]*Template, len(templates)),
+		pdbs:      factory.Policy().V1().PodDisruptionBudgets().Lister(),
+		validator: NewValidator(factory, opts.Namespaces),
+		bus:       bus,
+		logger:    logger,
+	}
+	for i := range templates {
+		h.templates[templates[i].Name] = &templates[i]
+	}
+	if len(opts.Namespaces) > 0 {
+		h.allowed = make(map[string]bool, len(opts.Namespaces))
+		for _, ns := range opts.Namespaces {
+			h.allowed[ns] = true
+		}
+	}
+	return h
+}
+
+// Register mounts the budget endpoints on mux.
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/pdbs/templates", h.listTemplates)
+	h.validator.Register(mux)
+	mux.HandleFunc("GET /api/v1/namespaces/{ns}/pdbs", h.list)
+	mux.HandleFunc("POST /api/v1/namespaces/{ns}/pdbs", h.create)
+	mux.HandleFunc("GET /api/v1/namespaces/{ns}/pdbs/{name}", h.get)
+}
+
+func (h *Handler) listTemplates(w http.ResponseWriter, r *http.Request) {
+	out := make([]*Template, 0, len(h.templates))
+	for _, t := range h.templates {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	writeJSON(w, http.StatusOK, map[string]any{"items": out})
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	ns := r.PathValue("ns")
+	if h.allowed != nil && !h.allowed[ns] {
+		http.Error(w, "namespace not allowed", http.StatusForbidden)
+		return
+	}
+	items, err := h.pdbs.PodDisruptionBudgets(ns).List(labels.Everything())
+	if err != nil {
+		http.Error(w, "failed to list disruption budgets", http.StatusInternalServerError)
+		return
+	}
+	out := make([]Budget, 0, len(items))
+	for _, p := range items {
+		out = append(out, toBudget(p))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	writeJSON(w, http.StatusOK, map[string]any{"items": out})
+}
+
+// get serves one budget with the findings that involve it.
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	ns, name := r.PathValue("ns"), r.PathValue("name")
+	if h.allowed != nil && !h.allowed[ns] {
+		http.Error(w, "namespace not allowed", http.StatusForbidden)
+		return
+	}
+	p, err := h.pdbs.PodDisruptionBudgets(ns).Get(name)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	b := toBudget(p)
+	findings, err := h.validator.Findings(ns)
+	if err != nil {
+		http.Error(w, "failed to check disruption budgets", http.StatusInternalServerError)
+		return
+	}
+	for _, f := range findings {
+		if slices.Contains(f.PDBs, name) {
+			b.Findings = append(b.Findings, f)
+		}
+	}
+	writeJSON(w, http.StatusOK, b)
+}
+
+type createRequest struct {
+	Template string `json:"template"`
+	// Kind and Name identify the workload to protect: a Deployment or
+	// StatefulSet in the namespace. The budget takes the workload's name.
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// create builds a budget from a template for a workload, selecting the
+// workload's pods and owned by it so it is deleted with it. Templates that
+// would leave the workload's replicas with no allowed disruption are
+// refused.
+func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
+	ns := r.PathValue("ns")
+
+	var req createRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	tmpl, ok := h.templates[req.Template]
+	if !ok {
+		http.Error(w, "unknown template", http.StatusBadRequest)
+		return
+	}
+	if req.Kind != "Deployment" && req.Kind != "StatefulSet" {
+		http.Error(w, "kind must be Deployment or StatefulSet", http.StatusBadRequest)
+		return
+	}
+
+	id, ok := h.authorize(w, r, authzv1.ResourceAttributes{
+		Namespace: ns,
+		Verb:      "create",
+		Group:     "policy",
+		Resource:  "poddisruptionbudgets",
+		Name:      req.Name,
+	})
+	if !ok {
+		return
+	}
+
+	owner, selector, replicas, err := h.workload(r.Context(), ns, req.Kind, req.Name)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            req.Name,
+			Namespace:       ns,
+			Labels:          map[string]string{TemplateLabel: tmpl.Name},
+			Annotations:     map[string]string{CreatedByAnnotation: id.User},
+			OwnerReferences: []metav1.OwnerReference{owner},
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			Selector:       selector,
+			MinAvailable:   tmpl.MinAvailable,
+			MaxUnavailable: tmpl.MaxUnavailable,
+		},
+	}
+	if tmpl.EvictUnhealthy {
+		policy := policyv1.AlwaysAllow
+		pdb.Spec.UnhealthyPodEvictionPolicy = &policy
+	}
+	if allowed := Disruptions(pdb.Spec, replicas); allowed <= 0 {
+		http.Error(w, fmt.Sprintf("template %s allows no disruption for %d replicas and would block node drains", tmpl.Name, replicas), http.StatusUnprocessableEntity)
+		return
+	}
+
+	created, err := h.clientset.PolicyV1().PodDisruptionBudgets(ns).Create(r.Context(), pdb, metav1.CreateOptions{})
+	if err != nil {
+		h.logger.Warn("disruption budget creation failed",
+			zap.String("namespace", ns),
+			zap.String("name", req.Name),
+			zap.String("template", tmpl.Name),
+			zap.Error(err),
+		)
+		h.fail(w, err)
+		return
+	}
+	h.logger.Info("disruption budget created",
+		zap.String("namespace", ns),
+		zap.String("name", created.Name),
+		zap.String("template", tmpl.Name),
+		zap.String("user", id.User),
+	)
+	h.publish(r.Context(), created, id.User)
+	writeJSON(w, http.StatusCreated, toBudget(created))
+}
+
+// workload fetches the named Deployment or StatefulSet live and returns an
+// owner reference to it, its pod selector and its replica count.
+func (h *Handler) workload(ctx context.Context, ns, kind, name string) (metav1.OwnerReference, *metav1.LabelSelector, int32, error) {
+	if kind == "Deployment" {
+		d, err := h.clientset.AppsV1().Deployments(ns).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return metav1.OwnerReference{}, nil, 0, err
+		}
+		ref := metav1.OwnerReference{APIVersion: "apps/v1", Kind: kind, Name: d.Name, UID: d.UID}
+		return ref, d.Spec.Selector, replicas(d.Spec.Replicas), nil
+	}
+	s, err := h.clientset.AppsV1().StatefulSets(ns).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return metav1.OwnerReference{}, nil, 0, err
+	}
+	ref := metav1.OwnerReference{APIVersion: "apps/v1", Kind: kind, Name: s.Name, UID: s.UID}
+	return ref, s.Spec.Selector, replicas(s.Spec.Replicas), nil
+}
+
+// authorize checks the namespace allow-list and asks the API server whether
+// the caller may perform attrs.
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request, attrs authzv1.ResourceAttributes) (authz.Identity, bool) {
+	id := h.headers.Identity(r)
+	if id.User == "" {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return id, false
+	}
+
+	audit := h.logger.With(
+		zap.String("audit", "pdbs"),
+		zap.String("request_id", middleware.GetRequestID(r.Context())),
+		zap.String("user", id.User),
+		zap.Strings("groups", id.Groups),
+		zap.String("namespace", attrs.Namespace),
+		zap.String("verb", attrs.Verb),
+		zap.String("name", attrs.Name),
+	)
+
+	if h.allowed != nil && !h.allowed[attrs.Namespace] {
+		audit.Warn("disruption budget access denied", zap.String("reason", "namespace not allowed"))
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return id, false
+	}
+	allowed, reason, err := h.reviewer.Allowed(r.Context(), id, attrs)
+	if err != nil {
+		audit.Error("disruption budget authorization failed", zap.Error(err))
+		http.Error(w, "authorization check failed", http.StatusBadGateway)
+		return id, false
+	}
+	if !allowed {
+		audit.Warn("disruption budget access denied", zap.String("reason", reason))
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return id, false
+	}
+	audit.Info("disruption budget access granted")
+	return id, true
+}
+
+func (h *Handler) publish(ctx context.Context, pdb *policyv1.PodDisruptionBudget, user string) {
+	e, err := events.New("pdb.created", "pdbs", map[string]string{
+		"namespace": pdb.Namespace,
+		"pdb":       pdb.Name,
+		"template":  pdb.Labels[TemplateLabel],
+		"user":      user,
+	})
+	if err != nil {
+		return
+	}
+	if err := h.bus.Publish(ctx, e); err != nil {
+		h.logger.Warn("failed to publish disruption budget event", zap.Error(err))
+	}
+}
+
+func (h *Handler) fail(w http.ResponseWriter, err error) {
+	switch err = kube.Classify(err); {
+	case errors.Is(err, errs.NotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	case apierrors.IsAlreadyExists(err):
+		http.Error(w, "disruption budget already exists", http.StatusConflict)
+	case errors.Is(err, errs.Forbidden):
+		http.Error(w, "forbidden", http.StatusForbidden)
+	case errors.Is(err, errs.Invalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errs.Unavailable):
+		h.logger.Warn("kubernetes API unavailable", zap.Error(err))
+		http.Error(w, "kubernetes API unavailable", http.StatusServiceUnavailable)
+	default:
+		h.logger.Error("kubernetes request failed", zap.Error(err))
+		http.Error(w, "kubernetes request failed", http.StatusBadGateway)
+	}
+}
+
+func toBudget(p *policyv1.PodDisruptionBudget) Budget {
+	selector := ""
+	if p.Spec.Selector != nil {
+		selector = metav1.FormatLabelSelector(p.Spec.Selector)
+	}
+	return Budget{
+		Namespace:          p.Namespace,
+		Name:               p.Name,
+		Template:           p.Labels[TemplateLabel],
+		Selector:           selector,
+		MinAvailable:       p.Spec.MinAvailable,
+		MaxUnavailable:     p.Spec.MaxUnavailable,
+		ExpectedPods:       p.Status.ExpectedPods,
+		CurrentHealthy:     p.Status.CurrentHealthy,
+		DesiredHealthy:     p.Status.DesiredHealthy,
+		DisruptionsAllowed: p.Status.DisruptionsAllowed,
+		Created:            p.CreationTimestamp.UTC(),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
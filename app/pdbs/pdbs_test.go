@@ -0,0 +1,199 @@
+package pdbs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+)
+
+func deployment(name string, replicas int32) *appsv1.Deployment {
+	podLabels := map[string]string{"app": name}
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: name, UID: types.UID("uid-" + name)},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: podLabels},
+			Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: podLabels}},
+		},
+	}
+}
+
+func budget(name string, matchLabels map[string]string, minAvailable intstr.IntOrString) *policyv1.PodDisruptionBudget {
+	return &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: name},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			Selector:     &metav1.LabelSelector{MatchLabels: matchLabels},
+			MinAvailable: &minAvailable,
+		},
+	}
+}
+
+func newMux(t *testing.T, objs ...runtime.Object) (*http.ServeMux, *fake.Clientset) {
+	t.Helper()
+	// Members of team-a may do anything in team-a
+	cs := fake.NewClientset(objs...)
+	cs.PrependReactor("create", "subjectaccessreviews", func(a k8stesting.Action) (bool, runtime.Object, error) {
+		sar := a.(k8stesting.CreateAction).GetObject().(*authzv1.SubjectAccessReview)
+		for _, g := range sar.Spec.Groups {
+			if g == "team-a" && sar.Spec.ResourceAttributes.Namespace == "team-a" {
+				sar.Status.Allowed = true
+			}
+		}
+		return true, sar, nil
+	})
+
+	factory := informers.NewSharedInformerFactory(cs, 0)
+	h := New(cs, factory, DefaultTemplates(), events.NewMemoryBus(), Options{
+		UserHeader:   "X-Forwarded-User",
+		GroupsHeader: "X-Forwarded-Groups",
+	}, zap.NewNop())
+	factory.Start(t.Context().Done())
+	t.Cleanup(factory.Shutdown)
+	factory.WaitForCacheSync(t.Context().Done())
+
+	mux := http.NewServeMux()
+	h.Register(mux)
+	return mux, cs
+}
+
+func do(mux *http.ServeMux, method, path, body, groups string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-Forwarded-User", "alice")
+	req.Header.Set("X-Forwarded-Groups", groups)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestFindings(t *testing.T) {
+	mux, _ := newMux(t,
+		deployment("web", 3),
+		deployment("api", 2),
+		deployment("db", 2),
+		deployment("cron", 1),
+		budget("web", map[string]string{"app": "web"}, intstr.FromInt32(1)),
+		budget("api", map[string]string{"app": "api"}, intstr.FromString("100%")),
+		budget("db", map[string]string{"app": "db"}, intstr.FromInt32(1)),
+		budget("db-extra", map[string]string{"app": "db"}, intstr.FromInt32(1)),
+		budget("stale", map[string]string{"app": "gone"}, intstr.FromInt32(1)),
+	)
+
+	rec := do(mux, http.MethodGet, "/api/v1/pdbs/findings", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var got struct {
+		Items   []Finding      `json:"items"`
+		Summary map[string]int `json:"summary"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var kinds []string
+	for _, f := range got.Items {
+		kinds = append(kinds, f.Kind+" "+f.Workload+strings.Join(f.PDBs, ","))
+	}
+	want := []string{
+		"blocks_drain Deployment/apiapi",
+		"multiple_pdbs Deployment/dbdb,db-extra",
+		"unused_pdb stale",
+	}
+	if strings.Join(kinds, "|") != strings.Join(want, "|") {
+		t.Errorf("unexpected findings %q", kinds)
+	}
+	if got.Summary[SeverityCritical] != 2 || got.Summary[SeverityInfo] != 1 || got.Summary[SeverityWarning] != 0 {
+		t.Errorf("unexpected summary %v", got.Summary)
+	}
+
+	// An inspected budget carries its own findings
+	rec = do(mux, http.MethodGet, "/api/v1/namespaces/team-a/pdbs/api", "", "")
+	var b Budget
+	if err := json.Unmarshal(rec.Body.Bytes(), &b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(b.Findings) != 1 || b.Findings[0].Kind != FindingBlocksDrain || b.Selector != "app=api" {
+		t.Errorf("unexpected budget %+v", b)
+	}
+}
+
+func TestCreateFromTemplate(t *testing.T) {
+	mux, cs := newMux(t, deployment("web", 3), deployment("single", 1))
+
+	if rec := do(mux, http.MethodPost, "/api/v1/namespaces/team-a/pdbs", `{"template":"one-at-a-time","kind":"Deployment","name":"web"}`, "team-b"); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for another team, got %d", rec.Code)
+	}
+	if rec := do(mux, http.MethodPost, "/api/v1/namespaces/team-a/pdbs", `{"template":"quorum","kind":"Deployment","name":"single"}`, "team-a"); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for a budget blocking drains, got %d", rec.Code)
+	}
+
+	rec := do(mux, http.MethodPost, "/api/v1/namespaces/team-a/pdbs", `{"template":"one-at-a-time","kind":"Deployment","name":"web"}`, "team-a")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	pdb, err := cs.PolicyV1().PodDisruptionBudgets("team-a").Get(t.Context(), "web", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pdb.Labels[TemplateLabel] != "one-at-a-time" || pdb.Annotations[CreatedByAnnotation] != "alice" {
+		t.Errorf("unexpected metadata %v %v", pdb.Labels, pdb.Annotations)
+	}
+	if pdb.Spec.MaxUnavailable.IntValue() != 1 || pdb.Spec.Selector.MatchLabels["app"] != "web" {
+		t.Errorf("unexpected spec %+v", pdb.Spec)
+	}
+	if pdb.Spec.UnhealthyPodEvictionPolicy == nil || *pdb.Spec.UnhealthyPodEvictionPolicy != policyv1.AlwaysAllow {
+		t.Errorf("expected unhealthy pods to be evictable")
+	}
+	if len(pdb.OwnerReferences) != 1 || pdb.OwnerReferences[0].UID != "uid-web" {
+		t.Errorf("expected the budget to be owned by the deployment, got %+v", pdb.OwnerReferences)
+	}
+
+	if rec := do(mux, http.MethodPost, "/api/v1/namespaces/team-a/pdbs", `{"template":"one-at-a-time","kind":"Deployment","name":"web"}`, "team-a"); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 for an existing budget, got %d", rec.Code)
+	}
+	if rec := do(mux, http.MethodPost, "/api/v1/namespaces/team-a/pdbs", `{"template":"one-at-a-time","kind":"StatefulSet","name":"web"}`, "team-a"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing workload, got %d", rec.Code)
+	}
+}
+
+func TestLoadTemplates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "templates.json")
+	if err := os.WriteFile(path, []byte(`[
+		{"name": "quorum", "min_available": 2},
+		{"name": "half", "max_unavailable": "50%"}
+	]`), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	templates, err := LoadTemplates(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(templates) != 4 || templates[2].MinAvailable.IntValue() != 2 || templates[3].Name != "half" {
+		t.Errorf("expected quorum replaced and half added, got %+v", templates)
+	}
+
+	if err := os.WriteFile(path, []byte(`[{"name": "both", "min_available": 1, "max_unavailable": 1}]`), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := LoadTemplates(path); err == nil {
+		t.Error("expected an error for a template setting both fields")
+	}
+}
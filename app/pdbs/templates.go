@@ -0,0 +1,104 @@
+package pdbs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Template is a vetted disruption budget shape. Exactly one of
+// MinAvailable and MaxUnavailable is set, as an integer or a percentage.
+type Template struct {
+	Name           string              `json:"name"`
+	Description    string              `json:"description"`
+	MinAvailable   *intstr.IntOrString `json:"min_available,omitempty"`
+	MaxUnavailable *intstr.IntOrString `json:"max_unavailable,omitempty"`
+	// EvictUnhealthy lets pods that are not ready be evicted even when the
+	// budget is exhausted, so a crash-looping replica cannot stall a drain.
+	EvictUnhealthy bool `json:"evict_unhealthy"`
+}
+
+// DefaultTemplates are offered when no templates file is configured, and
+// extended or overridden by one that is.
+func DefaultTemplates() []Template {
+	return []Template{
+		{
+			Name:           "one-at-a-time",
+			Description:    "Disrupt at most one pod at a time; suits most stateless services.",
+			MaxUnavailable: new(intstr.FromInt32(1)),
+			EvictUnhealthy: true,
+		},
+		{
+			Name:           "quarter",
+			Description:    "Disrupt up to a quarter of the pods; for large Deployments that drain faster.",
+			MaxUnavailable: new(intstr.FromString("25%")),
+			EvictUnhealthy: true,
+		},
+		{
+			Name:         "quorum",
+			Description:  "Keep a majority available; for consensus-based StatefulSets.",
+			MinAvailable: new(intstr.FromString("51%")),
+		},
+	}
+}
+
+// LoadTemplates reads a JSON array of templates from path and merges it
+// over the defaults; a template with a default's name replaces it.
+func LoadTemplates(path string) ([]Template, error) {
+	templates := DefaultTemplates()
+	if path == "" {
+		return templates, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read pdb templates: %w", err)
+	}
+	var custom []Template
+	if err := json.Unmarshal(data, &custom); err != nil {
+		return nil, fmt.Errorf("parse pdb templates: %w", err)
+	}
+	seen := make(map[string]bool, len(custom))
+	for i := range custom {
+		t := custom[i]
+		if err := t.validate(); err != nil {
+			return nil, fmt.Errorf("template %d: %w", i, err)
+		}
+		if seen[t.Name] {
+			return nil, fmt.Errorf("template %d: duplicate name %q", i, t.Name)
+		}
+		seen[t.Name] = true
+		replaced := false
+		for j := range templates {
+			if templates[j].Name == t.Name {
+				templates[j], replaced = t, true
+			}
+		}
+		if !replaced {
+			templates = append(templates, t)
+		}
+	}
+	return templates, nil
+}
+
+func (t *Template) validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if (t.MinAvailable == nil) == (t.MaxUnavailable == nil) {
+		return fmt.Errorf("template %s must set exactly one of min_available and max_unavailable", t.Name)
+	}
+	for _, v := range []*intstr.IntOrString{t.MinAvailable, t.MaxUnavailable} {
+		if v == nil {
+			continue
+		}
+		if _, err := intstr.GetScaledValueFromIntOrPercent(v, 100, true); err != nil {
+			return fmt.Errorf("template %s: %w", t.Name, err)
+		}
+		if v.Type == intstr.Int && v.IntVal < 0 {
+			return fmt.Errorf("template %s: values must not be negative", t.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package pdbs
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/informers"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	policylisters "k8s.io/client-go/listers/policy/v1"
+)
+
+// Finding kinds reported by the validator.
+const (
+	// FindingMissing is a workload with several replicas and no budget, so
+	// a drain may take all of them down at once.
+	FindingMissing = "missing_pdb"
+	// FindingBlocksDrain is a budget that allows no disruption even with
+	// every replica healthy, so node drains wait on it forever.
+	FindingBlocksDrain = "blocks_drain"
+	// FindingMultiple is a workload covered by more than one budget; the
+	// eviction API refuses to evict its pods.
+	FindingMultiple = "multiple_pdbs"
+	// FindingUnused is a budget that selects no Deployment or StatefulSet.
+	FindingUnused = "unused_pdb"
+)
+
+// Finding severities, most severe first.
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+var severityOrder = []string{SeverityCritical, SeverityWarning, SeverityInfo}
+
+// Finding is one problem with a workload's disruption budget.
+type Finding struct {
+	Kind      string `json:"kind"`
+	Severity  string `json:"severity"`
+	Namespace string `json:"namespace"`
+	// Workload is "Kind/name"; empty for unused budgets.
+	Workload string `json:"workload,omitempty"`
+	// PDBs are the budgets involved, if any.
+	PDBs    []string `json:"pdbs,omitempty"`
+	Message string   `json:"message"`
+}
+
+// Validator checks Deployments and StatefulSets against the disruption
+// budgets that select their pods, from shared informer caches.
+type Validator struct {
+	deployments  appslisters.DeploymentLister
+	statefulSets appslisters.StatefulSetLister
+	pdbs         policylisters.PodDisruptionBudgetLister
+	allowed      map[string]bool
+}
+
+// NewValidator registers the workload and PodDisruptionBudget informers on
+// factory; the factory must be started afterwards. An empty namespaces list
+// allows all namespaces.
+func NewValidator(factory informers.SharedInformerFactory, namespaces []string) *Validator {
+	v := &Validator{
+		deployments:  factory.Apps().V1().Deployments().Lister(),
+		statefulSets: factory.Apps().V1().StatefulSets().Lister(),
+		pdbs:         factory.Policy().V1().PodDisruptionBudgets().Lister(),
+	}
+	if len(namespaces) > 0 {
+		v.allowed = make(map[string]bool, len(namespaces))
+		for _, ns := range namespaces {
+			v.allowed[ns] = true
+		}
+	}
+	return v
+}
+
+// workload is the part of a Deployment or StatefulSet the checks need.
+type workload struct {
+	kind, namespace, name string
+	replicas              int32
+	podLabels             labels.Set
+}
+
+func (w workload) String() string { return w.kind + "/" + w.name }
+
+// Findings checks the allowed namespaces (or only namespace, if set) and
+// returns the findings sorted by severity, namespace and workload.
+func (v *Validator) Findings(namespace string) ([]Finding, error) {
+	matches := func(ns string) bool {
+		return (namespace == "" || ns == namespace) && (v.allowed == nil || v.allowed[ns])
+	}
+
+	var workloads []workload
+	deployments, err := v.deployments.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range deployments {
+		if matches(d.Namespace) {
+			workloads = append(workloads, workload{"Deployment", d.Namespace, d.Name, replicas(d.Spec.Replicas), d.Spec.Template.Labels})
+		}
+	}
+	statefulSets, err := v.statefulSets.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range statefulSets {
+		if matches(s.Namespace) {
+			workloads = append(workloads, workload{"StatefulSet", s.Namespace, s.Name, replicas(s.Spec.Replicas), s.Spec.Template.Labels})
+		}
+	}
+	all, err := v.pdbs.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	var budgets []*policyv1.PodDisruptionBudget
+	for _, p := range all {
+		if matches(p.Namespace) {
+			budgets = append(budgets, p)
+		}
+	}
+
+	findings := []Finding{}
+	used := make(map[*policyv1.PodDisruptionBudget]bool)
+	for _, w := range workloads {
+		var covering []*policyv1.PodDisruptionBudget
+		for _, p := range budgets {
+			if p.Namespace == w.namespace && selects(p, w.podLabels) {
+				covering = append(covering, p)
+				used[p] = true
+			}
+		}
+		findings = append(findings, check(w, covering)...)
+	}
+	for _, p := range budgets {
+		if !used[p] {
+			findings = append(findings, Finding{
+				Kind:      FindingUnused,
+				Severity:  SeverityInfo,
+				Namespace: p.Namespace,
+				PDBs:      []string{p.Name},
+				Message:   "selects no Deployment or StatefulSet",
+			})
+		}
+	}
+
+	slices.SortFunc(findings, func(a, b Finding) int {
+		if c := slices.Index(severityOrder, a.Severity) - slices.Index(severityOrder, b.Severity); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Namespace, b.Namespace); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Workload+strings.Join(a.PDBs, ","), b.Workload+strings.Join(b.PDBs, ","))
+	})
+	return findings, nil
+}
+
+func check(w workload, covering []*policyv1.PodDisruptionBudget) []Finding {
+	names := make([]string, len(covering))
+	for i, p := range covering {
+		names[i] = p.Name
+	}
+	slices.Sort(names)
+	switch {
+	case len(covering) == 0 && w.replicas > 1:
+		return []Finding{{
+			Kind:      FindingMissing,
+			Severity:  SeverityWarning,
+			Namespace: w.namespace,
+			Workload:  w.String(),
+			Message:   fmt.Sprintf("%d replicas without a PodDisruptionBudget", w.replicas),
+		}}
+	case len(covering) > 1:
+		return []Finding{{
+			Kind:      FindingMultiple,
+			Severity:  SeverityCritical,
+			Namespace: w.namespace,
+			Workload:  w.String(),
+			PDBs:      names,
+			Message:   "pods are selected by several PodDisruptionBudgets and cannot be evicted",
+		}}
+	case len(covering) == 1 && w.replicas > 0:
+		if allowed := Disruptions(covering[0].Spec, w.replicas); allowed <= 0 {
+			return []Finding{{
+				Kind:      FindingBlocksDrain,
+				Severity:  SeverityCritical,
+				Namespace: w.namespace,
+				Workload:  w.String(),
+				PDBs:      names,
+				Message:   fmt.Sprintf("allows no disruption with all %d replicas healthy; node drains will stall", w.replicas),
+			}}
+		}
+	}
+	return nil
+}
+
+// Disruptions is how many of replicas healthy pods spec lets be disrupted
+// at once. Percentages round up, as in the disruption controller.
+func Disruptions(spec policyv1.PodDisruptionBudgetSpec, replicas int32) int32 {
+	total := int(replicas)
+	switch {
+	case spec.MaxUnavailable != nil:
+		n, err := intstr.GetScaledValueFromIntOrPercent(spec.MaxUnavailable, total, true)
+		if err != nil {
+			return 0
+		}
+		return int32(min(n, total))
+	case spec.MinAvailable != nil:
+		n, err := intstr.GetScaledValueFromIntOrPercent(spec.MinAvailable, total, true)
+		if err != nil {
+			return 0
+		}
+		return int32(max(total-n, 0))
+	}
+	// Neither set: the budget protects nothing
+	return replicas
+}
+
+// selects reports whether p's selector matches podLabels. In policy/v1 an
+// empty selector selects every pod in the namespace and a nil one none.
+func selects(p *policyv1.PodDisruptionBudget, podLabels labels.Set) bool {
+	if p.Spec.Selector == nil {
+		return false
+	}
+	sel, err := metav1.LabelSelectorAsSelector(p.Spec.Selector)
+	if err != nil {
+		return false
+	}
+	return sel.Matches(podLabels)
+}
+
+func replicas(r *int32) int32 {
+	if r == nil {
+		return 1
+	}
+	return *r
+}
+
+// Summary counts findings by severity.
+func Summary(findings []Finding) map[string]int {
+	out := make(map[string]int, len(severityOrder))
+	for _, s := range severityOrder {
+		out[s] = 0
+	}
+	for _, f := range findings {
+		out[f.Severity]++
+	}
+	return out
+}
+
+// Register mounts GET /api/v1/pdbs/findings on mux.
+func (v *Validator) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/pdbs/findings", v.serveFindings)
+}
+
+// serveFindings reports the findings, optionally for ?namespace= only, and
+// their count per severity.
+func (v *Validator) serveFindings(w http.ResponseWriter, r *http.Request) {
+	ns := r.URL.Query().Get("namespace")
+	if ns != "" && v.allowed != nil && !v.allowed[ns] {
+		http.Error(w, "namespace not allowed", http.StatusForbidden)
+		return
+	}
+	findings, err := v.Findings(ns)
+	if err != nil {
+		http.Error(w, "failed to check disruption budgets", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": findings, "summary": Summary(findings)})
+}
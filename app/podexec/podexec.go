@@ -0,0 +1,273 @@
+// Package podexec proxies pods/exec over a WebSocket so the portal can offer
+// a browser terminal into containers. Only allowlisted commands may be
+// started; every session is authorised with a SubjectAccessReview for the
+// caller's identity and written to the audit log from start to end.
+package podexec
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	authzv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+)
+
+var sessionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "pod_exec_sessions_total",
+	Help: "Pod exec session requests by result.",
+}, []string{"result"})
+
+// ExecutorFunc opens the exec stream for a container.
+type ExecutorFunc func(namespace, pod string, opts *corev1.PodExecOptions) (remotecommand.Executor, error)
+
+// SPDYExecutor execs through the API server, upgrading the connection with
+// client-go's SPDY executor.
+func SPDYExecutor(cs kubernetes.Interface, cfg *rest.Config) ExecutorFunc {
+	return func(namespace, pod string, opts *corev1.PodExecOptions) (remotecommand.Executor, error) {
+		req := cs.CoreV1().RESTClient().Post().
+			Namespace(namespace).
+			Resource("pods").
+			Name(pod).
+			SubResource("exec").
+			VersionedParams(opts, scheme.ParameterCodec)
+		return remotecommand.NewSPDYExecutor(cfg, http.MethodPost, req.URL())
+	}
+}
+
+// Options configures the handler.
+type Options struct {
+	// Namespaces limits which namespaces can be exec'd into (empty = all).
+	Namespaces []string
+	// UserHeader and GroupsHeader carry the caller's identity, set by the
+	// authenticating proxy (e.g. oauth2-proxy). Groups are comma-separated.
+	UserHeader   string
+	GroupsHeader string
+	// Commands are the programs a session may start, matched exactly
+	// against the first argument (e.g. "/bin/sh"). With none, every
+	// session is refused.
+	Commands []string
+	// MaxDuration ends sessions that run longer (0 = no limit).
+	MaxDuration time.Duration
+	// RecordingDir, when set, receives an asciinema v2 cast of every
+	// session's terminal output.
+	RecordingDir string
+}
+
+// Handler serves GET /api/v1/namespaces/{ns}/pods/{pod}/exec.
+type Handler struct {
+	reviewer *authz.Reviewer
+	headers  authz.Headers
+	executor ExecutorFunc
+	opts     Options
+	allowed  map[string]bool
+	upgrader websocket.Upgrader
+	logger   *zap.Logger
+
+	// Sessions run on hijacked connections the HTTP server no longer
+	// tracks, so the handler cancels them itself on shutdown.
+	ctx  context.Context
+	stop context.CancelFunc
+	wg   sync.WaitGroup
+}
+
+// New creates an exec handler. The SubjectAccessReviews go through cs and
+// the streams through executor.
+func New(cs kubernetes.Interface, executor ExecutorFunc, opts Options, logger *zap.Logger) *Handler {
+	h := &Handler{
+		reviewer: authz.NewReviewer(cs),
+		headers:  authz.Headers{User: opts.UserHeader, Groups: opts.GroupsHeader},
+		executor: executor,
+		opts:     opts,
+		// The default origin check only accepts same-host pages, which keeps
+		// other sites from opening sessions with the user's cookies.
+		upgrader: websocket.Upgrader{ReadBufferSize: 4096, WriteBufferSize: 32 * 1024},
+		logger:   logger,
+	}
+	h.ctx, h.stop = context.WithCancel(context.Background())
+	if len(opts.Namespaces) > 0 {
+		h.allowed = make(map[string]bool, len(opts.Namespaces))
+		for _, ns := range opts.Namespaces {
+			h.allowed[ns] = true
+		}
+	}
+	return h
+}
+
+// Register mounts the handler on mux.
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.Handle("GET /api/v1/namespaces/{ns}/pods/{pod}/exec", h)
+}
+
+// ServeHTTP authorises the session, then upgrades to a WebSocket and
+// proxies a TTY exec of ?command= (repeated for each argument, defaulting
+// to the first allowed command) in ?container=. Binary messages carry
+// terminal input and output; text messages are JSON control messages, see
+// Message.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ns, pod := r.PathValue("ns"), r.PathValue("pod")
+
+	id := h.headers.Identity(r)
+	if id.User == "" {
+		sessionsTotal.WithLabelValues("unauthenticated").Inc()
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+	if !websocket.IsWebSocketUpgrade(r) {
+		sessionsTotal.WithLabelValues("bad_request").Inc()
+		http.Error(w, "websocket upgrade required", http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+	command := q["command"]
+	if len(command) == 0 && len(h.opts.Commands) > 0 {
+		command = h.opts.Commands[:1]
+	}
+	opts := &corev1.PodExecOptions{
+		Container: q.Get("container"),
+		Command:   command,
+		Stdin:     true,
+		Stdout:    true,
+		TTY:       true,
+	}
+
+	audit := h.logger.With(
+		zap.String("audit", "pod_exec"),
+		zap.String("request_id", middleware.GetRequestID(r.Context())),
+		zap.String("user", id.User),
+		zap.Strings("groups", id.Groups),
+		zap.String("namespace", ns),
+		zap.String("pod", pod),
+		zap.String("container", opts.Container),
+		zap.Strings("command", command),
+	)
+
+	if len(command) == 0 || !slices.Contains(h.opts.Commands, command[0]) {
+		sessionsTotal.WithLabelValues("forbidden").Inc()
+		audit.Warn("pod exec denied", zap.String("reason", "command not allowed"))
+		http.Error(w, "command not allowed", http.StatusForbidden)
+		return
+	}
+	if h.allowed != nil && !h.allowed[ns] {
+		sessionsTotal.WithLabelValues("forbidden").Inc()
+		audit.Warn("pod exec denied", zap.String("reason", "namespace not allowed"))
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	// Ask the API server whether the caller may exec into the pod
+	allowed, reason, err := h.reviewer.Allowed(r.Context(), id, authzv1.ResourceAttributes{
+		Namespace:   ns,
+		Verb:        "create",
+		Resource:    "pods",
+		Subresource: "exec",
+		Name:        pod,
+	})
+	if err != nil {
+		sessionsTotal.WithLabelValues("error").Inc()
+		audit.Error("pod exec authorization failed", zap.Error(err))
+		http.Error(w, "authorization check failed", http.StatusBadGateway)
+		return
+	}
+	if !allowed {
+		sessionsTotal.WithLabelValues("forbidden").Inc()
+		audit.Warn("pod exec denied", zap.String("reason", reason))
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	stream, err := h.executor(ns, pod, opts)
+	if err != nil {
+		sessionsTotal.WithLabelValues("error").Inc()
+		audit.Error("failed to create pod exec stream", zap.Error(err))
+		http.Error(w, "failed to create exec stream", http.StatusBadGateway)
+		return
+	}
+
+	h.wg.Add(1)
+	defer h.wg.Done()
+
+	var rec *recorder
+	if h.opts.RecordingDir != "" {
+		if rec, err = newRecorder(h.opts.RecordingDir, id.User, ns, pod, command); err != nil {
+			// With recording configured, sessions never run unrecorded
+			sessionsTotal.WithLabelValues("error").Inc()
+			audit.Error("failed to start session recording", zap.Error(err))
+			http.Error(w, "failed to start session recording", http.StatusInternalServerError)
+			return
+		}
+		audit = audit.With(zap.String("recording", rec.Path()))
+		defer func() {
+			if err := rec.Close(); err != nil {
+				audit.Error("session recording incomplete", zap.Error(err))
+			}
+		}()
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied to the client
+		sessionsTotal.WithLabelValues("bad_request").Inc()
+		audit.Warn("pod exec upgrade failed", zap.Error(err))
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(h.ctx)
+	defer cancel()
+	if h.opts.MaxDuration > 0 {
+		var stop context.CancelFunc
+		ctx, stop = context.WithTimeout(ctx, h.opts.MaxDuration)
+		defer stop()
+	}
+
+	sessionsTotal.WithLabelValues("ok").Inc()
+	audit.Info("pod exec session started")
+
+	start := time.Now()
+	s := newSession(conn, rec)
+	err = s.run(ctx, cancel, stream)
+	code, msg := exitStatus(err)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		msg = "session exceeded maximum duration"
+	}
+	s.finish(code, msg)
+
+	audit.Info("pod exec session ended",
+		zap.Int("exit_code", code),
+		zap.String("error", msg),
+		zap.Int64("bytes_in", s.bytesIn.Load()),
+		zap.Int64("bytes_out", s.bytesOut.Load()),
+		zap.Duration("duration", time.Since(start)),
+	)
+}
+
+// Shutdown ends open sessions and waits for them to close or ctx to expire.
+func (h *Handler) Shutdown(ctx context.Context) error {
+	h.stop()
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,175 @@
+package podexec
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	authzv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/util/exec"
+)
+
+// fakeShell echoes input lines and exits with status 3 on "exit", after
+// reporting the first terminal size it was given.
+type fakeShell struct {
+	opts *corev1.PodExecOptions
+}
+
+func (f *fakeShell) Stream(opts remotecommand.StreamOptions) error {
+	return f.StreamWithContext(context.Background(), opts)
+}
+
+func (f *fakeShell) StreamWithContext(ctx context.Context, opts remotecommand.StreamOptions) error {
+	size := opts.TerminalSizeQueue.Next()
+	if size == nil {
+		return ctx.Err()
+	}
+	opts.Stdout.Write([]byte("size " + strings.Repeat("#", int(size.Width)) + "\n"))
+	lines := bufio.NewScanner(opts.Stdin)
+	for lines.Scan() {
+		if lines.Text() == "exit" {
+			return exec.CodeExitError{Err: context.Canceled, Code: 3}
+		}
+		opts.Stdout.Write([]byte("echo " + lines.Text() + "\n"))
+	}
+	return ctx.Err()
+}
+
+func newTestServer(t *testing.T, recordings string) (*httptest.Server, *Handler, *fakeShell) {
+	t.Helper()
+	cs := fake.NewClientset()
+	cs.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authzv1.SubjectAccessReview)
+		attrs := review.Spec.ResourceAttributes
+		review.Status.Allowed = review.Spec.User == "alice" && attrs.Verb == "create" && attrs.Subresource == "exec"
+		return true, review, nil
+	})
+
+	shell := &fakeShell{}
+	h := New(cs, func(namespace, pod string, opts *corev1.PodExecOptions) (remotecommand.Executor, error) {
+		shell.opts = opts
+		return shell, nil
+	}, Options{
+		Namespaces:   []string{"team-a"},
+		UserHeader:   "X-Forwarded-User",
+		GroupsHeader: "X-Forwarded-Groups",
+		Commands:     []string{"/bin/sh", "/bin/bash"},
+		RecordingDir: recordings,
+	}, zap.NewNop())
+	mux := http.NewServeMux()
+	h.Register(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(func() {
+		h.Shutdown(context.Background())
+		srv.Close()
+	})
+	return srv, h, shell
+}
+
+func TestSessionProxiesTerminalAndRecords(t *testing.T) {
+	dir := t.TempDir()
+	srv, h, shell := newTestServer(t, dir)
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/v1/namespaces/team-a/pods/api-0/exec?container=app&command=/bin/bash&command=-l"
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"X-Forwarded-User": {"alice"}})
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	conn.WriteJSON(Message{Type: "resize", Cols: 4, Rows: 2})
+	conn.WriteMessage(websocket.BinaryMessage, []byte("ls\nexit\n"))
+
+	var out strings.Builder
+	var exit Message
+	for {
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read failed after %q: %v", out.String(), err)
+		}
+		if kind == websocket.TextMessage {
+			if err := json.Unmarshal(data, &exit); err != nil {
+				t.Fatalf("bad control message %s", data)
+			}
+			break
+		}
+		out.Write(data)
+	}
+	if out.String() != "size ####\necho ls\n" {
+		t.Errorf("unexpected terminal output %q", out.String())
+	}
+	if exit.Type != "exit" || exit.Code == nil || *exit.Code != 3 || exit.Error != "" {
+		t.Errorf("expected exit code 3, got %+v", exit)
+	}
+	if shell.opts.Container != "app" || strings.Join(shell.opts.Command, " ") != "/bin/bash -l" || !shell.opts.TTY {
+		t.Errorf("unexpected exec options %+v", shell.opts)
+	}
+
+	// The recording is complete once the session has ended
+	h.Shutdown(t.Context())
+	casts, _ := filepath.Glob(filepath.Join(dir, "team-a_api-0_*.cast"))
+	if len(casts) != 1 {
+		t.Fatalf("expected one recording, got %v", casts)
+	}
+	cast, _ := os.ReadFile(casts[0])
+	lines := strings.Split(strings.TrimSpace(string(cast)), "\n")
+	if !strings.Contains(lines[0], `"version":2`) || !strings.Contains(lines[0], `"title":"alice@team-a/api-0"`) {
+		t.Errorf("unexpected cast header %s", lines[0])
+	}
+	if !strings.Contains(string(cast), `"r","4x2"`) || !strings.Contains(string(cast), `"i","ls\nexit\n"`) || !strings.Contains(string(cast), `"o","echo ls\n"`) {
+		t.Errorf("expected resize, input and output events, got %s", cast)
+	}
+}
+
+func TestRejectsUnauthorisedSessions(t *testing.T) {
+	srv, _, _ := newTestServer(t, "")
+
+	tests := []struct {
+		name    string
+		path    string
+		user    string
+		upgrade bool
+		want    int
+	}{
+		{"no identity", "/api/v1/namespaces/team-a/pods/api-0/exec", "", true, http.StatusUnauthorized},
+		{"not a websocket", "/api/v1/namespaces/team-a/pods/api-0/exec", "alice", false, http.StatusBadRequest},
+		{"command not allowed", "/api/v1/namespaces/team-a/pods/api-0/exec?command=rm", "alice", true, http.StatusForbidden},
+		{"namespace not allowed", "/api/v1/namespaces/kube-system/pods/etcd-0/exec", "alice", true, http.StatusForbidden},
+		{"rbac denied", "/api/v1/namespaces/team-a/pods/api-0/exec", "mallory", true, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+tt.path, nil)
+			if tt.user != "" {
+				req.Header.Set("X-Forwarded-User", tt.user)
+			}
+			if tt.upgrade {
+				req.Header.Set("Connection", "Upgrade")
+				req.Header.Set("Upgrade", "websocket")
+			}
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, resp.StatusCode)
+			}
+		})
+	}
+}
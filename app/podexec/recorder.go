@@ -0,0 +1,82 @@
+package podexec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recorder writes a session as an asciinema v2 cast: a JSON header line
+// followed by one [seconds, kind, data] line per event. A nil recorder
+// records nothing.
+type recorder struct {
+	mu    sync.Mutex
+	f     *os.File
+	enc   *json.Encoder
+	start time.Time
+	err   error
+}
+
+// newRecorder creates the cast file for a session in dir. File names start
+// with the namespace, pod and start time so recordings sort per pod.
+func newRecorder(dir, user, namespace, pod string, command []string) (*recorder, error) {
+	start := time.Now()
+	f, err := os.CreateTemp(dir, fmt.Sprintf("%s_%s_%s_*.cast", namespace, pod, start.UTC().Format("20060102T150405Z")))
+	if err != nil {
+		return nil, err
+	}
+	r := &recorder{f: f, enc: json.NewEncoder(f), start: start}
+	header := map[string]any{
+		"version":   2,
+		"width":     80,
+		"height":    24,
+		"timestamp": start.Unix(),
+		"command":   strings.Join(command, " "),
+		"title":     fmt.Sprintf("%s@%s/%s", user, namespace, pod),
+	}
+	if err := r.enc.Encode(header); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return r, nil
+}
+
+// Path returns the cast file's path.
+func (r *recorder) Path() string {
+	return r.f.Name()
+}
+
+func (r *recorder) output(p []byte) { r.event("o", string(p)) }
+
+func (r *recorder) input(p []byte) { r.event("i", string(p)) }
+
+func (r *recorder) resize(cols, rows uint16) { r.event("r", fmt.Sprintf("%dx%d", cols, rows)) }
+
+// event appends one event. After the first write error the recording stops
+// and Close reports the error.
+func (r *recorder) event(kind, data string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	r.err = r.enc.Encode([]any{time.Since(r.start).Seconds(), kind, data})
+}
+
+// Close flushes the cast file to disk.
+func (r *recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return errors.Join(r.err, r.f.Sync(), r.f.Close())
+}
@@ -0,0 +1,184 @@
+package podexec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/util/exec"
+)
+
+const (
+	// writeTimeout bounds a single write to the browser.
+	writeTimeout = 10 * time.Second
+	// pingInterval keeps idle sessions alive through proxies that close
+	// quiet connections.
+	pingInterval = 30 * time.Second
+)
+
+// Message is a JSON control message, sent as a WebSocket text message.
+// Clients send "resize" with the terminal size; the server sends "exit" as
+// its last message, with the command's exit code (-1 if it did not exit on
+// its own) and the reason the session ended, if not a normal exit.
+type Message struct {
+	Type  string `json:"type"`
+	Cols  uint16 `json:"cols,omitempty"`
+	Rows  uint16 `json:"rows,omitempty"`
+	Code  *int   `json:"code,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// session bridges one WebSocket to one exec stream.
+type session struct {
+	conn   *websocket.Conn
+	rec    *recorder
+	sizes  chan remotecommand.TerminalSize
+	stdin  *io.PipeReader
+	input  *io.PipeWriter
+	writes sync.Mutex
+
+	bytesIn, bytesOut atomic.Int64
+}
+
+func newSession(conn *websocket.Conn, rec *recorder) *session {
+	stdin, input := io.Pipe()
+	return &session{
+		conn:  conn,
+		rec:   rec,
+		sizes: make(chan remotecommand.TerminalSize, 1),
+		stdin: stdin,
+		input: input,
+	}
+}
+
+// run streams until the command exits, the client goes away (cancel is
+// called) or ctx ends.
+func (s *session) run(ctx context.Context, cancel context.CancelFunc, executor remotecommand.Executor) error {
+	go s.read(cancel)
+	go s.ping(ctx)
+	defer s.stdin.Close()
+	return executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:             s.stdin,
+		Stdout:            s,
+		Tty:               true,
+		TerminalSizeQueue: sizeQueue{ctx: ctx, sizes: s.sizes},
+	})
+}
+
+// read forwards terminal input and resizes from the client. It returns,
+// ending the session, when the connection fails or is closed.
+func (s *session) read(cancel context.CancelFunc) {
+	defer cancel()
+	defer s.input.Close()
+	for {
+		kind, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		switch kind {
+		case websocket.BinaryMessage:
+			s.rec.input(data)
+			n, err := s.input.Write(data)
+			s.bytesIn.Add(int64(n))
+			if err != nil {
+				return
+			}
+		case websocket.TextMessage:
+			var msg Message
+			if json.Unmarshal(data, &msg) != nil || msg.Type != "resize" || msg.Cols == 0 || msg.Rows == 0 {
+				continue
+			}
+			s.rec.resize(msg.Cols, msg.Rows)
+			s.resize(remotecommand.TerminalSize{Width: msg.Cols, Height: msg.Rows})
+		}
+	}
+}
+
+// resize queues size, replacing one the executor has not picked up yet.
+func (s *session) resize(size remotecommand.TerminalSize) {
+	select {
+	case s.sizes <- size:
+	default:
+		select {
+		case <-s.sizes:
+		default:
+		}
+		s.sizes <- size
+	}
+}
+
+func (s *session) ping(ctx context.Context) {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)) != nil {
+				return
+			}
+		}
+	}
+}
+
+// Write sends terminal output to the client.
+func (s *session) Write(p []byte) (int, error) {
+	s.writes.Lock()
+	defer s.writes.Unlock()
+	s.rec.output(p)
+	_ = s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := s.conn.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	s.bytesOut.Add(int64(len(p)))
+	return len(p), nil
+}
+
+// finish sends the exit message and closes the WebSocket cleanly. Errors
+// are ignored: the client may already be gone.
+func (s *session) finish(code int, reason string) {
+	s.writes.Lock()
+	defer s.writes.Unlock()
+	deadline := time.Now().Add(writeTimeout)
+	_ = s.conn.SetWriteDeadline(deadline)
+	_ = s.conn.WriteJSON(Message{Type: "exit", Code: &code, Error: reason})
+	_ = s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), deadline)
+}
+
+// exitStatus maps the stream's result to an exit code and, unless the
+// command exited on its own, the reason the session ended.
+func exitStatus(err error) (int, string) {
+	var exitErr exec.ExitError
+	switch {
+	case err == nil:
+		return 0, ""
+	case errors.As(err, &exitErr):
+		return exitErr.ExitStatus(), ""
+	case errors.Is(err, context.Canceled):
+		return -1, "session closed"
+	default:
+		return -1, err.Error()
+	}
+}
+
+// sizeQueue hands terminal resizes to the executor.
+type sizeQueue struct {
+	ctx   context.Context
+	sizes <-chan remotecommand.TerminalSize
+}
+
+func (q sizeQueue) Next() *remotecommand.TerminalSize {
+	select {
+	case size := <-q.sizes:
+		return &size
+	case <-q.ctx.Done():
+		return nil
+	}
+}
@@ -0,0 +1,235 @@
+// Package podlogs streams container logs through the service so portal users
+// can read logs without kubectl access. Every request is authorised with a
+// SubjectAccessReview for the caller's identity and written to the audit log.
+package podlogs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	authzv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/kube"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+)
+
+var streamsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "pod_log_streams_total",
+	Help: "Pod log stream requests by result.",
+}, []string{"result"})
+
+// Options configures the handler.
+type Options struct {
+	// Namespaces limits which namespaces can be read (empty = all).
+	Namespaces []string
+	// UserHeader and GroupsHeader carry the caller's identity, set by the
+	// authenticating proxy (e.g. oauth2-proxy). Groups are comma-separated.
+	UserHeader   string
+	GroupsHeader string
+	// MaxTailLines caps the lines returned, with or without ?tailLines=
+	// (0 = no cap).
+	MaxTailLines int64
+}
+
+// Handler serves GET /api/v1/namespaces/{ns}/pods/{pod}/logs.
+type Handler struct {
+	clientset kubernetes.Interface
+	reviewer  *authz.Reviewer
+	headers   authz.Headers
+	opts      Options
+	allowed   map[string]bool
+	logger    *zap.Logger
+}
+
+// New creates a log streaming handler.
+func New(cs kubernetes.Interface, opts Options, logger *zap.Logger) *Handler {
+	h := &Handler{
+		clientset: cs,
+		reviewer:  authz.NewReviewer(cs),
+		headers:   authz.Headers{User: opts.UserHeader, Groups: opts.GroupsHeader},
+		opts:      opts,
+		logger:    logger,
+	}
+	if len(opts.Namespaces) > 0 {
+		h.allowed = make(map[string]bool, len(opts.Namespaces))
+		for _, ns := range opts.Namespaces {
+			h.allowed[ns] = true
+		}
+	}
+	return h
+}
+
+// Register mounts the handler on mux.
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.Handle("GET /api/v1/namespaces/{ns}/pods/{pod}/logs", h)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ns, pod := r.PathValue("ns"), r.PathValue("pod")
+
+	id := h.headers.Identity(r)
+	if id.User == "" {
+		streamsTotal.WithLabelValues("unauthenticated").Inc()
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	opts, err := h.logOptions(r)
+	if err != nil {
+		streamsTotal.WithLabelValues("bad_request").Inc()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	audit := h.logger.With(
+		zap.String("audit", "pod_logs"),
+		zap.String("request_id", middleware.GetRequestID(r.Context())),
+		zap.String("user", id.User),
+		zap.Strings("groups", id.Groups),
+		zap.String("namespace", ns),
+		zap.String("pod", pod),
+		zap.String("container", opts.Container),
+		zap.Bool("follow", opts.Follow),
+	)
+
+	if h.allowed != nil && !h.allowed[ns] {
+		streamsTotal.WithLabelValues("forbidden").Inc()
+		audit.Warn("pod log access denied", zap.String("reason", "namespace not allowed"))
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	// Ask the API server whether the caller may read pods/log
+	allowed, reason, err := h.reviewer.Allowed(r.Context(), id, authzv1.ResourceAttributes{
+		Namespace:   ns,
+		Verb:        "get",
+		Resource:    "pods",
+		Subresource: "log",
+		Name:        pod,
+	})
+	if err != nil {
+		streamsTotal.WithLabelValues("error").Inc()
+		audit.Error("pod log authorization failed", zap.Error(err))
+		http.Error(w, "authorization check failed", http.StatusBadGateway)
+		return
+	}
+	if !allowed {
+		streamsTotal.WithLabelValues("forbidden").Inc()
+		audit.Warn("pod log access denied", zap.String("reason", reason))
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	stream, err := h.clientset.CoreV1().Pods(ns).GetLogs(pod, opts).Stream(r.Context())
+	if err != nil {
+		streamsTotal.WithLabelValues("error").Inc()
+		audit.Warn("pod log stream failed", zap.Error(err))
+		status := http.StatusBadGateway
+		if err := kube.Classify(err); errs.Kind(err) != nil {
+			status = errs.HTTPStatus(err)
+		}
+		http.Error(w, "failed to open log stream", status)
+		return
+	}
+	defer stream.Close()
+
+	audit.Info("pod log access granted")
+	streamsTotal.WithLabelValues("ok").Inc()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	rc := http.NewResponseController(w)
+	if opts.Follow {
+		// Followed streams outlive the server's WriteTimeout
+		_ = rc.SetWriteDeadline(time.Time{})
+	}
+
+	start := time.Now()
+	n, err := copyFlush(w, rc, stream)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		audit.Debug("pod log stream ended", zap.Error(err))
+	}
+	audit.Info("pod log stream closed",
+		zap.Int64("bytes", n),
+		zap.Duration("duration", time.Since(start)),
+	)
+}
+
+func (h *Handler) logOptions(r *http.Request) (*corev1.PodLogOptions, error) {
+	q := r.URL.Query()
+	opts := &corev1.PodLogOptions{Container: q.Get("container")}
+
+	var err error
+	if s := q.Get("follow"); s != "" {
+		if opts.Follow, err = strconv.ParseBool(s); err != nil {
+			return nil, errors.New("invalid follow")
+		}
+	}
+	if s := q.Get("timestamps"); s != "" {
+		if opts.Timestamps, err = strconv.ParseBool(s); err != nil {
+			return nil, errors.New("invalid timestamps")
+		}
+	}
+	if s := q.Get("previous"); s != "" {
+		if opts.Previous, err = strconv.ParseBool(s); err != nil {
+			return nil, errors.New("invalid previous")
+		}
+	}
+	if s := q.Get("tailLines"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n < 0 {
+			return nil, errors.New("invalid tailLines")
+		}
+		if h.opts.MaxTailLines > 0 {
+			n = min(n, h.opts.MaxTailLines)
+		}
+		opts.TailLines = &n
+	} else if h.opts.MaxTailLines > 0 {
+		n := h.opts.MaxTailLines
+		opts.TailLines = &n
+	}
+	if s := q.Get("sinceSeconds"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, errors.New("invalid sinceSeconds")
+		}
+		opts.SinceSeconds = &n
+	}
+	return opts, nil
+}
+
+// copyFlush copies src to w, flushing after every read so followed logs
+// reach the client as they are written.
+func copyFlush(w io.Writer, rc *http.ResponseController, src io.Reader) (int64, error) {
+	buf := make([]byte, 32*1024)
+	var total int64
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			written, werr := w.Write(buf[:n])
+			total += int64(written)
+			if werr != nil {
+				return total, werr
+			}
+			_ = rc.Flush()
+		}
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
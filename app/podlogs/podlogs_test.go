@@ -0,0 +1,78 @@
+package podlogs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+	authzv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newTestMux(allowUser string) *http.ServeMux {
+	cs := fake.NewClientset(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "api-0"}})
+	cs.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authzv1.SubjectAccessReview)
+		review.Status.Allowed = review.Spec.User == allowUser
+		return true, review, nil
+	})
+
+	h := New(cs, Options{
+		Namespaces:   []string{"team-a"},
+		UserHeader:   "X-Forwarded-User",
+		GroupsHeader: "X-Forwarded-Groups",
+	}, zap.NewNop())
+	mux := http.NewServeMux()
+	h.Register(mux)
+	return mux
+}
+
+func request(mux *http.ServeMux, url, user string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	if user != "" {
+		req.Header.Set("X-Forwarded-User", user)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestStreamsLogsForAuthorisedUser(t *testing.T) {
+	mux := newTestMux("alice")
+
+	rec := request(mux, "/api/v1/namespaces/team-a/pods/api-0/logs?tailLines=10", "alice")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Body.Len() == 0 {
+		t.Error("expected log output")
+	}
+}
+
+func TestRejectsUnauthorisedRequests(t *testing.T) {
+	mux := newTestMux("alice")
+
+	tests := []struct {
+		name string
+		url  string
+		user string
+		want int
+	}{
+		{"no identity", "/api/v1/namespaces/team-a/pods/api-0/logs", "", http.StatusUnauthorized},
+		{"rbac denied", "/api/v1/namespaces/team-a/pods/api-0/logs", "mallory", http.StatusForbidden},
+		{"namespace not allowed", "/api/v1/namespaces/kube-system/pods/etcd-0/logs", "alice", http.StatusForbidden},
+		{"bad tailLines", "/api/v1/namespaces/team-a/pods/api-0/logs?tailLines=-1", "alice", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := request(mux, tt.url, tt.user); rec.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
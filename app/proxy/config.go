@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Route maps a path prefix onto one or more backend base URLs.
+type Route struct {
+	// Prefix is the public path prefix, e.g. "/billing".
+	Prefix string `json:"prefix"`
+	// Backends are load-balanced round-robin, e.g. "http://billing.billing.svc:8080".
+	Backends []string `json:"backends"`
+	// StripPrefix removes Prefix before forwarding.
+	StripPrefix bool `json:"strip_prefix"`
+
+	// Timeout bounds the whole proxied request, including retries.
+	Timeout Duration `json:"timeout"`
+	// Retries is the number of extra attempts for idempotent requests.
+	Retries int `json:"retries"`
+
+	// SetHeaders are added to (or overwrite) request headers.
+	SetHeaders map[string]string `json:"set_headers"`
+	// RemoveHeaders are stripped from the request before forwarding.
+	RemoveHeaders []string `json:"remove_headers"`
+
+	CircuitBreaker BreakerConfig `json:"circuit_breaker"`
+}
+
+// BreakerConfig tunes the per-backend circuit breaker.
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens the circuit.
+	FailureThreshold int `json:"failure_threshold"`
+	// OpenDuration is how long the circuit stays open before a trial request.
+	OpenDuration Duration `json:"open_duration"`
+}
+
+// Duration is a time.Duration that unmarshals from strings like "5s".
+type Duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"5s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// LoadRoutes reads a JSON array of routes from path.
+func LoadRoutes(path string) ([]Route, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read proxy routes: %w", err)
+	}
+	var routes []Route
+	if err := json.Unmarshal(data, &routes); err != nil {
+		return nil, fmt.Errorf("parse proxy routes: %w", err)
+	}
+	for i := range routes {
+		if err := routes[i].validate(); err != nil {
+			return nil, fmt.Errorf("route %d: %w", i, err)
+		}
+	}
+	return routes, nil
+}
+
+func (r *Route) validate() error {
+	if !strings.HasPrefix(r.Prefix, "/") {
+		return fmt.Errorf("prefix %q must start with /", r.Prefix)
+	}
+	if len(r.Backends) == 0 {
+		return fmt.Errorf("prefix %s has no backends", r.Prefix)
+	}
+	r.Prefix = strings.TrimSuffix(r.Prefix, "/")
+	if r.Timeout == 0 {
+		r.Timeout = Duration(30 * time.Second)
+	}
+	if r.CircuitBreaker.FailureThreshold == 0 {
+		r.CircuitBreaker.FailureThreshold = 5
+	}
+	if r.CircuitBreaker.OpenDuration == 0 {
+		r.CircuitBreaker.OpenDuration = Duration(30 * time.Second)
+	}
+	return nil
+}
@@ -0,0 +1,311 @@
+// Package proxy reverse-proxies selected path prefixes to internal backends,
+// turning the platform API into a lightweight gateway. Each route gets
+// round-robin load balancing, retries for idempotent requests, header
+// rewriting, a timeout, and per-backend circuit breaking.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/httpclient"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/tokens"
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_requests_total",
+		Help: "Proxied requests by route and upstream status code.",
+	}, []string{"route", "code"})
+	retriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_retries_total",
+		Help: "Proxied request retries by route.",
+	}, []string{"route"})
+	circuitOpen = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "proxy_circuit_open",
+		Help: "1 when the circuit breaker for a backend is open.",
+	}, []string{"route", "backend"})
+)
+
+// errNoBackend is returned when every backend's circuit is open.
+var errNoBackend = errors.New("no healthy backend available")
+
+// Proxy holds the handlers for all configured routes.
+type Proxy struct {
+	routes []*routeProxy
+	logger *zap.Logger
+}
+
+// Options configures a Proxy.
+type Options struct {
+	// Transport is used for upstream calls; nil means a pooled httpclient
+	// transport with default options.
+	Transport http.RoundTripper
+	// SessionCookie names the platform's session cookie. It, and the
+	// cookies named after it such as its sign-in flow cookie, are never
+	// forwarded.
+	SessionCookie string
+}
+
+// New builds handlers for routes.
+func New(routes []Route, opts Options, logger *zap.Logger) (*Proxy, error) {
+	if opts.Transport == nil {
+		opts.Transport = httpclient.NewTransport(httpclient.DefaultOptions())
+	}
+	p := &Proxy{logger: logger}
+	for _, r := range routes {
+		rp, err := newRouteProxy(r, opts, logger)
+		if err != nil {
+			return nil, err
+		}
+		p.routes = append(p.routes, rp)
+	}
+	return p, nil
+}
+
+// Register mounts every route on mux under its prefix.
+func (p *Proxy) Register(mux *http.ServeMux) {
+	for _, rp := range p.routes {
+		mux.Handle(rp.route.Prefix+"/", rp)
+		p.logger.Info("proxy route registered",
+			zap.String("prefix", rp.route.Prefix),
+			zap.Int("backends", len(rp.backends)),
+		)
+	}
+}
+
+type backend struct {
+	url     *url.URL
+	breaker *httpclient.Breaker
+}
+
+// routeProxy serves a single route.
+type routeProxy struct {
+	route         Route
+	sessionCookie string
+	backends      []*backend
+	next          atomic.Uint64
+	proxy         *httputil.ReverseProxy
+	logger        *zap.Logger
+}
+
+func newRouteProxy(r Route, opts Options, logger *zap.Logger) (*routeProxy, error) {
+	rp := &routeProxy{route: r, sessionCookie: opts.SessionCookie, logger: logger}
+	for _, raw := range r.Backends {
+		u, err := url.Parse(raw)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("route %s: invalid backend %q", r.Prefix, raw)
+		}
+		rp.backends = append(rp.backends, &backend{url: u, breaker: httpclient.NewBreaker(httpclient.BreakerConfig{
+			FailureThreshold: r.CircuitBreaker.FailureThreshold,
+			OpenDuration:     time.Duration(r.CircuitBreaker.OpenDuration),
+		})})
+	}
+
+	rp.proxy = &httputil.ReverseProxy{
+		Rewrite:      rp.rewrite,
+		Transport:    &retryTransport{route: rp, base: opts.Transport},
+		ErrorHandler: rp.errorHandler,
+	}
+	return rp, nil
+}
+
+func (rp *routeProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(rp.route.Timeout))
+	defer cancel()
+	rp.proxy.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// rewrite prepares the outbound request. The backend host is chosen per
+// attempt by retryTransport.
+func (rp *routeProxy) rewrite(pr *httputil.ProxyRequest) {
+	pr.SetXForwarded()
+
+	out := pr.Out
+	if rp.route.StripPrefix {
+		out.URL.Path = strings.TrimPrefix(out.URL.Path, rp.route.Prefix)
+		out.URL.RawPath = ""
+		if out.URL.Path == "" {
+			out.URL.Path = "/"
+		}
+	}
+	rp.dropCredentials(out)
+	for _, h := range rp.route.RemoveHeaders {
+		out.Header.Del(h)
+	}
+	for k, v := range rp.route.SetHeaders {
+		out.Header.Set(k, v)
+	}
+	out.Host = ""
+}
+
+// dropCredentials removes the caller's platform session cookies and
+// personal access token, which a backend could otherwise replay against
+// the API. Backends' own cookies and credentials pass through.
+func (rp *routeProxy) dropCredentials(out *http.Request) {
+	if strings.HasPrefix(strings.TrimPrefix(out.Header.Get("Authorization"), "Bearer "), tokens.SecretPrefix) {
+		out.Header.Del("Authorization")
+	}
+	if rp.sessionCookie == "" || out.Header.Get("Cookie") == "" {
+		return
+	}
+	cookies := out.Cookies()
+	out.Header.Del("Cookie")
+	for _, c := range cookies {
+		if c.Name != rp.sessionCookie && !strings.HasPrefix(c.Name, rp.sessionCookie+"_") {
+			out.AddCookie(c)
+		}
+	}
+}
+
+func (rp *routeProxy) errorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusBadGateway
+	switch {
+	case errors.Is(err, errNoBackend):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		status = http.StatusGatewayTimeout
+	}
+	requestsTotal.WithLabelValues(rp.route.Prefix, strconv.Itoa(status)).Inc()
+
+	rp.logger.Warn("proxy request failed",
+		zap.String("route", rp.route.Prefix),
+		zap.String("path", r.URL.Path),
+		zap.Error(err),
+	)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"error":%q}`, http.StatusText(status))
+}
+
+// pick returns the next backend whose circuit allows a request, skipping any
+// in exclude.
+func (rp *routeProxy) pick(exclude map[*backend]bool) *backend {
+	n := len(rp.backends)
+	start := rp.next.Add(1)
+	for i := 0; i < n; i++ {
+		b := rp.backends[(start+uint64(i))%uint64(n)]
+		if exclude[b] {
+			continue
+		}
+		if b.breaker.Allow() {
+			return b
+		}
+	}
+	return nil
+}
+
+// retryTransport sends each attempt to a healthy backend and retries
+// idempotent requests on connection errors and 502/503/504.
+type retryTransport struct {
+	route *routeProxy
+	base  http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rp := t.route
+	attempts := 1
+	if isIdempotent(req) {
+		attempts += rp.route.Retries
+	}
+
+	tried := make(map[*backend]bool)
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		b := rp.pick(tried)
+		if b == nil {
+			// Every backend was tried or is open; allow reuse before giving up
+			if b = rp.pick(nil); b == nil {
+				break
+			}
+		}
+		tried[b] = true
+		if attempt > 0 {
+			retriesTotal.WithLabelValues(rp.route.Prefix).Inc()
+		}
+
+		out := req.Clone(req.Context())
+		out.URL.Scheme = b.url.Scheme
+		out.URL.Host = b.url.Host
+		out.URL.Path = singleJoiningSlash(b.url.Path, req.URL.Path)
+
+		resp, err := t.base.RoundTrip(out)
+		failed := err != nil || isRetryableStatus(resp.StatusCode)
+		b.breaker.Record(!failed)
+		t.observe(b)
+
+		if !failed {
+			requestsTotal.WithLabelValues(rp.route.Prefix, strconv.Itoa(resp.StatusCode)).Inc()
+			return resp, nil
+		}
+		if req.Context().Err() != nil {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, req.Context().Err()
+		}
+		if attempt == attempts-1 && resp != nil {
+			// Out of retries: surface the upstream's own error response
+			requestsTotal.WithLabelValues(rp.route.Prefix, strconv.Itoa(resp.StatusCode)).Inc()
+			return resp, nil
+		}
+		if resp != nil {
+			resp.Body.Close()
+			lastErr = fmt.Errorf("backend %s returned %d", b.url.Host, resp.StatusCode)
+		} else {
+			lastErr = err
+		}
+	}
+
+	if lastErr == nil {
+		lastErr = errNoBackend
+	}
+	return nil, lastErr
+}
+
+func (t *retryTransport) observe(b *backend) {
+	v := 0.0
+	if b.breaker.Open() {
+		v = 1
+	}
+	circuitOpen.WithLabelValues(t.route.route.Prefix, b.url.Host).Set(v)
+}
+
+func isIdempotent(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		// Bodies are streamed once, so only bodyless requests can be replayed
+		return r.Body == nil || r.Body == http.NoBody
+	}
+	return false
+}
+
+func isRetryableStatus(code int) bool {
+	return code == http.StatusBadGateway ||
+		code == http.StatusServiceUnavailable ||
+		code == http.StatusGatewayTimeout
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
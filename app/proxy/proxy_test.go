@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newTestProxy(t *testing.T, route Route) *http.ServeMux {
+	t.Helper()
+	if err := route.validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	p, err := New([]Route{route}, Options{SessionCookie: "platform_session"}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	mux := http.NewServeMux()
+	p.Register(mux)
+	return mux
+}
+
+func TestProxyStripPrefixAndHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/items" {
+			t.Errorf("expected path '/v1/items', got '%s'", r.URL.Path)
+		}
+		if r.Header.Get("X-Platform") != "gateway" {
+			t.Errorf("expected X-Platform header to be set")
+		}
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("expected Authorization header to be removed")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	mux := newTestProxy(t, Route{
+		Prefix:        "/billing",
+		Backends:      []string{upstream.URL},
+		StripPrefix:   true,
+		SetHeaders:    map[string]string{"X-Platform": "gateway"},
+		RemoveHeaders: []string{"Authorization"},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/billing/v1/items", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rec.Code)
+	}
+}
+
+func TestProxyDropsPlatformCredentials(t *testing.T) {
+	var auth, cookie string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, cookie = r.Header.Get("Authorization"), r.Header.Get("Cookie")
+	}))
+	defer upstream.Close()
+	mux := newTestProxy(t, Route{Prefix: "/billing", Backends: []string{upstream.URL}})
+
+	req := httptest.NewRequest(http.MethodGet, "/billing/v1/items", nil)
+	req.Header.Set("Authorization", "Bearer plt_secret")
+	req.Header.Set("Cookie", "platform_session=sealed; theme=dark; platform_session_flow=state")
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+	if auth != "" || cookie != "theme=dark" {
+		t.Errorf("expected platform credentials dropped, got Authorization %q and Cookie %q", auth, cookie)
+	}
+
+	// A backend's own bearer token still reaches it
+	req = httptest.NewRequest(http.MethodGet, "/billing/v1/items", nil)
+	req.Header.Set("Authorization", "Bearer backend-token")
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+	if auth != "Bearer backend-token" {
+		t.Errorf("expected other bearer tokens forwarded, got %q", auth)
+	}
+}
+
+func TestProxyRetriesOtherBackend(t *testing.T) {
+	var badHits atomic.Int32
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		badHits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer good.Close()
+
+	mux := newTestProxy(t, Route{
+		Prefix:   "/svc",
+		Backends: []string{bad.URL, good.URL},
+		Retries:  1,
+	})
+
+	for i := 0; i < 4; i++ {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/svc/x", nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("request %d: expected 200, got %d", i, rec.Code)
+		}
+	}
+	if badHits.Load() == 0 {
+		t.Error("expected the failing backend to be tried")
+	}
+}
+
+func TestProxyCircuitBreakerOpens(t *testing.T) {
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+
+	mux := newTestProxy(t, Route{
+		Prefix:   "/svc",
+		Backends: []string{upstream.URL},
+		CircuitBreaker: BreakerConfig{
+			FailureThreshold: 2,
+			OpenDuration:     Duration(time.Minute),
+		},
+	})
+
+	codes := make([]int, 3)
+	for i := range codes {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/svc/x", nil))
+		codes[i] = rec.Code
+	}
+
+	if codes[2] != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 once circuit is open, got %v", codes)
+	}
+	if hits.Load() != 2 {
+		t.Errorf("expected 2 upstream hits before opening, got %d", hits.Load())
+	}
+}
@@ -0,0 +1,142 @@
+package queue
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/handlers"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+// Handler serves the job status and retry endpoints to members of the
+// admin groups.
+type Handler struct {
+	queue   *Queue
+	headers authz.Headers
+	groups  []string
+	logger  *zap.Logger
+}
+
+// NewHandler creates a handler that admits callers in any of groups, as
+// asserted by the authenticating proxy.
+func NewHandler(q *Queue, headers authz.Headers, groups []string, logger *zap.Logger) *Handler {
+	return &Handler{queue: q, headers: headers, groups: groups, logger: logger}
+}
+
+// Register mounts the job endpoints on mux:
+//
+//	GET  /api/v1/jobs               jobs newest first (?type=&status=&limit=)
+//	GET  /api/v1/jobs/{id}          one job
+//	POST /api/v1/jobs/{id}/retry    queue a dead job again
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.Handle("GET /api/v1/jobs", h.authorize("list", handlers.Handle(h.logger, h.list)))
+	mux.Handle("GET /api/v1/jobs/{id}", h.authorize("get", handlers.Handle(h.logger, h.get)))
+	mux.Handle("POST /api/v1/jobs/{id}/retry", h.authorize("retry", handlers.Handle(h.logger, h.retry)))
+}
+
+type listRequest struct {
+	Type   string `query:"type"`
+	Status string `query:"status"`
+	Limit  int    `query:"limit"`
+}
+
+func (req *listRequest) Validate() error {
+	if req.Status != "" && !slices.Contains([]string{store.JobQueued, store.JobRunning, store.JobSucceeded, store.JobDead}, req.Status) {
+		return fmt.Errorf("unknown status %q", req.Status)
+	}
+	if req.Limit < 0 || req.Limit > maxListLimit {
+		return fmt.Errorf("limit must be between 1 and %d", maxListLimit)
+	}
+	return nil
+}
+
+type jobList struct {
+	Items []store.QueueJob `json:"items"`
+}
+
+type jobRequest struct {
+	ID string `path:"id"`
+}
+
+func (h *Handler) list(ctx context.Context, req listRequest) (jobList, error) {
+	f := store.QueueFilter{Type: req.Type, Status: req.Status, Limit: cmp.Or(req.Limit, defaultListLimit)}
+	jobs, err := h.queue.repo.List(ctx, f)
+	if jobs == nil {
+		jobs = []store.QueueJob{}
+	}
+	return jobList{Items: jobs}, err
+}
+
+func (h *Handler) get(ctx context.Context, req jobRequest) (*store.QueueJob, error) {
+	job, err := h.queue.Get(ctx, req.ID)
+	return job, notFound(err)
+}
+
+func (h *Handler) retry(ctx context.Context, req jobRequest) (*store.QueueJob, error) {
+	job, err := h.queue.repo.Retry(ctx, req.ID, h.queue.now().UTC())
+	if err != nil {
+		return nil, notFound(err)
+	}
+	auditFrom(ctx).Info("dead job queued again", zap.String("job_id", job.ID), zap.String("type", job.Type))
+	return job, nil
+}
+
+// notFound names the job in a not found error.
+func notFound(err error) error {
+	if errors.Is(err, store.ErrNotFound) {
+		return errs.New(errs.NotFound, "job not found")
+	}
+	return err
+}
+
+type auditKey struct{}
+
+// auditFrom returns the logger for the audit entry of the operation
+// authorized for ctx.
+func auditFrom(ctx context.Context) *zap.Logger {
+	if l, ok := ctx.Value(auditKey{}).(*zap.Logger); ok {
+		return l
+	}
+	return zap.NewNop()
+}
+
+// authorize admits callers in one of the admin groups to next, with the
+// logger for the audit entry of the operation in the request context.
+func (h *Handler) authorize(op string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := h.headers.Identity(r)
+		if id.User == "" {
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		audit := h.logger.With(
+			zap.String("audit", "queue"),
+			zap.String("request_id", middleware.GetRequestID(r.Context())),
+			zap.String("user", id.User),
+			zap.Strings("groups", id.Groups),
+			zap.String("operation", op),
+		)
+		for _, g := range id.Groups {
+			if slices.Contains(h.groups, g) {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), auditKey{}, audit)))
+				return
+			}
+		}
+		audit.Warn("job operation denied")
+		http.Error(w, "forbidden", http.StatusForbidden)
+	})
+}
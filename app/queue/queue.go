@@ -0,0 +1,318 @@
+// Package queue runs background jobs from a durable queue in the store.
+// Jobs survive restarts: a pool of workers on every replica claims due
+// jobs under a lease, runs the handler registered for their type and
+// records the outcome. A failed job is retried with exponential backoff
+// until it runs out of attempts, then it is dead-lettered and waits for a
+// retry through the API. A job whose worker stopped mid-run is claimed
+// again once its lease expires, so handlers must be idempotent.
+//
+// The package is named queue rather than jobs, which submits Kubernetes
+// Jobs.
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+var (
+	jobsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "queue_jobs_total",
+		Help: "Finished job attempts by type and result (succeeded, retried or dead).",
+	}, []string{"type", "result"})
+	jobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "queue_job_duration_seconds",
+		Help:    "Duration of job attempts by type.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 16),
+	}, []string{"type"})
+	jobsRunning = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "queue_jobs_running",
+		Help: "Jobs this replica is running.",
+	})
+)
+
+// ErrUnknownType is returned when enqueueing a job no handler is
+// registered for.
+var ErrUnknownType = errs.New(errs.Invalid, "unknown job type")
+
+// Func handles one attempt of a job. Its context ends with the job's
+// lease. A returned error fails the attempt; wrap it with Permanent to
+// dead-letter the job without further attempts.
+type Func func(ctx context.Context, job store.QueueJob) error
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as one retrying cannot fix, such as a payload that
+// does not decode.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// Options configures a Queue.
+type Options struct {
+	// Workers is how many jobs the replica runs at once; 0 means 1.
+	Workers int
+	// PollInterval is how often idle workers look for due jobs.
+	PollInterval time.Duration
+	// Lease bounds a job attempt. A job whose worker stopped is claimed
+	// again once the lease expires, so it must exceed the longest run; 0
+	// means 5 minutes.
+	Lease time.Duration
+	// MaxAttempts is how many times a job runs before it is dead; 0
+	// means 5.
+	MaxAttempts int
+	// BackoffBase and BackoffMax bound the delay before a retry, which
+	// doubles with every attempt and is jittered.
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// Retention is how long succeeded jobs are kept; 0 keeps them. Dead
+	// jobs are kept until they are retried.
+	Retention time.Duration
+}
+
+// Queue enqueues jobs and runs them with the registered handlers.
+type Queue struct {
+	repo   store.QueueRepository
+	opts   Options
+	logger *zap.Logger
+	worker string
+	now    func() time.Time
+
+	mu       sync.RWMutex
+	handlers map[string]Func
+	running  sync.WaitGroup
+}
+
+// New creates a queue over repo; register handlers with Handle, then
+// start the workers with Run.
+func New(repo store.QueueRepository, opts Options, logger *zap.Logger) *Queue {
+	opts.Workers = max(opts.Workers, 1)
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = 5 * time.Minute
+	}
+	if opts.BackoffBase <= 0 {
+		opts.BackoffBase = 10 * time.Second
+	}
+	if opts.BackoffMax < opts.BackoffBase {
+		opts.BackoffMax = max(10*time.Minute, opts.BackoffBase)
+	}
+	host, _ := os.Hostname()
+	return &Queue{
+		repo:     repo,
+		opts:     opts,
+		logger:   logger,
+		worker:   host + "/" + uuid.NewString()[:8],
+		now:      time.Now,
+		handlers: make(map[string]Func),
+	}
+}
+
+// Handle registers fn for jobs of typ. Only registered types are claimed,
+// so replicas without a handler leave the jobs to the others.
+func (q *Queue) Handle(typ string, fn Func) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[typ] = fn
+}
+
+// Enqueue queues a job of typ with payload encoded as JSON, due now.
+func (q *Queue) Enqueue(ctx context.Context, typ string, payload any) (*store.QueueJob, error) {
+	q.mu.RLock()
+	_, ok := q.handlers[typ]
+	q.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownType, typ)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("encode payload: %w", err)
+	}
+	job := &store.QueueJob{Type: typ, Payload: data, MaxAttempts: q.opts.MaxAttempts, RunAt: q.now().UTC()}
+	if err := q.repo.Enqueue(ctx, job); err != nil {
+		return nil, err
+	}
+	q.logger.Info("job enqueued", zap.String("job_id", job.ID), zap.String("type", typ))
+	return job, nil
+}
+
+// Get returns a job by ID.
+func (q *Queue) Get(ctx context.Context, id string) (*store.QueueJob, error) {
+	return q.repo.Get(ctx, id)
+}
+
+// Run claims and runs due jobs every poll interval until ctx is done, and
+// prunes succeeded jobs past the retention hourly. Jobs still running when
+// it returns carry on; Shutdown waits for them.
+func (q *Queue) Run(ctx context.Context) {
+	ticker := time.NewTicker(q.opts.PollInterval)
+	defer ticker.Stop()
+	slots := make(chan struct{}, q.opts.Workers)
+	var pruned time.Time
+	for {
+		if err := q.poll(ctx, slots); err != nil && ctx.Err() == nil {
+			q.logger.Warn("failed to claim jobs", zap.Error(err))
+		}
+		if now := q.now(); q.opts.Retention > 0 && now.Sub(pruned) >= time.Hour {
+			if _, err := q.repo.Prune(ctx, now.Add(-q.opts.Retention)); err != nil && ctx.Err() == nil {
+				q.logger.Warn("failed to prune jobs", zap.Error(err))
+			}
+			pruned = now
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Shutdown waits for running jobs to finish or ctx to expire. Jobs cut
+// short are claimed again once their lease expires.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		q.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// poll claims as many jobs as there are free slots and starts them.
+func (q *Queue) poll(ctx context.Context, slots chan struct{}) error {
+	free := cap(slots) - len(slots)
+	if free == 0 {
+		return nil
+	}
+	q.mu.RLock()
+	types := make([]string, 0, len(q.handlers))
+	for typ := range q.handlers {
+		types = append(types, typ)
+	}
+	q.mu.RUnlock()
+	if len(types) == 0 {
+		return nil
+	}
+	slices.Sort(types)
+
+	now := q.now().UTC()
+	jobs, err := q.repo.Claim(ctx, q.worker, types, free, now, now.Add(q.opts.Lease))
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		slots <- struct{}{}
+		q.running.Add(1)
+		jobsRunning.Inc()
+		// Attempts outlive Run's context: shutdown waits for them instead
+		// of failing them
+		jctx, cancel := context.WithDeadline(context.WithoutCancel(ctx), *job.LockedUntil)
+		go func() {
+			defer func() {
+				cancel()
+				jobsRunning.Dec()
+				q.running.Done()
+				<-slots
+			}()
+			q.process(jctx, job)
+		}()
+	}
+	return nil
+}
+
+// process runs one attempt of job and records its outcome.
+func (q *Queue) process(ctx context.Context, job store.QueueJob) {
+	log := q.logger.With(zap.String("job_id", job.ID), zap.String("type", job.Type), zap.Int("attempt", job.Attempts))
+	q.mu.RLock()
+	fn := q.handlers[job.Type]
+	q.mu.RUnlock()
+
+	var err error
+	if job.Attempts > job.MaxAttempts {
+		// Claimed again after its worker stopped during the last attempt
+		err = Permanent(errors.New("lease expired during the last attempt"))
+	} else {
+		start := q.now()
+		err = q.call(ctx, fn, job)
+		jobDuration.WithLabelValues(job.Type).Observe(q.now().Sub(start).Seconds())
+	}
+
+	now := q.now().UTC()
+	result := "succeeded"
+	var permanent permanentError
+	switch {
+	case err == nil:
+		job.Status, job.LastError, job.FinishedAt = store.JobSucceeded, "", &now
+	case errors.As(err, &permanent) || job.Attempts >= job.MaxAttempts:
+		result = "dead"
+		job.Status, job.LastError, job.FinishedAt = store.JobDead, err.Error(), &now
+		log.Error("job dead-lettered", zap.Error(err))
+	default:
+		result = "retried"
+		job.Status, job.LastError = store.JobQueued, err.Error()
+		job.RunAt = now.Add(backoff(job.Attempts-1, q.opts.BackoffBase, q.opts.BackoffMax))
+		log.Warn("job failed, will retry", zap.Time("run_at", job.RunAt), zap.Error(err))
+	}
+	jobsTotal.WithLabelValues(job.Type, result).Inc()
+
+	err = q.repo.Finish(context.WithoutCancel(ctx), q.worker, &job)
+	if errors.Is(err, store.ErrConflict) {
+		// The lease expired and another worker claimed the job
+		log.Warn("job lease lost before it finished")
+		return
+	}
+	if err != nil {
+		log.Error("failed to record job outcome", zap.Error(err))
+	}
+}
+
+// call runs fn, turning a panic into a failed attempt.
+func (q *Queue) call(ctx context.Context, fn Func, job store.QueueJob) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return fn(ctx, job)
+}
+
+// backoff returns a full-jitter delay before retry attempt (from zero):
+// random up to base doubled per attempt, capped at max.
+func backoff(attempt int, base, max time.Duration) time.Duration {
+	d := base << attempt
+	if d <= 0 || d > max {
+		d = max
+	}
+	return time.Duration(rand.Int64N(int64(d) + 1))
+}
@@ -0,0 +1,144 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+// run polls once at now and waits for the claimed jobs.
+func run(t *testing.T, q *Queue, now time.Time) {
+	t.Helper()
+	q.now = func() time.Time { return now }
+	if err := q.poll(t.Context(), make(chan struct{}, q.opts.Workers)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	if err := q.Shutdown(ctx); err != nil {
+		t.Fatalf("jobs did not finish: %v", err)
+	}
+}
+
+func newQueue(st *store.Store) *Queue {
+	q := New(st.Queue, Options{Workers: 4, MaxAttempts: 2, BackoffBase: time.Minute, BackoffMax: time.Minute}, zap.NewNop())
+	calls := 0
+	q.Handle("flaky", func(ctx context.Context, job store.QueueJob) error {
+		if calls++; calls == 1 {
+			return errors.New("unavailable")
+		}
+		return nil
+	})
+	q.Handle("broken", func(ctx context.Context, job store.QueueJob) error { return errors.New("always fails") })
+	q.Handle("invalid", func(ctx context.Context, job store.QueueJob) error {
+		var v struct{ N int }
+		return Permanent(json.Unmarshal(job.Payload, &v))
+	})
+	return q
+}
+
+func TestQueueRetriesAndDeadLetters(t *testing.T) {
+	ctx := t.Context()
+	st := store.NewMemory()
+	q := newQueue(st)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return start }
+
+	// A job whose worker stopped during its only attempt
+	crashed := &store.QueueJob{Type: "flaky", MaxAttempts: 1, RunAt: start}
+	st.Queue.Enqueue(ctx, crashed)
+	st.Queue.Claim(ctx, "gone", []string{"flaky"}, 1, start, start)
+
+	flaky, _ := q.Enqueue(ctx, "flaky", map[string]int{"n": 1})
+	broken, _ := q.Enqueue(ctx, "broken", nil)
+	invalid, _ := q.Enqueue(ctx, "invalid", "not an object")
+	if _, err := q.Enqueue(ctx, "unknown", nil); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("expected ErrUnknownType, got %v", err)
+	}
+
+	run(t, q, start.Add(time.Second))
+	get := func(id string) *store.QueueJob {
+		j, err := st.Queue.Get(ctx, id)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return j
+	}
+	if j := get(flaky.ID); j.Status != store.JobQueued || j.Attempts != 1 || j.LastError != "unavailable" || j.RunAt.After(start.Add(time.Minute+time.Second)) {
+		t.Errorf("expected the failed job queued for a retry within the backoff, got %+v", j)
+	}
+	if j := get(invalid.ID); j.Status != store.JobDead || j.Attempts != 1 {
+		t.Errorf("expected a permanent failure to dead-letter the job at once, got %+v", j)
+	}
+	if j := get(crashed.ID); j.Status != store.JobDead || j.LastError == "" {
+		t.Errorf("expected an expired last attempt to dead-letter the job, got %+v", j)
+	}
+
+	run(t, q, start.Add(2*time.Minute))
+	if j := get(flaky.ID); j.Status != store.JobSucceeded || j.Attempts != 2 || j.FinishedAt == nil {
+		t.Errorf("expected the retry to succeed, got %+v", j)
+	}
+	if j := get(broken.ID); j.Status != store.JobDead || j.Attempts != 2 {
+		t.Errorf("expected the job dead after its last attempt, got %+v", j)
+	}
+	if n, _ := st.Queue.Prune(ctx, start.Add(time.Hour)); n != 1 {
+		t.Errorf("expected only the succeeded job pruned, got %d", n)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	ctx := t.Context()
+	st := store.NewMemory()
+	q := newQueue(st)
+	broken, _ := q.Enqueue(ctx, "broken", nil)
+	flaky, _ := q.Enqueue(ctx, "flaky", nil)
+	now := time.Now()
+	run(t, q, now)
+	run(t, q, now.Add(2*time.Minute))
+
+	mux := http.NewServeMux()
+	NewHandler(q, authz.Headers{User: "X-Forwarded-User", Groups: "X-Forwarded-Groups"}, []string{"platform-admins"}, zap.NewNop()).Register(mux)
+	do := func(method, path, groups string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-Forwarded-User", "alice")
+		req.Header.Set("X-Forwarded-Groups", groups)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodGet, "/api/v1/jobs", "developers"); rec.Code != http.StatusForbidden {
+		t.Errorf("expected callers outside the admin groups to be refused, got %d", rec.Code)
+	}
+	rec := do(http.MethodGet, "/api/v1/jobs?status=dead", "platform-admins")
+	var list struct{ Items []store.QueueJob }
+	json.NewDecoder(rec.Body).Decode(&list)
+	if rec.Code != http.StatusOK || len(list.Items) != 1 || list.Items[0].ID != broken.ID {
+		t.Fatalf("expected the dead job, got %d %+v", rec.Code, list.Items)
+	}
+	if rec := do(http.MethodGet, "/api/v1/jobs?status=failed", "platform-admins"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown status, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/api/v1/jobs/missing", "platform-admins"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+
+	if rec := do(http.MethodPost, "/api/v1/jobs/"+flaky.ID+"/retry", "platform-admins"); rec.Code != http.StatusConflict {
+		t.Errorf("expected retrying a job that is not dead to conflict, got %d", rec.Code)
+	}
+	rec = do(http.MethodPost, "/api/v1/jobs/"+broken.ID+"/retry", "platform-admins")
+	var job store.QueueJob
+	json.NewDecoder(rec.Body).Decode(&job)
+	if rec.Code != http.StatusOK || job.Status != store.JobQueued || job.Attempts != 0 {
+		t.Errorf("expected the dead job queued again, got %d %+v", rec.Code, job)
+	}
+}
@@ -0,0 +1,344 @@
+// Package quotas reports ResourceQuota usage against limits per namespace.
+// A collector samples every quota from the shared informer cache on an
+// interval, records the samples in the store for history, and publishes an
+// event whenever a resource crosses the warning or critical threshold.
+package quotas
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+var usageRatio = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "resource_quota_usage_ratio",
+	Help: "ResourceQuota used/hard per namespace, quota and resource.",
+}, []string{"namespace", "quota", "resource"})
+
+// Level is how close a resource is to its hard limit.
+type Level int
+
+const (
+	LevelOK Level = iota
+	LevelWarning
+	LevelCritical
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelWarning:
+		return "warning"
+	case LevelCritical:
+		return "critical"
+	default:
+		return "ok"
+	}
+}
+
+// Options configures the reporter.
+type Options struct {
+	// Namespaces limits which quotas are reported (empty = all).
+	Namespaces []string
+	// Retention is how long samples are kept in the store.
+	Retention time.Duration
+	// WarnThreshold and CriticalThreshold are used/hard ratios, e.g. 0.8
+	// and 0.95.
+	WarnThreshold     float64
+	CriticalThreshold float64
+}
+
+// Reporter collects quota usage and serves it over HTTP.
+type Reporter struct {
+	quotas  corelisters.ResourceQuotaLister
+	repo    store.QuotaUsageRepository
+	bus     events.Publisher
+	opts    Options
+	allowed map[string]bool
+	logger  *zap.Logger
+
+	mu sync.Mutex
+	// levels remembers the last level of each namespace/quota/resource so
+	// events fire on transitions only
+	levels map[string]Level
+	now    func() time.Time
+}
+
+// New registers the ResourceQuota informer on factory; the factory must be
+// started before Run.
+func New(factory informers.SharedInformerFactory, repo store.QuotaUsageRepository, bus events.Publisher, opts Options, logger *zap.Logger) *Reporter {
+	rp := &Reporter{
+		quotas: factory.Core().V1().ResourceQuotas().Lister(),
+		repo:   repo,
+		bus:    bus,
+		opts:   opts,
+		logger: logger,
+		levels: make(map[string]Level),
+		now:    time.Now,
+	}
+	if len(opts.Namespaces) > 0 {
+		rp.allowed = make(map[string]bool, len(opts.Namespaces))
+		for _, ns := range opts.Namespaces {
+			rp.allowed[ns] = true
+		}
+	}
+	return rp
+}
+
+// Run collects immediately and then every interval until ctx is done.
+func (rp *Reporter) Run(ctx context.Context, interval time.Duration) {
+	rp.Collect(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rp.Collect(ctx)
+		}
+	}
+}
+
+// Collect samples every quota once, records the samples, publishes
+// threshold events and prunes history older than the retention.
+func (rp *Reporter) Collect(ctx context.Context) {
+	now := rp.now().UTC()
+	samples := rp.sample(now)
+	if err := rp.repo.Record(ctx, samples); err != nil {
+		rp.logger.Warn("failed to record quota usage", zap.Error(err))
+	}
+	for _, s := range samples {
+		usageRatio.WithLabelValues(s.Namespace, s.Quota, s.Resource).Set(ratio(s))
+		rp.checkThreshold(ctx, s)
+	}
+	if rp.opts.Retention > 0 {
+		if _, err := rp.repo.Prune(ctx, now.Add(-rp.opts.Retention)); err != nil {
+			rp.logger.Warn("failed to prune quota usage history", zap.Error(err))
+		}
+	}
+}
+
+func (rp *Reporter) sample(now time.Time) []store.QuotaSample {
+	quotas, err := rp.quotas.List(labels.Everything())
+	if err != nil {
+		rp.logger.Warn("failed to list resource quotas", zap.Error(err))
+		return nil
+	}
+	var samples []store.QuotaSample
+	for _, q := range quotas {
+		if rp.allowed != nil && !rp.allowed[q.Namespace] {
+			continue
+		}
+		samples = append(samples, toSamples(q, now)...)
+	}
+	return samples
+}
+
+// checkThreshold publishes quota.threshold.crossed when a resource moves up
+// a level and quota.threshold.cleared when it drops back to ok.
+func (rp *Reporter) checkThreshold(ctx context.Context, s store.QuotaSample) {
+	level := rp.level(ratio(s))
+	key := s.Namespace + "/" + s.Quota + "/" + s.Resource
+
+	rp.mu.Lock()
+	prev := rp.levels[key]
+	rp.levels[key] = level
+	rp.mu.Unlock()
+
+	var eventType string
+	switch {
+	case level > prev:
+		eventType = "quota.threshold.crossed"
+	case level == LevelOK && prev != LevelOK:
+		eventType = "quota.threshold.cleared"
+	default:
+		return
+	}
+	e, err := events.New(eventType, "quotas", map[string]any{
+		"namespace": s.Namespace,
+		"quota":     s.Quota,
+		"resource":  s.Resource,
+		"used":      s.Used,
+		"hard":      s.Hard,
+		"level":     level.String(),
+	})
+	if err != nil {
+		return
+	}
+	if err := rp.bus.Publish(ctx, e); err != nil {
+		rp.logger.Warn("failed to publish quota event", zap.Error(err))
+	}
+}
+
+func (rp *Reporter) level(r float64) Level {
+	switch {
+	case rp.opts.CriticalThreshold > 0 && r >= rp.opts.CriticalThreshold:
+		return LevelCritical
+	case rp.opts.WarnThreshold > 0 && r >= rp.opts.WarnThreshold:
+		return LevelWarning
+	default:
+		return LevelOK
+	}
+}
+
+// Register mounts the reporting endpoints on mux.
+func (rp *Reporter) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/quotas", rp.list)
+	mux.HandleFunc("GET /api/v1/namespaces/{ns}/quotas", rp.namespace)
+	mux.HandleFunc("GET /api/v1/namespaces/{ns}/quotas/history", rp.history)
+}
+
+// Usage is the current state of one resource in one quota.
+type Usage struct {
+	Namespace string  `json:"namespace"`
+	Quota     string  `json:"quota"`
+	Resource  string  `json:"resource"`
+	Used      float64 `json:"used"`
+	Hard      float64 `json:"hard"`
+	Ratio     float64 `json:"ratio"`
+	Level     string  `json:"level"`
+}
+
+// list serves current usage of every quota; ?level=warning or critical
+// returns only resources at or above that level.
+func (rp *Reporter) list(w http.ResponseWriter, r *http.Request) {
+	floor := LevelOK
+	switch r.URL.Query().Get("level") {
+	case "", "ok":
+	case "warning":
+		floor = LevelWarning
+	case "critical":
+		floor = LevelCritical
+	default:
+		http.Error(w, "level must be ok, warning or critical", http.StatusBadRequest)
+		return
+	}
+	items := rp.current("", floor)
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+func (rp *Reporter) namespace(w http.ResponseWriter, r *http.Request) {
+	ns := r.PathValue("ns")
+	if rp.allowed != nil && !rp.allowed[ns] {
+		http.Error(w, "namespace not allowed", http.StatusForbidden)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": rp.current(ns, LevelOK)})
+}
+
+// history serves recorded samples of a namespace. ?since= is a Go duration
+// (default 24h) and ?resource= narrows to one resource, e.g. requests.cpu.
+func (rp *Reporter) history(w http.ResponseWriter, r *http.Request) {
+	ns := r.PathValue("ns")
+	if rp.allowed != nil && !rp.allowed[ns] {
+		http.Error(w, "namespace not allowed", http.StatusForbidden)
+		return
+	}
+	window := 24 * time.Hour
+	if s := r.URL.Query().Get("since"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			http.Error(w, "invalid since", http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+	samples, err := rp.repo.History(r.Context(), ns, rp.now().Add(-window))
+	if err != nil {
+		rp.logger.Error("failed to read quota usage history", zap.Error(err))
+		http.Error(w, "failed to read history", http.StatusInternalServerError)
+		return
+	}
+	if resource := r.URL.Query().Get("resource"); resource != "" {
+		filtered := samples[:0]
+		for _, s := range samples {
+			if s.Resource == resource {
+				filtered = append(filtered, s)
+			}
+		}
+		samples = filtered
+	}
+	if samples == nil {
+		samples = []store.QuotaSample{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": samples})
+}
+
+func (rp *Reporter) current(ns string, floor Level) []Usage {
+	items := []Usage{}
+	for _, s := range rp.sample(rp.now().UTC()) {
+		if ns != "" && s.Namespace != ns {
+			continue
+		}
+		r := ratio(s)
+		level := rp.level(r)
+		if level < floor {
+			continue
+		}
+		items = append(items, Usage{
+			Namespace: s.Namespace,
+			Quota:     s.Quota,
+			Resource:  s.Resource,
+			Used:      s.Used,
+			Hard:      s.Hard,
+			Ratio:     r,
+			Level:     level.String(),
+		})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Namespace != items[j].Namespace {
+			return items[i].Namespace < items[j].Namespace
+		}
+		if items[i].Quota != items[j].Quota {
+			return items[i].Quota < items[j].Quota
+		}
+		return items[i].Resource < items[j].Resource
+	})
+	return items
+}
+
+func toSamples(q *corev1.ResourceQuota, now time.Time) []store.QuotaSample {
+	out := make([]store.QuotaSample, 0, len(q.Status.Hard))
+	for name, hard := range q.Status.Hard {
+		used := q.Status.Used[name]
+		out = append(out, store.QuotaSample{
+			Namespace: q.Namespace,
+			Quota:     q.Name,
+			Resource:  string(name),
+			Used:      used.AsApproximateFloat64(),
+			Hard:      hard.AsApproximateFloat64(),
+			SampledAt: now,
+		})
+	}
+	return out
+}
+
+func ratio(s store.QuotaSample) float64 {
+	if s.Hard == 0 {
+		if s.Used > 0 {
+			return 1
+		}
+		return 0
+	}
+	return s.Used / s.Hard
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
@@ -0,0 +1,153 @@
+package quotas
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+func quota(ns, cpuUsed string) *corev1.ResourceQuota {
+	return &corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "compute"},
+		Status: corev1.ResourceQuotaStatus{
+			Hard: corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("4")},
+			Used: corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse(cpuUsed)},
+		},
+	}
+}
+
+type recorder struct {
+	mu     sync.Mutex
+	events []events.Event
+}
+
+func (rec *recorder) handle(_ context.Context, e events.Event) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.events = append(rec.events, e)
+}
+
+func (rec *recorder) types() []string {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	var out []string
+	for _, e := range rec.events {
+		out = append(out, e.Type)
+	}
+	return out
+}
+
+func newReporter(t *testing.T, objs ...*corev1.ResourceQuota) (*Reporter, *fake.Clientset, *store.Store, *recorder) {
+	t.Helper()
+	cs := fake.NewClientset()
+	for _, q := range objs {
+		cs.Tracker().Add(q)
+	}
+	factory := informers.NewSharedInformerFactory(cs, 0)
+	st := store.NewMemory()
+	bus := events.NewMemoryBus()
+	rec := &recorder{}
+	bus.Subscribe(rec.handle)
+
+	rp := New(factory, st.QuotaUsage, bus, Options{
+		Retention:         time.Hour,
+		WarnThreshold:     0.8,
+		CriticalThreshold: 0.95,
+	}, zap.NewNop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		factory.Shutdown()
+	})
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+	return rp, cs, st, rec
+}
+
+func TestCollectPublishesOnTransitionsOnly(t *testing.T) {
+	rp, cs, _, rec := newReporter(t, quota("team-a", "3500m"))
+
+	rp.Collect(t.Context())
+	rp.Collect(t.Context())
+	if got := rec.types(); len(got) != 1 || got[0] != "quota.threshold.crossed" {
+		t.Fatalf("expected one crossed event, got %v", got)
+	}
+
+	// Usage drops back under the warning threshold
+	if _, err := cs.CoreV1().ResourceQuotas("team-a").UpdateStatus(t.Context(), quota("team-a", "1"), metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		q, _ := rp.quotas.ResourceQuotas("team-a").Get("compute")
+		used := q.Status.Used[corev1.ResourceRequestsCPU]
+		if used.Cmp(resource.MustParse("1")) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("informer did not observe the update")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	rp.Collect(t.Context())
+	if got := rec.types(); len(got) != 2 || got[1] != "quota.threshold.cleared" {
+		t.Errorf("expected cleared event, got %v", got)
+	}
+}
+
+func TestHistoryIsRecordedAndPruned(t *testing.T) {
+	rp, _, st, _ := newReporter(t, quota("team-a", "1"))
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	rp.now = func() time.Time { return now }
+
+	rp.Collect(t.Context())
+	now = start.Add(30 * time.Minute)
+	rp.Collect(t.Context())
+	now = start.Add(90 * time.Minute)
+	rp.Collect(t.Context())
+
+	samples, _ := st.QuotaUsage.History(t.Context(), "team-a", time.Time{})
+	if len(samples) != 2 || !samples[0].SampledAt.Equal(start.Add(30*time.Minute)) {
+		t.Errorf("expected the first sample to be pruned, got %+v", samples)
+	}
+
+	mux := http.NewServeMux()
+	rp.Register(mux)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/namespaces/team-a/quotas/history?since=10m", nil))
+	var resp struct{ Items []store.QuotaSample }
+	json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp.Items) != 1 || resp.Items[0].Used != 1 || resp.Items[0].Hard != 4 {
+		t.Errorf("expected the latest sample only, got %+v", resp.Items)
+	}
+}
+
+func TestListFiltersByLevel(t *testing.T) {
+	rp, _, _, _ := newReporter(t, quota("team-a", "3900m"), quota("team-b", "1"))
+	mux := http.NewServeMux()
+	rp.Register(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/quotas?level=critical", nil))
+	var resp struct{ Items []Usage }
+	json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp.Items) != 1 || resp.Items[0].Namespace != "team-a" || resp.Items[0].Level != "critical" {
+		t.Errorf("expected only team-a at critical, got %+v", resp.Items)
+	}
+}
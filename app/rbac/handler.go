@@ -0,0 +1,142 @@
+package rbac
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+// Register mounts the admin endpoints on mux. They rely on the rules for
+// rbac:read and rbac:admin, so mux must be served through Middleware:
+//
+//	GET    /api/v1/rbac/me                 the caller's roles and permissions
+//	GET    /api/v1/rbac/roles              roles and their permissions
+//	GET    /api/v1/rbac/assignments        assignments (?subject_kind=&subject=)
+//	POST   /api/v1/rbac/assignments        assign a role to a user or group
+//	DELETE /api/v1/rbac/assignments/{id}   remove an assignment
+func (e *Enforcer) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/rbac/me", e.me)
+	mux.HandleFunc("GET /api/v1/rbac/roles", e.listRoles)
+	mux.HandleFunc("GET /api/v1/rbac/assignments", e.listAssignments)
+	mux.HandleFunc("POST /api/v1/rbac/assignments", e.createAssignment)
+	mux.HandleFunc("DELETE /api/v1/rbac/assignments/{id}", e.deleteAssignment)
+}
+
+func (e *Enforcer) me(w http.ResponseWriter, r *http.Request) {
+	id := e.headers.Identity(r)
+	if id.User == "" {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+	names, err := e.RolesOf(r.Context(), id)
+	if err != nil {
+		e.fail(w, err)
+		return
+	}
+	perms := []string{}
+	for _, name := range names {
+		for _, p := range e.roles[name].Permissions {
+			if !slices.Contains(perms, p) {
+				perms = append(perms, p)
+			}
+		}
+	}
+	if names == nil {
+		names = []string{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"user":        id.User,
+		"groups":      id.Groups,
+		"roles":       names,
+		"permissions": perms,
+	})
+}
+
+func (e *Enforcer) listRoles(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"items": e.Roles()})
+}
+
+func (e *Enforcer) listAssignments(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	items, err := e.assignments.List(r.Context(), q.Get("subject_kind"), q.Get("subject"))
+	if err != nil {
+		e.fail(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+func (e *Enforcer) createAssignment(w http.ResponseWriter, r *http.Request) {
+	var a store.RoleAssignment
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&a); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	switch {
+	case a.SubjectKind != store.SubjectUser && a.SubjectKind != store.SubjectGroup:
+		http.Error(w, "subject_kind must be user or group", http.StatusBadRequest)
+		return
+	case a.Subject == "":
+		http.Error(w, "subject is required", http.StatusBadRequest)
+		return
+	}
+	if _, ok := e.roles[a.Role]; !ok {
+		http.Error(w, "unknown role", http.StatusBadRequest)
+		return
+	}
+	a.ID = ""
+	a.CreatedBy = e.headers.Identity(r).User
+	if err := e.assignments.Create(r.Context(), &a); err != nil {
+		e.fail(w, err)
+		return
+	}
+	e.audit(r, "role assigned", zap.String("assignment_id", a.ID),
+		zap.String("subject_kind", a.SubjectKind), zap.String("subject", a.Subject), zap.String("role", a.Role))
+	w.Header().Set("Location", "/api/v1/rbac/assignments/"+a.ID)
+	writeJSON(w, http.StatusCreated, a)
+}
+
+func (e *Enforcer) deleteAssignment(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := e.assignments.Delete(r.Context(), id); err != nil {
+		e.fail(w, err)
+		return
+	}
+	e.audit(r, "role assignment removed", zap.String("assignment_id", id))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (e *Enforcer) audit(r *http.Request, msg string, fields ...zap.Field) {
+	id := e.headers.Identity(r)
+	e.logger.Info(msg, append([]zap.Field{
+		zap.String("audit", "rbac"),
+		zap.String("request_id", middleware.GetRequestID(r.Context())),
+		zap.String("user", id.User),
+		zap.Strings("groups", id.Groups),
+	}, fields...)...)
+}
+
+func (e *Enforcer) fail(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		http.Error(w, "assignment not found", http.StatusNotFound)
+	case errors.Is(err, store.ErrConflict):
+		http.Error(w, "subject already has the role", http.StatusConflict)
+	default:
+		e.logger.Error("role assignment request failed", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
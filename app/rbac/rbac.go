@@ -0,0 +1,316 @@
+// Package rbac authorizes API requests against the platform's own roles,
+// independent of cluster RBAC (see authz for SubjectAccessReviews).
+//
+// A role is a named set of permissions such as "tenants:write". Callers
+// get roles from their groups, the identity provider's groups claim as
+// forwarded by the authenticating proxy, through Options.GroupRoles, and
+// from assignments to their user or groups made with the admin API. Rules
+// map routes to the permission they need; the middleware refuses requests
+// to mapped routes whose caller lacks it and passes the others on
+// unchanged, leaving them to the handlers' own checks.
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+var decisionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "rbac_decisions_total",
+	Help: "Authorization decisions on mapped routes by result (allowed, denied, unauthenticated or error).",
+}, []string{"result"})
+
+// Role is a named set of permissions.
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Permissions []string `json:"permissions"`
+}
+
+// Grants reports whether r grants perm. "*" grants every permission and
+// "tenants:*" every action on tenants.
+func (r Role) Grants(perm string) bool {
+	resource, _, _ := strings.Cut(perm, ":")
+	for _, p := range r.Permissions {
+		if p == "*" || p == perm || p == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultRoles are the built-in roles.
+var DefaultRoles = []Role{
+	{"admin", "Everything, including role assignments", []string{"*"}},
+	{"operator", "Operate the platform; read role assignments", []string{
+		"tenants:*", "environments:*", "catalog:*", "search:read", "jobs:*", "backup:*", "nodes:*", "rbac:read",
+		"credentials:*", "audit:verify", "webhooks:*", "supplychain:read", "locks:*",
+		"events:read", "objects:*",
+	}},
+	{"developer", "Read the platform and manage catalog items", []string{
+		"tenants:read", "environments:read", "catalog:*", "search:read", "jobs:read", "credentials:read",
+		"supplychain:read", "locks:*", "events:read", "objects:*",
+	}},
+	{"viewer", "Read the platform", []string{
+		"tenants:read", "environments:read", "catalog:read", "search:read", "supplychain:read", "locks:read",
+		"events:read", "objects:read",
+	}},
+}
+
+// Rule maps a route to the permission it needs. Pattern is a ServeMux
+// pattern, e.g. "PUT /api/v1/tenants/{id}", and matches the same requests
+// as it would when routing. An empty Permission exempts the route from a
+// broader pattern.
+type Rule struct {
+	Pattern    string
+	Permission string
+}
+
+// DefaultRules map the platform's write endpoints, and the reads of
+// entities whose visibility is not limited otherwise.
+var DefaultRules = []Rule{
+	{"GET /api/v1/tenants", "tenants:read"},
+	{"GET /api/v1/tenants/", "tenants:read"},
+	{"POST /api/v1/tenants", "tenants:write"},
+	{"PUT /api/v1/tenants/{id}", "tenants:write"},
+	{"DELETE /api/v1/tenants/{id}", "tenants:write"},
+	{"POST /api/v1/tenants/{tenant}/onboarding", "tenants:onboard"},
+	{"GET /api/v1/tenants/{id}/credentials", "credentials:read"},
+	{"PUT /api/v1/tenants/{id}/credentials/{name}", "credentials:write"},
+	{"DELETE /api/v1/tenants/{id}/credentials/{name}", "credentials:write"},
+	{"POST /api/v1/admin/credentials/reencrypt", "credentials:rotate"},
+	{"GET /api/v1/admin/webhooks/keys", "webhooks:read"},
+	{"POST /api/v1/admin/webhooks/keys/rotate", "webhooks:rotate"},
+	{"GET /api/v1/environments", "environments:read"},
+	{"GET /api/v1/environments/", "environments:read"},
+	{"POST /api/v1/environments", "environments:write"},
+	{"PUT /api/v1/environments/{id}", "environments:write"},
+	{"DELETE /api/v1/environments/{id}", "environments:write"},
+	{"GET /api/v1/catalog", "catalog:read"},
+	{"GET /api/v1/catalog/{name}", "catalog:read"},
+	{"POST /api/v1/catalog", "catalog:write"},
+	{"PUT /api/v1/catalog/{name}", "catalog:write"},
+	{"DELETE /api/v1/catalog/{name}", "catalog:write"},
+	{"GET /api/v1/search", "search:read"},
+	// GraphQL resolves tenants and their services
+	{"/graphql", "tenants:read"},
+	{"GET /api/v1/events", "events:read"},
+	{"GET /api/v1/objects/{key...}", "objects:read"},
+	{"POST /api/v1/objects/presign", "objects:write"},
+	{"GET /api/v1/supply-chain", "supplychain:read"},
+	{"GET /api/v1/supply-chain/", "supplychain:read"},
+	{"GET /api/v1/jobs", "jobs:read"},
+	{"GET /api/v1/jobs/{id}", "jobs:read"},
+	{"GET /api/v1/jobs/templates", ""},
+	{"POST /api/v1/jobs/{id}/retry", "jobs:retry"},
+	{"GET /api/v1/locks/{name}", "locks:read"},
+	{"POST /api/v1/locks/{name}", "locks:write"},
+	{"PUT /api/v1/locks/{name}", "locks:write"},
+	{"DELETE /api/v1/locks/{name}", "locks:write"},
+	{"GET /api/v1/admin/export", "backup:export"},
+	{"POST /api/v1/admin/import", "backup:import"},
+	{"/api/v1/admin/nodes/", "nodes:operate"},
+	{"GET /api/v1/admin/audit/verify", "audit:verify"},
+	{"GET /api/v1/rbac/roles", "rbac:read"},
+	{"GET /api/v1/rbac/assignments", "rbac:read"},
+	{"POST /api/v1/rbac/assignments", "rbac:admin"},
+	{"DELETE /api/v1/rbac/assignments/{id}", "rbac:admin"},
+}
+
+// Options configures an Enforcer.
+type Options struct {
+	// UserHeader and GroupsHeader carry the caller's identity, set by the
+	// authenticating proxy.
+	UserHeader   string
+	GroupsHeader string
+	// GroupRoles maps groups to the role their members have.
+	GroupRoles map[string]string
+	// Roles and Rules default to DefaultRoles and DefaultRules.
+	Roles []Role
+	Rules []Rule
+}
+
+// Enforcer decides which callers may use which routes.
+type Enforcer struct {
+	assignments store.RoleAssignmentRepository
+	headers     authz.Headers
+	groupRoles  map[string]string
+	roles       map[string]Role
+	// routes matches requests to rules; permissions holds each rule's
+	// permission by pattern
+	routes      *http.ServeMux
+	permissions map[string]string
+	logger      *zap.Logger
+}
+
+// New creates an enforcer reading assignments from repo. It fails if a
+// group maps to an unknown role or a rule's pattern is invalid.
+func New(repo store.RoleAssignmentRepository, opts Options, logger *zap.Logger) (*Enforcer, error) {
+	if opts.Roles == nil {
+		opts.Roles = DefaultRoles
+	}
+	if opts.Rules == nil {
+		opts.Rules = DefaultRules
+	}
+	e := &Enforcer{
+		assignments: repo,
+		headers:     authz.Headers{User: opts.UserHeader, Groups: opts.GroupsHeader},
+		groupRoles:  opts.GroupRoles,
+		roles:       make(map[string]Role, len(opts.Roles)),
+		routes:      http.NewServeMux(),
+		permissions: make(map[string]string, len(opts.Rules)),
+		logger:      logger,
+	}
+	for _, r := range opts.Roles {
+		e.roles[r.Name] = r
+	}
+	for group, role := range opts.GroupRoles {
+		if _, ok := e.roles[role]; !ok {
+			return nil, fmt.Errorf("group %q: unknown role %q", group, role)
+		}
+	}
+	for _, rule := range opts.Rules {
+		if err := e.addRule(rule); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// addRule registers rule, turning ServeMux's panics on invalid or
+// conflicting patterns into errors.
+func (e *Enforcer) addRule(rule Rule) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("rule %q: %v", rule.Pattern, p)
+		}
+	}()
+	e.routes.Handle(rule.Pattern, http.NotFoundHandler())
+	e.permissions[rule.Pattern] = rule.Permission
+	return nil
+}
+
+// Role returns the role named name.
+func (e *Enforcer) Role(name string) (Role, bool) {
+	r, ok := e.roles[name]
+	return r, ok
+}
+
+// Roles returns the roles by name.
+func (e *Enforcer) Roles() []Role {
+	out := make([]Role, 0, len(e.roles))
+	for _, r := range e.roles {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// RolesOf returns the names of id's roles, from its groups and from
+// assignments. Assignments of roles no longer defined are ignored.
+func (e *Enforcer) RolesOf(ctx context.Context, id authz.Identity) ([]string, error) {
+	var names []string
+	for _, g := range id.Groups {
+		if role, ok := e.groupRoles[g]; ok {
+			names = append(names, role)
+		}
+	}
+	assigned, err := e.assignments.ForIdentity(ctx, id.User, id.Groups)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range assigned {
+		if _, ok := e.roles[a.Role]; ok {
+			names = append(names, a.Role)
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names), nil
+}
+
+// Allowed reports whether one of id's roles grants perm.
+func (e *Enforcer) Allowed(ctx context.Context, id authz.Identity, perm string) (bool, error) {
+	names, err := e.RolesOf(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	for _, name := range names {
+		if e.roles[name].Grants(perm) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// PermissionsOf returns the permissions id's roles grant.
+func (e *Enforcer) PermissionsOf(ctx context.Context, id authz.Identity) ([]string, error) {
+	names, err := e.RolesOf(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	var perms []string
+	for _, name := range names {
+		perms = append(perms, e.roles[name].Permissions...)
+	}
+	return perms, nil
+}
+
+// Permission returns the permission r's route needs, and false when no
+// rule maps the route.
+func (e *Enforcer) Permission(r *http.Request) (string, bool) {
+	_, pattern := e.routes.Handler(r)
+	perm, ok := e.permissions[pattern]
+	return perm, ok
+}
+
+// Middleware refuses requests to mapped routes unless the caller's roles
+// grant the route's permission.
+func (e *Enforcer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		perm, ok := e.Permission(r)
+		if !ok || perm == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		id := e.headers.Identity(r)
+		if id.User == "" {
+			decisionsTotal.WithLabelValues("unauthenticated").Inc()
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		allowed, err := e.Allowed(r.Context(), id, perm)
+		if err != nil {
+			decisionsTotal.WithLabelValues("error").Inc()
+			e.logger.Error("failed to resolve roles", zap.String("user", id.User), zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			decisionsTotal.WithLabelValues("denied").Inc()
+			e.logger.Warn("request denied",
+				zap.String("audit", "rbac"),
+				zap.String("request_id", middleware.GetRequestID(r.Context())),
+				zap.String("user", id.User),
+				zap.Strings("groups", id.Groups),
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.String("permission", perm))
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		decisionsTotal.WithLabelValues("allowed").Inc()
+		next.ServeHTTP(w, r)
+	})
+}
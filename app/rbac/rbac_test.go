@@ -0,0 +1,123 @@
+package rbac
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+func newMux(t *testing.T, st *store.Store) http.Handler {
+	t.Helper()
+	e, err := New(st.Roles, Options{
+		UserHeader:   "X-Forwarded-User",
+		GroupsHeader: "X-Forwarded-Groups",
+		GroupRoles:   map[string]string{"platform-admins": "admin", "developers": "developer"},
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mux := http.NewServeMux()
+	e.Register(mux)
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	mux.HandleFunc("GET /api/v1/tenants/{id}", ok)
+	mux.HandleFunc("PUT /api/v1/tenants/{id}", ok)
+	mux.HandleFunc("GET /api/v1/jobs/templates", ok)
+	mux.HandleFunc("/graphql", ok)
+	mux.HandleFunc("GET /healthz", ok)
+	return e.Middleware(mux)
+}
+
+func do(h http.Handler, method, path, user, groups, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-Forwarded-User", user)
+	req.Header.Set("X-Forwarded-Groups", groups)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddleware(t *testing.T) {
+	h := newMux(t, store.NewMemory())
+	tests := []struct {
+		method, path, user, groups string
+		want                       int
+	}{
+		{http.MethodGet, "/api/v1/tenants/payments", "bob", "developers", http.StatusOK},
+		{http.MethodPut, "/api/v1/tenants/payments", "bob", "developers", http.StatusForbidden},
+		{http.MethodPut, "/api/v1/tenants/payments", "alice", "platform-admins", http.StatusOK},
+		{http.MethodGet, "/api/v1/tenants/payments", "", "", http.StatusUnauthorized},
+		{http.MethodGet, "/api/v1/tenants/payments", "carol", "", http.StatusForbidden},
+		{http.MethodPost, "/graphql", "carol", "", http.StatusForbidden},
+		{http.MethodPost, "/graphql", "", "", http.StatusUnauthorized},
+		{http.MethodPost, "/graphql", "bob", "developers", http.StatusOK},
+		// Exempt and unmapped routes are left to their handlers
+		{http.MethodGet, "/api/v1/jobs/templates", "carol", "", http.StatusOK},
+		{http.MethodGet, "/healthz", "", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if rec := do(h, tt.method, tt.path, tt.user, tt.groups, ""); rec.Code != tt.want {
+			t.Errorf("%s %s as %q %q: expected %d, got %d", tt.method, tt.path, tt.user, tt.groups, tt.want, rec.Code)
+		}
+	}
+
+	if _, err := New(store.NewMemory().Roles, Options{GroupRoles: map[string]string{"sre": "root"}}, zap.NewNop()); err == nil {
+		t.Error("expected an unknown role in the group mapping to be refused")
+	}
+	if _, err := New(store.NewMemory().Roles, Options{Rules: []Rule{{"GET /a/{x}", "a"}, {"GET /a/{y}", "b"}}}, zap.NewNop()); err == nil {
+		t.Error("expected conflicting rules to be refused")
+	}
+}
+
+func TestAssignments(t *testing.T) {
+	st := store.NewMemory()
+	h := newMux(t, st)
+
+	body := `{"subject_kind":"user","subject":"carol","role":"operator"}`
+	if rec := do(h, http.MethodPost, "/api/v1/rbac/assignments", "bob", "developers", body); rec.Code != http.StatusForbidden {
+		t.Errorf("expected developers to be refused, got %d", rec.Code)
+	}
+	rec := do(h, http.MethodPost, "/api/v1/rbac/assignments", "alice", "platform-admins", body)
+	var a store.RoleAssignment
+	json.NewDecoder(rec.Body).Decode(&a)
+	if rec.Code != http.StatusCreated || a.ID == "" || a.CreatedBy != "alice" {
+		t.Fatalf("expected the assignment created, got %d %+v", rec.Code, a)
+	}
+	if rec := do(h, http.MethodPost, "/api/v1/rbac/assignments", "alice", "platform-admins", body); rec.Code != http.StatusConflict {
+		t.Errorf("expected a duplicate assignment to conflict, got %d", rec.Code)
+	}
+	for _, bad := range []string{`{"subject_kind":"team","subject":"x","role":"viewer"}`, `{"subject_kind":"user","subject":"x","role":"root"}`} {
+		if rec := do(h, http.MethodPost, "/api/v1/rbac/assignments", "alice", "platform-admins", bad); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", bad, rec.Code)
+		}
+	}
+
+	// The assigned role takes effect on the next request
+	if rec := do(h, http.MethodPut, "/api/v1/tenants/payments", "carol", "", ""); rec.Code != http.StatusOK {
+		t.Errorf("expected the operator role to allow tenant writes, got %d", rec.Code)
+	}
+	rec = do(h, http.MethodGet, "/api/v1/rbac/me", "carol", "developers", "")
+	var me struct {
+		Roles       []string
+		Permissions []string
+	}
+	json.NewDecoder(rec.Body).Decode(&me)
+	if len(me.Roles) != 2 || me.Roles[0] != "developer" || me.Roles[1] != "operator" || len(me.Permissions) == 0 {
+		t.Errorf("expected roles from the group and the assignment, got %+v", me)
+	}
+
+	if rec := do(h, http.MethodDelete, "/api/v1/rbac/assignments/"+a.ID, "alice", "platform-admins", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	if rec := do(h, http.MethodPut, "/api/v1/tenants/payments", "carol", "", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("expected the removed role to stop applying, got %d", rec.Code)
+	}
+	if rec := do(h, http.MethodDelete, "/api/v1/rbac/assignments/"+a.ID, "alice", "platform-admins", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,328 @@
+// Package redact masks personal and sensitive data before the service keeps
+// or shows it: in audit records, the recent-event log, log lines and the
+// admin debug endpoints. What is masked is decided by rules, from a JSON
+// policy file that is re-read while the service runs:
+//
+//	{"rules": [
+//	  {"name": "secret", "fields": ["password", "*_secret"]},
+//	  {"name": "email", "pattern": "[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\\.[A-Za-z]{2,}"}
+//	]}
+//
+// A rule with fields masks the whole value of fields with matching names; a
+// rule with a pattern masks its matches wherever they occur.
+package redact
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+var (
+	redactionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "redactions_total",
+		Help: "Values masked by rule.",
+	}, []string{"rule"})
+	reloadsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "redaction_policy_reloads_total",
+		Help: "Redaction policy reloads by result.",
+	}, []string{"result"})
+)
+
+// Rule masks one kind of data.
+type Rule struct {
+	Name string `json:"name"`
+	// Fields are the names of fields whose whole value is masked, as
+	// path.Match patterns matched case-insensitively, e.g. "*_token".
+	Fields []string `json:"fields,omitempty"`
+	// Pattern is a regular expression whose matches are masked in any
+	// value.
+	Pattern string `json:"pattern,omitempty"`
+	// Replacement replaces what the rule masks; "[REDACTED:<name>]" when
+	// empty.
+	Replacement string `json:"replacement,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// Policy is the content of a policy file.
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// DefaultRules apply without a policy file: secrets in conventionally named
+// fields, and bearer tokens, JWTs and the platform's own tokens anywhere.
+// Emails and IP addresses are only masked by policy.
+var DefaultRules = []Rule{
+	{Name: "secret", Fields: []string{
+		"password", "secret", "token", "access_token", "refresh_token", "id_token", "client_secret",
+		"api_key", "authorization", "cookie", "set-cookie",
+	}},
+	{Name: "token", Pattern: `(?i)\bbearer\s+[A-Za-z0-9._~+/-]+=*` +
+		`|\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*` +
+		`|\b(?:plt|whsec|ghp|gho|ghs|github_pat)_[A-Za-z0-9_]+`},
+}
+
+// compile checks rules and prepares them for use.
+func compile(rules []Rule) ([]Rule, error) {
+	out := make([]Rule, 0, len(rules))
+	names := map[string]bool{}
+	for _, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("redaction rule without a name")
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("redaction rule %q is defined twice", rule.Name)
+		}
+		names[rule.Name] = true
+		if len(rule.Fields) == 0 && rule.Pattern == "" {
+			return nil, fmt.Errorf("redaction rule %q needs fields or a pattern", rule.Name)
+		}
+		for i, field := range rule.Fields {
+			if _, err := path.Match(field, ""); err != nil {
+				return nil, fmt.Errorf("redaction rule %q: invalid field %q", rule.Name, field)
+			}
+			rule.Fields[i] = strings.ToLower(field)
+		}
+		if rule.Pattern != "" {
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("redaction rule %q: %w", rule.Name, err)
+			}
+			rule.re = re
+		}
+		if rule.Replacement == "" {
+			rule.Replacement = "[REDACTED:" + rule.Name + "]"
+		}
+		out = append(out, rule)
+	}
+	return out, nil
+}
+
+// Redactor applies the rules in force.
+type Redactor struct {
+	file   string
+	logger *zap.Logger
+
+	mu    sync.RWMutex
+	rules []Rule
+	raw   []byte
+}
+
+// New creates a redactor with the rules in file, or DefaultRules when file
+// is empty. It fails if the file cannot be read or holds invalid rules, so a
+// misconfigured pod never starts.
+func New(file string, logger *zap.Logger) (*Redactor, error) {
+	r := &Redactor{file: file, logger: logger}
+	if file == "" {
+		rules, err := compile(clone(DefaultRules))
+		if err != nil {
+			return nil, err
+		}
+		r.rules = rules
+		return r, nil
+	}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func clone(rules []Rule) []Rule {
+	out := make([]Rule, len(rules))
+	for i, rule := range rules {
+		rule.Fields = append([]string(nil), rule.Fields...)
+		out[i] = rule
+	}
+	return out
+}
+
+// Rules returns the rules in force.
+func (r *Redactor) Rules() []Rule {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rules
+}
+
+// Watch polls the policy file until ctx is cancelled, applying its rules
+// when it changes. An invalid file is logged and the previous rules stay in
+// force.
+func (r *Redactor) Watch(ctx context.Context, interval time.Duration) {
+	if r.file == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := r.reload()
+			switch {
+			case err != nil:
+				reloadsTotal.WithLabelValues("error").Inc()
+				r.logger.Error("redaction policy reload failed, keeping previous rules",
+					zap.String("file", r.file), zap.Error(err))
+			case changed:
+				reloadsTotal.WithLabelValues("success").Inc()
+			}
+		}
+	}
+}
+
+// reload re-reads the policy file and swaps the rules if it changed.
+func (r *Redactor) reload() (bool, error) {
+	raw, err := os.ReadFile(r.file)
+	if err != nil {
+		return false, fmt.Errorf("read redaction policy: %w", err)
+	}
+	r.mu.RLock()
+	unchanged := bytes.Equal(raw, r.raw)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	var p Policy
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return false, fmt.Errorf("parse redaction policy: %w", err)
+	}
+	rules, err := compile(p.Rules)
+	if err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	r.rules, r.raw = rules, raw
+	r.mu.Unlock()
+	names := make([]string, len(rules))
+	for i, rule := range rules {
+		names[i] = rule.Name
+	}
+	r.logger.Info("redaction policy loaded", zap.String("file", r.file), zap.Strings("rules", names))
+	return true, nil
+}
+
+// String masks the matches of pattern rules in s.
+func (r *Redactor) String(s string) string {
+	for _, rule := range r.Rules() {
+		if rule.re == nil {
+			continue
+		}
+		n := 0
+		s = rule.re.ReplaceAllStringFunc(s, func(string) string {
+			n++
+			return rule.Replacement
+		})
+		if n > 0 {
+			redactionsTotal.WithLabelValues(rule.Name).Add(float64(n))
+		}
+	}
+	return s
+}
+
+// Field masks value as the value of the field name: wholly if a field rule
+// matches name, and by String otherwise.
+func (r *Redactor) Field(name, value string) string {
+	if rule, ok := r.fieldRule(name); ok {
+		if value == "" {
+			return value
+		}
+		redactionsTotal.WithLabelValues(rule.Name).Inc()
+		return rule.Replacement
+	}
+	return r.String(value)
+}
+
+func (r *Redactor) fieldRule(name string) (Rule, bool) {
+	name = strings.ToLower(name)
+	for _, rule := range r.Rules() {
+		for _, field := range rule.Fields {
+			if ok, _ := path.Match(field, name); ok {
+				return rule, true
+			}
+		}
+	}
+	return Rule{}, false
+}
+
+// Map returns a copy of m with its values masked by Field.
+func (r *Redactor) Map(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = r.Field(k, v)
+	}
+	return out
+}
+
+// JSON returns data with the strings in it masked: values of object members
+// by Field, the others by String. Data that is not JSON is masked as text.
+func (r *Redactor) JSON(data []byte) []byte {
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return []byte(r.String(string(data)))
+	}
+	out, err := json.Marshal(r.value("", v))
+	if err != nil {
+		return []byte(r.String(string(data)))
+	}
+	return out
+}
+
+func (r *Redactor) value(field string, v any) any {
+	switch v := v.(type) {
+	case string:
+		if field != "" {
+			return r.Field(field, v)
+		}
+		return r.String(v)
+	case map[string]any:
+		for k, member := range v {
+			if _, ok := r.fieldRule(k); ok && member != nil {
+				if _, isString := member.(string); !isString {
+					// Secrets held as objects or numbers go whole
+					member = fmt.Sprint(member)
+				}
+			}
+			v[k] = r.value(k, member)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = r.value(field, item)
+		}
+		return v
+	}
+	return v
+}
+
+// text matches name=value pairs, as in command lines and query strings.
+var text = regexp.MustCompile(`([A-Za-z0-9_.-]+)=([^\s&\x00]*)`)
+
+// Text masks free text: the values of name=value pairs by Field, and the
+// rest by String.
+func (r *Redactor) Text(s string) string {
+	s = text.ReplaceAllStringFunc(s, func(pair string) string {
+		name, value, _ := strings.Cut(pair, "=")
+		if _, ok := r.fieldRule(strings.TrimLeft(name, "-")); ok {
+			return name + "=" + r.Field(strings.TrimLeft(name, "-"), value)
+		}
+		return pair
+	})
+	return r.String(s)
+}
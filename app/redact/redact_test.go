@@ -0,0 +1,115 @@
+package redact
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+func TestRedactor(t *testing.T) {
+	r, err := New("", zap.NewNop())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The default rules mask secrets, but not emails or addresses
+	got := r.Map(map[string]string{
+		"Password": "hunter2",
+		"note":     "called with Bearer abc.def and plt_0123abcd",
+		"user":     "alice@example.com",
+		"ip":       "10.0.0.7",
+	})
+	want := map[string]string{
+		"Password": "[REDACTED:secret]",
+		"note":     "called with [REDACTED:token] and [REDACTED:token]",
+		"user":     "alice@example.com",
+		"ip":       "10.0.0.7",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+	if out := string(r.JSON([]byte(`{"commits":[{"token":{"v":1},"message":"ghp_abc"}],"n":12345678901234567890}`))); out !=
+		`{"commits":[{"message":"[REDACTED:token]","token":"[REDACTED:secret]"}],"n":12345678901234567890}` {
+		t.Errorf("JSON = %s", out)
+	}
+
+	// Audit records are stored masked
+	st := store.NewMemory()
+	audit := r.AuditRepository(st.Audit)
+	if err := audit.Record(t.Context(), &store.AuditEvent{Actor: "alice", Action: "login", Details: map[string]string{"id_token": "eyJx.eyJy.z"}}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	if events, _ := st.Audit.List(t.Context(), store.AuditFilter{}); len(events) != 1 || events[0].Details["id_token"] != "[REDACTED:secret]" {
+		t.Errorf("audit = %+v", events)
+	}
+
+	// Log lines are masked, fields by name and errors as text
+	var buf bytes.Buffer
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&buf), zapcore.DebugLevel)
+	logger := zap.New(r.WrapCore(core)).With(zap.String("authorization", "Basic YWxpY2U6cHc="))
+	logger.Info("token whsec_abc rejected", zap.Error(errors.New("bad Bearer xyz")))
+	if line := buf.String(); strings.Contains(line, "YWxpY2U6cHc") || strings.Contains(line, "whsec_abc") || strings.Contains(line, "xyz") {
+		t.Errorf("log line not masked: %s", line)
+	}
+
+	// Debug endpoints are masked as text
+	h := r.Debug(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("platform-api\x00--client_secret=s3cr3t\x00--port=8080"))
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pprof/cmdline", nil))
+	if rec.Body.String() != "platform-api\x00--client_secret=[REDACTED:secret]\x00--port=8080" {
+		t.Errorf("cmdline = %q", rec.Body)
+	}
+}
+
+func TestPolicyReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.json")
+	write := func(policy string) {
+		if err := os.WriteFile(file, []byte(policy), 0o600); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	write(`{"rules":[{"name":"email","pattern":"[a-z]+@[a-z.]+","replacement":"<email>"}]}`)
+	r, err := New(file, zap.NewNop())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if got := r.String("from alice@example.com at 10.0.0.7"); got != "from <email> at 10.0.0.7" {
+		t.Errorf("String = %q", got)
+	}
+
+	write(`{"rules":[{"name":"ip","pattern":"\\b\\d{1,3}(\\.\\d{1,3}){3}\\b"}]}`)
+	if changed, err := r.reload(); !changed || err != nil {
+		t.Fatalf("reload = %v, %v", changed, err)
+	}
+	if got := r.String("from alice@example.com at 10.0.0.7"); got != "from alice@example.com at [REDACTED:ip]" {
+		t.Errorf("String after reload = %q", got)
+	}
+
+	// An invalid policy leaves the rules in force
+	for _, policy := range []string{`{"rules":[{"name":"x","pattern":"("}]}`, `{"rules":[{"name":"x"}]}`, `not json`} {
+		write(policy)
+		if _, err := r.reload(); err == nil {
+			t.Errorf("reload accepted %s", policy)
+		}
+	}
+	if rules := r.Rules(); len(rules) != 1 || rules[0].Name != "ip" {
+		t.Errorf("rules = %+v", rules)
+	}
+	if _, err := New(file, zap.NewNop()); err == nil {
+		t.Error("New accepted an invalid policy")
+	}
+}
@@ -0,0 +1,117 @@
+package redact
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+// Event returns e with its data masked by JSON.
+func (r *Redactor) Event(e events.Event) events.Event {
+	if len(e.Data) > 0 {
+		e.Data = r.JSON(e.Data)
+	}
+	return e
+}
+
+// Events returns a bus handler passing events to h masked, e.g. to keep
+// them in the recent-event log.
+func (r *Redactor) Events(h events.Handler) events.Handler {
+	return func(ctx context.Context, e events.Event) {
+		h(ctx, r.Event(e))
+	}
+}
+
+// AuditRepository wraps inner so audit events are recorded with their
+// details masked. The hash chain covers the masked event.
+func (r *Redactor) AuditRepository(inner store.AuditRepository) store.AuditRepository {
+	return &auditRepository{AuditRepository: inner, redactor: r}
+}
+
+type auditRepository struct {
+	store.AuditRepository
+	redactor *Redactor
+}
+
+func (a *auditRepository) Record(ctx context.Context, e *store.AuditEvent) error {
+	e.Details = a.redactor.Map(e.Details)
+	return a.AuditRepository.Record(ctx, e)
+}
+
+// WrapCore masks log entries written through core: messages by String and
+// string fields by Field. Use it with zap.WrapCore.
+func (r *Redactor) WrapCore(core zapcore.Core) zapcore.Core {
+	return &logCore{Core: core, redactor: r}
+}
+
+type logCore struct {
+	zapcore.Core
+	redactor *Redactor
+}
+
+func (c *logCore) With(fields []zapcore.Field) zapcore.Core {
+	return &logCore{Core: c.Core.With(c.fields(fields)), redactor: c.redactor}
+}
+
+func (c *logCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *logCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = c.redactor.String(ent.Message)
+	return c.Core.Write(ent, c.fields(fields))
+}
+
+func (c *logCore) fields(fields []zapcore.Field) []zapcore.Field {
+	out := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		switch f.Type {
+		case zapcore.StringType:
+			f.String = c.redactor.Field(f.Key, f.String)
+		case zapcore.ErrorType:
+			if err, ok := f.Interface.(error); ok && err != nil {
+				f = zap.String(f.Key, c.redactor.String(err.Error()))
+			}
+		}
+		out[i] = f
+	}
+	return out
+}
+
+// Debug serves h with its text response masked by Text, for debug
+// endpoints such as /debug/pprof/cmdline.
+func (r *Redactor) Debug(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rec := &bufferedWriter{header: http.Header{}, status: http.StatusOK}
+		h.ServeHTTP(rec, req)
+		body := []byte(r.Text(rec.body.String()))
+		for k, v := range rec.header {
+			w.Header()[k] = v
+		}
+		w.Header().Del("Content-Length")
+		w.WriteHeader(rec.status)
+		w.Write(body)
+	})
+}
+
+// bufferedWriter holds a response until it is masked.
+type bufferedWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedWriter) Header() http.Header { return b.header }
+
+func (b *bufferedWriter) WriteHeader(status int) { b.status = status }
+
+func (b *bufferedWriter) Write(p []byte) (int, error) { return b.body.Write(p) }
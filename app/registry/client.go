@@ -0,0 +1,412 @@
+// Package registry talks to the OCI registries (Harbor, ECR or any
+// distribution-spec registry) that cluster workloads pull from: it lists
+// repository tags, resolves tags to digests and fetches vulnerability scan
+// summaries, and serves them for the images referenced by workloads.
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+)
+
+// Registry kinds. Every kind serves the distribution API; the kind decides
+// where vulnerability scan results come from.
+const (
+	KindOCI    = "oci"
+	KindHarbor = "harbor"
+	KindECR    = "ecr"
+)
+
+var (
+	// ErrNotFound is returned for unknown repositories, tags or digests.
+	ErrNotFound = errs.New(errs.NotFound, "not found")
+	// ErrUnsupported is returned for registries that are not configured.
+	ErrUnsupported = errors.New("registry not configured")
+)
+
+// manifestTypes are accepted when resolving a tag, so multi-arch images
+// resolve to their index digest as the runtime records it.
+var manifestTypes = strings.Join([]string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}, ", ")
+
+// APIError is a non-2xx response from a registry.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("registry: status %d: %s", e.StatusCode, e.Message)
+}
+
+// Client calls the configured registries. Credentials come from a
+// dockerconfigjson file (the format of image pull secrets), so the same
+// secret the kubelet uses can be mounted here. ECR registries missing from
+// the file are authorized with the AWS SDK's default credentials.
+type Client struct {
+	kinds     map[string]string
+	credsFile string
+	http      *http.Client
+	// ecr calls the ECR API; nil when no ECR registry is configured
+	ecr *ecrClient
+
+	mu     sync.Mutex
+	creds  map[string]string
+	tokens map[string]token
+}
+
+type token struct {
+	value   string
+	expires time.Time
+}
+
+// NewClient creates a client for registries (host → kind). credentialsFile
+// may be empty for anonymous access.
+func NewClient(registries map[string]string, credentialsFile string, hc *http.Client) (*Client, error) {
+	c := &Client{
+		kinds:     make(map[string]string, len(registries)),
+		credsFile: credentialsFile,
+		http:      hc,
+		tokens:    make(map[string]token),
+	}
+	for host, kind := range registries {
+		switch kind {
+		case KindOCI, KindHarbor:
+		case KindECR:
+			if c.ecr == nil {
+				e, err := newECRClient(context.Background(), hc)
+				if err != nil {
+					return nil, err
+				}
+				c.ecr = e
+			}
+		default:
+			return nil, fmt.Errorf("registry %s: unknown kind %q", host, kind)
+		}
+		c.kinds[host] = kind
+	}
+	if err := c.ReloadCredentials(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Supports reports whether host is a configured registry.
+func (c *Client) Supports(host string) bool {
+	_, ok := c.kinds[host]
+	return ok
+}
+
+// ReloadCredentials re-reads the credentials file. Short-lived passwords
+// kept there are rotated by rewriting the file.
+func (c *Client) ReloadCredentials() error {
+	creds := make(map[string]string)
+	if c.credsFile != "" {
+		data, err := os.ReadFile(c.credsFile)
+		if err != nil {
+			return fmt.Errorf("read registry credentials: %w", err)
+		}
+		var cfg struct {
+			Auths map[string]struct {
+				Auth     string `json:"auth"`
+				Username string `json:"username"`
+				Password string `json:"password"`
+			} `json:"auths"`
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return fmt.Errorf("parse registry credentials: %w", err)
+		}
+		for host, a := range cfg.Auths {
+			auth := a.Auth
+			if auth == "" && a.Username != "" {
+				auth = base64.StdEncoding.EncodeToString([]byte(a.Username + ":" + a.Password))
+			}
+			// Keys may be URLs ("https://index.docker.io/v1/")
+			if u, err := url.Parse(host); err == nil && u.Host != "" {
+				host = u.Host
+			}
+			if host == "index.docker.io" {
+				host = dockerHub
+			}
+			creds[host] = auth
+		}
+	}
+	c.mu.Lock()
+	c.creds = creds
+	c.tokens = make(map[string]token)
+	c.mu.Unlock()
+	return nil
+}
+
+// Tags lists the tags of ref's repository, following pagination.
+func (c *Client) Tags(ctx context.Context, ref Reference) ([]string, error) {
+	if !c.Supports(ref.Registry) {
+		return nil, ErrUnsupported
+	}
+	var tags []string
+	next := "/v2/" + ref.Repository + "/tags/list?n=1000"
+	for next != "" {
+		resp, err := c.get(ctx, ref, next, "application/json")
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decode tags: %w", err)
+		}
+		tags = append(tags, page.Tags...)
+		next = nextLink(resp.Header.Get("Link"))
+	}
+	return tags, nil
+}
+
+// Digest resolves ref to the digest of its manifest (or index).
+func (c *Client) Digest(ctx context.Context, ref Reference) (string, error) {
+	if !c.Supports(ref.Registry) {
+		return "", ErrUnsupported
+	}
+	resp, err := c.request(ctx, ref, http.MethodHead, "/v2/"+ref.Repository+"/manifests/"+ref.Ref(), manifestTypes)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if d := resp.Header.Get("Docker-Content-Digest"); d != "" {
+		return d, nil
+	}
+	// Digest references are their own digest
+	if ref.Digest != "" {
+		return ref.Digest, nil
+	}
+	return "", errors.New("registry did not return a digest")
+}
+
+// Scan returns the vulnerability scan summary of digest in ref's
+// repository, or nil if the registry kind does not report scans.
+func (c *Client) Scan(ctx context.Context, ref Reference, digest string) (*ScanSummary, error) {
+	switch c.kinds[ref.Registry] {
+	case KindHarbor:
+		return c.harborScan(ctx, ref, digest)
+	case KindECR:
+		return c.ecr.scan(ctx, ref, digest)
+	case KindOCI:
+		return nil, nil
+	default:
+		return nil, ErrUnsupported
+	}
+}
+
+func (c *Client) get(ctx context.Context, ref Reference, path, accept string) (*http.Response, error) {
+	return c.request(ctx, ref, http.MethodGet, path, accept)
+}
+
+// request calls the distribution API, answering a bearer token challenge
+// once per scope.
+func (c *Client) request(ctx context.Context, ref Reference, method, path, accept string) (*http.Response, error) {
+	scope := "repository:" + ref.Repository + ":pull"
+	base := "https://" + apiHost(ref.Registry)
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, base+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", accept)
+		if err := c.authorize(req, ref.Registry, scope); err != nil {
+			return nil, err
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			challenge := resp.Header.Get("WWW-Authenticate")
+			resp.Body.Close()
+			if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+				return nil, &APIError{StatusCode: http.StatusUnauthorized, Message: "unauthorized"}
+			}
+			if err := c.fetchToken(ctx, ref.Registry, scope, challenge); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := checkResponse(resp); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+}
+
+func (c *Client) authorize(req *http.Request, host, scope string) error {
+	c.mu.Lock()
+	t, ok := c.tokens[host+" "+scope]
+	c.mu.Unlock()
+	if ok && time.Now().Before(t.expires) {
+		req.Header.Set("Authorization", "Bearer "+t.value)
+		return nil
+	}
+	auth, err := c.basicAuth(req.Context(), host)
+	if err != nil {
+		return err
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", "Basic "+auth)
+	}
+	return nil
+}
+
+// basicAuth returns host's base64 basic credentials: from the credentials
+// file, or from the ECR API for ECR registries missing there.
+func (c *Client) basicAuth(ctx context.Context, host string) (string, error) {
+	c.mu.Lock()
+	auth := c.creds[host]
+	c.mu.Unlock()
+	if auth != "" || c.kinds[host] != KindECR {
+		return auth, nil
+	}
+	return c.ecr.authorization(ctx, host)
+}
+
+// fetchToken runs the registry token flow for challenge (a WWW-Authenticate
+// header) and caches the token for host and scope.
+func (c *Client) fetchToken(ctx context.Context, host, scope, challenge string) error {
+	params := parseChallenge(challenge)
+	realm := params["realm"]
+	if realm == "" {
+		return errors.New("registry: bearer challenge without realm")
+	}
+	q := url.Values{}
+	if s := params["service"]; s != "" {
+		q.Set("service", s)
+	}
+	q.Set("scope", scope)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm+"?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	auth, err := c.basicAuth(ctx, host)
+	if err != nil {
+		return err
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", "Basic "+auth)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("decode registry token: %w", err)
+	}
+	t := token{value: body.Token, expires: time.Now().Add(60 * time.Second)}
+	if t.value == "" {
+		t.value = body.AccessToken
+	}
+	if body.ExpiresIn > 0 {
+		t.expires = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	}
+	// Renew a little early so a request never carries an expired token
+	t.expires = t.expires.Add(-5 * time.Second)
+
+	c.mu.Lock()
+	c.tokens[host+" "+scope] = t
+	c.mu.Unlock()
+	return nil
+}
+
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	// Distribution errors: {"errors":[{"code":"...","message":"..."}]}
+	var body struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	msg := strings.TrimSpace(string(raw))
+	if json.Unmarshal(raw, &body) == nil && len(body.Errors) > 0 {
+		msg = body.Errors[0].Message
+	}
+	return &APIError{StatusCode: resp.StatusCode, Message: msg}
+}
+
+// apiHost maps Docker Hub's image host to its API host.
+func apiHost(registry string) string {
+	if registry == dockerHub {
+		return "registry-1.docker.io"
+	}
+	return registry
+}
+
+// parseChallenge splits `Bearer realm="...",scope="a,b"` into parameters;
+// commas inside quotes do not separate them.
+func parseChallenge(h string) map[string]string {
+	params := make(map[string]string)
+	_, rest, _ := strings.Cut(h, " ")
+	for rest != "" {
+		k, v, ok := strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		if !ok {
+			break
+		}
+		if strings.HasPrefix(v, `"`) {
+			end := strings.Index(v[1:], `"`)
+			if end < 0 {
+				break
+			}
+			params[strings.ToLower(k)] = v[1 : end+1]
+			rest = v[end+2:]
+			continue
+		}
+		v, rest, _ = strings.Cut(v, ",")
+		params[strings.ToLower(k)] = strings.TrimSpace(v)
+	}
+	return params
+}
+
+// nextLink extracts the path from a `<...>; rel="next"` Link header.
+func nextLink(h string) string {
+	target, params, ok := strings.Cut(h, ";")
+	if !ok || !strings.Contains(params, `rel="next"`) {
+		return ""
+	}
+	target = strings.Trim(strings.TrimSpace(target), "<>")
+	if u, err := url.Parse(target); err == nil && u.IsAbs() {
+		return u.RequestURI()
+	}
+	return target
+}
@@ -0,0 +1,157 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrtypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+)
+
+// ecrClient calls the ECR API: scan findings, and authorization tokens
+// for the registry endpoint when the credentials file has none. It uses
+// the AWS SDK's default credential chain (environment, shared config,
+// web identity for IRSA, or the instance role), as the AWS CLI does.
+type ecrClient struct {
+	cfg aws.Config
+	// endpoint overrides the API URL; set in tests
+	endpoint string
+
+	mu      sync.Mutex
+	clients map[string]*ecr.Client
+	// tokens caches registry authorizations by registry host
+	tokens map[string]token
+}
+
+func newECRClient(ctx context.Context, hc *http.Client) (*ecrClient, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithHTTPClient(hc))
+	if err != nil {
+		return nil, fmt.Errorf("ecr: load AWS configuration: %w", err)
+	}
+	return &ecrClient{cfg: cfg, clients: make(map[string]*ecr.Client), tokens: make(map[string]token)}, nil
+}
+
+// ecrHost splits an ECR registry host, <account>.dkr.ecr.<region>.amazonaws.com,
+// into its account and region.
+func ecrHost(host string) (account, region string, err error) {
+	parts := strings.Split(host, ".")
+	if len(parts) < 6 || parts[1] != "dkr" || parts[2] != "ecr" {
+		return "", "", fmt.Errorf("%s is not an ECR registry host", host)
+	}
+	return parts[0], parts[3], nil
+}
+
+// client returns the API client for region.
+func (e *ecrClient) client(region string) *ecr.Client {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	c, ok := e.clients[region]
+	if !ok {
+		c = ecr.NewFromConfig(e.cfg, func(o *ecr.Options) {
+			o.Region = region
+			if e.endpoint != "" {
+				o.BaseEndpoint = aws.String(e.endpoint)
+			}
+		})
+		e.clients[region] = c
+	}
+	return c
+}
+
+// scan calls DescribeImageScanFindings for digest; ScanNotFoundException
+// means the image was never scanned.
+func (e *ecrClient) scan(ctx context.Context, ref Reference, digest string) (*ScanSummary, error) {
+	account, region, err := ecrHost(ref.Registry)
+	if err != nil {
+		return nil, err
+	}
+	out, err := e.client(region).DescribeImageScanFindings(ctx, &ecr.DescribeImageScanFindingsInput{
+		RegistryId:     aws.String(account),
+		RepositoryName: aws.String(ref.Repository),
+		ImageId:        &ecrtypes.ImageIdentifier{ImageDigest: aws.String(digest)},
+	})
+	var notScanned *ecrtypes.ScanNotFoundException
+	var notFound *ecrtypes.ImageNotFoundException
+	switch {
+	case errors.As(err, &notScanned):
+		return &ScanSummary{Status: ScanNotScanned}, nil
+	case errors.As(err, &notFound):
+		return nil, ErrNotFound
+	case err != nil:
+		return nil, fmt.Errorf("ecr: describe scan findings: %w", err)
+	}
+
+	s := &ScanSummary{Status: ScanNotScanned}
+	if out.ImageScanStatus != nil {
+		s.Status = ecrStatus(string(out.ImageScanStatus.Status))
+	}
+	if f := out.ImageScanFindings; f != nil {
+		if f.ImageScanCompletedAt != nil {
+			t := f.ImageScanCompletedAt.UTC()
+			s.ScannedAt = &t
+		}
+		if len(f.FindingSeverityCounts) > 0 {
+			s.Counts = make(map[string]int, len(f.FindingSeverityCounts))
+			for sev, n := range f.FindingSeverityCounts {
+				s.Counts[strings.ToLower(sev)] = int(n)
+			}
+		}
+	}
+	s.summarize()
+	return s, nil
+}
+
+func ecrStatus(s string) string {
+	switch s {
+	case "COMPLETE", "ACTIVE":
+		return ScanComplete
+	case "IN_PROGRESS", "PENDING":
+		return ScanPending
+	case "FAILED", "UNSUPPORTED_IMAGE", "FINDINGS_UNAVAILABLE":
+		return ScanFailed
+	default:
+		return ScanNotScanned
+	}
+}
+
+// authorization returns the base64 basic credentials for the registry
+// endpoint of host from GetAuthorizationToken, cached until shortly before
+// they expire (tokens last 12 hours).
+func (e *ecrClient) authorization(ctx context.Context, host string) (string, error) {
+	e.mu.Lock()
+	t, ok := e.tokens[host]
+	e.mu.Unlock()
+	if ok && time.Now().Before(t.expires) {
+		return t.value, nil
+	}
+
+	account, region, err := ecrHost(host)
+	if err != nil {
+		return "", err
+	}
+	out, err := e.client(region).GetAuthorizationToken(ctx, &ecr.GetAuthorizationTokenInput{
+		RegistryIds: []string{account},
+	})
+	if err != nil {
+		return "", fmt.Errorf("ecr: get authorization token: %w", err)
+	}
+	if len(out.AuthorizationData) == 0 || out.AuthorizationData[0].AuthorizationToken == nil {
+		return "", errors.New("ecr: no authorization token returned")
+	}
+	data := out.AuthorizationData[0]
+	t = token{value: *data.AuthorizationToken, expires: time.Now().Add(time.Hour)}
+	if data.ExpiresAt != nil {
+		t.expires = data.ExpiresAt.Add(-5 * time.Minute)
+	}
+	e.mu.Lock()
+	e.tokens[host] = t
+	e.mu.Unlock()
+	return t.value, nil
+}
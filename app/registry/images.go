@@ -0,0 +1,305 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+)
+
+// refreshConcurrency bounds parallel registry calls during a refresh.
+const refreshConcurrency = 4
+
+// Image is one image referenced by workloads, with what its registry
+// reports about it.
+type Image struct {
+	Image     string    `json:"image"`
+	Reference Reference `json:"reference"`
+	// Workloads are "Kind namespace/name" entries using the image.
+	Workloads []string `json:"workloads"`
+	// Supported is false for registries that are not configured; nothing
+	// below is reported for them.
+	Supported bool         `json:"supported"`
+	Digest    string       `json:"digest,omitempty"`
+	Scan      *ScanSummary `json:"scan,omitempty"`
+	Error     string       `json:"error,omitempty"`
+	CheckedAt *time.Time   `json:"checked_at,omitempty"`
+}
+
+type details struct {
+	digest    string
+	scan      *ScanSummary
+	err       error
+	checkedAt time.Time
+}
+
+func (d details) errString() string {
+	if d.err == nil {
+		return ""
+	}
+	return d.err.Error()
+}
+
+// Inventory tracks the images referenced by Deployments, StatefulSets and
+// DaemonSets and periodically resolves them against their registries.
+type Inventory struct {
+	client       *Client
+	deployments  appslisters.DeploymentLister
+	statefulSets appslisters.StatefulSetLister
+	daemonSets   appslisters.DaemonSetLister
+	allowed      map[string]bool
+	logger       *zap.Logger
+
+	mu    sync.RWMutex
+	cache map[string]details
+}
+
+// New registers the workload informers on factory; the factory must be
+// started afterwards. An empty namespaces list allows all namespaces.
+func New(factory informers.SharedInformerFactory, client *Client, namespaces []string, logger *zap.Logger) *Inventory {
+	inv := &Inventory{
+		client:       client,
+		deployments:  factory.Apps().V1().Deployments().Lister(),
+		statefulSets: factory.Apps().V1().StatefulSets().Lister(),
+		daemonSets:   factory.Apps().V1().DaemonSets().Lister(),
+		logger:       logger,
+		cache:        make(map[string]details),
+	}
+	if len(namespaces) > 0 {
+		inv.allowed = make(map[string]bool, len(namespaces))
+		for _, ns := range namespaces {
+			inv.allowed[ns] = true
+		}
+	}
+	return inv
+}
+
+// Run refreshes registry details every interval until ctx is cancelled.
+func (inv *Inventory) Run(ctx context.Context, interval time.Duration) {
+	inv.Refresh(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			inv.Refresh(ctx)
+		}
+	}
+}
+
+// Refresh re-reads registry credentials and resolves the digest and scan
+// summary of every referenced image in a configured registry. Images no
+// longer referenced are forgotten.
+func (inv *Inventory) Refresh(ctx context.Context) {
+	if err := inv.client.ReloadCredentials(); err != nil {
+		inv.logger.Warn("failed to reload registry credentials", zap.Error(err))
+	}
+
+	var refs []string
+	for image := range inv.referenced("") {
+		refs = append(refs, image)
+	}
+
+	results := make(map[string]details, len(refs))
+	var (
+		resultsMu sync.Mutex
+		wg        sync.WaitGroup
+		sem       = make(chan struct{}, refreshConcurrency)
+	)
+	for _, image := range refs {
+		ref, err := ParseReference(image)
+		if err != nil || !inv.client.Supports(ref.Registry) {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			d := inv.resolve(ctx, ref)
+			resultsMu.Lock()
+			results[image] = d
+			resultsMu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	inv.mu.Lock()
+	inv.cache = results
+	inv.mu.Unlock()
+}
+
+func (inv *Inventory) resolve(ctx context.Context, ref Reference) details {
+	d := details{checkedAt: time.Now().UTC()}
+	digest, err := inv.client.Digest(ctx, ref)
+	if err != nil {
+		d.err = err
+		inv.logger.Warn("failed to resolve image digest", zap.String("image", ref.String()), zap.Error(err))
+		return d
+	}
+	d.digest = digest
+	if d.scan, err = inv.client.Scan(ctx, ref, digest); err != nil {
+		d.err = err
+		inv.logger.Warn("failed to fetch image scan", zap.String("image", ref.String()), zap.Error(err))
+	}
+	return d
+}
+
+// referenced maps each image used in the allowed namespaces (or only in
+// namespace, if set) to the workloads using it.
+func (inv *Inventory) referenced(namespace string) map[string][]string {
+	out := make(map[string][]string)
+	add := func(kind, ns, name string, spec corev1.PodSpec) {
+		if (namespace != "" && ns != namespace) || (inv.allowed != nil && !inv.allowed[ns]) {
+			return
+		}
+		for _, c := range slices.Concat(spec.InitContainers, spec.Containers) {
+			w := kind + " " + ns + "/" + name
+			if !slices.Contains(out[c.Image], w) {
+				out[c.Image] = append(out[c.Image], w)
+			}
+		}
+	}
+	if items, err := inv.deployments.List(labels.Everything()); err == nil {
+		for _, d := range items {
+			add("Deployment", d.Namespace, d.Name, d.Spec.Template.Spec)
+		}
+	}
+	if items, err := inv.statefulSets.List(labels.Everything()); err == nil {
+		for _, s := range items {
+			add("StatefulSet", s.Namespace, s.Name, s.Spec.Template.Spec)
+		}
+	}
+	if items, err := inv.daemonSets.List(labels.Everything()); err == nil {
+		for _, d := range items {
+			add("DaemonSet", d.Namespace, d.Name, d.Spec.Template.Spec)
+		}
+	}
+	return out
+}
+
+// Register mounts the image endpoints on mux.
+func (inv *Inventory) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/images", inv.list)
+	mux.HandleFunc("GET /api/v1/images/tags", inv.tags)
+	mux.HandleFunc("GET /api/v1/images/inspect", inv.inspect)
+}
+
+// list serves the referenced images with the details from the last
+// refresh. ?namespace= limits the workloads considered, ?registry= the
+// registry host, and ?severity= keeps images with findings at that
+// severity or worse.
+func (inv *Inventory) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	namespace, registry, severity := q.Get("namespace"), q.Get("registry"), q.Get("severity")
+	if namespace != "" && inv.allowed != nil && !inv.allowed[namespace] {
+		http.Error(w, "namespace not allowed", http.StatusForbidden)
+		return
+	}
+	if severity != "" && !slices.Contains(severityOrder, severity) {
+		http.Error(w, "invalid severity", http.StatusBadRequest)
+		return
+	}
+
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+	items := []Image{}
+	for image, workloads := range inv.referenced(namespace) {
+		ref, err := ParseReference(image)
+		if err != nil || (registry != "" && ref.Registry != registry) {
+			continue
+		}
+		sort.Strings(workloads)
+		img := Image{Image: image, Reference: ref, Workloads: workloads, Supported: inv.client.Supports(ref.Registry)}
+		if d, ok := inv.cache[image]; ok {
+			img.Digest, img.Scan, img.Error = d.digest, d.scan, d.errString()
+			img.CheckedAt = &d.checkedAt
+		}
+		if severity != "" && !img.Scan.AtLeast(severity) {
+			continue
+		}
+		items = append(items, img)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Image < items[j].Image })
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+// tags lists the tags of ?repository= (e.g. harbor.example.com/team/app).
+func (inv *Inventory) tags(w http.ResponseWriter, r *http.Request) {
+	ref, ok := inv.parseParam(w, r, "repository")
+	if !ok {
+		return
+	}
+	tags, err := inv.client.Tags(r.Context(), ref)
+	if err != nil {
+		inv.fail(w, err)
+		return
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"repository": ref.Name(), "tags": tags})
+}
+
+// inspect resolves ?image= live: its digest and scan summary.
+func (inv *Inventory) inspect(w http.ResponseWriter, r *http.Request) {
+	ref, ok := inv.parseParam(w, r, "image")
+	if !ok {
+		return
+	}
+	d := inv.resolve(r.Context(), ref)
+	if d.digest == "" {
+		inv.fail(w, d.err)
+		return
+	}
+	writeJSON(w, http.StatusOK, Image{
+		Image:     ref.String(),
+		Reference: ref,
+		Supported: true,
+		Digest:    d.digest,
+		Scan:      d.scan,
+		Error:     d.errString(),
+		CheckedAt: &d.checkedAt,
+	})
+}
+
+func (inv *Inventory) parseParam(w http.ResponseWriter, r *http.Request, name string) (Reference, bool) {
+	ref, err := ParseReference(r.URL.Query().Get(name))
+	if err != nil {
+		http.Error(w, "invalid "+name, http.StatusBadRequest)
+		return ref, false
+	}
+	if !inv.client.Supports(ref.Registry) {
+		http.Error(w, "registry not configured: "+ref.Registry, http.StatusBadRequest)
+		return ref, false
+	}
+	return ref, true
+}
+
+func (inv *Inventory) fail(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	inv.logger.Error("registry request failed", zap.Error(err))
+	http.Error(w, "registry request failed", http.StatusBadGateway)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
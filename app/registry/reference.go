@@ -0,0 +1,81 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dockerHub is the registry implied by references without a host.
+const dockerHub = "docker.io"
+
+// Reference is a parsed image reference such as
+// harbor.example.com/team/app:1.4@sha256:....
+type Reference struct {
+	// Registry is the host (and port); docker.io for Docker Hub images.
+	Registry   string `json:"registry"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+}
+
+// ParseReference parses ref with the same defaulting rules as the container
+// runtime: a missing host means Docker Hub (with library/ for single-segment
+// names) and a missing tag and digest means latest.
+func ParseReference(ref string) (Reference, error) {
+	var r Reference
+	rest := ref
+	if name, digest, ok := strings.Cut(rest, "@"); ok {
+		if !strings.Contains(digest, ":") {
+			return r, fmt.Errorf("invalid digest in %q", ref)
+		}
+		rest, r.Digest = name, digest
+	}
+	// A colon after the last slash separates the tag; one before it is a port
+	if i := strings.LastIndex(rest, ":"); i > strings.LastIndex(rest, "/") {
+		rest, r.Tag = rest[:i], rest[i+1:]
+	}
+	if rest == "" {
+		return r, fmt.Errorf("invalid image reference %q", ref)
+	}
+
+	host, path, ok := strings.Cut(rest, "/")
+	if ok && (strings.ContainsAny(host, ".:") || host == "localhost") {
+		r.Registry, r.Repository = host, path
+	} else {
+		r.Registry, r.Repository = dockerHub, rest
+	}
+	if r.Registry == dockerHub && !strings.Contains(r.Repository, "/") {
+		r.Repository = "library/" + r.Repository
+	}
+	if r.Repository == "" || r.Repository != strings.ToLower(r.Repository) {
+		return r, fmt.Errorf("invalid repository in %q", ref)
+	}
+	if r.Tag == "" && r.Digest == "" {
+		r.Tag = "latest"
+	}
+	return r, nil
+}
+
+// Name is the repository including its registry.
+func (r Reference) Name() string {
+	return r.Registry + "/" + r.Repository
+}
+
+// Ref is the tag or, if pinned, the digest, as used in manifest URLs.
+func (r Reference) Ref() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+func (r Reference) String() string {
+	s := r.Name()
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
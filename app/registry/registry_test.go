@@ -0,0 +1,275 @@
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Reference
+	}{
+		{"nginx", Reference{Registry: "docker.io", Repository: "library/nginx", Tag: "latest"}},
+		{"grafana/grafana:11.0", Reference{Registry: "docker.io", Repository: "grafana/grafana", Tag: "11.0"}},
+		{"localhost:5000/app", Reference{Registry: "localhost:5000", Repository: "app", Tag: "latest"}},
+		{"harbor.example.com/team/app/api:1.2@" + digest, Reference{Registry: "harbor.example.com", Repository: "team/app/api", Tag: "1.2", Digest: digest}},
+	}
+	for _, tt := range tests {
+		got, err := ParseReference(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseReference(%q) = %+v, %v; want %+v", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := ParseReference("Team/App"); err == nil {
+		t.Error("expected upper-case repository to be rejected")
+	}
+}
+
+// fakeHarbor serves the distribution API behind a bearer token challenge and
+// Harbor's artifact API behind basic auth.
+func fakeHarbor(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	basic := base64.StdEncoding.EncodeToString([]byte("robot:secret"))
+	mux := http.NewServeMux()
+	srv := httptest.NewTLSServer(mux)
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	mux.HandleFunc("GET /service/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Basic "+basic || r.URL.Query().Get("scope") != "repository:team/web:pull" {
+			http.Error(w, "denied", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"token": "tok", "expires_in": 300})
+	})
+	v2 := func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer tok" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="`+srv.URL+`/service/token",service="harbor-registry",scope="repository:team/web:pull"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			h(w, r)
+		}
+	}
+	mux.HandleFunc("GET /v2/team/web/tags/list", v2(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("last") == "" {
+			w.Header().Set("Link", `</v2/team/web/tags/list?n=1000&last=1.0>; rel="next"`)
+			json.NewEncoder(w).Encode(map[string]any{"tags": []string{"1.0"}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"tags": []string{"1.1"}})
+	}))
+	mux.HandleFunc("HEAD /v2/team/web/manifests/{ref}", v2(func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("ref") != "1.1" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", digest)
+	}))
+	mux.HandleFunc("GET /api/v2.0/projects/team/repositories/web/artifacts/{ref}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Basic "+basic || r.PathValue("ref") != digest {
+			http.Error(w, "denied", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"digest":"` + digest + `","scan_overview":{"application/vnd.security.vulnerability.report; version=1.1":{
+			"scan_status":"Success","severity":"High","end_time":"2026-10-01T10:00:00Z",
+			"summary":{"total":3,"fixable":2,"summary":{"High":1,"Low":2}}}}}`))
+	})
+	t.Cleanup(srv.Close)
+
+	creds := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(creds, []byte(`{"auths":{"https://`+host+`":{"auth":"`+basic+`"}}}`), 0o600)
+	return srv, creds
+}
+
+func newClient(t *testing.T) (*Client, string) {
+	t.Helper()
+	srv, creds := fakeHarbor(t)
+	host := strings.TrimPrefix(srv.URL, "https://")
+	c, err := NewClient(map[string]string{host: KindHarbor}, creds, srv.Client())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return c, host
+}
+
+func TestClientTagsDigestAndHarborScan(t *testing.T) {
+	c, host := newClient(t)
+	ref, _ := ParseReference(host + "/team/web:1.1")
+
+	tags, err := c.Tags(t.Context(), ref)
+	if err != nil || strings.Join(tags, ",") != "1.0,1.1" {
+		t.Fatalf("expected paginated tags, got %v, %v", tags, err)
+	}
+	d, err := c.Digest(t.Context(), ref)
+	if err != nil || d != digest {
+		t.Fatalf("expected digest, got %q, %v", d, err)
+	}
+	scan, err := c.Scan(t.Context(), ref, d)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if scan.Status != ScanComplete || scan.Severity != "high" || scan.Counts["low"] != 2 || scan.Fixable != 2 {
+		t.Errorf("unexpected scan summary %+v", scan)
+	}
+	if !scan.AtLeast("medium") || scan.AtLeast("critical") {
+		t.Error("severity threshold mismatch")
+	}
+
+	missing, _ := ParseReference(host + "/team/web:9.9")
+	if _, err := c.Digest(t.Context(), missing); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	other, _ := ParseReference("nginx")
+	if _, err := c.Tags(t.Context(), other); err != ErrUnsupported {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+}
+
+// awsEnv points the AWS SDK's default credential chain at static keys.
+func awsEnv(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	t.Setenv("AWS_CA_BUNDLE", "")
+}
+
+func TestECRScanSignsRequest(t *testing.T) {
+	awsEnv(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") || !strings.Contains(auth, "/eu-west-1/ecr/aws4_request") {
+			http.Error(w, "bad signature", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"imageScanStatus":{"status":"COMPLETE"},"imageScanFindings":{
+			"imageScanCompletedAt":1790000000.5,"findingSeverityCounts":{"CRITICAL":1,"MEDIUM":4}}}`))
+	}))
+	defer srv.Close()
+
+	e, err := newECRClient(t.Context(), srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.endpoint = srv.URL
+	ref, _ := ParseReference("123456789012.dkr.ecr.eu-west-1.amazonaws.com/team/web:1.0")
+	s, err := e.scan(t.Context(), ref, digest)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Status != ScanComplete || s.Severity != "critical" || s.Counts["medium"] != 4 || s.ScannedAt == nil {
+		t.Errorf("unexpected scan summary %+v", s)
+	}
+}
+
+func TestECRAuthorizationIsCached(t *testing.T) {
+	awsEnv(t)
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.Header.Get("X-Amz-Target"), ".GetAuthorizationToken") {
+			http.Error(w, "unexpected call", http.StatusBadRequest)
+			return
+		}
+		calls++
+		fmt.Fprintf(w, `{"authorizationData":[{"authorizationToken":"QVdTOnBhc3N3b3Jk","expiresAt":%d}]}`,
+			time.Now().Add(12*time.Hour).Unix())
+	}))
+	defer srv.Close()
+
+	e, err := newECRClient(t.Context(), srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.endpoint = srv.URL
+	for range 2 {
+		auth, err := e.authorization(t.Context(), "123456789012.dkr.ecr.eu-west-1.amazonaws.com")
+		if err != nil || auth != "QVdTOnBhc3N3b3Jk" {
+			t.Fatalf("expected the token, got %q %v", auth, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected the token cached, got %d calls", calls)
+	}
+	if _, err := e.authorization(t.Context(), "registry.example.com"); err == nil {
+		t.Error("expected a non-ECR host refused")
+	}
+}
+
+func TestInventoryListsWorkloadImages(t *testing.T) {
+	c, host := newClient(t)
+	deploy := func(ns, name, image string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app", Image: image}},
+			}}},
+		}
+	}
+	factory := informers.NewSharedInformerFactory(fake.NewClientset(
+		deploy("team-a", "web", host+"/team/web:1.1"),
+		deploy("team-a", "proxy", "nginx:1.27"),
+		deploy("kube-system", "dns", "coredns/coredns:1.11"),
+	), 0)
+	inv := New(factory, c, []string{"team-a"}, zap.NewNop())
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		factory.Shutdown()
+	})
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+	inv.Refresh(ctx)
+
+	mux := http.NewServeMux()
+	inv.Register(mux)
+	get := func(path string) (int, []Image) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var body struct {
+			Items []Image `json:"items"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return rec.Code, body.Items
+	}
+
+	code, items := get("/api/v1/images")
+	if code != http.StatusOK || len(items) != 2 {
+		t.Fatalf("expected 2 images outside kube-system, got %d %+v", code, items)
+	}
+	web := items[0]
+	if web.Digest != digest || web.Scan == nil || web.Workloads[0] != "Deployment team-a/web" {
+		t.Errorf("expected resolved web image, got %+v", web)
+	}
+	if items[1].Supported || items[1].Digest != "" {
+		t.Errorf("expected unconfigured registry to be unresolved, got %+v", items[1])
+	}
+	if _, items := get("/api/v1/images?severity=critical"); len(items) != 0 {
+		t.Errorf("expected no critical images, got %+v", items)
+	}
+	if code, _ := get("/api/v1/images?namespace=kube-system"); code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", code)
+	}
+	if code, _ := get("/api/v1/images/tags?repository=nginx"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unconfigured registry, got %d", code)
+	}
+}
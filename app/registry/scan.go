@@ -0,0 +1,133 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Scan statuses, normalised across registries.
+const (
+	ScanComplete   = "complete"
+	ScanPending    = "pending"
+	ScanFailed     = "failed"
+	ScanNotScanned = "not_scanned"
+)
+
+// severityOrder ranks the severities registries report, most severe first.
+var severityOrder = []string{"critical", "high", "medium", "low", "negligible", "informational", "unknown"}
+
+// ScanSummary is the vulnerability scan result of one image digest.
+type ScanSummary struct {
+	Status string `json:"status"`
+	// Severity is the highest severity found; empty for a clean image.
+	Severity string `json:"severity,omitempty"`
+	// Counts is the number of findings per lower-case severity.
+	Counts map[string]int `json:"counts,omitempty"`
+	// Fixable is the number of findings with a fixed version (Harbor only).
+	Fixable   int        `json:"fixable,omitempty"`
+	ScannedAt *time.Time `json:"scanned_at,omitempty"`
+}
+
+// AtLeast reports whether the scan found anything at severity or worse.
+func (s *ScanSummary) AtLeast(severity string) bool {
+	if s == nil || s.Severity == "" {
+		return false
+	}
+	for _, sev := range severityOrder {
+		if sev == s.Severity {
+			return true
+		}
+		if sev == severity {
+			return false
+		}
+	}
+	return false
+}
+
+// summarize fills Severity from Counts.
+func (s *ScanSummary) summarize() {
+	for _, sev := range severityOrder {
+		if s.Counts[sev] > 0 {
+			s.Severity = sev
+			return
+		}
+	}
+}
+
+// harborScan reads the scan overview Harbor attaches to an artifact.
+// Harbor's API takes basic credentials (a robot account) rather than
+// registry tokens.
+func (c *Client) harborScan(ctx context.Context, ref Reference, digest string) (*ScanSummary, error) {
+	project, repo, ok := strings.Cut(ref.Repository, "/")
+	if !ok {
+		return nil, fmt.Errorf("harbor repository %q has no project", ref.Repository)
+	}
+	// Nested repository names are escaped twice, as Harbor requires
+	path := fmt.Sprintf("/api/v2.0/projects/%s/repositories/%s/artifacts/%s?with_scan_overview=true",
+		url.PathEscape(project), url.PathEscape(url.PathEscape(repo)), url.PathEscape(digest))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+ref.Registry+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	c.mu.Lock()
+	auth := c.creds[ref.Registry]
+	c.mu.Unlock()
+	if auth != "" {
+		req.Header.Set("Authorization", "Basic "+auth)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+	var artifact struct {
+		ScanOverview map[string]struct {
+			ScanStatus string     `json:"scan_status"`
+			EndTime    *time.Time `json:"end_time"`
+			Summary    struct {
+				Fixable int            `json:"fixable"`
+				Summary map[string]int `json:"summary"`
+			} `json:"summary"`
+		} `json:"scan_overview"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&artifact); err != nil {
+		return nil, fmt.Errorf("decode harbor artifact: %w", err)
+	}
+
+	// The overview is keyed by report MIME type; Harbor runs one scanner
+	for _, o := range artifact.ScanOverview {
+		s := &ScanSummary{Status: harborStatus(o.ScanStatus), Fixable: o.Summary.Fixable, ScannedAt: o.EndTime}
+		if len(o.Summary.Summary) > 0 {
+			s.Counts = make(map[string]int, len(o.Summary.Summary))
+			for sev, n := range o.Summary.Summary {
+				s.Counts[strings.ToLower(sev)] = n
+			}
+		}
+		s.summarize()
+		return s, nil
+	}
+	return &ScanSummary{Status: ScanNotScanned}, nil
+}
+
+func harborStatus(s string) string {
+	switch s {
+	case "Success":
+		return ScanComplete
+	case "Error", "Stopped":
+		return ScanFailed
+	case "Pending", "Running", "Scheduled":
+		return ScanPending
+	default:
+		return ScanNotScanned
+	}
+}
@@ -0,0 +1,422 @@
+// Package resources serves the platform's own entities kept in the store,
+// tenants and environments, through the crud framework. Anyone can read
+// them; writes are open to callers in the admin groups and must send back
+// the version from their last read, so concurrent edits are not lost. Every
+// write is recorded in the entity's change history, served alongside.
+package resources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/crud"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+// Options configures the handlers.
+type Options struct {
+	// UserHeader and GroupsHeader carry the caller's identity, set by the
+	// authenticating proxy.
+	UserHeader   string
+	GroupsHeader string
+	// AdminGroups may create, update and delete tenants and environments.
+	AdminGroups []string
+}
+
+// Handlers serves /api/v1/tenants and /api/v1/environments.
+type Handlers struct {
+	store        *store.Store
+	logger       *zap.Logger
+	tenants      *crud.Handler[Tenant, *Tenant]
+	environments *crud.Handler[Environment, *Environment]
+}
+
+// New creates the handlers over st.
+func New(st *store.Store, opts Options, logger *zap.Logger) *Handlers {
+	a := &authorizer{
+		headers: authz.Headers{User: opts.UserHeader, Groups: opts.GroupsHeader},
+		groups:  opts.AdminGroups,
+		logger:  logger,
+	}
+	actor := func(r *http.Request) string { return a.headers.Identity(r).User }
+	return &Handlers{
+		store:  st,
+		logger: logger,
+		tenants: crud.New[Tenant](tenantBackend{st}, crud.Options{
+			Path:           "/api/v1/tenants",
+			Kind:           "tenant",
+			Authorize:      a.authorize("tenant"),
+			Actor:          actor,
+			RequireVersion: true,
+		}, logger),
+		environments: crud.New[Environment](environmentBackend{st}, crud.Options{
+			Path:           "/api/v1/environments",
+			Kind:           "environment",
+			Authorize:      a.authorize("environment"),
+			Actor:          actor,
+			RequireVersion: true,
+		}, logger),
+	}
+}
+
+// Register mounts the endpoints on mux.
+func (h *Handlers) Register(mux *http.ServeMux) {
+	h.tenants.Register(mux)
+	h.environments.Register(mux)
+	mux.HandleFunc("GET /api/v1/tenants/{id}/history", h.history("tenants", func(ctx context.Context, id string) error {
+		_, err := h.store.Tenants.Get(ctx, id)
+		return err
+	}))
+	mux.HandleFunc("GET /api/v1/environments/{id}/history", h.history("environments", func(ctx context.Context, id string) error {
+		_, err := h.store.Environments.Get(ctx, id)
+		return err
+	}))
+}
+
+// history serves the changes to one entity of resource, newest first.
+// Deleted entities keep their history; exists tells an entity written
+// before history was kept from one that never existed.
+func (h *Handlers) history(resource string, exists func(ctx context.Context, id string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		changes, err := h.store.History.List(r.Context(), resource, id)
+		if err == nil && len(changes) == 0 {
+			err = exists(r.Context(), id)
+		}
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		case err != nil:
+			h.logger.Error("listing history failed", zap.String("resource", resource), zap.String("id", id), zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if changes == nil {
+			changes = []store.Change{}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": changes})
+	}
+}
+
+// Tenant is the API representation of a store.Tenant, keyed by ID.
+type Tenant struct {
+	store.Tenant
+	// ResourceVersion guards updates against concurrent edits; send back
+	// the value from the last read.
+	ResourceVersion string `json:"resource_version,omitempty"`
+}
+
+func (t *Tenant) Key() string          { return t.ID }
+func (t *Tenant) SetKey(id string)     { t.ID = id }
+func (t *Tenant) Version() string      { return t.ResourceVersion }
+func (t *Tenant) SetVersion(rv string) { t.ResourceVersion = rv }
+
+// Validate requires a name usable as a namespace.
+func (t *Tenant) Validate() error {
+	if errs := validation.IsDNS1123Label(t.Name); len(errs) > 0 {
+		return fmt.Errorf("invalid name %q: %s", t.Name, errs[0])
+	}
+	return validateVersion(t.ResourceVersion)
+}
+
+func toTenant(t store.Tenant) Tenant {
+	return Tenant{Tenant: t, ResourceVersion: strconv.FormatInt(t.Version, 10)}
+}
+
+// Environment is the API representation of a store.Environment, keyed by
+// ID.
+type Environment struct {
+	store.Environment
+	// ResourceVersion guards updates against concurrent edits; send back
+	// the value from the last read.
+	ResourceVersion string `json:"resource_version,omitempty"`
+}
+
+func (e *Environment) Key() string          { return e.ID }
+func (e *Environment) SetKey(id string)     { e.ID = id }
+func (e *Environment) Version() string      { return e.ResourceVersion }
+func (e *Environment) SetVersion(rv string) { e.ResourceVersion = rv }
+
+// Validate requires a DNS label name and a known tier.
+func (e *Environment) Validate() error {
+	if errs := validation.IsDNS1123Label(e.Name); len(errs) > 0 {
+		return fmt.Errorf("invalid name %q: %s", e.Name, errs[0])
+	}
+	if !slices.Contains([]string{store.TierDevelopment, store.TierStaging, store.TierProduction}, e.Tier) {
+		return fmt.Errorf("tier must be %s, %s or %s", store.TierDevelopment, store.TierStaging, store.TierProduction)
+	}
+	return validateVersion(e.ResourceVersion)
+}
+
+func toEnvironment(e store.Environment) Environment {
+	return Environment{Environment: e, ResourceVersion: strconv.FormatInt(e.Version, 10)}
+}
+
+func validateVersion(rv string) error {
+	if _, err := parseVersion(rv); err != nil {
+		return fmt.Errorf("invalid resource_version %q", rv)
+	}
+	return nil
+}
+
+// parseVersion returns the store version in rv, 0 when it is empty.
+func parseVersion(rv string) (int64, error) {
+	if rv == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseInt(rv, 10, 64)
+	if err != nil || v <= 0 {
+		return 0, errors.New("invalid version")
+	}
+	return v, nil
+}
+
+// tenantBackend keeps tenants in the store. IDs are generated on create.
+type tenantBackend struct {
+	store *store.Store
+}
+
+// List supports filtering by owner.
+func (b tenantBackend) List(ctx context.Context, q url.Values) ([]Tenant, error) {
+	tenants, err := b.store.Tenants.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	owner := q.Get("owner")
+	out := make([]Tenant, 0, len(tenants))
+	for _, t := range tenants {
+		if owner == "" || t.Owner == owner {
+			out = append(out, toTenant(t))
+		}
+	}
+	return out, nil
+}
+
+func (b tenantBackend) Get(ctx context.Context, id string) (*Tenant, error) {
+	t, err := b.store.Tenants.Get(ctx, id)
+	if err != nil {
+		return nil, translate(err)
+	}
+	out := toTenant(*t)
+	return &out, nil
+}
+
+func (b tenantBackend) Create(ctx context.Context, t *Tenant) error {
+	t.ID = ""
+	err := b.store.WithTx(ctx, func(tx store.Repos) error {
+		if err := tx.Tenants.Create(ctx, &t.Tenant); err != nil {
+			return err
+		}
+		return record(ctx, tx, "tenants", t.ID, store.ChangeCreate, nil, t.Tenant)
+	})
+	if err != nil {
+		return translate(err)
+	}
+	*t = toTenant(t.Tenant)
+	return nil
+}
+
+func (b tenantBackend) Update(ctx context.Context, t *Tenant) error {
+	t.Tenant.Version, _ = parseVersion(t.ResourceVersion)
+	err := b.store.WithTx(ctx, func(tx store.Repos) error {
+		before, err := tx.Tenants.Get(ctx, t.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Tenants.Update(ctx, &t.Tenant); err != nil {
+			return err
+		}
+		return record(ctx, tx, "tenants", t.ID, store.ChangeUpdate, *before, t.Tenant)
+	})
+	if err != nil {
+		return translate(err)
+	}
+	*t = toTenant(t.Tenant)
+	return nil
+}
+
+func (b tenantBackend) Delete(ctx context.Context, id, rv string) error {
+	return translate(b.store.WithTx(ctx, func(tx store.Repos) error {
+		t, err := tx.Tenants.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(rv, t.Version); err != nil {
+			return err
+		}
+		if err := tx.Tenants.Delete(ctx, id); err != nil {
+			return err
+		}
+		return record(ctx, tx, "tenants", id, store.ChangeDelete, *t, nil)
+	}))
+}
+
+// environmentBackend keeps environments in the store. IDs are generated on
+// create.
+type environmentBackend struct {
+	store *store.Store
+}
+
+// List supports filtering by tier.
+func (b environmentBackend) List(ctx context.Context, q url.Values) ([]Environment, error) {
+	envs, err := b.store.Environments.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tier := q.Get("tier")
+	out := make([]Environment, 0, len(envs))
+	for _, e := range envs {
+		if tier == "" || e.Tier == tier {
+			out = append(out, toEnvironment(e))
+		}
+	}
+	return out, nil
+}
+
+func (b environmentBackend) Get(ctx context.Context, id string) (*Environment, error) {
+	e, err := b.store.Environments.Get(ctx, id)
+	if err != nil {
+		return nil, translate(err)
+	}
+	out := toEnvironment(*e)
+	return &out, nil
+}
+
+func (b environmentBackend) Create(ctx context.Context, e *Environment) error {
+	e.ID = ""
+	err := b.store.WithTx(ctx, func(tx store.Repos) error {
+		if err := tx.Environments.Create(ctx, &e.Environment); err != nil {
+			return err
+		}
+		return record(ctx, tx, "environments", e.ID, store.ChangeCreate, nil, e.Environment)
+	})
+	if err != nil {
+		return translate(err)
+	}
+	*e = toEnvironment(e.Environment)
+	return nil
+}
+
+func (b environmentBackend) Update(ctx context.Context, e *Environment) error {
+	e.Environment.Version, _ = parseVersion(e.ResourceVersion)
+	err := b.store.WithTx(ctx, func(tx store.Repos) error {
+		before, err := tx.Environments.Get(ctx, e.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Environments.Update(ctx, &e.Environment); err != nil {
+			return err
+		}
+		return record(ctx, tx, "environments", e.ID, store.ChangeUpdate, *before, e.Environment)
+	})
+	if err != nil {
+		return translate(err)
+	}
+	*e = toEnvironment(e.Environment)
+	return nil
+}
+
+func (b environmentBackend) Delete(ctx context.Context, id, rv string) error {
+	return translate(b.store.WithTx(ctx, func(tx store.Repos) error {
+		e, err := tx.Environments.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(rv, e.Version); err != nil {
+			return err
+		}
+		if err := tx.Environments.Delete(ctx, id); err != nil {
+			return err
+		}
+		return record(ctx, tx, "environments", id, store.ChangeDelete, *e, nil)
+	}))
+}
+
+// record adds a change to the history within tx, attributed to the caller
+// and request in ctx.
+func record(ctx context.Context, tx store.Repos, resource, id, action string, before, after any) error {
+	c, err := store.NewChange(resource, id, action, before, after)
+	if err != nil {
+		return err
+	}
+	c.Actor = crud.ActorFrom(ctx)
+	c.RequestID = middleware.GetRequestID(ctx)
+	return tx.History.Record(ctx, c)
+}
+
+// checkVersion compares the version a client sent with the stored one.
+func checkVersion(rv string, current int64) error {
+	if rv == "" {
+		return nil
+	}
+	if v, err := parseVersion(rv); err != nil || v != current {
+		return store.ErrVersionConflict
+	}
+	return nil
+}
+
+// translate maps store errors to the crud errors.
+func translate(err error) error {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return fmt.Errorf("%w: %w", crud.ErrNotFound, err)
+	case errors.Is(err, store.ErrConflict):
+		return fmt.Errorf("%w: %w", crud.ErrExists, err)
+	case errors.Is(err, store.ErrVersionConflict):
+		return fmt.Errorf("%w: %w", crud.ErrStale, err)
+	}
+	return err
+}
+
+type authorizer struct {
+	headers authz.Headers
+	groups  []string
+	logger  *zap.Logger
+}
+
+// authorize returns the crud authorizer for kind, admitting callers in
+// one of the admin groups and writing the audit entry.
+func (a *authorizer) authorize(kind string) func(w http.ResponseWriter, r *http.Request, verb, key string) bool {
+	return func(w http.ResponseWriter, r *http.Request, verb, key string) bool {
+		id := a.headers.Identity(r)
+		if id.User == "" {
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+			return false
+		}
+		audit := a.logger.With(
+			zap.String("audit", kind),
+			zap.String("request_id", middleware.GetRequestID(r.Context())),
+			zap.String("user", id.User),
+			zap.Strings("groups", id.Groups),
+			zap.String("verb", verb),
+			zap.String("id", key),
+		)
+		for _, g := range id.Groups {
+			if slices.Contains(a.groups, g) {
+				audit.Info(kind + " change allowed")
+				return true
+			}
+		}
+		audit.Warn(kind + " change denied")
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return false
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
@@ -0,0 +1,98 @@
+package resources
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+func TestResources(t *testing.T) {
+	mux := http.NewServeMux()
+	New(store.NewMemory(), Options{
+		UserHeader:   "X-Forwarded-User",
+		GroupsHeader: "X-Forwarded-Groups",
+		AdminGroups:  []string{"platform-admins"},
+	}, zap.NewNop()).Register(mux)
+	do := func(method, path, body, groups string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-Forwarded-User", "alice")
+		req.Header.Set("X-Forwarded-Groups", groups)
+		if len(header) == 2 {
+			req.Header.Set(header[0], header[1])
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	body := `{"name":"payments","display_name":"Payments","owner":"team-payments"}`
+	if rec := do(http.MethodPost, "/api/v1/tenants", body, "developers"); rec.Code != http.StatusForbidden {
+		t.Errorf("expected writes outside the admin groups to be refused, got %d", rec.Code)
+	}
+	rec := do(http.MethodPost, "/api/v1/tenants", body, "platform-admins")
+	var tenant Tenant
+	json.NewDecoder(rec.Body).Decode(&tenant)
+	if rec.Code != http.StatusCreated || tenant.ID == "" || tenant.ResourceVersion != "1" {
+		t.Fatalf("expected the tenant created at version 1, got %d %+v", rec.Code, tenant)
+	}
+	if rec := do(http.MethodPost, "/api/v1/tenants", `{"name":"Payments"}`, "platform-admins"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a name unusable as a namespace to be refused, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api/v1/tenants", body, "platform-admins"); rec.Code != http.StatusConflict {
+		t.Errorf("expected a duplicate name to conflict, got %d", rec.Code)
+	}
+
+	path := "/api/v1/tenants/" + tenant.ID
+	update := `{"name":"payments","display_name":"Payments & Billing","resource_version":"1"}`
+	if rec := do(http.MethodPut, path, update, "platform-admins"); rec.Code != http.StatusOK || rec.Header().Get("ETag") != `"2"` {
+		t.Fatalf("expected the update at version 2, got %d %s: %s", rec.Code, rec.Header().Get("ETag"), rec.Body)
+	}
+	if rec := do(http.MethodPut, path, update, "platform-admins"); rec.Code != http.StatusConflict {
+		t.Errorf("expected a stale update to conflict, got %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, path, "", "platform-admins", "If-Match", `"1"`); rec.Code != http.StatusConflict {
+		t.Errorf("expected a stale delete to conflict, got %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, path, "", "platform-admins", "If-Match", `"2"`); rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, path, "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected a deleted tenant to be gone, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api/v1/tenants", body, "platform-admins"); rec.Code != http.StatusCreated {
+		t.Errorf("expected a deleted tenant's name to be reusable, got %d", rec.Code)
+	}
+	rec = do(http.MethodGet, path+"/history", "", "")
+	var history struct{ Items []store.Change }
+	json.NewDecoder(rec.Body).Decode(&history)
+	if len(history.Items) != 3 || history.Items[0].Action != store.ChangeDelete || history.Items[2].Action != store.ChangeCreate {
+		t.Fatalf("expected the create, update and delete newest first, got %d %+v", rec.Code, history.Items)
+	}
+	if c := history.Items[1]; c.Actor != "alice" || !strings.Contains(string(c.Diff), `"display_name":"Payments \u0026 Billing"`) {
+		t.Errorf("expected the update attributed to alice with its diff, got %+v", c)
+	}
+	if rec := do(http.MethodGet, "/api/v1/tenants/missing/history", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown tenant's history, got %d", rec.Code)
+	}
+
+	if rec := do(http.MethodPost, "/api/v1/environments", `{"name":"qa","tier":"testing"}`, "platform-admins"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected an unknown tier to be refused, got %d", rec.Code)
+	}
+	for _, env := range []string{`{"name":"prod","tier":"production"}`, `{"name":"staging","tier":"staging"}`} {
+		if rec := do(http.MethodPost, "/api/v1/environments", env, "platform-admins"); rec.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+		}
+	}
+	rec = do(http.MethodGet, "/api/v1/environments?tier=production", "", "")
+	var resp struct{ Items []Environment }
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if len(resp.Items) != 1 || resp.Items[0].Name != "prod" {
+		t.Errorf("expected only prod, got %+v", resp.Items)
+	}
+}
@@ -0,0 +1,128 @@
+// Package rpc builds the gRPC server that shares the public port with the
+// HTTP API. It carries the standard health service (kept in sync with
+// readiness) and reflection for grpcurl-style debugging.
+package rpc
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+)
+
+// Server bundles the gRPC server with its health service.
+type Server struct {
+	GRPC   *grpc.Server
+	health *health.Server
+}
+
+// New creates a gRPC server with logging and panic recovery interceptors.
+// Errors returned by services get the status code of their errs kind.
+// Additional services are registered on Server.GRPC before serving.
+func New(logger *zap.Logger) *Server {
+	g := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			unaryRecovery(logger),
+			unaryLogging(logger),
+			unaryErrors(logger),
+		),
+		grpc.ChainStreamInterceptor(
+			streamRecovery(logger),
+			streamErrors(logger),
+		),
+	)
+
+	h := health.NewServer()
+	healthpb.RegisterHealthServer(g, h)
+	reflection.Register(g)
+
+	return &Server{GRPC: g, health: h}
+}
+
+// SetNotServing flips the gRPC health status alongside HTTP readiness.
+func (s *Server) SetNotServing() {
+	s.health.Shutdown()
+}
+
+// Shutdown stops accepting RPCs and waits for in-flight ones until ctx expires.
+func (s *Server) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.GRPC.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.GRPC.Stop()
+		return ctx.Err()
+	}
+}
+
+func unaryLogging(logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logger.Info("rpc completed",
+			zap.String("method", info.FullMethod),
+			zap.String("code", status.Code(err).String()),
+			zap.Duration("duration", time.Since(start)),
+		)
+		return resp, err
+	}
+}
+
+func unaryErrors(logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		resp, err := handler(ctx, req)
+		return resp, grpcError(logger, info.FullMethod, err)
+	}
+}
+
+func streamErrors(logger *zap.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return grpcError(logger, info.FullMethod, handler(srv, ss))
+	}
+}
+
+// grpcError maps err to a status error, logging the errors that become
+// Internal since the caller does not get their message.
+func grpcError(logger *zap.Logger, method string, err error) error {
+	if err != nil && errs.GRPCCode(err) == codes.Unknown {
+		logger.Error("rpc failed", zap.String("method", method), zap.Error(err))
+	}
+	return errs.GRPCStatus(err)
+}
+
+func unaryRecovery(logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				logger.Error("panic recovered", zap.String("method", info.FullMethod), zap.Any("error", rec))
+				err = status.Error(codes.Internal, "internal server error")
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+func streamRecovery(logger *zap.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				logger.Error("panic recovered", zap.String("method", info.FullMethod), zap.Any("error", rec))
+				err = status.Error(codes.Internal, "internal server error")
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,190 @@
+package scaffold
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/storage/memory"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+)
+
+// ErrBranchExists is returned by Push when the branch is already there.
+var ErrBranchExists = errs.New(errs.Conflict, "branch already exists")
+
+// Remote commits to a branch of any Git repository over the smart HTTP
+// protocol: GitHub, GitLab, Gitea, Bitbucket or a plain git http-backend.
+// The base branch is fetched shallowly into memory, so no git binary or
+// disk checkout is needed.
+type Remote struct {
+	// URL is the repository's clone URL, e.g.
+	// https://gitlab.example.com/acme/services.git.
+	URL string
+	// BaseBranch is the branch new branches start from.
+	BaseBranch string
+	// Username and Token authenticate as HTTP basic auth. Hosts taking a
+	// token as the password accept any username; empty means "git".
+	Username string
+	Token    string
+	// AuthorName and AuthorEmail sign the commits.
+	AuthorName  string
+	AuthorEmail string
+	// Client carries clone, list and push requests; nil means a plain
+	// net/http client.
+	Client *http.Client
+}
+
+// Repository is the URL without credentials, as shown to callers.
+func (g *Remote) Repository() string {
+	u, err := url.Parse(g.URL)
+	if err != nil {
+		return g.URL
+	}
+	u.User = nil
+	return u.String()
+}
+
+// Push commits files on top of the base branch and creates branch pointing
+// at the commit. It returns the commit SHA.
+func (g *Remote) Push(ctx context.Context, branch, message string, files map[string][]byte) (string, error) {
+	ref := plumbing.NewBranchReferenceName(branch)
+	exists, err := g.hasRef(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("list remote branches: %w", err)
+	}
+	if exists {
+		return "", fmt.Errorf("%w: %s", ErrBranchExists, branch)
+	}
+
+	repo, err := git.CloneContext(ctx, memory.NewStorage(), memfs.New(), &git.CloneOptions{
+		URL:           g.URL,
+		Auth:          g.auth(),
+		ReferenceName: plumbing.NewBranchReferenceName(g.BaseBranch),
+		SingleBranch:  true,
+		Depth:         1,
+		Tags:          git.NoTags,
+	})
+	if err != nil {
+		return "", fmt.Errorf("fetch base branch: %w", err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return "", err
+	}
+	for name, content := range files {
+		if err := util.WriteFile(wt.Filesystem, name, content, 0o644); err != nil {
+			return "", fmt.Errorf("write %s: %w", name, err)
+		}
+		if _, err := wt.Add(name); err != nil {
+			return "", fmt.Errorf("add %s: %w", name, err)
+		}
+	}
+	commit, err := wt.Commit(message, &git.CommitOptions{
+		Author: &object.Signature{Name: g.AuthorName, Email: g.AuthorEmail, When: time.Now()},
+	})
+	if err != nil {
+		return "", fmt.Errorf("commit: %w", err)
+	}
+
+	// The hash refspec creates the remote branch without a local one
+	err = repo.PushContext(ctx, &git.PushOptions{
+		Auth:     g.auth(),
+		RefSpecs: []config.RefSpec{config.RefSpec(commit.String() + ":" + ref.String())},
+	})
+	switch {
+	case err == nil:
+		return commit.String(), nil
+	case errors.Is(err, git.ErrNonFastForwardUpdate), strings.Contains(err.Error(), "non-fast-forward"),
+		strings.Contains(err.Error(), "already exists"):
+		// Lost a race with another push of the same branch
+		return "", fmt.Errorf("%w: %s", ErrBranchExists, branch)
+	default:
+		return "", fmt.Errorf("push branch: %w", err)
+	}
+}
+
+// hasRef reports whether the remote has ref.
+func (g *Remote) hasRef(ctx context.Context, ref plumbing.ReferenceName) (bool, error) {
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{g.URL}})
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: g.auth()})
+	if err != nil {
+		return false, err
+	}
+	for _, r := range refs {
+		if r.Name() == ref {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// auth returns the credentials together with a transport over g.Client,
+// which the protocol dispatcher routes the session through.
+func (g *Remote) auth() transport.AuthMethod {
+	installOnce.Do(func() {
+		client.InstallProtocol("http", dispatcher{})
+		client.InstallProtocol("https", dispatcher{})
+	})
+	a := &remoteAuth{client: githttp.NewClient(g.Client)}
+	if g.Token != "" {
+		username := g.Username
+		if username == "" {
+			username = "git"
+		}
+		a.basic = &githttp.BasicAuth{Username: username, Password: g.Token}
+	}
+	return a
+}
+
+var installOnce sync.Once
+
+// remoteAuth carries a Remote's transport alongside its credentials, since
+// go-git picks transports per URL scheme for the whole process.
+type remoteAuth struct {
+	basic  *githttp.BasicAuth
+	client transport.Transport
+}
+
+func (a *remoteAuth) Name() string   { return "scaffold-remote" }
+func (a *remoteAuth) String() string { return a.Name() }
+
+// inner is the credentials the HTTP transport takes, nil for none.
+func (a *remoteAuth) inner() transport.AuthMethod {
+	if a.basic == nil {
+		return nil
+	}
+	return a.basic
+}
+
+// dispatcher replaces go-git's HTTP transports, sending sessions opened by
+// a Remote through its client and everything else through the default one.
+type dispatcher struct{}
+
+func (dispatcher) NewUploadPackSession(ep *transport.Endpoint, auth transport.AuthMethod) (transport.UploadPackSession, error) {
+	if a, ok := auth.(*remoteAuth); ok {
+		return a.client.NewUploadPackSession(ep, a.inner())
+	}
+	return githttp.DefaultClient.NewUploadPackSession(ep, auth)
+}
+
+func (dispatcher) NewReceivePackSession(ep *transport.Endpoint, auth transport.AuthMethod) (transport.ReceivePackSession, error) {
+	if a, ok := auth.(*remoteAuth); ok {
+		return a.client.NewReceivePackSession(ep, a.inner())
+	}
+	return githttp.DefaultClient.NewReceivePackSession(ep, auth)
+}
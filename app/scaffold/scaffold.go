@@ -0,0 +1,431 @@
+// Package scaffold renders new service skeletons from the platform's golden
+// path: a Dockerfile and starter app for the chosen language, Kubernetes
+// manifests or a Helm chart, and a CI pipeline, all from embedded templates.
+// A skeleton is returned as a tarball or committed to a branch of the
+// configured Git remote.
+package scaffold
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/objectstore"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/workpool"
+)
+
+// Templates are grouped as templates/<group>/<option>/<files>; the files of
+// the chosen option of each group, and of common, make up a skeleton. They
+// use [[ ]] delimiters so Helm and workflow syntax passes through.
+//
+//go:embed all:templates
+var templates embed.FS
+
+// Option groups a request chooses from.
+const (
+	GroupLanguage = "language"
+	GroupDeploy   = "deploy"
+	GroupCI       = "ci"
+)
+
+var groups = []string{GroupLanguage, GroupDeploy, GroupCI}
+
+var branchPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+
+var scaffoldsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "scaffolds_total",
+	Help: "Service scaffolds by output and result.",
+}, []string{"output", "result"})
+
+// Options configures the handler.
+type Options struct {
+	// Registry is the image registry prefix skeletons build to; images are
+	// <registry>/<team>/<name>.
+	Registry string
+	// Remote receives skeletons pushed as a branch; nil disables it.
+	Remote *Remote
+	// Objects keeps tarballs for the object output, downloadable for
+	// ObjectExpiry; nil disables it.
+	Objects      *objectstore.Client
+	ObjectExpiry time.Duration
+	// UserHeader and GroupsHeader carry the caller's identity, set by the
+	// authenticating proxy.
+	UserHeader   string
+	GroupsHeader string
+	// Workers renders the skeletons; nil renders them on the request
+	// goroutines.
+	Workers *workpool.Pool
+}
+
+// Handler serves the scaffolding API.
+type Handler struct {
+	registry string
+	remote   *Remote
+	objects  *objectstore.Client
+	expiry   time.Duration
+	headers  authz.Headers
+	workers  *workpool.Pool
+	bus      events.Publisher
+	logger   *zap.Logger
+}
+
+// New creates a scaffolding handler.
+func New(bus events.Publisher, opts Options, logger *zap.Logger) *Handler {
+	return &Handler{
+		registry: strings.TrimSuffix(opts.Registry, "/"),
+		remote:   opts.Remote,
+		objects:  opts.Objects,
+		expiry:   opts.ObjectExpiry,
+		headers:  authz.Headers{User: opts.UserHeader, Groups: opts.GroupsHeader},
+		workers:  opts.Workers,
+		bus:      bus,
+		logger:   logger,
+	}
+}
+
+// Register mounts the scaffolding endpoints on mux.
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/scaffold", h.options)
+	mux.HandleFunc("POST /api/v1/scaffold", h.scaffold)
+}
+
+// Params are the values a skeleton is rendered with.
+type Params struct {
+	Name     string `json:"name"`
+	Team     string `json:"team"`
+	Language string `json:"language"`
+	Deploy   string `json:"deploy"`
+	CI       string `json:"ci"`
+	Port     int    `json:"port"`
+}
+
+// data is what the templates see.
+type data struct {
+	Params
+	Image string
+}
+
+// defaults fills in unset choices.
+func (p *Params) defaults() {
+	if p.Language == "" {
+		p.Language = "go"
+	}
+	if p.Deploy == "" {
+		p.Deploy = "manifests"
+	}
+	if p.CI == "" {
+		p.CI = "github"
+	}
+	if p.Port == 0 {
+		p.Port = 8080
+	}
+}
+
+func (p *Params) validate() error {
+	if errs := validation.IsDNS1123Label(p.Name); len(errs) > 0 {
+		return fmt.Errorf("name: %s", strings.Join(errs, "; "))
+	}
+	if errs := validation.IsDNS1123Label(p.Team); len(errs) > 0 {
+		return fmt.Errorf("team: %s", strings.Join(errs, "; "))
+	}
+	if p.Port < 1024 || p.Port > 65535 {
+		return errors.New("port must be between 1024 and 65535")
+	}
+	for _, g := range groups {
+		if !slices.Contains(choices(g), p.choice(g)) {
+			return fmt.Errorf("%s must be one of %s", g, strings.Join(choices(g), ", "))
+		}
+	}
+	return nil
+}
+
+// choice is the option p picks in group.
+func (p *Params) choice(group string) string {
+	switch group {
+	case GroupLanguage:
+		return p.Language
+	case GroupDeploy:
+		return p.Deploy
+	}
+	return p.CI
+}
+
+// choices lists the options of group.
+func choices(group string) []string {
+	entries, _ := fs.ReadDir(templates, path.Join("templates", group))
+	var out []string
+	for _, e := range entries {
+		if e.IsDir() {
+			out = append(out, e.Name())
+		}
+	}
+	return out
+}
+
+// options lists the choices of every group and whether pushing is enabled.
+func (h *Handler) options(w http.ResponseWriter, r *http.Request) {
+	out := map[string]any{"git": h.remote != nil}
+	for _, g := range groups {
+		out[g] = choices(g)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// Render renders the skeleton for p, keyed by path relative to the service
+// root.
+func (h *Handler) Render(p Params) (map[string][]byte, error) {
+	d := data{Params: p, Image: h.registry + "/" + p.Team + "/" + p.Name}
+	if h.registry == "" {
+		d.Image = p.Team + "/" + p.Name
+	}
+	files := make(map[string][]byte)
+	dirs := []string{"templates/common"}
+	for _, g := range groups {
+		dirs = append(dirs, path.Join("templates", g, p.choice(g)))
+	}
+	for _, dir := range dirs {
+		err := fs.WalkDir(templates, dir, func(file string, e fs.DirEntry, err error) error {
+			if err != nil || e.IsDir() {
+				return err
+			}
+			src, err := templates.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			t, err := template.New(file).Delims("[[", "]]").Option("missingkey=error").Parse(string(src))
+			if err != nil {
+				return err
+			}
+			var buf bytes.Buffer
+			if err := t.Execute(&buf, d); err != nil {
+				return err
+			}
+			files[strings.TrimSuffix(strings.TrimPrefix(file, dir+"/"), ".tmpl")] = buf.Bytes()
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("render %s: %w", dir, err)
+		}
+	}
+	return files, nil
+}
+
+type scaffoldRequest struct {
+	Params
+	// Output is "tarball" (default), "git" or "object".
+	Output string `json:"output"`
+	// Branch is the branch created for "git"; defaults to scaffold/<name>.
+	Branch string `json:"branch"`
+}
+
+// scaffold renders a skeleton and returns it as a gzipped tarball rooted
+// at <name>/, or commits it under <name>/ on a new branch of the remote.
+func (h *Handler) scaffold(w http.ResponseWriter, r *http.Request) {
+	id := h.headers.Identity(r)
+	if id.User == "" {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+	var req scaffoldRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.defaults()
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Output == "" {
+		req.Output = "tarball"
+	}
+	if req.Branch == "" {
+		req.Branch = "scaffold/" + req.Name
+	}
+	switch {
+	case req.Output != "tarball" && req.Output != "git" && req.Output != "object":
+		http.Error(w, "output must be tarball, git or object", http.StatusBadRequest)
+		return
+	case req.Output == "git" && h.remote == nil:
+		http.Error(w, "no git remote configured", http.StatusBadRequest)
+		return
+	case req.Output == "object" && h.objects == nil:
+		http.Error(w, "no object store configured", http.StatusBadRequest)
+		return
+	case req.Output == "git" && !validBranch(req.Branch):
+		http.Error(w, "invalid branch", http.StatusBadRequest)
+		return
+	}
+
+	audit := h.logger.With(
+		zap.String("audit", "scaffold"),
+		zap.String("request_id", middleware.GetRequestID(r.Context())),
+		zap.String("user", id.User),
+		zap.Strings("groups", id.Groups),
+		zap.String("service", req.Name),
+		zap.String("team", req.Team),
+		zap.String("output", req.Output),
+	)
+
+	var files map[string][]byte
+	err := h.workers.Do(r.Context(), "scaffold", func() (err error) {
+		files, err = h.Render(req.Params)
+		return err
+	})
+	if workpool.Error(w, err) {
+		scaffoldsTotal.WithLabelValues(req.Output, "error").Inc()
+		return
+	}
+	if err != nil {
+		scaffoldsTotal.WithLabelValues(req.Output, "error").Inc()
+		audit.Error("failed to render scaffold", zap.Error(err))
+		http.Error(w, "failed to render scaffold", http.StatusInternalServerError)
+		return
+	}
+
+	if req.Output != "git" {
+		archive, err := tarball(req.Name, files)
+		if err != nil {
+			scaffoldsTotal.WithLabelValues(req.Output, "error").Inc()
+			http.Error(w, "failed to build archive", http.StatusInternalServerError)
+			return
+		}
+		if req.Output == "object" {
+			key := path.Join(objectstore.ScaffoldPrefix, req.Team, uuid.NewString(), req.Name+".tar.gz")
+			obj, err := h.objects.Upload(r.Context(), key, "application/gzip", archive, h.expiry)
+			if err != nil {
+				scaffoldsTotal.WithLabelValues(req.Output, "error").Inc()
+				audit.Warn("failed to store scaffold", zap.Error(err))
+				http.Error(w, "failed to store scaffold", http.StatusBadGateway)
+				return
+			}
+			scaffoldsTotal.WithLabelValues(req.Output, "success").Inc()
+			audit.Info("service scaffolded", zap.String("key", key))
+			h.publish(r.Context(), req.Params, id.User, "")
+			writeJSON(w, http.StatusCreated, obj)
+			return
+		}
+		scaffoldsTotal.WithLabelValues(req.Output, "success").Inc()
+		audit.Info("service scaffolded")
+		h.publish(r.Context(), req.Params, id.User, "")
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.tar.gz"`, req.Name))
+		w.Write(archive)
+		return
+	}
+
+	prefixed := make(map[string][]byte, len(files))
+	for name, content := range files {
+		prefixed[path.Join(req.Name, name)] = content
+	}
+	message := fmt.Sprintf("Scaffold %s for %s\n\nRequested by %s through the platform API.", req.Name, req.Team, id.User)
+	commit, err := h.remote.Push(r.Context(), req.Branch, message, prefixed)
+	if err != nil {
+		scaffoldsTotal.WithLabelValues(req.Output, "error").Inc()
+		audit.Warn("failed to push scaffold", zap.String("branch", req.Branch), zap.Error(err))
+		if errors.Is(err, ErrBranchExists) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, "failed to push scaffold: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	scaffoldsTotal.WithLabelValues(req.Output, "success").Inc()
+	audit.Info("service scaffolded", zap.String("branch", req.Branch), zap.String("commit", commit))
+	h.publish(r.Context(), req.Params, id.User, req.Branch)
+	writeJSON(w, http.StatusCreated, map[string]string{
+		"repository": h.remote.Repository(),
+		"branch":     req.Branch,
+		"commit":     commit,
+	})
+}
+
+// validBranch accepts branch names git takes as is.
+func validBranch(b string) bool {
+	return branchPattern.MatchString(b) && !strings.Contains(b, "..") && !strings.Contains(b, "//") &&
+		!strings.HasSuffix(b, "/") && !strings.HasSuffix(b, ".lock")
+}
+
+// tarball packs files under root/ as a gzipped tar.
+func tarball(root string, files map[string][]byte) ([]byte, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	now := time.Now()
+	for _, name := range names {
+		hdr := &tar.Header{
+			Name:     path.Join(root, name),
+			Mode:     0o644,
+			Size:     int64(len(files[name])),
+			ModTime:  now,
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (h *Handler) publish(ctx context.Context, p Params, user, branch string) {
+	e, err := events.New("service.scaffolded", "scaffold", map[string]string{
+		"service":  p.Name,
+		"team":     p.Team,
+		"language": p.Language,
+		"deploy":   p.Deploy,
+		"ci":       p.CI,
+		"branch":   branch,
+		"user":     user,
+	})
+	if err != nil {
+		return
+	}
+	if err := h.bus.Publish(ctx, e); err != nil {
+		h.logger.Warn("failed to publish scaffold event", zap.Error(err))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
@@ -0,0 +1,222 @@
+package scaffold
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"go.uber.org/zap"
+	"sigs.k8s.io/yaml"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+)
+
+func newMux(remote *Remote) *http.ServeMux {
+	mux := http.NewServeMux()
+	New(events.NewMemoryBus(), Options{
+		Registry:   "registry.internal/",
+		Remote:     remote,
+		UserHeader: "X-Forwarded-User",
+	}, zap.NewNop()).Register(mux)
+	return mux
+}
+
+func post(mux *http.ServeMux, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/scaffold", strings.NewReader(body))
+	req.Header.Set("X-Forwarded-User", "alice")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRenderChoices(t *testing.T) {
+	h := New(events.NewMemoryBus(), Options{Registry: "registry.internal"}, zap.NewNop())
+	for _, p := range []Params{
+		{Name: "payments", Team: "team-a", Language: "go", Deploy: "manifests", CI: "github", Port: 8080},
+		{Name: "payments", Team: "team-a", Language: "python", Deploy: "helm", CI: "gitlab", Port: 9000},
+	} {
+		files, err := h.Render(p)
+		if err != nil {
+			t.Fatalf("%+v: unexpected error: %v", p, err)
+		}
+		if !strings.Contains(string(files["Dockerfile"]), fmt.Sprintf("EXPOSE %d", p.Port)) {
+			t.Errorf("%+v: unexpected Dockerfile %s", p, files["Dockerfile"])
+		}
+		// Every rendered YAML file must still parse; Helm templates are
+		// checked for their untouched {{ }} actions instead
+		for name, content := range files {
+			if strings.HasPrefix(name, "chart/templates/") {
+				if !strings.Contains(string(content), "{{ .Release.Name }}") {
+					t.Errorf("%s: expected helm actions to pass through", name)
+				}
+				continue
+			}
+			if strings.HasSuffix(name, ".yaml") || strings.HasSuffix(name, ".yml") {
+				var v any
+				if err := yaml.Unmarshal(content, &v); err != nil {
+					t.Errorf("%+v: %s does not parse: %v", p, name, err)
+				}
+			}
+		}
+	}
+
+	files, _ := h.Render(Params{Name: "payments", Team: "team-a", Language: "go", Deploy: "helm", CI: "github", Port: 8080})
+	if !strings.Contains(string(files["chart/values.yaml"]), "repository: registry.internal/team-a/payments") {
+		t.Errorf("unexpected values.yaml %s", files["chart/values.yaml"])
+	}
+	if _, ok := files[".github/workflows/ci.yaml"]; !ok {
+		t.Errorf("expected a GitHub workflow, got %v", files)
+	}
+}
+
+func TestScaffoldTarball(t *testing.T) {
+	mux := newMux(nil)
+
+	if rec := post(mux, `{"name":"Payments","team":"team-a"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid name, got %d", rec.Code)
+	}
+	if rec := post(mux, `{"name":"payments","team":"team-a","language":"cobol"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown language, got %d", rec.Code)
+	}
+	if rec := post(mux, `{"name":"payments","team":"team-a","output":"git"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a git remote, got %d", rec.Code)
+	}
+
+	rec := post(mux, `{"name":"payments","team":"team-a"}`)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/gzip" {
+		t.Fatalf("expected a tarball, got %d: %s", rec.Code, rec.Body.String())
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var names []string
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		names = append(names, hdr.Name)
+	}
+	want := "payments/.dockerignore payments/.github/workflows/ci.yaml payments/Dockerfile payments/README.md " +
+		"payments/deploy/deployment.yaml payments/deploy/kustomization.yaml payments/deploy/service.yaml " +
+		"payments/go.mod payments/main.go"
+	if strings.Join(names, " ") != want {
+		t.Errorf("unexpected archive contents %v", names)
+	}
+}
+
+// gitServer serves a bare repository with one commit on main and a
+// scaffold/taken branch through git http-backend, requiring token as the
+// basic auth password.
+func gitServer(t *testing.T, token string) (*httptest.Server, *gogit.Repository) {
+	t.Helper()
+	bin, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+	root, work := t.TempDir(), t.TempDir()
+	bare := filepath.Join(root, "services.git")
+	for _, args := range [][]string{
+		{"init", "--bare", "-b", "main", bare},
+		{"-C", bare, "config", "http.receivepack", "true"},
+		{"init", "-b", "main", work},
+		{"-C", work, "-c", "user.name=acme", "-c", "user.email=acme@example.com", "commit", "--allow-empty", "-m", "Initial commit"},
+		{"-C", work, "push", bare, "main", "main:scaffold/taken"},
+	} {
+		if out, err := exec.Command(bin, args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	backend := &cgi.Handler{
+		Path: bin,
+		Args: []string{"http-backend"},
+		Env:  []string{"GIT_PROJECT_ROOT=" + root, "GIT_HTTP_EXPORT_ALL=1", "REMOTE_USER=platform"},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pass, _ := r.BasicAuth(); pass != token {
+			w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		backend.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	repo, err := gogit.PlainOpen(bare)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	return srv, repo
+}
+
+func TestScaffoldPush(t *testing.T) {
+	srv, repo := gitServer(t, "s3cret")
+	main, _ := repo.Reference(plumbing.NewBranchReferenceName("main"), false)
+	base := main.Hash()
+
+	var calls []string
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+	mux := newMux(&Remote{URL: srv.URL + "/services.git", BaseBranch: "main", Token: "s3cret", AuthorName: "Platform", AuthorEmail: "platform@example.com", Client: client})
+
+	rec := post(mux, `{"name":"payments","team":"team-a","deploy":"helm","output":"git"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+
+	ref, err := repo.Reference("refs/heads/scaffold/payments", false)
+	if err != nil {
+		t.Fatalf("expected the branch pushed: %v", err)
+	}
+	if ref.Hash().String() != resp["commit"] || resp["repository"] != srv.URL+"/services.git" {
+		t.Errorf("expected the branch at the commit answered, got %s and %v", ref.Hash(), resp)
+	}
+	commit, _ := repo.CommitObject(ref.Hash())
+	if len(commit.ParentHashes) != 1 || commit.ParentHashes[0] != base || commit.Author.Name != "Platform" {
+		t.Errorf("expected a commit by Platform on the base branch, got %+v", commit)
+	}
+	tree, _ := commit.Tree()
+	if _, err := tree.File("payments/Dockerfile"); err != nil {
+		t.Error("expected the skeleton under payments/")
+	}
+	if joined := strings.Join(calls, ","); !strings.Contains(joined, "POST /services.git/git-upload-pack") ||
+		!strings.Contains(joined, "POST /services.git/git-receive-pack") {
+		t.Errorf("expected clone and push through the configured client, got %v", calls)
+	}
+
+	if rec := post(mux, `{"name":"payments","team":"team-a","output":"git","branch":"scaffold/taken"}`); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 for an existing branch, got %d", rec.Code)
+	}
+	if rec := post(mux, `{"name":"payments","team":"team-a","output":"git","branch":"a..b"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid branch, got %d", rec.Code)
+	}
+
+	// A wrong token is a failed push, not a conflict
+	mux = newMux(&Remote{URL: srv.URL + "/services.git", BaseBranch: "main", Token: "wrong"})
+	if rec := post(mux, `{"name":"orders","team":"team-a","output":"git"}`); rec.Code != http.StatusBadGateway {
+		t.Errorf("expected 502 for a rejected token, got %d", rec.Code)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
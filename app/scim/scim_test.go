@@ -0,0 +1,64 @@
+package scim
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func newSCIM(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/scim/v2/Users" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/scim+json")
+		switch r.URL.Query().Get("filter") {
+		case `userName eq "alice"`:
+			w.Write([]byte(`{"totalResults":1,"Resources":[{"userName":"alice","groups":[
+				{"value":"1","display":"platform-admins"},{"value":"2","display":"developers"}]}]}`))
+		case `userName eq "Bob"`:
+			// Matched case-insensitively
+			w.Write([]byte(`{"totalResults":1,"Resources":[{"userName":"bob","groups":[{"display":"platform-admins"}]}]}`))
+		case `userName eq "eve\" or userName pr \""`:
+			w.Write([]byte(`{"totalResults":0,"Resources":[]}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGroups(t *testing.T) {
+	srv := newSCIM(t)
+	c := NewClient(srv.URL+"/scim/v2/", "secret", srv.Client())
+	ctx := context.Background()
+
+	groups, err := c.Groups(ctx, "alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(groups, []string{"platform-admins", "developers"}) {
+		t.Errorf("expected alice's groups, got %v", groups)
+	}
+	if groups, err := c.Groups(ctx, "Bob"); err != nil || groups != nil {
+		t.Errorf("expected no groups for a differently cased user, got %v %v", groups, err)
+	}
+	if groups, err := c.Groups(ctx, `eve" or userName pr "`); err != nil || groups != nil {
+		t.Errorf("expected the quote to be escaped, got %v %v", groups, err)
+	}
+
+	var apiErr *APIError
+	if _, err := NewClient(srv.URL+"/scim/v2", "wrong", srv.Client()).Groups(ctx, "alice"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected a 401 APIError, got %v", err)
+	}
+}
@@ -0,0 +1,277 @@
+// Package search serves /api/v1/search: one query across the platform's
+// entities, returning typed results best match first. Tenants and services
+// come from the store (PostgreSQL full-text search, or the memory store's
+// index), namespaces from the informer cache and catalog items from the
+// API server. Every source matches each query term as a word or word
+// prefix.
+package search
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	platformv1alpha1 "github.com/virenpatel/k8s-platform-engineering-lab/app/api/v1alpha1"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/workpool"
+)
+
+// Result types besides store.SearchTenant and store.SearchService.
+const (
+	TypeNamespace   = "namespace"
+	TypeCatalogItem = "catalog_item"
+)
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+// Source finds entities of its types. store.SearchRepository is one.
+type Source interface {
+	// Search returns up to limit (0 for all) matches of query, best first.
+	Search(ctx context.Context, query string, limit int) ([]store.SearchHit, error)
+}
+
+type source struct {
+	Source
+	types []string
+}
+
+// Handler serves GET /api/v1/search.
+type Handler struct {
+	sources []source
+	logger  *zap.Logger
+}
+
+// New creates a handler without sources; see Add.
+func New(logger *zap.Logger) *Handler {
+	return &Handler{logger: logger}
+}
+
+// Add searches src for results of types.
+func (h *Handler) Add(src Source, types ...string) {
+	h.sources = append(h.sources, source{Source: src, types: types})
+}
+
+// Register mounts the endpoint on mux.
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/search", h.search)
+}
+
+// response is a ranked list of results.
+type response struct {
+	Items []store.SearchHit `json:"items"`
+	// Unavailable lists the types whose source failed; the results lack
+	// them.
+	Unavailable []string `json:"unavailable,omitempty"`
+}
+
+// search handles GET /api/v1/search?q=&type=&limit=. type is a
+// comma-separated list restricting the result types.
+func (h *Handler) search(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	query := strings.TrimSpace(q.Get("q"))
+	if query == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+	limit := defaultLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	var wanted []string
+	if v := q.Get("type"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			if !h.known(t) {
+				http.Error(w, fmt.Sprintf("unknown type %q", t), http.StatusBadRequest)
+				return
+			}
+			wanted = append(wanted, t)
+		}
+	}
+
+	resp := response{Items: []store.SearchHit{}}
+	for _, src := range h.sources {
+		n := limit
+		if len(wanted) > 0 {
+			if !slices.ContainsFunc(src.types, func(t string) bool { return slices.Contains(wanted, t) }) {
+				continue
+			}
+			// Filtering out some of the source's types could leave fewer
+			// than limit of the others
+			if slices.ContainsFunc(src.types, func(t string) bool { return !slices.Contains(wanted, t) }) {
+				n = 0
+			}
+		}
+		hits, err := src.Search(r.Context(), query, n)
+		if err != nil {
+			h.logger.Warn("search source failed", zap.Strings("types", src.types), zap.Error(err))
+			resp.Unavailable = append(resp.Unavailable, src.types...)
+			continue
+		}
+		for _, hit := range hits {
+			if len(wanted) == 0 || slices.Contains(wanted, hit.Type) {
+				resp.Items = append(resp.Items, hit)
+			}
+		}
+	}
+	resp.Items = rank(resp.Items, limit)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) known(typ string) bool {
+	for _, src := range h.sources {
+		if slices.Contains(src.types, typ) {
+			return true
+		}
+	}
+	return false
+}
+
+// rank orders hits best first, then by name, and keeps up to limit (0 for
+// all).
+func rank(hits []store.SearchHit, limit int) []store.SearchHit {
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Rank != hits[j].Rank {
+			return hits[i].Rank > hits[j].Rank
+		}
+		if hits[i].Name != hits[j].Name {
+			return hits[i].Name < hits[j].Name
+		}
+		return hits[i].Type < hits[j].Type
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// Pooled returns src with its searches run on workers. Use it for sources
+// that rank in memory, such as Namespaces and the memory store, rather
+// than ones waiting on a database or the API server.
+func Pooled(src Source, workers *workpool.Pool) Source {
+	return pooled{src: src, workers: workers}
+}
+
+type pooled struct {
+	src     Source
+	workers *workpool.Pool
+}
+
+func (p pooled) Search(ctx context.Context, query string, limit int) (hits []store.SearchHit, err error) {
+	err = p.workers.Do(ctx, "search", func() (err error) {
+		hits, err = p.src.Search(ctx, query, limit)
+		return err
+	})
+	return hits, err
+}
+
+// namespaces searches namespace names and label values in the informer
+// cache.
+type namespaces struct {
+	lister  corelisters.NamespaceLister
+	allowed map[string]bool
+}
+
+// Namespaces returns a source of the namespaces in factory's cache,
+// registering the Namespace informer; the factory must be started
+// afterwards. An empty allowed list allows all namespaces.
+func Namespaces(factory informers.SharedInformerFactory, allowed []string) Source {
+	s := &namespaces{lister: factory.Core().V1().Namespaces().Lister()}
+	if len(allowed) > 0 {
+		s.allowed = make(map[string]bool, len(allowed))
+		for _, ns := range allowed {
+			s.allowed[ns] = true
+		}
+	}
+	return s
+}
+
+func (s *namespaces) Search(ctx context.Context, query string, limit int) ([]store.SearchHit, error) {
+	terms := store.SearchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	list, err := s.lister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	var hits []store.SearchHit
+	for _, ns := range list {
+		if s.allowed != nil && !s.allowed[ns.Name] {
+			continue
+		}
+		values := make([]string, 0, len(ns.Labels))
+		for _, v := range ns.Labels {
+			values = append(values, v)
+		}
+		if r := store.MatchRank(terms, ns.Name, values...); r > 0 {
+			hits = append(hits, store.SearchHit{Type: TypeNamespace, ID: ns.Name, Name: ns.Name, Rank: r})
+		}
+	}
+	return rank(hits, limit), nil
+}
+
+// catalogItems searches the CatalogItems offered for provisioning.
+type catalogItems struct {
+	client client.Client
+}
+
+// CatalogItems returns a source of the CatalogItems c lists, leaving out
+// deprecated ones as the catalog does by default. c must have the
+// platform.io types in its scheme.
+func CatalogItems(c client.Client) Source {
+	return catalogItems{client: c}
+}
+
+func (s catalogItems) Search(ctx context.Context, query string, limit int) ([]store.SearchHit, error) {
+	terms := store.SearchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	var list platformv1alpha1.CatalogItemList
+	if err := s.client.List(ctx, &list); err != nil {
+		return nil, err
+	}
+	var hits []store.SearchHit
+	for _, ci := range list.Items {
+		if ci.Spec.Deprecated {
+			continue
+		}
+		text := append([]string{ci.Spec.DisplayName, ci.Spec.Description, ci.Spec.Category, ci.Spec.Owner}, ci.Spec.Tags...)
+		if r := store.MatchRank(terms, ci.Name, text...); r > 0 {
+			hits = append(hits, store.SearchHit{
+				Type:        TypeCatalogItem,
+				ID:          ci.Name,
+				Name:        ci.Name,
+				Title:       ci.Spec.DisplayName,
+				Description: ci.Spec.Description,
+				Rank:        r,
+			})
+		}
+	}
+	return rank(hits, limit), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
@@ -0,0 +1,119 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	platformv1alpha1 "github.com/virenpatel/k8s-platform-engineering-lab/app/api/v1alpha1"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+type failing struct{}
+
+func (failing) Search(ctx context.Context, query string, limit int) ([]store.SearchHit, error) {
+	return nil, errors.New("unreachable")
+}
+
+func newMux(t *testing.T) *http.ServeMux {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	st := store.NewMemory()
+	for _, tn := range []store.Tenant{
+		{ID: "payments", Name: "payments", DisplayName: "Payments", Owner: "team-payments"},
+		{ID: "search", Name: "search", DisplayName: "Search", Owner: "team-search"},
+	} {
+		if err := st.Tenants.Create(ctx, &tn); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	st.Services.Create(ctx, &store.Service{ID: "ledger", TenantID: "payments", Name: "ledger", Description: "Double-entry payments ledger"})
+
+	factory := informers.NewSharedInformerFactory(kubefake.NewClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "payments-prod", Labels: map[string]string{"tenant": "payments"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}},
+	), 0)
+	scheme := runtime.NewScheme()
+	if err := platformv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	catalog := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&platformv1alpha1.CatalogItem{ObjectMeta: metav1.ObjectMeta{Name: "postgres"}, Spec: platformv1alpha1.CatalogItemSpec{DisplayName: "PostgreSQL", Tags: []string{"payments"}}},
+		&platformv1alpha1.CatalogItem{ObjectMeta: metav1.ObjectMeta{Name: "payments-queue"}, Spec: platformv1alpha1.CatalogItemSpec{Deprecated: true}},
+	).Build()
+
+	h := New(zap.NewNop())
+	h.Add(st.Search, store.SearchTenant, store.SearchService)
+	h.Add(Namespaces(factory, []string{"payments-prod"}), TypeNamespace)
+	h.Add(CatalogItems(catalog), TypeCatalogItem)
+	h.Add(failing{}, "repository")
+	t.Cleanup(func() {
+		cancel()
+		factory.Shutdown()
+	})
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+
+	mux := http.NewServeMux()
+	h.Register(mux)
+	return mux
+}
+
+func get(t *testing.T, mux *http.ServeMux, url string) (int, response) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	var resp response
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+	}
+	return rec.Code, resp
+}
+
+func TestSearch(t *testing.T) {
+	mux := newMux(t)
+
+	_, resp := get(t, mux, "/api/v1/search?q=pay")
+	var got []string
+	for _, hit := range resp.Items {
+		got = append(got, hit.Type+"/"+hit.ID)
+	}
+	// Name prefixes rank above matches in the description, labels or tags
+	want := []string{"tenant/payments", "namespace/payments-prod", "service/ledger", "catalog_item/postgres"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+	if len(resp.Unavailable) != 1 || resp.Unavailable[0] != "repository" {
+		t.Errorf("expected the failed source reported, got %v", resp.Unavailable)
+	}
+
+	if _, resp := get(t, mux, "/api/v1/search?q=payments+ledger&type=service,namespace"); len(resp.Items) != 1 || resp.Items[0].ID != "ledger" {
+		t.Errorf("expected every term to match and the types to filter, got %+v", resp.Items)
+	}
+	if _, resp := get(t, mux, "/api/v1/search?q=kube"); len(resp.Items) != 0 {
+		t.Errorf("expected namespaces outside the allowed list to be hidden, got %+v", resp.Items)
+	}
+	for _, url := range []string{"/api/v1/search", "/api/v1/search?q=x&type=pods", "/api/v1/search?q=x&limit=1000"} {
+		if code, _ := get(t, mux, url); code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", url, code)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+var (
+	connections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_server_connections",
+		Help: "Open connections by listener and state (new, active, idle).",
+	}, []string{"listener", "state"})
+	connectionsAccepted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_server_connections_accepted_total",
+		Help: "Connections accepted by listener.",
+	}, []string{"listener"})
+	tlsHandshakeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_server_tls_handshake_errors_total",
+		Help: "Failed TLS handshakes by listener.",
+	}, []string{"listener"})
+)
+
+// connTracker follows every connection through http.ConnState transitions,
+// keeping per-state gauges for capacity planning.
+type connTracker struct {
+	listener string
+	open     atomic.Int64
+
+	mu     sync.Mutex
+	states map[net.Conn]http.ConnState
+}
+
+func newConnTracker(listener string) *connTracker {
+	return &connTracker{listener: listener, states: make(map[net.Conn]http.ConnState)}
+}
+
+// observe records a state transition; it is installed as http.Server.ConnState.
+func (t *connTracker) observe(c net.Conn, state http.ConnState) {
+	t.mu.Lock()
+	prev, known := t.states[c]
+	switch state {
+	case http.StateClosed, http.StateHijacked:
+		delete(t.states, c)
+	default:
+		t.states[c] = state
+	}
+	t.mu.Unlock()
+
+	if known {
+		connections.WithLabelValues(t.listener, prev.String()).Dec()
+	}
+
+	switch state {
+	case http.StateNew:
+		t.open.Add(1)
+		connectionsAccepted.WithLabelValues(t.listener).Inc()
+		connections.WithLabelValues(t.listener, state.String()).Inc()
+	case http.StateActive, http.StateIdle:
+		connections.WithLabelValues(t.listener, state.String()).Inc()
+	case http.StateClosed, http.StateHijacked:
+		if known {
+			t.open.Add(-1)
+		}
+	}
+}
+
+// errorLog adapts http.Server.ErrorLog to zap, counting TLS handshake
+// failures (which net/http only reports through this logger).
+func errorLog(listener string, logger *zap.Logger) *log.Logger {
+	return log.New(&errorLogWriter{listener: listener, logger: logger}, "", 0)
+}
+
+type errorLogWriter struct {
+	listener string
+	logger   *zap.Logger
+}
+
+func (w *errorLogWriter) Write(p []byte) (int, error) {
+	msg := string(bytes.TrimSpace(p))
+	if bytes.Contains(p, []byte("TLS handshake error")) {
+		tlsHandshakeErrors.WithLabelValues(w.listener).Inc()
+		// Scanners and health checkers make these noisy; keep them at debug
+		w.logger.Debug("tls handshake failed", zap.String("error", msg))
+		return len(p), nil
+	}
+	w.logger.Warn("http server error", zap.String("error", msg))
+	return len(p), nil
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestConnTracker(t *testing.T) {
+	tracker := newConnTracker("test")
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	tracker.observe(a, http.StateNew)
+	tracker.observe(b, http.StateNew)
+	tracker.observe(a, http.StateActive)
+	tracker.observe(a, http.StateIdle)
+
+	if got := tracker.open.Load(); got != 2 {
+		t.Errorf("expected 2 open conns, got %d", got)
+	}
+	if got := testutil.ToFloat64(connections.WithLabelValues("test", "idle")); got != 1 {
+		t.Errorf("expected 1 idle conn, got %v", got)
+	}
+	if got := testutil.ToFloat64(connections.WithLabelValues("test", "new")); got != 1 {
+		t.Errorf("expected 1 new conn, got %v", got)
+	}
+
+	tracker.observe(a, http.StateClosed)
+	tracker.observe(b, http.StateHijacked)
+
+	if got := tracker.open.Load(); got != 0 {
+		t.Errorf("expected 0 open conns, got %d", got)
+	}
+	if got := testutil.ToFloat64(connectionsAccepted.WithLabelValues("test")); got != 2 {
+		t.Errorf("expected 2 accepted conns, got %v", got)
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestMultiplexGRPC(t *testing.T) {
+	srv := New("test", &http.Server{
+		Addr: "127.0.0.1:0",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("http"))
+		}),
+	}, zap.NewNop())
+
+	g := grpc.NewServer()
+	healthpb.RegisterHealthServer(g, health.NewServer())
+	srv.MultiplexGRPC(g)
+
+	if err := srv.Listen(ListenOptions{}); err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	srv.Start()
+	defer func() {
+		g.Stop()
+		srv.Shutdown(context.Background())
+	}()
+	addr := srv.listener.Addr().String()
+
+	// HTTP/1.1 reaches the HTTP handler
+	resp, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatalf("http request: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "http" {
+		t.Errorf("expected 'http', got '%s'", body)
+	}
+
+	// gRPC reaches the gRPC server on the same port
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("grpc dial: %v", err)
+	}
+	defer conn.Close()
+
+	hc, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("health check: %v", err)
+	}
+	if hc.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("expected SERVING, got %s", hc.Status)
+	}
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Environment variables used to hand listeners from a parent process to its
+// replacement during a zero-downtime restart.
+const (
+	// inheritedListenersEnv maps listener names to inherited file descriptors,
+	// e.g. "public=3,admin=4".
+	inheritedListenersEnv = "PLATFORM_INHERITED_LISTENERS"
+	// restartReadyFDEnv names the pipe the child writes to once it is serving.
+	restartReadyFDEnv = "PLATFORM_RESTART_READY_FD"
+)
+
+// inheritedListener returns the listener passed down by a parent process for
+// name, if any.
+func inheritedListener(name string) (net.Listener, error) {
+	for _, entry := range strings.Split(os.Getenv(inheritedListenersEnv), ",") {
+		n, fdStr, ok := strings.Cut(entry, "=")
+		if !ok || n != name {
+			continue
+		}
+		fd, err := strconv.Atoi(fdStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid inherited fd %q for %s: %w", fdStr, name, err)
+		}
+		f := os.NewFile(uintptr(fd), name)
+		defer f.Close()
+		return net.FileListener(f)
+	}
+	return nil, nil
+}
+
+// Restart starts a new copy of the running binary that inherits the listening
+// sockets of servers, and blocks until the child reports it is serving or
+// timeout elapses. On success the caller should flip readiness and drain.
+func Restart(logger *zap.Logger, timeout time.Duration, servers ...*Server) (*os.Process, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("resolve executable: %w", err)
+	}
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("create ready pipe: %w", err)
+	}
+	defer readyR.Close()
+
+	// ExtraFiles[i] becomes fd 3+i in the child
+	files := []*os.File{readyW}
+	var mapping []string
+	for _, s := range servers {
+		f, err := s.listenerFile()
+		if err != nil {
+			readyW.Close()
+			closeFiles(files[1:])
+			return nil, fmt.Errorf("export %s listener: %w", s.name, err)
+		}
+		files = append(files, f)
+		mapping = append(mapping, fmt.Sprintf("%s=%d", s.name, 2+len(files)))
+	}
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(),
+		inheritedListenersEnv+"="+strings.Join(mapping, ","),
+		restartReadyFDEnv+"=3",
+	)
+
+	err = cmd.Start()
+	readyW.Close()
+	closeFiles(files[1:])
+	if err != nil {
+		return nil, fmt.Errorf("start replacement process: %w", err)
+	}
+	logger.Info("replacement process started", zap.Int("pid", cmd.Process.Pid))
+
+	ready := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		_, err := readyR.Read(buf)
+		ready <- err
+	}()
+
+	select {
+	case err := <-ready:
+		if err != nil {
+			cmd.Process.Kill()
+			return nil, fmt.Errorf("replacement process exited before becoming ready: %w", err)
+		}
+		return cmd.Process, nil
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		return nil, errors.New("timed out waiting for replacement process")
+	}
+}
+
+// NotifyRestartReady tells the parent process (if this process was started by
+// Restart) that all listeners are serving and it can begin draining.
+func NotifyRestartReady() error {
+	fdStr := os.Getenv(restartReadyFDEnv)
+	if fdStr == "" {
+		return nil
+	}
+	os.Unsetenv(restartReadyFDEnv)
+	os.Unsetenv(inheritedListenersEnv)
+
+	fd, err := strconv.Atoi(fdStr)
+	if err != nil {
+		return fmt.Errorf("invalid ready fd %q: %w", fdStr, err)
+	}
+	f := os.NewFile(uintptr(fd), "restart-ready")
+	defer f.Close()
+	_, err = f.Write([]byte{1})
+	return err
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
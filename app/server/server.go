@@ -0,0 +1,258 @@
+// Package server wraps http.Server with the start/stop lifecycle shared by
+// the public and admin listeners.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/soheilhy/cmux"
+	"go.uber.org/zap"
+)
+
+var drainingConns = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "http_server_draining_connections",
+	Help: "Connections still open while a listener shuts down.",
+}, []string{"listener"})
+
+// Server is a named HTTP listener.
+type Server struct {
+	name   string
+	http   *http.Server
+	logger *zap.Logger
+
+	listener net.Listener
+	conns    *connTracker
+
+	// Optional gRPC server sharing the listener via protocol detection
+	rpc RPCServer
+	mux cmux.CMux
+}
+
+// RPCServer is a gRPC server that can share the HTTP listener.
+type RPCServer interface {
+	Serve(net.Listener) error
+}
+
+// New wraps srv. The name is used in logs to tell listeners apart.
+func New(name string, srv *http.Server, logger *zap.Logger) *Server {
+	s := &Server{
+		name:   name,
+		http:   srv,
+		logger: logger.With(zap.String("listener", name)),
+		conns:  newConnTracker(name),
+	}
+
+	// Chain onto any existing ConnState hook
+	next := srv.ConnState
+	srv.ConnState = func(c net.Conn, state http.ConnState) {
+		s.conns.observe(c, state)
+		if next != nil {
+			next(c, state)
+		}
+	}
+	if srv.ErrorLog == nil {
+		srv.ErrorLog = errorLog(name, s.logger)
+	}
+	return s
+}
+
+// OpenConns returns the number of connections currently open.
+func (s *Server) OpenConns() int64 {
+	return s.conns.open.Load()
+}
+
+// DisableKeepAlives stops reusing connections so clients reconnect (and get
+// routed to another endpoint) on their next request. Call it after readiness
+// is flipped, before Shutdown.
+func (s *Server) DisableKeepAlives() {
+	s.http.SetKeepAlivesEnabled(false)
+	s.logger.Info("keep-alives disabled", zap.Int64("open_conns", s.OpenConns()))
+}
+
+// Name returns the listener name.
+func (s *Server) Name() string {
+	return s.name
+}
+
+// Addr returns the address the listener is bound to, nil before Listen.
+// With port 0 in the configured address it tells which port was picked.
+func (s *Server) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// HTTP exposes the underlying http.Server for further tuning.
+func (s *Server) HTTP() *http.Server {
+	return s.http
+}
+
+// ListenOptions tunes the listening socket.
+type ListenOptions struct {
+	// ReusePort sets SO_REUSEPORT so a replacement process can bind the port.
+	ReusePort bool
+	// KeepAlive is the TCP keep-alive period for accepted connections
+	// (0 uses the Go default, negative disables keep-alive probes).
+	KeepAlive time.Duration
+	// MaxConns caps concurrently open connections (0 means unlimited).
+	MaxConns int
+}
+
+// Listen binds the listening socket. A socket handed down by a parent process
+// during a zero-downtime restart is reused; otherwise a new one is bound.
+func (s *Server) Listen(opts ListenOptions) error {
+	ln, err := inheritedListener(s.name)
+	if err != nil {
+		return err
+	}
+	if ln != nil {
+		s.logger.Info("inherited listener from parent process", zap.String("addr", ln.Addr().String()))
+	} else {
+		lc := net.ListenConfig{KeepAlive: opts.KeepAlive}
+		if opts.ReusePort {
+			lc.Control = reusePortControl
+		}
+		ln, err = lc.Listen(context.Background(), "tcp", s.http.Addr)
+		if err != nil {
+			return fmt.Errorf("listen %s on %s: %w", s.name, s.http.Addr, err)
+		}
+	}
+
+	if opts.MaxConns > 0 {
+		ln = newLimitListener(ln, opts.MaxConns)
+	}
+	s.listener = ln
+	return nil
+}
+
+// MultiplexGRPC serves rpc on the same port as HTTP, routing connections by
+// protocol: HTTP/2 requests with a gRPC content type go to rpc, everything
+// else to the HTTP handler. Must be called before Start. Only supported on
+// plaintext listeners (TLS terminated by a sidecar or ingress).
+func (s *Server) MultiplexGRPC(rpc RPCServer) {
+	s.rpc = rpc
+}
+
+// Start begins serving in the background, binding the socket first if Listen
+// was not called. A listener that fails to start is fatal: a pod without its
+// probe or API port is useless.
+func (s *Server) Start() {
+	if s.listener == nil {
+		if err := s.Listen(ListenOptions{}); err != nil {
+			s.logger.Fatal("server failed to start", zap.Error(err))
+		}
+	}
+
+	httpListener := s.listener
+	if s.rpc != nil {
+		if s.http.TLSConfig != nil {
+			s.logger.Fatal("gRPC multiplexing is not supported on TLS listeners")
+		}
+		s.mux = cmux.New(s.listener)
+		grpcListener := s.mux.MatchWithWriters(
+			cmux.HTTP2MatchHeaderFieldSendSettings("content-type", "application/grpc"),
+		)
+		httpListener = s.mux.Match(cmux.Any())
+
+		go func() {
+			if err := s.rpc.Serve(grpcListener); err != nil && !isClosed(err) {
+				s.logger.Error("grpc server failed", zap.Error(err))
+			}
+		}()
+		go func() {
+			if err := s.mux.Serve(); err != nil && !isClosed(err) {
+				s.logger.Error("protocol multiplexer failed", zap.Error(err))
+			}
+		}()
+	}
+
+	go func() {
+		s.logger.Info("server listening",
+			zap.String("addr", s.listener.Addr().String()),
+			zap.Bool("tls", s.http.TLSConfig != nil),
+			zap.Bool("grpc", s.rpc != nil),
+		)
+		if err := s.serve(httpListener); err != nil && !isClosed(err) {
+			s.logger.Fatal("server failed", zap.Error(err))
+		}
+	}()
+}
+
+// isClosed reports whether err just means the listener was shut down. With
+// multiplexing, whichever of HTTP or gRPC stops first closes the shared socket
+// under the other.
+func isClosed(err error) bool {
+	return errors.Is(err, http.ErrServerClosed) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, cmux.ErrListenerClosed) ||
+		errors.Is(err, cmux.ErrServerClosed)
+}
+
+func (s *Server) serve(ln net.Listener) error {
+	if s.http.TLSConfig != nil {
+		// Certificates come from TLSConfig (GetCertificate or Certificates)
+		return s.http.ServeTLS(ln, "", "")
+	}
+	return s.http.Serve(ln)
+}
+
+func (s *Server) reportDrain(done <-chan struct{}) {
+	gauge := drainingConns.WithLabelValues(s.name)
+	gauge.Set(float64(s.OpenConns()))
+	defer gauge.Set(0)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			remaining := s.OpenConns()
+			gauge.Set(float64(remaining))
+			s.logger.Info("draining", zap.Int64("remaining_conns", remaining))
+		}
+	}
+}
+
+// listenerFile returns a dup of the listening socket for passing to a child.
+func (s *Server) listenerFile() (*os.File, error) {
+	ln := s.listener
+	if ll, ok := ln.(*limitListener); ok {
+		ln = ll.Listener
+	}
+	tl, ok := ln.(*net.TCPListener)
+	if !ok {
+		return nil, fmt.Errorf("listener %s is not a TCP listener", s.name)
+	}
+	return tl.File()
+}
+
+// Shutdown gracefully stops the listener, waiting for in-flight requests
+// until ctx expires. Drain progress is logged and exported every second.
+func (s *Server) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	defer close(done)
+	go s.reportDrain(done)
+
+	err := s.http.Shutdown(ctx)
+	if s.mux != nil {
+		// Closes the shared root listener once HTTP has drained
+		s.mux.Close()
+	}
+	if err != nil {
+		s.logger.Error("forced shutdown", zap.Error(err))
+		return err
+	}
+	s.logger.Info("server stopped")
+	return nil
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// HostRouter dispatches requests to a handler chosen by the Host header, so
+// several logical APIs (api.internal, portal.internal) with their own route
+// tables and middleware chains can share one listener.
+type HostRouter struct {
+	exact    map[string]http.Handler
+	wildcard map[string]http.Handler // keyed by suffix, e.g. ".example.com"
+	fallback http.Handler
+}
+
+// NewHostRouter returns a router that sends unmatched hosts to fallback.
+func NewHostRouter(fallback http.Handler) *HostRouter {
+	return &HostRouter{
+		exact:    make(map[string]http.Handler),
+		wildcard: make(map[string]http.Handler),
+		fallback: fallback,
+	}
+}
+
+// Handle routes host to h. A leading "*." matches any subdomain.
+func (hr *HostRouter) Handle(host string, h http.Handler) {
+	host = strings.ToLower(host)
+	if suffix, ok := strings.CutPrefix(host, "*"); ok {
+		hr.wildcard[suffix] = h
+		return
+	}
+	hr.exact[host] = h
+}
+
+func (hr *HostRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	hr.match(r.Host).ServeHTTP(w, r)
+}
+
+func (hr *HostRouter) match(host string) http.Handler {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	if h, ok := hr.exact[host]; ok {
+		return h
+	}
+	// Longest matching wildcard suffix wins
+	var best http.Handler
+	bestLen := 0
+	for suffix, h := range hr.wildcard {
+		if strings.HasSuffix(host, suffix) && len(suffix) > bestLen {
+			best, bestLen = h, len(suffix)
+		}
+	}
+	if best != nil {
+		return best
+	}
+	return hr.fallback
+}
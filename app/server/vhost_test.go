@@ -0,0 +1,40 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func named(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name))
+	})
+}
+
+func TestHostRouter(t *testing.T) {
+	router := NewHostRouter(named("default"))
+	router.Handle("api.internal", named("api"))
+	router.Handle("*.portal.internal", named("portal"))
+
+	tests := []struct {
+		host     string
+		expected string
+	}{
+		{"api.internal", "api"},
+		{"API.internal:9090", "api"},
+		{"team-a.portal.internal", "portal"},
+		{"portal.internal", "default"},
+		{"unknown.internal", "default"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = tt.host
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Body.String() != tt.expected {
+			t.Errorf("host %s: expected '%s', got '%s'", tt.host, tt.expected, rec.Body.String())
+		}
+	}
+}
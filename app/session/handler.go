@@ -0,0 +1,160 @@
+package session
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+)
+
+// flowTimeout bounds a sign-in, from /auth/login to the callback.
+const flowTimeout = 10 * time.Minute
+
+// flow is a sign-in in progress, kept in a cookie sealed like the
+// session cookie.
+type flow struct {
+	State    string    `json:"state"`
+	Nonce    string    `json:"nonce"`
+	Verifier string    `json:"verifier"`
+	Redirect string    `json:"redirect"`
+	Expires  time.Time `json:"expires"`
+}
+
+func (m *Manager) flowCookie() string {
+	return m.opts.CookieName + "_flow"
+}
+
+// Register mounts the sign-in endpoints on mux:
+//
+//	GET  /auth/login?redirect=/path   start signing in with the provider
+//	GET  /auth/callback               the provider's redirect back
+//	GET  /auth/session                the caller's session and CSRF token
+//	POST /auth/logout                 end the session
+func (m *Manager) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /auth/login", m.login)
+	mux.HandleFunc("GET /auth/callback", m.callback)
+	mux.HandleFunc("GET /auth/session", m.session)
+	mux.HandleFunc("POST /auth/logout", m.logout)
+}
+
+// localRedirect returns target if it is a path on this site, or "/", so
+// that sign-in cannot be used to send users elsewhere.
+func localRedirect(target string) string {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.Contains(target, "\\") {
+		return "/"
+	}
+	return target
+}
+
+func (m *Manager) login(w http.ResponseWriter, r *http.Request) {
+	f := flow{Redirect: localRedirect(r.URL.Query().Get("redirect")), Expires: m.now().Add(flowTimeout)}
+	for _, v := range []*string{&f.State, &f.Nonce, &f.Verifier} {
+		var err error
+		if *v, err = randomString(); err != nil {
+			m.fail(w, "failed to start sign-in", err)
+			return
+		}
+	}
+	target, err := m.provider.AuthURL(r.Context(), f.State, f.Nonce, f.Verifier)
+	if err != nil {
+		m.fail(w, "failed to start sign-in", err)
+		return
+	}
+	data, _ := json.Marshal(f)
+	sealed, err := m.seal(m.flowCookie(), data)
+	if err != nil {
+		m.fail(w, "failed to start sign-in", err)
+		return
+	}
+	m.setCookie(w, m.flowCookie(), sealed, "/auth/", f.Expires)
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+func (m *Manager) callback(w http.ResponseWriter, r *http.Request) {
+	var f flow
+	c, err := r.Cookie(m.flowCookie())
+	if err == nil {
+		data, ok := m.open(m.flowCookie(), c.Value)
+		if !ok || json.Unmarshal(data, &f) != nil {
+			f = flow{}
+		}
+	}
+	m.clearCookie(w, m.flowCookie(), "/auth/")
+	q := r.URL.Query()
+	switch {
+	case f.State == "" || !m.now().Before(f.Expires):
+		http.Error(w, "sign-in expired; start again", http.StatusBadRequest)
+		return
+	case subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(f.State)) != 1:
+		http.Error(w, "sign-in state does not match", http.StatusBadRequest)
+		return
+	case q.Get("error") != "":
+		m.logger.Warn("sign-in refused by the identity provider",
+			zap.String("error", q.Get("error")), zap.String("description", q.Get("error_description")))
+		http.Error(w, "sign-in refused", http.StatusForbidden)
+		return
+	}
+	claims, err := m.provider.Exchange(r.Context(), q.Get("code"), f.Verifier, f.Nonce)
+	if err != nil {
+		m.logger.Warn("sign-in failed", zap.Error(err))
+		http.Error(w, "sign-in failed", http.StatusUnauthorized)
+		return
+	}
+	id := authz.Identity{User: claims.User, Groups: claims.Groups}
+	if _, err := m.Create(w, r, id, claims.Email); err != nil {
+		m.fail(w, "failed to create session", err)
+		return
+	}
+	m.audit(r, "signed in", id)
+	http.Redirect(w, r, f.Redirect, http.StatusFound)
+}
+
+func (m *Manager) session(w http.ResponseWriter, r *http.Request) {
+	s := FromContext(r.Context())
+	if s == nil {
+		http.Error(w, "not signed in", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, s)
+}
+
+func (m *Manager) logout(w http.ResponseWriter, r *http.Request) {
+	s := FromContext(r.Context())
+	if err := m.End(w, r); err != nil {
+		m.fail(w, "failed to end session", err)
+		return
+	}
+	if s != nil {
+		eventsTotal.WithLabelValues("logout").Inc()
+		m.audit(r, "signed out", authz.Identity{User: s.User, Groups: s.Groups})
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *Manager) audit(r *http.Request, msg string, id authz.Identity) {
+	m.logger.Info(msg,
+		zap.String("audit", "session"),
+		zap.String("request_id", middleware.GetRequestID(r.Context())),
+		zap.String("user", id.User),
+		zap.Strings("groups", id.Groups))
+}
+
+func (m *Manager) fail(w http.ResponseWriter, msg string, err error) {
+	eventsTotal.WithLabelValues("error").Inc()
+	m.logger.Error(msg, zap.Error(err))
+	http.Error(w, "internal error", http.StatusInternalServerError)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
@@ -0,0 +1,254 @@
+package session
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/jwks"
+)
+
+// ProviderConfig configures an OpenID Connect provider.
+type ProviderConfig struct {
+	// IssuerURL is the provider's issuer; its discovery document is at
+	// <IssuerURL>/.well-known/openid-configuration.
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the service's /auth/callback URL, as registered
+	// with the provider.
+	RedirectURL string
+	// Scopes are requested at sign-in (default openid, profile and email);
+	// "openid" is always added.
+	Scopes []string
+	// UserClaim names the ID token claim used as the user name (default
+	// "preferred_username", falling back to "sub"), and GroupsClaim the
+	// one listing the user's groups (default "groups").
+	UserClaim   string
+	GroupsClaim string
+	// Keys configures the cache of the provider's signing keys.
+	Keys jwks.Options
+}
+
+// Provider signs users in with the authorization code flow and PKCE.
+type Provider struct {
+	cfg  ProviderConfig
+	http *http.Client
+	keys *jwks.Cache
+	now  func() time.Time
+
+	mu        sync.Mutex
+	discovery *discovery
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the parts of an ID token a session needs.
+type Claims struct {
+	Subject string
+	User    string
+	Email   string
+	Groups  []string
+}
+
+// NewProvider creates a provider calling the issuer with hc. The discovery
+// document is fetched on first use.
+func NewProvider(cfg ProviderConfig, hc *http.Client, logger *zap.Logger) *Provider {
+	if cfg.UserClaim == "" {
+		cfg.UserClaim = "preferred_username"
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	}
+	if !slices.Contains(cfg.Scopes, "openid") {
+		cfg.Scopes = append([]string{"openid"}, cfg.Scopes...)
+	}
+	cfg.IssuerURL = strings.TrimSuffix(cfg.IssuerURL, "/")
+	p := &Provider{cfg: cfg, http: hc, now: time.Now}
+	p.keys = jwks.New("oidc", func(ctx context.Context) (string, error) {
+		d, err := p.discover(ctx)
+		if err != nil {
+			return "", err
+		}
+		return d.JWKSURI, nil
+	}, hc, cfg.Keys, logger)
+	return p
+}
+
+// Check fetches the discovery document and the signing keys, for the
+// readiness probe.
+func (p *Provider) Check(ctx context.Context) error {
+	if _, err := p.discover(ctx); err != nil {
+		return err
+	}
+	return p.keys.Check(ctx)
+}
+
+func (p *Provider) discover(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.IssuerURL+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var d discovery
+	if err := p.do(req, &d); err != nil {
+		return nil, fmt.Errorf("oidc: discovery: %w", err)
+	}
+	if d.Issuer != p.cfg.IssuerURL {
+		return nil, fmt.Errorf("oidc: discovery names issuer %q, expected %q", d.Issuer, p.cfg.IssuerURL)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery document lacks endpoints")
+	}
+	p.discovery = &d
+	return &d, nil
+}
+
+// AuthURL returns the provider's sign-in URL for a flow with state, nonce
+// and the PKCE verifier.
+func (p *Provider) AuthURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the ID token's
+// claims, after checking its signature against the provider's keys and
+// its issuer, audience, expiry and nonce.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := p.do(req, &tokens); err != nil {
+		return nil, fmt.Errorf("oidc: token exchange: %w", err)
+	}
+	return p.claims(ctx, tokens.IDToken, nonce)
+}
+
+func (p *Provider) claims(ctx context.Context, idToken, nonce string) (*Claims, error) {
+	payload, err := p.keys.Verify(ctx, idToken)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: ID token: %w", err)
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, errors.New("oidc: malformed ID token")
+	}
+	str := func(name string) string {
+		v, _ := raw[name].(string)
+		return v
+	}
+	var audience []string
+	switch aud := raw["aud"].(type) {
+	case string:
+		audience = []string{aud}
+	case []any:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				audience = append(audience, s)
+			}
+		}
+	}
+	exp, _ := raw["exp"].(float64)
+	switch {
+	case str("iss") != p.cfg.IssuerURL:
+		return nil, fmt.Errorf("oidc: ID token issued by %q", str("iss"))
+	case !slices.Contains(audience, p.cfg.ClientID):
+		return nil, errors.New("oidc: ID token is for another client")
+	case !p.now().Before(time.Unix(int64(exp), 0)):
+		return nil, errors.New("oidc: ID token expired")
+	case str("nonce") != nonce:
+		return nil, errors.New("oidc: ID token nonce does not match")
+	}
+	c := &Claims{Subject: str("sub"), User: str(p.cfg.UserClaim), Email: str("email")}
+	if c.User == "" {
+		c.User = c.Subject
+	}
+	if c.User == "" {
+		return nil, errors.New("oidc: ID token names no user")
+	}
+	if groups, ok := raw[p.cfg.GroupsClaim].([]any); ok {
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				c.Groups = append(c.Groups, s)
+			}
+		}
+	}
+	return c, nil
+}
+
+func (p *Provider) do(req *http.Request, out any) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body := io.LimitReader(resp.Body, 1<<20)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var e struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		json.NewDecoder(body).Decode(&e)
+		return fmt.Errorf("status %d: %s %s", resp.StatusCode, e.Error, e.Description)
+	}
+	return json.NewDecoder(body).Decode(out)
+}
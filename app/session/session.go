@@ -0,0 +1,480 @@
+// Package session signs browser users in to the portal with OpenID Connect
+// and keeps them signed in with a cookie. The cookie holds only the
+// session ID, encrypted and authenticated with the session secret; the
+// session itself (user, groups, CSRF token) lives in a Store, such as the
+// shared cache, so that every replica sees it. Sessions end after an idle
+// timeout or a maximum age, whichever comes first.
+//
+// The middleware turns a session into the identity headers the rest of
+// the service reads, as the authenticating proxy and personal access
+// tokens do. Requests with an Authorization header are left to token
+// authentication. Unsafe methods must echo the session's CSRF token in
+// the X-CSRF-Token header. A new session ID is issued on every sign-in and
+// whenever the user's privileges change, so that an ID captured before
+// is worth nothing after.
+package session
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/access"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/cache"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+)
+
+// CSRFHeader carries the session's CSRF token on unsafe requests.
+const CSRFHeader = "X-CSRF-Token"
+
+const (
+	// touchInterval limits how often a session's idle timeout is extended
+	// and its privileges checked.
+	touchInterval = time.Minute
+	// rotationGrace keeps a rotated session answering its old ID, for
+	// requests that were already in flight with the old cookie.
+	rotationGrace = 30 * time.Second
+)
+
+// ErrNotFound is returned by a Store for unknown or expired sessions.
+var ErrNotFound = errs.New(errs.NotFound, "session not found")
+
+var eventsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "session_events_total",
+	Help: "Portal session events (created, rotated, expired, csrf_rejected, logout or error).",
+}, []string{"event"})
+
+// Session is a signed-in browser user.
+type Session struct {
+	ID        string    `json:"-"`
+	User      string    `json:"user"`
+	Email     string    `json:"email,omitempty"`
+	Groups    []string  `json:"groups"`
+	CSRFToken string    `json:"csrf_token"`
+	CreatedAt time.Time `json:"created_at"`
+	// ExpiresAt is the end of the session's maximum age.
+	ExpiresAt time.Time `json:"expires_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	// Privileges fingerprints the user's roles when last checked.
+	Privileges string `json:"privileges,omitempty"`
+	// Successor is the session that replaced this one on rotation.
+	Successor string `json:"successor,omitempty"`
+}
+
+// Store keeps sessions by ID.
+type Store interface {
+	// Get returns the session id, or ErrNotFound.
+	Get(ctx context.Context, id string) (*Session, error)
+	// Save stores s, expiring it after ttl.
+	Save(ctx context.Context, s *Session, ttl time.Duration) error
+	Delete(ctx context.Context, id string) error
+}
+
+// cacheStore keeps sessions in a cache.Cache: process memory, or Redis
+// when replicas share sessions. Keys are hashes of the session IDs, so
+// that reading the cache does not yield usable IDs.
+type cacheStore struct {
+	c cache.Cache
+}
+
+// NewCacheStore creates a Store over c.
+func NewCacheStore(c cache.Cache) Store {
+	return cacheStore{c}
+}
+
+func (s cacheStore) key(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return "session:" + hex.EncodeToString(sum[:])
+}
+
+func (s cacheStore) Get(ctx context.Context, id string) (*Session, error) {
+	data, err := s.c.Get(ctx, s.key(id))
+	if errors.Is(err, cache.ErrMiss) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sess Session
+	if err := json.Unmarshal(data, &sess); err != nil {
+		return nil, fmt.Errorf("decode session: %w", err)
+	}
+	sess.ID = id
+	return &sess, nil
+}
+
+func (s cacheStore) Save(ctx context.Context, sess *Session, ttl time.Duration) error {
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	return s.c.Set(ctx, s.key(sess.ID), data, ttl)
+}
+
+func (s cacheStore) Delete(ctx context.Context, id string) error {
+	return s.c.Delete(ctx, s.key(id))
+}
+
+// Options configures a Manager.
+type Options struct {
+	// UserHeader and GroupsHeader carry the caller's identity; the
+	// middleware sets them from the session.
+	UserHeader   string
+	GroupsHeader string
+	// Secrets encrypt session cookies. The first encrypts; the others
+	// only decrypt, so that a secret can be replaced without signing
+	// everyone out. Each must be at least 32 bytes.
+	Secrets []string
+	// CookieName names the session cookie; default "platform_session".
+	CookieName string
+	// IdleTimeout ends sessions unused for that long, and MaxAge ends them
+	// regardless; defaults 1h and 12h.
+	IdleTimeout time.Duration
+	MaxAge      time.Duration
+	// SameSite is the cookies' SameSite mode; default Lax, which the
+	// OIDC redirect back from the identity provider needs.
+	SameSite http.SameSite
+	// Insecure drops the Secure attribute, for local development over
+	// plain HTTP.
+	Insecure bool
+	// Privileges, when set, fingerprints a user's privileges, e.g. their
+	// role names. The session is rotated when the fingerprint changes.
+	Privileges func(ctx context.Context, id authz.Identity) (string, error)
+}
+
+// Manager creates sessions and authenticates requests carrying them.
+type Manager struct {
+	store    Store
+	provider *Provider
+	opts     Options
+	aeads    []cipher.AEAD
+	logger   *zap.Logger
+	now      func() time.Time
+}
+
+// New creates a manager keeping sessions in store and signing users in
+// with provider.
+func New(store Store, provider *Provider, opts Options, logger *zap.Logger) (*Manager, error) {
+	if len(opts.Secrets) == 0 {
+		return nil, errors.New("session: a secret is required")
+	}
+	if opts.CookieName == "" {
+		opts.CookieName = "platform_session"
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = time.Hour
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = 12 * time.Hour
+	}
+	if opts.SameSite == 0 {
+		opts.SameSite = http.SameSiteLaxMode
+	}
+	m := &Manager{store: store, provider: provider, opts: opts, logger: logger, now: time.Now}
+	for _, secret := range opts.Secrets {
+		if len(secret) < 32 {
+			return nil, errors.New("session: secrets must be at least 32 bytes")
+		}
+		key := sha256.Sum256([]byte(secret))
+		block, err := aes.NewCipher(key[:])
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		m.aeads = append(m.aeads, aead)
+	}
+	return m, nil
+}
+
+// seal encrypts value for the cookie name, so that it cannot be read,
+// altered or moved to another cookie.
+func (m *Manager) seal(name string, value []byte) (string, error) {
+	aead := m.aeads[0]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, value, []byte(name))), nil
+}
+
+func (m *Manager) open(name, sealed string) ([]byte, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, false
+	}
+	for _, aead := range m.aeads {
+		if len(data) < aead.NonceSize() {
+			return nil, false
+		}
+		if value, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(name)); err == nil {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+func (m *Manager) setCookie(w http.ResponseWriter, name, value, path string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Expires:  expires,
+		Secure:   !m.opts.Insecure,
+		HttpOnly: true,
+		SameSite: m.opts.SameSite,
+	})
+}
+
+func (m *Manager) clearCookie(w http.ResponseWriter, name, path string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Path:     path,
+		MaxAge:   -1,
+		Secure:   !m.opts.Insecure,
+		HttpOnly: true,
+		SameSite: m.opts.SameSite,
+	})
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ttl is how long s stays in the store: until it idles out, but not past
+// its maximum age.
+func (m *Manager) ttl(s *Session) time.Duration {
+	return min(m.opts.IdleTimeout, s.ExpiresAt.Sub(m.now()))
+}
+
+// start saves a new session for id and sets its cookie. An empty csrf
+// gets a new CSRF token.
+func (m *Manager) start(ctx context.Context, w http.ResponseWriter, id authz.Identity, email, csrf string, createdAt, expiresAt time.Time) (*Session, error) {
+	sid, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	if csrf == "" {
+		if csrf, err = randomString(); err != nil {
+			return nil, err
+		}
+	}
+	now := m.now()
+	s := &Session{ID: sid, User: id.User, Email: email, Groups: id.Groups, CSRFToken: csrf,
+		CreatedAt: createdAt, ExpiresAt: expiresAt, LastSeen: now}
+	if m.opts.Privileges != nil {
+		if s.Privileges, err = m.opts.Privileges(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	if err := m.store.Save(ctx, s, m.ttl(s)); err != nil {
+		return nil, err
+	}
+	return s, m.setSessionCookie(w, s)
+}
+
+func (m *Manager) setSessionCookie(w http.ResponseWriter, s *Session) error {
+	cookie, err := m.seal(m.opts.CookieName, []byte(s.ID))
+	if err != nil {
+		return err
+	}
+	m.setCookie(w, m.opts.CookieName, cookie, "/", s.ExpiresAt)
+	return nil
+}
+
+// Create signs id in with a new session, ending the one the request
+// carries, if any.
+func (m *Manager) Create(w http.ResponseWriter, r *http.Request, id authz.Identity, email string) (*Session, error) {
+	if old, _ := m.cookieSession(r); old != "" {
+		if err := m.store.Delete(r.Context(), old); err != nil {
+			m.logger.Warn("failed to delete replaced session", zap.Error(err))
+		}
+	}
+	now := m.now()
+	s, err := m.start(r.Context(), w, id, email, "", now, now.Add(m.opts.MaxAge))
+	if err != nil {
+		return nil, err
+	}
+	eventsTotal.WithLabelValues("created").Inc()
+	return s, nil
+}
+
+// rotate replaces s with a session under a new ID, keeping its user,
+// expiry and CSRF token, so that pages already loaded keep working. The
+// old ID answers for rotationGrace longer.
+func (m *Manager) rotate(ctx context.Context, w http.ResponseWriter, s *Session) (*Session, error) {
+	next, err := m.start(ctx, w, authz.Identity{User: s.User, Groups: s.Groups}, s.Email, s.CSRFToken, s.CreatedAt, s.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	s.Successor = next.ID
+	if err := m.store.Save(ctx, s, min(rotationGrace, m.ttl(s))); err != nil {
+		m.logger.Warn("failed to retire rotated session", zap.Error(err))
+	}
+	eventsTotal.WithLabelValues("rotated").Inc()
+	return next, nil
+}
+
+// cookieSession returns the session ID in the request's cookie, or "".
+func (m *Manager) cookieSession(r *http.Request) (string, bool) {
+	c, err := r.Cookie(m.opts.CookieName)
+	if err != nil {
+		return "", false
+	}
+	id, ok := m.open(m.opts.CookieName, c.Value)
+	return string(id), ok
+}
+
+// Load returns the request's session, following a rotation to its
+// successor, and nil when there is none or it has ended.
+func (m *Manager) Load(ctx context.Context, r *http.Request) (*Session, error) {
+	id, ok := m.cookieSession(r)
+	if !ok {
+		return nil, nil
+	}
+	s, err := m.store.Get(ctx, id)
+	if err == nil && s.Successor != "" {
+		s, err = m.store.Get(ctx, s.Successor)
+	}
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	case !m.now().Before(s.ExpiresAt):
+		return nil, nil
+	}
+	return s, nil
+}
+
+// End deletes the request's session and clears its cookie.
+func (m *Manager) End(w http.ResponseWriter, r *http.Request) error {
+	s, err := m.Load(r.Context(), r)
+	if err != nil {
+		return err
+	}
+	if s != nil {
+		if err := m.store.Delete(r.Context(), s.ID); err != nil {
+			return err
+		}
+	}
+	m.clearCookie(w, m.opts.CookieName, "/")
+	return nil
+}
+
+// refresh extends s's idle timeout and rotates it if the user's
+// privileges changed, at most once per touchInterval. It returns the
+// session to use from now on.
+func (m *Manager) refresh(ctx context.Context, w http.ResponseWriter, s *Session) (*Session, error) {
+	now := m.now()
+	if now.Sub(s.LastSeen) < touchInterval {
+		return s, nil
+	}
+	if m.opts.Privileges != nil {
+		fingerprint, err := m.opts.Privileges(ctx, authz.Identity{User: s.User, Groups: s.Groups})
+		if err != nil {
+			return nil, err
+		}
+		if fingerprint != s.Privileges {
+			m.logger.Info("session rotated on privilege change",
+				zap.String("audit", "session"),
+				zap.String("request_id", middleware.GetRequestID(ctx)),
+				zap.String("user", s.User))
+			return m.rotate(ctx, w, s)
+		}
+	}
+	s.LastSeen = now
+	return s, m.store.Save(ctx, s, m.ttl(s))
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// Middleware authenticates requests carrying a session cookie: it replaces
+// the identity headers with the session's user and groups, and refuses
+// unsafe requests without the session's CSRF token (403). A cookie whose
+// session has ended is cleared and the request passes on without it.
+// Requests with an Authorization header pass unchanged, for token
+// authentication further in. Mount it outside the rbac middleware.
+func (m *Manager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, err := r.Cookie(m.opts.CookieName); err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s, err := m.Load(r.Context(), r)
+		if err == nil && s != nil {
+			if id, _ := m.cookieSession(r); id != s.ID {
+				// Rotated while the request was on its way
+				err = m.setSessionCookie(w, s)
+			}
+		}
+		if err == nil && s != nil {
+			s, err = m.refresh(r.Context(), w, s)
+		}
+		switch {
+		case err != nil:
+			eventsTotal.WithLabelValues("error").Inc()
+			m.logger.Error("failed to load session", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		case s == nil:
+			eventsTotal.WithLabelValues("expired").Inc()
+			m.clearCookie(w, m.opts.CookieName, "/")
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !safeMethod(r.Method) && subtle.ConstantTimeCompare([]byte(r.Header.Get(CSRFHeader)), []byte(s.CSRFToken)) != 1 {
+			eventsTotal.WithLabelValues("csrf_rejected").Inc()
+			http.Error(w, "missing or invalid CSRF token", http.StatusForbidden)
+			return
+		}
+		ctx := access.WithClaims(r.Context(), map[string]string{"auth": "session", "email": s.Email})
+		r = r.Clone(context.WithValue(ctx, sessionKey{}, s))
+		r.Header.Del(m.opts.UserHeader)
+		r.Header.Del(m.opts.GroupsHeader)
+		r.Header.Set(m.opts.UserHeader, s.User)
+		r.Header.Set(m.opts.GroupsHeader, strings.Join(s.Groups, ","))
+		next.ServeHTTP(w, r)
+	})
+}
+
+type sessionKey struct{}
+
+// FromContext returns the session that authenticated the request, or nil.
+func FromContext(ctx context.Context) *Session {
+	s, _ := ctx.Value(sessionKey{}).(*Session)
+	return s
+}
@@ -0,0 +1,180 @@
+package session
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/cache"
+)
+
+// fakeIssuer is an OpenID Connect provider signing in alice, remembering
+// the nonce and PKCE challenge of the last sign-in.
+func fakeIssuer(t *testing.T) *httptest.Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	var nonce, challenge string
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"issuer":%q,"authorization_endpoint":%q,"token_endpoint":%q,"jwks_uri":%q}`,
+			srv.URL, srv.URL+"/authorize", srv.URL+"/token", srv.URL+"/jwks")
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"keys":[{"kty":"RSA","kid":"k1","use":"sig","n":%q,"e":%q}]}`,
+			b64(key.N.Bytes()), b64(big.NewInt(int64(key.E)).Bytes()))
+	})
+	mux.HandleFunc("GET /authorize", func(w http.ResponseWriter, r *http.Request) {
+		nonce, challenge = r.URL.Query().Get("nonce"), r.URL.Query().Get("code_challenge")
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if id, secret, _ := r.BasicAuth(); id != "portal" || secret != "s3cret" || r.Form.Get("code") != "code-1" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		claims, _ := json.Marshal(map[string]any{
+			"iss": srv.URL, "aud": []string{"portal"}, "sub": "u-1", "preferred_username": "alice",
+			"email": "alice@example.com", "groups": []string{"developers"},
+			"exp": time.Now().Add(time.Hour).Unix(), "nonce": nonce,
+		})
+		signed := b64([]byte(`{"alg":"RS256","kid":"k1"}`)) + "." + b64(claims)
+		digest := sha256.Sum256([]byte(signed))
+		sig, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		idToken := signed + "." + b64(sig)
+		fmt.Fprintf(w, `{"access_token":"at","token_type":"Bearer","id_token":%q}`, idToken)
+	})
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSignInAndSessions(t *testing.T) {
+	issuer := fakeIssuer(t)
+	privileges := "developer"
+	m, err := New(NewCacheStore(cache.NewMemory()), NewProvider(ProviderConfig{
+		IssuerURL: issuer.URL, ClientID: "portal", ClientSecret: "s3cret", RedirectURL: "https://portal.example.com/auth/callback",
+	}, issuer.Client(), zap.NewNop()), Options{
+		UserHeader:   "X-Auth-Request-User",
+		GroupsHeader: "X-Auth-Request-Groups",
+		Secrets:      []string{strings.Repeat("k", 32)},
+		Privileges: func(context.Context, authz.Identity) (string, error) {
+			return privileges, nil
+		},
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	mux := http.NewServeMux()
+	m.Register(mux)
+	mux.HandleFunc("/api/v1/whoami", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.Header.Get("X-Auth-Request-User"), r.Header.Get("X-Auth-Request-Groups"))
+	})
+	h := m.Middleware(mux)
+	do := func(method, target string, cookies []*http.Cookie, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodGet, "/auth/login?redirect=//evil.example.com", nil)
+	location, _ := url.Parse(rec.Header().Get("Location"))
+	if rec.Code != http.StatusFound || location.Query().Get("code_challenge_method") != "S256" {
+		t.Fatalf("expected a redirect to the provider, got %d %s", rec.Code, location)
+	}
+	flowCookies := rec.Result().Cookies()
+	resp, err := issuer.Client().Get(location.String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if rec := do(http.MethodGet, "/auth/callback?code=code-1&state=forged", flowCookies); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a forged state refused, got %d", rec.Code)
+	}
+	rec = do(http.MethodGet, "/auth/callback?code=code-1&state="+location.Query().Get("state"), flowCookies)
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/" {
+		t.Fatalf("expected a redirect home, got %d %s: %s", rec.Code, rec.Header().Get("Location"), rec.Body)
+	}
+	var session *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "platform_session" {
+			session = c
+		}
+	}
+	if session == nil || !session.HttpOnly || !session.Secure || session.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("expected a secure session cookie, got %+v", session)
+	}
+	cookies := []*http.Cookie{session}
+
+	if rec := do(http.MethodGet, "/api/v1/whoami", cookies, "X-Auth-Request-User", "mallory"); rec.Body.String() != "alice developers" {
+		t.Errorf("expected the session's identity, got %q", rec.Body)
+	}
+	var info Session
+	json.NewDecoder(do(http.MethodGet, "/auth/session", cookies).Body).Decode(&info)
+	if info.User != "alice" || info.Email != "alice@example.com" || info.CSRFToken == "" {
+		t.Fatalf("expected alice's session, got %+v", info)
+	}
+	if rec := do(http.MethodPost, "/api/v1/whoami", cookies); rec.Code != http.StatusForbidden {
+		t.Errorf("expected a write without the CSRF token refused, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api/v1/whoami", cookies, CSRFHeader, info.CSRFToken); rec.Code != http.StatusOK {
+		t.Errorf("expected a write with the CSRF token allowed, got %d", rec.Code)
+	}
+
+	// A privilege change rotates the session; the old cookie keeps working
+	// for a moment and is replaced
+	privileges = "developer,operator"
+	now = now.Add(2 * time.Minute)
+	rec = do(http.MethodGet, "/api/v1/whoami", cookies)
+	rotated := rec.Result().Cookies()
+	if rec.Code != http.StatusOK || len(rotated) != 1 || rotated[0].Value == session.Value {
+		t.Fatalf("expected the session rotated, got %d %+v", rec.Code, rotated)
+	}
+	if rec := do(http.MethodGet, "/api/v1/whoami", cookies); rec.Body.String() != "alice developers" || len(rec.Result().Cookies()) != 1 {
+		t.Errorf("expected the old cookie to follow the rotation, got %q", rec.Body)
+	}
+
+	if rec := do(http.MethodPost, "/auth/logout", rotated, CSRFHeader, info.CSRFToken); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/auth/session", rotated); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected the session ended, got %d", rec.Code)
+	}
+	now = now.Add(13 * time.Hour)
+	if rec := do(http.MethodGet, "/api/v1/whoami", cookies); rec.Body.String() != " " {
+		t.Errorf("expected no identity after expiry, got %q", rec.Body)
+	}
+}
@@ -0,0 +1,393 @@
+// Package siem forwards security events to a SIEM: failed authentication,
+// denied requests, admin actions and policy violations. Events are queued
+// in memory and sent in batches, as JSON or CEF, to Splunk's HTTP Event
+// Collector or to Elasticsearch's bulk API.
+//
+// Events come from two places: Middleware sees the 401s and 403s of the
+// API, and the log core returned by Core turns audit log lines, including
+// the abuse guard's lockouts, into events.
+package siem
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+)
+
+// maxAttempts bounds the tries to send one batch before its events are
+// counted as failed.
+const maxAttempts = 3
+
+var (
+	eventsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "siem_events_total",
+		Help: "Security events by category and result (delivered, failed, shed or dropped).",
+	}, []string{"category", "result"})
+	queueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "siem_queue_depth",
+		Help: "Security events waiting to be forwarded.",
+	})
+	sendDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "siem_send_duration_seconds",
+		Help:    "Time to send one batch to the SIEM by result.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"result"})
+)
+
+// Event categories.
+const (
+	CategoryAuthentication = "authentication"
+	CategoryAuthorization  = "authorization"
+	CategoryAdmin          = "admin"
+	CategoryPolicy         = "policy"
+)
+
+// Severities, on CEF's 0 to 10 scale.
+const (
+	SeverityLow    = 3
+	SeverityMedium = 5
+	SeverityHigh   = 8
+)
+
+// Event is a security event.
+type Event struct {
+	Time     time.Time `json:"time"`
+	Category string    `json:"category"`
+	// Name is a stable identifier of what happened, e.g.
+	// "authentication_failure" or "credentials".
+	Name      string         `json:"name"`
+	Message   string         `json:"message"`
+	Severity  int            `json:"severity"`
+	Outcome   string         `json:"outcome,omitempty"`
+	User      string         `json:"user,omitempty"`
+	SourceIP  string         `json:"source_ip,omitempty"`
+	Method    string         `json:"method,omitempty"`
+	Path      string         `json:"path,omitempty"`
+	RequestID string         `json:"request_id,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+// Options configures a Forwarder.
+type Options struct {
+	// Sink sends batches; see Splunk and Elastic.
+	Sink Sink
+	// A batch is sent when it holds BatchSize events or its first event
+	// has waited BatchTimeout.
+	BatchSize    int
+	BatchTimeout time.Duration
+	// BufferSize is how many events may wait to be sent. Past three
+	// quarters full, events below SeverityHigh are shed; when full, all
+	// are dropped rather than blocking the caller.
+	BufferSize int
+	// UserHeader carries the caller's identity for Middleware.
+	UserHeader string
+}
+
+// Forwarder queues security events and sends them from a background loop.
+type Forwarder struct {
+	opts   Options
+	logger *zap.Logger
+
+	queue    chan Event
+	stop     chan struct{}
+	done     chan struct{}
+	stopping atomic.Bool
+	now      func() time.Time
+}
+
+// New creates a forwarder and starts its send loop.
+func New(opts Options, logger *zap.Logger) *Forwarder {
+	opts.BatchSize = max(opts.BatchSize, 1)
+	if opts.BatchTimeout <= 0 {
+		opts.BatchTimeout = 2 * time.Second
+	}
+	f := &Forwarder{
+		opts:   opts,
+		logger: logger,
+		queue:  make(chan Event, max(opts.BufferSize, opts.BatchSize)),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		now:    time.Now,
+	}
+	go f.run()
+	return f
+}
+
+// Forward queues e. It never blocks: under backpressure, low-severity
+// events are shed first.
+func (f *Forwarder) Forward(e Event) {
+	if e.Time.IsZero() {
+		e.Time = f.now()
+	}
+	if f.stopping.Load() {
+		eventsTotal.WithLabelValues(e.Category, "dropped").Inc()
+		return
+	}
+	if e.Severity < SeverityHigh && len(f.queue) >= cap(f.queue)*3/4 {
+		eventsTotal.WithLabelValues(e.Category, "shed").Inc()
+		return
+	}
+	select {
+	case f.queue <- e:
+		queueDepth.Inc()
+	default:
+		eventsTotal.WithLabelValues(e.Category, "dropped").Inc()
+	}
+}
+
+type callerKey struct{}
+
+// caller is filled in by Identify for Middleware.
+type caller struct{ user string }
+
+// Middleware forwards the API's 401s as authentication failures and its
+// 403s as authorization denials. Mount it outside the authentication
+// middleware, so that it sees their 401s, and Identify inside it.
+func (f *Forwarder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := &caller{}
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), callerKey{}, c)))
+
+		var e Event
+		switch sw.status {
+		case http.StatusUnauthorized:
+			e = Event{Category: CategoryAuthentication, Name: "authentication_failure",
+				Message: "authentication failed", Severity: SeverityMedium}
+		case http.StatusForbidden:
+			e = Event{Category: CategoryAuthorization, Name: "access_denied",
+				Message: "request denied", Severity: SeverityMedium}
+		default:
+			return
+		}
+		e.Outcome = "failure"
+		e.User = c.user
+		if e.User == "" {
+			e.User = r.Header.Get(f.opts.UserHeader)
+		}
+		e.SourceIP = clientIP(r)
+		e.Method, e.Path = r.Method, r.URL.Path
+		e.RequestID = middleware.GetRequestID(r.Context())
+		f.Forward(e)
+	})
+}
+
+// Identify records the caller the authentication middleware resolved, for
+// Middleware. Mount it inside them.
+func (f *Forwarder) Identify(next http.Handler) http.Handler {
+	headers := authz.Headers{User: f.opts.UserHeader}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, ok := r.Context().Value(callerKey{}).(*caller); ok {
+			c.user = headers.Identity(r).User
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	if sw.status == 0 {
+		sw.status = code
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+// ReadFrom keeps sendfile(2) available to handlers serving files.
+func (sw *statusWriter) ReadFrom(src io.Reader) (int64, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return io.Copy(sw.ResponseWriter, src)
+}
+
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// Core returns a log core forwarding audit log lines, those with an
+// "audit" field, as admin actions. Tee it with the logger's core. Denials
+// logged by access and rbac are left to Middleware; lines from abuse are
+// authentication events and from admission policy violations.
+func (f *Forwarder) Core() zapcore.Core {
+	return &auditCore{forwarder: f}
+}
+
+type auditCore struct {
+	forwarder *Forwarder
+	fields    []zapcore.Field
+}
+
+func (c *auditCore) Enabled(level zapcore.Level) bool { return level >= zapcore.InfoLevel }
+
+func (c *auditCore) With(fields []zapcore.Field) zapcore.Core {
+	return &auditCore{forwarder: c.forwarder, fields: append(c.fields[:len(c.fields):len(c.fields)], fields...)}
+}
+
+func (c *auditCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *auditCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, field := range append(c.fields[:len(c.fields):len(c.fields)], fields...) {
+		field.AddTo(enc)
+	}
+	kind, _ := enc.Fields["audit"].(string)
+	if kind == "" || kind == "access" || kind == "rbac" {
+		return nil
+	}
+	e := Event{Time: ent.Time, Category: CategoryAdmin, Name: kind, Message: ent.Message, Severity: SeverityLow, Outcome: "success"}
+	switch kind {
+	case "abuse":
+		e.Category, e.Severity = CategoryAuthentication, SeverityHigh
+	case "admission":
+		e.Category, e.Severity, e.Outcome = CategoryPolicy, SeverityMedium, "failure"
+	}
+	if ent.Level >= zapcore.WarnLevel {
+		e.Severity = max(e.Severity, SeverityMedium)
+	}
+	for key, target := range map[string]*string{"user": &e.User, "request_id": &e.RequestID, "method": &e.Method, "path": &e.Path} {
+		if v, ok := enc.Fields[key].(string); ok {
+			*target = v
+			delete(enc.Fields, key)
+		}
+	}
+	delete(enc.Fields, "audit")
+	if len(enc.Fields) > 0 {
+		e.Details = enc.Fields
+	}
+	c.forwarder.Forward(e)
+	return nil
+}
+
+func (c *auditCore) Sync() error { return nil }
+
+func (f *Forwarder) run() {
+	defer close(f.done)
+	timer := time.NewTimer(f.opts.BatchTimeout)
+	timer.Stop()
+	var batch []Event
+	for {
+		select {
+		case e := <-f.queue:
+			queueDepth.Dec()
+			batch = append(batch, e)
+			if len(batch) == 1 {
+				timer.Reset(f.opts.BatchTimeout)
+			}
+			if len(batch) >= f.opts.BatchSize {
+				timer.Stop()
+				f.send(batch)
+				batch = nil
+			}
+		case <-timer.C:
+			f.send(batch)
+			batch = nil
+		case <-f.stop:
+			for {
+				select {
+				case e := <-f.queue:
+					queueDepth.Dec()
+					batch = append(batch, e)
+					if len(batch) >= f.opts.BatchSize {
+						f.send(batch)
+						batch = nil
+					}
+				default:
+					f.send(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (f *Forwarder) send(batch []Event) {
+	if len(batch) == 0 {
+		return
+	}
+	var err error
+	for attempt := range maxAttempts {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff(attempt - 1)):
+			case <-f.stop:
+				// Shutting down: one more try, without waiting
+			}
+		}
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err = f.opts.Sink.Send(ctx, batch)
+		cancel()
+		result := "success"
+		if err != nil {
+			result = "error"
+		}
+		sendDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+		if err == nil {
+			count(batch, "delivered")
+			return
+		}
+	}
+	count(batch, "failed")
+	f.logger.Warn("failed to forward security events", zap.Int("events", len(batch)), zap.Error(err))
+}
+
+func count(batch []Event, result string) {
+	for _, e := range batch {
+		eventsTotal.WithLabelValues(e.Category, result).Inc()
+	}
+}
+
+// Shutdown stops accepting events and sends those queued, waiting for
+// them or ctx to expire.
+func (f *Forwarder) Shutdown(ctx context.Context) error {
+	if f.stopping.Swap(true) {
+		return nil
+	}
+	close(f.stop)
+	select {
+	case <-f.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// backoff returns the wait before retry attempt n (from 0), capped at 30s.
+func backoff(n int) time.Duration {
+	return min(500*time.Millisecond<<min(n, 6), 30*time.Second)
+}
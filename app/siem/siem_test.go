@@ -0,0 +1,194 @@
+package siem
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+func TestForwarder(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		batches [][]map[string]any
+	)
+	hec := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/services/collector/event" || r.Header.Get("Authorization") != "Splunk hec-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var batch []map[string]any
+		dec := json.NewDecoder(r.Body)
+		for dec.More() {
+			var e map[string]any
+			if err := dec.Decode(&e); err != nil {
+				t.Errorf("decode: %v", err)
+			}
+			batch = append(batch, e)
+		}
+		mu.Lock()
+		batches = append(batches, batch)
+		mu.Unlock()
+		w.Write([]byte(`{"text":"Success","code":0}`))
+	}))
+	defer hec.Close()
+
+	f := New(Options{
+		Sink:         &Splunk{URL: hec.URL, Token: "hec-token", Index: "security", Product: Product{"Lab", "platform-api", "1.0.0"}},
+		BatchSize:    2,
+		BatchTimeout: time.Hour,
+		BufferSize:   10,
+		UserHeader:   "X-Forwarded-User",
+	}, zap.NewNop())
+
+	// Refused requests are forwarded with the caller and the request
+	denied := http.StatusUnauthorized
+	h := f.Middleware(f.Identify(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(denied)
+	})))
+	for _, status := range []int{http.StatusUnauthorized, http.StatusOK, http.StatusForbidden} {
+		denied = status
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/deployments/web", nil)
+		req.Header.Set("X-Forwarded-User", "mallory")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	// Audit log lines are forwarded as admin actions
+	logger := zap.New(f.Core())
+	logger.Info("rotated webhook signing key", zap.String("audit", "webhooks"), zap.String("user", "alice"), zap.String("key", "k1"))
+	logger.Info("request denied", zap.String("audit", "rbac"))
+	logger.Info("not an audit line")
+
+	if err := f.Shutdown(t.Context()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 1 {
+		t.Fatalf("batches = %v", batches)
+	}
+	got := []map[string]any{}
+	for _, b := range batches {
+		for _, e := range b {
+			if e["index"] != "security" || e["sourcetype"] != "_json" {
+				t.Errorf("envelope = %v", e)
+			}
+			got = append(got, e["event"].(map[string]any))
+		}
+	}
+	if got[0]["category"] != "authentication" || got[0]["user"] != "mallory" || got[0]["path"] != "/api/v1/deployments/web" {
+		t.Errorf("first event = %v", got[0])
+	}
+	if got[1]["category"] != "authorization" || got[1]["method"] != "DELETE" {
+		t.Errorf("second event = %v", got[1])
+	}
+	if got[2]["category"] != "admin" || got[2]["name"] != "webhooks" || got[2]["user"] != "alice" ||
+		got[2]["details"].(map[string]any)["key"] != "k1" {
+		t.Errorf("third event = %v", got[2])
+	}
+
+	// Events after shutdown are dropped, not blocked on
+	f.Forward(Event{Category: CategoryAdmin})
+}
+
+func TestBackpressure(t *testing.T) {
+	release := make(chan struct{})
+	f := New(Options{Sink: sinkFunc(func([]Event) error { <-release; return nil }), BatchSize: 1, BufferSize: 4}, zap.NewNop())
+	defer f.Shutdown(t.Context())
+	defer close(release)
+
+	// The loop holds the first event; past three quarters of the buffer
+	// only high-severity events are queued
+	f.Forward(Event{Severity: SeverityLow})
+	time.Sleep(10 * time.Millisecond)
+	for range 3 {
+		f.Forward(Event{Severity: SeverityLow})
+	}
+	f.Forward(Event{Severity: SeverityLow})
+	f.Forward(Event{Severity: SeverityHigh})
+	f.Forward(Event{Severity: SeverityHigh})
+	if n := len(f.queue); n != 4 {
+		t.Errorf("queued %d events, want 4", n)
+	}
+}
+
+func TestSinks(t *testing.T) {
+	line := Product{"Lab", "platform|api", "1.0"}.CEF(Event{
+		Time:     time.UnixMilli(1700000000000),
+		Category: CategoryPolicy,
+		Name:     "admission",
+		Message:  `denied: image\tag`,
+		Severity: SeverityMedium,
+		User:     "system:serviceaccount:ci",
+		Details:  map[string]any{"reason": "a=b\nc", "pod.name": "web"},
+	})
+	want := `CEF:0|Lab|platform\|api|1.0|policy:admission|denied: image\\tag|5|rt=1700000000000 cat=policy suser=system:serviceaccount:ci podname=web reason=a\=b\nc`
+	if line != want {
+		t.Errorf("CEF =\n%s\nwant\n%s", line, want)
+	}
+
+	// Bulk requests fail on rejected items, not only on their status
+	var lines []string
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/logs-security/_bulk" || r.Header.Get("Authorization") != "ApiKey a2V5" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		for s := bufio.NewScanner(r.Body); s.Scan(); {
+			lines = append(lines, s.Text())
+		}
+		if strings.Contains(lines[len(lines)-1], "reject") {
+			w.Write([]byte(`{"errors":true,"items":[{"create":{"status":400,"error":{"reason":"mapping"}}}]}`))
+			return
+		}
+		w.Write([]byte(`{"errors":false,"items":[{"create":{"status":201}}]}`))
+	}))
+	defer es.Close()
+
+	sink := &Elastic{URL: es.URL, APIKey: "a2V5", Index: "logs-security", Format: FormatCEF, Product: Product{"Lab", "api", "1"}}
+	if err := sink.Send(t.Context(), []Event{{Category: CategoryAdmin, Name: "jobs", Message: "job submitted"}}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if len(lines) != 2 || lines[0] != `{"create":{}}` || !strings.Contains(lines[1], `"message":"CEF:0|Lab|api|1|admin:jobs|job submitted|0|`) {
+		t.Errorf("bulk body = %q", lines)
+	}
+	if err := sink.Send(t.Context(), []Event{{Message: "reject"}}); err == nil || !strings.Contains(err.Error(), "mapping") {
+		t.Errorf("rejected item: %v", err)
+	}
+
+	// Without a client of its own, the sink goes through the siem httpclient
+	if !sentBy(t, "siem") {
+		t.Error("expected requests counted for the siem client")
+	}
+}
+
+// sentBy reports whether the httpclient metrics count requests by client.
+func sentBy(t *testing.T, client string) bool {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, f := range families {
+		if f.GetName() != "http_client_requests_total" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "client" && l.GetValue() == client {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+type sinkFunc func([]Event) error
+
+func (f sinkFunc) Send(_ context.Context, batch []Event) error { return f(batch) }
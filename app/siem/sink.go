@@ -0,0 +1,278 @@
+package siem
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/httpclient"
+)
+
+// Sink sends a batch of events to a SIEM.
+type Sink interface {
+	Send(ctx context.Context, batch []Event) error
+}
+
+// Formats of the events sent.
+const (
+	FormatJSON = "json"
+	FormatCEF  = "cef"
+)
+
+// Product identifies the service in CEF headers and as the event source.
+type Product struct {
+	Vendor  string
+	Name    string
+	Version string
+}
+
+// Format renders an event in the named format: the event as a JSON
+// object, or a CEF line as a JSON string.
+func (p Product) Format(format string, e Event) (any, error) {
+	switch format {
+	case FormatJSON, "":
+		return e, nil
+	case FormatCEF:
+		return p.CEF(e), nil
+	}
+	return nil, fmt.Errorf("unknown SIEM format %q", format)
+}
+
+// CEF renders e as an ArcSight Common Event Format line.
+func (p Product) CEF(e Event) string {
+	var b strings.Builder
+	b.WriteString("CEF:0")
+	for _, h := range []string{p.Vendor, p.Name, p.Version, e.Category + ":" + e.Name, e.Message, strconv.Itoa(e.Severity)} {
+		b.WriteByte('|')
+		b.WriteString(cefHeader.Replace(h))
+	}
+	b.WriteByte('|')
+
+	ext := []struct{ key, value string }{
+		{"rt", strconv.FormatInt(e.Time.UnixMilli(), 10)},
+		{"cat", e.Category},
+		{"outcome", e.Outcome},
+		{"suser", e.User},
+		{"src", e.SourceIP},
+		{"requestMethod", e.Method},
+		{"request", e.Path},
+		{"externalId", e.RequestID},
+	}
+	keys := make([]string, 0, len(e.Details))
+	for k := range e.Details {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		ext = append(ext, struct{ key, value string }{cefKey(k), fmt.Sprint(e.Details[k])})
+	}
+	sep := ""
+	for _, kv := range ext {
+		if kv.value == "" {
+			continue
+		}
+		b.WriteString(sep)
+		b.WriteString(kv.key)
+		b.WriteByte('=')
+		b.WriteString(cefValue.Replace(kv.value))
+		sep = " "
+	}
+	return b.String()
+}
+
+var (
+	cefHeader = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefValue  = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+// cefKey turns a detail name into an extension key, which CEF limits to
+// letters and digits.
+func cefKey(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, name)
+}
+
+// Splunk sends events to a Splunk HTTP Event Collector.
+type Splunk struct {
+	// URL is the collector's base URL, e.g. https://splunk:8088.
+	URL        string
+	Token      string
+	Index      string
+	SourceType string
+	Format     string
+	Product    Product
+	// Client sends the requests; nil means a "siem" httpclient with
+	// default options.
+	Client *http.Client
+}
+
+// Send posts batch to /services/collector/event, one event object after
+// another as HEC expects.
+func (s *Splunk) Send(ctx context.Context, batch []Event) error {
+	sourceType := s.SourceType
+	if sourceType == "" {
+		sourceType = "_json"
+		if s.Format == FormatCEF {
+			sourceType = "cef"
+		}
+	}
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, e := range batch {
+		event, err := s.Product.Format(s.Format, e)
+		if err != nil {
+			return err
+		}
+		envelope := map[string]any{
+			"time":       float64(e.Time.UnixMilli()) / 1000,
+			"source":     s.Product.Name,
+			"sourcetype": sourceType,
+			"event":      event,
+		}
+		if s.Index != "" {
+			// Otherwise the token's default index
+			envelope["index"] = s.Index
+		}
+		if err := enc.Encode(envelope); err != nil {
+			return err
+		}
+	}
+	return post(ctx, s.Client, strings.TrimRight(s.URL, "/")+"/services/collector/event", "Splunk "+s.Token, "application/json", &body)
+}
+
+// Elastic sends events to an Elasticsearch index or data stream through
+// the bulk API.
+type Elastic struct {
+	// URL is the cluster's base URL, e.g. https://elastic:9200.
+	URL string
+	// APIKey is the base64 encoded id:key of an API key.
+	APIKey  string
+	Index   string
+	Format  string
+	Product Product
+	// Client sends the requests; nil means a "siem" httpclient with
+	// default options.
+	Client *http.Client
+}
+
+// Send posts batch to <index>/_bulk as create actions, which data streams
+// require.
+func (s *Elastic) Send(ctx context.Context, batch []Event) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, e := range batch {
+		var doc any
+		switch s.Format {
+		case FormatJSON, "":
+			doc = struct {
+				Timestamp time.Time `json:"@timestamp"`
+				Event
+			}{e.Time, e}
+		case FormatCEF:
+			// Documents need @timestamp, so the CEF line goes in message
+			doc = map[string]any{"@timestamp": e.Time, "message": s.Product.CEF(e), "event": map[string]string{"category": e.Category}}
+		default:
+			return fmt.Errorf("unknown SIEM format %q", s.Format)
+		}
+		if err := enc.Encode(map[string]any{"create": map[string]any{}}); err != nil {
+			return err
+		}
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+	}
+	url := strings.TrimRight(s.URL, "/") + "/" + s.Index + "/_bulk"
+	var auth string
+	if s.APIKey != "" {
+		auth = "ApiKey " + s.APIKey
+	}
+	return postBulk(ctx, s.Client, url, auth, &body)
+}
+
+// postBulk posts a bulk request, failing if any of its items did: the
+// bulk API answers 200 even then.
+func postBulk(ctx context.Context, client *http.Client, url, auth string, body io.Reader) error {
+	resp, err := do(ctx, client, url, auth, "application/x-ndjson", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+			Error  struct {
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("decode bulk response: %w", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+	for _, item := range result.Items {
+		for _, r := range item {
+			if r.Status >= 300 {
+				return fmt.Errorf("bulk item rejected: %d %s", r.Status, r.Error.Reason)
+			}
+		}
+	}
+	return fmt.Errorf("bulk request had errors")
+}
+
+func post(ctx context.Context, client *http.Client, url, auth, contentType string, body io.Reader) error {
+	resp, err := do(ctx, client, url, auth, contentType, body)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return nil
+}
+
+// defaultClient is the client for sinks configured without one: with
+// timeouts, retries and a circuit breaker like every other dependency.
+var defaultClient = sync.OnceValue(func() *http.Client {
+	return httpclient.New("siem", httpclient.DefaultOptions(), zap.NewNop())
+})
+
+// do sends the request, returning an error for any status but 2xx.
+func do(ctx context.Context, client *http.Client, url, auth, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	if client == nil {
+		client = defaultClient()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("SIEM answered %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return resp, nil
+}
@@ -0,0 +1,191 @@
+// Package spiffe authenticates in-mesh workloads by their SPIFFE identity
+// instead of bearer tokens. The service fetches its own X.509 SVID and the
+// trust bundles from the SPIRE agent's Workload API (see Source), asks TLS
+// peers for their SVID and verifies it against the bundle of the peer's
+// trust domain. The middleware then maps the peer's SPIFFE ID, such as
+// spiffe://example.org/ns/ci/sa/runner, to a platform principal for RBAC.
+package spiffe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/access"
+)
+
+var authenticationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "spiffe_authentications_total",
+	Help: "TLS peers presenting an X.509 SVID by result (verified or rejected).",
+}, []string{"result"})
+
+// ID is a SPIFFE ID.
+type ID struct {
+	TrustDomain string
+	Path        string
+}
+
+// ParseID parses a SPIFFE ID such as spiffe://example.org/ns/ci/sa/runner.
+func ParseID(s string) (ID, error) {
+	u, err := url.Parse(s)
+	switch {
+	case err != nil:
+		return ID{}, fmt.Errorf("spiffe: invalid ID %q: %w", s, err)
+	case u.Scheme != "spiffe" || u.Host == "" || u.User != nil || u.Port() != "":
+		return ID{}, fmt.Errorf("spiffe: invalid ID %q: need spiffe://<trust domain>/<path>", s)
+	case u.RawQuery != "" || u.Fragment != "" || strings.HasSuffix(u.Path, "/"):
+		return ID{}, fmt.Errorf("spiffe: invalid ID %q", s)
+	}
+	return ID{TrustDomain: strings.ToLower(u.Host), Path: u.Path}, nil
+}
+
+func (id ID) String() string {
+	return "spiffe://" + id.TrustDomain + id.Path
+}
+
+// IDFromCertificate returns the SPIFFE ID of an X.509 SVID: its one URI
+// SAN.
+func IDFromCertificate(cert *x509.Certificate) (ID, error) {
+	if len(cert.URIs) != 1 {
+		return ID{}, errors.New("spiffe: certificate is not an SVID: it needs exactly one URI SAN")
+	}
+	return ParseID(cert.URIs[0].String())
+}
+
+// Options configures an Authenticator.
+type Options struct {
+	// TrustDomains are the trust domains whose workloads are accepted;
+	// empty accepts only the service's own.
+	TrustDomains []string
+	// UserHeader and GroupsHeader carry the caller's identity; the
+	// middleware sets them for SVID peers.
+	UserHeader   string
+	GroupsHeader string
+	// Principals maps SPIFFE IDs to user names. Other peers' user is
+	// their SPIFFE ID, which role assignments can name too.
+	Principals map[string]string
+	// Groups are given to every SVID peer, e.g. to grant workloads a role
+	// through the group mapping.
+	Groups []string
+}
+
+// Authenticator verifies SVID peers and maps them to principals.
+type Authenticator struct {
+	source *Source
+	opts   Options
+	logger *zap.Logger
+}
+
+// New creates an authenticator verifying peers with source's bundles.
+func New(source *Source, opts Options, logger *zap.Logger) *Authenticator {
+	return &Authenticator{source: source, opts: opts, logger: logger}
+}
+
+// TLSConfig returns base with SVID peer authentication added. Peers may
+// present an X.509 SVID, which must chain to the bundle of a trusted trust
+// domain or the handshake fails; peers without a certificate connect as
+// before, to authenticate otherwise. Without base, the service serves its
+// own SVID.
+func (a *Authenticator) TLSConfig(base *tls.Config) *tls.Config {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if base != nil {
+		cfg = base.Clone()
+	}
+	if cfg.GetCertificate == nil && len(cfg.Certificates) == 0 {
+		cfg.GetCertificate = a.source.certificate
+	}
+	// Bundles rotate, so peers are verified here rather than against a
+	// fixed ClientCAs pool
+	cfg.ClientAuth = tls.RequestClientCert
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return nil
+		}
+		id, err := a.verify(cs.PeerCertificates)
+		if err != nil {
+			authenticationsTotal.WithLabelValues("rejected").Inc()
+			a.logger.Warn("rejected TLS peer", zap.Error(err))
+			return err
+		}
+		authenticationsTotal.WithLabelValues("verified").Inc()
+		a.logger.Debug("verified TLS peer", zap.Stringer("spiffe_id", id))
+		return nil
+	}
+	return cfg
+}
+
+// verify checks that chain is an SVID of a trusted trust domain.
+func (a *Authenticator) verify(chain []*x509.Certificate) (ID, error) {
+	id, err := IDFromCertificate(chain[0])
+	if err != nil {
+		return ID{}, err
+	}
+	trusted := a.opts.TrustDomains
+	if len(trusted) == 0 {
+		trusted = []string{a.source.ID().TrustDomain}
+	}
+	if !slices.Contains(trusted, id.TrustDomain) {
+		return ID{}, fmt.Errorf("spiffe: trust domain %q is not trusted", id.TrustDomain)
+	}
+	roots := a.source.Bundle(id.TrustDomain)
+	if roots == nil {
+		return ID{}, fmt.Errorf("spiffe: no bundle for trust domain %q", id.TrustDomain)
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return ID{}, fmt.Errorf("spiffe: %s: %w", id, err)
+	}
+	return id, nil
+}
+
+// Principal returns the user name id maps to.
+func (a *Authenticator) Principal(id ID) string {
+	if name, ok := a.opts.Principals[id.String()]; ok {
+		return name
+	}
+	return id.String()
+}
+
+// Middleware sets the identity headers of requests from SVID peers to
+// their principal and Groups, replacing whatever the peer sent. It relies
+// on TLSConfig having verified the peer during the handshake. Mount it
+// outside the token and rbac middleware; a personal access token the
+// workload sends still takes precedence.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		id, err := IDFromCertificate(r.TLS.PeerCertificates[0])
+		if err != nil {
+			// Not reachable through TLSConfig, which rejects such peers
+			http.Error(w, "client certificate is not an SVID", http.StatusUnauthorized)
+			return
+		}
+		r = r.Clone(access.WithClaims(r.Context(), map[string]string{
+			"auth": "spiffe", "spiffe_id": id.String(), "trust_domain": id.TrustDomain,
+		}))
+		r.Header.Del(a.opts.UserHeader)
+		r.Header.Del(a.opts.GroupsHeader)
+		r.Header.Set(a.opts.UserHeader, a.Principal(id))
+		r.Header.Set(a.opts.GroupsHeader, strings.Join(a.opts.Groups, ","))
+		next.ServeHTTP(w, r)
+	})
+}
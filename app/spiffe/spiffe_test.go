@@ -0,0 +1,188 @@
+package spiffe
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newCA(t *testing.T, td string) *testCA {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		URIs:                  []*url.URL{{Scheme: "spiffe", Host: td}},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert, key}
+}
+
+// svid issues an SVID for id, returning its certificate and PKCS#8 key.
+func (ca *testCA) svid(t *testing.T, id string) ([]byte, []byte, *ecdsa.PrivateKey) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	u, _ := url.Parse(id)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		URIs:         []*url.URL{u},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(key)
+	return der, pkcs8, key
+}
+
+// field encodes a length-delimited protobuf field.
+func field(num int, value []byte) []byte {
+	b := binary.AppendUvarint(nil, uint64(num)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+type rawCodec struct{}
+
+func (rawCodec) Name() string                  { return "proto" }
+func (rawCodec) Marshal(v any) ([]byte, error) { return v.([]byte), nil }
+func (rawCodec) Unmarshal([]byte, any) error   { return nil }
+
+// fakeAgent serves the Workload API on a Unix socket, streaming resp.
+func fakeAgent(t *testing.T, resp []byte) string {
+	dir, _ := os.MkdirTemp("", "spiffe")
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	lis, err := net.Listen("unix", filepath.Join(dir, "agent.sock"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	srv := grpc.NewServer(grpc.ForceServerCodec(rawCodec{}))
+	srv.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "SpiffeWorkloadAPI",
+		HandlerType: (*any)(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "FetchX509SVID",
+			ServerStreams: true,
+			Handler: func(_ any, stream grpc.ServerStream) error {
+				md, _ := metadata.FromIncomingContext(stream.Context())
+				if len(md.Get(securityHeader)) == 0 {
+					return io.ErrUnexpectedEOF
+				}
+				if err := stream.SendMsg(resp); err != nil {
+					return err
+				}
+				<-stream.Context().Done()
+				return nil
+			},
+		}},
+	}, nil)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return "unix://" + lis.Addr().String()
+}
+
+func TestWorkloadIdentity(t *testing.T) {
+	ca, rogue := newCA(t, "example.org"), newCA(t, "example.org")
+	svid, key, _ := ca.svid(t, "spiffe://example.org/ns/platform/sa/api")
+	resp := field(1, append(append(append(
+		field(1, []byte("spiffe://example.org/ns/platform/sa/api")),
+		field(2, svid)...), field(3, key)...), field(4, ca.cert.Raw)...))
+
+	source := NewSource(fakeAgent(t, resp), zap.NewNop())
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go source.Run(ctx)
+	deadline := time.Now().Add(5 * time.Second)
+	for source.Check(ctx) != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected an SVID, got %v", source.Check(ctx))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if id := source.ID(); id.String() != "spiffe://example.org/ns/platform/sa/api" {
+		t.Errorf("expected the service's SPIFFE ID, got %s", id)
+	}
+
+	auth := New(source, Options{
+		UserHeader:   "X-Forwarded-User",
+		GroupsHeader: "X-Forwarded-Groups",
+		Principals:   map[string]string{"spiffe://example.org/ns/ci/sa/runner": "ci-runner"},
+		Groups:       []string{"workloads"},
+	}, zap.NewNop())
+	srv := httptest.NewUnstartedServer(auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Forwarded-User") + " " + r.Header.Get("X-Forwarded-Groups")))
+	})))
+	srv.TLS = auth.TLSConfig(nil)
+	srv.StartTLS()
+	defer srv.Close()
+
+	get := func(cert *tls.Certificate) (string, error) {
+		tr := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+		if cert != nil {
+			tr.TLSClientConfig.Certificates = []tls.Certificate{*cert}
+		}
+		defer tr.CloseIdleConnections()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		req.Header.Set("X-Forwarded-User", "mallory")
+		resp, err := (&http.Client{Transport: tr}).Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body), nil
+	}
+	client := func(ca *testCA, id string) *tls.Certificate {
+		der, _, key := ca.svid(t, id)
+		return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	}
+
+	if got, err := get(client(ca, "spiffe://example.org/ns/ci/sa/runner")); err != nil || got != "ci-runner workloads" {
+		t.Errorf("expected the mapped principal, got %q, %v", got, err)
+	}
+	if got, err := get(client(ca, "spiffe://example.org/ns/apps/sa/web")); err != nil || got != "spiffe://example.org/ns/apps/sa/web workloads" {
+		t.Errorf("expected the SPIFFE ID as principal, got %q, %v", got, err)
+	}
+	if got, err := get(nil); err != nil || got != "mallory " {
+		t.Errorf("expected peers without a certificate passed through, got %q, %v", got, err)
+	}
+	if _, err := get(client(rogue, "spiffe://example.org/ns/ci/sa/runner")); err == nil {
+		t.Error("expected an SVID from another CA rejected")
+	}
+	if _, err := get(client(ca, "spiffe://other.org/ns/ci/sa/runner")); err == nil {
+		t.Error("expected an untrusted trust domain rejected")
+	}
+}
@@ -0,0 +1,348 @@
+package spiffe
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// The Workload API is a gRPC service on the SPIRE agent's Unix socket.
+// Only FetchX509SVID is used, so its two messages are decoded by hand
+// rather than with generated protobuf types.
+const (
+	fetchX509SVIDMethod = "/SpiffeWorkloadAPI/FetchX509SVID"
+	// securityHeader must be sent with every call, so that the API is not
+	// called through a forwarding proxy by accident.
+	securityHeader = "workload.spiffe.io"
+)
+
+var (
+	svidUpdatesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "spiffe_svid_updates_total",
+		Help: "X.509 SVID updates received from the Workload API by result (ok or error).",
+	}, []string{"result"})
+	svidExpiry = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "spiffe_svid_expiry_timestamp_seconds",
+		Help: "Unix time at which the service's current X.509 SVID expires.",
+	})
+)
+
+// Source keeps the service's X.509 SVID and trust bundles current from the
+// Workload API, which streams a new response whenever either rotates.
+type Source struct {
+	addr   string
+	logger *zap.Logger
+
+	mu      sync.RWMutex
+	id      ID
+	svid    *tls.Certificate
+	bundles map[string]*x509.CertPool
+}
+
+// NewSource creates a source for the Workload API at addr, such as
+// unix:///run/spire/sockets/agent.sock. Call Run to start fetching.
+func NewSource(addr string, logger *zap.Logger) *Source {
+	return &Source{addr: addr, logger: logger}
+}
+
+// Run streams SVID updates until ctx is cancelled, reconnecting with
+// backoff when the agent is unavailable.
+func (s *Source) Run(ctx context.Context) {
+	for attempt := 0; ; attempt++ {
+		err := s.watch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			// The stream ran; start the backoff over
+			attempt = 0
+		}
+		delay := min(time.Second<<min(attempt, 5), 30*time.Second)
+		s.logger.Warn("workload API stream ended; reconnecting", zap.Duration("delay", delay), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// watch runs one stream. It returns nil if at least one update arrived.
+func (s *Source) watch(ctx context.Context) error {
+	conn, err := grpc.NewClient(s.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(ctx, securityHeader, "true"))
+	defer cancel()
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, fetchX509SVIDMethod,
+		grpc.ForceCodec(wireCodec{}))
+	if err != nil {
+		return err
+	}
+	if err := stream.SendMsg(&x509SVIDRequest{}); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+	received := false
+	for {
+		var resp x509SVIDResponse
+		if err := stream.RecvMsg(&resp); err != nil {
+			if received && (errors.Is(err, io.EOF) || ctx.Err() != nil) {
+				return nil
+			}
+			return err
+		}
+		if err := s.update(&resp); err != nil {
+			svidUpdatesTotal.WithLabelValues("error").Inc()
+			s.logger.Error("invalid X.509 SVID from the workload API", zap.Error(err))
+			continue
+		}
+		svidUpdatesTotal.WithLabelValues("ok").Inc()
+		received = true
+	}
+}
+
+func (s *Source) update(resp *x509SVIDResponse) error {
+	if len(resp.svids) == 0 {
+		return errors.New("no SVIDs in response")
+	}
+	// The first SVID is the default one for the workload
+	svid := resp.svids[0]
+	certs, err := x509.ParseCertificates(svid.certs)
+	if err != nil || len(certs) == 0 {
+		return fmt.Errorf("parse SVID certificates: %w", err)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(svid.key)
+	if err != nil {
+		return fmt.Errorf("parse SVID key: %w", err)
+	}
+	id, err := IDFromCertificate(certs[0])
+	if err != nil {
+		return err
+	}
+	if id.String() != svid.id {
+		return fmt.Errorf("SVID certificate names %s, response names %s", id, svid.id)
+	}
+	bundles := map[string]*x509.CertPool{}
+	add := func(td string, der []byte) error {
+		roots, err := x509.ParseCertificates(der)
+		if err != nil {
+			return fmt.Errorf("parse bundle of %s: %w", td, err)
+		}
+		pool := x509.NewCertPool()
+		for _, c := range roots {
+			pool.AddCert(c)
+		}
+		bundles[td] = pool
+		return nil
+	}
+	if err := add(id.TrustDomain, svid.bundle); err != nil {
+		return err
+	}
+	for td, der := range resp.federated {
+		// Federated bundles are keyed by trust domain ID, spiffe://<td>
+		fed, err := ParseID(td)
+		if err != nil {
+			return err
+		}
+		if err := add(fed.TrustDomain, der); err != nil {
+			return err
+		}
+	}
+	cert := &tls.Certificate{PrivateKey: key, Leaf: certs[0]}
+	for _, c := range certs {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+
+	s.mu.Lock()
+	rotated := s.svid != nil
+	s.id, s.svid, s.bundles = id, cert, bundles
+	s.mu.Unlock()
+	svidExpiry.Set(float64(certs[0].NotAfter.Unix()))
+	s.logger.Info("X.509 SVID updated", zap.Stringer("spiffe_id", id), zap.Time("expires", certs[0].NotAfter),
+		zap.Int("bundles", len(bundles)), zap.Bool("rotated", rotated))
+	return nil
+}
+
+// ID returns the service's own SPIFFE ID, or the zero ID before the first
+// SVID arrives.
+func (s *Source) ID() ID {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.id
+}
+
+// Bundle returns the roots of trust domain td, or nil.
+func (s *Source) Bundle(td string) *x509.CertPool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.bundles[td]
+}
+
+func (s *Source) certificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.svid == nil {
+		return nil, errors.New("spiffe: no SVID yet")
+	}
+	return s.svid, nil
+}
+
+// Check reports whether a current SVID is held, for the readiness probe.
+func (s *Source) Check(context.Context) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	switch {
+	case s.svid == nil:
+		return errors.New("no SVID from the workload API yet")
+	case !time.Now().Before(s.svid.Leaf.NotAfter):
+		return fmt.Errorf("SVID expired at %s", s.svid.Leaf.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// x509SVIDRequest is the empty FetchX509SVID request.
+type x509SVIDRequest struct{}
+
+// x509SVIDResponse holds the fields of X509SVIDResponse that are used:
+//
+//	repeated X509SVID svids = 1;
+//	map<string, bytes> federated_bundles = 3;
+type x509SVIDResponse struct {
+	svids     []x509SVID
+	federated map[string][]byte
+}
+
+// x509SVID is an X509SVID message:
+//
+//	string spiffe_id = 1;
+//	bytes x509_svid = 2;      // DER certificates, leaf first
+//	bytes x509_svid_key = 3;  // PKCS#8 DER
+//	bytes bundle = 4;         // DER certificates
+type x509SVID struct {
+	id     string
+	certs  []byte
+	key    []byte
+	bundle []byte
+}
+
+// wireCodec encodes the Workload API messages in the protobuf wire format.
+// It is passed per call, so the registered proto codec is left alone.
+type wireCodec struct{}
+
+func (wireCodec) Name() string { return "proto" }
+
+func (wireCodec) Marshal(v any) ([]byte, error) {
+	if _, ok := v.(*x509SVIDRequest); !ok {
+		return nil, fmt.Errorf("spiffe: cannot encode %T", v)
+	}
+	return nil, nil
+}
+
+func (wireCodec) Unmarshal(data []byte, v any) error {
+	resp, ok := v.(*x509SVIDResponse)
+	if !ok {
+		return fmt.Errorf("spiffe: cannot decode into %T", v)
+	}
+	// data is only valid during the call
+	data = bytes.Clone(data)
+	return eachField(data, func(num int, value []byte) error {
+		switch num {
+		case 1:
+			var svid x509SVID
+			err := eachField(value, func(num int, value []byte) error {
+				switch num {
+				case 1:
+					svid.id = string(value)
+				case 2:
+					svid.certs = value
+				case 3:
+					svid.key = value
+				case 4:
+					svid.bundle = value
+				}
+				return nil
+			})
+			resp.svids = append(resp.svids, svid)
+			return err
+		case 3:
+			var key string
+			var bundle []byte
+			err := eachField(value, func(num int, value []byte) error {
+				switch num {
+				case 1:
+					key = string(value)
+				case 2:
+					bundle = value
+				}
+				return nil
+			})
+			if resp.federated == nil {
+				resp.federated = map[string][]byte{}
+			}
+			resp.federated[key] = bundle
+			return err
+		}
+		return nil
+	})
+}
+
+// eachField calls fn with the number and contents of each length-delimited
+// field in the protobuf message data, skipping fields of other wire types.
+func eachField(data []byte, fn func(num int, value []byte) error) error {
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("spiffe: malformed message")
+		}
+		data = data[n:]
+		num, wireType := int(tag>>3), tag&7
+		var size uint64
+		switch wireType {
+		case 0: // varint
+			if _, n = binary.Uvarint(data); n <= 0 {
+				return errors.New("spiffe: malformed message")
+			}
+			size = uint64(n)
+		case 1: // 64-bit
+			size = 8
+		case 5: // 32-bit
+			size = 4
+		case 2: // length-delimited
+			if size, n = binary.Uvarint(data); n <= 0 {
+				return errors.New("spiffe: malformed message")
+			}
+			data = data[n:]
+		default:
+			return fmt.Errorf("spiffe: unsupported wire type %d", wireType)
+		}
+		if size > uint64(len(data)) {
+			return errors.New("spiffe: malformed message")
+		}
+		if wireType == 2 {
+			if err := fn(num, data[:size]); err != nil {
+				return err
+			}
+		}
+		data = data[size:]
+	}
+	return nil
+}
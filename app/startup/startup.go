@@ -0,0 +1,249 @@
+// Package startup brings up the dependencies a replica needs before it is
+// sent traffic: databases, caches, brokers and the services it calls. They
+// are started one by one in the order they were declared, each attempt is
+// retried with backoff until the dependency's time is up, and the readiness
+// check fails until every required one is up. An optional dependency that
+// does not come up leaves the replica degraded rather than down: it is
+// retried in the background while the replica serves what it can without
+// it. Compare warmup, which runs once the dependencies are up and only
+// makes the replica faster.
+package startup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+var (
+	dependencyUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "startup_dependency_up",
+		Help: "Whether each startup dependency has come up (1) or not yet (0).",
+	}, []string{"dependency"})
+	dependencySeconds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "startup_dependency_duration_seconds",
+		Help: "How long each startup dependency took to come up, retries included.",
+	}, []string{"dependency"})
+	startupSeconds = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "startup_duration_seconds",
+		Help: "How long the required startup dependencies took to come up.",
+	})
+)
+
+// Dependency is something the service depends on.
+type Dependency struct {
+	Name string
+	// Required dependencies must be up before the replica is ready; the
+	// service does not start without them.
+	Required bool
+	// Start connects to the dependency or checks that it answers. It is
+	// called again after it fails, so it must be safe to retry.
+	Start func(ctx context.Context) error
+	// Timeout bounds bringing the dependency up, all attempts included,
+	// and AttemptTimeout each attempt; 0 uses the Options.
+	Timeout        time.Duration
+	AttemptTimeout time.Duration
+	// Attempts limits the attempts within Timeout, for work that will not
+	// succeed by repeating it, such as migrations; 0 for no limit.
+	Attempts int
+}
+
+// Options configures an Orchestrator.
+type Options struct {
+	// Timeout bounds each dependency, all attempts included (default 2m).
+	Timeout time.Duration
+	// AttemptTimeout bounds each attempt (default 10s).
+	AttemptTimeout time.Duration
+	// BackoffBase and BackoffMax shape the full-jitter delay between
+	// attempts: random up to BackoffBase doubled per attempt, capped at
+	// BackoffMax (defaults 500ms and 15s).
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+}
+
+// Orchestrator starts a set of dependencies.
+type Orchestrator struct {
+	opts   Options
+	logger *zap.Logger
+
+	mu       sync.Mutex
+	deps     []Dependency
+	degraded map[string]bool
+	ready    atomic.Bool
+}
+
+// New creates an orchestrator without dependencies.
+func New(opts Options, logger *zap.Logger) *Orchestrator {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 2 * time.Minute
+	}
+	if opts.AttemptTimeout <= 0 {
+		opts.AttemptTimeout = 10 * time.Second
+	}
+	if opts.BackoffBase <= 0 {
+		opts.BackoffBase = 500 * time.Millisecond
+	}
+	if opts.BackoffMax <= 0 {
+		opts.BackoffMax = 15 * time.Second
+	}
+	return &Orchestrator{opts: opts, logger: logger, degraded: make(map[string]bool)}
+}
+
+// Add declares d; Run starts dependencies in the order they were added, so
+// a dependency is added after those it needs.
+func (o *Orchestrator) Add(d Dependency) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.deps = append(o.deps, d)
+	dependencyUp.WithLabelValues(d.Name).Set(0)
+}
+
+// Run starts the dependencies in order. It fails on the first required one
+// that does not come up in time; optional ones that do not are marked
+// degraded and retried in the background until they come up or ctx ends.
+// Once it returns nil the replica may become ready.
+func (o *Orchestrator) Run(ctx context.Context) error {
+	o.mu.Lock()
+	deps := o.deps
+	o.mu.Unlock()
+
+	start := time.Now()
+	for _, d := range deps {
+		err := o.start(ctx, d, orDefault(d.Timeout, o.opts.Timeout))
+		switch {
+		case err == nil:
+		case d.Required:
+			o.logger.Error("required dependency did not come up", zap.String("dependency", d.Name), zap.Error(err))
+			return fmt.Errorf("%s: %w", d.Name, err)
+		default:
+			o.logger.Warn("optional dependency did not come up, continuing degraded",
+				zap.String("dependency", d.Name), zap.Error(err))
+			o.setDegraded(d.Name, true)
+			go o.recover(ctx, d)
+		}
+	}
+	elapsed := time.Since(start)
+	startupSeconds.Set(elapsed.Seconds())
+	o.ready.Store(true)
+	o.logger.Info("dependencies up",
+		zap.Duration("duration", elapsed),
+		zap.Int("dependencies", len(deps)),
+		zap.Strings("degraded", o.Degraded()),
+	)
+	return nil
+}
+
+// recover keeps starting the optional dependency d until it comes up.
+func (o *Orchestrator) recover(ctx context.Context, d Dependency) {
+	d.Attempts = 0
+	if err := o.start(ctx, d, 0); err != nil {
+		return
+	}
+	o.setDegraded(d.Name, false)
+	o.logger.Info("optional dependency recovered", zap.String("dependency", d.Name))
+}
+
+// start attempts d until it is up, timeout (0 for none) passes or d's
+// attempts run out.
+func (o *Orchestrator) start(ctx context.Context, d Dependency, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	begin := time.Now()
+	for attempt := 0; ; attempt++ {
+		err := o.attempt(ctx, d)
+		if err == nil {
+			elapsed := time.Since(begin)
+			dependencyUp.WithLabelValues(d.Name).Set(1)
+			dependencySeconds.WithLabelValues(d.Name).Set(elapsed.Seconds())
+			o.logger.Info("dependency up",
+				zap.String("dependency", d.Name),
+				zap.Int("attempts", attempt+1),
+				zap.Duration("duration", elapsed),
+			)
+			return nil
+		}
+		if d.Attempts > 0 && attempt+1 >= d.Attempts {
+			return err
+		}
+		delay := backoff(attempt, o.opts.BackoffBase, o.opts.BackoffMax)
+		o.logger.Warn("dependency not up, retrying",
+			zap.String("dependency", d.Name),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("retry_in", delay),
+			zap.Error(err),
+		)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return fmt.Errorf("gave up after %d attempts: %w", attempt+1, err)
+		}
+	}
+}
+
+func (o *Orchestrator) attempt(ctx context.Context, d Dependency) error {
+	ctx, cancel := context.WithTimeout(ctx, orDefault(d.AttemptTimeout, o.opts.AttemptTimeout))
+	defer cancel()
+	return d.Start(ctx)
+}
+
+func (o *Orchestrator) setDegraded(name string, degraded bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if degraded {
+		o.degraded[name] = true
+	} else {
+		delete(o.degraded, name)
+	}
+}
+
+// Degraded returns the optional dependencies that are not up, in the order
+// they were declared.
+func (o *Orchestrator) Degraded() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var names []string
+	for _, d := range o.deps {
+		if o.degraded[d.Name] {
+			names = append(names, d.Name)
+		}
+	}
+	return names
+}
+
+// Check is a readiness check failing until Run has brought up the required
+// dependencies.
+func (o *Orchestrator) Check(context.Context) error {
+	if !o.ready.Load() {
+		return errors.New("starting dependencies")
+	}
+	return nil
+}
+
+// orDefault returns d, or fallback when d is not set.
+func orDefault(d, fallback time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return fallback
+}
+
+// backoff returns a full-jitter delay before retry attempt (from zero):
+// random up to base doubled per attempt, capped at max.
+func backoff(attempt int, base, max time.Duration) time.Duration {
+	d := base << attempt
+	if d <= 0 || d > max {
+		d = max
+	}
+	return time.Duration(rand.Int64N(int64(d) + 1))
+}
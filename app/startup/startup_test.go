@@ -0,0 +1,129 @@
+package startup
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func fastOptions() Options {
+	return Options{
+		Timeout:        200 * time.Millisecond,
+		AttemptTimeout: 50 * time.Millisecond,
+		BackoffBase:    time.Millisecond,
+		BackoffMax:     5 * time.Millisecond,
+	}
+}
+
+func TestRunStartsInOrderAndRetries(t *testing.T) {
+	o := New(fastOptions(), zap.NewNop())
+	var mu sync.Mutex
+	var started []string
+	up := func(name string) func(context.Context) error {
+		return func(context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			started = append(started, name)
+			return nil
+		}
+	}
+	var attempts atomic.Int32
+	o.Add(Dependency{Name: "database", Required: true, Start: up("database")})
+	o.Add(Dependency{Name: "redis", Required: true, Start: func(ctx context.Context) error {
+		// Down for the first two attempts
+		if attempts.Add(1) < 3 {
+			return errors.New("connection refused")
+		}
+		return up("redis")(ctx)
+	}})
+	o.Add(Dependency{Name: "nats", Required: true, Start: up("nats")})
+	if o.Check(t.Context()) == nil {
+		t.Fatal("ready before starting")
+	}
+
+	if err := o.Run(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(started, []string{"database", "redis", "nats"}) || attempts.Load() != 3 {
+		t.Errorf("started %v after %d redis attempts", started, attempts.Load())
+	}
+	if err := o.Check(t.Context()); err != nil {
+		t.Errorf("not ready after starting: %v", err)
+	}
+	if d := o.Degraded(); len(d) != 0 {
+		t.Errorf("degraded %v", d)
+	}
+}
+
+func TestRunFailsOnRequiredDependency(t *testing.T) {
+	o := New(fastOptions(), zap.NewNop())
+	var later atomic.Bool
+	o.Add(Dependency{Name: "database", Required: true, Start: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	o.Add(Dependency{Name: "redis", Required: true, Start: func(context.Context) error {
+		later.Store(true)
+		return nil
+	}})
+	err := o.Run(t.Context())
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "database") {
+		t.Errorf("run = %v", err)
+	}
+	if later.Load() {
+		t.Error("started a dependency after a required one failed")
+	}
+	if o.Check(t.Context()) == nil {
+		t.Error("ready after a required dependency failed")
+	}
+}
+
+func TestRunLimitsAttempts(t *testing.T) {
+	o := New(fastOptions(), zap.NewNop())
+	var attempts atomic.Int32
+	o.Add(Dependency{Name: "migrations", Required: true, Attempts: 1, Start: func(context.Context) error {
+		attempts.Add(1)
+		return errors.New("syntax error")
+	}})
+	if err := o.Run(t.Context()); err == nil || attempts.Load() != 1 {
+		t.Errorf("run = %v after %d attempts", err, attempts.Load())
+	}
+}
+
+func TestOptionalDependencyDegradesAndRecovers(t *testing.T) {
+	o := New(fastOptions(), zap.NewNop())
+	var down atomic.Bool
+	down.Store(true)
+	o.Add(Dependency{Name: "objectstore", Start: func(context.Context) error {
+		if down.Load() {
+			return errors.New("no route to host")
+		}
+		return nil
+	}})
+	if err := o.Run(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Check(t.Context()); err != nil {
+		t.Errorf("not ready without an optional dependency: %v", err)
+	}
+	if d := o.Degraded(); !slices.Equal(d, []string{"objectstore"}) {
+		t.Errorf("degraded %v", d)
+	}
+
+	// Retried in the background until it comes up
+	down.Store(false)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(o.Degraded()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("optional dependency did not recover")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,227 @@
+// Package static serves the platform portal frontend from a directory or the
+// embedded build, with cache headers, validators and ranges, gzip, and
+// single-page-app fallback.
+package static
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+//go:embed all:web
+var embedded embed.FS
+
+// Embedded returns the frontend build compiled into the binary.
+func Embedded() fs.FS {
+	sub, _ := fs.Sub(embedded, "web")
+	return sub
+}
+
+// Dir returns the frontend build in a directory on disk.
+func Dir(dir string) fs.FS {
+	return os.DirFS(dir)
+}
+
+// Handler serves files from fsys. Unknown paths without a file extension
+// fall back to index.html so client-side routes work on reload.
+type Handler struct {
+	fsys   fs.FS
+	prefix string
+	// etags of embedded files by name
+	etags sync.Map
+}
+
+// New creates a handler for files in fsys mounted under prefix (e.g. "/portal").
+func New(fsys fs.FS, prefix string) *Handler {
+	return &Handler{fsys: fsys, prefix: strings.TrimSuffix(prefix, "/")}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+strings.TrimPrefix(r.URL.Path, h.prefix)), "/")
+	if name == "" {
+		name = "index.html"
+	}
+
+	if !h.exists(name) {
+		// Asset requests (with an extension) are real 404s; everything else is
+		// a client-side route handled by the SPA.
+		if path.Ext(name) != "" {
+			http.NotFound(w, r)
+			return
+		}
+		name = "index.html"
+	}
+
+	h.serveFile(w, r, name)
+}
+
+func (h *Handler) exists(name string) bool {
+	info, err := fs.Stat(h.fsys, name)
+	return err == nil && !info.IsDir()
+}
+
+func (h *Handler) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	w.Header().Set("Cache-Control", cacheControl(name))
+	w.Header().Add("Vary", "Accept-Encoding")
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		w.Header().Set("Content-Type", ctype)
+	}
+
+	acceptsGzip := strings.Contains(r.Header.Get("Accept-Encoding"), "gzip")
+
+	// Prefer a precompressed sibling produced by the frontend build
+	if acceptsGzip && h.exists(name+".gz") {
+		w.Header().Set("Content-Encoding", "gzip")
+		h.serveContent(w, r, name+".gz")
+		return
+	}
+
+	// Compressing on the fly rules out ranges, so a range request gets the
+	// file as it is
+	if acceptsGzip && r.Header.Get("Range") == "" && compressible(w.Header().Get("Content-Type")) {
+		h.serveGzip(w, r, name)
+		return
+	}
+
+	h.serveContent(w, r, name)
+}
+
+// serveContent serves name with http.ServeContent: ranges, conditional
+// requests and, for files on disk, sendfile(2) when the response writer
+// reaches the connection.
+func (h *Handler) serveContent(w http.ResponseWriter, r *http.Request, name string) {
+	f, info, ok := h.open(w, r, name)
+	if !ok {
+		return
+	}
+	defer f.Close()
+	if etag := h.etag(name, f, info); etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodHead {
+			io.Copy(w, f)
+		}
+		return
+	}
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+// serveGzip streams name compressed. Its ETag is weak and marked as gzip,
+// as the bytes differ from the file's.
+func (h *Handler) serveGzip(w http.ResponseWriter, r *http.Request, name string) {
+	f, info, ok := h.open(w, r, name)
+	if !ok {
+		return
+	}
+	defer f.Close()
+	if etag := h.etag(name, f, info); etag != "" {
+		etag = "W/" + strings.TrimSuffix(etag, `"`) + `-gzip"`
+		w.Header().Set("ETag", etag)
+		if noneMatch(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	gz := gzip.NewWriter(w)
+	defer gz.Close()
+	io.Copy(gz, f)
+}
+
+func (h *Handler) open(w http.ResponseWriter, r *http.Request, name string) (fs.File, fs.FileInfo, bool) {
+	f, err := h.fsys.Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, nil, false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		http.NotFound(w, r)
+		return nil, nil, false
+	}
+	return f, info, true
+}
+
+// etag identifies a file's content: by size and modification time on disk,
+// and by a hash, computed once, for embedded files, which have no
+// modification time. It leaves f's offset where it was.
+func (h *Handler) etag(name string, f fs.File, info fs.FileInfo) string {
+	if !info.ModTime().IsZero() {
+		return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+	}
+	if tag, ok := h.etags.Load(name); ok {
+		return tag.(string)
+	}
+	seeker, ok := f.(io.Seeker)
+	if !ok {
+		return ""
+	}
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return ""
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return ""
+	}
+	tag := `"` + hex.EncodeToString(sum.Sum(nil)[:16]) + `"`
+	h.etags.Store(name, tag)
+	return tag
+}
+
+// noneMatch reports whether an If-None-Match header matches etag, weakly
+// as RFC 9110 requires for it.
+func noneMatch(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheControl lets fingerprinted build assets be cached forever while
+// index.html is always revalidated so new deploys are picked up.
+func cacheControl(name string) string {
+	if name == "index.html" || path.Ext(name) == ".html" {
+		return "no-cache"
+	}
+	if strings.HasPrefix(name, "assets/") || strings.HasPrefix(name, "static/") {
+		return "public, max-age=31536000, immutable"
+	}
+	return "public, max-age=3600"
+}
+
+func compressible(ctype string) bool {
+	for _, prefix := range []string{"text/", "application/javascript", "application/json", "image/svg+xml"} {
+		if strings.HasPrefix(ctype, prefix) {
+			return true
+		}
+	}
+	return false
+}
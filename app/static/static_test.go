@@ -0,0 +1,110 @@
+package static
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"index.html":        {Data: []byte("<html>portal</html>")},
+		"assets/app.123.js": {Data: []byte("console.log('hi')")},
+	}
+}
+
+func TestServeAsset(t *testing.T) {
+	h := New(testFS(), "/portal")
+
+	req := httptest.NewRequest(http.MethodGet, "/portal/assets/app.123.js", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rec.Code)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "public, max-age=31536000, immutable" {
+		t.Errorf("expected immutable cache header, got '%s'", cc)
+	}
+}
+
+func TestSPAFallback(t *testing.T) {
+	h := New(testFS(), "/portal")
+
+	req := httptest.NewRequest(http.MethodGet, "/portal/teams/payments", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rec.Code)
+	}
+	if rec.Body.String() != "<html>portal</html>" {
+		t.Errorf("expected index.html, got '%s'", rec.Body.String())
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "no-cache" {
+		t.Errorf("expected no-cache for index.html, got '%s'", cc)
+	}
+
+	// Missing assets are not masked by the fallback
+	req = httptest.NewRequest(http.MethodGet, "/portal/assets/missing.js", nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestGzip(t *testing.T) {
+	h := New(testFS(), "")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("expected gzip encoding, got '%s'", rec.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestValidatorsAndRanges(t *testing.T) {
+	h := New(testFS(), "")
+	get := func(header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/assets/app.123.js", nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	etag := get().Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+	if rec := get("If-None-Match", etag); rec.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match: expected 304, got %d", rec.Code)
+	}
+	rec := get("Range", "bytes=0-6")
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "console" {
+		t.Errorf("Range: got %d '%s'", rec.Code, rec.Body.String())
+	}
+
+	// A range is served from the file as it is, even to gzip clients
+	rec = get("Range", "bytes=8-10", "Accept-Encoding", "gzip")
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "log" || rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Range with gzip: got %d '%s'", rec.Code, rec.Body.String())
+	}
+
+	// Compressed responses have their own validator
+	gzipped := get("Accept-Encoding", "gzip").Header().Get("ETag")
+	if gzipped == etag || gzipped == "" {
+		t.Errorf("gzip ETag %s, identity %s", gzipped, etag)
+	}
+	if rec := get("Accept-Encoding", "gzip", "If-None-Match", gzipped); rec.Code != http.StatusNotModified {
+		t.Errorf("gzip If-None-Match: expected 304, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+// NewChange describes action on the entity resource/id, which was before
+// and is now after; before is nil for creates and after for deletes.
+// The caller sets Actor and RequestID.
+func NewChange(resource, id, action string, before, after any) (*Change, error) {
+	c := &Change{Resource: resource, ResourceID: id, Action: action, Time: time.Now().UTC()}
+	var b, a map[string]any
+	var err error
+	if before != nil {
+		if c.Before, b, err = marshalObject(before); err != nil {
+			return nil, err
+		}
+	}
+	if after != nil {
+		if c.After, a, err = marshalObject(after); err != nil {
+			return nil, err
+		}
+	}
+	if before != nil || after != nil {
+		if c.Diff, err = json.Marshal(mergePatch(b, a)); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func marshalObject(v any) (json.RawMessage, map[string]any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, nil, err
+	}
+	return data, m, nil
+}
+
+// mergePatch returns the JSON merge patch turning before into after:
+// changed and added members with their new values, removed ones as null,
+// recursing into objects present in both.
+func mergePatch(before, after map[string]any) map[string]any {
+	patch := map[string]any{}
+	for k, b := range before {
+		a, ok := after[k]
+		if !ok {
+			patch[k] = nil
+			continue
+		}
+		bm, bok := b.(map[string]any)
+		am, aok := a.(map[string]any)
+		if bok && aok {
+			if p := mergePatch(bm, am); len(p) > 0 {
+				patch[k] = p
+			}
+			continue
+		}
+		if !reflect.DeepEqual(a, b) {
+			patch[k] = a
+		}
+	}
+	for k, a := range after {
+		if _, ok := before[k]; !ok {
+			patch[k] = a
+		}
+	}
+	return patch
+}
@@ -0,0 +1,1214 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NewMemory returns a Store that keeps everything in process memory. Data is
+// lost on restart; it is meant for local development and tests. It enforces
+// the constraints of the PostgreSQL schema (unique names, services and
+// deployments referring to live parents, soft deletes cascading from
+// tenants to services), so code tested against it behaves the same in
+// production.
+func NewMemory() *Store {
+	deployments := &memoryDeployments{items: make(map[string]Deployment)}
+	services := &memoryServices{items: make(map[string]Service)}
+	tenants := &memoryTenants{items: make(map[string]Tenant), services: services}
+	services.tenants = tenants
+	deployments.services = services
+	environments := &memoryEnvironments{items: make(map[string]Environment)}
+	quotaUsage := &memoryQuotaUsage{items: make(map[string][]QuotaSample)}
+	provisioning := &memoryProvisioning{items: make(map[string]ProvisioningRecord)}
+	audit := &memoryAudit{}
+	history := &memoryHistory{}
+	search := &memorySearch{tenants: tenants, services: services}
+	roles := &memoryRoles{items: make(map[string]RoleAssignment)}
+	tokens := &memoryTokens{items: make(map[string]APIToken)}
+	credentials := &memoryCredentials{items: make(map[string]Credential)}
+	webhookKeys := &memoryWebhookKeys{items: make(map[string]WebhookKey)}
+	queue := &memoryQueue{items: make(map[string]QueueJob)}
+	outbox := &memoryOutbox{items: make(map[string]outboxEntry)}
+	repos := Repos{
+		Tenants:      tenants,
+		Environments: environments,
+		Services:     services,
+		Deployments:  deployments,
+		QuotaUsage:   quotaUsage,
+		Provisioning: provisioning,
+		Audit:        audit,
+		History:      history,
+		Search:       search,
+		Roles:        roles,
+		Tokens:       tokens,
+		Credentials:  credentials,
+		WebhookKeys:  webhookKeys,
+		Queue:        queue,
+		Outbox:       outbox,
+	}
+
+	// Transactions run one at a time and roll back by restoring snapshots
+	// taken when they began. They are not isolated from writes made outside
+	// a transaction meanwhile, which a rollback also undoes.
+	var txMu sync.Mutex
+	inTx := func(ctx context.Context, fn func(Repos) error) error {
+		txMu.Lock()
+		defer txMu.Unlock()
+		restores := []func(){
+			snapshotMap(&tenants.mu, &tenants.items, nil),
+			snapshotMap(&environments.mu, &environments.items, nil),
+			snapshotMap(&services.mu, &services.items, nil),
+			snapshotMap(&deployments.mu, &deployments.items, nil),
+			snapshotMap(&quotaUsage.mu, &quotaUsage.items, slices.Clone[[]QuotaSample]),
+			snapshotMap(&provisioning.mu, &provisioning.items, nil),
+			audit.snapshot(),
+			history.snapshot(),
+			snapshotMap(&roles.mu, &roles.items, nil),
+			snapshotMap(&tokens.mu, &tokens.items, nil),
+			snapshotMap(&credentials.mu, &credentials.items, nil),
+			snapshotMap(&webhookKeys.mu, &webhookKeys.items, nil),
+			snapshotMap(&queue.mu, &queue.items, nil),
+			snapshotMap(&outbox.mu, &outbox.items, nil),
+		}
+		return runTx("memory", func() error { return fn(repos) }, func() error { return nil }, func() error {
+			for _, restore := range restores {
+				restore()
+			}
+			return nil
+		})
+	}
+	return &Store{Repos: repos, inTx: inTx}
+}
+
+// snapshotMap copies items, cloning values with clone when they share
+// memory, and returns a func putting the copy back.
+func snapshotMap[V any](mu *sync.RWMutex, items *map[string]V, clone func(V) V) (restore func()) {
+	mu.RLock()
+	saved := maps.Clone(*items)
+	mu.RUnlock()
+	if clone != nil {
+		for k, v := range saved {
+			saved[k] = clone(v)
+		}
+	}
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		*items = saved
+	}
+}
+
+// The repositories refer to each other for the foreign keys. Locks are
+// always taken in the order tenants, services, deployments.
+
+type memoryTenants struct {
+	mu       sync.RWMutex
+	items    map[string]Tenant
+	services *memoryServices
+}
+
+func (m *memoryTenants) List(ctx context.Context) ([]Tenant, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]Tenant, 0, len(m.items))
+	for _, t := range m.items {
+		if t.DeletedAt == nil {
+			out = append(out, t)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (m *memoryTenants) Get(ctx context.Context, id string) (*Tenant, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t, ok := m.items[id]
+	if !ok || t.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+	return &t, nil
+}
+
+func (m *memoryTenants) Create(ctx context.Context, t *Tenant) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if t.ID == "" {
+		t.ID = uuid.NewString()
+	}
+	if _, ok := m.items[t.ID]; ok || m.conflicts(t) {
+		return ErrConflict
+	}
+	now := time.Now().UTC()
+	t.CreatedAt, t.UpdatedAt = now, now
+	t.DeletedAt = nil
+	t.Version = 1
+	m.items[t.ID] = *t
+	return nil
+}
+
+func (m *memoryTenants) Update(ctx context.Context, t *Tenant) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	existing, ok := m.items[t.ID]
+	if !ok || existing.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if t.Version != 0 && t.Version != existing.Version {
+		return ErrVersionConflict
+	}
+	if m.conflicts(t) {
+		return ErrConflict
+	}
+	t.CreatedAt = existing.CreatedAt
+	t.DeletedAt = nil
+	t.UpdatedAt = time.Now().UTC()
+	t.Version = existing.Version + 1
+	m.items[t.ID] = *t
+	return nil
+}
+
+// conflicts reports whether another live tenant has t's name. The caller
+// holds m.mu.
+func (m *memoryTenants) conflicts(t *Tenant) bool {
+	for id, existing := range m.items {
+		if existing.Name == t.Name && id != t.ID && existing.DeletedAt == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Delete soft-deletes the tenant with its services.
+func (m *memoryTenants) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.items[id]
+	if !ok || t.DeletedAt != nil {
+		return ErrNotFound
+	}
+	now := time.Now().UTC()
+	t.DeletedAt = &now
+	m.items[id] = t
+
+	s := m.services
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sid, svc := range s.items {
+		if svc.TenantID == id && svc.DeletedAt == nil {
+			svc.DeletedAt = &now
+			s.items[sid] = svc
+		}
+	}
+	return nil
+}
+
+type memoryEnvironments struct {
+	mu    sync.RWMutex
+	items map[string]Environment
+}
+
+func (m *memoryEnvironments) List(ctx context.Context) ([]Environment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]Environment, 0, len(m.items))
+	for _, e := range m.items {
+		if e.DeletedAt == nil {
+			out = append(out, e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (m *memoryEnvironments) Get(ctx context.Context, id string) (*Environment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.items[id]
+	if !ok || e.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+	return &e, nil
+}
+
+func (m *memoryEnvironments) Create(ctx context.Context, e *Environment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e.ID == "" {
+		e.ID = uuid.NewString()
+	}
+	if _, ok := m.items[e.ID]; ok || m.conflicts(e) {
+		return ErrConflict
+	}
+	now := time.Now().UTC()
+	e.CreatedAt, e.UpdatedAt = now, now
+	e.DeletedAt = nil
+	e.Version = 1
+	m.items[e.ID] = *e
+	return nil
+}
+
+func (m *memoryEnvironments) Update(ctx context.Context, e *Environment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	existing, ok := m.items[e.ID]
+	if !ok || existing.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if e.Version != 0 && e.Version != existing.Version {
+		return ErrVersionConflict
+	}
+	if m.conflicts(e) {
+		return ErrConflict
+	}
+	e.CreatedAt = existing.CreatedAt
+	e.DeletedAt = nil
+	e.UpdatedAt = time.Now().UTC()
+	e.Version = existing.Version + 1
+	m.items[e.ID] = *e
+	return nil
+}
+
+// conflicts reports whether another live environment has e's name. The
+// caller holds m.mu.
+func (m *memoryEnvironments) conflicts(e *Environment) bool {
+	for id, existing := range m.items {
+		if existing.Name == e.Name && id != e.ID && existing.DeletedAt == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Delete soft-deletes the environment.
+func (m *memoryEnvironments) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.items[id]
+	if !ok || e.DeletedAt != nil {
+		return ErrNotFound
+	}
+	now := time.Now().UTC()
+	e.DeletedAt = &now
+	m.items[id] = e
+	return nil
+}
+
+type memoryServices struct {
+	mu      sync.RWMutex
+	items   map[string]Service
+	tenants *memoryTenants
+}
+
+func (m *memoryServices) List(ctx context.Context, tenantID string) ([]Service, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]Service, 0, len(m.items))
+	for _, s := range m.items {
+		if (tenantID == "" || s.TenantID == tenantID) && s.DeletedAt == nil {
+			out = append(out, s)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (m *memoryServices) Get(ctx context.Context, id string) (*Service, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.items[id]
+	if !ok || s.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+	return &s, nil
+}
+
+func (m *memoryServices) Create(ctx context.Context, s *Service) error {
+	m.tenants.mu.RLock()
+	defer m.tenants.mu.RUnlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s.ID == "" {
+		s.ID = uuid.NewString()
+	}
+	if _, ok := m.items[s.ID]; ok {
+		return ErrConflict
+	}
+	if err := m.check(s); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	s.CreatedAt, s.UpdatedAt = now, now
+	s.DeletedAt = nil
+	m.items[s.ID] = *s
+	return nil
+}
+
+func (m *memoryServices) Update(ctx context.Context, s *Service) error {
+	m.tenants.mu.RLock()
+	defer m.tenants.mu.RUnlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	existing, ok := m.items[s.ID]
+	if !ok || existing.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if err := m.check(s); err != nil {
+		return err
+	}
+	s.CreatedAt = existing.CreatedAt
+	s.DeletedAt = nil
+	s.UpdatedAt = time.Now().UTC()
+	m.items[s.ID] = *s
+	return nil
+}
+
+// check enforces the reference to a live tenant and the unique name within
+// the tenant. The caller holds m.mu and m.tenants.mu.
+func (m *memoryServices) check(s *Service) error {
+	if t, ok := m.tenants.items[s.TenantID]; !ok || t.DeletedAt != nil {
+		return fmt.Errorf("%w: tenant %q", ErrNotFound, s.TenantID)
+	}
+	for id, existing := range m.items {
+		if existing.TenantID == s.TenantID && existing.Name == s.Name && id != s.ID && existing.DeletedAt == nil {
+			return ErrConflict
+		}
+	}
+	return nil
+}
+
+// Delete soft-deletes the service. Its deployments are kept as history.
+func (m *memoryServices) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.items[id]
+	if !ok || s.DeletedAt != nil {
+		return ErrNotFound
+	}
+	now := time.Now().UTC()
+	s.DeletedAt = &now
+	m.items[id] = s
+	return nil
+}
+
+type memoryDeployments struct {
+	mu       sync.RWMutex
+	items    map[string]Deployment
+	services *memoryServices
+}
+
+func (m *memoryDeployments) List(ctx context.Context, serviceID string) ([]Deployment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var out []Deployment
+	for _, d := range m.items {
+		if d.ServiceID == serviceID {
+			out = append(out, d)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].DeployedAt.After(out[j].DeployedAt) })
+	return out, nil
+}
+
+func (m *memoryDeployments) Get(ctx context.Context, id string) (*Deployment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	d, ok := m.items[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &d, nil
+}
+
+func (m *memoryDeployments) Create(ctx context.Context, d *Deployment) error {
+	m.services.mu.RLock()
+	defer m.services.mu.RUnlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.services.items[d.ServiceID]; !ok || s.DeletedAt != nil {
+		return fmt.Errorf("%w: service %q", ErrNotFound, d.ServiceID)
+	}
+	if d.ID == "" {
+		d.ID = uuid.NewString()
+	}
+	if _, ok := m.items[d.ID]; ok {
+		return ErrConflict
+	}
+	if d.DeployedAt.IsZero() {
+		d.DeployedAt = time.Now().UTC()
+	}
+	m.items[d.ID] = *d
+	return nil
+}
+
+type memoryQuotaUsage struct {
+	mu sync.RWMutex
+	// items holds each namespace's samples in the order they were recorded
+	items map[string][]QuotaSample
+}
+
+func (m *memoryQuotaUsage) Record(ctx context.Context, samples []QuotaSample) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range samples {
+		if s.SampledAt.IsZero() {
+			s.SampledAt = time.Now().UTC()
+		}
+		m.items[s.Namespace] = append(m.items[s.Namespace], s)
+	}
+	return nil
+}
+
+func (m *memoryQuotaUsage) History(ctx context.Context, namespace string, since time.Time) ([]QuotaSample, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var out []QuotaSample
+	for _, s := range m.items[namespace] {
+		if !s.SampledAt.Before(since) {
+			out = append(out, s)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].SampledAt.Before(out[j].SampledAt) })
+	return out, nil
+}
+
+func (m *memoryQuotaUsage) Prune(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pruned := 0
+	for ns, samples := range m.items {
+		kept := samples[:0]
+		for _, s := range samples {
+			if s.SampledAt.Before(before) {
+				pruned++
+				continue
+			}
+			kept = append(kept, s)
+		}
+		if len(kept) == 0 {
+			delete(m.items, ns)
+		} else {
+			m.items[ns] = kept
+		}
+	}
+	return pruned, nil
+}
+
+type memoryProvisioning struct {
+	mu    sync.RWMutex
+	items map[string]ProvisioningRecord
+}
+
+func (m *memoryProvisioning) List(ctx context.Context, tenantID string) ([]ProvisioningRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]ProvisioningRecord, 0, len(m.items))
+	for _, r := range m.items {
+		if tenantID == "" || r.TenantID == tenantID {
+			out = append(out, r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (m *memoryProvisioning) Get(ctx context.Context, id string) (*ProvisioningRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	r, ok := m.items[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &r, nil
+}
+
+func (m *memoryProvisioning) Create(ctx context.Context, r *ProvisioningRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if r.ID == "" {
+		r.ID = uuid.NewString()
+	}
+	if _, ok := m.items[r.ID]; ok {
+		return ErrConflict
+	}
+	now := time.Now().UTC()
+	r.CreatedAt, r.UpdatedAt = now, now
+	m.items[r.ID] = *r
+	return nil
+}
+
+func (m *memoryProvisioning) Update(ctx context.Context, r *ProvisioningRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	existing, ok := m.items[r.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	r.CreatedAt = existing.CreatedAt
+	r.UpdatedAt = time.Now().UTC()
+	m.items[r.ID] = *r
+	return nil
+}
+
+type memoryAudit struct {
+	mu sync.RWMutex
+	// events are kept in the order they were recorded
+	events []AuditEvent
+}
+
+func (m *memoryAudit) Record(ctx context.Context, e *AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var prevHash string
+	if n := len(m.events); n > 0 {
+		prevHash = m.events[n-1].Hash
+	}
+	prepareAudit(e, uuid.NewString, int64(len(m.events)), prevHash)
+	m.events = append(m.events, *e)
+	return nil
+}
+
+func (m *memoryAudit) Chain(ctx context.Context, afterSeq int64, limit int) ([]AuditEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	// Events are recorded with Seq = index + 1
+	start := min(max(afterSeq, 0), int64(len(m.events)))
+	out := slices.Clone(m.events[start:])
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (m *memoryAudit) Head(ctx context.Context) (int64, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.events) == 0 {
+		return 0, "", nil
+	}
+	last := m.events[len(m.events)-1]
+	return last.Seq, last.Hash, nil
+}
+
+// snapshot returns a func dropping the events recorded since. Events are
+// only ever appended, so the count is enough.
+func (m *memoryAudit) snapshot() (restore func()) {
+	m.mu.RLock()
+	n := len(m.events)
+	m.mu.RUnlock()
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.events = m.events[:n]
+	}
+}
+
+func (m *memoryAudit) List(ctx context.Context, f AuditFilter) ([]AuditEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var out []AuditEvent
+	for _, e := range m.events {
+		if (f.Actor == "" || e.Actor == f.Actor) && (f.Resource == "" || e.Resource == f.Resource) && !e.Time.Before(f.Since) {
+			out = append(out, e)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.After(out[j].Time) })
+	if f.Limit > 0 && len(out) > f.Limit {
+		out = out[:f.Limit]
+	}
+	return out, nil
+}
+
+type memoryHistory struct {
+	mu sync.RWMutex
+	// changes are kept in the order they were recorded
+	changes []Change
+}
+
+func (m *memoryHistory) Record(ctx context.Context, c *Change) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c.ID == "" {
+		c.ID = uuid.NewString()
+	}
+	if c.Time.IsZero() {
+		c.Time = time.Now().UTC()
+	}
+	m.changes = append(m.changes, *c)
+	return nil
+}
+
+// snapshot returns a func dropping the changes recorded since.
+func (m *memoryHistory) snapshot() (restore func()) {
+	m.mu.RLock()
+	n := len(m.changes)
+	m.mu.RUnlock()
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.changes = m.changes[:n]
+	}
+}
+
+func (m *memoryHistory) List(ctx context.Context, resource, id string) ([]Change, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := []Change{}
+	for i := len(m.changes) - 1; i >= 0; i-- {
+		if c := m.changes[i]; c.Resource == resource && c.ResourceID == id {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+// memorySearch ranks the live tenants and services with MatchRank.
+type memorySearch struct {
+	tenants  *memoryTenants
+	services *memoryServices
+}
+
+func (m *memorySearch) Search(ctx context.Context, query string, limit int) ([]SearchHit, error) {
+	terms := SearchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	var hits []SearchHit
+	m.tenants.mu.RLock()
+	for _, t := range m.tenants.items {
+		if t.DeletedAt != nil {
+			continue
+		}
+		if rank := MatchRank(terms, t.Name, t.DisplayName, t.Owner); rank > 0 {
+			hits = append(hits, SearchHit{Type: SearchTenant, ID: t.ID, Name: t.Name, Title: t.DisplayName, Description: t.Owner, Rank: rank})
+		}
+	}
+	m.tenants.mu.RUnlock()
+	m.services.mu.RLock()
+	for _, s := range m.services.items {
+		if s.DeletedAt != nil {
+			continue
+		}
+		if rank := MatchRank(terms, s.Name, s.Description, s.Owner, s.Repository); rank > 0 {
+			hits = append(hits, SearchHit{Type: SearchService, ID: s.ID, Name: s.Name, Description: s.Description, Rank: rank})
+		}
+	}
+	m.services.mu.RUnlock()
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Rank != hits[j].Rank {
+			return hits[i].Rank > hits[j].Rank
+		}
+		if hits[i].Name != hits[j].Name {
+			return hits[i].Name < hits[j].Name
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+type memoryRoles struct {
+	mu    sync.RWMutex
+	items map[string]RoleAssignment
+}
+
+func (m *memoryRoles) list(match func(RoleAssignment) bool) []RoleAssignment {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := []RoleAssignment{}
+	for _, a := range m.items {
+		if match(a) {
+			out = append(out, a)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+func (m *memoryRoles) List(ctx context.Context, subjectKind, subject string) ([]RoleAssignment, error) {
+	return m.list(func(a RoleAssignment) bool {
+		return subject == "" || a.SubjectKind == subjectKind && a.Subject == subject
+	}), nil
+}
+
+func (m *memoryRoles) ForIdentity(ctx context.Context, user string, groups []string) ([]RoleAssignment, error) {
+	return m.list(func(a RoleAssignment) bool {
+		return a.SubjectKind == SubjectUser && a.Subject == user ||
+			a.SubjectKind == SubjectGroup && slices.Contains(groups, a.Subject)
+	}), nil
+}
+
+func (m *memoryRoles) Create(ctx context.Context, a *RoleAssignment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if a.ID == "" {
+		a.ID = uuid.NewString()
+	}
+	for id, existing := range m.items {
+		if id == a.ID || existing.SubjectKind == a.SubjectKind && existing.Subject == a.Subject && existing.Role == a.Role {
+			return ErrConflict
+		}
+	}
+	a.CreatedAt = time.Now().UTC()
+	m.items[a.ID] = *a
+	return nil
+}
+
+func (m *memoryRoles) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.items[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.items, id)
+	return nil
+}
+
+type memoryTokens struct {
+	mu    sync.RWMutex
+	items map[string]APIToken
+}
+
+func (m *memoryTokens) Create(ctx context.Context, t *APIToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if t.ID == "" {
+		t.ID = uuid.NewString()
+	}
+	for id, existing := range m.items {
+		if id == t.ID || existing.Hash == t.Hash {
+			return ErrConflict
+		}
+	}
+	t.CreatedAt = time.Now().UTC()
+	t.Scopes = slices.Clone(t.Scopes)
+	m.items[t.ID] = *t
+	return nil
+}
+
+func (m *memoryTokens) Get(ctx context.Context, id string) (*APIToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t, ok := m.items[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &t, nil
+}
+
+func (m *memoryTokens) ByHash(ctx context.Context, hash string) (*APIToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, t := range m.items {
+		if t.Hash == hash {
+			return &t, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *memoryTokens) List(ctx context.Context, owner string) ([]APIToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := []APIToken{}
+	for _, t := range m.items {
+		if t.Owner == owner {
+			out = append(out, t)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.After(out[j].CreatedAt)
+		}
+		return out[i].ID > out[j].ID
+	})
+	return out, nil
+}
+
+func (m *memoryTokens) Revoke(ctx context.Context, id string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.items[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if t.RevokedAt == nil {
+		at = at.UTC()
+		t.RevokedAt = &at
+		m.items[id] = t
+	}
+	return nil
+}
+
+func (m *memoryTokens) Touch(ctx context.Context, id string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.items[id]
+	if !ok {
+		return ErrNotFound
+	}
+	at = at.UTC()
+	t.LastUsedAt = &at
+	m.items[id] = t
+	return nil
+}
+
+type memoryCredentials struct {
+	mu sync.RWMutex
+	// items are keyed by tenant ID and name
+	items map[string]Credential
+}
+
+func credentialKey(tenantID, name string) string {
+	return tenantID + "/" + name
+}
+
+func (m *memoryCredentials) List(ctx context.Context, tenantID string) ([]Credential, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := []Credential{}
+	for _, c := range m.items {
+		if c.TenantID == tenantID {
+			out = append(out, c)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (m *memoryCredentials) Get(ctx context.Context, tenantID, name string) (*Credential, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c, ok := m.items[credentialKey(tenantID, name)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &c, nil
+}
+
+func (m *memoryCredentials) Put(ctx context.Context, c *Credential) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UTC()
+	key := credentialKey(c.TenantID, c.Name)
+	existing, ok := m.items[key]
+	if ok {
+		c.ID, c.CreatedAt = existing.ID, existing.CreatedAt
+	} else {
+		c.CreatedAt = now
+	}
+	c.UpdatedAt = now
+	m.items[key] = *c
+	return !ok, nil
+}
+
+func (m *memoryCredentials) Delete(ctx context.Context, tenantID, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := credentialKey(tenantID, name)
+	if _, ok := m.items[key]; !ok {
+		return ErrNotFound
+	}
+	delete(m.items, key)
+	return nil
+}
+
+func (m *memoryCredentials) NotSealedWith(ctx context.Context, keyID, afterID string, limit int) ([]Credential, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := []Credential{}
+	for _, c := range m.items {
+		if c.KeyID != keyID && c.ID > afterID {
+			out = append(out, c)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (m *memoryCredentials) Reseal(ctx context.Context, id, old, value, keyID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, c := range m.items {
+		if c.ID != id {
+			continue
+		}
+		if c.Value != old {
+			return ErrVersionConflict
+		}
+		c.Value, c.KeyID = value, keyID
+		m.items[key] = c
+		return nil
+	}
+	return ErrNotFound
+}
+
+type memoryWebhookKeys struct {
+	mu    sync.RWMutex
+	items map[string]WebhookKey
+}
+
+func (m *memoryWebhookKeys) List(ctx context.Context) ([]WebhookKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]WebhookKey, 0, len(m.items))
+	for _, k := range m.items {
+		out = append(out, k)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.After(out[j].CreatedAt)
+		}
+		return out[i].ID > out[j].ID
+	})
+	return out, nil
+}
+
+func (m *memoryWebhookKeys) Create(ctx context.Context, k *WebhookKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.items[k.ID]; ok {
+		return ErrConflict
+	}
+	k.CreatedAt = time.Now().UTC()
+	m.items[k.ID] = *k
+	return nil
+}
+
+func (m *memoryWebhookKeys) Retire(ctx context.Context, keep string, at time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	at = at.UTC()
+	n := 0
+	for id, k := range m.items {
+		if id != keep && k.RetiresAt == nil {
+			k.RetiresAt = &at
+			m.items[id] = k
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *memoryWebhookKeys) Prune(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for id, k := range m.items {
+		if k.RetiresAt != nil && k.RetiresAt.Before(before) {
+			delete(m.items, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+type memoryQueue struct {
+	mu    sync.RWMutex
+	items map[string]QueueJob
+}
+
+func (m *memoryQueue) Enqueue(ctx context.Context, j *QueueJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if j.ID == "" {
+		j.ID = uuid.NewString()
+	}
+	if _, ok := m.items[j.ID]; ok {
+		return ErrConflict
+	}
+	now := time.Now().UTC()
+	if j.RunAt.IsZero() {
+		j.RunAt = now
+	}
+	j.Status, j.Attempts, j.LockedBy, j.LockedUntil, j.FinishedAt = JobQueued, 0, "", nil, nil
+	j.CreatedAt, j.UpdatedAt = now, now
+	m.items[j.ID] = *j
+	return nil
+}
+
+func (m *memoryQueue) Claim(ctx context.Context, worker string, types []string, limit int, now, leaseUntil time.Time) ([]QueueJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var due []QueueJob
+	for _, j := range m.items {
+		if !slices.Contains(types, j.Type) {
+			continue
+		}
+		if j.Status == JobQueued && !j.RunAt.After(now) ||
+			j.Status == JobRunning && j.LockedUntil != nil && j.LockedUntil.Before(now) {
+			due = append(due, j)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].RunAt.Before(due[j].RunAt) })
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+	for i := range due {
+		j, lease := &due[i], leaseUntil
+		j.Status, j.LockedBy, j.LockedUntil, j.UpdatedAt = JobRunning, worker, &lease, now
+		j.Attempts++
+		m.items[j.ID] = *j
+	}
+	return due, nil
+}
+
+func (m *memoryQueue) Finish(ctx context.Context, worker string, j *QueueJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	existing, ok := m.items[j.ID]
+	if !ok || existing.Status != JobRunning || existing.LockedBy != worker {
+		return ErrConflict
+	}
+	existing.Status, existing.LastError, existing.RunAt, existing.FinishedAt = j.Status, j.LastError, j.RunAt, j.FinishedAt
+	existing.LockedBy, existing.LockedUntil, existing.UpdatedAt = "", nil, time.Now().UTC()
+	m.items[j.ID] = existing
+	*j = existing
+	return nil
+}
+
+func (m *memoryQueue) Get(ctx context.Context, id string) (*QueueJob, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	j, ok := m.items[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &j, nil
+}
+
+func (m *memoryQueue) List(ctx context.Context, f QueueFilter) ([]QueueJob, error) {
+	m.mu.RLock()
+	var out []QueueJob
+	for _, j := range m.items {
+		if (f.Type == "" || j.Type == f.Type) && (f.Status == "" || j.Status == f.Status) {
+			out = append(out, j)
+		}
+	}
+	m.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	if f.Limit > 0 && len(out) > f.Limit {
+		out = out[:f.Limit]
+	}
+	return out, nil
+}
+
+func (m *memoryQueue) Retry(ctx context.Context, id string, now time.Time) (*QueueJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.items[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if j.Status != JobDead {
+		return nil, fmt.Errorf("job %s is %s: %w", id, j.Status, ErrConflict)
+	}
+	j.Status, j.Attempts, j.RunAt, j.FinishedAt, j.UpdatedAt = JobQueued, 0, now, nil, now
+	m.items[id] = j
+	return &j, nil
+}
+
+func (m *memoryQueue) Prune(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pruned := 0
+	for id, j := range m.items {
+		if j.Status == JobSucceeded && j.FinishedAt != nil && j.FinishedAt.Before(before) {
+			delete(m.items, id)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+type memoryOutbox struct {
+	mu    sync.RWMutex
+	items map[string]outboxEntry
+	// seq orders messages added within the same instant
+	seq int64
+}
+
+type outboxEntry struct {
+	OutboxMessage
+	seq    int64
+	sentAt time.Time
+}
+
+func (m *memoryOutbox) Add(ctx context.Context, msg *OutboxMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if msg.ID == "" {
+		msg.ID = uuid.NewString()
+	}
+	if _, ok := m.items[msg.ID]; ok {
+		return ErrConflict
+	}
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now().UTC()
+	}
+	m.seq++
+	m.items[msg.ID] = outboxEntry{OutboxMessage: *msg, seq: m.seq}
+	return nil
+}
+
+func (m *memoryOutbox) Pending(ctx context.Context, limit int) ([]OutboxMessage, error) {
+	m.mu.RLock()
+	var pending []outboxEntry
+	for _, e := range m.items {
+		if e.sentAt.IsZero() {
+			pending = append(pending, e)
+		}
+	}
+	m.mu.RUnlock()
+	sort.Slice(pending, func(i, j int) bool { return pending[i].seq < pending[j].seq })
+	if limit > 0 && len(pending) > limit {
+		pending = pending[:limit]
+	}
+	out := make([]OutboxMessage, len(pending))
+	for i, e := range pending {
+		out[i] = e.OutboxMessage
+	}
+	return out, nil
+}
+
+func (m *memoryOutbox) MarkSent(ctx context.Context, ids []string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range ids {
+		if e, ok := m.items[id]; ok {
+			e.sentAt = at
+			m.items[id] = e
+		}
+	}
+	return nil
+}
+
+func (m *memoryOutbox) Prune(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pruned := 0
+	for id, e := range m.items {
+		if !e.sentAt.IsZero() && e.sentAt.Before(before) {
+			delete(m.items, id)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
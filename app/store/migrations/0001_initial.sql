@@ -0,0 +1,76 @@
+-- Initial schema. IF NOT EXISTS lets databases that had the schema applied
+-- by hand adopt the migration history.
+
+CREATE TABLE IF NOT EXISTS tenants (
+    id           TEXT PRIMARY KEY,
+    name         TEXT NOT NULL UNIQUE,
+    display_name TEXT NOT NULL DEFAULT '',
+    owner        TEXT NOT NULL DEFAULT '',
+    labels       JSONB NOT NULL DEFAULT '{}',
+    created_at   TIMESTAMPTZ NOT NULL,
+    updated_at   TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS services (
+    id          TEXT PRIMARY KEY,
+    tenant_id   TEXT NOT NULL REFERENCES tenants (id) ON DELETE CASCADE,
+    name        TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    owner       TEXT NOT NULL DEFAULT '',
+    repository  TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL,
+    updated_at  TIMESTAMPTZ NOT NULL,
+    UNIQUE (tenant_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS deployments (
+    id          TEXT PRIMARY KEY,
+    service_id  TEXT NOT NULL REFERENCES services (id) ON DELETE CASCADE,
+    environment TEXT NOT NULL,
+    version     TEXT NOT NULL,
+    image       TEXT NOT NULL DEFAULT '',
+    replicas    INTEGER NOT NULL DEFAULT 0,
+    status      TEXT NOT NULL DEFAULT '',
+    deployed_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS deployments_service_idx ON deployments (service_id, deployed_at DESC);
+
+CREATE TABLE IF NOT EXISTS quota_samples (
+    id         BIGSERIAL PRIMARY KEY,
+    namespace  TEXT NOT NULL,
+    quota      TEXT NOT NULL,
+    resource   TEXT NOT NULL,
+    used       DOUBLE PRECISION NOT NULL,
+    hard       DOUBLE PRECISION NOT NULL,
+    sampled_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS quota_samples_namespace_idx ON quota_samples (namespace, sampled_at);
+CREATE INDEX IF NOT EXISTS quota_samples_sampled_at_idx ON quota_samples (sampled_at);
+
+-- Records outlive their tenant, so there is no foreign key
+CREATE TABLE IF NOT EXISTS provisioning_records (
+    id         TEXT PRIMARY KEY,
+    tenant_id  TEXT NOT NULL,
+    kind       TEXT NOT NULL,
+    target     TEXT NOT NULL,
+    status     TEXT NOT NULL DEFAULT '',
+    requester  TEXT NOT NULL DEFAULT '',
+    details    JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS provisioning_records_tenant_idx ON provisioning_records (tenant_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id         TEXT PRIMARY KEY,
+    actor      TEXT NOT NULL,
+    action     TEXT NOT NULL,
+    resource   TEXT NOT NULL DEFAULT '',
+    outcome    TEXT NOT NULL DEFAULT '',
+    request_id TEXT NOT NULL DEFAULT '',
+    details    JSONB NOT NULL DEFAULT '{}',
+    time       TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_events_time_idx ON audit_events (time DESC);
+CREATE INDEX IF NOT EXISTS audit_events_actor_idx ON audit_events (actor, time DESC);
+CREATE INDEX IF NOT EXISTS audit_events_resource_idx ON audit_events (resource, time DESC);
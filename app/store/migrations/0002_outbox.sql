@@ -0,0 +1,13 @@
+-- Domain events written in the same transaction as the changes they
+-- describe; seq keeps the order they were written in
+CREATE TABLE IF NOT EXISTS outbox (
+    seq        BIGSERIAL PRIMARY KEY,
+    id         TEXT NOT NULL UNIQUE,
+    type       TEXT NOT NULL,
+    source     TEXT NOT NULL DEFAULT '',
+    data       JSONB,
+    created_at TIMESTAMPTZ NOT NULL,
+    sent_at    TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (seq) WHERE sent_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_sent_at_idx ON outbox (sent_at) WHERE sent_at IS NOT NULL;
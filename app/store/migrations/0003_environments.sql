@@ -0,0 +1,15 @@
+-- Versions for optimistic concurrency on tenant updates, and the
+-- environments services are deployed to
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS environments (
+    id           TEXT PRIMARY KEY,
+    name         TEXT NOT NULL UNIQUE,
+    display_name TEXT NOT NULL DEFAULT '',
+    tier         TEXT NOT NULL,
+    cluster      TEXT NOT NULL DEFAULT '',
+    labels       JSONB NOT NULL DEFAULT '{}',
+    version      BIGINT NOT NULL DEFAULT 1,
+    created_at   TIMESTAMPTZ NOT NULL,
+    updated_at   TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,31 @@
+-- Soft deletes for tenants, environments and services: names are unique
+-- among live rows only, so a deleted name can be reused. Deleted rows and
+-- their deployments stay for the change history.
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE environments ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE services ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+ALTER TABLE tenants DROP CONSTRAINT IF EXISTS tenants_name_key;
+ALTER TABLE environments DROP CONSTRAINT IF EXISTS environments_name_key;
+ALTER TABLE services DROP CONSTRAINT IF EXISTS services_tenant_id_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS tenants_live_name ON tenants (name) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS environments_live_name ON environments (name) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS services_live_name ON services (tenant_id, name) WHERE deleted_at IS NULL;
+
+-- Every change to a platform entity, with the entity before and after and
+-- the JSON merge patch between them
+CREATE TABLE IF NOT EXISTS entity_history (
+    seq         BIGSERIAL PRIMARY KEY,
+    id          TEXT NOT NULL UNIQUE,
+    resource    TEXT NOT NULL,
+    resource_id TEXT NOT NULL,
+    action      TEXT NOT NULL,
+    actor       TEXT NOT NULL DEFAULT '',
+    request_id  TEXT NOT NULL DEFAULT '',
+    before      JSONB,
+    after       JSONB,
+    diff        JSONB,
+    changed_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS entity_history_resource ON entity_history (resource, resource_id, seq DESC);
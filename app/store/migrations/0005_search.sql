@@ -0,0 +1,9 @@
+-- Full-text search over live tenants and services. The expressions must
+-- match tenantSearchDoc and serviceSearchDoc in postgres.go.
+CREATE INDEX IF NOT EXISTS tenants_search ON tenants USING GIN (
+    (setweight(to_tsvector('simple', name), 'A') || setweight(to_tsvector('simple', display_name || ' ' || owner), 'B'))
+) WHERE deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS services_search ON services USING GIN (
+    (setweight(to_tsvector('simple', name), 'A') || setweight(to_tsvector('simple', description || ' ' || owner || ' ' || repository), 'B'))
+) WHERE deleted_at IS NULL;
@@ -0,0 +1,20 @@
+-- Background jobs. Workers claim due queued jobs, and running jobs whose
+-- lease has expired, with FOR UPDATE SKIP LOCKED.
+CREATE TABLE IF NOT EXISTS queue_jobs (
+    id           TEXT PRIMARY KEY,
+    type         TEXT NOT NULL,
+    payload      JSONB,
+    status       TEXT NOT NULL,
+    attempts     INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL,
+    last_error   TEXT NOT NULL DEFAULT '',
+    run_at       TIMESTAMPTZ NOT NULL,
+    locked_by    TEXT NOT NULL DEFAULT '',
+    locked_until TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL,
+    updated_at   TIMESTAMPTZ NOT NULL,
+    finished_at  TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS queue_jobs_due_idx ON queue_jobs (run_at) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS queue_jobs_lease_idx ON queue_jobs (locked_until) WHERE status = 'running';
+CREATE INDEX IF NOT EXISTS queue_jobs_created_at_idx ON queue_jobs (created_at);
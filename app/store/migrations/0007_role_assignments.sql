@@ -0,0 +1,10 @@
+-- Roles granted to users and groups through the RBAC admin API
+CREATE TABLE IF NOT EXISTS role_assignments (
+    id           TEXT PRIMARY KEY,
+    subject_kind TEXT NOT NULL,
+    subject      TEXT NOT NULL,
+    role         TEXT NOT NULL,
+    created_by   TEXT NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL,
+    UNIQUE (subject_kind, subject, role)
+);
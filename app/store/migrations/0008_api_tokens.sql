@@ -0,0 +1,16 @@
+-- Personal access tokens; the secret itself is never stored, only its hash
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id           TEXT PRIMARY KEY,
+    owner        TEXT NOT NULL,
+    groups       TEXT[] NOT NULL DEFAULT '{}',
+    name         TEXT NOT NULL,
+    prefix       TEXT NOT NULL,
+    hash         TEXT NOT NULL UNIQUE,
+    scopes       TEXT[] NOT NULL DEFAULT '{}',
+    expires_at   TIMESTAMPTZ NOT NULL,
+    last_used_at TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS api_tokens_owner_idx ON api_tokens (owner, created_at DESC);
@@ -0,0 +1,16 @@
+-- Tenant credentials, sealed with envelope encryption before they are stored
+CREATE TABLE IF NOT EXISTS credentials (
+    id          TEXT PRIMARY KEY,
+    tenant_id   TEXT NOT NULL,
+    name        TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    value       TEXT NOT NULL,
+    key_id      TEXT NOT NULL,
+    updated_by  TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL,
+    updated_at  TIMESTAMPTZ NOT NULL,
+    UNIQUE (tenant_id, name)
+);
+
+-- Finds credentials still sealed with a retired master key
+CREATE INDEX IF NOT EXISTS credentials_key_id_idx ON credentials (key_id);
@@ -0,0 +1,18 @@
+-- Hash-chain audit events: each event's hash covers the previous event's
+-- hash. Events recorded before this migration stay unchained.
+ALTER TABLE audit_events
+    ADD COLUMN IF NOT EXISTS seq       BIGINT,
+    ADD COLUMN IF NOT EXISTS prev_hash TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS hash      TEXT NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS audit_events_seq_idx ON audit_events (seq);
+
+-- The last chained event. Recording locks this row, which serialises the
+-- chain; it also shows when the latest events are deleted.
+CREATE TABLE IF NOT EXISTS audit_chain (
+    id   INT PRIMARY KEY CHECK (id = 1),
+    seq  BIGINT NOT NULL,
+    hash TEXT NOT NULL
+);
+
+INSERT INTO audit_chain (id, seq, hash) VALUES (1, 0, '') ON CONFLICT (id) DO NOTHING;
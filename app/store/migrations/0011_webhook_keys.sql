@@ -0,0 +1,11 @@
+-- Keys signing outgoing webhook deliveries; secrets are sealed with
+-- envelope encryption before they are stored
+CREATE TABLE IF NOT EXISTS webhook_keys (
+    id         TEXT PRIMARY KEY,
+    algorithm  TEXT NOT NULL,
+    secret     TEXT NOT NULL,
+    public_key TEXT NOT NULL DEFAULT '',
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL,
+    retires_at TIMESTAMPTZ
+);
@@ -0,0 +1,3 @@
+-- Tokens act with their owner's current groups, looked up when used,
+-- rather than the groups the owner had when creating them
+ALTER TABLE api_tokens DROP COLUMN IF EXISTS groups;
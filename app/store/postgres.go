@@ -0,0 +1,1402 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "store_query_duration_seconds",
+		Help:    "PostgreSQL query latency by operation and result.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"operation", "result"})
+	queryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "store_query_errors_total",
+		Help: "PostgreSQL errors by operation and kind (conflict, foreign_key, serialization, timeout, canceled, connection or other).",
+	}, []string{"operation", "kind"})
+)
+
+// PostgresOptions configures the PostgreSQL connection pool.
+type PostgresOptions struct {
+	// DSN is a postgres:// URL or a libpq key=value connection string.
+	DSN             string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// PingTimeout bounds Check and replica checks; 0 leaves them to the
+	// caller's context.
+	PingTimeout time.Duration
+	// ReplicaDSNs are read replicas, each with a pool sized like the
+	// primary's. Reads outside transactions go to them in turn; see
+	// MonitorReplicas.
+	ReplicaDSNs []string
+	// MaxReplicaLag is how far behind a replica may be and still serve
+	// reads; 0 only skips unreachable replicas.
+	MaxReplicaLag time.Duration
+}
+
+// Postgres keeps the platform's entities in PostgreSQL. The tables are
+// created by the embedded migrations; see Migrate.
+type Postgres struct {
+	db          *sql.DB
+	replicas    *replicaSet
+	pingTimeout time.Duration
+	// poolStats export the pools' sql.DBStats as go_sql_* metrics
+	poolStats []prometheus.Collector
+	// schemaCurrent is set once no migration is pending
+	schemaCurrent atomic.Bool
+}
+
+// OpenPostgres opens the connection pools and checks the primary answers;
+// see NewPostgres and Connect.
+func OpenPostgres(ctx context.Context, opts PostgresOptions) (*Postgres, error) {
+	p, err := NewPostgres(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Connect(ctx); err != nil {
+		p.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// NewPostgres opens the connection pools without connecting; queries fail
+// until the database answers. Replicas are skipped for reads until Connect
+// or MonitorReplicas finds them healthy. The pools' statistics are
+// registered as go_sql_* metrics with db_name="store" (and
+// "store-<replica>") until Close.
+func NewPostgres(opts PostgresOptions) (*Postgres, error) {
+	db, err := openPool(opts.DSN, opts)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+	p := &Postgres{db: db, pingTimeout: opts.PingTimeout}
+	p.registerPoolStats(db, "store")
+
+	if len(opts.ReplicaDSNs) > 0 {
+		p.replicas = &replicaSet{maxLag: opts.MaxReplicaLag, timeout: opts.PingTimeout}
+		for i, dsn := range opts.ReplicaDSNs {
+			rdb, err := openPool(dsn, opts)
+			if err != nil {
+				p.Close()
+				return nil, fmt.Errorf("open database replica %d: %w", i, err)
+			}
+			r := &replica{name: replicaName(i, dsn), db: rdb}
+			p.replicas.replicas = append(p.replicas.replicas, r)
+			p.registerPoolStats(rdb, "store-"+r.name)
+		}
+	}
+	return p, nil
+}
+
+// Connect checks the primary answers, then checks each replica. Replicas
+// that do not answer do not fail it; they are skipped for reads until
+// MonitorReplicas finds them healthy. It may be called again after it
+// fails.
+func (p *Postgres) Connect(ctx context.Context) error {
+	if err := p.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("connect to database: %w", err)
+	}
+	if p.replicas != nil {
+		for _, r := range p.replicas.replicas {
+			p.replicas.check(ctx, r)
+		}
+	}
+	return nil
+}
+
+func openPool(dsn string, opts PostgresOptions) (*sql.DB, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxIdleConns)
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+	return db, nil
+}
+
+func (p *Postgres) registerPoolStats(db *sql.DB, name string) {
+	c := collectors.NewDBStatsCollector(db, name)
+	// If another pool of that name is open in this process, it keeps the
+	// metrics
+	if err := prometheus.Register(c); err == nil {
+		p.poolStats = append(p.poolStats, c)
+	}
+}
+
+// Store returns the repositories backed by the database.
+func (p *Postgres) Store() *Store {
+	return &Store{Repos: pgRepos(pgDB{db: p.db, replicas: p.replicas}), inTx: p.inTx}
+}
+
+func pgRepos(d pgDB) Repos {
+	return Repos{
+		Tenants:      pgTenants{d},
+		Environments: pgEnvironments{d},
+		Services:     pgServices{d},
+		Deployments:  pgDeployments{d},
+		QuotaUsage:   pgQuotaUsage{d},
+		Provisioning: pgProvisioning{d},
+		Audit:        pgAudit{d},
+		History:      pgHistory{d},
+		Search:       pgSearch{d},
+		Roles:        pgRoles{d},
+		Tokens:       pgTokens{d},
+		Credentials:  pgCredentials{d},
+		WebhookKeys:  pgWebhookKeys{d},
+		Queue:        pgQueue{d},
+		Outbox:       pgOutbox{d},
+	}
+}
+
+// inTx runs fn with repositories bound to a database transaction.
+// Beginning, committing and rolling back are timed as the tx.begin,
+// tx.commit and tx.rollback operations.
+func (p *Postgres) inTx(ctx context.Context, fn func(Repos) error) error {
+	start := time.Now()
+	tx, err := p.db.BeginTx(ctx, nil)
+	observe("tx.begin", start, err)
+	if err != nil {
+		transactions.WithLabelValues("postgres", "error").Inc()
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	commit := func() error {
+		start := time.Now()
+		err := tx.Commit()
+		observe("tx.commit", start, err)
+		return translate(err)
+	}
+	rollback := func() error {
+		start := time.Now()
+		err := tx.Rollback()
+		observe("tx.rollback", start, err)
+		return err
+	}
+	return runTx("postgres", func() error { return fn(pgRepos(pgDB{db: tx})) }, commit, rollback)
+}
+
+// Check pings the database within PingTimeout, for readiness probes. It is
+// timed as the ping operation.
+func (p *Postgres) Check(ctx context.Context) error {
+	if p.pingTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.pingTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	err := p.db.PingContext(ctx)
+	observe("ping", start, err)
+	return err
+}
+
+// Warm opens up to n connections in each pool and returns them to it idle,
+// so that the first requests do not wait for connections to be set up.
+func (p *Postgres) Warm(ctx context.Context, n int) error {
+	pools := []*sql.DB{p.db}
+	if p.replicas != nil {
+		for _, r := range p.replicas.replicas {
+			pools = append(pools, r.db)
+		}
+	}
+	for _, db := range pools {
+		conns := make([]*sql.Conn, 0, n)
+		var err error
+		for range n {
+			var c *sql.Conn
+			if c, err = db.Conn(ctx); err != nil {
+				break
+			}
+			conns = append(conns, c)
+		}
+		for _, c := range conns {
+			c.Close()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the connection pools.
+func (p *Postgres) Close() error {
+	for _, c := range p.poolStats {
+		prometheus.Unregister(c)
+	}
+	if p.replicas != nil {
+		for _, r := range p.replicas.replicas {
+			r.db.Close()
+		}
+	}
+	return p.db.Close()
+}
+
+// pgDB runs queries and records their latency under an operation name.
+type pgDB struct {
+	db querier
+	// replicas serve reads that go through reader; nil in transactions
+	replicas *replicaSet
+}
+
+// querier is a *sql.DB or a *sql.Tx.
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// scanner is a *sql.Row or *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func (d pgDB) get(ctx context.Context, op string, scan func(scanner) error, query string, args ...any) error {
+	start := time.Now()
+	err := scan(d.db.QueryRowContext(ctx, query, args...))
+	observe(op, start, err)
+	return translate(err)
+}
+
+func (d pgDB) list(ctx context.Context, op string, scan func(scanner) error, query string, args ...any) error {
+	start := time.Now()
+	err := func() error {
+		rows, err := d.db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			if err := scan(rows); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	}()
+	observe(op, start, err)
+	return translate(err)
+}
+
+// exec runs a statement and returns the number of rows it affected.
+func (d pgDB) exec(ctx context.Context, op, query string, args ...any) (int64, error) {
+	start := time.Now()
+	res, err := d.db.ExecContext(ctx, query, args...)
+	var n int64
+	if err == nil {
+		n, err = res.RowsAffected()
+	}
+	observe(op, start, err)
+	return n, translate(err)
+}
+
+func observe(op string, start time.Time, err error) {
+	result := "success"
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		result = "error"
+		queryErrors.WithLabelValues(op, errorKind(err)).Inc()
+	}
+	queryDuration.WithLabelValues(op, result).Observe(time.Since(start).Seconds())
+}
+
+// errorKind classifies a database error for metrics.
+func errorKind(err error) string {
+	var pgErr *pgconn.PgError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone), errors.As(err, &netErr):
+		return "connection"
+	case errors.As(err, &pgErr):
+		switch pgErr.Code {
+		case "23505": // unique_violation
+			return "conflict"
+		case "23503": // foreign_key_violation
+			return "foreign_key"
+		case "40001", "40P01": // serialization_failure, deadlock_detected
+			return "serialization"
+		case "57014": // query_canceled, e.g. by statement_timeout
+			return "timeout"
+		}
+		if strings.HasPrefix(pgErr.Code, "08") { // connection_exception
+			return "connection"
+		}
+	}
+	return "other"
+}
+
+// translate maps database errors onto the repository errors.
+func translate(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505": // unique_violation
+			return ErrConflict
+		case "23503": // foreign_key_violation
+			return fmt.Errorf("%w: %s", ErrNotFound, pgErr.ConstraintName)
+		}
+	}
+	return err
+}
+
+// textArray scans a text[] column into v. database/sql receives arrays from
+// the pgx driver in their text form, so pgx's type map decodes them.
+func textArray(v *[]string) sql.Scanner {
+	return pgtype.NewMap().SQLScanner(v)
+}
+
+// stringMap stores a map[string]string as JSONB. Values are sent as text;
+// []byte would be sent as bytea.
+type stringMap map[string]string
+
+func (m stringMap) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(map[string]string(m))
+	return string(b), err
+}
+
+func (m *stringMap) Scan(src any) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("unexpected JSONB value %T", src)
+	}
+	*m = nil
+	if err := json.Unmarshal(b, (*map[string]string)(m)); err != nil {
+		return err
+	}
+	if len(*m) == 0 {
+		*m = nil
+	}
+	return nil
+}
+
+// jsonValue is raw JSON in a JSONB column, NULL when empty. Like
+// stringMap it is sent as text rather than bytea.
+type jsonValue json.RawMessage
+
+func (j jsonValue) Value() (driver.Value, error) {
+	if len(j) == 0 {
+		return nil, nil
+	}
+	return string(j), nil
+}
+
+func (j *jsonValue) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*j = nil
+	case []byte:
+		*j = append(jsonValue(nil), v...)
+	case string:
+		*j = jsonValue(v)
+	default:
+		return fmt.Errorf("unexpected JSONB value %T", src)
+	}
+	return nil
+}
+
+// utc scans a timestamptz in UTC, like the memory store keeps them.
+type utc struct {
+	t *time.Time
+}
+
+func (u utc) Scan(src any) error {
+	t, ok := src.(time.Time)
+	if !ok {
+		return fmt.Errorf("unexpected timestamp value %T", src)
+	}
+	*u.t = t.UTC()
+	return nil
+}
+
+// nullUTC scans a nullable timestamptz in UTC.
+type nullUTC struct {
+	t **time.Time
+}
+
+func (u nullUTC) Scan(src any) error {
+	if src == nil {
+		*u.t = nil
+		return nil
+	}
+	var t time.Time
+	if err := (utc{&t}).Scan(src); err != nil {
+		return err
+	}
+	*u.t = &t
+	return nil
+}
+
+type pgTenants struct{ d pgDB }
+
+const tenantColumns = "id, name, display_name, owner, labels, version, created_at, updated_at"
+
+func scanTenant(s scanner, t *Tenant) error {
+	return s.Scan(&t.ID, &t.Name, &t.DisplayName, &t.Owner, (*stringMap)(&t.Labels), &t.Version, utc{&t.CreatedAt}, utc{&t.UpdatedAt})
+}
+
+func (r pgTenants) List(ctx context.Context) ([]Tenant, error) {
+	out := []Tenant{}
+	err := r.d.reader().list(ctx, "tenants.list", func(s scanner) error {
+		var t Tenant
+		if err := scanTenant(s, &t); err != nil {
+			return err
+		}
+		out = append(out, t)
+		return nil
+	}, "SELECT "+tenantColumns+" FROM tenants WHERE deleted_at IS NULL ORDER BY name")
+	return out, err
+}
+
+func (r pgTenants) Get(ctx context.Context, id string) (*Tenant, error) {
+	var t Tenant
+	err := r.d.reader().get(ctx, "tenants.get", func(s scanner) error { return scanTenant(s, &t) },
+		"SELECT "+tenantColumns+" FROM tenants WHERE id = $1 AND deleted_at IS NULL", id)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r pgTenants) Create(ctx context.Context, t *Tenant) error {
+	if t.ID == "" {
+		t.ID = uuid.NewString()
+	}
+	now := time.Now().UTC()
+	t.CreatedAt, t.UpdatedAt = now, now
+	t.Version, t.DeletedAt = 1, nil
+	_, err := r.d.exec(ctx, "tenants.create",
+		"INSERT INTO tenants ("+tenantColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		t.ID, t.Name, t.DisplayName, t.Owner, stringMap(t.Labels), t.Version, t.CreatedAt, t.UpdatedAt)
+	return err
+}
+
+func (r pgTenants) Update(ctx context.Context, t *Tenant) error {
+	t.UpdatedAt = time.Now().UTC()
+	err := r.d.get(ctx, "tenants.update", func(s scanner) error { return s.Scan(&t.Version, utc{&t.CreatedAt}) },
+		`UPDATE tenants SET name = $2, display_name = $3, owner = $4, labels = $5, updated_at = $6, version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL AND ($7::bigint = 0 OR version = $7) RETURNING version, created_at`,
+		t.ID, t.Name, t.DisplayName, t.Owner, stringMap(t.Labels), t.UpdatedAt, t.Version)
+	if errors.Is(err, ErrNotFound) && t.Version != 0 {
+		return versionConflict(ctx, r.d, "tenants", t.ID)
+	}
+	return err
+}
+
+// Delete soft-deletes the tenant with its services.
+func (r pgTenants) Delete(ctx context.Context, id string) error {
+	n, err := r.d.exec(ctx, "tenants.delete",
+		`WITH services AS (
+			UPDATE services SET deleted_at = $2 WHERE tenant_id = $1 AND deleted_at IS NULL
+		)
+		UPDATE tenants SET deleted_at = $2 WHERE id = $1 AND deleted_at IS NULL`,
+		id, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type pgEnvironments struct{ d pgDB }
+
+const environmentColumns = "id, name, display_name, tier, cluster, labels, version, created_at, updated_at"
+
+func scanEnvironment(s scanner, e *Environment) error {
+	return s.Scan(&e.ID, &e.Name, &e.DisplayName, &e.Tier, &e.Cluster, (*stringMap)(&e.Labels), &e.Version, utc{&e.CreatedAt}, utc{&e.UpdatedAt})
+}
+
+func (r pgEnvironments) List(ctx context.Context) ([]Environment, error) {
+	out := []Environment{}
+	err := r.d.reader().list(ctx, "environments.list", func(s scanner) error {
+		var e Environment
+		if err := scanEnvironment(s, &e); err != nil {
+			return err
+		}
+		out = append(out, e)
+		return nil
+	}, "SELECT "+environmentColumns+" FROM environments WHERE deleted_at IS NULL ORDER BY name")
+	return out, err
+}
+
+func (r pgEnvironments) Get(ctx context.Context, id string) (*Environment, error) {
+	var e Environment
+	err := r.d.reader().get(ctx, "environments.get", func(s scanner) error { return scanEnvironment(s, &e) },
+		"SELECT "+environmentColumns+" FROM environments WHERE id = $1 AND deleted_at IS NULL", id)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (r pgEnvironments) Create(ctx context.Context, e *Environment) error {
+	if e.ID == "" {
+		e.ID = uuid.NewString()
+	}
+	now := time.Now().UTC()
+	e.CreatedAt, e.UpdatedAt = now, now
+	e.Version, e.DeletedAt = 1, nil
+	_, err := r.d.exec(ctx, "environments.create",
+		"INSERT INTO environments ("+environmentColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+		e.ID, e.Name, e.DisplayName, e.Tier, e.Cluster, stringMap(e.Labels), e.Version, e.CreatedAt, e.UpdatedAt)
+	return err
+}
+
+func (r pgEnvironments) Update(ctx context.Context, e *Environment) error {
+	e.UpdatedAt = time.Now().UTC()
+	err := r.d.get(ctx, "environments.update", func(s scanner) error { return s.Scan(&e.Version, utc{&e.CreatedAt}) },
+		`UPDATE environments SET name = $2, display_name = $3, tier = $4, cluster = $5, labels = $6, updated_at = $7, version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL AND ($8::bigint = 0 OR version = $8) RETURNING version, created_at`,
+		e.ID, e.Name, e.DisplayName, e.Tier, e.Cluster, stringMap(e.Labels), e.UpdatedAt, e.Version)
+	if errors.Is(err, ErrNotFound) && e.Version != 0 {
+		return versionConflict(ctx, r.d, "environments", e.ID)
+	}
+	return err
+}
+
+// Delete soft-deletes the environment.
+func (r pgEnvironments) Delete(ctx context.Context, id string) error {
+	return softDelete(ctx, r.d, "environments", id)
+}
+
+type pgServices struct{ d pgDB }
+
+const serviceColumns = "id, tenant_id, name, description, owner, repository, created_at, updated_at"
+
+func scanService(s scanner, svc *Service) error {
+	return s.Scan(&svc.ID, &svc.TenantID, &svc.Name, &svc.Description, &svc.Owner, &svc.Repository, utc{&svc.CreatedAt}, utc{&svc.UpdatedAt})
+}
+
+func (r pgServices) List(ctx context.Context, tenantID string) ([]Service, error) {
+	out := []Service{}
+	err := r.d.reader().list(ctx, "services.list", func(s scanner) error {
+		var svc Service
+		if err := scanService(s, &svc); err != nil {
+			return err
+		}
+		out = append(out, svc)
+		return nil
+	}, "SELECT "+serviceColumns+" FROM services WHERE ($1::text = '' OR tenant_id = $1) AND deleted_at IS NULL ORDER BY name", tenantID)
+	return out, err
+}
+
+func (r pgServices) Get(ctx context.Context, id string) (*Service, error) {
+	var svc Service
+	err := r.d.reader().get(ctx, "services.get", func(s scanner) error { return scanService(s, &svc) },
+		"SELECT "+serviceColumns+" FROM services WHERE id = $1 AND deleted_at IS NULL", id)
+	if err != nil {
+		return nil, err
+	}
+	return &svc, nil
+}
+
+func (r pgServices) Create(ctx context.Context, s *Service) error {
+	if s.ID == "" {
+		s.ID = uuid.NewString()
+	}
+	now := time.Now().UTC()
+	s.CreatedAt, s.UpdatedAt, s.DeletedAt = now, now, nil
+	// The foreign key cannot tell a soft-deleted tenant from a live one
+	n, err := r.d.exec(ctx, "services.create",
+		`INSERT INTO services (`+serviceColumns+`) SELECT $1, $2, $3, $4, $5, $6, $7::timestamptz, $8::timestamptz
+		WHERE EXISTS (SELECT 1 FROM tenants WHERE id = $2 AND deleted_at IS NULL)`,
+		s.ID, s.TenantID, s.Name, s.Description, s.Owner, s.Repository, s.CreatedAt, s.UpdatedAt)
+	if err == nil && n == 0 {
+		return fmt.Errorf("%w: tenant %q", ErrNotFound, s.TenantID)
+	}
+	return err
+}
+
+func (r pgServices) Update(ctx context.Context, s *Service) error {
+	s.UpdatedAt = time.Now().UTC()
+	return r.d.get(ctx, "services.update", func(sc scanner) error { return sc.Scan(utc{&s.CreatedAt}) },
+		`UPDATE services SET tenant_id = $2, name = $3, description = $4, owner = $5, repository = $6, updated_at = $7
+		WHERE id = $1 AND deleted_at IS NULL
+		AND EXISTS (SELECT 1 FROM tenants WHERE id = $2 AND deleted_at IS NULL) RETURNING created_at`,
+		s.ID, s.TenantID, s.Name, s.Description, s.Owner, s.Repository, s.UpdatedAt)
+}
+
+// Delete soft-deletes the service. Its deployments are kept as history.
+func (r pgServices) Delete(ctx context.Context, id string) error {
+	return softDelete(ctx, r.d, "services", id)
+}
+
+type pgDeployments struct{ d pgDB }
+
+const deploymentColumns = "id, service_id, environment, version, image, replicas, status, deployed_at"
+
+func scanDeployment(s scanner, d *Deployment) error {
+	return s.Scan(&d.ID, &d.ServiceID, &d.Environment, &d.Version, &d.Image, &d.Replicas, &d.Status, utc{&d.DeployedAt})
+}
+
+func (r pgDeployments) List(ctx context.Context, serviceID string) ([]Deployment, error) {
+	var out []Deployment
+	err := r.d.reader().list(ctx, "deployments.list", func(s scanner) error {
+		var d Deployment
+		if err := scanDeployment(s, &d); err != nil {
+			return err
+		}
+		out = append(out, d)
+		return nil
+	}, "SELECT "+deploymentColumns+" FROM deployments WHERE service_id = $1 ORDER BY deployed_at DESC", serviceID)
+	return out, err
+}
+
+func (r pgDeployments) Get(ctx context.Context, id string) (*Deployment, error) {
+	var d Deployment
+	err := r.d.reader().get(ctx, "deployments.get", func(s scanner) error { return scanDeployment(s, &d) },
+		"SELECT "+deploymentColumns+" FROM deployments WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (r pgDeployments) Create(ctx context.Context, d *Deployment) error {
+	if d.ID == "" {
+		d.ID = uuid.NewString()
+	}
+	if d.DeployedAt.IsZero() {
+		d.DeployedAt = time.Now().UTC()
+	}
+	n, err := r.d.exec(ctx, "deployments.create",
+		`INSERT INTO deployments (`+deploymentColumns+`) SELECT $1, $2, $3, $4, $5, $6::integer, $7, $8::timestamptz
+		WHERE EXISTS (SELECT 1 FROM services WHERE id = $2 AND deleted_at IS NULL)`,
+		d.ID, d.ServiceID, d.Environment, d.Version, d.Image, d.Replicas, d.Status, d.DeployedAt)
+	if err == nil && n == 0 {
+		return fmt.Errorf("%w: service %q", ErrNotFound, d.ServiceID)
+	}
+	return err
+}
+
+type pgQuotaUsage struct{ d pgDB }
+
+func (r pgQuotaUsage) Record(ctx context.Context, samples []QuotaSample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	// One multi-row insert per batch; a sampling pass is a few hundred rows
+	// at most
+	var b strings.Builder
+	b.WriteString("INSERT INTO quota_samples (namespace, quota, resource, used, hard, sampled_at) VALUES ")
+	args := make([]any, 0, len(samples)*6)
+	for i, s := range samples {
+		if s.SampledAt.IsZero() {
+			s.SampledAt = time.Now().UTC()
+		}
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		n := len(args)
+		fmt.Fprintf(&b, "($%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6)
+		args = append(args, s.Namespace, s.Quota, s.Resource, s.Used, s.Hard, s.SampledAt)
+	}
+	_, err := r.d.exec(ctx, "quota_samples.record", b.String(), args...)
+	return err
+}
+
+func (r pgQuotaUsage) History(ctx context.Context, namespace string, since time.Time) ([]QuotaSample, error) {
+	var out []QuotaSample
+	err := r.d.reader().list(ctx, "quota_samples.history", func(s scanner) error {
+		var q QuotaSample
+		if err := s.Scan(&q.Namespace, &q.Quota, &q.Resource, &q.Used, &q.Hard, utc{&q.SampledAt}); err != nil {
+			return err
+		}
+		out = append(out, q)
+		return nil
+	}, `SELECT namespace, quota, resource, used, hard, sampled_at FROM quota_samples
+	WHERE namespace = $1 AND sampled_at >= $2 ORDER BY sampled_at, id`, namespace, since)
+	return out, err
+}
+
+func (r pgQuotaUsage) Prune(ctx context.Context, before time.Time) (int, error) {
+	n, err := r.d.exec(ctx, "quota_samples.prune", "DELETE FROM quota_samples WHERE sampled_at < $1", before)
+	return int(n), err
+}
+
+type pgProvisioning struct{ d pgDB }
+
+const provisioningColumns = "id, tenant_id, kind, target, status, requester, details, created_at, updated_at"
+
+func scanProvisioning(s scanner, r *ProvisioningRecord) error {
+	return s.Scan(&r.ID, &r.TenantID, &r.Kind, &r.Target, &r.Status, &r.Requester, (*stringMap)(&r.Details), utc{&r.CreatedAt}, utc{&r.UpdatedAt})
+}
+
+func (r pgProvisioning) List(ctx context.Context, tenantID string) ([]ProvisioningRecord, error) {
+	out := []ProvisioningRecord{}
+	err := r.d.reader().list(ctx, "provisioning_records.list", func(s scanner) error {
+		var rec ProvisioningRecord
+		if err := scanProvisioning(s, &rec); err != nil {
+			return err
+		}
+		out = append(out, rec)
+		return nil
+	}, "SELECT "+provisioningColumns+" FROM provisioning_records WHERE $1::text = '' OR tenant_id = $1 ORDER BY created_at DESC", tenantID)
+	return out, err
+}
+
+func (r pgProvisioning) Get(ctx context.Context, id string) (*ProvisioningRecord, error) {
+	var rec ProvisioningRecord
+	err := r.d.reader().get(ctx, "provisioning_records.get", func(s scanner) error { return scanProvisioning(s, &rec) },
+		"SELECT "+provisioningColumns+" FROM provisioning_records WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (r pgProvisioning) Create(ctx context.Context, rec *ProvisioningRecord) error {
+	if rec.ID == "" {
+		rec.ID = uuid.NewString()
+	}
+	now := time.Now().UTC()
+	rec.CreatedAt, rec.UpdatedAt = now, now
+	_, err := r.d.exec(ctx, "provisioning_records.create",
+		"INSERT INTO provisioning_records ("+provisioningColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+		rec.ID, rec.TenantID, rec.Kind, rec.Target, rec.Status, rec.Requester, stringMap(rec.Details), rec.CreatedAt, rec.UpdatedAt)
+	return err
+}
+
+func (r pgProvisioning) Update(ctx context.Context, rec *ProvisioningRecord) error {
+	rec.UpdatedAt = time.Now().UTC()
+	return r.d.get(ctx, "provisioning_records.update", func(s scanner) error { return s.Scan(utc{&rec.CreatedAt}) },
+		`UPDATE provisioning_records SET tenant_id = $2, kind = $3, target = $4, status = $5, requester = $6, details = $7, updated_at = $8
+		WHERE id = $1 RETURNING created_at`,
+		rec.ID, rec.TenantID, rec.Kind, rec.Target, rec.Status, rec.Requester, stringMap(rec.Details), rec.UpdatedAt)
+}
+
+type pgAudit struct{ d pgDB }
+
+// Record locks the chain head, so events are chained one at a time. Outside
+// a transaction it takes its own for the lock to cover the insert; inside
+// one, other events wait until it ends.
+func (r pgAudit) Record(ctx context.Context, e *AuditEvent) error {
+	db, ok := r.d.db.(*sql.DB)
+	if !ok {
+		return r.record(ctx, e)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	if err := (pgAudit{pgDB{db: tx}}).record(ctx, e); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return translate(tx.Commit())
+}
+
+func (r pgAudit) record(ctx context.Context, e *AuditEvent) error {
+	var (
+		seq  int64
+		hash string
+	)
+	if err := r.d.get(ctx, "audit_chain.lock", func(s scanner) error { return s.Scan(&seq, &hash) },
+		"SELECT seq, hash FROM audit_chain WHERE id = 1 FOR UPDATE"); err != nil {
+		return err
+	}
+	prepareAudit(e, uuid.NewString, seq, hash)
+	if _, err := r.d.exec(ctx, "audit_events.record",
+		`INSERT INTO audit_events (id, actor, action, resource, outcome, request_id, details, time, seq, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		e.ID, e.Actor, e.Action, e.Resource, e.Outcome, e.RequestID, stringMap(e.Details), e.Time,
+		e.Seq, e.PrevHash, e.Hash); err != nil {
+		return err
+	}
+	_, err := r.d.exec(ctx, "audit_chain.advance", "UPDATE audit_chain SET seq = $1, hash = $2 WHERE id = 1", e.Seq, e.Hash)
+	return err
+}
+
+const auditColumns = "id, actor, action, resource, outcome, request_id, details, time, COALESCE(seq, 0), prev_hash, hash"
+
+func scanAuditEvent(s scanner, e *AuditEvent) error {
+	return s.Scan(&e.ID, &e.Actor, &e.Action, &e.Resource, &e.Outcome, &e.RequestID, (*stringMap)(&e.Details), utc{&e.Time},
+		&e.Seq, &e.PrevHash, &e.Hash)
+}
+
+func (r pgAudit) Chain(ctx context.Context, afterSeq int64, limit int) ([]AuditEvent, error) {
+	var lim any
+	if limit > 0 {
+		lim = limit
+	}
+	var out []AuditEvent
+	err := r.d.list(ctx, "audit_events.chain", func(s scanner) error {
+		var e AuditEvent
+		if err := scanAuditEvent(s, &e); err != nil {
+			return err
+		}
+		out = append(out, e)
+		return nil
+	}, "SELECT "+auditColumns+" FROM audit_events WHERE seq > $1 ORDER BY seq LIMIT $2", afterSeq, lim)
+	return out, err
+}
+
+func (r pgAudit) Head(ctx context.Context) (int64, string, error) {
+	var (
+		seq  int64
+		hash string
+	)
+	err := r.d.get(ctx, "audit_chain.head", func(s scanner) error { return s.Scan(&seq, &hash) },
+		"SELECT seq, hash FROM audit_chain WHERE id = 1")
+	return seq, hash, err
+}
+
+func (r pgAudit) List(ctx context.Context, f AuditFilter) ([]AuditEvent, error) {
+	var limit any
+	if f.Limit > 0 {
+		limit = f.Limit
+	}
+	var out []AuditEvent
+	err := r.d.reader().list(ctx, "audit_events.list", func(s scanner) error {
+		var e AuditEvent
+		if err := scanAuditEvent(s, &e); err != nil {
+			return err
+		}
+		out = append(out, e)
+		return nil
+	}, `SELECT `+auditColumns+` FROM audit_events
+	WHERE ($1::text = '' OR actor = $1) AND ($2::text = '' OR resource = $2) AND time >= $3
+	ORDER BY time DESC LIMIT $4`, f.Actor, f.Resource, f.Since, limit)
+	return out, err
+}
+
+type pgHistory struct{ d pgDB }
+
+func (r pgHistory) Record(ctx context.Context, c *Change) error {
+	if c.ID == "" {
+		c.ID = uuid.NewString()
+	}
+	if c.Time.IsZero() {
+		c.Time = time.Now().UTC()
+	}
+	_, err := r.d.exec(ctx, "entity_history.record",
+		`INSERT INTO entity_history (id, resource, resource_id, action, actor, request_id, before, after, diff, changed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		c.ID, c.Resource, c.ResourceID, c.Action, c.Actor, c.RequestID,
+		jsonValue(c.Before), jsonValue(c.After), jsonValue(c.Diff), c.Time)
+	return err
+}
+
+func (r pgHistory) List(ctx context.Context, resource, id string) ([]Change, error) {
+	var out []Change
+	err := r.d.reader().list(ctx, "entity_history.list", func(s scanner) error {
+		var c Change
+		if err := s.Scan(&c.ID, &c.Resource, &c.ResourceID, &c.Action, &c.Actor, &c.RequestID,
+			(*jsonValue)(&c.Before), (*jsonValue)(&c.After), (*jsonValue)(&c.Diff), utc{&c.Time}); err != nil {
+			return err
+		}
+		out = append(out, c)
+		return nil
+	}, `SELECT id, resource, resource_id, action, actor, request_id, before, after, diff, changed_at
+	FROM entity_history WHERE resource = $1 AND resource_id = $2 ORDER BY seq DESC`, resource, id)
+	return out, err
+}
+
+// The documents searched for tenants and services, names weighted above
+// the rest. They must stay identical to the expressions of the GIN indexes
+// in migration 0005 for the indexes to be used.
+const (
+	tenantSearchDoc  = `setweight(to_tsvector('simple', name), 'A') || setweight(to_tsvector('simple', display_name || ' ' || owner), 'B')`
+	serviceSearchDoc = `setweight(to_tsvector('simple', name), 'A') || setweight(to_tsvector('simple', description || ' ' || owner || ' ' || repository), 'B')`
+)
+
+var searchQuery = `SELECT type, id, name, title, description, rank FROM (
+	SELECT 'tenant' AS type, id, name, display_name AS title, owner AS description,
+		ts_rank(` + tenantSearchDoc + `, to_tsquery('simple', $1)) AS rank
+	FROM tenants WHERE deleted_at IS NULL AND ` + tenantSearchDoc + ` @@ to_tsquery('simple', $1)
+	UNION ALL
+	SELECT 'service', id, name, '', description,
+		ts_rank(` + serviceSearchDoc + `, to_tsquery('simple', $1))
+	FROM services WHERE deleted_at IS NULL AND ` + serviceSearchDoc + ` @@ to_tsquery('simple', $1)
+) hits ORDER BY rank DESC, name, id LIMIT $2`
+
+type pgSearch struct{ d pgDB }
+
+// Search matches each term as a prefix (term:*), like the memory store.
+// Terms hold only letters and digits, so they need no tsquery quoting.
+func (r pgSearch) Search(ctx context.Context, query string, limit int) ([]SearchHit, error) {
+	terms := SearchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	for i, t := range terms {
+		terms[i] = t + ":*"
+	}
+	var n any
+	if limit > 0 {
+		n = limit
+	}
+	var out []SearchHit
+	err := r.d.reader().list(ctx, "search.query", func(s scanner) error {
+		var h SearchHit
+		if err := s.Scan(&h.Type, &h.ID, &h.Name, &h.Title, &h.Description, &h.Rank); err != nil {
+			return err
+		}
+		out = append(out, h)
+		return nil
+	}, searchQuery, strings.Join(terms, " & "), n)
+	return out, err
+}
+
+type pgRoles struct{ d pgDB }
+
+const roleAssignmentColumns = "id, subject_kind, subject, role, created_by, created_at"
+
+func (r pgRoles) query(ctx context.Context, op, where string, args ...any) ([]RoleAssignment, error) {
+	out := []RoleAssignment{}
+	err := r.d.reader().list(ctx, op, func(s scanner) error {
+		var a RoleAssignment
+		if err := s.Scan(&a.ID, &a.SubjectKind, &a.Subject, &a.Role, &a.CreatedBy, utc{&a.CreatedAt}); err != nil {
+			return err
+		}
+		out = append(out, a)
+		return nil
+	}, "SELECT "+roleAssignmentColumns+" FROM role_assignments WHERE "+where+" ORDER BY created_at, id", args...)
+	return out, err
+}
+
+func (r pgRoles) List(ctx context.Context, subjectKind, subject string) ([]RoleAssignment, error) {
+	return r.query(ctx, "role_assignments.list", "$2::text = '' OR subject_kind = $1 AND subject = $2", subjectKind, subject)
+}
+
+func (r pgRoles) ForIdentity(ctx context.Context, user string, groups []string) ([]RoleAssignment, error) {
+	return r.query(ctx, "role_assignments.for_identity",
+		"subject_kind = 'user' AND subject = $1 OR subject_kind = 'group' AND subject = ANY($2)", user, groups)
+}
+
+func (r pgRoles) Create(ctx context.Context, a *RoleAssignment) error {
+	if a.ID == "" {
+		a.ID = uuid.NewString()
+	}
+	a.CreatedAt = time.Now().UTC()
+	_, err := r.d.exec(ctx, "role_assignments.create",
+		"INSERT INTO role_assignments ("+roleAssignmentColumns+") VALUES ($1, $2, $3, $4, $5, $6)",
+		a.ID, a.SubjectKind, a.Subject, a.Role, a.CreatedBy, a.CreatedAt)
+	return err
+}
+
+func (r pgRoles) Delete(ctx context.Context, id string) error {
+	n, err := r.d.exec(ctx, "role_assignments.delete", "DELETE FROM role_assignments WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type pgTokens struct{ d pgDB }
+
+const tokenColumns = "id, owner, name, prefix, hash, scopes, expires_at, last_used_at, revoked_at, created_at"
+
+func scanToken(s scanner, t *APIToken) error {
+	return s.Scan(&t.ID, &t.Owner, &t.Name, &t.Prefix, &t.Hash, textArray(&t.Scopes),
+		utc{&t.ExpiresAt}, nullUTC{&t.LastUsedAt}, nullUTC{&t.RevokedAt}, utc{&t.CreatedAt})
+}
+
+func (r pgTokens) Create(ctx context.Context, t *APIToken) error {
+	if t.ID == "" {
+		t.ID = uuid.NewString()
+	}
+	t.CreatedAt = time.Now().UTC()
+	_, err := r.d.exec(ctx, "api_tokens.create",
+		"INSERT INTO api_tokens ("+tokenColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, NULL, NULL, $8)",
+		t.ID, t.Owner, t.Name, t.Prefix, t.Hash, t.Scopes, t.ExpiresAt, t.CreatedAt)
+	return err
+}
+
+func (r pgTokens) get(ctx context.Context, op, where string, arg any) (*APIToken, error) {
+	var t APIToken
+	// From the primary: a token just revoked must stop working at once
+	err := r.d.get(ctx, op, func(s scanner) error { return scanToken(s, &t) },
+		"SELECT "+tokenColumns+" FROM api_tokens WHERE "+where+" = $1", arg)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r pgTokens) Get(ctx context.Context, id string) (*APIToken, error) {
+	return r.get(ctx, "api_tokens.get", "id", id)
+}
+
+func (r pgTokens) ByHash(ctx context.Context, hash string) (*APIToken, error) {
+	return r.get(ctx, "api_tokens.by_hash", "hash", hash)
+}
+
+func (r pgTokens) List(ctx context.Context, owner string) ([]APIToken, error) {
+	out := []APIToken{}
+	err := r.d.reader().list(ctx, "api_tokens.list", func(s scanner) error {
+		var t APIToken
+		if err := scanToken(s, &t); err != nil {
+			return err
+		}
+		out = append(out, t)
+		return nil
+	}, "SELECT "+tokenColumns+" FROM api_tokens WHERE owner = $1 ORDER BY created_at DESC, id DESC", owner)
+	return out, err
+}
+
+func (r pgTokens) Revoke(ctx context.Context, id string, at time.Time) error {
+	n, err := r.d.exec(ctx, "api_tokens.revoke",
+		"UPDATE api_tokens SET revoked_at = COALESCE(revoked_at, $2) WHERE id = $1", id, at.UTC())
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r pgTokens) Touch(ctx context.Context, id string, at time.Time) error {
+	n, err := r.d.exec(ctx, "api_tokens.touch", "UPDATE api_tokens SET last_used_at = $2 WHERE id = $1", id, at.UTC())
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type pgCredentials struct{ d pgDB }
+
+const credentialColumns = "id, tenant_id, name, description, value, key_id, updated_by, created_at, updated_at"
+
+func (r pgCredentials) query(ctx context.Context, op, where string, args ...any) ([]Credential, error) {
+	out := []Credential{}
+	err := r.d.list(ctx, op, func(s scanner) error {
+		var c Credential
+		if err := s.Scan(&c.ID, &c.TenantID, &c.Name, &c.Description, &c.Value, &c.KeyID, &c.UpdatedBy,
+			utc{&c.CreatedAt}, utc{&c.UpdatedAt}); err != nil {
+			return err
+		}
+		out = append(out, c)
+		return nil
+	}, "SELECT "+credentialColumns+" FROM credentials WHERE "+where, args...)
+	return out, err
+}
+
+func (r pgCredentials) List(ctx context.Context, tenantID string) ([]Credential, error) {
+	return r.query(ctx, "credentials.list", "tenant_id = $1 ORDER BY name", tenantID)
+}
+
+func (r pgCredentials) Get(ctx context.Context, tenantID, name string) (*Credential, error) {
+	out, err := r.query(ctx, "credentials.get", "tenant_id = $1 AND name = $2", tenantID, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, ErrNotFound
+	}
+	return &out[0], nil
+}
+
+func (r pgCredentials) Put(ctx context.Context, c *Credential) (bool, error) {
+	now := time.Now().UTC()
+	var created bool
+	err := r.d.get(ctx, "credentials.put", func(s scanner) error {
+		return s.Scan(&c.ID, utc{&c.CreatedAt}, &created)
+	}, `INSERT INTO credentials (`+credentialColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+		ON CONFLICT (tenant_id, name) DO UPDATE SET
+			description = EXCLUDED.description, value = EXCLUDED.value, key_id = EXCLUDED.key_id,
+			updated_by = EXCLUDED.updated_by, updated_at = EXCLUDED.updated_at
+		RETURNING id, created_at, xmax = 0`,
+		c.ID, c.TenantID, c.Name, c.Description, c.Value, c.KeyID, c.UpdatedBy, now)
+	if err != nil {
+		return false, err
+	}
+	c.UpdatedAt = now
+	return created, nil
+}
+
+func (r pgCredentials) Delete(ctx context.Context, tenantID, name string) error {
+	n, err := r.d.exec(ctx, "credentials.delete", "DELETE FROM credentials WHERE tenant_id = $1 AND name = $2", tenantID, name)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r pgCredentials) NotSealedWith(ctx context.Context, keyID, afterID string, limit int) ([]Credential, error) {
+	var lim any
+	if limit > 0 {
+		lim = limit
+	}
+	return r.query(ctx, "credentials.not_sealed_with", "key_id <> $1 AND id > $2 ORDER BY id LIMIT $3", keyID, afterID, lim)
+}
+
+func (r pgCredentials) Reseal(ctx context.Context, id, old, value, keyID string) error {
+	n, err := r.d.exec(ctx, "credentials.reseal",
+		"UPDATE credentials SET value = $3, key_id = $4 WHERE id = $1 AND value = $2", id, old, value, keyID)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	// Tell a changed credential from a deleted one
+	var exists bool
+	if err := r.d.get(ctx, "credentials.exists", func(s scanner) error { return s.Scan(&exists) },
+		"SELECT EXISTS (SELECT 1 FROM credentials WHERE id = $1)", id); err != nil {
+		return err
+	}
+	if exists {
+		return ErrVersionConflict
+	}
+	return ErrNotFound
+}
+
+type pgWebhookKeys struct{ d pgDB }
+
+const webhookKeyColumns = "id, algorithm, secret, public_key, created_by, created_at, retires_at"
+
+func (r pgWebhookKeys) List(ctx context.Context) ([]WebhookKey, error) {
+	out := []WebhookKey{}
+	err := r.d.list(ctx, "webhook_keys.list", func(s scanner) error {
+		var k WebhookKey
+		if err := s.Scan(&k.ID, &k.Algorithm, &k.Secret, &k.PublicKey, &k.CreatedBy,
+			utc{&k.CreatedAt}, nullUTC{&k.RetiresAt}); err != nil {
+			return err
+		}
+		out = append(out, k)
+		return nil
+	}, "SELECT "+webhookKeyColumns+" FROM webhook_keys ORDER BY created_at DESC, id DESC")
+	return out, err
+}
+
+func (r pgWebhookKeys) Create(ctx context.Context, k *WebhookKey) error {
+	k.CreatedAt = time.Now().UTC()
+	_, err := r.d.exec(ctx, "webhook_keys.create",
+		"INSERT INTO webhook_keys ("+webhookKeyColumns+") VALUES ($1, $2, $3, $4, $5, $6, NULL)",
+		k.ID, k.Algorithm, k.Secret, k.PublicKey, k.CreatedBy, k.CreatedAt)
+	return err
+}
+
+func (r pgWebhookKeys) Retire(ctx context.Context, keep string, at time.Time) (int, error) {
+	n, err := r.d.exec(ctx, "webhook_keys.retire",
+		"UPDATE webhook_keys SET retires_at = $2 WHERE id <> $1 AND retires_at IS NULL", keep, at.UTC())
+	return int(n), err
+}
+
+func (r pgWebhookKeys) Prune(ctx context.Context, before time.Time) (int, error) {
+	n, err := r.d.exec(ctx, "webhook_keys.prune", "DELETE FROM webhook_keys WHERE retires_at < $1", before.UTC())
+	return int(n), err
+}
+
+type pgQueue struct{ d pgDB }
+
+const queueColumns = `id, type, payload, status, attempts, max_attempts, last_error, run_at,
+	locked_by, locked_until, created_at, updated_at, finished_at`
+
+func scanQueueJob(s scanner, j *QueueJob) error {
+	return s.Scan(&j.ID, &j.Type, (*jsonValue)(&j.Payload), &j.Status, &j.Attempts, &j.MaxAttempts, &j.LastError,
+		utc{&j.RunAt}, &j.LockedBy, nullUTC{&j.LockedUntil}, utc{&j.CreatedAt}, utc{&j.UpdatedAt}, nullUTC{&j.FinishedAt})
+}
+
+func (r pgQueue) Enqueue(ctx context.Context, j *QueueJob) error {
+	if j.ID == "" {
+		j.ID = uuid.NewString()
+	}
+	now := time.Now().UTC()
+	if j.RunAt.IsZero() {
+		j.RunAt = now
+	}
+	j.Status, j.Attempts, j.LockedBy, j.LockedUntil, j.FinishedAt = JobQueued, 0, "", nil, nil
+	j.CreatedAt, j.UpdatedAt = now, now
+	_, err := r.d.exec(ctx, "queue_jobs.enqueue",
+		`INSERT INTO queue_jobs (id, type, payload, status, attempts, max_attempts, last_error, run_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, 0, $5, $6, $7, $8, $8)`,
+		j.ID, j.Type, jsonValue(j.Payload), j.Status, j.MaxAttempts, j.LastError, j.RunAt, now)
+	return err
+}
+
+func (r pgQueue) Claim(ctx context.Context, worker string, types []string, limit int, now, leaseUntil time.Time) ([]QueueJob, error) {
+	var out []QueueJob
+	err := r.d.list(ctx, "queue_jobs.claim", func(s scanner) error {
+		var j QueueJob
+		if err := scanQueueJob(s, &j); err != nil {
+			return err
+		}
+		out = append(out, j)
+		return nil
+	}, `UPDATE queue_jobs SET status = 'running', attempts = attempts + 1, locked_by = $1, locked_until = $2, updated_at = $3
+	WHERE id IN (
+		SELECT id FROM queue_jobs
+		WHERE type = ANY($4) AND (status = 'queued' AND run_at <= $3 OR status = 'running' AND locked_until < $3)
+		ORDER BY run_at LIMIT $5 FOR UPDATE SKIP LOCKED
+	) RETURNING `+queueColumns, worker, leaseUntil, now, types, limit)
+	slices.SortFunc(out, func(a, b QueueJob) int { return a.RunAt.Compare(b.RunAt) })
+	return out, err
+}
+
+func (r pgQueue) Finish(ctx context.Context, worker string, j *QueueJob) error {
+	err := r.d.get(ctx, "queue_jobs.finish", func(s scanner) error { return scanQueueJob(s, j) },
+		`UPDATE queue_jobs SET status = $3, last_error = $4, run_at = $5, finished_at = $6,
+		locked_by = '', locked_until = NULL, updated_at = now()
+		WHERE id = $1 AND status = 'running' AND locked_by = $2 RETURNING `+queueColumns,
+		j.ID, worker, j.Status, j.LastError, j.RunAt, j.FinishedAt)
+	if errors.Is(err, ErrNotFound) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (r pgQueue) Get(ctx context.Context, id string) (*QueueJob, error) {
+	var j QueueJob
+	err := r.d.reader().get(ctx, "queue_jobs.get", func(s scanner) error { return scanQueueJob(s, &j) },
+		"SELECT "+queueColumns+" FROM queue_jobs WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+func (r pgQueue) List(ctx context.Context, f QueueFilter) ([]QueueJob, error) {
+	var limit any
+	if f.Limit > 0 {
+		limit = f.Limit
+	}
+	var out []QueueJob
+	err := r.d.reader().list(ctx, "queue_jobs.list", func(s scanner) error {
+		var j QueueJob
+		if err := scanQueueJob(s, &j); err != nil {
+			return err
+		}
+		out = append(out, j)
+		return nil
+	}, "SELECT "+queueColumns+` FROM queue_jobs
+	WHERE ($1::text = '' OR type = $1) AND ($2::text = '' OR status = $2)
+	ORDER BY created_at DESC LIMIT $3`, f.Type, f.Status, limit)
+	return out, err
+}
+
+func (r pgQueue) Retry(ctx context.Context, id string, now time.Time) (*QueueJob, error) {
+	var j QueueJob
+	err := r.d.get(ctx, "queue_jobs.retry", func(s scanner) error { return scanQueueJob(s, &j) },
+		`UPDATE queue_jobs SET status = 'queued', attempts = 0, run_at = $2, finished_at = NULL, updated_at = $2
+		WHERE id = $1 AND status = 'dead' RETURNING `+queueColumns, id, now)
+	if errors.Is(err, ErrNotFound) {
+		// Tell a missing job from one that is not dead
+		existing, gerr := r.Get(ctx, id)
+		if gerr != nil {
+			return nil, gerr
+		}
+		return nil, fmt.Errorf("job %s is %s: %w", id, existing.Status, ErrConflict)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+func (r pgQueue) Prune(ctx context.Context, before time.Time) (int, error) {
+	n, err := r.d.exec(ctx, "queue_jobs.prune",
+		"DELETE FROM queue_jobs WHERE status = 'succeeded' AND finished_at < $1", before)
+	return int(n), err
+}
+
+type pgOutbox struct{ d pgDB }
+
+func (r pgOutbox) Add(ctx context.Context, m *OutboxMessage) error {
+	if m.ID == "" {
+		m.ID = uuid.NewString()
+	}
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now().UTC()
+	}
+	_, err := r.d.exec(ctx, "outbox.add",
+		`INSERT INTO outbox (id, type, source, data, created_at) VALUES ($1, $2, $3, $4, $5)`,
+		m.ID, m.Type, m.Source, jsonValue(m.Data), m.CreatedAt)
+	return err
+}
+
+func (r pgOutbox) Pending(ctx context.Context, limit int) ([]OutboxMessage, error) {
+	var n any
+	if limit > 0 {
+		n = limit
+	}
+	var out []OutboxMessage
+	err := r.d.list(ctx, "outbox.pending", func(s scanner) error {
+		var m OutboxMessage
+		if err := s.Scan(&m.ID, &m.Type, &m.Source, (*jsonValue)(&m.Data), utc{&m.CreatedAt}); err != nil {
+			return err
+		}
+		out = append(out, m)
+		return nil
+	}, `SELECT id, type, source, data, created_at FROM outbox WHERE sent_at IS NULL
+	ORDER BY seq LIMIT $1 FOR UPDATE SKIP LOCKED`, n)
+	return out, err
+}
+
+func (r pgOutbox) MarkSent(ctx context.Context, ids []string, at time.Time) error {
+	_, err := r.d.exec(ctx, "outbox.mark_sent",
+		`UPDATE outbox SET sent_at = $2 WHERE id = ANY($1)`, ids, at)
+	return err
+}
+
+func (r pgOutbox) Prune(ctx context.Context, before time.Time) (int, error) {
+	n, err := r.d.exec(ctx, "outbox.prune", "DELETE FROM outbox WHERE sent_at < $1", before)
+	return int(n), err
+}
+
+// versionConflict tells apart the reasons a versioned update of id in
+// table matched no row: ErrNotFound if the row is gone or soft-deleted,
+// ErrVersionConflict if it was changed since it was read.
+func versionConflict(ctx context.Context, d pgDB, table, id string) error {
+	var one int
+	err := d.get(ctx, table+".exists", func(s scanner) error { return s.Scan(&one) },
+		"SELECT 1 FROM "+table+" WHERE id = $1 AND deleted_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+	return ErrVersionConflict
+}
+
+// softDelete marks the live row id in table deleted.
+func softDelete(ctx context.Context, d pgDB, table, id string) error {
+	n, err := d.exec(ctx, table+".delete",
+		"UPDATE "+table+" SET deleted_at = $2 WHERE id = $1 AND deleted_at IS NULL", id, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
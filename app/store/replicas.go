@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+var (
+	replicaLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "store_replica_lag_seconds",
+		Help: "Replication lag of each read replica when last checked.",
+	}, []string{"replica"})
+	replicaHealthy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "store_replica_healthy",
+		Help: "Whether each read replica serves reads (1) or is skipped for being unreachable or behind (0).",
+	}, []string{"replica"})
+	replicaReads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "store_replica_reads_total",
+		Help: "Reads outside transactions by target: replica, or primary when no replica is healthy.",
+	}, []string{"target"})
+)
+
+// lagQuery measures how far a standby's replay is behind. A standby that
+// has replayed everything it received is current even if the primary has
+// been idle since its last transaction; on a primary it returns 0.
+const lagQuery = `SELECT COALESCE(CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()) END, 0)`
+
+// replica is a read-only standby and its health when last checked.
+type replica struct {
+	name    string
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// replicaSet spreads reads over the healthy replicas.
+type replicaSet struct {
+	replicas []*replica
+	next     atomic.Uint64
+	maxLag   time.Duration
+	timeout  time.Duration
+}
+
+// replicaName labels the replica at dsn by its host, or by its position
+// for key=value connection strings.
+func replicaName(i int, dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return fmt.Sprintf("replica-%d", i)
+}
+
+// pick returns the next healthy replica in turn, or nil if none is.
+func (s *replicaSet) pick() *sql.DB {
+	n := uint64(len(s.replicas))
+	start := s.next.Add(1)
+	for i := range n {
+		if r := s.replicas[(start+i)%n]; r.healthy.Load() {
+			return r.db
+		}
+	}
+	return nil
+}
+
+// check measures r's lag and marks it healthy if it answered within the
+// ping timeout and is no more than maxLag behind. It reports whether r's
+// health changed.
+func (s *replicaSet) check(ctx context.Context, r *replica) (changed bool, lag time.Duration, err error) {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	var secs float64
+	start := time.Now()
+	err = r.db.QueryRowContext(ctx, lagQuery).Scan(&secs)
+	observe("replica.lag", start, err)
+	lag = time.Duration(secs * float64(time.Second))
+	healthy := err == nil && (s.maxLag <= 0 || lag <= s.maxLag)
+	if err == nil {
+		replicaLag.WithLabelValues(r.name).Set(secs)
+	}
+	if healthy {
+		replicaHealthy.WithLabelValues(r.name).Set(1)
+	} else {
+		replicaHealthy.WithLabelValues(r.name).Set(0)
+	}
+	return r.healthy.Swap(healthy) != healthy, lag, err
+}
+
+// reader returns d bound to a healthy replica, for reads that may lag the
+// primary by up to the maximum replica lag. It returns d itself within a
+// transaction, without replicas, or when no replica is healthy.
+func (d pgDB) reader() pgDB {
+	if d.replicas == nil {
+		return d
+	}
+	if db := d.replicas.pick(); db != nil {
+		replicaReads.WithLabelValues("replica").Inc()
+		return pgDB{db: db}
+	}
+	replicaReads.WithLabelValues("primary").Inc()
+	return d
+}
+
+// MonitorReplicas checks the read replicas every interval until ctx is
+// done. A replica that does not answer, or is more than the maximum lag
+// behind, gets no reads until a later check finds it healthy again.
+func (p *Postgres) MonitorReplicas(ctx context.Context, interval time.Duration, logger *zap.Logger) {
+	if p.replicas == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, r := range p.replicas.replicas {
+			changed, lag, err := p.replicas.check(ctx, r)
+			if !changed {
+				continue
+			}
+			if r.healthy.Load() {
+				logger.Info("database replica healthy, serving reads", zap.String("replica", r.name), zap.Duration("lag", lag))
+			} else {
+				logger.Warn("database replica unhealthy, skipping it for reads",
+					zap.String("replica", r.name), zap.Duration("lag", lag), zap.Error(err))
+			}
+		}
+	}
+}
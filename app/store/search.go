@@ -0,0 +1,60 @@
+package store
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Weights of a term matching a word of an entity's name exactly, a prefix
+// of a word of its name, and a word or prefix of its other text.
+const (
+	nameWordWeight   = 1.0
+	namePrefixWeight = 0.8
+	textWeight       = 0.4
+)
+
+// SearchTerms splits query into lowercase words of letters and digits, the
+// way names are split for matching.
+func SearchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// MatchRank ranks an entity named name, described by text, against terms:
+// 0 unless every term matches a word or word prefix, otherwise the mean
+// weight of the terms' best matches, in (0, 1]. The memory store ranks
+// with it; sources outside the store can too, to rank alike.
+func MatchRank(terms []string, name string, text ...string) float64 {
+	if len(terms) == 0 {
+		return 0
+	}
+	nameWords := SearchTerms(name)
+	textWords := SearchTerms(strings.Join(text, " "))
+	var total float64
+	for _, term := range terms {
+		best := 0.0
+		for _, w := range nameWords {
+			if w == term {
+				best = nameWordWeight
+				break
+			}
+			if strings.HasPrefix(w, term) {
+				best = namePrefixWeight
+			}
+		}
+		if best == 0 {
+			for _, w := range textWords {
+				if strings.HasPrefix(w, term) {
+					best = textWeight
+					break
+				}
+			}
+		}
+		if best == 0 {
+			return 0
+		}
+		total += best
+	}
+	return total / float64(len(terms))
+}
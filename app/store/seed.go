@@ -0,0 +1,97 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Seed is fixture data for a fresh store, so a local instance on the
+// memory backend starts with tenants, environments, services and
+// deployments to browse.
+// Entities keep the IDs given in the file, so services can name their
+// tenant and deployments their service.
+type Seed struct {
+	Tenants      []Tenant      `json:"tenants"`
+	Environments []Environment `json:"environments"`
+	Services     []Service     `json:"services"`
+	Deployments  []Deployment  `json:"deployments"`
+}
+
+// LoadSeed reads a Seed from a JSON file.
+func LoadSeed(path string) (*Seed, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read seed: %w", err)
+	}
+	return ParseSeed(data)
+}
+
+// ParseSeed reads a Seed from JSON, e.g. fixtures embedded in the binary.
+func ParseSeed(data []byte) (*Seed, error) {
+	var seed Seed
+	if err := json.Unmarshal(data, &seed); err != nil {
+		return nil, fmt.Errorf("parse seed: %w", err)
+	}
+	return &seed, nil
+}
+
+// Apply writes the seed to st in one transaction, parents first. Nothing
+// is written if any entity is invalid or already exists.
+func (seed *Seed) Apply(ctx context.Context, st *Store) error {
+	return st.WithTx(ctx, func(tx Repos) error { return seed.Create(ctx, tx) })
+}
+
+// Create writes the seed through repos, parents first, stopping at the
+// first entity that is invalid or already exists. Call it within a
+// transaction to write all or nothing.
+func (seed *Seed) Create(ctx context.Context, repos Repos) error {
+	for i := range seed.Tenants {
+		if err := repos.Tenants.Create(ctx, &seed.Tenants[i]); err != nil {
+			return fmt.Errorf("tenant %q: %w", seed.Tenants[i].Name, err)
+		}
+	}
+	for i := range seed.Environments {
+		if err := repos.Environments.Create(ctx, &seed.Environments[i]); err != nil {
+			return fmt.Errorf("environment %q: %w", seed.Environments[i].Name, err)
+		}
+	}
+	for i := range seed.Services {
+		if err := repos.Services.Create(ctx, &seed.Services[i]); err != nil {
+			return fmt.Errorf("service %q: %w", seed.Services[i].Name, err)
+		}
+	}
+	for i := range seed.Deployments {
+		if err := repos.Deployments.Create(ctx, &seed.Deployments[i]); err != nil {
+			return fmt.Errorf("deployment %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Dump reads the live tenants, environments and services of st, with the
+// deployments of those services, into a Seed that Apply can write to
+// another store. It reads each repository in turn, not a point-in-time
+// snapshot, so writes made meanwhile may be partly included.
+func Dump(ctx context.Context, st *Store) (*Seed, error) {
+	var seed Seed
+	var err error
+	if seed.Tenants, err = st.Tenants.List(ctx); err != nil {
+		return nil, fmt.Errorf("list tenants: %w", err)
+	}
+	if seed.Environments, err = st.Environments.List(ctx); err != nil {
+		return nil, fmt.Errorf("list environments: %w", err)
+	}
+	if seed.Services, err = st.Services.List(ctx, ""); err != nil {
+		return nil, fmt.Errorf("list services: %w", err)
+	}
+	for _, s := range seed.Services {
+		deployments, err := st.Deployments.List(ctx, s.ID)
+		if err != nil {
+			return nil, fmt.Errorf("list deployments of %q: %w", s.Name, err)
+		}
+		seed.Deployments = append(seed.Deployments, deployments...)
+	}
+	return &seed, nil
+}
@@ -0,0 +1,522 @@
+// Package store defines the platform's persisted entities (tenants,
+// environments, services, deployments, quota usage history, provisioning
+// records, audit events, change history, role assignments, access tokens,
+// sealed credentials, queued jobs, outbox messages)
+// and the repositories used to read, write and search them, kept in
+// memory or in PostgreSQL.
+//
+// Tenants, environments and services are soft-deleted: Delete marks them
+// deleted, after which repositories no longer return them and their names
+// can be reused, but their rows and change history are kept.
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+)
+
+var (
+	// ErrNotFound is returned when an entity does not exist.
+	ErrNotFound = errs.New(errs.NotFound, "not found")
+	// ErrConflict is returned when an entity with the same name already exists.
+	ErrConflict = errs.New(errs.Conflict, "already exists")
+	// ErrVersionConflict is returned when an update carries a version other
+	// than the stored one, because someone else changed the entity since it
+	// was read.
+	ErrVersionConflict = errs.New(errs.Conflict, "version conflict")
+)
+
+// Tenant is a team or organisation that owns services on the platform.
+type Tenant struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	DisplayName string            `json:"display_name"`
+	Owner       string            `json:"owner"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	// Version starts at 1 and is incremented by every update.
+	Version   int64      `json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Environment tiers, in promotion order.
+const (
+	TierDevelopment = "development"
+	TierStaging     = "staging"
+	TierProduction  = "production"
+)
+
+// Environment is a stage services are deployed to, such as staging or
+// production. Deployments refer to it by name.
+type Environment struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Tier        string `json:"tier"`
+	// Cluster is the name of the cluster the environment runs on, empty
+	// for the local one.
+	Cluster string            `json:"cluster,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	// Version starts at 1 and is incremented by every update.
+	Version   int64      `json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Service is a deployable workload owned by a tenant.
+type Service struct {
+	ID          string     `json:"id"`
+	TenantID    string     `json:"tenant_id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Owner       string     `json:"owner"`
+	Repository  string     `json:"repository"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Deployment records a version of a service rolled out to an environment.
+type Deployment struct {
+	ID          string    `json:"id"`
+	ServiceID   string    `json:"service_id"`
+	Environment string    `json:"environment"`
+	Version     string    `json:"version"`
+	Image       string    `json:"image"`
+	Replicas    int       `json:"replicas"`
+	Status      string    `json:"status"`
+	DeployedAt  time.Time `json:"deployed_at"`
+}
+
+// QuotaSample is the usage of one resource in one ResourceQuota at a point
+// in time. Used and Hard are in the resource's base unit (cores, bytes,
+// object count).
+type QuotaSample struct {
+	Namespace string    `json:"namespace"`
+	Quota     string    `json:"quota"`
+	Resource  string    `json:"resource"`
+	Used      float64   `json:"used"`
+	Hard      float64   `json:"hard"`
+	SampledAt time.Time `json:"sampled_at"`
+}
+
+// ProvisioningRecord tracks a resource the platform provisioned for a
+// tenant, such as a namespace or a Terraform workspace run.
+type ProvisioningRecord struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id"`
+	// Kind is what was provisioned ("namespace", "infra_run", ...) and
+	// Target identifies it within that kind.
+	Kind      string            `json:"kind"`
+	Target    string            `json:"target"`
+	Status    string            `json:"status"`
+	Requester string            `json:"requester"`
+	Details   map[string]string `json:"details,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// AuditEvent is one action taken through the platform.
+type AuditEvent struct {
+	ID        string            `json:"id"`
+	Actor     string            `json:"actor"`
+	Action    string            `json:"action"`
+	Resource  string            `json:"resource"`
+	Outcome   string            `json:"outcome"`
+	RequestID string            `json:"request_id,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	Time      time.Time         `json:"time"`
+	// Seq numbers events in the order they were recorded, from 1. Hash
+	// covers the event and PrevHash, the Hash of event Seq-1, chaining
+	// each event to all before it (see AuditHash). Events recorded before
+	// chaining was introduced have neither.
+	Seq      int64  `json:"seq,omitempty"`
+	PrevHash string `json:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// AuditFilter selects audit events; zero fields match everything.
+type AuditFilter struct {
+	Actor    string
+	Resource string
+	Since    time.Time
+	// Limit caps the events returned (0 means no limit).
+	Limit int
+}
+
+// Change actions.
+const (
+	ChangeCreate = "create"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+// Change is one write to an entity, with the entity as JSON before and
+// after it. See NewChange.
+type Change struct {
+	ID string `json:"id"`
+	// Resource is the kind of entity, e.g. "tenants", and ResourceID its ID.
+	Resource   string          `json:"resource"`
+	ResourceID string          `json:"resource_id"`
+	Action     string          `json:"action"`
+	Actor      string          `json:"actor"`
+	RequestID  string          `json:"request_id,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	// Diff is the JSON merge patch (RFC 7386) turning Before into After.
+	Diff json.RawMessage `json:"diff,omitempty"`
+	Time time.Time       `json:"time"`
+}
+
+// Searchable entity types.
+const (
+	SearchTenant  = "tenant"
+	SearchService = "service"
+)
+
+// SearchHit is an entity matching a search query. Rank orders hits of one
+// search, higher first.
+type SearchHit struct {
+	Type        string  `json:"type"`
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Title       string  `json:"title,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Rank        float64 `json:"rank"`
+}
+
+// Role assignment subject kinds.
+const (
+	SubjectUser  = "user"
+	SubjectGroup = "group"
+)
+
+// RoleAssignment grants a role to a user or to the members of a group.
+type RoleAssignment struct {
+	ID          string    `json:"id"`
+	SubjectKind string    `json:"subject_kind"`
+	Subject     string    `json:"subject"`
+	Role        string    `json:"role"`
+	CreatedBy   string    `json:"created_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// APIToken is a personal access token. Only a hash of its secret is
+// stored; the secret is shown once, when the token is created.
+type APIToken struct {
+	ID    string `json:"id"`
+	Owner string `json:"owner"`
+	Name  string `json:"name"`
+	// Prefix is the start of the secret, to tell tokens apart.
+	Prefix string `json:"prefix"`
+	Hash   string `json:"-"`
+	// Scopes are the permissions the token is limited to.
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Credential is a secret a tenant keeps on the platform, such as a
+// registry password. Value holds it sealed by the encryption package, with
+// the master key KeyID; the store never sees the plaintext.
+type Credential struct {
+	ID          string    `json:"id"`
+	TenantID    string    `json:"tenant_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Value       string    `json:"-"`
+	KeyID       string    `json:"key_id"`
+	UpdatedBy   string    `json:"updated_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Webhook signing algorithms.
+const (
+	WebhookHMAC    = "hmac-sha256"
+	WebhookEd25519 = "ed25519"
+)
+
+// WebhookKey signs outgoing webhook deliveries. Secret holds the HMAC
+// secret or the Ed25519 private key sealed by the encryption package;
+// PublicKey is the Ed25519 public key, base64 encoded. A rotated key keeps
+// signing until RetiresAt, so receivers can move to its successor.
+type WebhookKey struct {
+	ID        string     `json:"id"`
+	Algorithm string     `json:"algorithm"`
+	Secret    string     `json:"-"`
+	PublicKey string     `json:"public_key,omitempty"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RetiresAt *time.Time `json:"retires_at,omitempty"`
+}
+
+// Queue job statuses. A failed attempt with attempts left goes back to
+// queued, to run again at RunAt.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	// JobDead jobs failed their last attempt, or failed permanently, and
+	// wait for a retry by hand.
+	JobDead = "dead"
+)
+
+// QueueJob is a unit of background work in the durable job queue.
+type QueueJob struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Status  string          `json:"status"`
+	// Attempts counts the runs started, MaxAttempts the runs allowed
+	// before the job is dead.
+	Attempts    int    `json:"attempts"`
+	MaxAttempts int    `json:"max_attempts"`
+	LastError   string `json:"last_error,omitempty"`
+	// RunAt is when a queued job is due.
+	RunAt time.Time `json:"run_at"`
+	// LockedBy is the worker running the job, until LockedUntil.
+	LockedBy    string     `json:"locked_by,omitempty"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// QueueFilter selects queue jobs; zero fields match everything.
+type QueueFilter struct {
+	Type   string
+	Status string
+	Limit  int
+}
+
+// OutboxMessage is a domain event written in the same transaction as the
+// change it describes, waiting for the relay to publish it.
+type OutboxMessage struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Source    string          `json:"source"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// TenantRepository persists tenants.
+type TenantRepository interface {
+	List(ctx context.Context) ([]Tenant, error)
+	Get(ctx context.Context, id string) (*Tenant, error)
+	Create(ctx context.Context, t *Tenant) error
+	// Update fails with ErrVersionConflict if t.Version is set and is not
+	// the stored version; zero overwrites unconditionally.
+	Update(ctx context.Context, t *Tenant) error
+	Delete(ctx context.Context, id string) error
+}
+
+// EnvironmentRepository persists environments.
+type EnvironmentRepository interface {
+	List(ctx context.Context) ([]Environment, error)
+	Get(ctx context.Context, id string) (*Environment, error)
+	Create(ctx context.Context, e *Environment) error
+	// Update fails with ErrVersionConflict if e.Version is set and is not
+	// the stored version; zero overwrites unconditionally.
+	Update(ctx context.Context, e *Environment) error
+	Delete(ctx context.Context, id string) error
+}
+
+// ServiceRepository persists services.
+type ServiceRepository interface {
+	// List returns all services, or only those of tenantID when it is non-empty.
+	List(ctx context.Context, tenantID string) ([]Service, error)
+	Get(ctx context.Context, id string) (*Service, error)
+	Create(ctx context.Context, s *Service) error
+	Update(ctx context.Context, s *Service) error
+	Delete(ctx context.Context, id string) error
+}
+
+// DeploymentRepository persists deployment records.
+type DeploymentRepository interface {
+	// List returns deployments of serviceID, newest first.
+	List(ctx context.Context, serviceID string) ([]Deployment, error)
+	Get(ctx context.Context, id string) (*Deployment, error)
+	Create(ctx context.Context, d *Deployment) error
+}
+
+// QuotaUsageRepository persists ResourceQuota usage history.
+type QuotaUsageRepository interface {
+	Record(ctx context.Context, samples []QuotaSample) error
+	// History returns samples of namespace taken at or after since, oldest
+	// first.
+	History(ctx context.Context, namespace string, since time.Time) ([]QuotaSample, error)
+	// Prune deletes samples taken before before and reports how many.
+	Prune(ctx context.Context, before time.Time) (int, error)
+}
+
+// ProvisioningRepository persists provisioning records.
+type ProvisioningRepository interface {
+	// List returns all records, or only those of tenantID when it is
+	// non-empty, newest first.
+	List(ctx context.Context, tenantID string) ([]ProvisioningRecord, error)
+	Get(ctx context.Context, id string) (*ProvisioningRecord, error)
+	Create(ctx context.Context, r *ProvisioningRecord) error
+	Update(ctx context.Context, r *ProvisioningRecord) error
+}
+
+// AuditRepository persists audit events. Events are never changed once
+// recorded.
+type AuditRepository interface {
+	// Record appends e to the chain, setting its Seq, PrevHash and Hash.
+	Record(ctx context.Context, e *AuditEvent) error
+	// List returns the events matching f, newest first.
+	List(ctx context.Context, f AuditFilter) ([]AuditEvent, error)
+	// Chain returns up to limit chained events with a Seq above afterSeq,
+	// in Seq order.
+	Chain(ctx context.Context, afterSeq int64, limit int) ([]AuditEvent, error)
+	// Head returns the Seq and Hash of the last event recorded, kept
+	// apart from the events so that dropping the latest ones shows; zero
+	// and "" before the first.
+	Head(ctx context.Context) (seq int64, hash string, err error)
+}
+
+// HistoryRepository persists entity change history. Changes are never
+// altered once recorded, and outlive soft-deleted entities.
+type HistoryRepository interface {
+	Record(ctx context.Context, c *Change) error
+	// List returns the changes of one entity, newest first.
+	List(ctx context.Context, resource, id string) ([]Change, error)
+}
+
+// SearchRepository finds live tenants and services by text.
+type SearchRepository interface {
+	// Search returns up to limit entities matching every term of query,
+	// each as a word or word prefix, best match first. A query without
+	// terms matches nothing.
+	Search(ctx context.Context, query string, limit int) ([]SearchHit, error)
+}
+
+// RoleAssignmentRepository persists role assignments.
+type RoleAssignmentRepository interface {
+	// List returns all assignments, or only those of subjectKind and
+	// subject when subject is non-empty, oldest first.
+	List(ctx context.Context, subjectKind, subject string) ([]RoleAssignment, error)
+	// ForIdentity returns the assignments to user and to any of groups.
+	ForIdentity(ctx context.Context, user string, groups []string) ([]RoleAssignment, error)
+	// Create fails with ErrConflict if the subject already has the role.
+	Create(ctx context.Context, a *RoleAssignment) error
+	Delete(ctx context.Context, id string) error
+}
+
+// TokenRepository persists personal access tokens.
+type TokenRepository interface {
+	Create(ctx context.Context, t *APIToken) error
+	Get(ctx context.Context, id string) (*APIToken, error)
+	// ByHash returns the token whose secret hashes to hash, revoked and
+	// expired ones included.
+	ByHash(ctx context.Context, hash string) (*APIToken, error)
+	// List returns owner's tokens, newest first.
+	List(ctx context.Context, owner string) ([]APIToken, error)
+	// Revoke marks the token revoked at at; revoking it again keeps the
+	// first time.
+	Revoke(ctx context.Context, id string, at time.Time) error
+	// Touch records a use of the token at at.
+	Touch(ctx context.Context, id string, at time.Time) error
+}
+
+// CredentialRepository persists sealed tenant credentials.
+type CredentialRepository interface {
+	// List returns the tenant's credentials by name.
+	List(ctx context.Context, tenantID string) ([]Credential, error)
+	Get(ctx context.Context, tenantID, name string) (*Credential, error)
+	// Put creates the tenant's credential named c.Name, or replaces its
+	// description and value, and reports whether it was created. c.ID
+	// must be set; an existing credential keeps its own.
+	Put(ctx context.Context, c *Credential) (created bool, err error)
+	Delete(ctx context.Context, tenantID, name string) error
+	// NotSealedWith returns up to limit credentials whose KeyID is not
+	// keyID, ordered by ID and starting after afterID.
+	NotSealedWith(ctx context.Context, keyID, afterID string, limit int) ([]Credential, error)
+	// Reseal replaces the value of credential id, sealed again under
+	// keyID. It fails with ErrVersionConflict if the value is no longer
+	// old, because the credential was changed meanwhile.
+	Reseal(ctx context.Context, id, old, value, keyID string) error
+}
+
+// WebhookKeyRepository persists the keys signing outgoing webhooks.
+type WebhookKeyRepository interface {
+	// List returns the keys, newest first.
+	List(ctx context.Context) ([]WebhookKey, error)
+	Create(ctx context.Context, k *WebhookKey) error
+	// Retire sets RetiresAt to at on the keys other than keep that have
+	// none, and reports how many.
+	Retire(ctx context.Context, keep string, at time.Time) (int, error)
+	// Prune deletes keys retired before before and reports how many.
+	Prune(ctx context.Context, before time.Time) (int, error)
+}
+
+// QueueRepository persists the job queue.
+type QueueRepository interface {
+	Enqueue(ctx context.Context, j *QueueJob) error
+	// Claim hands worker up to limit jobs of types, oldest due first,
+	// marking them running until leaseUntil and counting an attempt: queued
+	// jobs due by now, and running jobs whose lease expired because their
+	// worker stopped. Concurrent claims never return the same job.
+	Claim(ctx context.Context, worker string, types []string, limit int, now, leaseUntil time.Time) ([]QueueJob, error)
+	// Finish stores the outcome of a job claimed by worker: Status,
+	// LastError, RunAt and FinishedAt. It fails with ErrConflict if the job
+	// is no longer claimed by worker.
+	Finish(ctx context.Context, worker string, j *QueueJob) error
+	Get(ctx context.Context, id string) (*QueueJob, error)
+	// List returns the jobs matching f, newest first.
+	List(ctx context.Context, f QueueFilter) ([]QueueJob, error)
+	// Retry queues a dead job to run at now with its attempts reset. It
+	// fails with ErrConflict if the job is not dead.
+	Retry(ctx context.Context, id string, now time.Time) (*QueueJob, error)
+	// Prune deletes jobs that succeeded before before and reports how many.
+	Prune(ctx context.Context, before time.Time) (int, error)
+}
+
+// OutboxRepository persists outbox messages until they are published.
+type OutboxRepository interface {
+	Add(ctx context.Context, m *OutboxMessage) error
+	// Pending returns up to limit unsent messages, oldest first. Within a
+	// PostgreSQL transaction the rows stay locked until it ends and rows
+	// locked by other transactions are skipped, so relays on several
+	// replicas never hand out the same message at once.
+	Pending(ctx context.Context, limit int) ([]OutboxMessage, error)
+	MarkSent(ctx context.Context, ids []string, at time.Time) error
+	// Prune deletes messages sent before before and reports how many.
+	Prune(ctx context.Context, before time.Time) (int, error)
+}
+
+// Repos groups the repositories of one backend, or of one transaction.
+type Repos struct {
+	Tenants      TenantRepository
+	Environments EnvironmentRepository
+	Services     ServiceRepository
+	Deployments  DeploymentRepository
+	QuotaUsage   QuotaUsageRepository
+	Provisioning ProvisioningRepository
+	Audit        AuditRepository
+	History      HistoryRepository
+	Search       SearchRepository
+	Roles        RoleAssignmentRepository
+	Tokens       TokenRepository
+	Credentials  CredentialRepository
+	WebhookKeys  WebhookKeyRepository
+	Queue        QueueRepository
+	Outbox       OutboxRepository
+}
+
+// Store is a backend's repositories; see WithTx for changing several
+// atomically.
+type Store struct {
+	Repos
+	// inTx runs fn against repositories bound to a new transaction,
+	// committing when it returns nil.
+	inTx func(ctx context.Context, fn func(Repos) error) error
+}
@@ -0,0 +1,315 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestMemoryAudit(t *testing.T) {
+	ctx := t.Context()
+	st := NewMemory()
+	base := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	for i, e := range []AuditEvent{
+		{Actor: "alice", Action: "create", Resource: "infra/network"},
+		{Actor: "bob", Action: "apply", Resource: "infra/network"},
+		{Actor: "alice", Action: "drain", Resource: "nodes/node-1"},
+	} {
+		e.Time = base.Add(time.Duration(i) * time.Minute)
+		if err := st.Audit.Record(ctx, &e); err != nil || e.ID == "" {
+			t.Fatalf("unexpected error %v or empty ID", err)
+		}
+	}
+
+	events, _ := st.Audit.List(ctx, AuditFilter{Actor: "alice"})
+	if len(events) != 2 || events[0].Action != "drain" {
+		t.Errorf("expected alice's events newest first, got %+v", events)
+	}
+	events, _ = st.Audit.List(ctx, AuditFilter{Resource: "infra/network", Limit: 1})
+	if len(events) != 1 || events[0].Actor != "bob" {
+		t.Errorf("expected the newest network event, got %+v", events)
+	}
+	if events, _ := st.Audit.List(ctx, AuditFilter{Since: base.Add(90 * time.Second)}); len(events) != 1 {
+		t.Errorf("expected one event since the cutoff, got %+v", events)
+	}
+	chain, _ := st.Audit.Chain(ctx, 1, 0)
+	if len(chain) != 2 || chain[0].Seq != 2 || chain[0].PrevHash == "" || chain[1].PrevHash != chain[0].Hash {
+		t.Errorf("expected events 2 and 3 linked in order, got %+v", chain)
+	}
+	if seq, hash, _ := st.Audit.Head(ctx); seq != 3 || hash != chain[1].Hash || AuditHash(&chain[1]) != hash {
+		t.Errorf("expected the third event at the head, got %d %q", seq, hash)
+	}
+
+	rec := &ProvisioningRecord{TenantID: "t1", Kind: "namespace", Target: "team-a", Status: "pending"}
+	st.Provisioning.Create(ctx, rec)
+	rec.Status = "ready"
+	if err := st.Provisioning.Update(ctx, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := st.Provisioning.Get(ctx, rec.ID); got.Status != "ready" {
+		t.Errorf("expected the updated record, got %+v", got)
+	}
+	if err := st.Provisioning.Update(ctx, &ProvisioningRecord{ID: "missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestMemoryTx(t *testing.T) {
+	ctx := t.Context()
+	st := NewMemory()
+	st.QuotaUsage.Record(ctx, []QuotaSample{{Namespace: "team-a", Resource: "cpu", SampledAt: time.Now().Add(-time.Hour)}})
+
+	err := st.WithTx(ctx, func(tx Repos) error {
+		tenant := &Tenant{Name: "team-a"}
+		if err := tx.Tenants.Create(ctx, tenant); err != nil {
+			return err
+		}
+		tx.Audit.Record(ctx, &AuditEvent{Actor: "alice", Action: "create", Resource: "tenants/" + tenant.ID})
+		tx.QuotaUsage.Prune(ctx, time.Now())
+		return tx.Services.Create(ctx, &Service{TenantID: tenant.ID, Name: "api"})
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	errBoom := errors.New("boom")
+	err = st.WithTx(ctx, func(tx Repos) error {
+		tx.Tenants.Create(ctx, &Tenant{Name: "team-b"})
+		tx.Audit.Record(ctx, &AuditEvent{Actor: "alice", Action: "create", Resource: "tenants/team-b"})
+		tx.QuotaUsage.Record(ctx, []QuotaSample{{Namespace: "team-b", Resource: "cpu"}})
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Errorf("expected fn's error, got %v", err)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected the panic to propagate")
+			}
+		}()
+		st.WithTx(ctx, func(tx Repos) error {
+			tx.Services.Create(ctx, &Service{Name: "worker"})
+			panic("boom")
+		})
+	}()
+
+	tenants, _ := st.Tenants.List(ctx)
+	services, _ := st.Services.List(ctx, "")
+	events, _ := st.Audit.List(ctx, AuditFilter{})
+	if len(tenants) != 1 || len(services) != 1 || len(events) != 1 {
+		t.Errorf("expected only the committed writes, got %d tenants, %d services, %d events", len(tenants), len(services), len(events))
+	}
+	if samples, _ := st.QuotaUsage.History(ctx, "team-b", time.Time{}); len(samples) != 0 {
+		t.Errorf("expected the rolled back samples to be gone, got %+v", samples)
+	}
+}
+
+func TestMemoryConstraints(t *testing.T) {
+	ctx := t.Context()
+	st := NewMemory()
+	seed, err := LoadSeed("testdata/seed.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := seed.Apply(ctx, st); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := seed.Apply(ctx, st); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected seeding twice to conflict, got %v", err)
+	}
+	if services, _ := st.Services.List(ctx, ""); len(services) != 3 {
+		t.Fatalf("expected the seeded services once, got %+v", services)
+	}
+
+	if err := st.Services.Create(ctx, &Service{TenantID: "missing", Name: "api"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a missing tenant to be refused, got %v", err)
+	}
+	if err := st.Deployments.Create(ctx, &Deployment{ServiceID: "missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a missing service to be refused, got %v", err)
+	}
+	search, _ := st.Tenants.Get(ctx, "search")
+	search.Name = "payments"
+	if err := st.Tenants.Update(ctx, search); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected renaming onto a taken name to conflict, got %v", err)
+	}
+	prod, _ := st.Environments.Get(ctx, "prod")
+	prod.DisplayName = "Production (EU)"
+	if err := st.Environments.Update(ctx, prod); err != nil || prod.Version != 2 {
+		t.Fatalf("expected the update to bump the version to 2, got %d (%v)", prod.Version, err)
+	}
+	prod.Version = 1
+	if err := st.Environments.Update(ctx, prod); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("expected a stale version to be refused, got %v", err)
+	}
+	gateway, _ := st.Services.Get(ctx, "payments-gateway")
+	gateway.Name = "ledger"
+	if err := st.Services.Update(ctx, gateway); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected renaming onto a taken name to conflict, got %v", err)
+	}
+
+	if err := st.Tenants.Delete(ctx, "payments"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if services, _ := st.Services.List(ctx, ""); len(services) != 1 || services[0].ID != "search-indexer" {
+		t.Errorf("expected the tenant's services to be deleted with it, got %+v", services)
+	}
+	if _, err := st.Services.Get(ctx, "payments-ledger"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a deleted service to be hidden, got %v", err)
+	}
+	if deployments, _ := st.Deployments.List(ctx, "payments-ledger"); len(deployments) != 2 {
+		t.Errorf("expected the deleted services' deployments to be kept, got %+v", deployments)
+	}
+	if err := st.Tenants.Create(ctx, &Tenant{Name: "payments"}); err != nil {
+		t.Errorf("expected a deleted tenant's name to be reusable, got %v", err)
+	}
+}
+
+func TestNewChange(t *testing.T) {
+	before := Environment{ID: "prod", Name: "prod", Tier: TierProduction, Labels: map[string]string{"region": "eu", "team": "sre"}}
+	after := before
+	after.DisplayName = "Production"
+	after.Labels = map[string]string{"region": "us"}
+	c, err := NewChange("environments", "prod", ChangeUpdate, before, after)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := `{"display_name":"Production","labels":{"region":"us","team":null}}`; string(c.Diff) != want {
+		t.Errorf("expected diff %s, got %s", want, c.Diff)
+	}
+	if c, _ := NewChange("environments", "prod", ChangeDelete, before, nil); c.After != nil || string(c.Diff) == "{}" {
+		t.Errorf("expected a delete to have no after and a diff removing everything, got %+v", c)
+	}
+}
+
+func TestPostgresValues(t *testing.T) {
+	for err, want := range map[error]error{
+		sql.ErrNoRows: ErrNotFound,
+		fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23505"}):                     ErrConflict,
+		&pgconn.PgError{Code: "23503", ConstraintName: "services_tenant_id_fkey"}:    ErrNotFound,
+		&pgconn.PgError{Code: "42P01", Message: `relation "tenants" does not exist`}: nil,
+	} {
+		if got := translate(err); want != nil && !errors.Is(got, want) || want == nil && got != err {
+			t.Errorf("%v: expected %v, got %v", err, want, got)
+		}
+	}
+
+	v, _ := stringMap(nil).Value()
+	if v != "{}" {
+		t.Errorf("expected an empty object for nil, got %v", v)
+	}
+	v, _ = stringMap{"team": "a"}.Value()
+	var m map[string]string
+	if err := (*stringMap)(&m).Scan([]byte(v.(string))); err != nil || m["team"] != "a" {
+		t.Errorf("expected a round trip, got %v (%v)", m, err)
+	}
+	if err := (*stringMap)(&m).Scan([]byte("{}")); err != nil || m != nil {
+		t.Errorf("expected an empty object to scan as nil, got %v", m)
+	}
+
+	var groups []string
+	if err := textArray(&groups).Scan(`{admins,"team a"}`); err != nil || !slices.Equal(groups, []string{"admins", "team a"}) {
+		t.Errorf("expected a text[] to scan, got %v (%v)", groups, err)
+	}
+
+	var ts time.Time
+	local := time.Date(2026, 10, 1, 14, 0, 0, 0, time.FixedZone("CEST", 2*3600))
+	if err := (utc{&ts}).Scan(local); err != nil || ts.Location() != time.UTC || !ts.Equal(local) {
+		t.Errorf("expected %v in UTC, got %v", local, ts)
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want string
+	}{
+		{&pgconn.PgError{Code: "23505"}, "conflict"},
+		{fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23503"}), "foreign_key"},
+		{&pgconn.PgError{Code: "40P01"}, "serialization"},
+		{&pgconn.PgError{Code: "57014"}, "timeout"},
+		{&pgconn.PgError{Code: "08006"}, "connection"},
+		{&pgconn.PgError{Code: "42P01"}, "other"},
+		{context.DeadlineExceeded, "timeout"},
+		{fmt.Errorf("ping: %w", context.Canceled), "canceled"},
+		{driver.ErrBadConn, "connection"},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, "connection"},
+		{errors.New("boom"), "other"},
+	} {
+		if got := errorKind(tc.err); got != tc.want {
+			t.Errorf("errorKind(%v) = %s, want %s", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(migrations) == 0 || migrations[0].Version != 1 || migrations[0].Name != "initial" {
+		t.Fatalf("expected the initial migration first, got %+v", migrations)
+	}
+	for i, m := range migrations {
+		if i > 0 && m.Version <= migrations[i-1].Version {
+			t.Errorf("migrations out of order at %d_%s", m.Version, m.Name)
+		}
+	}
+
+	if st := status(migrations, map[int]bool{}); st.Current != 0 || len(st.Pending) != len(migrations) {
+		t.Errorf("expected everything pending on an empty database, got %+v", st)
+	}
+	applied := map[int]bool{}
+	for _, m := range migrations {
+		applied[m.Version] = true
+	}
+	last := migrations[len(migrations)-1].Version
+	if st := status(migrations, applied); st.Current != last || st.Latest != last || len(st.Pending) != 0 {
+		t.Errorf("expected a current schema, got %+v", st)
+	}
+}
+
+func TestReplicaRouting(t *testing.T) {
+	// Pools connect lazily, so these never dial
+	var replicas []*replica
+	for i, dsn := range []string{"postgres://replica-a:5432/platform", "host=replica-b dbname=platform"} {
+		db, _ := sql.Open("pgx", dsn)
+		defer db.Close()
+		replicas = append(replicas, &replica{name: replicaName(i, dsn), db: db})
+	}
+	if replicas[0].name != "replica-a:5432" || replicas[1].name != "replica-1" {
+		t.Errorf("unexpected replica names %q and %q", replicas[0].name, replicas[1].name)
+	}
+	primary, _ := sql.Open("pgx", "postgres://primary:5432/platform")
+	defer primary.Close()
+	d := pgDB{db: primary, replicas: &replicaSet{replicas: replicas}}
+
+	if got := d.reader().db; got != primary {
+		t.Errorf("expected reads on the primary while no replica is healthy")
+	}
+	replicas[0].healthy.Store(true)
+	replicas[1].healthy.Store(true)
+	seen := map[querier]int{}
+	for range 4 {
+		seen[d.reader().db]++
+	}
+	if seen[replicas[0].db] != 2 || seen[replicas[1].db] != 2 {
+		t.Errorf("expected reads spread over both replicas, got %v", seen)
+	}
+	replicas[0].healthy.Store(false)
+	for range 2 {
+		if got := d.reader().db; got != replicas[1].db {
+			t.Errorf("expected the unhealthy replica to be skipped")
+		}
+	}
+	if tx := (pgDB{db: primary}); tx.reader().db != primary {
+		t.Errorf("expected reads without replicas to stay on the same connection")
+	}
+}
@@ -0,0 +1,44 @@
+package store
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var transactions = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "store_transactions_total",
+	Help: "Units of work by backend and result (commit, rollback or error).",
+}, []string{"backend", "result"})
+
+// WithTx runs fn as a unit of work: writes through tx are committed
+// together when fn returns nil, and rolled back when it returns an error or
+// panics. fn's error is returned as is. The repositories of s itself stay
+// outside the transaction, so fn must only use tx.
+func (s *Store) WithTx(ctx context.Context, fn func(tx Repos) error) error {
+	return s.inTx(ctx, fn)
+}
+
+// runTx calls fn, then commit when it succeeds or rollback when it fails,
+// recording the result under backend. A panic in fn is rolled back and re-raised.
+func runTx(backend string, fn func() error, commit, rollback func() error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			rollback()
+			transactions.WithLabelValues(backend, "rollback").Inc()
+			panic(p)
+		}
+	}()
+	if err := fn(); err != nil {
+		rollback()
+		transactions.WithLabelValues(backend, "rollback").Inc()
+		return err
+	}
+	if err := commit(); err != nil {
+		transactions.WithLabelValues(backend, "error").Inc()
+		return err
+	}
+	transactions.WithLabelValues(backend, "commit").Inc()
+	return nil
+}
@@ -0,0 +1,245 @@
+// Package supplychain serves what the running binary was built from: the
+// SBOM and provenance attestation generated when the image is built and
+// embedded in the binary, and the module and VCS information Go records in
+// every build.
+package supplychain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+)
+
+//go:embed all:attestations
+var embedded embed.FS
+
+// Embedded returns the attestations compiled into the binary.
+func Embedded() fs.FS {
+	sub, _ := fs.Sub(embedded, "attestations")
+	return sub
+}
+
+// Attestation file names, as written by scripts/attest.sh.
+const (
+	CycloneDXFile  = "sbom.cdx.json"
+	SPDXFile       = "sbom.spdx.json"
+	ProvenanceFile = "provenance.intoto.json"
+)
+
+// document is an embedded attestation.
+type document struct {
+	mediaType string
+	data      []byte
+	digest    string
+	// describe is what the summary shows of the document besides its
+	// digest.
+	describe map[string]string
+}
+
+// Handler serves the supply chain endpoints.
+type Handler struct {
+	sbom       *document
+	provenance *document
+	build      *debug.BuildInfo
+}
+
+// New reads the attestations in fsys. build is the binary's build
+// information, from debug.ReadBuildInfo. It fails if an attestation is not
+// what its name says, so a broken build never starts serving.
+func New(fsys fs.FS, build *debug.BuildInfo) (*Handler, error) {
+	h := &Handler{build: build}
+	var err error
+	for _, candidate := range []struct{ name, mediaType string }{
+		{CycloneDXFile, "application/vnd.cyclonedx+json"},
+		{SPDXFile, "application/spdx+json"},
+	} {
+		if h.sbom, err = load(fsys, candidate.name, candidate.mediaType, describeSBOM); h.sbom != nil || err != nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if h.provenance, err = load(fsys, ProvenanceFile, "application/vnd.in-toto+json", describeProvenance); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// load reads the file name, returning nil if there is none.
+func load(fsys fs.FS, name, mediaType string, describe func([]byte) (map[string]string, error)) (*document, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+	fields, err := describe(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", name, err)
+	}
+	sum := sha256.Sum256(data)
+	return &document{mediaType: mediaType, data: data, digest: hex.EncodeToString(sum[:]), describe: fields}, nil
+}
+
+func describeSBOM(data []byte) (map[string]string, error) {
+	var doc struct {
+		BOMFormat   string `json:"bomFormat"`
+		SpecVersion string `json:"specVersion"`
+		SPDXVersion string `json:"spdxVersion"`
+		Components  []any  `json:"components"`
+		Packages    []any  `json:"packages"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	switch {
+	case doc.BOMFormat == "CycloneDX":
+		return map[string]string{"format": "CycloneDX " + doc.SpecVersion, "components": strconv.Itoa(len(doc.Components))}, nil
+	case doc.SPDXVersion != "":
+		return map[string]string{"format": doc.SPDXVersion, "components": strconv.Itoa(len(doc.Packages))}, nil
+	}
+	return nil, errors.New("neither a CycloneDX nor an SPDX document")
+}
+
+func describeProvenance(data []byte) (map[string]string, error) {
+	var doc struct {
+		Type          string `json:"_type"`
+		PredicateType string `json:"predicateType"`
+		Predicate     struct {
+			RunDetails struct {
+				Builder struct {
+					ID string `json:"id"`
+				} `json:"builder"`
+			} `json:"runDetails"`
+		} `json:"predicate"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Type == "" || doc.PredicateType == "" {
+		return nil, errors.New("not an in-toto statement")
+	}
+	return map[string]string{"predicate_type": doc.PredicateType, "builder": doc.Predicate.RunDetails.Builder.ID}, nil
+}
+
+// Register mounts the endpoints on mux:
+//
+//	GET /api/v1/supply-chain              the build, its modules and digests of the attestations
+//	GET /api/v1/supply-chain/sbom         the SBOM, as generated
+//	GET /api/v1/supply-chain/provenance   the provenance attestation, as generated
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/supply-chain", h.summary)
+	mux.HandleFunc("GET /api/v1/supply-chain/sbom", h.serve(h.sbom))
+	mux.HandleFunc("GET /api/v1/supply-chain/provenance", h.serve(h.provenance))
+}
+
+type buildInfo struct {
+	GoVersion string            `json:"go_version"`
+	Path      string            `json:"path"`
+	Version   string            `json:"version"`
+	Revision  string            `json:"revision,omitempty"`
+	Time      string            `json:"time,omitempty"`
+	Modified  bool              `json:"modified"`
+	Settings  map[string]string `json:"settings,omitempty"`
+}
+
+type module struct {
+	Path    string  `json:"path"`
+	Version string  `json:"version"`
+	Sum     string  `json:"sum,omitempty"`
+	Replace *module `json:"replace,omitempty"`
+}
+
+type attestation map[string]string
+
+type summaryResponse struct {
+	Build      *buildInfo  `json:"build,omitempty"`
+	Modules    []module    `json:"modules"`
+	SBOM       attestation `json:"sbom,omitempty"`
+	Provenance attestation `json:"provenance,omitempty"`
+}
+
+func (h *Handler) summary(w http.ResponseWriter, r *http.Request) {
+	resp := summaryResponse{
+		Modules:    []module{},
+		SBOM:       summarize(h.sbom, "/api/v1/supply-chain/sbom"),
+		Provenance: summarize(h.provenance, "/api/v1/supply-chain/provenance"),
+	}
+	if h.build != nil {
+		b := &buildInfo{
+			GoVersion: h.build.GoVersion,
+			Path:      h.build.Path,
+			Version:   h.build.Main.Version,
+			Settings:  map[string]string{},
+		}
+		for _, s := range h.build.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				b.Revision = s.Value
+			case "vcs.time":
+				b.Time = s.Value
+			case "vcs.modified":
+				b.Modified = s.Value == "true"
+			default:
+				b.Settings[s.Key] = s.Value
+			}
+		}
+		resp.Build = b
+		for _, dep := range h.build.Deps {
+			resp.Modules = append(resp.Modules, toModule(dep))
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func toModule(m *debug.Module) module {
+	out := module{Path: m.Path, Version: m.Version, Sum: m.Sum}
+	if m.Replace != nil {
+		replace := toModule(m.Replace)
+		out.Replace = &replace
+	}
+	return out
+}
+
+func summarize(doc *document, href string) attestation {
+	if doc == nil {
+		return nil
+	}
+	out := attestation{"media_type": doc.mediaType, "sha256": doc.digest, "href": href}
+	for k, v := range doc.describe {
+		out[k] = v
+	}
+	return out
+}
+
+func (h *Handler) serve(doc *document) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if doc == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not embedded in this build"})
+			return
+		}
+		w.Header().Set("Content-Type", doc.mediaType)
+		w.Header().Set("ETag", strconv.Quote(doc.digest))
+		// Conditional and range requests; the build time is unknown
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(doc.data))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
@@ -0,0 +1,77 @@
+package supplychain
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime/debug"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSupplyChain(t *testing.T) {
+	sbom := `{"bomFormat":"CycloneDX","specVersion":"1.5","components":[{"name":"zap"},{"name":"grpc"}]}`
+	provenance := `{"_type":"https://in-toto.io/Statement/v1","predicateType":"https://slsa.dev/provenance/v1",
+		"predicate":{"runDetails":{"builder":{"id":"https://example.com/builder"}}}}`
+	build := &debug.BuildInfo{
+		GoVersion: "go1.26.0",
+		Path:      "github.com/virenpatel/k8s-platform-engineering-lab/app",
+		Main:      debug.Module{Path: "github.com/virenpatel/k8s-platform-engineering-lab/app", Version: "(devel)"},
+		Deps:      []*debug.Module{{Path: "go.uber.org/zap", Version: "v1.27.0", Sum: "h1:x"}},
+		Settings:  []debug.BuildSetting{{Key: "vcs.revision", Value: "e4a5e48"}, {Key: "GOARCH", Value: "amd64"}},
+	}
+	h, err := New(fstest.MapFS{
+		CycloneDXFile:  {Data: []byte(sbom)},
+		ProvenanceFile: {Data: []byte(provenance)},
+	}, build)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	mux := http.NewServeMux()
+	h.Register(mux)
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get("/api/v1/supply-chain")
+	var summary summaryResponse
+	if err := json.NewDecoder(rec.Body).Decode(&summary); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if summary.Build == nil || summary.Build.Revision != "e4a5e48" || summary.Build.Settings["GOARCH"] != "amd64" ||
+		len(summary.Modules) != 1 || summary.Modules[0].Path != "go.uber.org/zap" {
+		t.Errorf("summary = %+v", summary)
+	}
+	if summary.SBOM["format"] != "CycloneDX 1.5" || summary.SBOM["components"] != "2" ||
+		summary.Provenance["builder"] != "https://example.com/builder" {
+		t.Errorf("attestations = %v, %v", summary.SBOM, summary.Provenance)
+	}
+
+	// The documents are served as embedded, under their digest
+	rec = get("/api/v1/supply-chain/sbom")
+	if rec.Body.String() != sbom || rec.Header().Get("Content-Type") != "application/vnd.cyclonedx+json" ||
+		rec.Header().Get("ETag") != `"`+summary.SBOM["sha256"]+`"` {
+		t.Errorf("sbom: %d %v %s", rec.Code, rec.Header(), rec.Body)
+	}
+
+	// A build without attestations still reports its modules
+	h, err = New(fstest.MapFS{}, build)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	mux = http.NewServeMux()
+	h.Register(mux)
+	if rec := get("/api/v1/supply-chain/provenance"); rec.Code != http.StatusNotFound {
+		t.Errorf("missing provenance: status %d", rec.Code)
+	}
+
+	// Attestations that are not what their names say fail at startup
+	if _, err := New(fstest.MapFS{SPDXFile: {Data: []byte(`{"name":"x"}`)}}, build); err == nil {
+		t.Error("accepted an invalid SBOM")
+	}
+	if _, err := New(fstest.MapFS{ProvenanceFile: {Data: []byte(`{}`)}}, build); err == nil {
+		t.Error("accepted an invalid provenance statement")
+	}
+}
@@ -0,0 +1,318 @@
+// Package testkit runs the whole service for end-to-end tests. Start
+// assembles it with app.New, as serve does, but with a memory store and
+// event bus, a fake Kubernetes clientset and a logger writing to the test
+// log, and serves it on ephemeral ports. Tests then make real HTTP requests
+// as the users they need, and assert on the responses, the store, the fake
+// cluster and the events published.
+//
+//	kit := testkit.Start(t, testkit.Options{Env: map[string]string{"PDBS_ENABLED": "true"}})
+//	kit.As("alice", "team-a").Post("/api/v1/namespaces/team-a/pdbs", req).Expect(http.StatusCreated)
+//	kit.WaitForEvent("pdb.created")
+//
+// Start sets environment variables, so tests using it cannot run in
+// parallel.
+package testkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zaptest"
+	authzv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/app"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/config"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/kube"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+// Timeout bounds starting the service, shutting it down and waiting for
+// events.
+const Timeout = 10 * time.Second
+
+// Options configures the service under test. Every field is optional.
+type Options struct {
+	// Env sets configuration variables before the configuration is
+	// loaded, e.g. to turn features on. PORT and ADMIN_PORT are always 0,
+	// the store and event bus are always in memory, and KUBE_ENABLED is
+	// always on. Features that need a REST config for their own clients,
+	// such as CATALOG_ENABLED, cannot run against the fake cluster.
+	Env map[string]string
+	// Store replaces the empty memory store, e.g. to start from fixtures.
+	Store *store.Store
+	// Objects seed the fake cluster.
+	Objects []runtime.Object
+	// Authorize answers the SubjectAccessReviews the service sends to the
+	// fake cluster; nil allows everything.
+	Authorize func(authzv1.SubjectAccessReviewSpec) bool
+}
+
+// Kit is a running service.
+type Kit struct {
+	App *app.App
+	// Store and Kube are the service's store and fake cluster, for
+	// arranging state and checking what requests changed.
+	Store *store.Store
+	Kube  *fake.Clientset
+	// URL and AdminURL are the base URLs of the public and admin
+	// listeners.
+	URL      string
+	AdminURL string
+
+	t      testing.TB
+	client *http.Client
+
+	mu     sync.Mutex
+	events []events.Event
+}
+
+// Start assembles and starts the service, waits for it to warm up, and
+// shuts it down when the test ends.
+func Start(t testing.TB, opts Options) *Kit {
+	t.Helper()
+	for k, v := range opts.Env {
+		t.Setenv(k, v)
+	}
+	if _, ok := opts.Env["AUTH_PROXY_TRUSTED_CIDRS"]; !ok {
+		// The test's requests stand in for the authenticating proxy
+		t.Setenv("AUTH_PROXY_TRUSTED_CIDRS", "127.0.0.0/8,::1/128")
+	}
+	t.Setenv("PORT", "0")
+	t.Setenv("ADMIN_PORT", "0")
+	t.Setenv("STORE_BACKEND", config.StoreMemory)
+	t.Setenv("EVENTS_BACKEND", config.EventsMemory)
+	// The fake cluster stands in for the real one
+	t.Setenv("KUBE_ENABLED", "true")
+
+	logger := zaptest.NewLogger(t)
+	st := opts.Store
+	if st == nil {
+		st = store.NewMemory()
+	}
+	cs := fake.NewClientset(opts.Objects...)
+	authorize := opts.Authorize
+	if authorize == nil {
+		authorize = func(authzv1.SubjectAccessReviewSpec) bool { return true }
+	}
+	cs.PrependReactor("create", "subjectaccessreviews", func(a k8stesting.Action) (bool, runtime.Object, error) {
+		sar := a.(k8stesting.CreateAction).GetObject().(*authzv1.SubjectAccessReview)
+		sar.Status.Allowed = authorize(sar.Spec)
+		return true, sar, nil
+	})
+
+	a, err := app.New(config.Load(), app.Options{
+		Logger: logger,
+		Store:  st,
+		Kube:   kube.NewForClientset(cs, nil, 0, logger),
+	})
+	if err != nil {
+		t.Fatalf("testkit: assemble service: %v", err)
+	}
+	k := &Kit{
+		App:    a,
+		Store:  st,
+		Kube:   cs,
+		t:      t,
+		client: &http.Client{Timeout: Timeout},
+	}
+	a.Bus.Subscribe(k.record)
+	t.Cleanup(k.shutdown)
+	if err := a.Start(); err != nil {
+		t.Fatalf("testkit: start service: %v", err)
+	}
+	k.URL = "http://" + a.Public.Addr().String()
+	k.AdminURL = "http://" + a.Admin.Addr().String()
+
+	deadline := time.Now().Add(Timeout)
+	for a.Warmup.Check(context.Background()) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("testkit: service did not warm up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return k
+}
+
+func (k *Kit) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	if err := k.App.Shutdown(ctx); err != nil {
+		k.t.Errorf("testkit: shut down service: %v", err)
+	}
+}
+
+// As returns a client making requests to the public listener as user in
+// groups, through the auth proxy headers. With no user, requests carry no
+// identity.
+func (k *Kit) As(user string, groups ...string) *Client {
+	return &Client{kit: k, base: k.URL, user: user, groups: groups}
+}
+
+// Admin returns a client for the admin listener: probes, metrics and
+// pprof.
+func (k *Kit) Admin() *Client {
+	return &Client{kit: k, base: k.AdminURL}
+}
+
+func (k *Kit) record(_ context.Context, e events.Event) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.events = append(k.events, e)
+}
+
+// Events returns the events published since Start, in order.
+func (k *Kit) Events() []events.Event {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return append([]events.Event(nil), k.events...)
+}
+
+// WaitForEvent returns the first event of type typ published since Start,
+// waiting up to Timeout for it, and fails the test if there is none.
+func (k *Kit) WaitForEvent(typ string) events.Event {
+	k.t.Helper()
+	deadline := time.Now().Add(Timeout)
+	for {
+		for _, e := range k.Events() {
+			if e.Type == typ {
+				return e
+			}
+		}
+		if time.Now().After(deadline) {
+			k.t.Fatalf("testkit: no %s event; got %v", typ, eventTypes(k.Events()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func eventTypes(es []events.Event) []string {
+	types := make([]string, len(es))
+	for i, e := range es {
+		types[i] = e.Type
+	}
+	return types
+}
+
+// Client makes requests to one listener as one user. Requests that cannot
+// be sent fail the test.
+type Client struct {
+	kit    *Kit
+	base   string
+	user   string
+	groups []string
+}
+
+// Do sends a request to path. A string or []byte body is sent as is; any
+// other non-nil body is sent as JSON.
+func (c *Client) Do(method, path string, body any) *Response {
+	t := c.kit.t
+	t.Helper()
+	var r io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		r = strings.NewReader(b)
+	case []byte:
+		r = bytes.NewReader(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			t.Fatalf("testkit: encode %s %s body: %v", method, path, err)
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.base+path, r)
+	if err != nil {
+		t.Fatalf("testkit: %s %s: %v", method, path, err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	cfg := c.kit.App.Config
+	if c.user != "" {
+		req.Header.Set(cfg.AuthProxyUserHeader, c.user)
+	}
+	if len(c.groups) > 0 {
+		req.Header.Set(cfg.AuthProxyGroupsHeader, strings.Join(c.groups, ","))
+	}
+
+	resp, err := c.kit.client.Do(req)
+	if err != nil {
+		t.Fatalf("testkit: %s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("testkit: read %s %s response: %v", method, path, err)
+	}
+	return &Response{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       data,
+		t:          t,
+		request:    method + " " + path,
+	}
+}
+
+// Get sends a GET request.
+func (c *Client) Get(path string) *Response {
+	c.kit.t.Helper()
+	return c.Do(http.MethodGet, path, nil)
+}
+
+// Post sends a POST request with body.
+func (c *Client) Post(path string, body any) *Response {
+	c.kit.t.Helper()
+	return c.Do(http.MethodPost, path, body)
+}
+
+// Put sends a PUT request with body.
+func (c *Client) Put(path string, body any) *Response {
+	c.kit.t.Helper()
+	return c.Do(http.MethodPut, path, body)
+}
+
+// Delete sends a DELETE request.
+func (c *Client) Delete(path string) *Response {
+	c.kit.t.Helper()
+	return c.Do(http.MethodDelete, path, nil)
+}
+
+// Response is a response read in full.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+
+	t       testing.TB
+	request string
+}
+
+// Expect fails the test unless the response has status code, and returns
+// the response for further checks.
+func (r *Response) Expect(code int) *Response {
+	r.t.Helper()
+	if r.StatusCode != code {
+		r.t.Fatalf("%s: expected %d, got %d: %s", r.request, code, r.StatusCode, r.Body)
+	}
+	return r
+}
+
+// JSON decodes the body into v, failing the test if it cannot.
+func (r *Response) JSON(v any) {
+	r.t.Helper()
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		r.t.Fatalf("%s: decode response %s: %v", r.request, r.Body, err)
+	}
+}
@@ -0,0 +1,85 @@
+package testkit_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/testkit"
+)
+
+func TestTenantLifecycle(t *testing.T) {
+	kit := testkit.Start(t, testkit.Options{Env: map[string]string{
+		"RESOURCES_API_ENABLED":  "true",
+		"RESOURCES_ADMIN_GROUPS": "platform-admins",
+	}})
+	admin := kit.As("alice", "platform-admins")
+
+	admin.Post("/api/v1/tenants", map[string]string{
+		"name":         "payments",
+		"display_name": "Payments",
+		"owner":        "team-payments",
+	}).Expect(http.StatusCreated)
+
+	var list struct {
+		Items []struct {
+			Name string `json:"name"`
+		} `json:"items"`
+	}
+	admin.Get("/api/v1/tenants").Expect(http.StatusOK).JSON(&list)
+	if len(list.Items) != 1 || list.Items[0].Name != "payments" {
+		t.Errorf("expected the new tenant, got %+v", list.Items)
+	}
+	stored, err := kit.Store.Tenants.List(t.Context())
+	if err != nil || len(stored) != 1 {
+		t.Errorf("expected the tenant in the store, got %+v %v", stored, err)
+	}
+
+	kit.Admin().Get("/readyz").Expect(http.StatusOK)
+}
+
+func TestDisruptionBudgetPublishesEvent(t *testing.T) {
+	replicas := int32(3)
+	web := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "team-a", UID: "web-uid"},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+		},
+	}
+	kit := testkit.Start(t, testkit.Options{
+		Env:     map[string]string{"PDBS_ENABLED": "true"},
+		Objects: []runtime.Object{web},
+		// Only team-a may manage its own namespace
+		Authorize: func(spec authzv1.SubjectAccessReviewSpec) bool {
+			return spec.User == "alice" && spec.ResourceAttributes.Namespace == "team-a"
+		},
+	})
+	budget := map[string]string{"template": "one-at-a-time", "kind": "Deployment", "name": "web"}
+
+	kit.As("mallory").Post("/api/v1/namespaces/team-a/pdbs", budget).Expect(http.StatusForbidden)
+	kit.As("alice", "team-a").Post("/api/v1/namespaces/team-a/pdbs", budget).Expect(http.StatusCreated)
+
+	e := kit.WaitForEvent("pdb.created")
+	var data map[string]string
+	if err := json.Unmarshal(e.Data, &data); err != nil || data["pdb"] != "web" || data["user"] != "alice" {
+		t.Errorf("expected alice's budget in the event, got %s", e.Data)
+	}
+	if _, err := kit.Kube.PolicyV1().PodDisruptionBudgets("team-a").Get(t.Context(), "web", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected the budget in the cluster: %v", err)
+	}
+}
+
+func TestUnauthenticatedRequestsAreRejected(t *testing.T) {
+	kit := testkit.Start(t, testkit.Options{Env: map[string]string{"PDBS_ENABLED": "true"}})
+	budget := map[string]string{"template": "one-at-a-time", "kind": "Deployment", "name": "web"}
+	kit.As("").Post("/api/v1/namespaces/team-a/pdbs", budget).Expect(http.StatusUnauthorized)
+	if len(kit.Events()) != 0 {
+		t.Errorf("expected no events, got %v", kit.Events())
+	}
+}
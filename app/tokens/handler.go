@@ -0,0 +1,177 @@
+package tokens
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/access"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+// maxNameLength bounds a token's name.
+const maxNameLength = 100
+
+// Register mounts the self-service endpoints on mux. They serve the
+// caller's own tokens to interactive users only, so that neither a leaked
+// token nor a workload can mint others:
+//
+//	GET    /api/v1/tokens        the caller's tokens, newest first
+//	POST   /api/v1/tokens        create a token; the response holds its secret
+//	DELETE /api/v1/tokens/{id}   revoke a token
+func (s *Service) Register(mux *http.ServeMux) {
+	interactive := access.RequireClaim("auth", "proxy", "session")
+	mux.Handle("GET /api/v1/tokens", access.Protect(http.HandlerFunc(s.list), interactive))
+	mux.Handle("POST /api/v1/tokens", access.Protect(http.HandlerFunc(s.create), interactive))
+	mux.Handle("DELETE /api/v1/tokens/{id}", access.Protect(http.HandlerFunc(s.revoke), interactive))
+}
+
+// caller returns the authenticated user, or writes an error.
+func (s *Service) caller(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user := s.headers.Identity(r).User
+	if user == "" {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return "", false
+	}
+	return user, true
+}
+
+func (s *Service) list(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.caller(w, r)
+	if !ok {
+		return
+	}
+	items, err := s.repo.List(r.Context(), user)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+type createRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresIn is a duration such as "720h"; empty means the default.
+	ExpiresIn string `json:"expires_in"`
+}
+
+func (s *Service) create(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.caller(w, r)
+	if !ok {
+		return
+	}
+	var req createRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" || len(req.Name) > maxNameLength {
+		http.Error(w, "name is required and at most 100 characters", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		http.Error(w, "at least one scope is required", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !validScope(scope) {
+			http.Error(w, "invalid scope "+scope+": expected *, resource:* or resource:action", http.StatusBadRequest)
+			return
+		}
+	}
+	ttl := s.opts.DefaultTTL
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			http.Error(w, "expires_in must be a positive duration such as 720h", http.StatusBadRequest)
+			return
+		}
+		if d > s.opts.MaxTTL {
+			http.Error(w, "expires_in exceeds the maximum of "+s.opts.MaxTTL.String(), http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	t := &store.APIToken{
+		Owner:     user,
+		Name:      req.Name,
+		Prefix:    secret[:len(SecretPrefix)+6],
+		Hash:      hash(secret),
+		Scopes:    req.Scopes,
+		ExpiresAt: s.now().Add(ttl).UTC(),
+	}
+	if err := s.repo.Create(r.Context(), t); err != nil {
+		s.fail(w, err)
+		return
+	}
+	s.audit(r, "token created", zap.String("token_id", t.ID), zap.String("name", t.Name),
+		zap.Strings("scopes", t.Scopes), zap.Time("expires_at", t.ExpiresAt))
+	w.Header().Set("Location", "/api/v1/tokens/"+t.ID)
+	writeJSON(w, http.StatusCreated, struct {
+		*store.APIToken
+		// Secret is only ever returned here
+		Secret string `json:"secret"`
+	}{t, secret})
+}
+
+func (s *Service) revoke(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.caller(w, r)
+	if !ok {
+		return
+	}
+	id := r.PathValue("id")
+	t, err := s.repo.Get(r.Context(), id)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	if t.Owner != user {
+		// Other users' tokens are not disclosed
+		http.Error(w, "token not found", http.StatusNotFound)
+		return
+	}
+	if err := s.repo.Revoke(r.Context(), id, s.now()); err != nil {
+		s.fail(w, err)
+		return
+	}
+	s.audit(r, "token revoked", zap.String("token_id", id), zap.String("name", t.Name))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) audit(r *http.Request, msg string, fields ...zap.Field) {
+	id := s.headers.Identity(r)
+	s.logger.Info(msg, append([]zap.Field{
+		zap.String("audit", "tokens"),
+		zap.String("request_id", middleware.GetRequestID(r.Context())),
+		zap.String("user", id.User),
+		zap.Strings("groups", id.Groups),
+	}, fields...)...)
+}
+
+func (s *Service) fail(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		http.Error(w, "token not found", http.StatusNotFound)
+	default:
+		s.logger.Error("token request failed", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
@@ -0,0 +1,208 @@
+// Package tokens issues personal access tokens for automation, in place
+// of shared static keys. A user mints a token through the API with a name,
+// scopes and a lifetime; the secret is shown once and only its SHA-256
+// hash is kept. Requests carrying the secret as a bearer token act as the
+// token's owner, limited to its scopes, until it expires or is revoked.
+package tokens
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/access"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/rbac"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+// SecretPrefix starts every token secret, so that leaked secrets are easy
+// to scan for and bearer tokens from other issuers are left alone.
+const SecretPrefix = "plt_"
+
+// touchInterval limits how often a token's last use is written.
+const touchInterval = time.Minute
+
+var authenticationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "api_token_authentications_total",
+	Help: "Requests carrying a personal access token by result (valid, invalid, expired, revoked, out_of_scope or error).",
+}, []string{"result"})
+
+// Options configures a Service.
+type Options struct {
+	// UserHeader and GroupsHeader carry the caller's identity. The proxy
+	// sets them for interactive callers; the middleware sets them from the
+	// token for token callers.
+	UserHeader   string
+	GroupsHeader string
+	// DefaultTTL is the lifetime of tokens created without one, and MaxTTL
+	// the longest allowed.
+	DefaultTTL time.Duration
+	MaxTTL     time.Duration
+	// Permission returns the permission a request's route needs and false
+	// for unmapped routes, as rbac.Enforcer.Permission does. Tokens reach
+	// unmapped routes only with the "*" scope.
+	Permission func(r *http.Request) (string, bool)
+	// Groups looks up a token owner's current groups in the identity
+	// source on every request, so leaving a group takes its roles from the
+	// owner's tokens too. Nil limits tokens to the roles assigned to the
+	// owner directly.
+	Groups func(ctx context.Context, user string) ([]string, error)
+}
+
+// Service issues tokens and authenticates requests made with them.
+type Service struct {
+	repo    store.TokenRepository
+	opts    Options
+	headers authz.Headers
+	logger  *zap.Logger
+	now     func() time.Time
+}
+
+// New creates a service keeping tokens in repo.
+func New(repo store.TokenRepository, opts Options, logger *zap.Logger) *Service {
+	if opts.DefaultTTL <= 0 {
+		opts.DefaultTTL = 30 * 24 * time.Hour
+	}
+	if opts.MaxTTL < opts.DefaultTTL {
+		opts.MaxTTL = opts.DefaultTTL
+	}
+	return &Service{
+		repo:    repo,
+		opts:    opts,
+		headers: authz.Headers{User: opts.UserHeader, Groups: opts.GroupsHeader},
+		logger:  logger,
+		now:     time.Now,
+	}
+}
+
+type tokenKey struct{}
+
+// TokenID returns the ID of the token that authenticated the request, or
+// "" for requests authenticated by the proxy.
+func TokenID(ctx context.Context) string {
+	id, _ := ctx.Value(tokenKey{}).(string)
+	return id
+}
+
+// hash returns the stored form of secret.
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// newSecret returns a random token secret.
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return SecretPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Middleware authenticates requests whose Authorization header carries a
+// token secret: it drops the identity headers sent with it, sets them to
+// the token's owner and the owner's current groups, and refuses the request if the token is
+// unknown, expired or revoked (401) or its scopes lack the route's
+// permission (403). Other requests pass unchanged. Mount it outside the rbac middleware, which
+// then checks the owner's roles too.
+func (s *Service) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || !strings.HasPrefix(secret, SecretPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// The token alone names the caller, whatever else was sent
+		r = r.Clone(r.Context())
+		r.Header.Del(s.opts.UserHeader)
+		r.Header.Del(s.opts.GroupsHeader)
+		t, err := s.repo.ByHash(r.Context(), hash(secret))
+		now := s.now()
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			authenticationsTotal.WithLabelValues("invalid").Inc()
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		case err != nil:
+			authenticationsTotal.WithLabelValues("error").Inc()
+			s.logger.Error("failed to look up token", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		case t.RevokedAt != nil:
+			authenticationsTotal.WithLabelValues("revoked").Inc()
+			http.Error(w, "token revoked", http.StatusUnauthorized)
+			return
+		case !now.Before(t.ExpiresAt):
+			authenticationsTotal.WithLabelValues("expired").Inc()
+			http.Error(w, "token expired", http.StatusUnauthorized)
+			return
+		}
+		if !s.inScope(r, t.Scopes) {
+			authenticationsTotal.WithLabelValues("out_of_scope").Inc()
+			http.Error(w, "token scopes do not allow this request", http.StatusForbidden)
+			return
+		}
+		var groups []string
+		if s.opts.Groups != nil {
+			if groups, err = s.opts.Groups(r.Context(), t.Owner); err != nil {
+				authenticationsTotal.WithLabelValues("error").Inc()
+				s.logger.Error("failed to look up token owner's groups", zap.String("user", t.Owner), zap.Error(err))
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+		}
+		authenticationsTotal.WithLabelValues("valid").Inc()
+
+		if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) >= touchInterval {
+			if err := s.repo.Touch(context.WithoutCancel(r.Context()), t.ID, now); err != nil {
+				s.logger.Warn("failed to record token use", zap.String("token_id", t.ID), zap.Error(err))
+			}
+		}
+		ctx := context.WithValue(r.Context(), tokenKey{}, t.ID)
+		ctx = access.WithClaims(ctx, map[string]string{"auth": "token", "token_id": t.ID})
+		r = r.WithContext(access.WithScopes(ctx, t.Scopes))
+		r.Header.Del("Authorization")
+		r.Header.Set(s.opts.UserHeader, t.Owner)
+		r.Header.Set(s.opts.GroupsHeader, strings.Join(groups, ","))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// inScope reports whether scopes allow the request. Exempt routes need no
+// scope.
+func (s *Service) inScope(r *http.Request, scopes []string) bool {
+	granted := rbac.Role{Permissions: scopes}
+	if s.opts.Permission == nil {
+		return granted.Grants("*")
+	}
+	perm, mapped := s.opts.Permission(r)
+	switch {
+	case !mapped:
+		return granted.Grants("*")
+	case perm == "":
+		return true
+	default:
+		return granted.Grants(perm)
+	}
+}
+
+// validScope reports whether scope is "*", "resource:*" or
+// "resource:action".
+func validScope(scope string) bool {
+	if scope == "*" {
+		return true
+	}
+	resource, action, ok := strings.Cut(scope, ":")
+	return ok && resource != "" && action != "" && !strings.ContainsAny(resource+action, ": ")
+}
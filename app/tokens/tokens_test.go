@@ -0,0 +1,213 @@
+package tokens
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/access"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/rbac"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+// newServer returns a service whose owners' groups are looked up in
+// directory, which tests may change between requests.
+func newServer(t *testing.T) (*Service, http.Handler, map[string][]string) {
+	t.Helper()
+	directory := map[string][]string{"bob": {"developers"}}
+	st := store.NewMemory()
+	e, err := rbac.New(st.Roles, rbac.Options{
+		UserHeader:   "X-Forwarded-User",
+		GroupsHeader: "X-Forwarded-Groups",
+		GroupRoles:   map[string]string{"platform-admins": "admin", "developers": "developer"},
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s := New(st.Tokens, Options{
+		UserHeader:   "X-Forwarded-User",
+		GroupsHeader: "X-Forwarded-Groups",
+		DefaultTTL:   24 * time.Hour,
+		MaxTTL:       48 * time.Hour,
+		Permission:   e.Permission,
+		Groups: func(_ context.Context, user string) ([]string, error) {
+			return directory[user], nil
+		},
+	}, zap.NewNop())
+	mux := http.NewServeMux()
+	s.Register(mux)
+	// Echo the identity the handler sees
+	whoami := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Forwarded-User") + " " + r.Header.Get("X-Forwarded-Groups")))
+	}
+	mux.HandleFunc("GET /api/v1/tenants/{id}", whoami)
+	mux.HandleFunc("PUT /api/v1/tenants/{id}", whoami)
+	mux.HandleFunc("GET /api/v1/version", whoami)
+	routes := access.New(access.Options{
+		UserHeader:   "X-Forwarded-User",
+		GroupsHeader: "X-Forwarded-Groups",
+		Grants:       e.PermissionsOf,
+	}, zap.NewNop())
+	// httptest requests come from 192.0.2.1, standing in for the proxy
+	proxies, err := access.ParseProxies([]string{"192.0.2.0/24"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := authz.Headers{User: "X-Forwarded-User", Groups: "X-Forwarded-Groups"}
+	return s, access.TrustProxy(headers, proxies, s.Middleware(e.Middleware(routes.Middleware(mux)))), directory
+}
+
+func do(h http.Handler, method, path, user, groups, bearer, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if user != "" {
+		req.Header.Set("X-Forwarded-User", user)
+		req.Header.Set("X-Forwarded-Groups", groups)
+	}
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func create(t *testing.T, h http.Handler, user, groups, body string) (store.APIToken, string) {
+	t.Helper()
+	rec := do(h, http.MethodPost, "/api/v1/tokens", user, groups, "", body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		store.APIToken
+		Secret string
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	return resp.APIToken, resp.Secret
+}
+
+func TestTokenAuthentication(t *testing.T) {
+	s, h, _ := newServer(t)
+	tok, secret := create(t, h, "bob", "developers", `{"name":"ci","scopes":["tenants:read"]}`)
+	if !strings.HasPrefix(secret, SecretPrefix) || !strings.HasPrefix(secret, tok.Prefix) {
+		t.Fatalf("unexpected secret %q for prefix %q", secret, tok.Prefix)
+	}
+
+	// The token acts as its owner with the owner's current groups
+	rec := do(h, http.MethodGet, "/api/v1/tenants/payments", "", "", secret, "")
+	if rec.Code != http.StatusOK || rec.Body.String() != "bob developers" {
+		t.Errorf("expected the request to run as bob, got %d %q", rec.Code, rec.Body)
+	}
+	// Forged identity headers are replaced
+	rec = do(h, http.MethodGet, "/api/v1/tenants/payments", "alice", "platform-admins", secret, "")
+	if rec.Body.String() != "bob developers" {
+		t.Errorf("expected the token identity to win, got %q", rec.Body)
+	}
+
+	tests := []struct {
+		method, path, bearer string
+		want                 int
+	}{
+		{http.MethodPut, "/api/v1/tenants/payments", secret, http.StatusForbidden},
+		{http.MethodGet, "/api/v1/version", secret, http.StatusForbidden},
+		{http.MethodGet, "/api/v1/tokens", secret, http.StatusForbidden},
+		{http.MethodGet, "/api/v1/tenants/payments", SecretPrefix + "unknown", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if rec := do(h, tt.method, tt.path, "", "", tt.bearer, ""); rec.Code != tt.want {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.path, tt.want, rec.Code)
+		}
+	}
+
+	got, _ := s.repo.Get(t.Context(), tok.ID)
+	if got.LastUsedAt == nil {
+		t.Error("expected the last use recorded")
+	}
+	s.now = func() time.Time { return time.Now().Add(25 * time.Hour) }
+	if rec := do(h, http.MethodGet, "/api/v1/tenants/payments", "", "", secret, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected an expired token to be refused, got %d", rec.Code)
+	}
+}
+
+func TestTokenLifecycle(t *testing.T) {
+	_, h, _ := newServer(t)
+	for _, bad := range []string{
+		`{"name":"","scopes":["*"]}`,
+		`{"name":"x","scopes":[]}`,
+		`{"name":"x","scopes":["tenants"]}`,
+		`{"name":"x","scopes":["*"],"expires_in":"72h"}`,
+	} {
+		if rec := do(h, http.MethodPost, "/api/v1/tokens", "bob", "", "", bad); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", bad, rec.Code)
+		}
+	}
+	if rec := do(h, http.MethodPost, "/api/v1/tokens", "", "", "", `{"name":"x","scopes":["*"]}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a user, got %d", rec.Code)
+	}
+
+	tok, secret := create(t, h, "bob", "developers", `{"name":"ci","scopes":["*"],"expires_in":"1h"}`)
+	create(t, h, "carol", "", `{"name":"other","scopes":["*"]}`)
+	rec := do(h, http.MethodGet, "/api/v1/tokens", "bob", "", "", "")
+	var list struct{ Items []map[string]any }
+	json.NewDecoder(rec.Body).Decode(&list)
+	if len(list.Items) != 1 || list.Items[0]["name"] != "ci" || list.Items[0]["hash"] != nil || list.Items[0]["secret"] != nil {
+		t.Errorf("expected only bob's token without its secret, got %+v", list.Items)
+	}
+
+	if rec := do(h, http.MethodDelete, "/api/v1/tokens/"+tok.ID, "carol", "", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected other users' tokens to be hidden, got %d", rec.Code)
+	}
+	if rec := do(h, http.MethodDelete, "/api/v1/tokens/"+tok.ID, "bob", "", "", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	if rec := do(h, http.MethodGet, "/api/v1/tenants/payments", "", "", secret, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected a revoked token to be refused, got %d", rec.Code)
+	}
+}
+
+func TestTokenIssuanceNeedsVerifiedCaller(t *testing.T) {
+	_, h, _ := newServer(t)
+	_, secret := create(t, h, "bob", "developers", `{"name":"ci","scopes":["*"]}`)
+	body := `{"name":"x","scopes":["*"]}`
+
+	// Identity headers from a client rather than the proxy name nobody
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tokens", strings.NewReader(body))
+	req.RemoteAddr = "203.0.113.9:1234"
+	req.Header.Set("X-Forwarded-User", "alice")
+	req.Header.Set("X-Forwarded-Groups", "platform-admins")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected spoofed identity headers refused, got %d", rec.Code)
+	}
+	// A token cannot mint another, whatever identity it claims to carry
+	if rec := do(h, http.MethodPost, "/api/v1/tokens", "alice", "platform-admins", secret, body); rec.Code != http.StatusForbidden {
+		t.Errorf("expected a token refused, got %d", rec.Code)
+	}
+}
+
+func TestTokenFollowsGroupMembership(t *testing.T) {
+	s, h, directory := newServer(t)
+	_, secret := create(t, h, "bob", "developers", `{"name":"ci","scopes":["tenants:read"]}`)
+	if rec := do(h, http.MethodGet, "/api/v1/tenants/payments", "", "", secret, ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected the developer role to allow the read, got %d", rec.Code)
+	}
+
+	// Leaving the group takes its role from the existing token
+	delete(directory, "bob")
+	if rec := do(h, http.MethodGet, "/api/v1/tenants/payments", "", "", secret, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("expected the group-derived role gone after leaving the group, got %d", rec.Code)
+	}
+
+	s.opts.Groups = func(context.Context, string) ([]string, error) { return nil, errors.New("directory down") }
+	if rec := do(h, http.MethodGet, "/api/v1/tenants/payments", "", "", secret, ""); rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected a failed lookup to refuse the request, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,141 @@
+// Package warmup runs the work that makes a new replica fast before it is
+// sent traffic: syncing informer caches, fetching key sets, opening
+// database connections. Components register tasks as they are created; Run
+// runs them all at once after the listeners open, and the readiness check
+// fails until it is done. Without it, the first requests to a new pod pay
+// for all of that, right as a rollout or a scale-up sends them in.
+package warmup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+var (
+	taskSeconds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "warmup_task_duration_seconds",
+		Help: "How long each warmup task took at startup, by task and result (ok or error).",
+	}, []string{"task", "result"})
+	warmupSeconds = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "warmup_duration_seconds",
+		Help: "How long the warmup phase took at startup.",
+	})
+)
+
+// Task warms something up.
+type Task func(ctx context.Context) error
+
+type task struct {
+	name     string
+	required bool
+	fn       Task
+}
+
+// Warmup is a set of warmup tasks.
+type Warmup struct {
+	timeout time.Duration
+	logger  *zap.Logger
+
+	mu    sync.Mutex
+	tasks []task
+	done  atomic.Bool
+}
+
+// New creates an empty warmup; each task gets up to timeout (0 for no
+// limit).
+func New(timeout time.Duration, logger *zap.Logger) *Warmup {
+	return &Warmup{timeout: timeout, logger: logger}
+}
+
+// Add registers fn. When a required task fails Run fails; when an
+// optional one does, the replica becomes ready regardless and warms up on
+// its first requests.
+func (w *Warmup) Add(name string, required bool, fn Task) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.tasks = append(w.tasks, task{name: name, required: required, fn: fn})
+}
+
+// Run runs the tasks concurrently and marks the warmup done once they have
+// finished, unless a required one failed.
+func (w *Warmup) Run(ctx context.Context) error {
+	w.mu.Lock()
+	tasks := w.tasks
+	w.mu.Unlock()
+
+	start := time.Now()
+	errs := make([]error, len(tasks))
+	var wg sync.WaitGroup
+	for i, t := range tasks {
+		wg.Go(func() {
+			errs[i] = w.run(ctx, t)
+		})
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	warmupSeconds.Set(elapsed.Seconds())
+
+	failed := 0
+	var required []error
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		failed++
+		if tasks[i].required {
+			required = append(required, fmt.Errorf("%s: %w", tasks[i].name, err))
+		}
+	}
+	if len(required) > 0 {
+		return errors.Join(required...)
+	}
+	w.done.Store(true)
+	w.logger.Info("warmup complete",
+		zap.Duration("duration", elapsed),
+		zap.Int("tasks", len(tasks)),
+		zap.Int("failed", failed),
+	)
+	return nil
+}
+
+func (w *Warmup) run(ctx context.Context, t task) error {
+	if w.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	err := t.fn(ctx)
+	elapsed := time.Since(start)
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	taskSeconds.WithLabelValues(t.name, result).Set(elapsed.Seconds())
+	fields := []zap.Field{zap.String("task", t.name), zap.Duration("duration", elapsed)}
+	switch {
+	case err == nil:
+		w.logger.Info("warmup task done", fields...)
+	case t.required:
+		w.logger.Error("warmup task failed", append(fields, zap.Error(err))...)
+	default:
+		w.logger.Warn("optional warmup task failed", append(fields, zap.Error(err))...)
+	}
+	return err
+}
+
+// Check is a readiness check failing until the warmup is done.
+func (w *Warmup) Check(context.Context) error {
+	if !w.done.Load() {
+		return errors.New("warming up")
+	}
+	return nil
+}
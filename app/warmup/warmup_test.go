@@ -0,0 +1,41 @@
+package warmup
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestWarmup(t *testing.T) {
+	w := New(50*time.Millisecond, zap.NewNop())
+	var ran atomic.Int32
+	w.Add("quick", true, func(context.Context) error { ran.Add(1); return nil })
+	w.Add("optional", false, func(context.Context) error { ran.Add(1); return errors.New("unreachable") })
+	if w.Check(t.Context()) == nil {
+		t.Fatal("ready before warming up")
+	}
+
+	// Optional tasks may fail
+	if err := w.Run(t.Context()); err != nil || ran.Load() != 2 {
+		t.Fatalf("run: %v, %d tasks ran", err, ran.Load())
+	}
+	if err := w.Check(t.Context()); err != nil {
+		t.Errorf("not ready after warming up: %v", err)
+	}
+
+	// Required ones may not, and are cut off at the timeout
+	w = New(50*time.Millisecond, zap.NewNop())
+	w.Add("slow", true, func(ctx context.Context) error { <-ctx.Done(); return ctx.Err() })
+	err := w.Run(t.Context())
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "slow") {
+		t.Errorf("run = %v", err)
+	}
+	if w.Check(t.Context()) == nil {
+		t.Error("ready after a required task failed")
+	}
+}
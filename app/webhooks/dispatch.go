@@ -0,0 +1,235 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+)
+
+// maxAttempts bounds the tries to deliver one event to one destination.
+const maxAttempts = 3
+
+var deliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "webhook_deliveries_total",
+	Help: "Outgoing webhook deliveries by destination host and result (delivered, rejected, failed, unsigned or dropped).",
+}, []string{"destination", "result"})
+
+// DispatchOptions configures a Dispatcher.
+type DispatchOptions struct {
+	// URLs receive every dispatched event.
+	URLs []string
+	// Events are the event type prefixes dispatched, e.g. "deployment.";
+	// empty dispatches every event.
+	Events []string
+	// BufferSize is how many events may wait to be delivered; further
+	// events are dropped rather than blocking the publisher.
+	BufferSize int
+}
+
+// Dispatcher delivers bus events to webhook receivers from a background
+// loop, signed by Keys. Delivery is at least once: receivers deduplicate by
+// the Webhook-Id header, which is the event ID.
+type Dispatcher struct {
+	keys   *Keys
+	client *http.Client
+	opts   DispatchOptions
+	logger *zap.Logger
+
+	queue    chan events.Event
+	stop     chan struct{}
+	done     chan struct{}
+	stopping atomic.Bool
+}
+
+// NewDispatcher creates a dispatcher and starts its delivery loop.
+func NewDispatcher(keys *Keys, client *http.Client, opts DispatchOptions, logger *zap.Logger) *Dispatcher {
+	d := &Dispatcher{
+		keys:   keys,
+		client: client,
+		opts:   opts,
+		logger: logger,
+		queue:  make(chan events.Event, max(opts.BufferSize, 1)),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+// HandleEvent queues e if its type is dispatched. Subscribe it to the bus.
+// Events from other instances (see events.WithRemote) are dispatched by
+// the instance that published them.
+func (d *Dispatcher) HandleEvent(ctx context.Context, e events.Event) {
+	if events.IsRemote(ctx) || !d.dispatches(e.Type) {
+		return
+	}
+	if d.stopping.Load() {
+		d.count("dropped")
+		return
+	}
+	select {
+	case d.queue <- e:
+	default:
+		d.count("dropped")
+	}
+}
+
+func (d *Dispatcher) dispatches(eventType string) bool {
+	if len(d.opts.Events) == 0 {
+		return true
+	}
+	for _, prefix := range d.opts.Events {
+		if strings.HasPrefix(eventType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Dispatcher) count(result string) {
+	for _, u := range d.opts.URLs {
+		deliveries.WithLabelValues(destination(u), result).Inc()
+	}
+}
+
+func (d *Dispatcher) run() {
+	defer close(d.done)
+	for {
+		select {
+		case e := <-d.queue:
+			d.dispatch(e)
+		case <-d.stop:
+			for {
+				select {
+				case e := <-d.queue:
+					d.dispatch(e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) dispatch(e events.Event) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		d.logger.Warn("failed to encode webhook", zap.String("event_id", e.ID), zap.Error(err))
+		return
+	}
+	for _, u := range d.opts.URLs {
+		result, err := d.deliver(u, e.ID, body)
+		deliveries.WithLabelValues(destination(u), result).Inc()
+		if err != nil {
+			d.logger.Warn("failed to deliver webhook",
+				zap.String("destination", destination(u)),
+				zap.String("event_id", e.ID),
+				zap.String("event_type", e.Type),
+				zap.String("result", result),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// deliver posts body to u, retrying server errors, and returns the result
+// to count.
+func (d *Dispatcher) deliver(u, id string, body []byte) (string, error) {
+	var err error
+	for attempt := range maxAttempts {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff(attempt - 1)):
+			case <-d.stop:
+				// Shutting down: one more try, without waiting
+			}
+		}
+		var retry bool
+		retry, err = d.post(u, id, body)
+		if err == nil {
+			return "delivered", nil
+		}
+		if errors.Is(err, ErrNoKeys) {
+			return "unsigned", err
+		}
+		if !retry {
+			return "rejected", err
+		}
+	}
+	return "failed", err
+}
+
+// post makes one delivery attempt, signed at the time it is made, and
+// reports whether a failure is worth retrying.
+func (d *Dispatcher) post(u, id string, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ts := time.Now()
+	sig, err := d.keys.Sign(ctx, id, ts, body)
+	if err != nil {
+		return !errors.Is(err, ErrNoKeys), err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, id)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts.Unix(), 10))
+	req.Header.Set(HeaderSignature, sig)
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout ||
+		resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("receiver responded %s", resp.Status)
+}
+
+// Shutdown stops accepting events and delivers those queued, waiting for
+// them or ctx to expire.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	if d.stopping.Swap(true) {
+		return nil
+	}
+	close(d.stop)
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// destination labels deliveries to u by its host.
+func destination(u string) string {
+	if parsed, err := url.Parse(u); err == nil && parsed.Host != "" {
+		return parsed.Host
+	}
+	return u
+}
+
+// backoff returns the wait before retry attempt n (from 0), capped at 30s.
+func backoff(n int) time.Duration {
+	return min(time.Second<<min(n, 5), 30*time.Second)
+}
@@ -0,0 +1,100 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/authz"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+// KeyHandler serves the signing key endpoints. The public keys are open to
+// all; access to the others is decided by the rbac rules for webhooks:read
+// and webhooks:rotate.
+type KeyHandler struct {
+	keys    *Keys
+	headers authz.Headers
+	logger  *zap.Logger
+}
+
+// NewKeyHandler creates the signing key endpoints for keys.
+func NewKeyHandler(keys *Keys, headers authz.Headers, logger *zap.Logger) *KeyHandler {
+	return &KeyHandler{keys: keys, headers: headers, logger: logger}
+}
+
+// Register mounts the endpoints on mux:
+//
+//	GET  /.well-known/webhook-keys            the Ed25519 keys that sign deliveries, for receivers
+//	GET  /api/v1/admin/webhooks/keys          the signing keys, without secrets
+//	POST /api/v1/admin/webhooks/keys/rotate   create a key and retire the others after the grace period
+func (h *KeyHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /.well-known/webhook-keys", h.public)
+	mux.HandleFunc("GET /api/v1/admin/webhooks/keys", h.list)
+	mux.HandleFunc("POST /api/v1/admin/webhooks/keys/rotate", h.rotate)
+}
+
+func (h *KeyHandler) public(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.keys.Public(r.Context())
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, map[string]any{"keys": keys})
+}
+
+func (h *KeyHandler) list(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.keys.List(r.Context())
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": keys})
+}
+
+type rotateRequest struct {
+	Algorithm string `json:"algorithm"`
+}
+
+type rotateResponse struct {
+	*store.WebhookKey
+	// Secret is the new HMAC secret, shown only here.
+	Secret string `json:"secret,omitempty"`
+}
+
+func (h *KeyHandler) rotate(w http.ResponseWriter, r *http.Request) {
+	var req rotateRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	id := h.headers.Identity(r)
+	key, secret, err := h.keys.Rotate(r.Context(), req.Algorithm, id.User)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	h.logger.Info("webhook signing key rotated",
+		zap.String("audit", "webhooks"),
+		zap.String("request_id", middleware.GetRequestID(r.Context())),
+		zap.String("user", id.User),
+		zap.Strings("groups", id.Groups),
+		zap.String("key_id", key.ID),
+		zap.String("algorithm", key.Algorithm),
+	)
+	writeJSON(w, http.StatusCreated, rotateResponse{WebhookKey: key, Secret: secret})
+}
+
+func (h *KeyHandler) fail(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrInvalidAlgorithm) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.logger.Error("webhook key request failed", zap.Error(err))
+	http.Error(w, "internal error", http.StatusInternalServerError)
+}
@@ -0,0 +1,150 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Provider knows how to authenticate and validate one sender's webhooks.
+type Provider interface {
+	// Name is the path segment and event source, e.g. "github".
+	Name() string
+	// Verify authenticates the request (signature or shared token).
+	Verify(r *http.Request, body []byte) error
+	// Parse validates the payload and returns the event type and a delivery
+	// ID used for replay protection (empty to fall back to a body hash).
+	Parse(r *http.Request, body []byte) (eventType, deliveryID string, err error)
+}
+
+var (
+	errUnauthorized = errors.New("invalid signature or token")
+	errInvalid      = errors.New("invalid payload")
+	errStale        = errors.New("delivery timestamp outside tolerance")
+)
+
+// ─── GitHub ──────────────────────────────────────────────────────────────────
+
+// GitHub verifies X-Hub-Signature-256 HMACs.
+type GitHub struct {
+	Secret string
+}
+
+func (GitHub) Name() string { return "github" }
+
+func (g GitHub) Verify(r *http.Request, body []byte) error {
+	sig, ok := strings.CutPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=")
+	if !ok {
+		return errUnauthorized
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return errUnauthorized
+	}
+	mac := hmac.New(sha256.New, []byte(g.Secret))
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return errUnauthorized
+	}
+	return nil
+}
+
+func (GitHub) Parse(r *http.Request, body []byte) (string, string, error) {
+	eventType := r.Header.Get("X-GitHub-Event")
+	delivery := r.Header.Get("X-GitHub-Delivery")
+	if eventType == "" || delivery == "" {
+		return "", "", fmt.Errorf("%w: missing X-GitHub-Event or X-GitHub-Delivery", errInvalid)
+	}
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", "", fmt.Errorf("%w: %v", errInvalid, err)
+	}
+	if eventType != "ping" {
+		if _, ok := payload["repository"]; !ok {
+			return "", "", fmt.Errorf("%w: missing repository", errInvalid)
+		}
+	}
+	return eventType, delivery, nil
+}
+
+// ─── Harbor ──────────────────────────────────────────────────────────────────
+
+// Harbor authenticates with the static Authorization header configured on
+// the Harbor webhook policy.
+type Harbor struct {
+	Secret    string
+	Tolerance time.Duration
+}
+
+func (Harbor) Name() string { return "harbor" }
+
+func (h Harbor) Verify(r *http.Request, body []byte) error {
+	return compareToken(r.Header.Get("Authorization"), h.Secret)
+}
+
+func (h Harbor) Parse(r *http.Request, body []byte) (string, string, error) {
+	var payload struct {
+		Type      string          `json:"type"`
+		OccurAt   int64           `json:"occur_at"`
+		EventData json.RawMessage `json:"event_data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", "", fmt.Errorf("%w: %v", errInvalid, err)
+	}
+	if payload.Type == "" || len(payload.EventData) == 0 {
+		return "", "", fmt.Errorf("%w: missing type or event_data", errInvalid)
+	}
+	if h.Tolerance > 0 && payload.OccurAt > 0 {
+		if age := time.Since(time.Unix(payload.OccurAt, 0)); age > h.Tolerance || age < -h.Tolerance {
+			return "", "", errStale
+		}
+	}
+	return strings.ToLower(payload.Type), "", nil
+}
+
+// ─── Alertmanager ────────────────────────────────────────────────────────────
+
+// Alertmanager authenticates with the bearer token from the receiver's
+// http_config.
+type Alertmanager struct {
+	Token string
+}
+
+func (Alertmanager) Name() string { return "alertmanager" }
+
+func (a Alertmanager) Verify(r *http.Request, body []byte) error {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return compareToken(token, a.Token)
+}
+
+func (Alertmanager) Parse(r *http.Request, body []byte) (string, string, error) {
+	var payload struct {
+		Version  string            `json:"version"`
+		Status   string            `json:"status"`
+		GroupKey string            `json:"groupKey"`
+		Alerts   []json.RawMessage `json:"alerts"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", "", fmt.Errorf("%w: %v", errInvalid, err)
+	}
+	if payload.Version != "4" || payload.Status == "" || len(payload.Alerts) == 0 {
+		return "", "", fmt.Errorf("%w: expected version 4 payload with status and alerts", errInvalid)
+	}
+	// Alertmanager re-sends a group on every repeat_interval; only exact
+	// duplicates (same body) are treated as replays.
+	return payload.Status, "", nil
+}
+
+func compareToken(got, want string) error {
+	if want == "" || subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+		return errUnauthorized
+	}
+	return nil
+}
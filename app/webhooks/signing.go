@@ -0,0 +1,226 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/encryption"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+// Headers of signed deliveries, after the Standard Webhooks specification.
+// The signature covers "<id>.<timestamp>.<body>".
+const (
+	HeaderID        = "Webhook-Id"
+	HeaderTimestamp = "Webhook-Timestamp"
+	HeaderSignature = "Webhook-Signature"
+)
+
+// hmacSecretPrefix marks HMAC secrets handed to receivers.
+const hmacSecretPrefix = "whsec_"
+
+var (
+	// ErrNoKeys is returned by Sign before the first key is created.
+	ErrNoKeys = errors.New("webhooks: no signing key")
+	// ErrInvalidAlgorithm is returned by Rotate for an unknown algorithm.
+	ErrInvalidAlgorithm = errors.New("webhooks: algorithm must be hmac-sha256 or ed25519")
+)
+
+// KeyOptions configures Keys.
+type KeyOptions struct {
+	// Algorithm is the algorithm of keys rotated in without one.
+	Algorithm string
+	// Grace is how long a rotated key keeps signing next to its successor.
+	Grace time.Duration
+	// RefreshInterval is how often the keys are read again, picking up
+	// rotations made on other replicas.
+	RefreshInterval time.Duration
+}
+
+// Keys holds the keys signing outgoing webhooks. Secrets are stored sealed
+// and opened once per refresh.
+type Keys struct {
+	repo   store.WebhookKeyRepository
+	enc    *encryption.Encryptor
+	opts   KeyOptions
+	logger *zap.Logger
+	now    func() time.Time
+
+	mu       sync.Mutex
+	signers  []signer
+	loadedAt time.Time
+}
+
+// signer is an opened key.
+type signer struct {
+	key    store.WebhookKey
+	secret []byte
+	priv   ed25519.PrivateKey
+}
+
+// NewKeys creates the signing keys stored in repo, sealed with enc.
+func NewKeys(repo store.WebhookKeyRepository, enc *encryption.Encryptor, opts KeyOptions, logger *zap.Logger) *Keys {
+	if opts.Algorithm == "" {
+		opts.Algorithm = store.WebhookHMAC
+	}
+	if opts.Grace <= 0 {
+		opts.Grace = 24 * time.Hour
+	}
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = time.Minute
+	}
+	return &Keys{repo: repo, enc: enc, opts: opts, logger: logger, now: time.Now}
+}
+
+// List returns the keys, newest first, without their secrets.
+func (k *Keys) List(ctx context.Context) ([]store.WebhookKey, error) {
+	return k.repo.List(ctx)
+}
+
+// Public returns the Ed25519 keys that still sign, for receivers to verify
+// with.
+func (k *Keys) Public(ctx context.Context) ([]store.WebhookKey, error) {
+	keys, err := k.repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := []store.WebhookKey{}
+	for _, key := range keys {
+		if key.Algorithm == store.WebhookEd25519 && k.active(key) {
+			out = append(out, key)
+		}
+	}
+	return out, nil
+}
+
+// Rotate creates a key of algorithm, or of the configured one, and retires
+// the others after the grace period. Keys retired earlier are deleted. For
+// an HMAC key it returns the secret, prefixed "whsec_"; it cannot be
+// read again.
+func (k *Keys) Rotate(ctx context.Context, algorithm, actor string) (*store.WebhookKey, string, error) {
+	if algorithm == "" {
+		algorithm = k.opts.Algorithm
+	}
+	key := &store.WebhookKey{ID: "whk_" + uuid.NewString(), Algorithm: algorithm, CreatedBy: actor}
+	var secret, shown []byte
+	switch algorithm {
+	case store.WebhookHMAC:
+		secret = make([]byte, 32)
+		rand.Read(secret)
+		shown = []byte(hmacSecretPrefix + base64.StdEncoding.EncodeToString(secret))
+	case store.WebhookEd25519:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, "", err
+		}
+		secret = priv.Seed()
+		key.PublicKey = base64.StdEncoding.EncodeToString(pub)
+	default:
+		return nil, "", ErrInvalidAlgorithm
+	}
+	sealed, err := k.enc.Seal(ctx, secret, []byte(key.ID))
+	if err != nil {
+		return nil, "", fmt.Errorf("seal webhook key: %w", err)
+	}
+	key.Secret = sealed
+	if err := k.repo.Create(ctx, key); err != nil {
+		return nil, "", err
+	}
+	now := k.now()
+	if _, err := k.repo.Retire(ctx, key.ID, now.Add(k.opts.Grace)); err != nil {
+		return nil, "", err
+	}
+	if n, err := k.repo.Prune(ctx, now); err != nil {
+		k.logger.Warn("failed to prune retired webhook keys", zap.Error(err))
+	} else if n > 0 {
+		k.logger.Info("pruned retired webhook keys", zap.Int("deleted", n))
+	}
+	k.mu.Lock()
+	k.loadedAt = time.Time{}
+	k.mu.Unlock()
+	return key, string(shown), nil
+}
+
+// Sign returns the signature header value for delivery id at ts: one
+// space-separated "v1,<base64>" (HMAC-SHA256) or "v1a,<base64>" (Ed25519)
+// signature per key that still signs.
+func (k *Keys) Sign(ctx context.Context, id string, ts time.Time, body []byte) (string, error) {
+	signers, err := k.load(ctx)
+	if err != nil {
+		return "", err
+	}
+	msg := signedContent(id, ts, body)
+	var sigs []string
+	for _, s := range signers {
+		if !k.active(s.key) {
+			continue
+		}
+		if s.priv != nil {
+			sigs = append(sigs, "v1a,"+base64.StdEncoding.EncodeToString(ed25519.Sign(s.priv, msg)))
+			continue
+		}
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write(msg)
+		sigs = append(sigs, "v1,"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	}
+	if len(sigs) == 0 {
+		return "", ErrNoKeys
+	}
+	return strings.Join(sigs, " "), nil
+}
+
+func (k *Keys) active(key store.WebhookKey) bool {
+	return key.RetiresAt == nil || k.now().Before(*key.RetiresAt)
+}
+
+// load returns the opened keys, reading them again once RefreshInterval
+// has passed. If that fails, the keys read last are used.
+func (k *Keys) load(ctx context.Context) ([]signer, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if !k.loadedAt.IsZero() && k.now().Sub(k.loadedAt) < k.opts.RefreshInterval {
+		return k.signers, nil
+	}
+	keys, err := k.repo.List(ctx)
+	if err != nil {
+		if k.signers != nil {
+			k.logger.Warn("failed to refresh webhook keys", zap.Error(err))
+			return k.signers, nil
+		}
+		return nil, err
+	}
+	signers := make([]signer, 0, len(keys))
+	for _, key := range keys {
+		if !k.active(key) {
+			continue
+		}
+		secret, err := k.enc.Open(ctx, key.Secret, []byte(key.ID))
+		if err != nil {
+			return nil, fmt.Errorf("open webhook key %s: %w", key.ID, err)
+		}
+		s := signer{key: key, secret: secret}
+		if key.Algorithm == store.WebhookEd25519 {
+			s.priv = ed25519.NewKeyFromSeed(secret)
+		}
+		signers = append(signers, s)
+	}
+	k.signers, k.loadedAt = signers, k.now()
+	return signers, nil
+}
+
+func signedContent(id string, ts time.Time, body []byte) []byte {
+	return fmt.Appendf(nil, "%s.%s.%s", id, strconv.FormatInt(ts.Unix(), 10), body)
+}
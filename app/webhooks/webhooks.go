@@ -0,0 +1,201 @@
+// Package webhooks receives webhooks from external systems (GitHub, Harbor,
+// Alertmanager), authenticates and validates them per provider, rejects
+// replays, and publishes them onto the internal event bus as
+// "webhook.<provider>.<type>" events. It also dispatches bus events to
+// external receivers, signed with keys it rotates.
+package webhooks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/middleware"
+)
+
+// maxBodyBytes bounds webhook payloads (GitHub caps deliveries at 25MB, but
+// the events we care about are far smaller).
+const maxBodyBytes = 5 << 20
+
+var received = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "webhooks_received_total",
+	Help: "Webhook deliveries by provider and result.",
+}, []string{"provider", "result"})
+
+// Receiver dispatches POST /webhooks/{provider} to the matching provider.
+type Receiver struct {
+	providers map[string]Provider
+	bus       events.Publisher
+	seen      *replayCache
+	logger    *zap.Logger
+}
+
+// NewReceiver creates a receiver. Deliveries seen within replayWindow are
+// rejected as replays.
+func NewReceiver(bus events.Publisher, replayWindow time.Duration, logger *zap.Logger, providers ...Provider) *Receiver {
+	r := &Receiver{
+		providers: make(map[string]Provider),
+		bus:       bus,
+		seen:      newReplayCache(replayWindow),
+		logger:    logger,
+	}
+	for _, p := range providers {
+		r.providers[p.Name()] = p
+	}
+	return r
+}
+
+// Providers returns the names of the enabled providers.
+func (rc *Receiver) Providers() []string {
+	names := make([]string, 0, len(rc.providers))
+	for name := range rc.providers {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (rc *Receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("provider")
+	p, ok := rc.providers[name]
+	if !ok {
+		rc.reject(w, r, name, "unknown_provider", http.StatusNotFound, "unknown webhook provider")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		rc.reject(w, r, name, "too_large", http.StatusRequestEntityTooLarge, "payload too large")
+		return
+	}
+
+	if err := p.Verify(r, body); err != nil {
+		rc.reject(w, r, name, "unauthorized", http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	eventType, deliveryID, err := p.Parse(r, body)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errStale) {
+			status = http.StatusConflict
+		}
+		rc.reject(w, r, name, "invalid", status, err.Error())
+		return
+	}
+
+	if deliveryID == "" {
+		sum := sha256.Sum256(body)
+		deliveryID = hex.EncodeToString(sum[:])
+	}
+	if !rc.seen.add(name + "/" + deliveryID) {
+		// Acknowledge so the sender stops retrying, but do not re-dispatch
+		received.WithLabelValues(name, "replay").Inc()
+		writeJSON(w, http.StatusOK, map[string]string{"status": "duplicate"})
+		return
+	}
+
+	event, err := events.New("webhook."+name+"."+eventType, name, json.RawMessage(body))
+	if err == nil {
+		event.ID = deliveryID
+		err = rc.bus.Publish(r.Context(), event)
+	}
+	if err != nil {
+		rc.seen.remove(name + "/" + deliveryID)
+		rc.logger.Error("failed to dispatch webhook", zap.String("provider", name), zap.Error(err))
+		received.WithLabelValues(name, "dispatch_error").Inc()
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "dispatch failed"})
+		return
+	}
+
+	received.WithLabelValues(name, "accepted").Inc()
+	rc.logger.Info("webhook accepted",
+		zap.String("request_id", middleware.GetRequestID(r.Context())),
+		zap.String("provider", name),
+		zap.String("event_type", eventType),
+		zap.String("delivery_id", deliveryID),
+	)
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "accepted", "id": deliveryID})
+}
+
+func (rc *Receiver) reject(w http.ResponseWriter, r *http.Request, provider, result string, status int, msg string) {
+	received.WithLabelValues(provider, result).Inc()
+	rc.logger.Warn("webhook rejected",
+		zap.String("request_id", middleware.GetRequestID(r.Context())),
+		zap.String("provider", provider),
+		zap.String("reason", msg),
+	)
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	codec.Encode(w, v)
+}
+
+// replayCache remembers delivery IDs for a fixed window. It is local to
+// the replica: a replay reaching another replica is not caught.
+type replayCache struct {
+	window time.Duration
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+	// order holds the IDs in the order they were seen, so expired ones
+	// are evicted from the front without scanning the map
+	order []seenEntry
+}
+
+type seenEntry struct {
+	id string
+	at time.Time
+}
+
+func newReplayCache(window time.Duration) *replayCache {
+	return &replayCache{window: window, seen: make(map[string]time.Time)}
+}
+
+// add records id and reports whether it was new.
+func (c *replayCache) add(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.evict(now)
+	if _, dup := c.seen[id]; dup {
+		return false
+	}
+	c.seen[id] = now
+	c.order = append(c.order, seenEntry{id: id, at: now})
+	return true
+}
+
+// evict forgets the IDs seen longer than the window ago.
+func (c *replayCache) evict(now time.Time) {
+	n := 0
+	for ; n < len(c.order) && now.Sub(c.order[n].at) > c.window; n++ {
+		e := c.order[n]
+		// An ID removed and seen again has a later entry of its own
+		if at, ok := c.seen[e.id]; ok && at.Equal(e.at) {
+			delete(c.seen, e.id)
+		}
+	}
+	clear(c.order[:n])
+	c.order = c.order[n:]
+}
+
+func (c *replayCache) remove(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.seen, id)
+}
@@ -0,0 +1,203 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/encryption"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/events"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/store"
+)
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func githubRequest(body, signature, delivery string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/github", strings.NewReader(body))
+	req.SetPathValue("provider", "github")
+	req.Header.Set("X-GitHub-Event", "push")
+	req.Header.Set("X-GitHub-Delivery", delivery)
+	req.Header.Set("X-Hub-Signature-256", signature)
+	return req
+}
+
+func TestGitHubWebhook(t *testing.T) {
+	bus := events.NewMemoryBus()
+	var got []events.Event
+	bus.Subscribe(func(_ context.Context, e events.Event) { got = append(got, e) })
+
+	rc := NewReceiver(bus, time.Hour, zap.NewNop(), GitHub{Secret: "s3cret"})
+	body := `{"ref":"refs/heads/main","repository":{"full_name":"org/repo"}}`
+
+	// Valid delivery is dispatched
+	rec := httptest.NewRecorder()
+	rc.ServeHTTP(rec, githubRequest(body, sign("s3cret", body), "d-1"))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(got) != 1 || got[0].Type != "webhook.github.push" {
+		t.Fatalf("expected one webhook.github.push event, got %+v", got)
+	}
+
+	// Replay is acknowledged but not dispatched again
+	rec = httptest.NewRecorder()
+	rc.ServeHTTP(rec, githubRequest(body, sign("s3cret", body), "d-1"))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200 for replay, got %d", rec.Code)
+	}
+	if len(got) != 1 {
+		t.Errorf("expected replay not to be dispatched, got %d events", len(got))
+	}
+
+	// Bad signature is rejected
+	rec = httptest.NewRecorder()
+	rc.ServeHTTP(rec, githubRequest(body, sign("wrong", body), "d-2"))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", rec.Code)
+	}
+}
+
+func TestAlertmanagerValidation(t *testing.T) {
+	rc := NewReceiver(events.NewMemoryBus(), time.Hour, zap.NewNop(), Alertmanager{Token: "tok"})
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/alertmanager", strings.NewReader(`{"version":"4","status":"firing"}`))
+	req.SetPathValue("provider", "alertmanager")
+	req.Header.Set("Authorization", "Bearer tok")
+	rec := httptest.NewRecorder()
+	rc.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for payload without alerts, got %d", rec.Code)
+	}
+}
+
+func TestSignedDelivery(t *testing.T) {
+	keyring, err := encryption.NewKeyring(map[string]string{"k1": base64.StdEncoding.EncodeToString(make([]byte, 32))}, "k1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	keys := NewKeys(store.NewMemory().WebhookKeys, encryption.New(keyring), KeyOptions{Grace: time.Hour}, zap.NewNop())
+	keys.now = func() time.Time { return now }
+
+	var mu sync.Mutex
+	var got []*http.Request
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		got, bodies = append(got, r), append(bodies, string(body))
+	}))
+	defer srv.Close()
+	// Publish one event, wait for its delivery and return its signatures
+	deliver := func() (*http.Request, string, []string) {
+		t.Helper()
+		d := NewDispatcher(keys, srv.Client(), DispatchOptions{URLs: []string{srv.URL}, Events: []string{"deployment."}, BufferSize: 4}, zap.NewNop())
+		bus := events.NewMemoryBus()
+		bus.Subscribe(d.HandleEvent)
+		e, _ := events.New("deployment.succeeded", "test", map[string]string{"service": "api"})
+		other, _ := events.New("tenant.created", "test", nil)
+		bus.Publish(t.Context(), e)
+		bus.Publish(t.Context(), other)
+		if err := d.Shutdown(t.Context()); err != nil {
+			t.Fatalf("Shutdown: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if len(got) != 1 || got[0].Header.Get(HeaderID) != e.ID {
+			t.Fatalf("delivered %d requests, want one for %s", len(got), e.ID)
+		}
+		r, body := got[0], bodies[0]
+		got, bodies = nil, nil
+		return r, body, strings.Fields(r.Header.Get(HeaderSignature))
+	}
+
+	// Before the first key, nothing is delivered unsigned
+	d := NewDispatcher(keys, srv.Client(), DispatchOptions{URLs: []string{srv.URL}}, zap.NewNop())
+	d.HandleEvent(t.Context(), events.Event{ID: "e1", Type: "deployment.succeeded"})
+	d.Shutdown(t.Context())
+	if len(got) != 0 {
+		t.Fatalf("delivered %d requests without a key", len(got))
+	}
+
+	first, secret, err := keys.Rotate(t.Context(), "", "alice")
+	if err != nil || !strings.HasPrefix(secret, "whsec_") || first.Secret == secret {
+		t.Fatalf("Rotate = %+v, %q, %v", first, secret, err)
+	}
+	hmacKey, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, "whsec_"))
+	validHMAC := func(r *http.Request, body, sig string) bool {
+		mac := hmac.New(sha256.New, hmacKey)
+		mac.Write([]byte(r.Header.Get(HeaderID) + "." + r.Header.Get(HeaderTimestamp) + "." + body))
+		return sig == "v1,"+base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+	r, body, sigs := deliver()
+	if len(sigs) != 1 || !validHMAC(r, body, sigs[0]) {
+		t.Fatalf("signatures %q do not verify", sigs)
+	}
+
+	// Rotating to Ed25519 signs with both keys for the grace period, and
+	// publishes the new public key
+	second, secret, err := keys.Rotate(t.Context(), store.WebhookEd25519, "alice")
+	if err != nil || secret != "" {
+		t.Fatalf("Rotate = %+v, %q, %v", second, secret, err)
+	}
+	public, err := keys.Public(t.Context())
+	if err != nil || len(public) != 1 || public[0].ID != second.ID {
+		t.Fatalf("Public = %+v, %v", public, err)
+	}
+	pub, _ := base64.StdEncoding.DecodeString(public[0].PublicKey)
+	validEd25519 := func(r *http.Request, body, sig string) bool {
+		raw, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(sig, "v1a,"))
+		msg := r.Header.Get(HeaderID) + "." + r.Header.Get(HeaderTimestamp) + "." + body
+		return strings.HasPrefix(sig, "v1a,") && ed25519.Verify(pub, []byte(msg), raw)
+	}
+	r, body, sigs = deliver()
+	if len(sigs) != 2 || !validEd25519(r, body, sigs[0]) || !validHMAC(r, body, sigs[1]) {
+		t.Fatalf("signatures %q do not verify", sigs)
+	}
+
+	now = now.Add(2 * time.Hour)
+	r, body, sigs = deliver()
+	if len(sigs) != 1 || !validEd25519(r, body, sigs[0]) {
+		t.Fatalf("signatures %q after the grace period", sigs)
+	}
+	if _, _, err := keys.Rotate(t.Context(), "rsa", "alice"); err != ErrInvalidAlgorithm {
+		t.Errorf("unknown algorithm: %v", err)
+	}
+}
+
+func TestReplayCacheExpires(t *testing.T) {
+	c := newReplayCache(time.Minute)
+	if !c.add("a") || !c.add("b") || c.add("a") {
+		t.Fatal("expected only the repeated ID to be a replay")
+	}
+	c.remove("b")
+	if !c.add("b") {
+		t.Fatal("expected a removed ID to be new again")
+	}
+
+	c.evict(time.Now().Add(2 * time.Minute))
+	if len(c.seen) != 0 || len(c.order) != 0 {
+		t.Errorf("expected every ID evicted after the window, got %v and %v", c.seen, c.order)
+	}
+	if !c.add("a") {
+		t.Error("expected an expired ID to be new again")
+	}
+}
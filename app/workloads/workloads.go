@@ -0,0 +1,340 @@
+// Package workloads serves a read-only catalog of cluster workloads
+// (Deployments and StatefulSets) from shared informer caches, so listing
+// issues no live LIST calls against the API server unless a caller asks
+// for a fresher list with ?freshness=.
+package workloads
+
+import (
+	"encoding/base64"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/codec"
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/kube"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+// Workload is one catalog entry.
+type Workload struct {
+	Kind      string            `json:"kind"`
+	Namespace string            `json:"namespace"`
+	Name      string            `json:"name"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Images    []string          `json:"images"`
+	Replicas  Replicas          `json:"replicas"`
+	Created   time.Time         `json:"created"`
+}
+
+// Replicas summarises rollout status.
+type Replicas struct {
+	Desired   int32 `json:"desired"`
+	Ready     int32 `json:"ready"`
+	Available int32 `json:"available"`
+	Updated   int32 `json:"updated"`
+}
+
+// listResponse is a page of workloads.
+type listResponse struct {
+	Items []Workload `json:"items"`
+	// Continue is passed back as ?continue= to fetch the next page; empty on
+	// the last page.
+	Continue string `json:"continue,omitempty"`
+}
+
+// Catalog lists workloads in the allowed namespaces.
+type Catalog struct {
+	clientset            kubernetes.Interface
+	deployments          appslisters.DeploymentLister
+	deploymentsInformer  cache.SharedIndexInformer
+	statefulSets         appslisters.StatefulSetLister
+	statefulSetsInformer cache.SharedIndexInformer
+	allowed              map[string]bool
+}
+
+// New registers the Deployment and StatefulSet informers on factory; the
+// factory must be started afterwards. cs serves the reads that must be
+// fresher than the caches. An empty namespaces list allows all namespaces.
+func New(cs kubernetes.Interface, factory informers.SharedInformerFactory, namespaces []string) *Catalog {
+	deployments := factory.Apps().V1().Deployments()
+	statefulSets := factory.Apps().V1().StatefulSets()
+	c := &Catalog{
+		clientset:            cs,
+		deployments:          deployments.Lister(),
+		deploymentsInformer:  deployments.Informer(),
+		statefulSets:         statefulSets.Lister(),
+		statefulSetsInformer: statefulSets.Informer(),
+	}
+	if len(namespaces) > 0 {
+		c.allowed = make(map[string]bool, len(namespaces))
+		for _, ns := range namespaces {
+			c.allowed[ns] = true
+		}
+	}
+	return c
+}
+
+// Register mounts the catalog endpoints on mux.
+func (c *Catalog) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/workloads/deployments", c.listDeployments)
+	mux.HandleFunc("GET /api/v1/workloads/statefulsets", c.listStatefulSets)
+}
+
+// List returns the Deployments and StatefulSets in the allowed namespaces
+// (or only in namespace, if set) matching selector, unsorted.
+func (c *Catalog) List(namespace string, selector labels.Selector) ([]Workload, error) {
+	q := query{namespace: namespace, allowed: c.allowed}
+	deployments, err := c.deployments.List(selector)
+	if err != nil {
+		return nil, err
+	}
+	statefulSets, err := c.statefulSets.List(selector)
+	if err != nil {
+		return nil, err
+	}
+	var out []Workload
+	for _, d := range deployments {
+		if q.matches(d.Namespace) {
+			out = append(out, deploymentWorkload(d))
+		}
+	}
+	for _, s := range statefulSets {
+		if q.matches(s.Namespace) {
+			out = append(out, statefulSetWorkload(s))
+		}
+	}
+	return out, nil
+}
+
+func (c *Catalog) listDeployments(w http.ResponseWriter, r *http.Request) {
+	q, ok := c.parseQuery(w, r)
+	if !ok {
+		return
+	}
+	var items []*appsv1.Deployment
+	var err error
+	if q.freshness.Cached(c.deploymentsInformer) {
+		items, err = c.deployments.List(q.selector)
+	} else {
+		var list *appsv1.DeploymentList
+		list, err = c.clientset.AppsV1().Deployments(q.namespace).List(r.Context(), metav1.ListOptions{LabelSelector: q.selector.String()})
+		if err == nil {
+			items = pointers(list.Items)
+		}
+	}
+	if err != nil {
+		http.Error(w, "failed to list deployments", http.StatusInternalServerError)
+		return
+	}
+
+	var out []Workload
+	for _, d := range items {
+		if !q.matches(d.Namespace) {
+			continue
+		}
+		out = append(out, deploymentWorkload(d))
+	}
+	writePage(w, out, q)
+}
+
+func (c *Catalog) listStatefulSets(w http.ResponseWriter, r *http.Request) {
+	q, ok := c.parseQuery(w, r)
+	if !ok {
+		return
+	}
+	var items []*appsv1.StatefulSet
+	var err error
+	if q.freshness.Cached(c.statefulSetsInformer) {
+		items, err = c.statefulSets.List(q.selector)
+	} else {
+		var list *appsv1.StatefulSetList
+		list, err = c.clientset.AppsV1().StatefulSets(q.namespace).List(r.Context(), metav1.ListOptions{LabelSelector: q.selector.String()})
+		if err == nil {
+			items = pointers(list.Items)
+		}
+	}
+	if err != nil {
+		http.Error(w, "failed to list statefulsets", http.StatusInternalServerError)
+		return
+	}
+
+	var out []Workload
+	for _, s := range items {
+		if !q.matches(s.Namespace) {
+			continue
+		}
+		out = append(out, statefulSetWorkload(s))
+	}
+	writePage(w, out, q)
+}
+
+func deploymentWorkload(d *appsv1.Deployment) Workload {
+	desired := int32(1)
+	if d.Spec.Replicas != nil {
+		desired = *d.Spec.Replicas
+	}
+	return Workload{
+		Kind:      "Deployment",
+		Namespace: d.Namespace,
+		Name:      d.Name,
+		Labels:    d.Labels,
+		Images:    images(d.Spec.Template.Spec),
+		Replicas: Replicas{
+			Desired:   desired,
+			Ready:     d.Status.ReadyReplicas,
+			Available: d.Status.AvailableReplicas,
+			Updated:   d.Status.UpdatedReplicas,
+		},
+		Created: d.CreationTimestamp.UTC(),
+	}
+}
+
+func statefulSetWorkload(s *appsv1.StatefulSet) Workload {
+	desired := int32(1)
+	if s.Spec.Replicas != nil {
+		desired = *s.Spec.Replicas
+	}
+	return Workload{
+		Kind:      "StatefulSet",
+		Namespace: s.Namespace,
+		Name:      s.Name,
+		Labels:    s.Labels,
+		Images:    images(s.Spec.Template.Spec),
+		Replicas: Replicas{
+			Desired:   desired,
+			Ready:     s.Status.ReadyReplicas,
+			Available: s.Status.AvailableReplicas,
+			Updated:   s.Status.UpdatedReplicas,
+		},
+		Created: s.CreationTimestamp.UTC(),
+	}
+}
+
+// pointers returns pointers to the items of a live list, as listers do.
+func pointers[T any](items []T) []*T {
+	out := make([]*T, len(items))
+	for i := range items {
+		out[i] = &items[i]
+	}
+	return out
+}
+
+func images(spec corev1.PodSpec) []string {
+	out := make([]string, 0, len(spec.InitContainers)+len(spec.Containers))
+	for _, c := range spec.InitContainers {
+		out = append(out, c.Image)
+	}
+	for _, c := range spec.Containers {
+		out = append(out, c.Image)
+	}
+	return out
+}
+
+// query holds the parsed list parameters.
+type query struct {
+	namespace string
+	allowed   map[string]bool
+	selector  labels.Selector
+	limit     int
+	after     string
+	freshness kube.Freshness
+}
+
+func (q query) matches(ns string) bool {
+	if q.namespace != "" && ns != q.namespace {
+		return false
+	}
+	return q.allowed == nil || q.allowed[ns]
+}
+
+func (c *Catalog) parseQuery(w http.ResponseWriter, r *http.Request) (query, bool) {
+	v := r.URL.Query()
+	q := query{
+		namespace: v.Get("namespace"),
+		allowed:   c.allowed,
+		selector:  labels.Everything(),
+		limit:     defaultLimit,
+	}
+
+	if q.namespace != "" && c.allowed != nil && !c.allowed[q.namespace] {
+		http.Error(w, "namespace not allowed", http.StatusForbidden)
+		return q, false
+	}
+	if s := v.Get("labelSelector"); s != "" {
+		sel, err := labels.Parse(s)
+		if err != nil {
+			http.Error(w, "invalid labelSelector: "+err.Error(), http.StatusBadRequest)
+			return q, false
+		}
+		q.selector = sel
+	}
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return q, false
+		}
+		q.limit = min(n, maxLimit)
+	}
+	if s := v.Get("continue"); s != "" {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			http.Error(w, "invalid continue token", http.StatusBadRequest)
+			return q, false
+		}
+		q.after = string(b)
+	}
+	f, err := kube.ParseFreshness(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return q, false
+	}
+	q.freshness = f
+	return q, true
+}
+
+// writePage sorts by namespace/name and returns the page after the continue
+// key. Keys rather than offsets keep pages stable as workloads come and go.
+func writePage(w http.ResponseWriter, items []Workload, q query) {
+	key := func(wl Workload) string { return wl.Namespace + "/" + wl.Name }
+	slices.SortFunc(items, func(a, b Workload) int { return strings.Compare(key(a), key(b)) })
+
+	start := 0
+	if q.after != "" {
+		start, _ = slices.BinarySearchFunc(items, q.after, func(wl Workload, k string) int {
+			if c := strings.Compare(key(wl), k); c != 0 {
+				return c
+			}
+			// Land just past an exact match
+			return -1
+		})
+	}
+	items = items[start:]
+
+	resp := listResponse{Items: items}
+	if len(items) > q.limit {
+		resp.Items = items[:q.limit]
+		resp.Continue = base64.RawURLEncoding.EncodeToString([]byte(key(resp.Items[q.limit-1])))
+	}
+	if resp.Items == nil {
+		resp.Items = []Workload{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	codec.Encode(w, resp)
+}
@@ -0,0 +1,133 @@
+package workloads
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func deployment(ns, name, team string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name, Labels: map[string]string{"team": team}},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app", Image: "registry.local/" + name + ":1.0"}},
+			}},
+		},
+	}
+}
+
+func newTestMux(t *testing.T, allowed []string, objs ...runtime.Object) *http.ServeMux {
+	t.Helper()
+	cs := fake.NewClientset(objs...)
+	return newTestMuxLive(t, cs, cs, allowed)
+}
+
+// newTestMuxLive serves cached lists from cached's objects and live ones
+// from live's.
+func newTestMuxLive(t *testing.T, cached, live *fake.Clientset, allowed []string) *http.ServeMux {
+	t.Helper()
+	factory := informers.NewSharedInformerFactory(cached, 0)
+	c := New(live, factory, allowed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		factory.Shutdown()
+	})
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+
+	mux := http.NewServeMux()
+	c.Register(mux)
+	return mux
+}
+
+func get(t *testing.T, mux *http.ServeMux, url string) (int, listResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	var resp listResponse
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+	}
+	return rec.Code, resp
+}
+
+func TestListDeploymentsFiltersNamespacesAndLabels(t *testing.T) {
+	mux := newTestMux(t, []string{"team-a", "team-b"},
+		deployment("team-a", "api", "a"),
+		deployment("team-b", "worker", "b"),
+		deployment("kube-system", "coredns", "core"),
+	)
+
+	_, resp := get(t, mux, "/api/v1/workloads/deployments")
+	if len(resp.Items) != 2 {
+		t.Fatalf("expected 2 deployments in allowed namespaces, got %d", len(resp.Items))
+	}
+	if resp.Items[0].Images[0] != "registry.local/api:1.0" {
+		t.Errorf("expected image registry.local/api:1.0, got %v", resp.Items[0].Images)
+	}
+
+	_, resp = get(t, mux, "/api/v1/workloads/deployments?labelSelector=team%3Db")
+	if len(resp.Items) != 1 || resp.Items[0].Name != "worker" {
+		t.Errorf("expected only worker, got %+v", resp.Items)
+	}
+
+	if code, _ := get(t, mux, "/api/v1/workloads/deployments?namespace=kube-system"); code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", code)
+	}
+}
+
+func TestListDeploymentsPaginates(t *testing.T) {
+	var objs []runtime.Object
+	for i := range 5 {
+		objs = append(objs, deployment("default", fmt.Sprintf("app-%d", i), "x"))
+	}
+	mux := newTestMux(t, nil, objs...)
+
+	var names []string
+	url := "/api/v1/workloads/deployments?limit=2"
+	for pages := 0; pages < 5; pages++ {
+		_, resp := get(t, mux, url)
+		for _, w := range resp.Items {
+			names = append(names, w.Name)
+		}
+		if resp.Continue == "" {
+			break
+		}
+		url = "/api/v1/workloads/deployments?limit=2&continue=" + resp.Continue
+	}
+
+	if len(names) != 5 || names[0] != "app-0" || names[4] != "app-4" {
+		t.Errorf("expected app-0..app-4 across pages, got %v", names)
+	}
+}
+
+func TestListDeploymentsFreshness(t *testing.T) {
+	cached := fake.NewClientset(deployment("default", "api", "a"))
+	live := fake.NewClientset(deployment("default", "api", "a"), deployment("default", "worker", "a"))
+	mux := newTestMuxLive(t, cached, live, nil)
+
+	if _, resp := get(t, mux, "/api/v1/workloads/deployments"); len(resp.Items) != 1 {
+		t.Errorf("expected 1 cached deployment, got %d", len(resp.Items))
+	}
+	if _, resp := get(t, mux, "/api/v1/workloads/deployments?freshness=live&labelSelector=team%3Da"); len(resp.Items) != 2 {
+		t.Errorf("expected 2 live deployments, got %d", len(resp.Items))
+	}
+	if code, _ := get(t, mux, "/api/v1/workloads/deployments?freshness=soon"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid freshness, got %d", code)
+	}
+}
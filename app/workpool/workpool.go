@@ -0,0 +1,119 @@
+// Package workpool bounds the CPU-heavy work requests do, such as
+// rendering manifests and ranking search results, to a fixed number of
+// workers, so that a burst of such requests queues instead of
+// oversubscribing the CPUs and slowing every other request down.
+//
+// Work runs on the calling goroutine once it holds one of the workers:
+// contexts, panics and stack traces stay with the request.
+package workpool
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/virenpatel/k8s-platform-engineering-lab/app/errs"
+)
+
+var (
+	queueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "workpool_queue_depth",
+		Help: "Work waiting for a worker, by pool.",
+	}, []string{"pool"})
+	busyWorkers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "workpool_busy_workers",
+		Help: "Workers running work, by pool.",
+	}, []string{"pool"})
+	waitSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "workpool_wait_seconds",
+		Help:    "Time work waited for a worker, by pool and operation.",
+		Buckets: []float64{.0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"pool", "op"})
+	rejectedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "workpool_rejected_total",
+		Help: "Work not run by pool, operation and reason (saturated or canceled).",
+	}, []string{"pool", "op", "reason"})
+)
+
+// ErrSaturated is returned when the queue is full.
+var ErrSaturated = errs.New(errs.Unavailable, "too much work queued, try again later")
+
+// Pool runs work on a bounded number of workers. A nil *Pool runs work
+// straight away, so callers need not check whether one is configured.
+type Pool struct {
+	name     string
+	workers  chan struct{}
+	maxQueue int64
+	queued   atomic.Int64
+}
+
+// New creates a pool of workers (GOMAXPROCS when not positive) in which up
+// to queue pieces of work wait for a worker; more are rejected with
+// ErrSaturated.
+func New(name string, workers, queue int) *Pool {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return &Pool{name: name, workers: make(chan struct{}, workers), maxQueue: int64(max(queue, 0))}
+}
+
+// Do runs fn once a worker is free, returning its error. It returns
+// ErrSaturated without running fn if the queue is full, and ctx's error if
+// ctx is done first. op names the work in the metrics.
+func (p *Pool) Do(ctx context.Context, op string, fn func() error) error {
+	if p == nil {
+		return fn()
+	}
+	start := time.Now()
+	select {
+	case p.workers <- struct{}{}:
+	default:
+		if p.queued.Add(1) > p.maxQueue {
+			p.queued.Add(-1)
+			rejectedTotal.WithLabelValues(p.name, op, "saturated").Inc()
+			return ErrSaturated
+		}
+		queueDepth.WithLabelValues(p.name).Inc()
+		select {
+		case p.workers <- struct{}{}:
+			p.dequeue()
+		case <-ctx.Done():
+			p.dequeue()
+			rejectedTotal.WithLabelValues(p.name, op, "canceled").Inc()
+			return ctx.Err()
+		}
+	}
+	waitSeconds.WithLabelValues(p.name, op).Observe(time.Since(start).Seconds())
+	busyWorkers.WithLabelValues(p.name).Inc()
+	defer func() {
+		busyWorkers.WithLabelValues(p.name).Dec()
+		<-p.workers
+	}()
+	return fn()
+}
+
+func (p *Pool) dequeue() {
+	p.queued.Add(-1)
+	queueDepth.WithLabelValues(p.name).Dec()
+}
+
+// Error answers a request whose work was not run because of err, an error
+// returned by Do, and reports whether it did: a 503 to retry when the pool
+// is saturated, nothing when the request was canceled.
+func Error(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, ErrSaturated):
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return true
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return true
+	}
+	return false
+}
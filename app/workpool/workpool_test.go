@@ -0,0 +1,66 @@
+package workpool
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	p := New("test", 1, 1)
+
+	// One worker, busy until release is closed
+	release := make(chan struct{})
+	running := make(chan struct{})
+	first := make(chan error)
+	go func() {
+		first <- p.Do(t.Context(), "first", func() error {
+			close(running)
+			<-release
+			return errors.New("first failed")
+		})
+	}()
+	<-running
+
+	// The next piece of work queues, and the one after is turned away
+	ctx, cancel := context.WithCancel(t.Context())
+	queued := make(chan error)
+	go func() {
+		queued <- p.Do(ctx, "queued", func() error { return nil })
+	}()
+	for p.queued.Load() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := p.Do(t.Context(), "rejected", func() error { t.Error("ran while saturated"); return nil }); !errors.Is(err, ErrSaturated) {
+		t.Errorf("saturated pool: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	if !Error(rec, ErrSaturated) || rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("saturated response: %d %v", rec.Code, rec.Header())
+	}
+
+	// Queued work gives up with its request
+	cancel()
+	if err := <-queued; !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled work: %v", err)
+	}
+
+	// The worker's result is the work's, and it is free again after
+	close(release)
+	if err := <-first; err == nil || err.Error() != "first failed" {
+		t.Errorf("first = %v", err)
+	}
+	ran := false
+	if err := p.Do(t.Context(), "again", func() error { ran = true; return nil }); err != nil || !ran {
+		t.Errorf("after release: %v, ran %v", err, ran)
+	}
+
+	// Without a pool, work runs straight away
+	var none *Pool
+	if err := none.Do(t.Context(), "direct", func() error { return nil }); err != nil {
+		t.Errorf("nil pool: %v", err)
+	}
+}
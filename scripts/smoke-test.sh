@@ -6,6 +6,7 @@
 set -euo pipefail
 
 BASE_URL="${1:-http://localhost:9090}"
+ADMIN_URL="${2:-http://localhost:9091}"
 PASS=0
 FAIL=0
 
@@ -26,13 +27,13 @@ check() {
 }
 
 echo "============================================"
-echo "  Smoke Tests: ${BASE_URL}"
+echo "  Smoke Tests: ${BASE_URL} (admin: ${ADMIN_URL})"
 echo "============================================"
 echo ""
 
-check "Liveness probe"   "${BASE_URL}/healthz"
-check "Readiness probe"  "${BASE_URL}/readyz"
-check "Metrics endpoint" "${BASE_URL}/metrics"
+check "Liveness probe"   "${ADMIN_URL}/healthz"
+check "Readiness probe"  "${ADMIN_URL}/readyz"
+check "Metrics endpoint" "${ADMIN_URL}/metrics"
 check "Service info"     "${BASE_URL}/api/v1/info"
 check "Service status"   "${BASE_URL}/api/v1/status"
 